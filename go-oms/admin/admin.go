@@ -0,0 +1,776 @@
+// Package admin serves the OMS operations API over HTTP: queue stats, the
+// queue streams on the host, open orders, the order history, positions,
+// risk limits, session state, kill-switch resets, trade busts and
+// corrections, per-symbol traffic, surveillance alerts and the audit trail
+// of every change made through it.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"oms/audit"
+	"oms/queue"
+	"oms/refdata"
+	"oms/risk"
+	"oms/session"
+	"oms/stats"
+	"oms/store"
+	"oms/surveillance"
+	"oms/tracker"
+)
+
+// QueueStats is the part of a queue the API reports on.
+type QueueStats interface {
+	Depth() uint64
+	Capacity() uint64
+}
+
+// Server wires the OMS components into HTTP handlers. Components left nil
+// are reported as not configured.
+type Server struct {
+	Token        string // bearer token; an empty token rejects every request
+	Queues       map[string]QueueStats
+	Streams      string // directory whose queue streams /v1/streams lists, see queue.List
+	Tracker      *tracker.Tracker
+	Risk         *risk.Checker
+	Switch       *risk.KillSwitch
+	Session      *session.Session
+	Audit        *audit.Log // records every mutating request when set
+	Symbols      *stats.Symbols
+	History      store.Backend // the order history omsbroker -store keeps
+	Surveillance *surveillance.Engine
+	Control      queue.OrderQueue // where bust and correct messages are enqueued
+	Reload       func() error     // re-reads configuration files, see package reload
+}
+
+// ActorHeader names the operator behind a request in the audit log. The
+// bearer token is shared, so this is attribution, not authentication.
+const ActorHeader = "X-OMS-Actor"
+
+// Handler returns the authenticated API handler.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/queues", s.getQueues)
+	mux.HandleFunc("GET /v1/streams", s.getStreams)
+	mux.HandleFunc("GET /v1/orders", s.getOrders)
+	mux.HandleFunc("GET /v1/history/orders", s.getHistory)
+	mux.HandleFunc("GET /v1/history/orders/{order}", s.getHistoryOrder)
+	mux.HandleFunc("GET /v1/history/summary", s.getHistorySummary)
+	mux.HandleFunc("GET /v1/positions", s.getPositions)
+	mux.HandleFunc("GET /v1/limits/{client}", s.getLimits)
+	mux.HandleFunc("PUT /v1/limits/{client}", s.putLimits)
+	mux.HandleFunc("DELETE /v1/limits/{client}", s.deleteLimits)
+	mux.HandleFunc("GET /v1/accounts/{account}/limits", s.getAccountLimits)
+	mux.HandleFunc("PUT /v1/accounts/{account}/limits", s.putAccountLimits)
+	mux.HandleFunc("DELETE /v1/accounts/{account}/limits", s.deleteAccountLimits)
+	mux.HandleFunc("GET /v1/session", s.getSession)
+	mux.HandleFunc("PUT /v1/session", s.putSession)
+	mux.HandleFunc("GET /v1/killswitch", s.getKillSwitch)
+	mux.HandleFunc("POST /v1/killswitch/{client}/reset", s.resetKillSwitch)
+	mux.HandleFunc("POST /v1/reload", s.reload)
+	mux.HandleFunc("POST /v1/trades/{order}/bust", s.bustTrade)
+	mux.HandleFunc("POST /v1/trades/{order}/correct", s.correctTrade)
+	mux.HandleFunc("GET /v1/audit", s.getAudit)
+	mux.HandleFunc("GET /v1/audit/verify", s.verifyAudit)
+	mux.HandleFunc("GET /v1/stats/symbols", s.getSymbolStats)
+	mux.HandleFunc("GET /v1/surveillance/alerts", s.getSurveillanceAlerts)
+	mux.HandleFunc("GET /metrics", s.getMetrics)
+	return s.auth(mux)
+}
+
+func (s *Server) auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type queueInfo struct {
+	Name     string `json:"name"`
+	Depth    uint64 `json:"depth"`
+	Capacity uint64 `json:"capacity"`
+}
+
+func (s *Server) getQueues(w http.ResponseWriter, r *http.Request) {
+	out := make([]queueInfo, 0, len(s.Queues))
+	for name, q := range s.Queues {
+		out = append(out, queueInfo{Name: name, Depth: q.Depth(), Capacity: q.Capacity()})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+type streamInfo struct {
+	Name     string         `json:"name"`
+	Kind     string         `json:"kind,omitempty"`
+	Pair     string         `json:"pair,omitempty"`
+	Capacity uint64         `json:"capacity"`
+	Depth    uint64         `json:"depth"`
+	Head     uint64         `json:"producer_head"`
+	Tail     uint64         `json:"consumer_tail"`
+	InUse    bool           `json:"in_use"`
+	PIDs     []int          `json:"pids"`
+	Attached []attachedInfo `json:"attached"`
+	Created  time.Time      `json:"created"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type attachedInfo struct {
+	PID     int       `json:"pid"`
+	Roles   string    `json:"roles"`
+	Since   time.Time `json:"since"`
+	Orphan  bool      `json:"orphan"`
+	Foreign bool      `json:"foreign,omitempty"` // in another PID namespace
+}
+
+func (s *Server) getStreams(w http.ResponseWriter, r *http.Request) {
+	if s.Streams == "" {
+		writeError(w, http.StatusNotFound, "stream directory not configured")
+		return
+	}
+	streams, err := queue.List(s.Streams)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := make([]streamInfo, 0, len(streams))
+	for _, st := range streams {
+		info := streamInfo{
+			Name:     st.Name,
+			Kind:     st.Meta.Kind,
+			Pair:     st.Meta.Pair,
+			Capacity: st.Stats.Capacity,
+			Depth:    st.Stats.Depth,
+			Head:     st.Stats.ProducerHead,
+			Tail:     st.Stats.ConsumerTail,
+			InUse:    st.InUse,
+			PIDs:     st.PIDs,
+			Created:  st.Meta.Created,
+		}
+		for _, a := range st.Attached {
+			info.Attached = append(info.Attached, attachedInfo{
+				PID: a.PID, Roles: queue.RoleString(a.Roles), Since: a.Since, Orphan: a.Orphan(), Foreign: a.Foreign,
+			})
+		}
+		if st.Err != nil {
+			info.Error = st.Err.Error()
+		}
+		out = append(out, info)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getOrders(w http.ResponseWriter, r *http.Request) {
+	if s.Tracker == nil {
+		writeError(w, http.StatusNotFound, "order tracker not configured")
+		return
+	}
+	if c := r.URL.Query().Get("client"); c != "" {
+		clientID, err := parseClient(c)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Tracker.OpenOrders(clientID))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Tracker.All())
+}
+
+type historyPage struct {
+	Orders []store.OrderState `json:"orders"`
+	Next   uint64             `json:"next,omitempty"` // pass as after for the next page
+}
+
+// getHistory pages through stored orders, filtered by client, symbol,
+// state and an RFC 3339 from/to range.
+func (s *Server) getHistory(w http.ResponseWriter, r *http.Request) {
+	if s.History == nil {
+		writeError(w, http.StatusNotFound, "order history not configured")
+		return
+	}
+	var q store.Query
+	params := r.URL.Query()
+	if v := params.Get("client"); v != "" {
+		id, err := parseClient(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid client: "+err.Error())
+			return
+		}
+		q.ClientID = &id
+	}
+	if v := params.Get("symbol"); v != "" {
+		sym, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid symbol: "+err.Error())
+			return
+		}
+		symbol := uint32(sym)
+		q.Symbol = &symbol
+	}
+	if v := params.Get("state"); v != "" {
+		state, err := store.ParseState(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		q.State = &state
+	}
+	var ok bool
+	if q.From, q.To, ok = timeRange(w, r); !ok {
+		return
+	}
+	if v := params.Get("after"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid after: "+err.Error())
+			return
+		}
+		q.After = n
+	}
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > store.MaxLimit {
+			writeError(w, http.StatusBadRequest, "invalid limit: 1 to "+strconv.Itoa(store.MaxLimit))
+			return
+		}
+		q.Limit = n
+	}
+	page, err := s.History.Orders(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if page.Orders == nil {
+		page.Orders = []store.OrderState{}
+	}
+	writeJSON(w, http.StatusOK, historyPage{Orders: page.Orders, Next: page.Next})
+}
+
+// getHistoryOrder returns every status record stored for one order.
+func (s *Server) getHistoryOrder(w http.ResponseWriter, r *http.Request) {
+	if s.History == nil {
+		writeError(w, http.StatusNotFound, "order history not configured")
+		return
+	}
+	orderID, err := strconv.ParseUint(r.PathValue("order"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order id")
+		return
+	}
+	recs, err := s.History.Executions(r.Context(), orderID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if recs == nil {
+		recs = []store.Record{}
+	}
+	writeJSON(w, http.StatusOK, recs)
+}
+
+// getHistorySummary reports per client and symbol over from/to, by
+// default today so far.
+func (s *Server) getHistorySummary(w http.ResponseWriter, r *http.Request) {
+	if s.History == nil {
+		writeError(w, http.StatusNotFound, "order history not configured")
+		return
+	}
+	from, to, ok := timeRange(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if from.IsZero() {
+		from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+	if to.IsZero() {
+		to = now
+	}
+	sums, err := s.History.Summary(r.Context(), from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, sums)
+}
+
+// timeRange parses the optional RFC 3339 from and to parameters.
+func timeRange(w http.ResponseWriter, r *http.Request) (from, to time.Time, ok bool) {
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		v := r.URL.Query().Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid "+p.name+": "+err.Error())
+			return from, to, false
+		}
+		*p.t = t
+	}
+	return from, to, true
+}
+
+// getPositions reports per client, or with level=firm or
+// level=sub_account rolled up or down the account hierarchy.
+func (s *Server) getPositions(w http.ResponseWriter, r *http.Request) {
+	if s.Risk == nil {
+		writeError(w, http.StatusNotFound, "risk checker not configured")
+		return
+	}
+	level := refdata.LevelClient
+	if v := r.URL.Query().Get("level"); v != "" {
+		l, err := refdata.ParseLevel(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		level = l
+	}
+	writeJSON(w, http.StatusOK, s.Risk.AccountExposures(level))
+}
+
+func (s *Server) getLimits(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := s.riskClient(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Risk.Limits(clientID))
+}
+
+func (s *Server) putLimits(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := s.riskClient(w, r)
+	if !ok {
+		return
+	}
+	var limits risk.Limits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid limits: "+err.Error())
+		return
+	}
+	if err := limits.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	before := s.Risk.Limits(clientID)
+	if !s.record(w, r, "limits.set", clientID, limitChange{Before: before, After: limits}) {
+		return
+	}
+	s.Risk.SetLimits(clientID, limits)
+	writeJSON(w, http.StatusOK, limits)
+}
+
+func (s *Server) deleteLimits(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := s.riskClient(w, r)
+	if !ok {
+		return
+	}
+	if !s.record(w, r, "limits.clear", clientID, limitChange{Before: s.Risk.Limits(clientID)}) {
+		return
+	}
+	s.Risk.ClearLimits(clientID)
+	writeJSON(w, http.StatusOK, s.Risk.Limits(clientID))
+}
+
+func (s *Server) getAccountLimits(w http.ResponseWriter, r *http.Request) {
+	ref, ok := s.riskAccount(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Risk.AccountLimits(ref))
+}
+
+func (s *Server) putAccountLimits(w http.ResponseWriter, r *http.Request) {
+	ref, ok := s.riskAccount(w, r)
+	if !ok {
+		return
+	}
+	var limits risk.Limits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid limits: "+err.Error())
+		return
+	}
+	if err := limits.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	before := s.Risk.AccountLimits(ref)
+	if !s.recordTarget(w, r, "limits.set", ref.String(), limitChange{Before: before, After: limits}) {
+		return
+	}
+	s.Risk.SetAccountLimits(ref, limits)
+	writeJSON(w, http.StatusOK, limits)
+}
+
+func (s *Server) deleteAccountLimits(w http.ResponseWriter, r *http.Request) {
+	ref, ok := s.riskAccount(w, r)
+	if !ok {
+		return
+	}
+	if !s.recordTarget(w, r, "limits.clear", ref.String(), limitChange{Before: s.Risk.AccountLimits(ref)}) {
+		return
+	}
+	s.Risk.ClearAccountLimits(ref)
+	writeJSON(w, http.StatusOK, s.Risk.AccountLimits(ref))
+}
+
+func (s *Server) riskAccount(w http.ResponseWriter, r *http.Request) (refdata.AccountRef, bool) {
+	if s.Risk == nil {
+		writeError(w, http.StatusNotFound, "risk checker not configured")
+		return refdata.AccountRef{}, false
+	}
+	ref, err := refdata.ParseAccountRef(r.PathValue("account"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return refdata.AccountRef{}, false
+	}
+	return ref, true
+}
+
+func (s *Server) riskClient(w http.ResponseWriter, r *http.Request) (uint32, bool) {
+	if s.Risk == nil {
+		writeError(w, http.StatusNotFound, "risk checker not configured")
+		return 0, false
+	}
+	clientID, err := parseClient(r.PathValue("client"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return 0, false
+	}
+	return clientID, true
+}
+
+func (s *Server) getSymbolStats(w http.ResponseWriter, r *http.Request) {
+	if s.Symbols == nil {
+		writeError(w, http.StatusNotFound, "symbol stats not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Symbols.Snapshot(time.Now()))
+}
+
+func (s *Server) getMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.Symbols == nil && s.Tracker == nil {
+		writeError(w, http.StatusNotFound, "metrics not configured")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if s.Symbols != nil {
+		_ = s.Symbols.WritePrometheus(w)
+	}
+	if s.Tracker != nil {
+		// per-stage latency of the orders the tracker follows
+		_ = s.Tracker.WritePrometheus(w)
+	}
+}
+
+type sessionState struct {
+	State string `json:"state"`
+}
+
+func (s *Server) getSession(w http.ResponseWriter, r *http.Request) {
+	if s.Session == nil {
+		writeError(w, http.StatusNotFound, "session not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, sessionState{State: s.Session.State().String()})
+}
+
+func (s *Server) putSession(w http.ResponseWriter, r *http.Request) {
+	if s.Session == nil {
+		writeError(w, http.StatusNotFound, "session not configured")
+		return
+	}
+	var body sessionState
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	state, err := session.ParseState(body.State)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	change := map[string]string{"from": s.Session.State().String(), "to": state.String()}
+	if !s.record(w, r, "session.set", 0, change) {
+		return
+	}
+	s.Session.Set(state)
+	if state == session.Closed && s.Tracker != nil {
+		// the day is done: no more busts or corrections to route
+		s.Tracker.ForgetFills()
+	}
+	writeJSON(w, http.StatusOK, sessionState{State: state.String()})
+}
+
+func (s *Server) getKillSwitch(w http.ResponseWriter, r *http.Request) {
+	if s.Switch == nil {
+		writeError(w, http.StatusNotFound, "kill switch not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Switch.Breaches())
+}
+
+func (s *Server) resetKillSwitch(w http.ResponseWriter, r *http.Request) {
+	if s.Switch == nil {
+		writeError(w, http.StatusNotFound, "kill switch not configured")
+		return
+	}
+	clientID, err := parseClient(r.PathValue("client"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	breach, ok := s.Switch.Engaged(clientID)
+	if !ok {
+		writeError(w, http.StatusNotFound, "kill switch not engaged for client")
+		return
+	}
+	if !s.record(w, r, "killswitch.reset", clientID, breach) {
+		return
+	}
+	s.Switch.Reset(clientID)
+	writeJSON(w, http.StatusOK, map[string]uint32{"reset": clientID})
+}
+
+func (s *Server) reload(w http.ResponseWriter, r *http.Request) {
+	if s.Reload == nil {
+		writeError(w, http.StatusNotFound, "reload not configured")
+		return
+	}
+	if !s.record(w, r, "config.reload", 0, nil) {
+		return
+	}
+	if err := s.Reload(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"reloaded": true})
+}
+
+// tradeAmend is the body of a bust or correct request. ClientID may be left
+// out when the tracker saw the fill; Price and Quantity are the corrected
+// fill and are ignored for a bust.
+type tradeAmend struct {
+	ClientID uint32 `json:"client_id"`
+	Price    uint64 `json:"price"`
+	Quantity uint32 `json:"qty"`
+}
+
+func (s *Server) bustTrade(w http.ResponseWriter, r *http.Request) {
+	s.amendTrade(w, r, queue.MsgBust)
+}
+
+func (s *Server) correctTrade(w http.ResponseWriter, r *http.Request) {
+	s.amendTrade(w, r, queue.MsgCorrect)
+}
+
+// amendTrade sends a bust or correct message for the fill of the order in
+// the path, after checking it against the tracker and auditing it. The
+// engine's StatusBusted and StatusCorrected reports then move positions.
+func (s *Server) amendTrade(w http.ResponseWriter, r *http.Request, msgType uint8) {
+	if s.Control == nil {
+		writeError(w, http.StatusNotFound, "control queue not configured")
+		return
+	}
+	orderID, err := strconv.ParseUint(r.PathValue("order"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order id: "+err.Error())
+		return
+	}
+	var body tradeAmend
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	if s.Tracker != nil {
+		if f, ok := s.Tracker.Fill(orderID); ok {
+			if body.ClientID != 0 && body.ClientID != f.ClientID {
+				writeError(w, http.StatusBadRequest, "client_id does not match the fill")
+				return
+			}
+			body.ClientID = f.ClientID
+		}
+	}
+	if body.ClientID == 0 {
+		writeError(w, http.StatusNotFound, "fill not known here; give client_id")
+		return
+	}
+	now := uint64(time.Now().UnixNano())
+	msg, action := queue.Bust(orderID, body.ClientID, now), "trade.bust"
+	if msgType == queue.MsgCorrect {
+		if body.Price == 0 || body.Quantity == 0 {
+			writeError(w, http.StatusBadRequest, "correction needs price and qty")
+			return
+		}
+		msg, action = queue.Correct(orderID, body.ClientID, body.Price, body.Quantity, now), "trade.correct"
+	}
+	if !s.record(w, r, action, body.ClientID, auditedOrder{msg, fmt.Sprintf("%016x", msg.Fingerprint())}) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+	if err := queue.DefaultBackoff.Enqueue(ctx, s.Control, msg); err != nil {
+		writeError(w, http.StatusServiceUnavailable, "enqueue: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, msg)
+}
+
+// auditedOrder is a message sent to the engine as the audit log keeps it,
+// with the fingerprint to match it against the queue capture and replays.
+type auditedOrder struct {
+	queue.Order
+	Fingerprint string `json:"fingerprint"`
+}
+
+type limitChange struct {
+	Before risk.Limits `json:"before"`
+	After  risk.Limits `json:"after"`
+}
+
+// record appends to the audit log before a change is applied, so a change
+// that can't be audited is refused rather than made silently. clientID 0
+// means the action is not client specific.
+func (s *Server) record(w http.ResponseWriter, r *http.Request, action string, clientID uint32, detail any) bool {
+	target := ""
+	if clientID != 0 {
+		target = "client/" + strconv.FormatUint(uint64(clientID), 10)
+	}
+	return s.recordTarget(w, r, action, target, detail)
+}
+
+// recordTarget is record for a target other than a client.
+func (s *Server) recordTarget(w http.ResponseWriter, r *http.Request, action, target string, detail any) bool {
+	if s.Audit == nil {
+		return true
+	}
+	actor := r.Header.Get(ActorHeader)
+	if actor == "" {
+		actor = r.RemoteAddr
+	}
+	if _, err := s.Audit.Append(actor, action, target, detail); err != nil {
+		writeError(w, http.StatusInternalServerError, "audit log: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) getAudit(w http.ResponseWriter, r *http.Request) {
+	if s.Audit == nil {
+		writeError(w, http.StatusNotFound, "audit log not configured")
+		return
+	}
+	from, limit, ok := seqRange(w, r)
+	if !ok {
+		return
+	}
+	recs, err := s.Audit.Records(from, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "audit log: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, recs)
+}
+
+// seqRange parses the from and limit parameters of a listing by sequence
+// number, limit defaulting to 1000.
+func seqRange(w http.ResponseWriter, r *http.Request) (from uint64, limit int, ok bool) {
+	limit = 1000
+	if v := r.URL.Query().Get("from"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+			return 0, 0, false
+		}
+		from = n
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return 0, 0, false
+		}
+		limit = n
+	}
+	return from, limit, true
+}
+
+func (s *Server) getSurveillanceAlerts(w http.ResponseWriter, r *http.Request) {
+	if s.Surveillance == nil {
+		writeError(w, http.StatusNotFound, "surveillance not configured")
+		return
+	}
+	from, limit, ok := seqRange(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Surveillance.Alerts(from, limit))
+}
+
+// auditStatus is the result of verifying the audit log. Head and HeadSeq
+// are for a monitor to keep outside the host, and pass back as the seq and
+// head parameters to check the log still reaches them.
+type auditStatus struct {
+	OK      bool   `json:"ok"`
+	Records int    `json:"records"`
+	HeadSeq uint64 `json:"head_seq"`
+	Head    string `json:"head"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (s *Server) verifyAudit(w http.ResponseWriter, r *http.Request) {
+	if s.Audit == nil {
+		writeError(w, http.StatusNotFound, "audit log not configured")
+		return
+	}
+	var n int
+	var err error
+	if head := r.URL.Query().Get("head"); head != "" {
+		seq, perr := strconv.ParseUint(r.URL.Query().Get("seq"), 10, 64)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "invalid seq: "+perr.Error())
+			return
+		}
+		n, err = s.Audit.VerifyHead(seq, head)
+	} else {
+		n, err = s.Audit.Verify()
+	}
+	seq, head := s.Audit.Head()
+	if err != nil {
+		writeJSON(w, http.StatusConflict, auditStatus{HeadSeq: seq, Head: head, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, auditStatus{OK: true, Records: n, HeadSeq: seq, Head: head})
+}
+
+func parseClient(s string) (uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(id), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
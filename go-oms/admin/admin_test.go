@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"oms/audit"
+	"oms/queue"
+	"oms/risk"
+	"oms/session"
+	"oms/tracker"
+)
+
+const token = "t0ken"
+
+// do sends a request with the bearer token and decodes the JSON answer
+// into out, when given.
+func do(t *testing.T, h http.Handler, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(ActorHeader, "ops")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v in %q", method, path, err, w.Body.String())
+		}
+	}
+	return w.Code
+}
+
+func TestAuth(t *testing.T) {
+	h := (&Server{Token: token, Queues: map[string]QueueStats{"orders": queue.NewInMemory(8)}}).Handler()
+	for name, header := range map[string]string{
+		"none":      "",
+		"wrong":     "Bearer nope",
+		"no bearer": token,
+		"prefix":    "Bearer " + token[:2],
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/queues", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", name, w.Code)
+		}
+	}
+	if code := do(t, h, http.MethodGet, "/v1/queues", "", nil); code != http.StatusOK {
+		t.Errorf("with the token: status %d", code)
+	}
+
+	// an unset token locks the API rather than opening it
+	open := (&Server{}).Handler()
+	req := httptest.NewRequest(http.MethodGet, "/v1/queues", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("empty server token: status %d, want 401", w.Code)
+	}
+}
+
+func TestNotConfigured(t *testing.T) {
+	h := (&Server{Token: token}).Handler()
+	for _, path := range []string{"/v1/orders", "/v1/positions", "/v1/limits/7", "/v1/session", "/v1/killswitch", "/v1/audit", "/v1/history/orders"} {
+		if code := do(t, h, http.MethodGet, path, "", nil); code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, code)
+		}
+	}
+}
+
+func TestOrdersAndControls(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	tr := tracker.New()
+	checker := risk.NewChecker(risk.Limits{})
+	ks := risk.NewKillSwitch(nil)
+	sess := &session.Session{}
+	sess.Set(session.Open)
+	control := queue.NewInMemory(8)
+	h := (&Server{Token: token, Tracker: tr, Risk: checker, Switch: ks, Session: sess, Audit: log, Control: control}).Handler()
+
+	tr.Submit(queue.Order{OrderID: 1, ClientID: 7, Quantity: 10, Price: 100})
+	tr.Submit(queue.Order{OrderID: 2, ClientID: 8, Quantity: 5, Price: 100})
+	var open []queue.Order
+	if code := do(t, h, http.MethodGet, "/v1/orders?client=7", "", &open); code != http.StatusOK || len(open) != 1 || open[0].OrderID != 1 {
+		t.Fatalf("open orders of client 7: %d %+v", code, open)
+	}
+
+	var limits risk.Limits
+	if code := do(t, h, http.MethodPut, "/v1/limits/7", `{"max_position": 500}`, &limits); code != http.StatusOK || limits.MaxPosition != 500 {
+		t.Fatalf("put limits: %d %+v", code, limits)
+	}
+	if got := checker.Limits(7); got.MaxPosition != 500 {
+		t.Fatalf("checker has %+v after the put", got)
+	}
+	if code := do(t, h, http.MethodPut, "/v1/limits/7", `{"max_position": -1}`, nil); code != http.StatusBadRequest {
+		t.Errorf("negative limit: status %d", code)
+	}
+
+	var state sessionState
+	if code := do(t, h, http.MethodPut, "/v1/session", `{"state": "halted"}`, &state); code != http.StatusOK || sess.State() != session.Halted {
+		t.Fatalf("halt: %d, session %s", code, sess.State())
+	}
+	if code := do(t, h, http.MethodPut, "/v1/session", `{"state": "lunch"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("unknown state: status %d", code)
+	}
+
+	ks.Trip(risk.Breach{ClientID: 7, Reason: "max loss", At: time.Now()})
+	var breaches []risk.Breach
+	if code := do(t, h, http.MethodGet, "/v1/killswitch", "", &breaches); code != http.StatusOK || len(breaches) != 1 {
+		t.Fatalf("breaches: %d %+v", code, breaches)
+	}
+	if code := do(t, h, http.MethodPost, "/v1/killswitch/7/reset", "", nil); code != http.StatusOK {
+		t.Fatalf("reset: status %d", code)
+	}
+	if _, ok := ks.Engaged(7); ok {
+		t.Fatal("client 7 still fenced off after the reset")
+	}
+	if code := do(t, h, http.MethodPost, "/v1/killswitch/7/reset", "", nil); code != http.StatusNotFound {
+		t.Errorf("second reset: status %d, want 404", code)
+	}
+
+	tr.Apply(queue.Order{OrderID: 1, ClientID: 7, Quantity: 10, Price: 100, Status: queue.StatusFilled})
+	if code := do(t, h, http.MethodPost, "/v1/trades/1/bust", `{}`, nil); code != http.StatusAccepted {
+		t.Fatalf("bust: status %d", code)
+	}
+	if msg, _ := control.Dequeue(); msg == nil || msg.MsgType != queue.MsgBust || msg.ClientID != 7 {
+		t.Fatalf("control queue got %+v, want client 7's bust", msg)
+	}
+	if code := do(t, h, http.MethodPost, "/v1/trades/2/bust", `{}`, nil); code != http.StatusNotFound {
+		t.Errorf("bust of an unknown fill without client_id: status %d", code)
+	}
+
+	// every change, and only changes, in order, attributed to the actor
+	recs, err := log.Records(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, r := range recs {
+		if r.Actor != "ops" {
+			t.Errorf("record %d by %q", r.Seq, r.Actor)
+		}
+		actions = append(actions, r.Action+" "+r.Target)
+	}
+	want := "limits.set client/7,session.set ,killswitch.reset client/7,trade.bust client/7"
+	if got := strings.Join(actions, ","); got != want {
+		t.Errorf("audited %s, want %s", got, want)
+	}
+	var st auditStatus
+	if code := do(t, h, http.MethodGet, "/v1/audit/verify", "", &st); code != http.StatusOK || !st.OK || st.Records != 4 || st.HeadSeq != 4 {
+		t.Errorf("verify: %d %+v", code, st)
+	}
+	anchored := fmt.Sprintf("/v1/audit/verify?seq=%d&head=%s", st.HeadSeq, st.Head)
+	if code := do(t, h, http.MethodGet, anchored, "", &st); code != http.StatusOK || !st.OK {
+		t.Errorf("verify against its head: %d %+v", code, st)
+	}
+	if code := do(t, h, http.MethodGet, "/v1/audit/verify?seq=2&head=beef", "", &st); code != http.StatusConflict || st.OK {
+		t.Errorf("verify against a wrong head: %d %+v", code, st)
+	}
+
+	// closing the session ends the day's busts
+	tr.Submit(queue.Order{OrderID: 3, ClientID: 7, Quantity: 1, Price: 100})
+	tr.Apply(queue.Order{OrderID: 3, ClientID: 7, Quantity: 1, Price: 100, Status: queue.StatusFilled})
+	if code := do(t, h, http.MethodPut, "/v1/session", `{"state": "closed"}`, nil); code != http.StatusOK {
+		t.Fatalf("close: status %d", code)
+	}
+	if _, ok := tr.Fill(3); ok {
+		t.Error("fill kept for busts after the session closed")
+	}
+}
@@ -0,0 +1,43 @@
+// Package alertpost posts alerts to an HTTP endpoint as JSON, for the
+// packages that raise them (slo, watchdog).
+package alertpost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Webhook returns a hook that POSTs every alert to url as JSON. Posts run
+// in the background so a slow receiver never holds up whoever raised the
+// alert; failures are logged with prefix.
+func Webhook[A any](url, prefix string) func(A) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func(a A) {
+		body, err := json.Marshal(a)
+		if err != nil {
+			log.Printf("%s encode alert: %v", prefix, err)
+			return
+		}
+		go func() {
+			if err := post(client, url, body); err != nil {
+				log.Printf("%s webhook %s: %v", prefix, url, err)
+			}
+		}()
+	}
+}
+
+func post(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
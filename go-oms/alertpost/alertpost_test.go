@@ -0,0 +1,35 @@
+package alertpost
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	type alert struct {
+		Name string `json:"name"`
+	}
+	got := make(chan alert, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a alert
+		if r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&a) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got <- a
+	}))
+	defer srv.Close()
+
+	Webhook[alert](srv.URL, "[TEST]")(alert{Name: "down"})
+	select {
+	case a := <-got:
+		if a.Name != "down" {
+			t.Fatalf("posted %+v", a)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("alert never posted")
+	}
+}
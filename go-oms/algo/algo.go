@@ -0,0 +1,171 @@
+// Package algo works parent orders through child orders over time: a TWAP
+// schedule spreads the quantity evenly across a window, an iceberg shows a
+// small display quantity and replenishes it as it fills. Parent-child links
+// and fill aggregation live in the tracker, which the status reader keeps
+// current with Apply as usual; the algo only decides what to release.
+package algo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"oms/queue"
+	"oms/tracker"
+)
+
+// Schedule decides how much of a parent to release as a new child.
+type Schedule interface {
+	// Due returns the quantity to send now. p.Remaining bounds it.
+	Due(now time.Time, p tracker.Parent) uint32
+	// Finished reports that the schedule will release nothing more, even if
+	// quantity remains (e.g. the TWAP window is over).
+	Finished(now time.Time, p tracker.Parent) bool
+}
+
+// TWAP releases the parent in Slices equal children spread over
+// [Start, End). A child that ends unfilled is not chased on its own: its
+// quantity goes out with the next slice. Nothing is released from End on,
+// so whatever is unfilled by then stays unfilled.
+type TWAP struct {
+	Start, End time.Time
+	Slices     int
+}
+
+func (s TWAP) Due(now time.Time, p tracker.Parent) uint32 {
+	if now.Before(s.Start) || !now.Before(s.End) || s.Slices <= 0 {
+		return 0
+	}
+	elapsed := min(int(now.Sub(s.Start)*time.Duration(s.Slices)/s.End.Sub(s.Start))+1, s.Slices)
+	target := uint64(p.Order.Quantity) * uint64(elapsed) / uint64(s.Slices)
+	done := uint64(p.Filled + p.Live)
+	if target <= done {
+		return 0
+	}
+	return min(uint32(target-done), p.Remaining())
+}
+
+func (s TWAP) Finished(now time.Time, _ tracker.Parent) bool {
+	return !now.Before(s.End)
+}
+
+// Iceberg shows Display at a time and sends the next child only once the
+// previous one is done.
+type Iceberg struct {
+	Display uint32
+}
+
+func (s Iceberg) Due(_ time.Time, p tracker.Parent) uint32 {
+	if p.Live > 0 {
+		return 0
+	}
+	return min(s.Display, p.Remaining())
+}
+
+func (s Iceberg) Finished(time.Time, tracker.Parent) bool { return false }
+
+type working struct {
+	schedule Schedule
+	stopped  bool
+}
+
+// Engine releases children for every parent it works. It is not safe for
+// concurrent use; call Tick from one goroutine, as with expiry.Sweeper.
+type Engine struct {
+	q       queue.OrderQueue
+	tracker *tracker.Tracker
+	nextID  func() (uint64, error)
+	parents map[uint64]*working
+}
+
+// NewEngine returns an engine sending children to q. Child order ids come
+// from nextID, typically an orderid.Allocator.
+func NewEngine(q queue.OrderQueue, t *tracker.Tracker, nextID func() (uint64, error)) *Engine {
+	return &Engine{q: q, tracker: t, nextID: nextID, parents: make(map[uint64]*working)}
+}
+
+// Start begins working parent on schedule. The parent's OrderID names it
+// in the tracker and must not clash with child ids.
+func (e *Engine) Start(parent queue.Order, s Schedule) error {
+	if parent.IsControl() || parent.Quantity == 0 {
+		return errors.New("parent must be a new order with a quantity")
+	}
+	if _, dup := e.parents[parent.OrderID]; dup {
+		return fmt.Errorf("parent %d already working", parent.OrderID)
+	}
+	e.tracker.AddParent(parent)
+	e.parents[parent.OrderID] = &working{schedule: s}
+	return nil
+}
+
+// Tick releases every child that is due and retires parents that are
+// done, returning how many children it sent. A full queue stops the tick
+// early; the quantity is released on a later one.
+func (e *Engine) Tick(now time.Time) (int, error) {
+	sent := 0
+	for id, w := range e.parents {
+		p, ok := e.tracker.Parent(id)
+		if !ok {
+			delete(e.parents, id)
+			continue
+		}
+		if p.Filled >= p.Order.Quantity || (w.stopped || w.schedule.Finished(now, p)) && p.Live == 0 {
+			e.tracker.RemoveParent(id)
+			delete(e.parents, id)
+			continue
+		}
+		if w.stopped {
+			continue
+		}
+		qty := min(w.schedule.Due(now, p), p.Remaining())
+		if qty == 0 {
+			continue
+		}
+		child := p.Order
+		child.Quantity = qty
+		child.Timestamp = uint64(now.UnixNano())
+		child.Status = queue.StatusPending
+		var err error
+		if child.OrderID, err = e.nextID(); err != nil {
+			return sent, fmt.Errorf("no order id for child of %d: %w", id, err)
+		}
+		// track the child before the engine can report on it; a child that
+		// never made it onto the queue is closed again as rejected
+		e.tracker.SubmitChild(id, child)
+		if err := e.q.Enqueue(child); err != nil {
+			child.Status = queue.StatusRejected
+			child.Reason = queue.ReasonOf(err)
+			e.tracker.Apply(child)
+			if errors.Is(err, queue.ErrQueueFull) {
+				return sent, nil
+			}
+			return sent, fmt.Errorf("child of %d: %w", id, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// Cancel stops releasing children for a parent and cancels those still
+// open. The parent is retired on a later Tick once they are all done.
+func (e *Engine) Cancel(parentID uint64, now time.Time) error {
+	w, ok := e.parents[parentID]
+	if !ok {
+		return fmt.Errorf("parent %d not working", parentID)
+	}
+	w.stopped = true
+	p, _ := e.tracker.Parent(parentID)
+	for _, id := range p.Children {
+		if child, open := e.tracker.Get(id); open {
+			if err := e.q.Enqueue(queue.Cancel(id, child.ClientID, uint64(now.UnixNano()))); err != nil {
+				return fmt.Errorf("cancel child %d: %w", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Working is the number of parents being worked.
+func (e *Engine) Working() int {
+	return len(e.parents)
+}
@@ -0,0 +1,109 @@
+package algo
+
+import (
+	"testing"
+	"time"
+
+	"oms/queue"
+	"oms/tracker"
+)
+
+type harness struct {
+	q      *queue.MemQueue
+	t      *tracker.Tracker
+	e      *Engine
+	lastID uint64
+}
+
+func newHarness() *harness {
+	h := &harness{q: queue.NewInMemory(64), t: tracker.New()}
+	h.lastID = 1000
+	h.e = NewEngine(h.q, h.t, func() (uint64, error) { h.lastID++; return h.lastID, nil })
+	return h
+}
+
+// fillAll plays the engine: every queued child is filled in full.
+func (h *harness) fillAll() int {
+	n := 0
+	for {
+		o, _ := h.q.Dequeue()
+		if o == nil {
+			return n
+		}
+		if o.MsgType == queue.MsgNew {
+			o.Status = queue.StatusFilled
+			h.t.Apply(*o)
+			n++
+		}
+	}
+}
+
+func TestTWAPSlices(t *testing.T) {
+	h := newHarness()
+	start := time.Unix(1700000000, 0)
+	parent := queue.Order{OrderID: 1, ClientID: 7, Symbol: 3, Quantity: 1000, Price: 100}
+	if err := h.e.Start(parent, TWAP{Start: start, End: start.Add(10 * time.Minute), Slices: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, at := range []time.Duration{0, time.Minute, 3 * time.Minute, 5 * time.Minute, 8 * time.Minute} {
+		if _, err := h.e.Tick(start.Add(at)); err != nil {
+			t.Fatal(err)
+		}
+		h.fillAll()
+		p, _ := h.t.Parent(1)
+		want := []uint32{250, 250, 500, 750, 1000}[i]
+		if p.Filled != want {
+			t.Fatalf("after %v: filled %d, want %d", at, p.Filled, want)
+		}
+	}
+	if _, err := h.e.Tick(start.Add(9 * time.Minute)); err != nil || h.e.Working() != 0 {
+		t.Fatalf("parent not retired when filled: %d working, %v", h.e.Working(), err)
+	}
+}
+
+func TestIcebergReplenishes(t *testing.T) {
+	h := newHarness()
+	now := time.Unix(1700000000, 0)
+	h.e.Start(queue.Order{OrderID: 1, Quantity: 250}, Iceberg{Display: 100})
+
+	for _, want := range []uint32{100, 100, 50} {
+		h.e.Tick(now)
+		h.e.Tick(now) // nothing more while the child is live
+		if h.q.Depth() != 1 {
+			t.Fatalf("depth %d, want one live child", h.q.Depth())
+		}
+		o, _ := h.q.Dequeue()
+		if o.Quantity != want {
+			t.Fatalf("child quantity %d, want %d", o.Quantity, want)
+		}
+		o.Status = queue.StatusFilled
+		h.t.Apply(*o)
+	}
+	p, _ := h.t.Parent(1)
+	if p.Filled != 250 || len(p.Children) != 3 {
+		t.Fatalf("parent: %+v", p)
+	}
+}
+
+func TestCancelStopsAndCancelsChildren(t *testing.T) {
+	h := newHarness()
+	now := time.Unix(1700000000, 0)
+	h.e.Start(queue.Order{OrderID: 1, ClientID: 7, Quantity: 300}, Iceberg{Display: 100})
+	h.e.Tick(now)
+	child, _ := h.q.Dequeue()
+
+	if err := h.e.Cancel(1, now); err != nil {
+		t.Fatal(err)
+	}
+	cancel, _ := h.q.Dequeue()
+	if cancel == nil || cancel.MsgType != queue.MsgCancel || cancel.OrderID != child.OrderID {
+		t.Fatalf("cancel: %+v", cancel)
+	}
+	child.Status = queue.StatusCanceled
+	h.t.Apply(*child)
+	h.e.Tick(now)
+	if h.e.Working() != 0 || h.q.Depth() != 0 {
+		t.Fatalf("after cancel: %d working, depth %d", h.e.Working(), h.q.Depth())
+	}
+}
@@ -0,0 +1,263 @@
+// Package audit keeps an append-only log of operator actions. Each record
+// carries the SHA-256 of its predecessor, so editing, dropping or reordering
+// a line breaks the chain from that point on and Verify reports where.
+//
+// Nothing follows the last records, so cutting them off the end leaves a
+// chain that verifies. Verify catches it against the head the running Log
+// appended; across restarts only a head kept somewhere else can, so Head
+// returns it for an operator or monitor to record, and VerifyHead checks
+// the file still reaches it.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// genesis is the Prev of the first record.
+var genesis = hex.EncodeToString(make([]byte, sha256.Size))
+
+// ErrBroken is returned when the hash chain does not verify.
+var ErrBroken = errors.New("audit hash chain broken")
+
+// Record is one audited action, stored as a line of JSON.
+type Record struct {
+	Seq    uint64          `json:"seq"`
+	Time   time.Time       `json:"time"`
+	Actor  string          `json:"actor"`
+	Action string          `json:"action"`
+	Target string          `json:"target,omitempty"`
+	Detail json.RawMessage `json:"detail,omitempty"`
+	Prev   string          `json:"prev"`
+	Hash   string          `json:"hash"`
+}
+
+// digest hashes every field but Hash itself.
+func (r Record) digest() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends records to a file opened O_APPEND. Records are read back
+// from the file, never kept in memory.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	path string
+	seq  uint64
+	last string
+}
+
+// Open opens or creates the log at path. The existing chain is verified
+// first; a broken chain is an error rather than something to append past.
+func Open(path string) (*Log, error) {
+	var c chain
+	if err := scan(path, c.next); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{f: f, path: path, seq: c.seq, last: c.head()}, nil
+}
+
+// Append records an action and syncs it to disk before returning, so an
+// acknowledged admin request is never missing from the log. detail is
+// marshalled to JSON and may be nil.
+func (l *Log) Append(actor, action, target string, detail any) (Record, error) {
+	var raw json.RawMessage
+	if detail != nil {
+		b, err := json.Marshal(detail)
+		if err != nil {
+			return Record{}, fmt.Errorf("audit detail: %w", err)
+		}
+		raw = b
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec := Record{
+		Seq:    l.seq + 1,
+		Time:   time.Now().UTC(),
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Detail: raw,
+		Prev:   l.last,
+	}
+	hash, err := rec.digest()
+	if err != nil {
+		return Record{}, err
+	}
+	rec.Hash = hash
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return Record{}, err
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return Record{}, fmt.Errorf("failed to write audit record: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return Record{}, fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	l.seq, l.last = rec.Seq, rec.Hash
+	return rec, nil
+}
+
+// errDone stops a scan early.
+var errDone = errors.New("done")
+
+// Records reads up to limit records with Seq >= from from the file; limit
+// <= 0 means all.
+func (l *Log) Records(from uint64, limit int) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []Record{}
+	err := scan(l.path, func(r Record) error {
+		if r.Seq < from {
+			return nil
+		}
+		if limit > 0 && len(out) == limit {
+			return errDone
+		}
+		out = append(out, r)
+		return nil
+	})
+	if err != nil && err != errDone {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Head is the sequence number and hash of the last record appended, or 0
+// and the genesis hash for an empty log.
+func (l *Log) Head() (uint64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq, l.last
+}
+
+// Verify re-reads the file and checks the whole chain, catching edits made
+// on disk since Open, and records cut off the end since. It returns the
+// number of records verified.
+func (l *Log) Verify() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.verifyTo(l.seq, l.last)
+}
+
+// VerifyHead is Verify against a head recorded earlier with Head, perhaps
+// by another process: the chain must still pass through it.
+func (l *Log) VerifyHead(seq uint64, hash string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.verifyTo(seq, hash)
+}
+
+// verifyTo checks the chain and that record seq has hash. Called with l.mu
+// held.
+func (l *Log) verifyTo(seq uint64, hash string) (int, error) {
+	var c chain
+	found := seq == 0
+	err := scan(l.path, func(r Record) error {
+		if err := c.next(r); err != nil {
+			return err
+		}
+		if r.Seq == seq {
+			if r.Hash != hash {
+				return fmt.Errorf("%w: record %d is not the head recorded", ErrBroken, seq)
+			}
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("%w: file has %d records, the head recorded is record %d", ErrBroken, c.seq, seq)
+	}
+	if seq == l.seq && c.seq != l.seq {
+		return 0, fmt.Errorf("%w: file has %d records, %d were appended", ErrBroken, c.seq, l.seq)
+	}
+	return int(c.seq), nil
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// scan calls fn with each record in the file at path, in order, until fn
+// returns an error.
+func scan(path string, fn func(Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrBroken, line, err)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
+
+// chain checks records one at a time as they follow each other.
+type chain struct {
+	seq  uint64
+	last string
+}
+
+func (c *chain) head() string {
+	if c.seq == 0 {
+		return genesis
+	}
+	return c.last
+}
+
+func (c *chain) next(r Record) error {
+	if r.Seq != c.seq+1 {
+		return fmt.Errorf("%w: record %d has seq %d", ErrBroken, c.seq+1, r.Seq)
+	}
+	if r.Prev != c.head() {
+		return fmt.Errorf("%w: record %d does not follow record %d", ErrBroken, r.Seq, c.seq)
+	}
+	hash, err := r.digest()
+	if err != nil {
+		return err
+	}
+	if hash != r.Hash {
+		return fmt.Errorf("%w: record %d was modified", ErrBroken, r.Seq)
+	}
+	c.seq, c.last = r.Seq, r.Hash
+	return nil
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChainDetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append("ops", "limits.set", "client/1001", map[string]int{"max_position": 500})
+	l.Append("ops", "session.set", "", map[string]string{"to": "halted"})
+	l.Append("ops", "killswitch.reset", "client/1001", nil)
+	if n, err := l.Verify(); err != nil || n != 3 {
+		t.Fatalf("verify: %d records, err %v", n, err)
+	}
+	l.Close()
+
+	// Reopening continues the chain.
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := l.Append("ops", "limits.clear", "client/1001", nil)
+	if err != nil || rec.Seq != 4 {
+		t.Fatalf("append after reopen: seq %d, err %v", rec.Seq, err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.Replace(raw, []byte("500"), []byte("900"), 1), 0600)
+	if _, err := l.Verify(); !errors.Is(err, ErrBroken) {
+		t.Fatalf("verify after edit: got %v, want ErrBroken", err)
+	}
+	l.Close()
+	if _, err := Open(path); !errors.Is(err, ErrBroken) {
+		t.Fatalf("open after edit: got %v, want ErrBroken", err)
+	}
+}
+
+func TestTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for _, action := range []string{"limits.set", "session.set", "killswitch.reset"} {
+		if _, err := l.Append("ops", action, "", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seq, head := l.Head()
+	if recs, err := l.Records(2, 1); err != nil || len(recs) != 1 || recs[0].Seq != 2 {
+		t.Fatalf("records from 2: %+v %v", recs, err)
+	}
+
+	// cut the last record off: what is left still chains
+	raw, _ := os.ReadFile(path)
+	lines := bytes.SplitAfter(raw, []byte("\n"))
+	os.WriteFile(path, bytes.Join(lines[:2], nil), 0600)
+	if _, err := l.Verify(); !errors.Is(err, ErrBroken) {
+		t.Fatalf("verify after truncation: got %v, want ErrBroken", err)
+	}
+
+	// a fresh Log only catches it against the head kept elsewhere
+	fresh, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	if n, err := fresh.Verify(); err != nil || n != 2 {
+		t.Fatalf("fresh verify: %d %v", n, err)
+	}
+	if _, err := fresh.VerifyHead(seq, head); !errors.Is(err, ErrBroken) {
+		t.Fatalf("verify against head %d: got %v, want ErrBroken", seq, err)
+	}
+	if _, err := fresh.VerifyHead(1, string(lines[0])); !errors.Is(err, ErrBroken) {
+		t.Fatal("wrong hash for record 1 verified")
+	}
+}
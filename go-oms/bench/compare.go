@@ -0,0 +1,136 @@
+package bench
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// MinSamples is the fewest samples per side a comparison calls significant.
+const MinSamples = 4
+
+// Summary is a metric's samples reduced to what a report shows.
+type Summary struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+}
+
+func Summarize(samples []float64) Summary {
+	s := Summary{N: len(samples)}
+	if s.N == 0 {
+		return s
+	}
+	for _, x := range samples {
+		s.Mean += x
+	}
+	s.Mean /= float64(s.N)
+	if s.N > 1 {
+		var ss float64
+		for _, x := range samples {
+			ss += (x - s.Mean) * (x - s.Mean)
+		}
+		s.Stddev = math.Sqrt(ss / float64(s.N-1))
+	}
+	return s
+}
+
+// Change is one metric present in both runs.
+type Change struct {
+	Metric     string  `json:"metric"`
+	Unit       string  `json:"unit"`
+	Better     string  `json:"better"`
+	Base       Summary `json:"base"`
+	Current    Summary `json:"current"`
+	Delta      float64 `json:"delta"` // (current-base)/base
+	P          float64 `json:"p"`     // Mann-Whitney U, two-sided
+	Regression bool    `json:"regression"`
+	Improved   bool    `json:"improved"`
+}
+
+// Compare matches metrics by name. A change counts as a regression or an
+// improvement only when it is significant at alpha and moves the mean by
+// more than threshold (a fraction, e.g. 0.02); anything else is noise.
+// Metrics missing from either run are skipped. Results are sorted by name.
+func Compare(base, cur *Result, alpha, threshold float64) []Change {
+	var out []Change
+	for name, b := range base.Metrics {
+		c, ok := cur.Metrics[name]
+		if !ok {
+			continue
+		}
+		ch := Change{
+			Metric:  name,
+			Unit:    b.Unit,
+			Better:  b.Better,
+			Base:    Summarize(b.Samples),
+			Current: Summarize(c.Samples),
+			P:       MannWhitney(b.Samples, c.Samples),
+		}
+		if ch.Base.Mean != 0 {
+			ch.Delta = (ch.Current.Mean - ch.Base.Mean) / math.Abs(ch.Base.Mean)
+		}
+		if ch.P < alpha && math.Abs(ch.Delta) > threshold {
+			worse := ch.Delta < 0
+			if b.Better == Lower {
+				worse = ch.Delta > 0
+			}
+			ch.Regression, ch.Improved = worse, !worse
+		}
+		out = append(out, ch)
+	}
+	slices.SortFunc(out, func(a, b Change) int { return cmp.Compare(a.Metric, b.Metric) })
+	return out
+}
+
+// MannWhitney returns the two-sided p-value of the Mann-Whitney U test that
+// a and b come from the same distribution, by the normal approximation with
+// tie and continuity corrections. It makes no assumption about the shape
+// of the distribution, which suits latency samples. With fewer than
+// MinSamples on either side it returns 1.
+func MannWhitney(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 < MinSamples || n2 < MinSamples {
+		return 1
+	}
+	type obs struct {
+		v     float64
+		fromA bool
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range a {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range b {
+		all = append(all, obs{v, false})
+	}
+	slices.SortFunc(all, func(x, y obs) int { return cmp.Compare(x.v, y.v) })
+
+	// ranks from 1, ties sharing their average rank
+	var rankA, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankA += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	n := float64(n1 + n2)
+	u := rankA - float64(n1*(n1+1))/2
+	mean := float64(n1*n2) / 2
+	sigma := math.Sqrt(float64(n1*n2) / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1 // every sample equal
+	}
+	z := math.Max(math.Abs(u-mean)-0.5, 0) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
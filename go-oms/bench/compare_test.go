@@ -0,0 +1,65 @@
+package bench
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5}
+	b := []float64{6, 7, 8, 9, 10}
+	// U = 0, z = 12/sqrt(25*11/12)
+	if p := MannWhitney(a, b); math.Abs(p-0.0122) > 0.0005 {
+		t.Fatalf("disjoint samples: p = %.4f, want 0.0122", p)
+	}
+	if p := MannWhitney(a, a); p != 1 {
+		t.Fatalf("identical samples: p = %v", p)
+	}
+	if p := MannWhitney([]float64{1, 1, 1, 1}, []float64{1, 1, 1, 1}); p != 1 {
+		t.Fatalf("all ties: p = %v", p)
+	}
+	if p := MannWhitney(a[:3], b); p != 1 {
+		t.Fatalf("too few samples: p = %v", p)
+	}
+}
+
+func TestCompareDirections(t *testing.T) {
+	base, cur := NewResult("base"), NewResult("cur")
+	for i := range 10 {
+		x := float64(i)
+		base.Add("throughput", "orders/s", Higher, 1000+x)
+		cur.Add("throughput", "orders/s", Higher, 900+x) // 10% slower
+		base.Add("latency_p99", "ns", Lower, 500+x)
+		cur.Add("latency_p99", "ns", Lower, 400+x) // 20% faster
+		base.Add("latency_p50", "ns", Lower, 100+x)
+		cur.Add("latency_p50", "ns", Lower, 101+x) // noise
+		base.AddPhase("warmup", "throughput", "orders/s", Higher, 1000+x)
+		cur.AddPhase("warmup", "throughput", "orders/s", Higher, 100+x)
+	}
+	path := filepath.Join(t.TempDir(), "cur.json")
+	if err := cur.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]Change{}
+	for _, c := range Compare(base, loaded, 0.05, 0.02) {
+		got[c.Metric] = c
+	}
+	if c := got["throughput"]; !c.Regression || c.Improved {
+		t.Fatalf("throughput: %+v", c)
+	}
+	if c := got["latency_p99"]; c.Regression || !c.Improved {
+		t.Fatalf("latency_p99: %+v", c)
+	}
+	if c := got["latency_p50"]; c.Regression || c.Improved {
+		t.Fatalf("latency_p50: %+v", c)
+	}
+	if len(got) != 3 || loaded.Phases["warmup"]["throughput"].Samples[0] != 100 {
+		t.Fatalf("phases leaked into the comparison or were lost: %v", got)
+	}
+}
@@ -0,0 +1,123 @@
+package bench
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strings"
+)
+
+// ProfileKinds are the profiles a Profiler can capture.
+var ProfileKinds = []string{"cpu", "mem", "mutex"}
+
+// ParseProfiles parses a comma-separated list of ProfileKinds.
+func ParseProfiles(list string) ([]string, error) {
+	var kinds []string
+	for _, k := range strings.Split(list, ",") {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if !slices.Contains(ProfileKinds, k) {
+			return nil, fmt.Errorf("unknown profile %q (want %s)", k, strings.Join(ProfileKinds, ", "))
+		}
+		if !slices.Contains(kinds, k) {
+			kinds = append(kinds, k)
+		}
+	}
+	return kinds, nil
+}
+
+// Profiler records pprof profiles between Start and Stop only, so setup
+// and warmup stay out of them. Files are named <name>.<kind>.pprof.
+type Profiler struct {
+	dir, name string
+	kinds     []string
+	cpu       *os.File
+}
+
+// memProfileRate is the runtime default, restored at Start.
+const memProfileRate = 512 * 1024
+
+// NewProfiler prepares dir. With "mem" requested it stops heap sampling
+// until Start, so call it before the work that should not be sampled.
+func NewProfiler(dir, name string, kinds []string) (*Profiler, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if slices.Contains(kinds, "mem") {
+		runtime.MemProfileRate = 0
+	}
+	return &Profiler{dir: dir, name: name, kinds: kinds}, nil
+}
+
+func (p *Profiler) path(kind string) string {
+	return filepath.Join(p.dir, p.name+"."+kind+".pprof")
+}
+
+func (p *Profiler) Start() error {
+	for _, k := range p.kinds {
+		switch k {
+		case "cpu":
+			f, err := os.Create(p.path(k))
+			if err != nil {
+				return err
+			}
+			if err := pprof.StartCPUProfile(f); err != nil {
+				f.Close()
+				return err
+			}
+			p.cpu = f
+		case "mem":
+			runtime.MemProfileRate = memProfileRate
+		case "mutex":
+			runtime.SetMutexProfileFraction(1)
+		}
+	}
+	return nil
+}
+
+// Stop ends the window and writes the profiles, returning their paths.
+func (p *Profiler) Stop() ([]string, error) {
+	var written []string
+	for _, k := range p.kinds {
+		switch k {
+		case "cpu":
+			if p.cpu == nil {
+				continue
+			}
+			pprof.StopCPUProfile()
+			if err := p.cpu.Close(); err != nil {
+				return written, err
+			}
+			p.cpu = nil
+		case "mem":
+			// allocations since Start; sampling was off before it
+			if err := p.write(k, "allocs"); err != nil {
+				return written, err
+			}
+		case "mutex":
+			runtime.SetMutexProfileFraction(0)
+			if err := p.write(k, "mutex"); err != nil {
+				return written, err
+			}
+		}
+		written = append(written, p.path(k))
+	}
+	return written, nil
+}
+
+func (p *Profiler) write(kind, profile string) error {
+	f, err := os.Create(p.path(kind))
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(profile).WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
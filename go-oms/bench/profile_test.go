@@ -0,0 +1,37 @@
+package bench
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestProfilerWritesRequestedKinds(t *testing.T) {
+	if _, err := ParseProfiles("cpu,heap"); err == nil {
+		t.Fatal("accepted unknown profile kind")
+	}
+	kinds, err := ParseProfiles(" mem, mutex,mem ")
+	if err != nil || !slices.Equal(kinds, []string{"mem", "mutex"}) {
+		t.Fatalf("kinds %v, err %v", kinds, err)
+	}
+
+	p, err := NewProfiler(t.TempDir(), "run", kinds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	written, err := p.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("wrote %v", written)
+	}
+	for _, path := range written {
+		if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+}
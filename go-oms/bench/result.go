@@ -0,0 +1,103 @@
+// Package bench records benchmark runs in a stable JSON form and compares
+// two of them. Every metric keeps one sample per measurement interval
+// rather than a single average, so a comparison can tell a real change
+// from run-to-run noise.
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Better says which direction of a metric is an improvement.
+const (
+	Higher = "higher"
+	Lower  = "lower"
+)
+
+// Metric is one measured quantity.
+type Metric struct {
+	Unit    string    `json:"unit"`
+	Better  string    `json:"better"`
+	Samples []float64 `json:"samples"`
+}
+
+// Result is one benchmark run. Metrics are from the measured window;
+// Phases keeps the same metrics for the phases around it, such as warmup
+// and cooldown, for the report only. Compare looks at Metrics alone.
+type Result struct {
+	Name    string                       `json:"name"`
+	Started time.Time                    `json:"started"`
+	Env     map[string]string            `json:"env,omitempty"`
+	Metrics map[string]Metric            `json:"metrics"`
+	Phases  map[string]map[string]Metric `json:"phases,omitempty"`
+}
+
+// NewResult starts a result stamped with the Go runtime it runs on.
+func NewResult(name string) *Result {
+	return &Result{
+		Name:    name,
+		Started: time.Now().UTC(),
+		Env: map[string]string{
+			"go":         runtime.Version(),
+			"goos":       runtime.GOOS,
+			"goarch":     runtime.GOARCH,
+			"gomaxprocs": fmt.Sprint(runtime.GOMAXPROCS(0)),
+			"cpus":       fmt.Sprint(runtime.NumCPU()),
+		},
+		Metrics: make(map[string]Metric),
+	}
+}
+
+// Add appends a sample to a metric, creating it on first use.
+func (r *Result) Add(name, unit, better string, sample float64) {
+	add(r.Metrics, name, unit, better, sample)
+}
+
+// AddPhase is Add for a phase outside the measured window.
+func (r *Result) AddPhase(phase, name, unit, better string, sample float64) {
+	if r.Phases == nil {
+		r.Phases = make(map[string]map[string]Metric)
+	}
+	if r.Phases[phase] == nil {
+		r.Phases[phase] = make(map[string]Metric)
+	}
+	add(r.Phases[phase], name, unit, better, sample)
+}
+
+func add(metrics map[string]Metric, name, unit, better string, sample float64) {
+	m, ok := metrics[name]
+	if !ok {
+		m = Metric{Unit: unit, Better: better}
+	}
+	m.Samples = append(m.Samples, sample)
+	metrics[name] = m
+}
+
+func (r *Result) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+func Load(path string) (*Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for name, m := range r.Metrics {
+		if m.Better != Higher && m.Better != Lower {
+			return nil, fmt.Errorf("%s: metric %s: better must be %q or %q", path, name, Higher, Lower)
+		}
+	}
+	return &r, nil
+}
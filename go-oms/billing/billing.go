@@ -0,0 +1,133 @@
+// Package billing works out what clients owe in commission on their
+// executions. A fee schedule prices each fill by notional, by share and by
+// whether it added or removed liquidity; a Ledger applies the schedules to
+// status records, reversing busted fills and charging their corrections,
+// and sums them per client per trading day for the end-of-day report.
+//
+// Amounts are in price units, like Order.Price, rounded per fill.
+package billing
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+
+	"oms/queue"
+)
+
+// Schedule is one client's commission on a fill: MakerBps or TakerBps
+// basis points of the notional, by Order.Liquidity, plus PerShare per
+// share, held between Min and Max. Fills of unknown liquidity pay the
+// taker rate. A negative maker rate is a rebate, and Min does not apply
+// to it.
+type Schedule struct {
+	MakerBps float64 `yaml:"maker_bps" json:"maker_bps"`
+	TakerBps float64 `yaml:"taker_bps" json:"taker_bps"`
+	PerShare float64 `yaml:"per_share" json:"per_share"`
+	Min      int64   `yaml:"min" json:"min"`
+	Max      int64   `yaml:"max" json:"max"` // 0 for no cap
+}
+
+// Commission prices one fill.
+func (s Schedule) Commission(fill queue.Order) int64 {
+	bps := s.TakerBps
+	if fill.Liquidity == queue.LiquidityMaker {
+		bps = s.MakerBps
+	}
+	qty, notional := float64(fill.Quantity), float64(fill.Quantity)*float64(fill.Price)
+	c := int64(math.Round(notional*bps/10000 + qty*s.PerShare))
+	if c >= 0 {
+		c = max(c, s.Min)
+	}
+	if s.Max > 0 {
+		c = min(c, s.Max)
+	}
+	return c
+}
+
+// Fees maps clients to their schedules.
+type Fees struct {
+	Default Schedule
+	Clients map[uint32]Schedule
+}
+
+// For is the schedule client pays: its own, else the default.
+func (f *Fees) For(client uint32) Schedule {
+	if s, ok := f.Clients[client]; ok {
+		return s
+	}
+	return f.Default
+}
+
+// Summary is one client's commission over one trading day. Busts take a
+// fill back out of every field and corrections put the new one in, so
+// they are net.
+type Summary struct {
+	Day        string `json:"day"` // 2006-01-02
+	ClientID   uint32 `json:"client_id"`
+	Fills      int64  `json:"fills"`
+	Shares     int64  `json:"shares"`
+	Notional   int64  `json:"notional"`
+	Commission int64  `json:"commission"`
+	VenueFees  int64  `json:"venue_fees"` // Order.Fee on the fills, passed on
+}
+
+// Ledger accumulates commission per client per day. It is not safe for
+// concurrent use.
+type Ledger struct {
+	fees *Fees
+	loc  *time.Location
+	sums map[dayClient]*Summary
+}
+
+type dayClient struct {
+	day    string
+	client uint32
+}
+
+// NewLedger prices fills with fees, dividing days in loc.
+func NewLedger(fees *Fees, loc *time.Location) *Ledger {
+	return &Ledger{fees: fees, loc: loc, sums: make(map[dayClient]*Summary)}
+}
+
+// Add applies one status record read at at. Records other than fills,
+// busts and corrections of orders are ignored.
+func (l *Ledger) Add(at time.Time, status queue.Order) {
+	if status.MsgType != queue.MsgNew {
+		return
+	}
+	var sign int64
+	switch status.Status {
+	case queue.StatusFilled, queue.StatusPartial, queue.StatusCorrected:
+		sign = 1
+	case queue.StatusBusted:
+		sign = -1
+	default:
+		return
+	}
+	k := dayClient{at.In(l.loc).Format(time.DateOnly), status.ClientID}
+	s := l.sums[k]
+	if s == nil {
+		s = &Summary{Day: k.day, ClientID: k.client}
+		l.sums[k] = s
+	}
+	s.Fills += sign
+	s.Shares += sign * int64(status.Quantity)
+	s.Notional += sign * int64(status.Quantity) * int64(status.Price)
+	s.Commission += sign * l.fees.For(status.ClientID).Commission(status)
+	s.VenueFees += sign * int64(status.Fee)
+}
+
+// Summaries returns every day and client with fills, ordered by day, then
+// client.
+func (l *Ledger) Summaries() []Summary {
+	out := make([]Summary, 0, len(l.sums))
+	for _, s := range l.sums {
+		out = append(out, *s)
+	}
+	slices.SortFunc(out, func(a, b Summary) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(a.ClientID, b.ClientID))
+	})
+	return out
+}
@@ -0,0 +1,79 @@
+package billing
+
+import (
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestCommission(t *testing.T) {
+	s := Schedule{MakerBps: 0.5, TakerBps: 2, PerShare: 0.1, Min: 10, Max: 1000}
+	for _, tc := range []struct {
+		name string
+		fill queue.Order
+		want int64
+	}{
+		{"taker", queue.Order{Quantity: 100, Price: 10000, Liquidity: queue.LiquidityTaker}, 210}, // 200 + 10
+		{"maker", queue.Order{Quantity: 100, Price: 10000, Liquidity: queue.LiquidityMaker}, 60},  // 50 + 10
+		{"unknown pays taker", queue.Order{Quantity: 100, Price: 10000}, 210},
+		{"min", queue.Order{Quantity: 1, Price: 100}, 10},
+		{"max", queue.Order{Quantity: 10000, Price: 10000}, 1000},
+	} {
+		if got := s.Commission(tc.fill); got != tc.want {
+			t.Errorf("%s: commission %d, want %d", tc.name, got, tc.want)
+		}
+	}
+	rebate := Schedule{MakerBps: -1, Min: 10}
+	if got := rebate.Commission(queue.Order{Quantity: 100, Price: 10000, Liquidity: queue.LiquidityMaker}); got != -100 {
+		t.Errorf("rebate %d, want -100", got)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	fees, err := Parse([]byte("default: {taker_bps: 1}\nclients:\n  9: {per_share: 1}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLedger(fees, time.UTC)
+	day1 := time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	fill := queue.Order{OrderID: 1, ClientID: 7, Quantity: 100, Price: 10000, Fee: 5, Status: queue.StatusFilled}
+	l.Add(day1, fill)
+	l.Add(day1, queue.Order{OrderID: 2, ClientID: 9, Quantity: 30, Price: 50, Status: queue.StatusFilled})
+	l.Add(day1, queue.Order{OrderID: 3, ClientID: 9, Status: queue.StatusCanceled})
+	l.Add(day1, queue.Order{OrderID: 1, ClientID: 7, MsgType: queue.MsgCancel, Status: queue.StatusAcked})
+	// the next day, order 1's fill is busted and corrected to 100 @ 9000
+	fill.Status = queue.StatusBusted
+	l.Add(day2, fill)
+	fill.Status, fill.Price = queue.StatusCorrected, 9000
+	l.Add(day2, fill)
+
+	want := []Summary{
+		{Day: "2026-03-02", ClientID: 7, Fills: 1, Shares: 100, Notional: 1000000, Commission: 100, VenueFees: 5},
+		{Day: "2026-03-02", ClientID: 9, Fills: 1, Shares: 30, Notional: 1500, Commission: 30},
+		{Day: "2026-03-03", ClientID: 7, Fills: 0, Shares: 0, Notional: -100000, Commission: -10, VenueFees: 0},
+	}
+	got := l.Summaries()
+	if len(got) != len(want) {
+		t.Fatalf("summaries %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("summary %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, bad := range []string{
+		"default: {taker_bps: -1}",
+		"default: {min: 100, max: 10}",
+		"clients: {7: {min: -1}}",
+		"default: {fee: 1}",
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package billing
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a fee schedule file. A client listed under clients pays its
+// own schedule in full, not the default with overrides:
+//
+//	default: {maker_bps: 0.5, taker_bps: 1.5, min: 100}
+//	clients:
+//	  7: {per_share: 0.02, min: 50, max: 5000}
+//	  9: {maker_bps: -0.2, taker_bps: 1}
+type Config struct {
+	Default Schedule            `yaml:"default"`
+	Clients map[uint32]Schedule `yaml:"clients"`
+}
+
+// Load reads and validates a fee schedule file.
+func Load(path string) (*Fees, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fees, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fees, nil
+}
+
+// Parse decodes and validates a fee schedule file. Unknown keys are
+// errors.
+func Parse(data []byte) (*Fees, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Fees{Default: cfg.Default, Clients: cfg.Clients}, nil
+}
+
+func (cfg Config) Validate() error {
+	if err := cfg.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for client, s := range cfg.Clients {
+		if err := s.validate(); err != nil {
+			return fmt.Errorf("client %d: %w", client, err)
+		}
+	}
+	return nil
+}
+
+func (s Schedule) validate() error {
+	switch {
+	case s.TakerBps < 0 || s.PerShare < 0:
+		return fmt.Errorf("taker_bps and per_share must not be negative")
+	case s.Min < 0 || s.Max < 0:
+		return fmt.Errorf("min and max must not be negative")
+	case s.Max > 0 && s.Max < s.Min:
+		return fmt.Errorf("max %d is below min %d", s.Max, s.Min)
+	}
+	return nil
+}
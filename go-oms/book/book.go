@@ -0,0 +1,198 @@
+// Package book is a read-only view of the engine's order book snapshots.
+//
+// The Rust engine owns the segment (rust-me/src/book.rs) and rewrites a
+// symbol's slot after every change to its top levels. Each slot is guarded by
+// a sequence lock: the writer makes Seq odd, updates the levels and makes it
+// even again, so a reader that sees the same even Seq before and after its
+// copy has a consistent snapshot. Readers never write to the segment.
+package book
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/edsrzf/mmap-go"
+
+	"oms/cpu"
+	"oms/queue"
+)
+
+const (
+	Magic   uint32 = 0x4F4D5342 // "OMSB"
+	Depth          = 10         // levels per side
+	Symbols        = 1024       // slot count; symbol ids index slots directly
+
+	HeaderSize = 64
+	SlotSize   = unsafe.Sizeof(slot{})
+	TotalSize  = HeaderSize + Symbols*SlotSize
+)
+
+// PathFor is where the engine serving queuePath publishes its book.
+func PathFor(queuePath string) string {
+	return queuePath + "_book"
+}
+
+// ErrNoBook is returned for a symbol the engine has never published.
+var ErrNoBook = errors.New("no book for symbol")
+
+// ErrStaleBook is returned for a slot that stays mid-write, as one does
+// when the engine died writing it, until an engine rewrites it.
+var ErrStaleBook = errors.New("book slot left mid-write")
+
+// snapshotTries bounds Snapshot's retries; an engine write takes well under
+// a microsecond, so this many failed copies means no writer is coming.
+const snapshotTries = 1 << 16
+
+// Level is one aggregated price level.
+type Level struct {
+	Price    uint64 `json:"price"`
+	Quantity uint64 `json:"quantity"`
+}
+
+type header struct {
+	Magic     uint32
+	ByteOrder uint32
+	Depth     uint32
+	Symbols   uint32
+	_         [48]byte
+}
+
+type slot struct {
+	Seq       uint64 // odd while the engine is writing
+	UpdatedAt uint64 // unix nanos of the last write
+	Symbol    uint32
+	NumBids   uint32
+	NumAsks   uint32
+	_         uint32
+	Bids      [Depth]Level // best first
+	Asks      [Depth]Level // best first
+}
+
+// Snapshot is a consistent copy of one symbol's book.
+type Snapshot struct {
+	Symbol    uint32
+	Bids      []Level
+	Asks      []Level
+	UpdatedAt time.Time
+}
+
+// Book maps the engine's snapshot segment read-only.
+type Book struct {
+	file  *os.File
+	mmap  mmap.MMap
+	slots []slot
+}
+
+// Open maps the segment at path. It must have been created by the engine on
+// a host with the same byte order.
+func Open(path string) (*Book, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open book: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat book: %w", err)
+	}
+	if stat.Size() != int64(TotalSize) {
+		file.Close()
+		return nil, fmt.Errorf("invalid book size: got %d, expected %d", stat.Size(), TotalSize)
+	}
+	m, err := mmap.Map(file, mmap.RDONLY, 0)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to mmap book: %w", err)
+	}
+
+	h := (*header)(unsafe.Pointer(&m[0]))
+	switch {
+	case h.ByteOrder != queue.ByteOrderMark:
+		err = fmt.Errorf("%w: book mark 0x%08X", queue.ErrForeignByteOrder, h.ByteOrder)
+	case h.Magic != Magic:
+		err = fmt.Errorf("invalid book magic number")
+	case h.Depth != Depth || h.Symbols != Symbols:
+		err = fmt.Errorf("book geometry mismatch: file=%dx%d code=%dx%d", h.Symbols, h.Depth, Symbols, Depth)
+	}
+	if err != nil {
+		m.Unmap()
+		file.Close()
+		return nil, err
+	}
+
+	slots := unsafe.Slice((*slot)(unsafe.Pointer(&m[HeaderSize])), Symbols)
+	return &Book{file: file, mmap: m, slots: slots}, nil
+}
+
+// Levels returns up to Depth bids and asks for symbol, best first.
+func (b *Book) Levels(symbol uint32) (bids, asks []Level, err error) {
+	s, err := b.Snapshot(symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.Bids, s.Asks, nil
+}
+
+// BestBid returns the top bid; ok is false for an empty side or unknown symbol.
+func (b *Book) BestBid(symbol uint32) (Level, bool) {
+	s, err := b.Snapshot(symbol)
+	if err != nil || len(s.Bids) == 0 {
+		return Level{}, false
+	}
+	return s.Bids[0], true
+}
+
+// BestAsk returns the top ask; ok is false for an empty side or unknown symbol.
+func (b *Book) BestAsk(symbol uint32) (Level, bool) {
+	s, err := b.Snapshot(symbol)
+	if err != nil || len(s.Asks) == 0 {
+		return Level{}, false
+	}
+	return s.Asks[0], true
+}
+
+// Snapshot copies a symbol's slot under its sequence lock, retrying while
+// the engine is mid-write, up to snapshotTries times.
+func (b *Book) Snapshot(symbol uint32) (Snapshot, error) {
+	if symbol >= Symbols {
+		return Snapshot{}, fmt.Errorf("%w %d: outside the %d slot segment", ErrNoBook, symbol, Symbols)
+	}
+	sl := &b.slots[symbol]
+	for range snapshotTries {
+		before := atomic.LoadUint64(&sl.Seq)
+		if before == 0 {
+			return Snapshot{}, fmt.Errorf("%w %d", ErrNoBook, symbol)
+		}
+		if before&1 == 1 {
+			cpu.Relax()
+			continue
+		}
+		c := *sl
+		if atomic.LoadUint64(&sl.Seq) != before {
+			cpu.Relax()
+			continue
+		}
+		if c.Symbol != symbol || c.NumBids > Depth || c.NumAsks > Depth {
+			return Snapshot{}, fmt.Errorf("%w %d: slot is corrupted", ErrNoBook, symbol)
+		}
+		return Snapshot{
+			Symbol:    symbol,
+			Bids:      append([]Level(nil), c.Bids[:c.NumBids]...),
+			Asks:      append([]Level(nil), c.Asks[:c.NumAsks]...),
+			UpdatedAt: time.Unix(0, int64(c.UpdatedAt)),
+		}, nil
+	}
+	return Snapshot{}, fmt.Errorf("%w: symbol %d", ErrStaleBook, symbol)
+}
+
+// Close unmaps the segment.
+func (b *Book) Close() error {
+	if err := b.mmap.Unmap(); err != nil {
+		return err
+	}
+	return b.file.Close()
+}
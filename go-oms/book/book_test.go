@@ -0,0 +1,93 @@
+package book
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"oms/queue"
+)
+
+// writeSegment lays out a segment the way rust-me/src/book.rs does.
+func writeSegment(t *testing.T, symbol uint32, bids, asks []Level) string {
+	t.Helper()
+	buf := make([]byte, TotalSize)
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], Magic)
+	le.PutUint32(buf[4:], queue.ByteOrderMark)
+	le.PutUint32(buf[8:], Depth)
+	le.PutUint32(buf[12:], Symbols)
+
+	s := buf[HeaderSize+uintptr(symbol)*SlotSize:]
+	le.PutUint64(s[0:], 2) // one completed write
+	le.PutUint64(s[8:], 1700000000000000000)
+	le.PutUint32(s[16:], symbol)
+	le.PutUint32(s[20:], uint32(len(bids)))
+	le.PutUint32(s[24:], uint32(len(asks)))
+	for i, l := range bids {
+		le.PutUint64(s[32+16*i:], l.Price)
+		le.PutUint64(s[40+16*i:], l.Quantity)
+	}
+	for i, l := range asks {
+		le.PutUint64(s[32+16*Depth+16*i:], l.Price)
+		le.PutUint64(s[40+16*Depth+16*i:], l.Quantity)
+	}
+
+	path := filepath.Join(t.TempDir(), "orders_book")
+	if err := os.WriteFile(path, buf, 0640); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadSnapshot(t *testing.T) {
+	path := writeSegment(t, 7,
+		[]Level{{Price: 9990, Quantity: 100}, {Price: 9980, Quantity: 50}},
+		[]Level{{Price: 10010, Quantity: 30}})
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if bid, ok := b.BestBid(7); !ok || bid.Price != 9990 || bid.Quantity != 100 {
+		t.Fatalf("best bid: %+v %v", bid, ok)
+	}
+	if ask, ok := b.BestAsk(7); !ok || ask.Price != 10010 {
+		t.Fatalf("best ask: %+v %v", ask, ok)
+	}
+	bids, asks, err := b.Levels(7)
+	if err != nil || len(bids) != 2 || len(asks) != 1 || bids[1].Price != 9980 {
+		t.Fatalf("levels: %v %v %v", bids, asks, err)
+	}
+	if _, _, err := b.Levels(8); !errors.Is(err, ErrNoBook) {
+		t.Fatalf("unpublished symbol: got %v, want ErrNoBook", err)
+	}
+}
+
+func TestStaleSlot(t *testing.T) {
+	path := writeSegment(t, 7, []Level{{Price: 9990, Quantity: 100}}, nil)
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the engine died mid-write
+	if _, err := f.WriteAt(binary.LittleEndian.AppendUint64(nil, 3), int64(HeaderSize+7*SlotSize)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if _, err := b.Snapshot(7); !errors.Is(err, ErrStaleBook) {
+		t.Fatalf("got %v, want ErrStaleBook", err)
+	}
+	if _, ok := b.BestBid(7); ok {
+		t.Fatal("best bid from a stale slot")
+	}
+}
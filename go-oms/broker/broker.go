@@ -0,0 +1,784 @@
+// Package broker multiplexes many local client sessions onto the single
+// shared-memory order ring, so only the broker needs write access to it.
+//
+// Sessions speak a minimal protocol over a Unix domain socket: the client
+// sends its 4-byte ClientID, the broker answers with one byte (0 = accepted;
+// with Peers set, only a ClientID the peer's uid may use is), then both
+// sides exchange raw 64-byte Order frames in native layout. Clients send
+// orders and control messages; the broker sends back the status records
+// for that session's orders only.
+//
+// With a heartbeat interval set, the broker sends MsgHeartbeat frames at
+// that interval and drops a session it hears nothing from for three; clients
+// keep theirs alive with Conn.KeepAlive. A client ends its session cleanly
+// with MsgLogout, which the broker echoes before closing. CancelOnDisconnect
+// decides which endings cancel the client's open orders; CancelClient
+// cancels them whatever the sessions, for a kill switch. MsgTestRequest is
+// answered with a heartbeat carrying its OrderID, as a venue answers a FIX
+// test request, and test orders are screened by Tests (see TestPolicy);
+// TestStats counts both.
+//
+// Stop orders are held in the broker until a fill on the status ring prints
+// through their trigger (see package stops); the session sees
+// StatusTriggered when one goes to the engine, or StatusExpired when a
+// good-till-date or good-till-time stop expires first (see package expiry).
+package broker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"oms/enrich"
+	"oms/expiry"
+	"oms/queue"
+	"oms/stops"
+	"oms/throttle"
+	"oms/tracker"
+)
+
+const frameSize = int(queue.OrderSize)
+
+var (
+	errUnknownOrder = queue.NewReject(queue.ReasonUnknownOrder, "cancel for unknown order")
+	errDuplicateID  = queue.NewReject(queue.ReasonDuplicateID, "order id reused")
+)
+
+func encode(buf []byte, o *queue.Order) {
+	copy(buf, unsafe.Slice((*byte)(unsafe.Pointer(o)), frameSize))
+}
+
+func decode(buf []byte) queue.Order {
+	var o queue.Order
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&o)), frameSize), buf)
+	return o
+}
+
+type route struct {
+	s      *session
+	local  uint64 // the session's own OrderID
+	filled bool   // some of the order filled, so busts may follow
+}
+
+type session struct {
+	clientID uint32
+	conn     net.Conn
+	out      chan queue.Order
+	lastSeq  uint64            // last local OrderID accepted; must increase
+	locals   map[uint64]uint64 // local OrderID -> broker OrderID, for cancels
+	state    sessionState
+	closed   bool
+	flushed  chan struct{} // closed once write has drained out
+}
+
+type submission struct {
+	s     *session
+	order queue.Order
+	// cancelAll asks produce to cancel everything s.clientID has open,
+	// after the session's own submissions ahead of it in the channel.
+	cancelAll bool
+	received  time.Time // when handle read the order off the session
+}
+
+// Broker owns the producer side of Orders and the consumer side of Status.
+type Broker struct {
+	orders queue.OrderQueue
+	status queue.OrderQueue
+
+	// Enrich, when set, runs on every new order before it gets a broker
+	// id; an enrichment error rejects the order back to the session.
+	Enrich *enrich.Pipeline
+
+	// OnStatus, when set, sees every status record before it is routed,
+	// e.g. to feed post-trade risk checks. On a status ring that can be
+	// peeked, such as a queue.Queue, it runs before the record's slot is
+	// released, so what it writes down is never behind the ring's tail.
+	OnStatus func(queue.Order)
+
+	// Heartbeat, when set, is the interval between heartbeats in both
+	// directions; a session silent for three intervals is dropped.
+	Heartbeat time.Duration
+
+	// Throttle, when set, holds each client to its message rates; a
+	// session sending too fast gets rejections, never for a cancel.
+	Throttle *throttle.Throttle
+
+	// Timings, when set, is stamped with when each new order arrived, for
+	// the per-stage latency it keeps (see tracker.Stage). The ring must
+	// Submit to it, e.g. through a tracker.Queue.
+	Timings *tracker.Tracker
+
+	// CancelOnDisconnect cancels a client's open orders, stops held here
+	// included, when its session ends in a way the policy covers.
+	CancelOnDisconnect CancelPolicy
+
+	// Peers, when set, says which ClientIDs each local uid may open
+	// sessions for; any other hello is refused.
+	Peers Peers
+
+	// Tests picks out test orders and says what becomes of them.
+	Tests TestOrders
+
+	// TestRing, when set, is where test orders go under TestTag, and the
+	// messages acting on them: the ring beneath the decorators that record
+	// orders, such as store.Queue and mirror.Queue, so they never see them.
+	TestRing queue.OrderQueue
+
+	mu     sync.Mutex
+	nextID func() (uint64, error)
+	routes map[uint64]route
+	tagged map[uint64]bool // broker ids of test orders under TestTag
+
+	// filled keeps the routes of filled orders, oldest first in filledIDs,
+	// for the busts and corrections that may follow their fills.
+	filled    map[uint64]route
+	filledIDs []uint64
+
+	heartbeats, testRequests, testOrders, testDropped, suppressed atomic.Uint64
+
+	kills    []uint32      // clients CancelClient queued for produce
+	killWake chan struct{} // signals produce that kills is not empty
+
+	stops     *stops.Monitor
+	expiry    *expiry.Sweeper // held stops with an expiry; produce's only
+	expired   []queue.Order   // stops expiry swept, for produce to report
+	in        chan submission
+	triggered chan submission  // stops released by fanOut, sent by produce
+	reported  chan queue.Order // records made in the OMS, routed by fanOut
+}
+
+// New returns a broker over the shared rings. Broker order ids come from
+// nextID, typically an orderid.Allocator, and must increase across all
+// sessions and restarts.
+func New(orders, status queue.OrderQueue, nextID func() (uint64, error)) *Broker {
+	b := &Broker{
+		orders:    orders,
+		status:    status,
+		nextID:    nextID,
+		routes:    make(map[uint64]route),
+		tagged:    make(map[uint64]bool),
+		filled:    make(map[uint64]route),
+		killWake:  make(chan struct{}, 1),
+		in:        make(chan submission, 1024),
+		triggered: make(chan submission, 1024),
+		reported:  make(chan queue.Order, 1024),
+	}
+	b.stops = stops.NewMonitor(b.releaseStop)
+	b.stops.Report = b.reportStop
+	b.expiry = expiry.NewSweeper(b.expire)
+	return b
+}
+
+// FilledRoutes is how many filled orders the broker remembers routes for,
+// so a bust or correction of any of them still reaches its session.
+const FilledRoutes = 1 << 18
+
+// keepFilled remembers r for the busts and corrections of a filled order,
+// forgetting the oldest beyond FilledRoutes. Callers hold b.mu.
+func (b *Broker) keepFilled(global uint64, r route) {
+	if _, ok := b.filled[global]; !ok {
+		b.filledIDs = append(b.filledIDs, global)
+	}
+	b.filled[global] = r
+	if len(b.filledIDs) > FilledRoutes {
+		delete(b.filled, b.filledIDs[0])
+		b.filledIDs = b.filledIDs[1:]
+	}
+}
+
+// expirySweep is how often produce expires held stops.
+const expirySweep = 10 * time.Millisecond
+
+// expire drops a held stop the sweeper found expired, unless it triggered
+// meanwhile, for produce to report as the engine reports orders that
+// expire before it gets them.
+func (b *Broker) expire(order queue.Order) {
+	if b.stops.Cancel(order.OrderID) {
+		b.expired = append(b.expired, order)
+	}
+}
+
+// releaseStop hands a triggered stop to produce, the ring's only producer.
+// A full hand-off counts as a full queue, so the monitor retries it.
+func (b *Broker) releaseStop(order queue.Order) error {
+	b.mu.Lock()
+	r, ok := b.routes[order.OrderID]
+	b.mu.Unlock()
+	if !ok {
+		return nil // session gone; drop it
+	}
+	select {
+	case b.triggered <- submission{s: r.s, order: order}:
+		return nil
+	default:
+		return queue.ErrQueueFull
+	}
+}
+
+// reportStop tells the session its stop went to the engine.
+func (b *Broker) reportStop(status queue.Order) {
+	b.mu.Lock()
+	r, ok := b.routes[status.OrderID]
+	b.mu.Unlock()
+	if ok {
+		status.OrderID = r.local
+		b.send(r.s, status)
+	}
+}
+
+// Serve accepts sessions on l until ctx is done.
+func (b *Broker) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go b.produce(ctx)
+	go b.fanOut(ctx)
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go b.handle(ctx, conn)
+	}
+}
+
+func (b *Broker) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	var hello [4]byte
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, hello[:]); err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	clientID := binary.NativeEndian.Uint32(hello[:])
+	if b.Peers != nil {
+		uid, err := peerUID(conn)
+		if err == nil && !b.Peers.Allows(uid, clientID) {
+			err = fmt.Errorf("uid %d may not use it", uid)
+		}
+		if err != nil {
+			log.Printf("[BROKER] Refused session for client %d: %v", clientID, err)
+			conn.Write([]byte{1})
+			return
+		}
+	}
+	if _, err := conn.Write([]byte{0}); err != nil {
+		return
+	}
+
+	s := &session{
+		clientID: clientID,
+		conn:     conn,
+		out:      make(chan queue.Order, 4096),
+		locals:   make(map[uint64]uint64),
+		flushed:  make(chan struct{}),
+	}
+	go b.write(s)
+
+	end := stateDropped
+	defer func() { b.end(ctx, s, end) }()
+
+	buf := make([]byte, frameSize)
+	for {
+		if b.Heartbeat > 0 {
+			conn.SetReadDeadline(time.Now().Add(3 * b.Heartbeat))
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			var ne net.Error
+			switch {
+			case errors.As(err, &ne) && ne.Timeout():
+				log.Printf("[BROKER] client %d: no heartbeat for %v", s.clientID, 3*b.Heartbeat)
+			case !errors.Is(err, io.EOF):
+				log.Printf("[BROKER] client %d: %v", s.clientID, err)
+			}
+			return
+		}
+		order := decode(buf)
+		switch order.MsgType {
+		case MsgHeartbeat:
+			b.heartbeats.Add(1)
+			continue
+		case MsgTestRequest:
+			b.testRequests.Add(1)
+			b.send(s, queue.Order{MsgType: MsgHeartbeat, OrderID: order.OrderID})
+			continue
+		case MsgLogout:
+			end = stateLoggedOut
+			b.send(s, queue.Order{MsgType: MsgLogout})
+			return
+		}
+		select {
+		case b.in <- submission{s: s, order: order, received: time.Now()}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// end closes a session, lets its last frames drain, and queues the cancel
+// the policy calls for.
+func (b *Broker) end(ctx context.Context, s *session, state sessionState) {
+	b.mu.Lock()
+	s.state = state
+	s.closed = true
+	close(s.out)
+	b.mu.Unlock()
+
+	select {
+	case <-s.flushed:
+	case <-time.After(time.Second):
+	}
+	if !b.CancelOnDisconnect.covers(state) {
+		return
+	}
+	select {
+	case b.in <- submission{s: s, cancelAll: true}:
+	case <-ctx.Done():
+	}
+}
+
+// write drains a session's status frames to its socket, with a heartbeat
+// every interval when one is set.
+func (b *Broker) write(s *session) {
+	defer close(s.flushed)
+	var tick <-chan time.Time
+	if b.Heartbeat > 0 {
+		t := time.NewTicker(b.Heartbeat)
+		defer t.Stop()
+		tick = t.C
+	}
+	buf := make([]byte, frameSize)
+	for {
+		var order queue.Order
+		select {
+		case o, ok := <-s.out:
+			if !ok {
+				return
+			}
+			order = o
+		case <-tick:
+			order = queue.Order{MsgType: MsgHeartbeat}
+		}
+		encode(buf, &order)
+		if _, err := s.conn.Write(buf); err != nil {
+			s.conn.Close()
+			for range s.out {
+			}
+			return
+		}
+	}
+}
+
+// cancelAll cancels every open order of a session's client: stops still
+// held here are dropped, and the engine gets a CancelAll for the rest.
+// Only produce calls it, so nothing the session sent can overtake it.
+func (b *Broker) cancelAll(s *session) {
+	b.mu.Lock()
+	held := make([]uint64, 0, len(s.locals))
+	for local, global := range s.locals {
+		held = append(held, global)
+		delete(s.locals, local)
+	}
+	b.mu.Unlock()
+	for _, global := range held {
+		if b.stops.Cancel(global) {
+			b.expiry.Done(global)
+			b.mu.Lock()
+			delete(b.routes, global)
+			b.mu.Unlock()
+		}
+	}
+
+	id, err := b.nextID()
+	if err != nil {
+		log.Printf("[BROKER] client %d: no order id for cancel on disconnect: %v", s.clientID, err)
+		return
+	}
+	log.Printf("[BROKER] client %d: session %s, cancelling open orders", s.clientID, s.state)
+	cancel := queue.CancelAll(id, s.clientID, uint64(time.Now().UnixNano()))
+	b.forward(submission{s: s, order: cancel}, cancel)
+}
+
+// CancelClient has the broker cancel every open order of clientID, across
+// all its sessions and with none connected: stops held here are cancelled
+// back to their sessions, and the engine gets a CancelAll for the rest. It
+// is risk.KillSwitch's cancel func: it never blocks, queuing the cancel for
+// produce, the ring's only producer, and so never fails.
+func (b *Broker) CancelClient(clientID uint32) error {
+	b.mu.Lock()
+	b.kills = append(b.kills, clientID)
+	b.mu.Unlock()
+	select {
+	case b.killWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// kill cancels what CancelClient queued. Only produce calls it.
+func (b *Broker) kill() {
+	b.mu.Lock()
+	kills := b.kills
+	b.kills = nil
+	b.mu.Unlock()
+	for _, clientID := range kills {
+		b.mu.Lock()
+		var held []route
+		var ids []uint64
+		for global, r := range b.routes {
+			if r.s.clientID == clientID {
+				held, ids = append(held, r), append(ids, global)
+			}
+		}
+		b.mu.Unlock()
+		for i, global := range ids {
+			if !b.stops.Cancel(global) {
+				continue
+			}
+			b.expiry.Done(global)
+			r := held[i]
+			b.mu.Lock()
+			delete(b.routes, global)
+			delete(r.s.locals, r.local)
+			b.mu.Unlock()
+			b.send(r.s, queue.Order{OrderID: r.local, ClientID: clientID, Status: queue.StatusCanceled})
+		}
+
+		id, err := b.nextID()
+		if err != nil {
+			log.Printf("[BROKER] client %d: no order id for the kill switch's cancel: %v", clientID, err)
+			continue
+		}
+		log.Printf("[BROKER] client %d: kill switch engaged, cancelling open orders", clientID)
+		cancel := queue.CancelAll(id, clientID, uint64(time.Now().UnixNano()))
+		for {
+			err := b.orders.Enqueue(cancel)
+			if !errors.Is(err, queue.ErrQueueFull) {
+				if err != nil {
+					log.Printf("[BROKER] client %d: kill switch cancel: %v", clientID, err)
+				}
+				break
+			}
+			time.Sleep(10 * time.Microsecond)
+		}
+	}
+}
+
+// admit rewrites a session's message into broker id space, or returns a
+// rejection for the session.
+func (b *Broker) admit(sub submission) (queue.Order, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, order := sub.s, sub.order
+
+	// sessions only ever act as their own client
+	order.ClientID = s.clientID
+
+	if order.MsgType == queue.MsgCancel || order.MsgType == queue.MsgQuoteHit {
+		global, ok := s.locals[order.OrderID]
+		if !ok {
+			return order, fmt.Errorf("%w %d", errUnknownOrder, order.OrderID)
+		}
+		order.OrderID = global
+		return order, nil
+	}
+	if b.Enrich != nil {
+		enriched, err := b.Enrich.Order(order)
+		if err != nil {
+			return order, err
+		}
+		enriched.ClientID = s.clientID
+		order = enriched
+	}
+	if order.OrderID <= s.lastSeq {
+		return order, fmt.Errorf("%w: %d not above previous %d", errDuplicateID, order.OrderID, s.lastSeq)
+	}
+	global, err := b.nextID()
+	if err != nil {
+		return order, fmt.Errorf("no order id available: %w", err)
+	}
+	s.lastSeq = order.OrderID
+
+	b.routes[global] = route{s: s, local: order.OrderID}
+	if !order.IsControl() || order.MsgType == queue.MsgQuoteRequest {
+		s.locals[order.OrderID] = global
+	}
+	order.OrderID = global
+	return order, nil
+}
+
+// reject answers a session's order with StatusRejected and the reason err
+// maps to, so the client sees why without parsing a log.
+func (b *Broker) reject(s *session, order queue.Order, err error) {
+	order.Status = queue.StatusRejected
+	order.Reason = queue.ReasonOf(err)
+	b.send(s, order)
+}
+
+// produce is the ring's only producer.
+func (b *Broker) produce(ctx context.Context) {
+	sweep := time.NewTicker(expirySweep)
+	defer sweep.Stop()
+	for {
+		var sub submission
+		select {
+		case sub = <-b.in:
+		case sub = <-b.triggered:
+			// already admitted; sub.order is in broker id space
+			b.expiry.Done(sub.order.OrderID)
+			local := sub.order
+			b.mu.Lock()
+			local.OrderID = b.routes[sub.order.OrderID].local
+			b.mu.Unlock()
+			b.forward(submission{s: sub.s, order: local}, sub.order)
+			continue
+		case <-b.killWake:
+			b.kill()
+			continue
+		case now := <-sweep.C:
+			b.expiry.Sweep(uint64(now.UnixNano()))
+			for _, order := range b.expired {
+				select {
+				case b.reported <- order:
+				case <-ctx.Done():
+					return
+				}
+			}
+			b.expired = b.expired[:0]
+			continue
+		case <-ctx.Done():
+			return
+		}
+		if sub.cancelAll {
+			b.cancelAll(sub.s)
+			continue
+		}
+		if b.screenTest(sub) {
+			continue
+		}
+		if b.Throttle != nil {
+			counted := sub.order
+			counted.ClientID = sub.s.clientID
+			if err := b.Throttle.Allow(counted, time.Now()); err != nil {
+				b.reject(sub.s, sub.order, err)
+				continue
+			}
+		}
+		order, err := b.admit(sub)
+		if err != nil {
+			b.reject(sub.s, sub.order, err)
+			continue
+		}
+		if b.Tests.Policy == TestTag && b.Tests.match(order) {
+			b.mu.Lock()
+			b.tagged[order.OrderID] = true
+			b.mu.Unlock()
+		}
+		switch {
+		case order.MsgType == queue.MsgCancel && b.stops.Cancel(order.OrderID):
+			// the stop never reached the engine, so cancel it here
+			b.expiry.Done(order.OrderID)
+			b.mu.Lock()
+			delete(b.routes, order.OrderID)
+			delete(sub.s.locals, sub.order.OrderID)
+			b.mu.Unlock()
+			canceled := sub.order
+			canceled.MsgType = queue.MsgNew
+			canceled.Status = queue.StatusCanceled
+			b.send(sub.s, canceled)
+			continue
+		case order.IsStop():
+			if err := b.stops.Add(order); err != nil {
+				b.reject(sub.s, sub.order, err)
+				continue
+			}
+			b.expiry.Track(order)
+			continue
+		}
+		b.forward(sub, order)
+	}
+}
+
+// forward enqueues an admitted order, retrying while the ring is full.
+// sub carries the session's own copy for a rejection.
+func (b *Broker) forward(sub submission, order queue.Order) {
+	ring, test := b.orders, false
+	if b.TestRing != nil {
+		b.mu.Lock()
+		test = b.tagged[order.OrderID]
+		b.mu.Unlock()
+		if test {
+			ring = b.TestRing
+		}
+	}
+	for {
+		err := ring.Enqueue(order)
+		if err == nil {
+			if b.Timings != nil && order.MsgType == queue.MsgNew && !test {
+				b.Timings.Mark(order.OrderID, tracker.StageGatewayIn, sub.received)
+			}
+			return
+		}
+		if !errors.Is(err, queue.ErrQueueFull) {
+			// refused by a decorator on the ring, e.g. risk or session
+			log.Printf("[BROKER] enqueue order %d: %v", order.OrderID, err)
+			if order.MsgType != queue.MsgCancel && order.MsgType != queue.MsgQuoteHit {
+				b.mu.Lock()
+				delete(b.routes, order.OrderID)
+				delete(b.tagged, order.OrderID)
+				delete(sub.s.locals, sub.order.OrderID)
+				b.mu.Unlock()
+			}
+			b.reject(sub.s, sub.order, err)
+			return
+		}
+		time.Sleep(10 * time.Microsecond)
+	}
+}
+
+// Report routes a status record made in the OMS rather than by the
+// engine, such as an internal cross (see package cross), as if it had come
+// off the status ring. It blocks while fanOut is behind.
+func (b *Broker) Report(status queue.Order) {
+	b.reported <- status
+}
+
+// fanOut is the status ring's only consumer; it routes every record back
+// to the session that sent the order, in that session's id space.
+func (b *Broker) fanOut(ctx context.Context) {
+	var failing error // the last read error logged, until a read succeeds
+	for ctx.Err() == nil {
+		var rec *queue.Order
+		advance := func() {}
+		select {
+		case status := <-b.reported:
+			rec = &status
+		default:
+			var err error
+			p, peeks := b.status.(peeker)
+			if peeks {
+				rec, err = p.Peek()
+				advance = p.Advance
+			} else {
+				rec, err = b.status.Dequeue()
+			}
+			if err != nil {
+				if errors.Is(err, queue.ErrCorruptedOrder) && peeks {
+					// one bad slot must not stall every session behind it
+					log.Printf("[BROKER] Skipping unreadable status record: %v", err)
+					p.Advance()
+					continue
+				}
+				if failing == nil || err.Error() != failing.Error() {
+					log.Printf("[BROKER] Status ring: %v", err)
+					failing = err
+				}
+			} else {
+				failing = nil
+			}
+			if err != nil || rec == nil {
+				time.Sleep(20 * time.Microsecond)
+				continue
+			}
+		}
+		if rec.MsgType == queue.MsgResend {
+			// the broker keeps no log to republish from: the orders after
+			// the gap are lost to the engine, and their sessions must
+			// resubmit them once rejected or timed out
+			log.Printf("[BROKER] Engine asked for a resend from order %d, but the broker keeps no log to resend from; orders from there on are lost", rec.OrderID)
+			advance()
+			continue
+		}
+		if !b.suppress(*rec) {
+			if _, err := b.stops.Observe(*rec); err != nil {
+				log.Printf("[BROKER] %v", err)
+			}
+			if b.OnStatus != nil {
+				b.OnStatus(*rec)
+			}
+		}
+		advance()
+
+		b.mu.Lock()
+		r, ok := b.routes[rec.OrderID]
+		if ok && rec.IsTrade() {
+			r.filled = true
+			b.routes[rec.OrderID] = r
+		}
+		if ok && closesRoute(*rec) {
+			delete(b.routes, rec.OrderID)
+			delete(r.s.locals, r.local)
+			if r.filled {
+				b.keepFilled(rec.OrderID, r)
+			}
+		}
+		if !ok && amendsFill(*rec) {
+			r, ok = b.filled[rec.OrderID]
+		}
+		b.mu.Unlock()
+		if !ok {
+			continue
+		}
+		status := *rec
+		status.OrderID = r.local
+		b.send(r.s, status)
+	}
+}
+
+// peeker is a status ring whose records can be read before their slot is
+// released.
+type peeker interface {
+	Peek() (*queue.Order, error)
+	Advance()
+}
+
+// closesRoute reports whether rec is the last record for its order id.
+func closesRoute(rec queue.Order) bool {
+	switch rec.MsgType {
+	case queue.MsgNew:
+		return rec.Terminal()
+	case queue.MsgCancel, queue.MsgQuote, queue.MsgQuoteHit:
+		// the order or quote request they act on closes with its own record
+		return false
+	}
+	return true
+}
+
+// amendsFill reports whether rec busts or corrects a fill, after the
+// order's route closed on it.
+func amendsFill(rec queue.Order) bool {
+	return rec.MsgType == queue.MsgNew &&
+		(rec.Status == queue.StatusBusted || rec.Status == queue.StatusCorrected)
+}
+
+// send queues a frame for a session without ever blocking the broker; a
+// session too slow to keep up is disconnected.
+func (b *Broker) send(s *session, status queue.Order) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.out <- status:
+	default:
+		log.Printf("[BROKER] client %d not reading status, disconnecting", s.clientID)
+		s.conn.Close()
+	}
+}
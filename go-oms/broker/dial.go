@@ -0,0 +1,184 @@
+package broker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oms/queue"
+)
+
+// Conn is a client session with a broker. Orders and Status expose it as the
+// same pair of queues the client package uses for the shared rings.
+type Conn struct {
+	conn   net.Conn
+	status *queue.MemQueue
+	wmu    sync.Mutex
+	wbuf   []byte
+	done   chan struct{} // closed when the broker side ends
+	pongs  chan uint64   // test request ids the broker answered
+	pingID atomic.Uint64
+}
+
+// Dial opens a session for clientID on the broker socket.
+func Dial(socketPath string, clientID uint32) (*Conn, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	var hello [4]byte
+	binary.NativeEndian.PutUint32(hello[:], clientID)
+	if _, err := conn.Write(hello[:]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var ack [1]byte
+	if _, err := io.ReadFull(conn, ack[:]); err != nil || ack[0] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("broker refused session for client %d", clientID)
+	}
+
+	c := &Conn{
+		conn:   conn,
+		status: queue.NewInMemory(4096),
+		wbuf:   make([]byte, frameSize),
+		done:   make(chan struct{}),
+		pongs:  make(chan uint64, 1),
+	}
+	go c.read()
+	return c, nil
+}
+
+func (c *Conn) read() {
+	defer close(c.done)
+	defer c.status.Close()
+	buf := make([]byte, frameSize)
+	for {
+		if _, err := io.ReadFull(c.conn, buf); err != nil {
+			return
+		}
+		status := decode(buf)
+		switch status.MsgType {
+		case MsgHeartbeat:
+			if status.OrderID != 0 {
+				select {
+				case c.pongs <- status.OrderID:
+				default:
+				}
+			}
+			continue
+		case MsgLogout:
+			return
+		}
+		// the status buffer is sized like the broker's per-session queue;
+		// while it is full, stop reading rather than drop status, and the
+		// broker disconnects a client that stays behind
+		for {
+			err := c.status.Enqueue(status)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, queue.ErrQueueFull) {
+				return // closed
+			}
+			time.Sleep(20 * time.Microsecond)
+		}
+	}
+}
+
+func (c *Conn) sendFrame(msgType uint8) error {
+	return (*orderSide)(c).Enqueue(queue.Order{MsgType: msgType})
+}
+
+// KeepAlive sends a heartbeat every interval until the session ends. Use it
+// against a broker run with a heartbeat interval of at least this one.
+func (c *Conn) KeepAlive(interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if c.sendFrame(MsgHeartbeat) != nil {
+					return
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// Ping sends a test request and waits up to timeout for the broker to
+// answer it, returning the round trip. One Ping at a time per session.
+func (c *Conn) Ping(timeout time.Duration) (time.Duration, error) {
+	id := c.pingID.Add(1)
+	start := time.Now()
+	if err := (*orderSide)(c).Enqueue(queue.Order{MsgType: MsgTestRequest, OrderID: id}); err != nil {
+		return 0, err
+	}
+	deadline := time.After(timeout)
+	for {
+		select {
+		case got := <-c.pongs:
+			if got == id { // else the late answer to an earlier Ping
+				return time.Since(start), nil
+			}
+		case <-c.done:
+			return 0, fmt.Errorf("broker ended the session")
+		case <-deadline:
+			return 0, fmt.Errorf("broker did not answer test request %d within %v", id, timeout)
+		}
+	}
+}
+
+// Logout ends the session cleanly and closes it. Status already sent is
+// still delivered. The client's orders stay open unless the broker's
+// cancel policy is CancelAlways.
+func (c *Conn) Logout() error {
+	defer c.Close()
+	if err := c.sendFrame(MsgLogout); err != nil {
+		return err
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-time.After(5 * time.Second):
+		return fmt.Errorf("broker did not confirm logout")
+	}
+}
+
+// Orders is the send side of the session.
+func (c *Conn) Orders() queue.OrderQueue { return (*orderSide)(c) }
+
+// Status is the receive side of the session.
+func (c *Conn) Status() queue.OrderQueue { return c.status }
+
+// Close ends the session. Status already received can still be read.
+func (c *Conn) Close() error {
+	c.status.Close()
+	return c.conn.Close()
+}
+
+type orderSide Conn
+
+func (o *orderSide) Enqueue(order queue.Order) error {
+	o.wmu.Lock()
+	defer o.wmu.Unlock()
+	encode(o.wbuf, &order)
+	_, err := o.conn.Write(o.wbuf)
+	return err
+}
+
+func (o *orderSide) Dequeue() (*queue.Order, error) {
+	return nil, fmt.Errorf("broker order side is write-only")
+}
+
+func (o *orderSide) Depth() uint64    { return 0 }
+func (o *orderSide) Capacity() uint64 { return 0 }
+func (o *orderSide) Close() error     { return (*Conn)(o).Close() }
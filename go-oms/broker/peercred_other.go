@@ -0,0 +1,13 @@
+//go:build !linux
+
+package broker
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID needs SO_PEERCRED, which only Linux has.
+func peerUID(conn net.Conn) (uint32, error) {
+	return 0, errors.New("peer credentials need Linux")
+}
@@ -0,0 +1,50 @@
+package broker
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Peers maps a local uid to the ClientIDs its processes may open sessions
+// for, by the uid the kernel reports for the socket's peer (SO_PEERCRED),
+// so a process cannot trade as another user's client by sending its id. A
+// uid listed with no ClientIDs may open any.
+type Peers map[uint32][]uint32
+
+// Allows reports whether a peer running as uid may send clientID.
+func (p Peers) Allows(uid, clientID uint32) bool {
+	clients, ok := p[uid]
+	return ok && (len(clients) == 0 || slices.Contains(clients, clientID))
+}
+
+// ParsePeers reads comma-separated uid:client pairs, e.g. "1001:7,1001:8",
+// where a client of * lets the uid open any.
+func ParsePeers(s string) (Peers, error) {
+	p := Peers{}
+	any := map[uint32]bool{}
+	for _, pair := range strings.Split(s, ",") {
+		uidText, client, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("peer %q: want uid:client", pair)
+		}
+		uid, err := strconv.ParseUint(uidText, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("peer %q: invalid uid", pair)
+		}
+		if client == "*" {
+			any[uint32(uid)] = true
+			continue
+		}
+		id, err := strconv.ParseUint(client, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("peer %q: invalid client id", pair)
+		}
+		p[uint32(uid)] = append(p[uint32(uid)], uint32(id))
+	}
+	for uid := range any {
+		p[uid] = nil
+	}
+	return p, nil
+}
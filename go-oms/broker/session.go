@@ -0,0 +1,66 @@
+package broker
+
+import "fmt"
+
+// Session frames share the Order layout but only MsgType means anything.
+// The broker consumes them; they never reach the ring.
+const (
+	MsgHeartbeat   uint8 = 0x80 // either direction: the sender is alive
+	MsgLogout      uint8 = 0x81 // client: end the session; broker: logout done
+	MsgTestRequest uint8 = 0x82 // client: answer at once with a heartbeat carrying this OrderID
+)
+
+// CancelPolicy says which session endings cancel the client's open orders.
+// The cancel is a CancelAll for the ClientID, so it also reaches orders
+// sent on other sessions of the same client.
+type CancelPolicy uint8
+
+const (
+	CancelNever        CancelPolicy = iota
+	CancelOnDisconnect              // the connection dropped or went quiet
+	CancelAlways                    // any ending, a clean logout included
+)
+
+var cancelPolicyNames = [...]string{"never", "disconnect", "always"}
+
+func (p CancelPolicy) String() string {
+	if int(p) < len(cancelPolicyNames) {
+		return cancelPolicyNames[p]
+	}
+	return fmt.Sprintf("CancelPolicy(%d)", uint8(p))
+}
+
+// ParseCancelPolicy is the inverse of CancelPolicy.String.
+func ParseCancelPolicy(name string) (CancelPolicy, error) {
+	for i, n := range cancelPolicyNames {
+		if n == name {
+			return CancelPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown cancel policy %q", name)
+}
+
+// sessionState is where a session is in its life. Logon is the hello
+// exchange, before the session exists; after it a session is active until
+// the client logs out or the connection is lost, and never comes back.
+type sessionState uint8
+
+const (
+	stateActive sessionState = iota
+	stateLoggedOut
+	stateDropped // read error, missed heartbeats, or too slow to read status
+)
+
+var sessionStateNames = [...]string{"active", "logged out", "dropped"}
+
+func (s sessionState) String() string { return sessionStateNames[s] }
+
+func (p CancelPolicy) covers(end sessionState) bool {
+	switch end {
+	case stateLoggedOut:
+		return p == CancelAlways
+	case stateDropped:
+		return p == CancelOnDisconnect || p == CancelAlways
+	}
+	return false
+}
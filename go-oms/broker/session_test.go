@@ -0,0 +1,499 @@
+package broker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"oms/queue"
+	"oms/risk"
+)
+
+func startBroker(t *testing.T, policy CancelPolicy) (*queue.MemQueue, string) {
+	t.Helper()
+	orders, status := queue.NewInMemory(64), queue.NewInMemory(64)
+	var id atomic.Uint64
+	b := New(orders, status, func() (uint64, error) { return id.Add(1), nil })
+	b.Heartbeat = 20 * time.Millisecond
+	b.CancelOnDisconnect = policy
+
+	sock := filepath.Join(t.TempDir(), "broker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go b.Serve(ctx, l)
+	return orders, sock
+}
+
+func nextOrder(t *testing.T, q *queue.MemQueue) queue.Order {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if o, _ := q.Dequeue(); o != nil {
+			return *o
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("nothing reached the ring")
+	return queue.Order{}
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	limit := queue.Order{OrderID: 1, Price: 100, Quantity: 10, Symbol: 1}
+
+	orders, sock := startBroker(t, CancelOnDisconnect)
+	c, err := Dial(sock, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.KeepAlive(5 * time.Millisecond)
+	if err := c.Orders().Enqueue(limit); err != nil {
+		t.Fatal(err)
+	}
+	nextOrder(t, orders)
+	time.Sleep(100 * time.Millisecond) // several heartbeat timeouts
+	if o, _ := orders.Dequeue(); o != nil {
+		t.Fatalf("heartbeating session dropped: %+v", o)
+	}
+	c.Close()
+	if o := nextOrder(t, orders); o.MsgType != queue.MsgCancelAll || o.ClientID != 7 {
+		t.Fatalf("want CancelAll for client 7, got %+v", o)
+	}
+
+	// a session that goes quiet is dropped the same way
+	c, err = Dial(sock, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := nextOrder(t, orders); o.MsgType != queue.MsgCancelAll || o.ClientID != 8 {
+		t.Fatalf("want CancelAll for silent client 8, got %+v", o)
+	}
+	c.Close()
+
+	// a clean logout leaves orders open
+	c, err = Dial(sock, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Orders().Enqueue(limit); err != nil {
+		t.Fatal(err)
+	}
+	nextOrder(t, orders)
+	if err := c.Logout(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if o, _ := orders.Dequeue(); o != nil {
+		t.Fatalf("logout cancelled orders: %+v", o)
+	}
+}
+
+// recording counts what reaches the ring through it, as store.Queue and
+// mirror.Queue record it.
+type recording struct {
+	queue.OrderQueue
+	n atomic.Int32
+}
+
+func (r *recording) Enqueue(o queue.Order) error {
+	r.n.Add(1)
+	return r.OrderQueue.Enqueue(o)
+}
+
+func TestTestMessages(t *testing.T) {
+	for _, policy := range []TestPolicy{TestTag, TestDrop} {
+		t.Run(policy.String(), func(t *testing.T) {
+			orders, status := queue.NewInMemory(64), queue.NewInMemory(64)
+			var id atomic.Uint64
+			recorded := &recording{OrderQueue: orders}
+			b := New(recorded, status, func() (uint64, error) { return id.Add(1), nil })
+			b.Tests = TestOrders{Symbols: map[uint32]bool{99: true}, Policy: policy}
+			b.TestRing = orders
+			var reported atomic.Int32
+			b.OnStatus = func(queue.Order) { reported.Add(1) }
+			sock := filepath.Join(t.TempDir(), "broker.sock")
+			l, err := net.Listen("unix", sock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go b.Serve(ctx, l)
+
+			c, err := Dial(sock, 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if _, err := c.Ping(time.Second); err != nil {
+				t.Fatal(err)
+			}
+			c.Orders().Enqueue(queue.Order{MsgType: MsgHeartbeat})
+			c.Orders().Enqueue(queue.Order{OrderID: 1, Symbol: 99, Price: 100, Quantity: 1})
+			c.Orders().Enqueue(queue.Order{OrderID: 2, Symbol: 1, Price: 100, Quantity: 1})
+
+			if policy == TestTag {
+				test := nextOrder(t, orders)
+				test.Status = queue.StatusFilled
+				status.Enqueue(test)
+			}
+			real := nextOrder(t, orders)
+			if real.Symbol != 1 {
+				t.Fatalf("ring got %+v, want the real order", real)
+			}
+			real.Status = queue.StatusFilled
+			status.Enqueue(real)
+
+			var got []queue.Order
+			for len(got) < 2 {
+				if o, _ := c.Status().Dequeue(); o != nil {
+					got = append(got, *o)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			want := queue.StatusFilled
+			if policy == TestDrop {
+				want = queue.StatusCanceled
+			}
+			for _, o := range got {
+				if o.Symbol == 99 && (o.OrderID != 1 || o.Status != want) {
+					t.Errorf("session got %+v for its test order, want status %d", o, want)
+				}
+			}
+			if n := reported.Load(); n != 1 {
+				t.Errorf("OnStatus saw %d records, want only the real order's", n)
+			}
+			if n := recorded.n.Load(); n != 1 {
+				t.Errorf("the ring's decorators saw %d orders, want only the real one", n)
+			}
+			st := b.TestStats()
+			if st.Heartbeats != 1 || st.TestRequests != 1 || st.TestOrders != 1 ||
+				(policy == TestDrop) != (st.Dropped == 1) || (policy == TestTag) != (st.Suppressed == 1) {
+				t.Errorf("stats %+v", st)
+			}
+		})
+	}
+}
+
+func TestCancelClient(t *testing.T) {
+	orders, status := queue.NewInMemory(64), queue.NewInMemory(64)
+	var id atomic.Uint64
+	b := New(orders, status, func() (uint64, error) { return id.Add(1), nil })
+	ks := risk.NewKillSwitch(b.CancelClient)
+	sock := filepath.Join(t.TempDir(), "broker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Serve(ctx, l)
+
+	c, err := Dial(sock, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Orders().Enqueue(queue.Order{OrderID: 1, Price: 100, Quantity: 10, Symbol: 1}); err != nil {
+		t.Fatal(err)
+	}
+	nextOrder(t, orders)
+
+	// tripped from any goroutine, the cancel still comes from produce
+	for _, client := range []uint32{7, 8} { // 8 has no session
+		if err := ks.Trip(risk.Breach{ClientID: client, Reason: "max loss"}); err != nil {
+			t.Fatal(err)
+		}
+		if o := nextOrder(t, orders); o.MsgType != queue.MsgCancelAll || o.ClientID != client {
+			t.Fatalf("want CancelAll for client %d, got %+v", client, o)
+		}
+	}
+	ks.Trip(risk.Breach{ClientID: 7, Reason: "again"})
+	time.Sleep(20 * time.Millisecond)
+	if o, _ := orders.Dequeue(); o != nil {
+		t.Fatalf("engaged switch cancelled twice: %+v", o)
+	}
+}
+
+func TestExpireHeldStop(t *testing.T) {
+	orders, status := queue.NewInMemory(64), queue.NewInMemory(64)
+	var id atomic.Uint64
+	b := New(orders, status, func() (uint64, error) { return id.Add(1), nil })
+	var reported atomic.Int32
+	b.OnStatus = func(o queue.Order) {
+		if o.Status == queue.StatusExpired {
+			reported.Add(1)
+		}
+	}
+	sock := filepath.Join(t.TempDir(), "broker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Serve(ctx, l)
+
+	c, err := Dial(sock, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	soon := uint64(time.Now().Add(30 * time.Millisecond).UnixNano())
+	later := uint64(time.Now().Add(time.Hour).UnixNano())
+	for _, o := range []queue.Order{
+		{OrderID: 1, Symbol: 1, Quantity: 10, TriggerPrice: 120, TimeInForce: queue.TIFGoodTillDate, ExpireAt: soon},
+		{OrderID: 2, Symbol: 1, Quantity: 10, TriggerPrice: 130, TimeInForce: queue.TIFGoodTillDate, ExpireAt: later},
+	} {
+		if err := c.Orders().Enqueue(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var got *queue.Order
+	for got == nil && time.Now().Before(deadline) {
+		got, _ = c.Status().Dequeue()
+		time.Sleep(time.Millisecond)
+	}
+	if got == nil || got.OrderID != 1 || got.Status != queue.StatusExpired {
+		t.Fatalf("session got %+v, want stop 1 expired", got)
+	}
+	if reported.Load() != 1 {
+		t.Errorf("OnStatus saw %d expiries, want 1", reported.Load())
+	}
+	if o, _ := orders.Dequeue(); o != nil {
+		t.Fatalf("expired stop reached the ring: %+v", o)
+	}
+	if o, _ := c.Status().Dequeue(); o != nil {
+		t.Fatalf("session got %+v for a stop good for an hour", o)
+	}
+}
+
+func TestBustAfterFill(t *testing.T) {
+	orders, status := queue.NewInMemory(64), queue.NewInMemory(64)
+	var id atomic.Uint64
+	id.Store(100)
+	b := New(orders, status, func() (uint64, error) { return id.Add(1), nil })
+	sock := filepath.Join(t.TempDir(), "broker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Serve(ctx, l)
+
+	c, err := Dial(sock, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Orders().Enqueue(queue.Order{OrderID: 1, Price: 100, Quantity: 10, Symbol: 1}); err != nil {
+		t.Fatal(err)
+	}
+	o := nextOrder(t, orders)
+	fill := o
+	fill.Status = queue.StatusFilled
+	bust := o
+	bust.Status = queue.StatusBusted
+	for _, rec := range []queue.Order{fill, bust} {
+		if err := status.Enqueue(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []uint8{queue.StatusFilled, queue.StatusBusted} {
+		deadline := time.Now().Add(2 * time.Second)
+		var got *queue.Order
+		for got == nil && time.Now().Before(deadline) {
+			got, _ = c.Status().Dequeue()
+			time.Sleep(time.Millisecond)
+		}
+		if got == nil || got.OrderID != 1 || got.Status != want {
+			t.Fatalf("session got %+v, want order 1 with status %d", got, want)
+		}
+	}
+}
+
+func TestStatusReleasedAfterOnStatus(t *testing.T) {
+	status, err := queue.CreateQueue(filepath.Join(t.TempDir(), "status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer status.Close()
+	b := New(queue.NewInMemory(64), status, func() (uint64, error) { return 1, nil })
+	seen := make(chan uint64, 1)
+	b.OnStatus = func(queue.Order) { seen <- status.ConsumerTail() }
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		b.fanOut(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped // before status is closed under it
+	}()
+
+	if err := status.Enqueue(queue.Order{OrderID: 1, Status: queue.StatusFilled}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case tail := <-seen:
+		if tail != 0 {
+			t.Fatalf("slot released before OnStatus ran: tail %d", tail)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnStatus never ran")
+	}
+	waitTail := time.Now().Add(2 * time.Second)
+	for status.ConsumerTail() != 1 {
+		if time.Now().After(waitTail) {
+			t.Fatal("slot never released")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPeers(t *testing.T) {
+	p, err := ParsePeers(fmt.Sprintf("%d:7, 1:8, 0:*", os.Getuid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Allows(uint32(os.Getuid()), 7) || p.Allows(1, 7) || !p.Allows(0, 99) || p.Allows(2, 7) {
+		t.Fatalf("peers %v", p)
+	}
+	for _, bad := range []string{"7", "x:7", "1:y", "1:7,"} {
+		if _, err := ParsePeers(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+
+	orders, status := queue.NewInMemory(64), queue.NewInMemory(64)
+	b := New(orders, status, func() (uint64, error) { return 1, nil })
+	b.Peers = Peers{uint32(os.Getuid()): {7}}
+	sock := filepath.Join(t.TempDir(), "broker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Serve(ctx, l)
+
+	c, err := Dial(sock, 7)
+	if err != nil {
+		t.Fatalf("own client refused: %v", err)
+	}
+	c.Close()
+	if c, err := Dial(sock, 8); err == nil {
+		c.Close()
+		t.Fatal("session opened for a client the uid may not use")
+	}
+}
+
+func TestSkipCorruptedStatus(t *testing.T) {
+	status, err := queue.CreateQueue(filepath.Join(t.TempDir(), "status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer status.Close()
+	b := New(queue.NewInMemory(64), status, func() (uint64, error) { return 1, nil })
+	seen := make(chan uint64, 2)
+	b.OnStatus = func(o queue.Order) { seen <- o.OrderID }
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		b.fanOut(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped // before status is closed under it
+	}()
+
+	for _, o := range []queue.Order{{OrderID: 1, Side: 9}, {OrderID: 2, Status: queue.StatusFilled}} {
+		if err := status.Enqueue(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case id := <-seen:
+		if id != 2 {
+			t.Fatalf("OnStatus saw order %d, want 2", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fanOut stalled on the corrupted record")
+	}
+}
+
+func TestResendRefused(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	status := queue.NewInMemory(64)
+	b := New(queue.NewInMemory(64), status, func() (uint64, error) { return 1, nil })
+	seen := make(chan uint64, 2)
+	b.OnStatus = func(o queue.Order) { seen <- o.OrderID }
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		b.fanOut(ctx)
+		close(stopped)
+	}()
+
+	status.Enqueue(queue.ResendFrom(5, 0))
+	status.Enqueue(queue.Order{OrderID: 2, Status: queue.StatusFilled})
+	select {
+	case id := <-seen:
+		if id != 2 {
+			t.Fatalf("OnStatus saw order %d, want 2", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fanOut stalled on the resend request")
+	}
+	cancel()
+	<-stopped
+	if !strings.Contains(logged.String(), "resend from order 5") {
+		t.Errorf("resend request not reported, logged %q", logged.String())
+	}
+}
+
+func TestSlowReaderKeepsStatus(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	c := &Conn{conn: client, status: queue.NewInMemory(1), done: make(chan struct{}), pongs: make(chan uint64, 1)}
+	go c.read()
+	defer c.Close()
+
+	buf := make([]byte, frameSize)
+	for id := uint64(1); id <= 2; id++ {
+		encode(buf, &queue.Order{OrderID: id})
+		if _, err := server.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for want := uint64(1); want <= 2; want++ {
+		deadline := time.Now().Add(2 * time.Second)
+		var got *queue.Order
+		for got == nil && time.Now().Before(deadline) {
+			got, _ = c.Status().Dequeue()
+			time.Sleep(time.Millisecond)
+		}
+		if got == nil || got.OrderID != want {
+			t.Fatalf("got %+v, want order %d", got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package broker
+
+import (
+	"fmt"
+
+	"oms/queue"
+)
+
+// TestPolicy says what the broker does with test orders: new orders in one
+// of TestOrders.Symbols, the venue convention (ZVZZT and the like) for a
+// client to check its order path end to end without trading anything real.
+type TestPolicy uint8
+
+const (
+	TestPass TestPolicy = iota // sent on like any other order
+	// TestTag sends them to the engine but keeps their status records from
+	// OnStatus, so the store, mirrors, webhooks, post-trade risk and stops
+	// never see them; the session still gets them. The orders themselves
+	// only stay out of what the ring's decorators record when they go by
+	// Broker.TestRing.
+	TestTag
+	// TestDrop never sends them: the broker cancels each back to the
+	// session itself, so they reach neither the ring nor the reports.
+	TestDrop
+)
+
+var testPolicyNames = [...]string{"pass", "tag", "drop"}
+
+func (p TestPolicy) String() string {
+	if int(p) < len(testPolicyNames) {
+		return testPolicyNames[p]
+	}
+	return fmt.Sprintf("TestPolicy(%d)", uint8(p))
+}
+
+// ParseTestPolicy is the inverse of TestPolicy.String.
+func ParseTestPolicy(name string) (TestPolicy, error) {
+	for i, n := range testPolicyNames {
+		if n == name {
+			return TestPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown test order policy %q", name)
+}
+
+// TestOrders picks out test orders by symbol; see TestPolicy.
+type TestOrders struct {
+	Symbols map[uint32]bool
+	Policy  TestPolicy
+}
+
+func (t TestOrders) match(o queue.Order) bool {
+	return o.MsgType == queue.MsgNew && t.Symbols[o.Symbol]
+}
+
+// TestStats counts the session traffic that is not trading.
+type TestStats struct {
+	Heartbeats   uint64 // heartbeats received from sessions
+	TestRequests uint64 // test requests answered
+	TestOrders   uint64 // test orders, whatever the policy did with them
+	Dropped      uint64 // test orders cancelled back under TestDrop
+	Suppressed   uint64 // status records of tagged test orders kept from OnStatus
+}
+
+// TestStats returns the counts so far.
+func (b *Broker) TestStats() TestStats {
+	return TestStats{
+		Heartbeats:   b.heartbeats.Load(),
+		TestRequests: b.testRequests.Load(),
+		TestOrders:   b.testOrders.Load(),
+		Dropped:      b.testDropped.Load(),
+		Suppressed:   b.suppressed.Load(),
+	}
+}
+
+// screenTest counts a session's test order and, under TestDrop, answers it
+// and reports true: the caller is done with it.
+func (b *Broker) screenTest(sub submission) bool {
+	if !b.Tests.match(sub.order) {
+		return false
+	}
+	b.testOrders.Add(1)
+	if b.Tests.Policy != TestDrop {
+		return false
+	}
+	b.testDropped.Add(1)
+	canceled := sub.order
+	canceled.ClientID = sub.s.clientID
+	canceled.Status = queue.StatusCanceled
+	b.send(sub.s, canceled)
+	return true
+}
+
+// suppress reports whether rec belongs to a tagged test order, forgetting
+// the order with its last record.
+func (b *Broker) suppress(rec queue.Order) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.tagged[rec.OrderID] {
+		return false
+	}
+	if closesRoute(rec) {
+		delete(b.tagged, rec.OrderID)
+	}
+	b.suppressed.Add(1)
+	return true
+}
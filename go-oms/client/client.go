@@ -0,0 +1,341 @@
+// Package client is the application-facing API over the order and status
+// queues: submit orders, cancel them and receive their updates, without
+// dealing with ring indices, id correlation or backpressure retries.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oms/queue"
+	"oms/throttle"
+)
+
+// Backpressure decides what Submit does when the order ring is full.
+type Backpressure int
+
+const (
+	// Block retries per Config.Backoff until Config.SubmitTimeout.
+	Block Backpressure = iota
+	// FailFast returns queue.ErrQueueFull immediately.
+	FailFast
+)
+
+type Side uint8
+
+const (
+	Buy  Side = 0
+	Sell Side = 1
+)
+
+// Config describes one client connection.
+type Config struct {
+	OrderQueue    string // path of the order ring
+	StatusQueue   string // path of the status ring; this client becomes its only reader
+	ClientID      uint32
+	Backpressure  Backpressure
+	SubmitTimeout time.Duration   // Block policy only; default 1s
+	Backoff       queue.Backoff   // Block policy only; zero is queue.DefaultBackoff
+	Shed          ShedPolicy      // load shedding for new orders; zero disables
+	Throttle      throttle.Limits // message rates by type; cancels are never throttled
+	PollInterval  time.Duration   // status poll sleep when idle; default 50µs
+	NextID        func() uint64   // order id source; default is a time-seeded counter
+
+	// OnStatusError, when set, is told of errors reading the status ring,
+	// once each until a read succeeds; unset, they are logged. A corrupted
+	// record is skipped where the ring allows it, as a Queue does.
+	OnStatusError func(error)
+}
+
+// Status is one update for an order.
+type Status struct {
+	OrderID  uint64
+	Status   uint8 // queue.Status* value
+	Reason   uint8 // queue.Reason* value when Status is StatusRejected
+	Quantity uint32
+	Price    uint64
+	At       time.Time
+
+	// Execution report fields of a fill; see queue.Order.
+	Liquidity      uint8
+	Fee            int32
+	ContraClientID uint32
+}
+
+// Terminal reports whether no further updates follow.
+func (s Status) Terminal() bool {
+	o := queue.Order{Status: s.Status}
+	return o.Terminal()
+}
+
+var ErrClosed = errors.New("client closed")
+
+// Client is safe for concurrent use.
+type Client struct {
+	cfg    Config
+	orders queue.OrderQueue
+	status queue.OrderQueue
+	owned  []queue.OrderQueue // closed by Close
+
+	sendMu sync.Mutex // the order ring is single-producer
+
+	mu      sync.Mutex
+	handles map[uint64]*OrderHandle
+
+	shed     shedState
+	throttle *throttle.Throttle // nil when Config.Throttle is zero
+
+	closed atomic.Bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Connect opens both queues and starts delivering status updates.
+func Connect(cfg Config) (*Client, error) {
+	orders, err := queue.OpenQueue(cfg.OrderQueue)
+	if err != nil {
+		return nil, fmt.Errorf("open order queue: %w", err)
+	}
+	status, err := queue.OpenQueue(cfg.StatusQueue)
+	if err != nil {
+		orders.Close()
+		return nil, fmt.Errorf("open status queue: %w", err)
+	}
+	c := New(cfg, orders, status)
+	c.owned = []queue.OrderQueue{orders, status}
+	return c, nil
+}
+
+// New builds a client over already-open queues, e.g. in-memory ones in tests.
+// The caller keeps ownership of the queues.
+func New(cfg Config, orders, status queue.OrderQueue) *Client {
+	if cfg.SubmitTimeout == 0 {
+		cfg.SubmitTimeout = time.Second
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 50 * time.Microsecond
+	}
+	if cfg.Shed.Resume <= 0 || cfg.Shed.Resume > cfg.Shed.Threshold {
+		cfg.Shed.Resume = cfg.Shed.Threshold
+	}
+	if cfg.Shed.MaxDelay == 0 {
+		cfg.Shed.MaxDelay = cfg.SubmitTimeout
+	}
+	if cfg.NextID == nil {
+		var seq atomic.Uint64
+		seq.Store(uint64(time.Now().UnixNano()))
+		cfg.NextID = func() uint64 { return seq.Add(1) }
+	}
+	c := &Client{
+		cfg:     cfg,
+		orders:  orders,
+		status:  status,
+		handles: make(map[uint64]*OrderHandle),
+		done:    make(chan struct{}),
+	}
+	if cfg.Throttle.Enabled() {
+		c.throttle = throttle.New(cfg.Throttle)
+	}
+	c.wg.Add(1)
+	go c.readStatus()
+	return c
+}
+
+// OrderHandle follows one submitted order.
+type OrderHandle struct {
+	ID      uint64
+	c       *Client
+	order   queue.Order
+	updates chan Status
+}
+
+// Updates delivers the order's status updates and is closed after the
+// terminal one (or when the client closes).
+func (h *OrderHandle) Updates() <-chan Status {
+	return h.updates
+}
+
+// Cancel asks the engine to cancel the order. The outcome arrives on Updates.
+func (h *OrderHandle) Cancel() error {
+	return h.c.send(queue.Cancel(h.ID, h.order.ClientID, uint64(time.Now().UnixNano())))
+}
+
+// SubmitLimit sends a GTC limit order.
+func (c *Client) SubmitLimit(symbol uint32, side Side, qty uint32, price uint64) (*OrderHandle, error) {
+	return c.Submit(queue.Order{
+		Symbol:   symbol,
+		Side:     uint8(side),
+		Quantity: qty,
+		Price:    price,
+	})
+}
+
+// Submit sends a fully specified order; OrderID, ClientID and Timestamp are
+// filled in by the client. It fails with ErrShed while Config.Shed sheds,
+// and with throttle.ErrThrottled when sent faster than Config.Throttle.
+func (c *Client) Submit(order queue.Order) (*OrderHandle, error) {
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	if err := c.admit(); err != nil {
+		return nil, err
+	}
+	order.OrderID = c.cfg.NextID()
+	order.ClientID = c.cfg.ClientID
+	now := time.Now()
+	order.Timestamp = uint64(now.UnixNano())
+	if c.throttle != nil {
+		if err := c.throttle.Allow(order, now); err != nil {
+			return nil, err
+		}
+	}
+
+	h := &OrderHandle{ID: order.OrderID, c: c, order: order, updates: make(chan Status, 16)}
+	c.mu.Lock()
+	if c.closed.Load() {
+		// Close has taken the handles to close; one added now never would be
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	c.handles[h.ID] = h
+	c.mu.Unlock()
+
+	if err := c.send(order); err != nil {
+		c.mu.Lock()
+		delete(c.handles, h.ID)
+		c.mu.Unlock()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (c *Client) send(msg queue.Order) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.cfg.Backpressure == FailFast {
+		return c.orders.Enqueue(msg)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.SubmitTimeout)
+	defer cancel()
+	err := c.cfg.Backoff.Enqueue(ctx, c.orders, msg)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("submit timed out after %s: %w", c.cfg.SubmitTimeout, queue.ErrQueueFull)
+	}
+	return err
+}
+
+// skipper is a status ring that can step over a record it failed to read.
+type skipper interface {
+	Advance()
+}
+
+func (c *Client) readStatus() {
+	defer c.wg.Done()
+	var failing error // reported, until a read succeeds
+	for {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		rec, err := c.status.Dequeue()
+		if err != nil {
+			if failing == nil || err.Error() != failing.Error() {
+				c.statusError(err)
+				failing = err
+			}
+			if s, ok := c.status.(skipper); ok && errors.Is(err, queue.ErrCorruptedOrder) {
+				s.Advance()
+				failing = nil // the next bad record is another one
+				continue
+			}
+		} else {
+			failing = nil
+		}
+		if err != nil || rec == nil {
+			time.Sleep(c.cfg.PollInterval)
+			continue
+		}
+		if rec.MsgType != queue.MsgNew {
+			continue // control acks; the order-level reports carry the outcome
+		}
+		c.deliver(*rec)
+	}
+}
+
+func (c *Client) statusError(err error) {
+	if c.cfg.OnStatusError != nil {
+		c.cfg.OnStatusError(err)
+		return
+	}
+	log.Printf("[CLIENT] client %d: status ring: %v", c.cfg.ClientID, err)
+}
+
+func (c *Client) deliver(rec queue.Order) {
+	c.mu.Lock()
+	h, ok := c.handles[rec.OrderID]
+	st := Status{OrderID: rec.OrderID, Status: rec.Status, Reason: rec.Reason, Quantity: rec.Quantity, Price: rec.Price, At: time.Now(),
+		Liquidity: rec.Liquidity, Fee: rec.Fee, ContraClientID: rec.ContraClientID}
+	if ok && st.Terminal() {
+		delete(c.handles, rec.OrderID)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	select {
+	case h.updates <- st:
+	default:
+		// a reader that stopped draining its handle must not stall every
+		// other order's updates; only the terminal update is guaranteed,
+		// at the expense of the oldest one still buffered
+		if st.Terminal() {
+			select {
+			case <-h.updates:
+			default:
+			}
+			h.updates <- st
+		}
+	}
+	if st.Terminal() {
+		close(h.updates)
+	}
+}
+
+// ThrottleStats returns the throttle's counts; zero without Config.Throttle.
+func (c *Client) ThrottleStats() throttle.Stats {
+	if c.throttle == nil {
+		return throttle.Stats{}
+	}
+	return c.throttle.Stats()
+}
+
+// Close stops the status reader, closes every open handle's Updates and, for
+// clients from Connect, the queues.
+func (c *Client) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	close(c.done)
+	c.wg.Wait()
+
+	c.mu.Lock()
+	for id, h := range c.handles {
+		close(h.updates)
+		delete(c.handles, id)
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for _, q := range c.owned {
+		errs = append(errs, q.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func newClient(t *testing.T, cfg Config, status queue.OrderQueue) (*Client, *queue.MemQueue) {
+	t.Helper()
+	orders := queue.NewInMemory(4)
+	cfg.ClientID = 7
+	cfg.PollInterval = 100 * time.Microsecond
+	var id uint64
+	cfg.NextID = func() uint64 { id++; return id }
+	c := New(cfg, orders, status)
+	t.Cleanup(func() { c.Close() })
+	return c, orders
+}
+
+func next(t *testing.T, h *OrderHandle) (Status, bool) {
+	t.Helper()
+	select {
+	case st, ok := <-h.Updates():
+		return st, ok
+	case <-time.After(2 * time.Second):
+		t.Fatal("no update")
+		return Status{}, false
+	}
+}
+
+func TestSubmitAndUpdates(t *testing.T) {
+	status := queue.NewInMemory(16)
+	c, orders := newClient(t, Config{}, status)
+
+	h, err := c.SubmitLimit(1, Sell, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := orders.Dequeue()
+	if err != nil || o == nil || o.OrderID != h.ID || o.ClientID != 7 || o.Side != 1 || o.Quantity != 10 || o.Timestamp == 0 {
+		t.Fatalf("ring got %+v %v", o, err)
+	}
+
+	ack := *o
+	ack.Status = queue.StatusPartial
+	ack.Quantity = 4
+	fill := *o
+	fill.Status = queue.StatusFilled
+	fill.Quantity = 6
+	for _, rec := range []queue.Order{queue.CancelAll(99, 7, 1), ack, fill} {
+		status.Enqueue(rec)
+	}
+	if st, ok := next(t, h); !ok || st.Status != queue.StatusPartial || st.Quantity != 4 {
+		t.Fatalf("first update %+v %v", st, ok)
+	}
+	if st, ok := next(t, h); !ok || st.Status != queue.StatusFilled || !st.Terminal() {
+		t.Fatalf("second update %+v %v", st, ok)
+	}
+	if _, ok := next(t, h); ok {
+		t.Fatal("updates left open after the terminal one")
+	}
+
+	if err := h.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := orders.Dequeue(); o == nil || o.MsgType != queue.MsgCancel || o.OrderID != h.ID {
+		t.Fatalf("cancel got %+v", o)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	c, _ := newClient(t, Config{Backpressure: FailFast}, queue.NewInMemory(4))
+	for i := 0; i < 4; i++ {
+		if _, err := c.SubmitLimit(1, Buy, 1, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.SubmitLimit(1, Buy, 1, 100); !errors.Is(err, queue.ErrQueueFull) {
+		t.Fatalf("full ring: got %v, want ErrQueueFull", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	c, _ := newClient(t, Config{}, queue.NewInMemory(4))
+	h, err := c.SubmitLimit(1, Buy, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if _, ok := next(t, h); ok {
+		t.Fatal("open handle's updates left open by Close")
+	}
+	if _, err := c.SubmitLimit(1, Buy, 1, 100); !errors.Is(err, ErrClosed) {
+		t.Fatalf("submit after close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestSubmitRacingClose(t *testing.T) {
+	for range 200 {
+		c, _ := newClient(t, Config{Backpressure: FailFast}, queue.NewInMemory(4))
+		got := make(chan *OrderHandle, 1)
+		go func() {
+			h, _ := c.SubmitLimit(1, Buy, 1, 100)
+			got <- h
+		}()
+		c.Close()
+		if h := <-got; h != nil {
+			if _, ok := next(t, h); ok {
+				t.Fatal("handle registered after Close never closes")
+			}
+		}
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	status, err := queue.CreateQueue(filepath.Join(t.TempDir(), "status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer status.Close()
+	reported := make(chan error, 4)
+	c, orders := newClient(t, Config{OnStatusError: func(err error) { reported <- err }}, status)
+
+	h, err := c.SubmitLimit(1, Buy, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, _ := orders.Dequeue()
+	fill := *o
+	fill.Status = queue.StatusFilled
+	status.Enqueue(queue.Order{OrderID: o.OrderID, Side: 9}) // corrupted
+	status.Enqueue(fill)
+
+	if st, ok := next(t, h); !ok || st.Status != queue.StatusFilled {
+		t.Fatalf("update past the corrupted record: %+v %v", st, ok)
+	}
+	select {
+	case err := <-reported:
+		if !errors.Is(err, queue.ErrCorruptedOrder) {
+			t.Fatalf("reported %v, want ErrCorruptedOrder", err)
+		}
+	default:
+		t.Fatal("corrupted record not reported")
+	}
+	c.Close() // before status is closed under the reader
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"sync/atomic"
+	"time"
+
+	"oms/queue"
+)
+
+// ErrShed is returned for a new order refused because the order ring is
+// above Config.Shed.Threshold.
+var ErrShed = queue.NewReject(queue.ReasonThrottled, "order shed: order queue above load threshold")
+
+// ShedMode decides what happens to a new order while the client is shedding.
+type ShedMode int
+
+const (
+	// ShedReject fails the order with ErrShed at once.
+	ShedReject ShedMode = iota
+	// ShedDelay holds the order until the ring drains below Resume, and
+	// rejects it with ErrShed after MaxDelay.
+	ShedDelay
+)
+
+// ShedPolicy protects the order ring before it is actually full. Only new
+// orders are shed: cancels always go through, since they relieve the book.
+type ShedPolicy struct {
+	Threshold float64 // fill fraction (0..1) that starts shedding; 0 disables
+	Resume    float64 // fill fraction that stops it; default Threshold
+	Mode      ShedMode
+	MaxDelay  time.Duration // ShedDelay only; default Config.SubmitTimeout
+}
+
+// ShedStats counts shed volume since the client was created.
+type ShedStats struct {
+	Rejected uint64        // new orders refused with ErrShed
+	Delayed  uint64        // new orders held back, then sent
+	Delay    time.Duration // total time delayed orders were held
+}
+
+type shedState struct {
+	active   atomic.Bool
+	rejected atomic.Uint64
+	delayed  atomic.Uint64
+	delay    atomic.Int64
+}
+
+// ShedStats returns the load shedding counters.
+func (c *Client) ShedStats() ShedStats {
+	return ShedStats{
+		Rejected: c.shed.rejected.Load(),
+		Delayed:  c.shed.delayed.Load(),
+		Delay:    time.Duration(c.shed.delay.Load()),
+	}
+}
+
+// admit applies the shed policy to a new order.
+func (c *Client) admit() error {
+	p := c.cfg.Shed
+	if p.Threshold <= 0 || !c.overloaded() {
+		return nil
+	}
+	if p.Mode == ShedReject {
+		c.shed.rejected.Add(1)
+		return ErrShed
+	}
+
+	start := time.Now()
+	for c.overloaded() {
+		if c.closed.Load() {
+			return ErrClosed
+		}
+		if time.Since(start) >= p.MaxDelay {
+			c.shed.rejected.Add(1)
+			return ErrShed
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+	c.shed.delayed.Add(1)
+	c.shed.delay.Add(int64(time.Since(start)))
+	return nil
+}
+
+// overloaded samples the ring and flips the shedding state with hysteresis
+// between Threshold and Resume, so the client doesn't flap at the boundary.
+func (c *Client) overloaded() bool {
+	p := c.cfg.Shed
+	fill := float64(c.orders.Depth()) / float64(c.orders.Capacity())
+	if c.shed.active.Load() {
+		if fill < p.Resume {
+			c.shed.active.Store(false)
+		}
+	} else if fill >= p.Threshold {
+		c.shed.active.Store(true)
+	}
+	return c.shed.active.Load()
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestShedReject(t *testing.T) {
+	c, orders := newClient(t, Config{Shed: ShedPolicy{Threshold: 0.5}}, queue.NewInMemory(4))
+	h, err := c.SubmitLimit(1, Buy, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SubmitLimit(1, Buy, 1, 100); err != nil {
+		t.Fatal(err)
+	}
+	// the ring is half full
+	if _, err := c.SubmitLimit(1, Buy, 1, 100); !errors.Is(err, ErrShed) {
+		t.Fatalf("above the threshold: got %v, want ErrShed", err)
+	}
+	if err := h.Cancel(); err != nil {
+		t.Fatalf("cancel while shedding: %v", err)
+	}
+	if d := orders.Depth(); d != 3 {
+		t.Fatalf("ring depth %d, want both orders and the cancel", d)
+	}
+	if st := c.ShedStats(); st != (ShedStats{Rejected: 1}) {
+		t.Errorf("stats %+v, want one rejected", st)
+	}
+}
+
+func TestShedHysteresis(t *testing.T) {
+	c, orders := newClient(t, Config{Shed: ShedPolicy{Threshold: 0.75, Resume: 0.25}}, queue.NewInMemory(4))
+	for range 3 {
+		if _, err := c.SubmitLimit(1, Buy, 1, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// shedding holds until the ring drains below Resume, not Threshold
+	for depth := 3; depth > 0; depth-- {
+		if _, err := c.SubmitLimit(1, Buy, 1, 100); !errors.Is(err, ErrShed) {
+			t.Fatalf("depth %d: got %v, want ErrShed", depth, err)
+		}
+		orders.Dequeue()
+	}
+	// and, resumed, holds off until the ring is back at Threshold
+	for depth := 0; depth < 3; depth++ {
+		if _, err := c.SubmitLimit(1, Buy, 1, 100); err != nil {
+			t.Fatalf("depth %d: %v", depth, err)
+		}
+	}
+	if _, err := c.SubmitLimit(1, Buy, 1, 100); !errors.Is(err, ErrShed) {
+		t.Fatalf("back at the threshold: got %v, want ErrShed", err)
+	}
+	if st := c.ShedStats(); st.Rejected != 4 {
+		t.Errorf("stats %+v, want four rejected", st)
+	}
+}
+
+func TestShedDelay(t *testing.T) {
+	const maxDelay = 100 * time.Millisecond
+	c, orders := newClient(t, Config{Shed: ShedPolicy{Threshold: 0.5, Mode: ShedDelay, MaxDelay: maxDelay}}, queue.NewInMemory(4))
+	for range 2 {
+		if _, err := c.SubmitLimit(1, Buy, 1, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	if _, err := c.SubmitLimit(1, Buy, 1, 100); !errors.Is(err, ErrShed) {
+		t.Fatalf("ring never drained: got %v, want ErrShed", err)
+	}
+	if held := time.Since(start); held < maxDelay || held > time.Second {
+		t.Errorf("held %v, want MaxDelay %v", held, maxDelay)
+	}
+
+	go func() {
+		time.Sleep(maxDelay / 10)
+		orders.Dequeue()
+	}()
+	if _, err := c.SubmitLimit(1, Buy, 1, 100); err != nil {
+		t.Fatalf("ring drained within MaxDelay: %v", err)
+	}
+	st := c.ShedStats()
+	if st.Rejected != 1 || st.Delayed != 1 || st.Delay <= 0 || st.Delay >= maxDelay {
+		t.Errorf("stats %+v, want one rejected and one delayed under %v", st, maxDelay)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"oms/bench"
+)
+
+func compare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	alpha := fs.Float64("alpha", 0.05, "significance level a change must reach")
+	threshold := fs.Float64("threshold", 2, "ignore mean changes smaller than this percentage")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	base, err := bench.Load(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("compare: %v", err)
+	}
+	cur, err := bench.Load(fs.Arg(1))
+	if err != nil {
+		log.Fatalf("compare: %v", err)
+	}
+
+	changes := bench.Compare(base, cur, *alpha, *threshold/100)
+	if len(changes) == 0 {
+		log.Fatalf("compare: %s and %s share no metrics", fs.Arg(0), fs.Arg(1))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "metric\tbaseline\tcurrent\tdelta\tp\t")
+	regressed := false
+	for _, c := range changes {
+		verdict := "~"
+		switch {
+		case c.Regression:
+			verdict, regressed = "REGRESSION", true
+		case c.Improved:
+			verdict = "improved"
+		case c.Base.N < bench.MinSamples || c.Current.N < bench.MinSamples:
+			verdict = "too few samples"
+		}
+		fmt.Fprintf(w, "%s (%s)\t%s\t%s\t%+.1f%%\t%.3f\t%s\n",
+			c.Metric, c.Unit, summary(c.Base), summary(c.Current), c.Delta*100, c.P, verdict)
+	}
+	w.Flush()
+	if regressed {
+		os.Exit(1)
+	}
+}
+
+// summary prints a mean with its spread as a percentage of it.
+func summary(s bench.Summary) string {
+	if s.Mean == 0 {
+		return fmt.Sprintf("%.4g (n=%d)", s.Mean, s.N)
+	}
+	return fmt.Sprintf("%.4g ±%.0f%% (n=%d)", s.Mean, s.Stddev/s.Mean*100, s.N)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "run":
+		run(os.Args[2:])
+	case "compare":
+		compare(os.Args[2:])
+	default:
+		printUsage()
+		os.Exit(2)
+	}
+}
+
+func printUsage() {
+	fmt.Println(`
+Usage: omsbench <command> [flags]
+
+Commands:
+  run [--warmup 2s] [--duration 10s] [--cooldown 1s] [--interval 1s] [--latency-every 64]
+      [-o result.json] [--profile cpu,mem,mutex] [--profile-dir profiles]
+      [--gogc 100|off] [--memlimit 2GiB] [--ballast 256MiB]
+         Push orders through a scratch queue file with a consumer on
+         another thread; records throughput, enqueue-to-dequeue latency
+         and GC pauses once per interval, separately for the warmup,
+         measured and cooldown phases, and profiles the measured phase
+         only. The GC flags tune the collector for the run
+  run --scenario file.yaml [-o result.json] [--profile ...]
+         Play a scenario file instead; its phases replace the three
+         above and those marked measure: true are compared
+  compare [--alpha 0.05] [--threshold 2] baseline.json current.json
+         Report each metric's change with its Mann-Whitney p-value; exits
+         1 if any metric regressed significantly by more than --threshold
+         percent`)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"oms/bench"
+	"oms/cpu"
+	"oms/gctune"
+	"oms/queue"
+	"oms/scenario"
+)
+
+// plan is a run's phases back to back. By default a run has three.
+// Warmup faults in the ring and lets caches and branch predictors settle;
+// cooldown keeps the producer going past the measured window so the drain
+// at shutdown stays out of it. A scenario brings its own phases instead.
+// Each phase gets its own statistics; only measured ones are compared.
+type plan struct {
+	names    []string
+	ends     []int64 // Unix nanoseconds, so the consumer can place an order by its timestamp
+	measured []bool
+	last     time.Time
+}
+
+func newPlan(start time.Time) *plan { return &plan{last: start} }
+
+func (p *plan) add(name string, d time.Duration, measured bool) {
+	p.last = p.last.Add(d)
+	p.names = append(p.names, name)
+	p.ends = append(p.ends, p.last.UnixNano())
+	p.measured = append(p.measured, measured)
+}
+
+// done is the phase index past the last phase.
+func (p *plan) done() int { return len(p.names) }
+
+// at is the phase a moment in Unix nanoseconds falls in.
+func (p *plan) at(ns int64) int {
+	for i, end := range p.ends {
+		if ns < end {
+			return i
+		}
+	}
+	return p.done()
+}
+
+type latencySample struct {
+	phase    int
+	p50, p99 float64
+}
+
+func run(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	queuePath := fs.String("queue", filepath.Join(queue.RuntimeDir(), "omsbench_queue"), "scratch queue file; replaced and removed")
+	warmupFor := fs.Duration("warmup", 2*time.Second, "run this long before measuring, to fault in the ring and settle caches")
+	duration := fs.Duration("duration", 10*time.Second, "how long to measure")
+	cooldownFor := fs.Duration("cooldown", time.Second, "keep producing this long after measuring, so the final drain is not measured")
+	interval := fs.Duration("interval", time.Second, "length of one sample")
+	latencyEvery := fs.Uint64("latency-every", 64, "timestamp every Nth order for latency; reading the clock per order costs throughput")
+	name := fs.String("name", "spsc", "name recorded in the result")
+	out := fs.String("o", "", "write the result as JSON to this file")
+	profileList := fs.String("profile", "", "capture pprof profiles of the measured window: any of "+strings.Join(bench.ProfileKinds, ","))
+	profileDir := fs.String("profile-dir", "profiles", "directory for --profile output")
+	scenarioPath := fs.String("scenario", "", "play this scenario file instead of an unthrottled stream; its phases replace --warmup, --duration and --cooldown")
+	var gc gctune.Config
+	gc.Flags(fs)
+	fs.Parse(args)
+	defer gctune.Apply(gc)()
+	if *latencyEvery == 0 {
+		*latencyEvery = 1
+	}
+	kinds, err := bench.ParseProfiles(*profileList)
+	if err != nil {
+		log.Fatalf("run: %v", err)
+	}
+	var sc *scenario.Scenario
+	if *scenarioPath != "" {
+		if sc, err = scenario.Load(*scenarioPath); err != nil {
+			log.Fatalf("run: %v", err)
+		}
+		if *name == "spsc" && sc.Name != "" {
+			*name = sc.Name
+		}
+	}
+	var profiler *bench.Profiler
+	if len(kinds) > 0 {
+		if profiler, err = bench.NewProfiler(*profileDir, *name, kinds); err != nil {
+			log.Fatalf("run: %v", err)
+		}
+	}
+
+	q, err := queue.CreateQueue(*queuePath)
+	if err != nil {
+		log.Fatalf("run: %v", err)
+	}
+	defer os.Remove(*queuePath)
+	defer q.Close()
+
+	res := bench.NewResult(*name)
+	res.Env["capacity"] = fmt.Sprint(q.Capacity())
+	res.Env["gc"] = gc.String()
+	pl := newPlan(time.Now())
+	if sc != nil {
+		anyMeasured := slices.ContainsFunc(sc.Phases, func(ph scenario.Phase) bool { return ph.Measure })
+		for _, ph := range sc.Phases {
+			pl.add(ph.Name, ph.Duration, ph.Measure || !anyMeasured)
+		}
+	} else {
+		pl.add("warmup", *warmupFor, false)
+		pl.add("measure", *duration, true)
+		pl.add("cooldown", *cooldownFor, false)
+	}
+	addSample := func(p int, metric, unit, better string, v float64) {
+		if pl.measured[p] {
+			res.Add(metric, unit, better, v)
+		} else {
+			res.AddPhase(pl.names[p], metric, unit, better, v)
+		}
+	}
+
+	// the profile covers the first measured phase through the last
+	var profiles []string
+	profiling := false
+	enterPhase := func(p int) {
+		if profiler == nil {
+			return
+		}
+		switch {
+		case !profiling && p < pl.done() && pl.measured[p] && profiles == nil:
+			if err := profiler.Start(); err != nil {
+				log.Fatalf("run: profile: %v", err)
+			}
+			profiling = true
+		case profiling && !slices.Contains(pl.measured[min(p, pl.done()):], true):
+			if profiles, err = profiler.Stop(); err != nil {
+				log.Fatalf("run: profile: %v", err)
+			}
+			profiling = false
+		}
+	}
+
+	var stop atomic.Bool
+	var stall atomic.Int64
+	consumed := make(chan []latencySample)
+	go func() { consumed <- consume(q, &stop, &stall, pl, *interval) }()
+
+	runtime.LockOSThread()
+	if sc != nil {
+		playScenario(sc, q, pl, *interval, *latencyEvery, &stall, enterPhase, addSample)
+	} else {
+		stream(q, pl, *interval, *latencyEvery, enterPhase, addSample)
+	}
+	runtime.UnlockOSThread()
+	stop.Store(true)
+	for _, s := range <-consumed {
+		addSample(s.phase, "latency_p50", "ns", bench.Lower, s.p50)
+		addSample(s.phase, "latency_p99", "ns", bench.Lower, s.p99)
+	}
+
+	for p := range pl.done() {
+		metrics := res.Metrics
+		if !pl.measured[p] {
+			metrics = res.Phases[pl.names[p]]
+		}
+		for _, metric := range []string{"throughput", "latency_p50", "latency_p99", "gc_pauses", "gc_pause_total", "gc_pause_max"} {
+			m, ok := metrics[metric]
+			if !ok {
+				continue
+			}
+			s := bench.Summarize(m.Samples)
+			fmt.Printf("[OMSBENCH] %-8s %-12s %12.4g %-8s ±%.1f%% over %d samples\n",
+				pl.names[p], metric, s.Mean, m.Unit, s.Stddev/max(s.Mean, 1)*100, s.N)
+		}
+	}
+	if *out != "" {
+		if err := res.Save(*out); err != nil {
+			log.Fatalf("run: %v", err)
+		}
+		fmt.Printf("[OMSBENCH] Wrote %s\n", *out)
+	}
+	for _, p := range profiles {
+		fmt.Printf("[OMSBENCH] Profile %s (go tool pprof -http=: %s)\n", p, p)
+	}
+}
+
+// addPauses records an interval's GC pauses next to its throughput, so a
+// dip can be told apart from a collection.
+func addPauses(addSample func(int, string, string, string, float64), phase int, s gctune.PauseSummary) {
+	addSample(phase, "gc_pauses", "pauses", bench.Lower, float64(s.N))
+	addSample(phase, "gc_pause_total", "ns", bench.Lower, float64(s.Total))
+	addSample(phase, "gc_pause_max", "ns", bench.Lower, float64(s.Max))
+}
+
+// stream sends the same order as fast as the ring takes it, sampling
+// throughput and GC pauses every interval.
+func stream(q *queue.Queue, pl *plan, interval time.Duration, latencyEvery uint64, enterPhase func(int), addSample func(int, string, string, string, float64)) {
+	order := queue.Order{ClientID: 1001, Quantity: 100, Price: 50000}
+	cur, last, lastCount := 0, time.Now(), uint64(0)
+	pauses := gctune.ReadPauses()
+	enterPhase(cur)
+	for n := uint64(1); cur != pl.done(); n++ {
+		order.OrderID = n
+		order.Timestamp = 0
+		if n%latencyEvery == 0 {
+			order.Timestamp = uint64(time.Now().UnixNano())
+		}
+		for q.Enqueue(order) != nil {
+			cpu.Relax()
+		}
+		if n%4096 != 0 {
+			continue
+		}
+		now := time.Now()
+		if p := pl.at(now.UnixNano()); p != cur {
+			// a partial interval straddling the boundary is dropped
+			enterPhase(p)
+			cur, last, lastCount = p, now, n
+			pauses = gctune.ReadPauses()
+			continue
+		}
+		if now.Sub(last) >= interval {
+			addSample(cur, "throughput", "orders/s", bench.Higher, float64(n-lastCount)/now.Sub(last).Seconds())
+			next := gctune.ReadPauses()
+			addPauses(addSample, cur, next.Sub(pauses).Summary())
+			last, lastCount, pauses = now, n, next
+		}
+	}
+}
+
+// playScenario plays sc on this thread while a sampler reads its progress
+// every interval. stall_consumer faults go to the consumer through stall.
+func playScenario(sc *scenario.Scenario, q *queue.Queue, pl *plan, interval time.Duration, latencyEvery uint64, stall *atomic.Int64, enterPhase func(int), addSample func(int, string, string, string, float64)) {
+	var prog scenario.Progress
+	type rateSample struct {
+		phase  int
+		rate   float64
+		pauses gctune.PauseSummary
+	}
+	var samples []rateSample
+	sampled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer close(sampled)
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		cur, last, lastCount := 0, time.Now(), uint64(0)
+		pauses := gctune.ReadPauses()
+		for {
+			select {
+			case now := <-tick.C:
+				n := prog.Sent.Load()
+				next := gctune.ReadPauses()
+				if p := int(prog.Phase.Load()); p != cur {
+					cur, last, lastCount, pauses = p, now, n, next
+					continue
+				}
+				samples = append(samples, rateSample{cur, float64(n-lastCount) / now.Sub(last).Seconds(), next.Sub(pauses).Summary()})
+				last, lastCount, pauses = now, n, next
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err := scenario.Play(context.Background(), sc, q, scenario.Options{
+		StampEvery:    latencyEvery,
+		StallConsumer: func(d time.Duration) { stall.Store(int64(d)) },
+		OnPhase:       func(i int, _ *scenario.Phase) { enterPhase(i) },
+	}, &prog)
+	enterPhase(pl.done())
+	cancel()
+	<-sampled
+	if err != nil {
+		log.Fatalf("run: scenario: %v", err)
+	}
+	for _, s := range samples {
+		addSample(s.phase, "throughput", "orders/s", bench.Higher, s.rate)
+		addPauses(addSample, s.phase, s.pauses)
+	}
+}
+
+// consume drains q until stop is set and the ring is empty, returning the
+// p50 and p99 enqueue-to-dequeue latency of the timestamped orders in each
+// interval. An order belongs to the phase it was stamped in, and an
+// interval to a single phase. A duration stored in stall pauses it once.
+func consume(q *queue.Queue, stop *atomic.Bool, stall *atomic.Int64, pl *plan, interval time.Duration) []latencySample {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var samples []latencySample
+	var window []float64
+	cur, last := 0, time.Now()
+	for {
+		if d := stall.Swap(0); d > 0 {
+			time.Sleep(time.Duration(d))
+		}
+		o, err := q.Dequeue()
+		if err != nil {
+			log.Fatalf("run: consumer: %v", err)
+		}
+		if o == nil {
+			if stop.Load() && q.Depth() == 0 {
+				return samples
+			}
+			cpu.Relax()
+			continue
+		}
+		if o.Timestamp == 0 {
+			continue
+		}
+		now := time.Now()
+		if p := pl.at(int64(o.Timestamp)); p != cur {
+			cur, last, window = p, now, window[:0]
+		}
+		window = append(window, float64(now.UnixNano()-int64(o.Timestamp)))
+		if now.Sub(last) >= interval {
+			slices.Sort(window)
+			samples = append(samples, latencySample{cur, percentile(window, 0.50), percentile(window, 0.99)})
+			window, last = window[:0], now
+		}
+	}
+}
+
+// percentile of sorted samples, nearest rank.
+func percentile(sorted []float64, p float64) float64 {
+	return sorted[min(int(p*float64(len(sorted))), len(sorted)-1)]
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"oms/admin"
+	"oms/audit"
+	"oms/book"
+	"oms/broker"
+	"oms/cross"
+	"oms/enrich"
+	"oms/gctune"
+	"oms/handshake"
+	"oms/mirror"
+	"oms/orderid"
+	"oms/queue"
+	"oms/refdata"
+	"oms/reload"
+	"oms/risk"
+	"oms/router"
+	"oms/sdnotify"
+	"oms/session"
+	"oms/slo"
+	"oms/stats"
+	"oms/store"
+	_ "oms/store/drivers"
+	"oms/throttle"
+	"oms/tracker"
+	"oms/webhook"
+)
+
+func main() {
+	socketPath := flag.String("socket", filepath.Join(queue.RuntimeDir(), "broker.sock"), "Unix socket clients connect to")
+	queuePath := flag.String("queue", queue.DefaultPath(), "order queue stream directory or file (env "+queue.EnvQueuePath+"); status queue is <queue>_status")
+	idPath := flag.String("ids", "", "order id state file (default <queue>_ids)")
+	metricsAddr := flag.String("metrics", "", "serve per-symbol Prometheus metrics on this address, e.g. 127.0.0.1:9102")
+	routesPath := flag.String("routes", "", "routing config (JSON) fronting several engines; replaces -queue as the destination")
+	enrichPath := flag.String("enrich", "", "enrichment config (JSON) applied to every new order")
+	control := flag.Bool("control", true, "announce the queue to engines on <queue>_control (single-queue mode)")
+	envWait, envWaitErr := queue.StartupWait()
+	wait := flag.Duration("wait", envWait, "wait up to this long for the queues to be created, by an engine or init container starting alongside (env "+queue.EnvStartupWait+")")
+	memfd := flag.Bool("memfd", false, "create the order and status queues in memory instead of opening <queue>, and pass them to engines over <queue>_control (Linux)")
+	limitsPath := flag.String("limits", "", "risk limits file (JSON) checked on every new order; reloaded on SIGHUP")
+	refPath := flag.String("refdata", "", "instrument CSV every new order is validated against; reloaded on SIGHUP")
+	accountsPath := flag.String("accounts", "", "account hierarchy CSV (firm, client, sub-account) the -limits roll up through; reloaded on SIGHUP")
+	bandWindow := flag.Duration("price-bands", 0, "enforce each -refdata instrument's band_bps around its average trade price over this window, e.g. 5m, refusing orders priced through it (0 = off); needs -limits")
+	locatesPath := flag.String("locates", "", "borrow inventory CSV (symbol, shares) that approves orders marked short, which -limits otherwise refuses; reloaded on SIGHUP")
+	heartbeat := flag.Duration("heartbeat", 0, "heartbeat interval; sessions silent for three are dropped (0 = off)")
+	peersFlag := flag.String("peers", "", "admit a session only for a ClientID the connecting process' uid may use, as uid:client pairs, e.g. 1001:7,1001:8,0:* (Linux; default admits any)")
+	cancelOn := flag.String("cancel-on-disconnect", "never", "cancel a client's open orders when its session ends: never, disconnect or always")
+	testSymbols := flag.String("test-symbols", "", "comma-separated symbol ids whose new orders are test orders, e.g. a venue's test ticker")
+	testOrders := flag.String("test-orders", "drop", "what becomes of -test-symbols orders: pass, tag (sent to the engine, kept out of the reports) or drop (cancelled back by the broker)")
+	sloEnqueue := flag.Duration("slo-enqueue", 0, "enqueue latency objective, e.g. 50us (0 = not tracked)")
+	sloAck := flag.Duration("slo-ack", 0, "latency objective from enqueue to an order's first status, e.g. 2ms (0 = not tracked)")
+	sloGoal := flag.Float64("slo-goal", 0.999, "fraction of events that must meet the latency objectives")
+	sloWindow := flag.Duration("slo-window", time.Hour, "rolling window the SLO burn rate is taken over")
+	sloWebhook := flag.String("slo-webhook", "", "POST SLO alerts as JSON to this URL as well as logging them")
+	storeSpec := flag.String("store", "", "persist accepted orders and execution reports to SQL, as driver:dsn, e.g. sqlite:/var/lib/oms/history.db")
+	kafkaURL := flag.String("kafka-rest", "", "mirror accepted orders and execution reports to Kafka through the REST proxy at this URL, e.g. http://kafka-rest:8082")
+	kafkaOrders := flag.String("kafka-orders", "oms.orders", "Kafka topic for accepted orders")
+	kafkaExecs := flag.String("kafka-executions", "oms.executions", "Kafka topic for execution reports")
+	natsURL := flag.String("nats", "", "publish execution reports to NATS at this URL, e.g. nats://token@nats:4222, one subject per client")
+	natsSubject := flag.String("nats-subject", "oms.status", "NATS subject prefix; client N's reports go to <prefix>.N")
+	webhooksPath := flag.String("webhooks", "", "post execution reports to client HTTP endpoints under this config (YAML), at least once, through a durable outbox")
+	throttleNew := flag.String("throttle-new", "0", "per-client new order rate, e.g. 100/s or 100/s:500 with a burst; orders over it are rejected (0 = off)")
+	throttleQuotes := flag.String("throttle-quotes", "0", "per-client quote request and quote hit rate, as -throttle-new; cancels are never throttled")
+	stageTimings := flag.Bool("stage-timings", false, "time each order from gateway in through risk, the ring and the engine's ack to its fill, exported on -metrics as oms_order_stage_seconds")
+	strict := flag.Bool("strict", false, "zero the fields reserved on the order ring (the engine's status fields, expire_at on good-till-cancel orders) in every message before it is published")
+	adminAddr := flag.String("admin", "", "serve the admin API on this address, e.g. 127.0.0.1:8080, over this broker's open orders, positions, risk limits, kill switch and session gate (token from OMS_ADMIN_TOKEN, audit log at OMS_AUDIT_LOG, default oms-audit.log)")
+	crossPath := flag.String("cross", "", "internalize: cross opposing client orders in the broker under these rules (YAML) before sending what is left to the engine")
+	var gc gctune.Config
+	gc.Flags(flag.CommandLine)
+	flag.Parse()
+	gctune.Apply(gc)
+	log.Printf("[BROKER] GC: %s", gc)
+	if envWaitErr != nil {
+		configError("%v", envWaitErr)
+	}
+	cancelPolicy, err := broker.ParseCancelPolicy(*cancelOn)
+	if err != nil {
+		configError("Invalid -cancel-on-disconnect: %v", err)
+	}
+	var peers broker.Peers
+	if *peersFlag != "" {
+		if peers, err = broker.ParsePeers(*peersFlag); err != nil {
+			configError("Invalid -peers: %v", err)
+		}
+	}
+	var tests broker.TestOrders
+	if tests.Policy, err = broker.ParseTestPolicy(*testOrders); err != nil {
+		configError("Invalid -test-orders: %v", err)
+	}
+	if tests.Symbols, err = parseSymbols(*testSymbols); err != nil {
+		configError("Invalid -test-symbols: %v", err)
+	}
+	var limits throttle.Limits
+	if limits.NewOrders, err = throttle.ParseRate(*throttleNew); err != nil {
+		configError("Invalid -throttle-new: %v", err)
+	}
+	if limits.Quotes, err = throttle.ParseRate(*throttleQuotes); err != nil {
+		configError("Invalid -throttle-quotes: %v", err)
+	}
+	if *idPath == "" {
+		*idPath = orderid.StatePath(*queuePath)
+	}
+	adminToken := os.Getenv("OMS_ADMIN_TOKEN")
+	if *adminAddr != "" && adminToken == "" {
+		configError("-admin needs OMS_ADMIN_TOKEN")
+	}
+	if *memfd && (!*control || *routesPath != "") {
+		configError("-memfd needs the control socket, in single-queue mode")
+	}
+
+	var orders, status queue.OrderQueue
+	var queueFiles []*os.File // passed to engines with -memfd
+	if *routesPath != "" {
+		cfg, err := router.LoadConfig(*routesPath)
+		if err != nil {
+			configError("Failed to load routes: %v", err)
+		}
+		r, err := router.Open(cfg)
+		if err != nil {
+			log.Fatalf("Failed to open routes: %v", err)
+		}
+		defer r.Close()
+		orders, status = r, r.Statuses()
+	} else {
+		q, sq, err := openQueues(*queuePath, *memfd, *wait)
+		if err != nil {
+			log.Fatalf("Failed to open queues: %v", err)
+		}
+		defer q.Close()
+		defer sq.Close()
+		q.RecordHistory(queue.HistoryInterval)
+		go func() {
+			for r := range q.WatchDepth(100*time.Millisecond, 0.8) {
+				for _, e := range r.Crossed {
+					if e.Rising {
+						log.Printf("[BROKER] Order ring above %.0f%% (%d/%d): engine falling behind", e.Threshold*100, e.Depth, e.Capacity)
+					} else {
+						log.Printf("[BROKER] Order ring back below %.0f%% (%d/%d)", e.Threshold*100, e.Depth, e.Capacity)
+					}
+				}
+			}
+		}()
+		orders, status = q, sq
+		if *memfd {
+			queueFiles = []*os.File{q.File(), sq.File()}
+		}
+	}
+	if *strict {
+		orders = &queue.Strict{OrderQueue: orders}
+	}
+	// tagged test orders go on the ring as it is here, past every
+	// decorator that counts, records or mirrors orders
+	raw := orders
+
+	ids, err := orderid.Open(*idPath, uint64(time.Now().UnixNano()))
+	if err != nil {
+		log.Fatalf("Failed to open order id state: %v", err)
+	}
+	defer ids.Close()
+
+	l, err := listen(*socketPath)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *routesPath != "" {
+		fmt.Printf("[BROKER] Serving routes from %s on %s\n", *routesPath, *socketPath)
+	} else if *memfd {
+		fmt.Printf("[BROKER] Serving in-memory queues, passed to engines on %s, on %s\n", handshake.SocketPath(*queuePath), *socketPath)
+	} else {
+		fmt.Printf("[BROKER] Serving %s on %s\n", *queuePath, *socketPath)
+	}
+	if *control && *routesPath == "" {
+		go serveControl(ctx, *queuePath, queueFiles)
+	}
+	symbols := stats.NewSymbols()
+	var timings *tracker.Tracker
+	if *stageTimings {
+		if *metricsAddr == "" {
+			configError("-stage-timings needs -metrics")
+		}
+		timings = tracker.New()
+	}
+	// open orders, for the admin API; the same tracker as the timings
+	openOrders := timings
+	if *adminAddr != "" && openOrders == nil {
+		openOrders = tracker.New()
+	}
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+			symbols.ServeHTTP(w, r)
+			if timings != nil {
+				_ = timings.WritePrometheus(w)
+			}
+		})
+		go func() {
+			log.Printf("[BROKER] Metrics server stopped: %v", http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+	var timed *slo.Timed
+	if *sloEnqueue > 0 || *sloAck > 0 {
+		objective := func(name string, threshold time.Duration) *slo.Tracker {
+			if threshold == 0 {
+				return nil
+			}
+			t, err := slo.NewTracker(slo.Objective{Name: name, Threshold: threshold, Goal: *sloGoal, Window: *sloWindow, MinEvents: 100})
+			if err != nil {
+				configError("Invalid SLO: %v", err)
+			}
+			t.OnAlert(slo.LogAlerts("[BROKER]"))
+			if *sloWebhook != "" {
+				t.OnAlert(slo.Webhook(*sloWebhook))
+			}
+			return t
+		}
+		timed = slo.NewTimed(orders, objective("enqueue", *sloEnqueue), objective("ack", *sloAck))
+		go timed.Run(ctx, time.Second)
+		orders = timed
+	}
+	var ring queue.OrderQueue = orders
+	var internal *cross.Internalizer
+	if *crossPath != "" {
+		cfg, err := cross.Load(*crossPath)
+		if err != nil {
+			configError("Failed to load cross rules: %v", err)
+		}
+		// innermost, so refdata and risk see every order before it crosses
+		internal = cross.New(ring, cfg.Rules())
+		if cfg.Midpoint {
+			if bk, err := book.Open(book.PathFor(*queuePath)); err == nil {
+				defer bk.Close()
+				internal.Book = bk
+			} else {
+				log.Printf("[BROKER] Midpoint crosses disabled, crossing at limit prices: %v", err)
+			}
+		}
+		ring = internal
+	}
+	if openOrders != nil {
+		ring = &tracker.Queue{OrderQueue: ring, Tracker: openOrders}
+	}
+	if timings != nil {
+		// inside refdata and risk, so risk done is stamped after both
+		ring = &tracker.Stamp{OrderQueue: ring, Tracker: timings, Stage: tracker.StageRiskDone}
+	}
+	reloader := &reload.Reloader{}
+	var live *refdata.Live
+	if *refPath != "" {
+		store, err := refdata.Load(*refPath)
+		if err != nil {
+			configError("Failed to load refdata: %v", err)
+		}
+		live = refdata.NewLive(store)
+		ring = &refdata.Gate{OrderQueue: ring, Ref: live}
+		reloader.Add(reload.Refdata(*refPath, live))
+	}
+	var b *broker.Broker // made last, over the finished ring
+	var guard *risk.Guard
+	var checker *risk.Checker
+	if *limitsPath != "" {
+		cfg, err := risk.LoadConfig(*limitsPath)
+		if err != nil {
+			configError("Failed to load risk limits: %v", err)
+		}
+		checker = risk.NewChecker(cfg.Defaults)
+		checker.Apply(cfg)
+		if live != nil {
+			checker.SetRefdata(live)
+		}
+		if *accountsPath != "" {
+			accounts, err := refdata.LoadAccounts(*accountsPath)
+			if err != nil {
+				configError("Failed to load accounts: %v", err)
+			}
+			checker.SetAccounts(accounts)
+			reloader.Add(reload.Accounts(*accountsPath, checker))
+		}
+		// nothing breaches a limit before the broker serves, so b is set
+		guard = &risk.Guard{OrderQueue: ring, Checker: checker, Switch: risk.NewKillSwitch(func(clientID uint32) error {
+			return b.CancelClient(clientID)
+		})}
+		if *adminAddr == "" {
+			log.Printf("[BROKER] No -admin: a client the kill switch fences off stays fenced off until restart")
+		}
+		if *locatesPath != "" {
+			inventory, err := risk.LoadLocates(*locatesPath)
+			if err != nil {
+				configError("Failed to load locates: %v", err)
+			}
+			locates := risk.NewLocates(inventory)
+			guard.Locate = locates
+			reloader.Add(reload.Locates(*locatesPath, locates))
+		}
+		if *bandWindow > 0 {
+			if live == nil {
+				configError("-price-bands needs -refdata")
+			}
+			guard.Bands = risk.NewBands(live, *bandWindow)
+		}
+		ring = guard
+		reloader.Add(reload.RiskLimits(*limitsPath, checker))
+	} else if *accountsPath != "" {
+		configError("-accounts needs -limits")
+	} else if *locatesPath != "" || *bandWindow > 0 {
+		configError("-locates and -price-bands need -limits")
+	}
+	var sess *session.Session
+	if *adminAddr != "" {
+		// open from the start; the admin API halts and reopens it
+		sess = &session.Session{}
+		sess.Set(session.Open)
+		ring = &session.Gate{OrderQueue: ring, Session: sess}
+	}
+	// outside every gate and the internalizer, so their rejects count as
+	// rejects and crossed orders as traffic
+	ring = &stats.Counted{OrderQueue: ring, Symbols: symbols}
+	go reloader.OnHangup(ctx, "[BROKER]")
+	var mirrors sync.WaitGroup
+	var history *store.Writer
+	var db *store.SQL
+	if *storeSpec != "" {
+		db, err = store.Open(*storeSpec)
+		if err != nil {
+			configError("Failed to open store: %v", err)
+		}
+		defer db.Close()
+		history = store.NewWriter(db, store.WriterConfig{})
+		ring = &store.Queue{OrderQueue: ring, Writer: history}
+		mirrors.Go(func() { history.Run(ctx) })
+	}
+	var mirrored, natsStatus *mirror.Mirror
+	if *kafkaURL != "" {
+		mirrored = mirror.New(mirror.NewKafkaREST(*kafkaURL), mirror.Config{OrderTopic: *kafkaOrders, ExecutionTopic: *kafkaExecs})
+		ring = &mirror.Queue{OrderQueue: ring, Mirror: mirrored}
+		mirrors.Go(func() { mirrored.Run(ctx) })
+		log.Printf("[BROKER] Mirroring to Kafka via %s (topics %s, %s)", *kafkaURL, *kafkaOrders, *kafkaExecs)
+	}
+	if *natsURL != "" {
+		nc := mirror.NewNATS(*natsURL)
+		nc.Name = "omsbroker"
+		defer nc.Close()
+		natsStatus = mirror.New(nc, mirror.Config{ExecutionTopic: *natsSubject})
+		mirrors.Go(func() { natsStatus.Run(ctx) })
+		log.Printf("[BROKER] Publishing execution reports to NATS subjects %s.<client>", *natsSubject)
+	}
+	var webhooks *webhook.Dispatcher
+	if *webhooksPath != "" {
+		cfg, err := webhook.Load(*webhooksPath)
+		if err != nil {
+			configError("Failed to load webhooks: %v", err)
+		}
+		if cfg.Outbox == "" {
+			cfg.Outbox = webhook.OutboxPath(*queuePath)
+		}
+		if webhooks, err = webhook.Open(cfg); err != nil {
+			log.Fatalf("Failed to open webhook outbox: %v", err)
+		}
+		mirrors.Go(func() {
+			if err := webhooks.Run(ctx); err != nil {
+				log.Printf("[BROKER] Webhook outbox: %v", err)
+			}
+		})
+		log.Printf("[BROKER] Posting execution reports to %d webhooks, outbox %s (%d pending)", len(cfg.Endpoints), cfg.Outbox, webhooks.Stats().Pending)
+	}
+
+	b = broker.New(ring, status, ids.Next)
+	b.Heartbeat = *heartbeat
+	b.CancelOnDisconnect = cancelPolicy
+	b.Peers = peers
+	b.Tests = tests
+	if tests.Policy == broker.TestTag {
+		b.TestRing = raw
+	}
+	if len(tests.Symbols) > 0 {
+		log.Printf("[BROKER] Test orders on %s: %s", *testSymbols, tests.Policy)
+	}
+	if limits.Enabled() {
+		b.Throttle = throttle.New(limits)
+		log.Printf("[BROKER] Throttling clients: new orders %s, quotes %s", limits.NewOrders, limits.Quotes)
+	}
+	if internal != nil {
+		internal.Report = b.Report
+		go internal.Run(ctx)
+		log.Printf("[BROKER] Internalizing under %s", *crossPath)
+	}
+	b.Timings = timings
+	if guard != nil || timed != nil || history != nil || mirrored != nil || natsStatus != nil || webhooks != nil || openOrders != nil {
+		b.OnStatus = func(status queue.Order) {
+			if openOrders != nil {
+				openOrders.Apply(status)
+			}
+			if timed != nil {
+				timed.OnStatus(status)
+			}
+			if history != nil {
+				history.Execution(status)
+			}
+			if mirrored != nil {
+				mirrored.Execution(status)
+			}
+			if natsStatus != nil {
+				natsStatus.Execution(status)
+			}
+			if webhooks != nil {
+				webhooks.Execution(status)
+			}
+			if guard != nil {
+				if err := guard.OnStatus(status); err != nil {
+					log.Printf("[BROKER] %v", err)
+				}
+			}
+		}
+	}
+	if *enrichPath != "" {
+		cfg, err := enrich.LoadConfig(*enrichPath)
+		if err != nil {
+			configError("Failed to load enrichment config: %v", err)
+		}
+		// sessions send symbol ids, so there is no reference data to resolve
+		if b.Enrich, err = enrich.Build(cfg, nil, nil); err != nil {
+			configError("Invalid enrichment config: %v", err)
+		}
+	}
+	if *adminAddr != "" {
+		srv := &admin.Server{
+			Token:   adminToken,
+			Tracker: openOrders,
+			Risk:    checker,
+			Session: sess,
+			Symbols: symbols,
+			Reload:  reloader.Reload,
+		}
+		if guard != nil {
+			srv.Switch = guard.Switch
+		}
+		if db != nil {
+			srv.History = db
+		}
+		if *routesPath == "" {
+			srv.Queues = map[string]admin.QueueStats{"orders": orders, "status": status}
+			srv.Streams = filepath.Dir(*queuePath)
+		}
+		auditPath := os.Getenv("OMS_AUDIT_LOG")
+		if auditPath == "" {
+			auditPath = "oms-audit.log"
+		}
+		if srv.Audit, err = audit.Open(auditPath); err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer srv.Audit.Close()
+		go func() {
+			log.Printf("[BROKER] Admin server stopped: %v", http.ListenAndServe(*adminAddr, srv.Handler()))
+		}()
+		log.Printf("[BROKER] Serving the admin API on %s, audit log %s", *adminAddr, auditPath)
+	}
+	sdnotify.Notify(sdnotify.Ready, "STATUS=Serving "+l.Addr().String())
+	go sdnotify.Watchdog(ctx, nil)
+	err = b.Serve(ctx, l)
+	sdnotify.Notify(sdnotify.Stopping)
+	if err != nil {
+		log.Fatalf("Broker failed: %v", err)
+	}
+	mirrors.Wait()
+	if history != nil {
+		st := history.Stats()
+		log.Printf("[BROKER] Store: %d written, %d dropped, %d failed", st.Written, st.Dropped, st.Failed)
+	}
+	if mirrored != nil {
+		st := mirrored.Stats()
+		log.Printf("[BROKER] Kafka mirror: %d published, %d dropped, %d failed", st.Published, st.Dropped, st.Failed)
+	}
+	if natsStatus != nil {
+		st := natsStatus.Stats()
+		log.Printf("[BROKER] NATS status: %d published, %d dropped, %d failed", st.Published, st.Dropped, st.Failed)
+	}
+	if webhooks != nil {
+		st := webhooks.Stats()
+		log.Printf("[BROKER] Webhooks: %d queued, %d delivered, %d retries, %d pending", st.Queued, st.Delivered, st.Retries, st.Pending)
+	}
+	if st := b.TestStats(); st != (broker.TestStats{}) {
+		log.Printf("[BROKER] Session traffic: %d heartbeats, %d test requests, %d test orders (%d dropped, %d reports suppressed)",
+			st.Heartbeats, st.TestRequests, st.TestOrders, st.Dropped, st.Suppressed)
+	}
+	if b.Throttle != nil {
+		st := b.Throttle.Stats()
+		log.Printf("[BROKER] Throttle: %d allowed, %d throttled, %d exempt", st.Allowed, st.Throttled, st.Exempt)
+	}
+	if internal != nil {
+		st := internal.Stats()
+		log.Printf("[BROKER] Internalizer: %d crosses, %d shares, %d forwarded, %d still held", st.Crosses, st.Shares, st.Forwarded, st.Held)
+	}
+}
+
+// parseSymbols parses a comma-separated list of symbol ids.
+func parseSymbols(s string) (map[uint32]bool, error) {
+	symbols := make(map[uint32]bool)
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("symbol %q: %w", f, err)
+		}
+		symbols[uint32(id)] = true
+	}
+	return symbols, nil
+}
+
+// configError exits with sdnotify.ExitConfig, so systemd does not restart
+// the broker into the same bad flag or file.
+func configError(format string, args ...any) {
+	log.Printf(format, args...)
+	os.Exit(sdnotify.ExitConfig)
+}
+
+// listen returns the socket systemd passed in when started by a .socket
+// unit, else binds path for owner and group only: this socket is the gate
+// to the order ring. Closing a bound listener removes the file.
+func listen(path string) (net.Listener, error) {
+	ls, err := sdnotify.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(ls) > 0 {
+		for _, extra := range ls[1:] {
+			extra.Close()
+		}
+		return ls[0], nil
+	}
+	_ = os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// openQueues attaches to the order and status queues at path, waiting up
+// to wait for them to be created, or with memfd creates both in memory for
+// serveControl to pass to engines.
+func openQueues(path string, memfd bool, wait time.Duration) (orders, status *queue.Queue, err error) {
+	open := func(p string) (*queue.Queue, error) {
+		if wait > 0 {
+			log.Printf("[BROKER] Opening %s, waiting up to %v for it to be created", p, wait)
+		}
+		return queue.OpenQueueWait(context.Background(), p, wait)
+	}
+	if memfd {
+		open = func(p string) (*queue.Queue, error) { return queue.CreateQueueMemfd(filepath.Base(p)) }
+	}
+	if orders, err = open(path); err != nil {
+		return nil, nil, fmt.Errorf("order queue: %w", err)
+	}
+	if status, err = open(queue.StatusPath(path)); err != nil {
+		orders.Close()
+		return nil, nil, fmt.Errorf("status queue: %w", err)
+	}
+	return orders, status, nil
+}
+
+// serveControl hands engines the queue, its path or with queueFiles the
+// order and status queues themselves, over the control socket and tells
+// them when the broker shuts down.
+func serveControl(ctx context.Context, queuePath string, queueFiles []*os.File) {
+	sockPath := handshake.SocketPath(queuePath)
+	var s *handshake.Server
+	var err error
+	if queueFiles != nil {
+		s, err = handshake.ListenFiles(sockPath, queueFiles[0], queueFiles[1])
+	} else {
+		s, err = handshake.Listen(sockPath, queuePath)
+	}
+	if err != nil {
+		log.Printf("[BROKER] Control socket unavailable: %v", err)
+		return
+	}
+	defer os.Remove(sockPath)
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+	for {
+		e, err := s.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("[BROKER] Engine handshake failed: %v", err)
+			continue
+		}
+		log.Printf("[BROKER] Engine attached (protocol %d, capabilities %v)", e.Version, e.Capabilities)
+		go func() {
+			defer e.Close()
+			select {
+			case <-e.Done():
+				log.Printf("[BROKER] Engine detached: %s", e.Reason())
+			case <-ctx.Done():
+				e.Shutdown("broker stopping")
+			}
+		}()
+	}
+}
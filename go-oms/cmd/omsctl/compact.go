@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"oms/queue"
+)
+
+func compact(args []string) {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	queuePath := fs.String("queue", queue.DefaultPath(), "queue stream or file to compact (env "+queue.EnvQueuePath+")")
+	settle := fs.Duration("settle", 200*time.Millisecond, "how long the indices must stay still before rewriting")
+	fs.Parse(args)
+
+	stats, err := queue.Compact(*queuePath, *settle)
+	if err != nil {
+		log.Fatalf("compact: %v", err)
+	}
+	fmt.Printf("[OMSCTL] %s: kept %d unconsumed orders, dropped %d consumed; %d KiB -> %d KiB on disk\n",
+		*queuePath, stats.Live, stats.Dropped, stats.BytesBefore>>10, stats.BytesAfter>>10)
+}
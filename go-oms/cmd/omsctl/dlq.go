@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"oms/dlq"
+	"oms/queue"
+)
+
+func deadLetter(args []string) {
+	if len(args) < 1 {
+		printUsage()
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("dlq "+args[0], flag.ExitOnError)
+	queuePath := fs.String("queue", queue.DefaultPath(), "order queue file (env "+queue.EnvQueuePath+"); the ring is <queue>_dlq")
+	reasonFlag := fs.String("reason", "", "only entries parked for this reason: validation, risk or consumer-nak")
+	id := fs.Uint64("id", 0, "only the entry with this order id")
+	all := fs.Bool("all", false, "list: include entries already re-driven")
+	fs.Parse(args[1:])
+
+	match := func(e dlq.Entry) bool { return true }
+	if *reasonFlag != "" {
+		reason, err := dlq.ParseReason(*reasonFlag)
+		if err != nil {
+			log.Fatalf("dlq: %v", err)
+		}
+		match = func(e dlq.Entry) bool { return e.Reason == reason }
+	}
+	if *id != 0 {
+		byReason := match
+		match = func(e dlq.Entry) bool { return e.Order.OrderID == *id && byReason(e) }
+	}
+
+	store, err := dlq.Open(dlq.Path(*queuePath))
+	if err != nil {
+		log.Fatalf("Failed to open dead-letter ring: %v", err)
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "list":
+		entries, err := store.List()
+		if err != nil {
+			log.Fatalf("dlq: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tPARKED\tREASON\tTRIES\tORDER\tCLIENT\tSYMBOL\tSIDE\tQTY\tPRICE\tREDRIVEN")
+		for _, e := range entries {
+			if (e.Redriven && !*all) || !match(e) {
+				continue
+			}
+			o := e.Order
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%v\n",
+				e.Seq, e.ParkedAt.Format(time.RFC3339), e.Reason, e.Attempts,
+				o.OrderID, o.ClientID, o.Symbol, o.Side, o.Quantity, o.Price, e.Redriven)
+		}
+		w.Flush()
+	case "redrive":
+		q, err := queue.OpenQueue(*queuePath)
+		if err != nil {
+			log.Fatalf("Failed to open queue: %v", err)
+		}
+		defer q.Close()
+		n, err := store.Redrive(q, match)
+		fmt.Printf("[OMSCTL] Re-drove %d orders\n", n)
+		if err != nil {
+			log.Fatalf("dlq: %v", err)
+		}
+	default:
+		printUsage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"oms/codec"
+	"oms/queue"
+	"oms/wal"
+)
+
+// pickCodec is the codec named by format, else the one path's extension
+// implies, else def; a nil def makes the format required.
+func pickCodec(cmd, format, path string, def codec.Codec) codec.Codec {
+	switch {
+	case format != "":
+		c, err := codec.Lookup(format)
+		if err != nil {
+			configError("%s: %v", cmd, err)
+		}
+		return c
+	case path != "":
+		if c, err := codec.ForPath(path); err == nil {
+			return c
+		}
+	}
+	if def == nil {
+		configError("%s: --format is required for %q", cmd, path)
+	}
+	return def
+}
+
+func walOptions() wal.Options {
+	var opts wal.Options
+	if os.Getenv(wal.EnvKey) != "" {
+		opts.Key = wal.KeyFromEnv(wal.EnvKey)
+	}
+	return opts
+}
+
+func dump(args []string) {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	queuePath := fs.String("queue", queue.DefaultPath(), "queue stream or file whose slots to dump (env "+queue.EnvQueuePath+")")
+	walDir := fs.String("wal", "", "dump the write-ahead log in this directory instead of a queue")
+	from := fs.Uint64("from", 0, "first sequence number to dump: WAL seq, or ring slot seq")
+	format := fs.String("format", "", "capture format: "+strings.Join(codec.Names(), ", ")+" (default: from --out's extension, else json)")
+	out := fs.String("out", "", "file to write (default stdout)")
+	fs.Parse(args)
+	c := pickCodec("dump", *format, *out, codec.JSON)
+
+	var dst io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("dump: %v", err)
+		}
+		defer f.Close()
+		dst = f
+	}
+	w := codec.NewWriter(dst, c)
+	var n int
+	var err error
+	if *walDir != "" {
+		err = wal.Replay(*walDir, walOptions(), *from, func(seq uint64, o queue.Order) error {
+			n++
+			return w.Write(codec.Record{Seq: seq, Order: o})
+		})
+	} else {
+		n, err = dumpQueue(w, *queuePath, *from)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Fatalf("dump: %v", err)
+	}
+	if *out != "" {
+		fmt.Printf("[OMSCTL] wrote %d records to %s as %s\n", n, *out, c.Name())
+	}
+}
+
+// dumpQueue writes the orders still in the ring's slots from seq from on,
+// up to the head when it started: the latest Capacity at most.
+func dumpQueue(w *codec.Writer, path string, from uint64) (int, error) {
+	q, err := queue.OpenQueueReadOnly(path)
+	if err != nil {
+		return 0, err
+	}
+	defer q.Close()
+	end := q.ProducerHead()
+	buf := make([]queue.Order, 4096)
+	n := 0
+	for seq := from; seq < end; {
+		got, next, _ := q.Follow(seq, buf)
+		if len(got) == 0 {
+			break
+		}
+		first := next - uint64(len(got))
+		for i, o := range got {
+			if first+uint64(i) >= end {
+				return n, nil
+			}
+			if err := w.Write(codec.Record{Seq: first + uint64(i), Order: o}); err != nil {
+				return n, err
+			}
+			n++
+		}
+		seq = next
+	}
+	return n, nil
+}
+
+func replay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	queuePath := fs.String("queue", queue.DefaultPath(), "order queue file to enqueue onto (env "+queue.EnvQueuePath+")")
+	in := fs.String("in", "", "capture file written by omsctl dump")
+	format := fs.String("format", "", "capture format: "+strings.Join(codec.Names(), ", ")+" (default: from --in's extension)")
+	from := fs.Uint64("from", 0, "skip records before this sequence number")
+	fs.Parse(args)
+	if *in == "" {
+		configError("replay: --in is required")
+	}
+	c := pickCodec("replay", *format, *in, nil)
+
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	defer f.Close()
+	q, err := queue.OpenQueue(*queuePath)
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	defer q.Close()
+
+	r := codec.NewReader(f, c)
+	n := 0
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("replay: %s after %d records: %v", *in, n, err)
+		}
+		if rec.Seq < *from {
+			continue
+		}
+		if err := queue.DefaultBackoff.Enqueue(context.Background(), q, rec.Order); err != nil {
+			log.Fatalf("replay: record %d: %v", rec.Seq, err)
+		}
+		n++
+	}
+	fmt.Printf("[OMSCTL] replayed %d orders from %s onto %s\n", n, *in, *queuePath)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"oms/billing"
+	"oms/store"
+	_ "oms/store/drivers"
+)
+
+func eod(args []string) {
+	fs := flag.NewFlagSet("eod", flag.ExitOnError)
+	spec := fs.String("store", os.Getenv("OMS_STORE"), "history database as driver:dsn (env OMS_STORE), as omsbroker -store writes it")
+	date := fs.String("date", time.Now().Format(time.DateOnly), "trading day to report, local time")
+	feesPath := fs.String("fees", "", "fee schedule file; adds each client's commission, see package billing")
+	asJSON := fs.Bool("json", false, "print the summaries as JSON; with --fees, an object of summaries and commissions")
+	fs.Parse(args)
+
+	day, err := time.ParseInLocation(time.DateOnly, *date, time.Local)
+	if err != nil {
+		log.Fatalf("eod: --date: %v", err)
+	}
+	if *spec == "" {
+		log.Fatalf("eod: --store is required")
+	}
+	db, err := store.Open(*spec)
+	if err != nil {
+		log.Fatalf("eod: %v", err)
+	}
+	defer db.Close()
+	sums, err := db.Summary(context.Background(), day, day.AddDate(0, 0, 1))
+	if err != nil {
+		log.Fatalf("eod: %v", err)
+	}
+	var commissions []billing.Summary
+	if *feesPath != "" {
+		fees, err := billing.Load(*feesPath)
+		if err != nil {
+			log.Fatalf("eod: %v", err)
+		}
+		ledger := billing.NewLedger(fees, time.Local)
+		err = db.EachExecution(context.Background(), day, day.AddDate(0, 0, 1), func(r store.Record) error {
+			ledger.Add(r.At, r.Order)
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("eod: %v", err)
+		}
+		commissions = ledger.Summaries()
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if *feesPath == "" {
+			enc.Encode(sums)
+			return
+		}
+		enc.Encode(struct {
+			Summaries   []store.Summary   `json:"summaries"`
+			Commissions []billing.Summary `json:"commissions"`
+		}{sums, commissions})
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "CLIENT\tSYMBOL\tORDERS\tFILLS\tFILLED\tNOTIONAL\tFEES\tCANCELED\tREJECTED\tEXPIRED\tBUSTS\t")
+	var total store.Summary
+	for _, s := range sums {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n", s.ClientID, s.Symbol, s.Orders, s.Fills,
+			s.FilledQty, s.Notional, s.Fees, s.Canceled, s.Rejected, s.Expired, s.Busts)
+		total.Orders += s.Orders
+		total.Fills += s.Fills
+		total.FilledQty += s.FilledQty
+		total.Notional += s.Notional
+		total.Fees += s.Fees
+		total.Canceled += s.Canceled
+		total.Rejected += s.Rejected
+		total.Expired += s.Expired
+		total.Busts += s.Busts
+	}
+	fmt.Fprintf(w, "total\t\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n", total.Orders, total.Fills,
+		total.FilledQty, total.Notional, total.Fees, total.Canceled, total.Rejected, total.Expired, total.Busts)
+	w.Flush()
+	if *feesPath != "" {
+		printCommissions(commissions)
+	}
+}
+
+func printCommissions(commissions []billing.Summary) {
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "CLIENT\tFILLS\tSHARES\tNOTIONAL\tCOMMISSION\tVENUE FEES\t")
+	var total billing.Summary
+	for _, c := range commissions {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%d\t\n", c.ClientID, c.Fills, c.Shares, c.Notional, c.Commission, c.VenueFees)
+		total.Fills += c.Fills
+		total.Shares += c.Shares
+		total.Notional += c.Notional
+		total.Commission += c.Commission
+		total.VenueFees += c.VenueFees
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\t%d\t%d\t\n", total.Fills, total.Shares, total.Notional, total.Commission, total.VenueFees)
+	w.Flush()
+}
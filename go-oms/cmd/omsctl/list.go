@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"oms/queue"
+)
+
+func list(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	root := fs.String("root", queue.RuntimeDir(), "directory holding the stream directories")
+	fs.Parse(args)
+
+	streams, err := queue.List(*root)
+	if err != nil {
+		log.Fatalf("list: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STREAM\tKIND\tPAIR\tPIDS\tATTACHED\tHEAD\tTAIL\tDEPTH\tCREATED\tERROR")
+	for _, s := range streams {
+		created, pids, attached, errText := "-", "-", "-", ""
+		if !s.Meta.Created.IsZero() {
+			created = s.Meta.Created.Local().Format(time.RFC3339)
+		}
+		if len(s.PIDs) > 0 {
+			pids = strings.Trim(fmt.Sprint(s.PIDs), "[]")
+		} else if s.InUse {
+			pids = "?" // attached, but the OS does not say by whom
+		}
+		if len(s.Attached) > 0 {
+			names := make([]string, len(s.Attached))
+			for i, a := range s.Attached {
+				names[i] = a.String()
+			}
+			attached = strings.Join(names, ", ")
+		}
+		if s.Err != nil {
+			errText = s.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d/%d\t%s\t%s\n",
+			s.Name, s.Meta.Kind, s.Meta.Pair, pids, attached,
+			s.Stats.ProducerHead, s.Stats.ConsumerTail, s.Stats.Depth, s.Stats.Capacity, created, errText)
+	}
+	w.Flush()
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"oms/dlq"
+	"oms/enrich"
+	"oms/expiry"
+	"oms/gctune"
+	"oms/orderfile"
+	"oms/orderid"
+	"oms/queue"
+	"oms/refdata"
+	"oms/scheduled"
+	"oms/sdnotify"
+	"oms/wal"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "send":
+		send(os.Args[2:])
+	case "dlq":
+		deadLetter(os.Args[2:])
+	case "compact":
+		compact(os.Args[2:])
+	case "list":
+		list(os.Args[2:])
+	case "stat":
+		stat(os.Args[2:])
+	case "dump":
+		dump(os.Args[2:])
+	case "replay":
+		replay(os.Args[2:])
+	case "eod":
+		eod(os.Args[2:])
+	default:
+		printUsage()
+		os.Exit(2)
+	}
+}
+
+func printUsage() {
+	fmt.Println(`
+Usage: omsctl <command> [flags]
+
+Commands:
+  send --file orders.csv [--rate 10k/s] [--governor 0.5] [--refdata instruments.csv] [--enrich rules.json] [--wal dir]
+         Enqueue orders from a CSV/JSON/JSONL file; with --wal each order is
+         handed over through a write-ahead log exactly once, encrypted
+         when ` + wal.EnvKey + ` holds an AES key and, with
+         --wal-compress zstd or lz4, compressed as segments fill;
+         --wal-retain-age and --wal-retain-size drop the oldest sealed
+         segments, never ones a resend or recovery still needs;
+         --resend consumes the status ring and answers the engine's
+         resend requests from the log;
+         rows with a future activate_at are held until then, and
+         dropped if their expire_at passes first; with
+         --dlq rows failing --refdata validation are parked in the
+         dead-letter ring. As a Type=notify unit it reports ready once sending; bad flags exit 78.
+         --gogc, --memlimit and --ballast tune the garbage collector
+  dlq list [--reason r] [--all]
+         Show parked orders not yet re-driven (--all includes them)
+  dlq redrive [--reason r] [--id N]
+         Enqueue parked orders again and mark them re-driven
+  compact [--queue path] [--settle 200ms]
+         Rewrite a queue file with only its unconsumed orders and the
+         indices reset; nothing may have it attached. A file from an
+         older build comes out in this build's layout
+  list [--root dir]
+         Show the queue streams under dir (default the runtime dir):
+         kind, the attached processes and their roles (orphans of
+         crashed processes marked dead), and the indices
+  stat [--queue path] [--history] [--check-reserved]
+         Show a queue's indices and attached processes; --history adds
+         the depth and rate samples its producer kept in the header;
+         --check-reserved checks the order ring's slots for reserved
+         fields a producer left set (see omsbroker -strict)
+  dump [--queue path | --wal dir] [--from seq] [--format f] [--out file]
+         Write the orders still in a queue's slots, or a write-ahead
+         log, as binary, sbe, proto or json (default json, or from the
+         --out extension .bin, .sbe, .pb or .jsonl); see codec for the
+         schemas
+  replay --in file [--format f] [--queue path] [--from seq]
+         Enqueue the orders of a dump again, in order
+  eod --store driver:dsn [--date 2006-01-02] [--fees file] [--json]
+         End-of-day report from the history omsbroker -store keeps:
+         orders, fills, filled quantity, notional and fees net of busts
+         and corrections, cancels, rejects and expiries, per client and
+         symbol; --fees adds each client's commission under a fee
+         schedule file`)
+}
+
+func send(args []string) {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	file := fs.String("file", "", "order file (.csv, .json, .jsonl)")
+	rateFlag := fs.String("rate", "0", "orders per second, e.g. 500/s, 10k/s, 1m/s; 0 = unthrottled")
+	govTarget := fs.Float64("governor", 0, "pace to hold the ring at this utilization (0..1) from consumer lag; --rate becomes the ceiling")
+	refPath := fs.String("refdata", "", "instrument CSV; symbols are numeric ids when omitted")
+	queuePath := fs.String("queue", queue.DefaultPath(), "order queue file (env "+queue.EnvQueuePath+")")
+	startID := fs.Uint64("start-id", 0, "lowest order id for rows without order_id")
+	idPath := fs.String("ids", "", "order id state file, so ids are not reused across runs (default <queue>_ids)")
+	reportPath := fs.String("report", "", "write per-row errors here instead of stderr")
+	walDir := fs.String("wal", "", "append every order to a write-ahead log in this directory")
+	walCompress := fs.String("wal-compress", "none", "compress WAL segments once sealed: none, zstd or lz4")
+	walAge := fs.Duration("wal-retain-age", 0, "drop sealed WAL segments older than this (0 = keep)")
+	walSize := fs.String("wal-retain-size", "0", "drop the oldest sealed WAL segments past this total, e.g. 20GiB (0 = keep)")
+	answerResends := fs.Bool("resend", false, "with --wal, consume <queue>_status and resend from the log what the engine asks for")
+	enrichPath := fs.String("enrich", "", "enrichment config (JSON): accounts, symbol aliases, default tif, capacity")
+	parkFailed := fs.Bool("dlq", false, "park orders failing validation in the dead-letter ring <queue>_dlq")
+	tsFlag := fs.String("timestamps", "order", "order timestamps: order, coarse:N (every N orders) or coarse:<duration>")
+	backoff := queue.DefaultBackoff
+	fs.IntVar(&backoff.Spins, "spins", backoff.Spins, "retries spent spinning on a full queue before sleeping")
+	fs.BoolVar(&backoff.Pause, "pause", backoff.Pause, "issue a CPU pause hint while spinning")
+	fs.IntVar(&backoff.YieldEvery, "yield-every", backoff.YieldEvery, "yield the thread every N spins (0 = never)")
+	fs.DurationVar(&backoff.MaxSleep, "max-sleep", backoff.MaxSleep, "cap of the backoff sleep after spinning (0 = spin only)")
+	var gc gctune.Config
+	gc.Flags(fs)
+	fs.Parse(args)
+	gctune.Apply(gc)
+
+	if *file == "" {
+		configError("send: --file is required")
+	}
+	if *answerResends && *walDir == "" {
+		configError("send: --resend needs --wal to resend from")
+	}
+	rate, err := parseRate(*rateFlag)
+	if err != nil {
+		configError("send: %v", err)
+	}
+	tsMode, err := queue.ParseTimestampMode(*tsFlag)
+	if err != nil {
+		configError("send: %v", err)
+	}
+
+	resolve := orderfile.NumericSymbol
+	var ref *refdata.Store
+	if *refPath != "" {
+		if ref, err = refdata.Load(*refPath); err != nil {
+			log.Fatalf("send: %v", err)
+		}
+		resolve = func(s string) (uint32, error) {
+			inst, err := ref.Resolve(s)
+			return inst.ID, err
+		}
+	}
+
+	var pipeline *enrich.Pipeline
+	if *enrichPath != "" {
+		cfg, err := enrich.LoadConfig(*enrichPath)
+		if err != nil {
+			log.Fatalf("send: %v", err)
+		}
+		if pipeline, err = enrich.Build(cfg, ref, nil); err != nil {
+			configError("send: invalid enrichment config: %v", err)
+		}
+		if ref != nil {
+			// tickers are normalized by the pipeline, per client
+			resolve = func(string) (uint32, error) { return 0, nil }
+		}
+	}
+
+	format, err := orderfile.FormatOf(*file)
+	if err != nil {
+		log.Fatalf("send: %v", err)
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("send: %v", err)
+	}
+	rows, err := orderfile.Read(f, format)
+	f.Close()
+	if err != nil {
+		log.Fatalf("send: %v", err)
+	}
+
+	report := io.Writer(os.Stderr)
+	if *reportPath != "" {
+		rf, err := os.Create(*reportPath)
+		if err != nil {
+			log.Fatalf("send: %v", err)
+		}
+		defer rf.Close()
+		report = rf
+	}
+
+	q, err := queue.OpenQueue(*queuePath)
+	if err != nil {
+		log.Fatalf("Failed to open queue: %v", err)
+	}
+	defer q.Close()
+	q.RecordHistory(queue.HistoryInterval)
+
+	var pub *wal.Publisher
+	if *walDir != "" {
+		opts := walOptions()
+		if opts.Compression, err = wal.ParseCompression(*walCompress); err != nil {
+			configError("%v", err)
+		}
+		opts.Retention.MaxAge = *walAge
+		if opts.Retention.MaxSize, err = gctune.ParseSize(*walSize); err != nil {
+			configError("send: --wal-retain-size: %v", err)
+		}
+		wl, err := wal.Open(*walDir, opts)
+		if err != nil {
+			log.Fatalf("Failed to open wal: %v", err)
+		}
+		defer wl.Close()
+		pub = wal.NewPublisher(wl, q)
+		stats, err := pub.Recover(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to recover wal: %v", err)
+		}
+		if stats != (wal.RecoveryStats{}) {
+			fmt.Printf("[OMSCTL] WAL recovery: %d confirmed, %d republished\n", stats.Confirmed, stats.Republished)
+		}
+		// only now: recovery needs the in-doubt orders an earlier run left
+		pruned, err := wl.Prune()
+		if err != nil {
+			log.Fatalf("Failed to apply wal retention: %v", err)
+		}
+		if pruned.Segments > 0 {
+			fmt.Printf("[OMSCTL] WAL retention: dropped %d segments (%d bytes), log starts at seq %d\n", pruned.Segments, pruned.Bytes, pruned.First)
+		}
+	}
+	if *answerResends {
+		status, err := queue.OpenQueue(queue.StatusPath(*queuePath))
+		if err != nil {
+			log.Fatalf("Failed to open status queue: %v", err)
+		}
+		defer status.Close()
+		ctx, stop := context.WithCancel(context.Background())
+		answering := make(chan struct{})
+		// stopped before the status queue is closed under it
+		defer func() { stop(); <-answering }()
+		go func() {
+			defer close(answering)
+			err := pub.AnswerResends(ctx, status, func(from uint64, n int) {
+				fmt.Printf("[OMSCTL] Resent %d orders from id %d\n", n, from)
+			})
+			if ctx.Err() == nil {
+				log.Printf("[OMSCTL] No longer answering resends: %v", err)
+			}
+		}()
+	}
+
+	if *idPath == "" {
+		*idPath = orderid.StatePath(*queuePath)
+	}
+	ids, err := orderid.Open(*idPath, *startID)
+	if err != nil {
+		log.Fatalf("Failed to open order id state: %v", err)
+	}
+	defer ids.Close()
+
+	var dead *dlq.Store
+	if *parkFailed {
+		if dead, err = dlq.Open(dlq.Path(*queuePath)); err != nil {
+			log.Fatalf("Failed to open dead-letter ring: %v", err)
+		}
+		defer dead.Close()
+	}
+
+	var governor *queue.Governor
+	if *govTarget > 0 {
+		governor = queue.NewGovernor(q, queue.GovernorConfig{Target: *govTarget, MaxRate: rate})
+	}
+
+	stamps := queue.NewStamper(tsMode)
+	defer stamps.Stop()
+
+	fmt.Printf("[OMSCTL] Sending %d rows from %s\n", len(rows), *file)
+	// run as a Type=notify service, e.g. recording a feed through --wal
+	sdnotify.Notify(sdnotify.Ready, fmt.Sprintf("STATUS=Sending %d rows from %s", len(rows), *file))
+	keepAlive, stopKeepAlive := context.WithCancel(context.Background())
+	go sdnotify.Watchdog(keepAlive, nil)
+	defer stopKeepAlive()
+	sent, failed, expired := 0, 0, 0
+	start := time.Now()
+	lastProgress := start
+
+	submit := func(order queue.Order) error {
+		order.Timestamp = stamps.Next()
+		if pub != nil {
+			_, err := pub.Publish(context.Background(), order)
+			return err
+		}
+		return backoff.Enqueue(context.Background(), q, order)
+	}
+	// rows with a future activate_at wait here, released as they come due,
+	// unless the sweeper finds them expired first
+	var sweeper *expiry.Sweeper
+	wheel := scheduled.NewWheel(time.Millisecond, 1024, start, func(order queue.Order) error {
+		sweeper.Done(order.OrderID)
+		if err := submit(order); err != nil {
+			return err
+		}
+		sent++
+		return nil
+	})
+	sweeper = expiry.NewSweeper(func(order queue.Order) {
+		if wheel.Cancel(order.OrderID) {
+			fmt.Fprintf(report, "order %d: expired before activation\n", order.OrderID)
+			expired++
+		}
+	})
+	advance := func() {
+		now := time.Now()
+		sweeper.Sweep(uint64(now.UnixNano()))
+		if _, err := wheel.Advance(now); err != nil {
+			log.Fatalf("Failed to release scheduled order: %v", err)
+		}
+	}
+
+	for _, row := range rows {
+		order, err := toOrder(row, resolve)
+		if err == nil && pipeline != nil {
+			req := enrich.Request{Order: order, Account: row.Record.Account, TIFSet: row.Record.TIF != ""}
+			if ref != nil {
+				req.Ticker = row.Record.Symbol
+			}
+			err = pipeline.Run(&req)
+			order = req.Order
+		}
+		if err != nil {
+			fmt.Fprintf(report, "row %d: %v\n", row.Line, err)
+			failed++
+			continue
+		}
+		if order.OrderID == 0 {
+			if order.OrderID, err = ids.Next(); err != nil {
+				log.Fatalf("send: %v", err)
+			}
+		}
+		if ref != nil {
+			if err := ref.Validate(order); err != nil {
+				fmt.Fprintf(report, "row %d: %v\n", row.Line, err)
+				failed++
+				if dead != nil {
+					order.Timestamp = uint64(time.Now().UnixNano())
+					if err := dead.Park(order, dlq.ReasonValidation, 1); err != nil {
+						log.Fatalf("send: %v", err)
+					}
+				}
+				continue
+			}
+		}
+
+		if at := row.Record.ActivateAt; at > uint64(time.Now().UnixNano()) {
+			if err := wheel.Schedule(order, time.Unix(0, int64(at))); err != nil {
+				fmt.Fprintf(report, "row %d: %v\n", row.Line, err)
+				failed++
+				continue
+			}
+			sweeper.Track(order)
+			continue
+		}
+		advance()
+
+		if governor != nil {
+			if err := governor.Wait(context.Background()); err != nil {
+				log.Fatalf("send: %v", err)
+			}
+		} else if rate > 0 {
+			due := start.Add(time.Duration(float64(sent) / rate * float64(time.Second)))
+			if wait := time.Until(due); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		if err := submit(order); err != nil {
+			log.Fatalf("Failed to send row %d: %v", row.Line, err)
+		}
+		sent++
+
+		if now := time.Now(); now.Sub(lastProgress) >= time.Second {
+			lastProgress = now
+			fmt.Printf("[OMSCTL] Progress: %d/%d sent, %d errors, %.0f orders/sec, depth: %d\n",
+				sent, len(rows), failed, float64(sent)/now.Sub(start).Seconds(), q.Depth())
+			if governor != nil {
+				fmt.Printf("[OMSCTL] Governor rate: %.0f orders/sec\n", governor.Rate())
+			}
+		}
+	}
+
+	if n := wheel.Pending(); n > 0 {
+		fmt.Printf("[OMSCTL] Waiting to release %d scheduled orders\n", n)
+		for wheel.Pending() > 0 {
+			time.Sleep(time.Millisecond)
+			advance()
+		}
+	}
+
+	sdnotify.Notify(sdnotify.Stopping)
+	elapsed := time.Since(start).Seconds()
+	fmt.Printf("[OMSCTL] Done: %d sent, %d errors, %d expired in %.2fs (%.0f orders/sec)\n",
+		sent, failed, expired, elapsed, float64(sent)/elapsed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// configError exits with sdnotify.ExitConfig, so a unit running send does
+// not restart it into the same bad flag.
+func configError(format string, args ...any) {
+	log.Printf(format, args...)
+	os.Exit(sdnotify.ExitConfig)
+}
+
+func toOrder(row orderfile.Row, resolve func(string) (uint32, error)) (queue.Order, error) {
+	if row.Err != nil {
+		return queue.Order{}, row.Err
+	}
+	return row.Record.Order(resolve)
+}
+
+// parseRate accepts "N", "N/s" and k/m suffixes: "500/s", "10k/s", "1.5m".
+func parseRate(s string) (float64, error) {
+	s = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/s")
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1e3, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1e6, strings.TrimSuffix(s, "m")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return v * mult, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"oms/queue"
+)
+
+func stat(args []string) {
+	fs := flag.NewFlagSet("stat", flag.ExitOnError)
+	queuePath := fs.String("queue", queue.DefaultPath(), "queue stream or file (env "+queue.EnvQueuePath+")")
+	history := fs.Bool("history", false, "also show the depth and rate samples recorded in the header")
+	reserved := fs.Bool("check-reserved", false, "check that the orders still in the ring's slots left the reserved fields zero, as omsbroker -strict does; exits 1 if not")
+	fs.Parse(args)
+
+	q, err := queue.OpenQueueReadOnly(*queuePath)
+	if err != nil {
+		log.Fatalf("stat: %v", err)
+	}
+	defer q.Close()
+
+	s := q.Stats()
+	fmt.Printf("%s: depth %d/%d, head %d, tail %d\n", *queuePath, s.Depth, s.Capacity, s.ProducerHead, s.ConsumerTail)
+	if l := q.Layout(); l != queue.CurrentLayout {
+		fmt.Printf("  layout %s from an older build (this one writes %s); omsctl compact upgrades it\n", l, queue.CurrentLayout)
+	}
+	for _, a := range q.Attachments() {
+		fmt.Printf("  attached: %s since %s\n", a, a.Since.Format("2006-01-02 15:04:05"))
+	}
+	if *reserved {
+		checkReserved(q, *queuePath)
+	}
+	if !*history {
+		return
+	}
+	samples := q.History()
+	if len(samples) == 0 {
+		fmt.Println("no history: the producer has not recorded any")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TIME\tDEPTH\tRATE/s\t")
+	for _, p := range samples {
+		fmt.Fprintf(w, "%s\t%d\t%d\t\n", p.At.Format("15:04:05.000"), p.Depth, p.Rate)
+	}
+	w.Flush()
+}
+
+// checkReserved checks every slot still holding a published message, the
+// latest Capacity of them, and exits 1 if any set a reserved field. Status
+// rings are refused: the engine's fields are what they carry.
+func checkReserved(q *queue.ReadOnlyQueue, path string) {
+	if meta, err := queue.ReadStreamMeta(path); err == nil && meta.Kind == queue.StreamStatus {
+		log.Fatalf("stat: %s is a status ring; reserved fields apply to order rings", path)
+	}
+	slots := q.Recent(int(q.Capacity()))
+	bad := 0
+	for _, o := range slots {
+		if err := queue.CheckReserved(o); err != nil {
+			if bad < 10 {
+				fmt.Printf("  %v\n", err)
+			}
+			bad++
+		}
+	}
+	fmt.Printf("reserved fields: %d of %d messages set them\n", bad, len(slots))
+	if bad > 0 {
+		q.Close()
+		os.Exit(1)
+	}
+}
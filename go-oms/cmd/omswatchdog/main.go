@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"oms/sdnotify"
+	"oms/watchdog"
+)
+
+func main() {
+	configPath := flag.String("config", "watchdog.yaml", "watchdog config (YAML)")
+	flag.Parse()
+
+	cfg, err := watchdog.Load(*configPath)
+	if err != nil {
+		configError("Failed to load config: %v", err)
+	}
+	w := watchdog.New(cfg)
+	w.OnAlert(watchdog.LogAlerts("[WATCHDOG]"))
+	if cfg.Webhook != "" {
+		w.OnAlert(watchdog.Webhook(cfg.Webhook))
+	}
+	if cfg.Admin.URL != "" {
+		if os.Getenv(cfg.Admin.TokenEnv) == "" {
+			configError("%s is not set; the watchdog needs an operator token to halt the session", cfg.Admin.TokenEnv)
+		}
+		w.Halt = watchdog.AdminHalt(cfg.Admin)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("[WATCHDOG] Supervising %d processes every %v", len(cfg.Processes), cfg.Interval)
+	sdnotify.Notify(sdnotify.Ready, fmt.Sprintf("STATUS=Supervising %d processes", len(cfg.Processes)))
+	// systemd restarts the watchdog itself if its checks stop
+	go sdnotify.Watchdog(ctx, func() bool { return time.Since(w.LastCheck()) < 3*cfg.Interval })
+	err = w.Run(ctx)
+	sdnotify.Notify(sdnotify.Stopping)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Watchdog: %v", err)
+	}
+	log.Printf("[WATCHDOG] Stopped")
+}
+
+// configError exits with sdnotify.ExitConfig, so systemd does not restart
+// the watchdog into the same bad config.
+func configError(format string, args ...any) {
+	log.Printf(format, args...)
+	os.Exit(sdnotify.ExitConfig)
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"runtime"
 	"sync/atomic"
 	"time"
 
+	"oms/cpu"
 	"oms/queue"
 )
 
@@ -13,7 +15,10 @@ func main() {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
-	q, err := queue.OpenQueue("/tmp/sex")
+	queuePath := flag.String("queue", queue.DefaultPath(), "order queue file")
+	flag.Parse()
+
+	q, err := queue.OpenQueue(*queuePath)
 	if err != nil {
 		panic(err)
 	}
@@ -57,25 +62,19 @@ func main() {
 
 	// INFINITE LOOP
 	count := int64(0)
-	var ts uint64 = uint64(time.Now().UnixNano())
-	updateTick := int64(0)
+	stamps := queue.NewStamper(queue.Coarse(10000))
 
 	for {
-		if updateTick%10000 == 0 {
-			ts = uint64(time.Now().UnixNano())
-		}
-
 		count++
 		order.OrderID = uint64(count)
-		order.Timestamp = ts
+		order.Timestamp = stamps.Next()
 
 		for {
 			if err := q.Enqueue(order); err == nil {
 				atomic.AddInt64(&atomicCount, 1)
 				break
 			}
+			cpu.Relax()
 		}
-
-		updateTick++
 	}
 }
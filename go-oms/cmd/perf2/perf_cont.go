@@ -1,11 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"runtime"
 	"sync/atomic"
 	"time"
 
+	"oms/cpu"
 	"oms/queue"
 )
 
@@ -15,7 +17,10 @@ func main() {
 	defer runtime.UnlockOSThread()
 
 	// Open SHM queue
-	q, err := queue.OpenQueue("/tmp/sex")
+	queuePath := flag.String("queue", queue.DefaultPath(), "order queue file")
+	flag.Parse()
+
+	q, err := queue.OpenQueue(*queuePath)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to open queue: %v", err))
 	}
@@ -79,8 +84,8 @@ func main() {
 				atomicCount.Add(1)
 				break
 			}
-			// Queue full, yield CPU briefly
-			runtime.Gosched()
+			// Queue full: spin politely until the consumer frees a slot
+			cpu.Relax()
 		}
 	}
 }
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"runtime"
 	"sync/atomic"
 	"time"
 
+	"oms/cpu"
 	"oms/queue"
 )
 
@@ -13,7 +15,10 @@ func main() {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
-	q, err := queue.OpenQueue("/tmp/sex")
+	queuePath := flag.String("queue", queue.DefaultPath(), "order queue file")
+	flag.Parse()
+
+	q, err := queue.OpenQueue(*queuePath)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to open queue: %v", err))
 	}
@@ -79,7 +84,7 @@ func main() {
 				atomicCount.Add(1)
 				break
 			}
-			runtime.Gosched()
+			cpu.Relax()
 		}
 	}
 }
@@ -0,0 +1,117 @@
+// Package codec encodes captured orders for the tools that take them out
+// of the system and put them back: omsctl dump writes a WAL or the slots
+// of a queue file in one of these formats, and omsctl replay enqueues
+// such a dump again. Each codec frames a stream of records its own way,
+// so a capture can be handed to analytics in whatever format it reads:
+//
+//	binary  the 64-byte slot as the ring holds it, after its seq
+//	sbe     the same block behind an SBE message header; see capture.sbe.xml
+//	proto   length-delimited protobuf messages; see capture.proto
+//	json    one JSON object per line
+//
+// The field names and protobuf numbers are fixed in fields.go: a field
+// added to the slot gets the next number and keeps it, and the schema
+// files beside this one get the field too.
+package codec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"oms/queue"
+)
+
+// Record is one captured order.
+type Record struct {
+	// Seq is where the order was captured: its WAL sequence number, or
+	// the slot sequence on the ring it was dumped from.
+	Seq   uint64
+	Order queue.Order
+}
+
+// Codec is one capture format.
+type Codec interface {
+	Name() string
+	// Ext is the file extension dumps in the format get, dot included.
+	Ext() string
+	// Append appends r, framed, to dst.
+	Append(dst []byte, r Record) []byte
+	// Read reads the next record. It returns io.EOF at a clean end of
+	// the stream and io.ErrUnexpectedEOF for a record cut short.
+	Read(r *bufio.Reader) (Record, error)
+}
+
+// The codecs, by the names Lookup takes.
+var (
+	Binary Codec = binaryCodec{}
+	SBE    Codec = sbeCodec{}
+	Proto  Codec = protoCodec{}
+	JSON   Codec = jsonCodec{}
+)
+
+var codecs = []Codec{Binary, SBE, Proto, JSON}
+
+// Names lists the codec names, for flag help.
+func Names() []string {
+	names := make([]string, len(codecs))
+	for i, c := range codecs {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// Lookup finds a codec by name.
+func Lookup(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == strings.ToLower(name) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q (want one of %s)", name, strings.Join(Names(), ", "))
+}
+
+// ForPath picks a codec from a file's extension.
+func ForPath(path string) (Codec, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, c := range codecs {
+		if c.Ext() == ext {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown capture file extension %q", ext)
+}
+
+// Writer encodes records onto a stream, buffered: call Flush when done.
+type Writer struct {
+	w   *bufio.Writer
+	c   Codec
+	buf []byte
+}
+
+func NewWriter(w io.Writer, c Codec) *Writer {
+	return &Writer{w: bufio.NewWriter(w), c: c}
+}
+
+func (w *Writer) Write(r Record) error {
+	w.buf = w.c.Append(w.buf[:0], r)
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+func (w *Writer) Flush() error { return w.w.Flush() }
+
+// Reader decodes records from a stream.
+type Reader struct {
+	r *bufio.Reader
+	c Codec
+}
+
+func NewReader(r io.Reader, c Codec) *Reader {
+	return &Reader{r: bufio.NewReader(r), c: c}
+}
+
+// Read returns the next record, or io.EOF after the last.
+func (r *Reader) Read() (Record, error) { return r.c.Read(r.r) }
@@ -0,0 +1,163 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"oms/queue"
+)
+
+var records = []Record{
+	{Seq: 1, Order: queue.Order{OrderID: 1, ClientID: 7, Symbol: 3, Quantity: 100, Price: 50000, Timestamp: 1 << 60}},
+	{Seq: 2, Order: queue.Order{OrderID: 2, ClientID: 7, Side: 1, Status: queue.StatusFilled, Liquidity: 1, Fee: -12, ContraClientID: 9, TriggerPrice: 49000, SubAccount: 2, Flags: 5}},
+	{Seq: 1 << 40},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range codecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, c)
+			for _, r := range records {
+				if err := w.Write(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			full := buf.Len()
+
+			r := NewReader(bytes.NewReader(buf.Bytes()), c)
+			for _, want := range records {
+				got, err := r.Read()
+				if err != nil || got != want {
+					t.Fatalf("got %+v %v, want %+v", got, err, want)
+				}
+			}
+			if _, err := r.Read(); err != io.EOF {
+				t.Fatalf("after the last record: %v, want io.EOF", err)
+			}
+
+			r = NewReader(bytes.NewReader(buf.Bytes()[:full-3]), c)
+			var err error
+			for err == nil {
+				_, err = r.Read()
+			}
+			if !errors.Is(err, io.ErrUnexpectedEOF) && c != JSON {
+				t.Fatalf("cut short: %v, want io.ErrUnexpectedEOF", err)
+			}
+			if err == io.EOF {
+				t.Fatal("a stream cut short read as complete")
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, c := range codecs {
+		if got, err := Lookup(strings.ToUpper(c.Name())); err != nil || got != c {
+			t.Errorf("Lookup(%s) = %v, %v", c.Name(), got, err)
+		}
+		if got, err := ForPath("capture" + c.Ext()); err != nil || got != c {
+			t.Errorf("ForPath(%s) = %v, %v", c.Ext(), got, err)
+		}
+	}
+	if _, err := Lookup("avro"); err == nil {
+		t.Error("Lookup accepted an unknown codec")
+	}
+}
+
+func TestFieldsCoverOrder(t *testing.T) {
+	nums := map[uint64]bool{seqNum: true}
+	covered := map[int]bool{}
+	for _, f := range orderFields {
+		if nums[f.num] {
+			t.Errorf("%s reuses field number %d", f.name, f.num)
+		}
+		nums[f.num], covered[f.index] = true, true
+	}
+	for i := range orderType.NumField() {
+		if !covered[i] {
+			t.Errorf("queue.Order.%s has no codec field: give it the next number", orderType.Field(i).Name)
+		}
+	}
+}
+
+// The schema files handed to downstream readers must describe what the
+// codecs write.
+func TestSchemaFiles(t *testing.T) {
+	proto, err := os.ReadFile("capture.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbe, err := os.ReadFile("capture.sbe.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(proto, []byte(fmt.Sprintf(" %s = %d;", seqName, seqNum))) {
+		t.Errorf("capture.proto lacks %s = %d", seqName, seqNum)
+	}
+	if !bytes.Contains(sbe, []byte(fmt.Sprintf(`id="%d" blockLength="%d"`, sbeTemplateID, blockSize))) {
+		t.Errorf("capture.sbe.xml message is not template %d of %d bytes", sbeTemplateID, blockSize)
+	}
+	if !bytes.Contains(sbe, []byte(fmt.Sprintf(`id="%d" version="%d"`, sbeSchemaID, sbeVersion))) {
+		t.Errorf("capture.sbe.xml schema is not %d version %d", sbeSchemaID, sbeVersion)
+	}
+	for _, f := range orderFields {
+		typ := "uint32"
+		if f.bits == 64 {
+			typ = "uint64"
+		}
+		if f.signed {
+			typ = "sint32"
+		}
+		if want := fmt.Sprintf("%s %s = %d;", typ, f.name, f.num); !bytes.Contains(proto, []byte(want)) {
+			t.Errorf("capture.proto lacks %q", want)
+		}
+		sbeType := fmt.Sprintf("uint%d", f.bits)
+		if f.signed {
+			sbeType = sbeType[1:]
+		}
+		offset := 8 + orderType.Field(f.index).Offset
+		if want := fmt.Sprintf(`<field name="%s" id="%d" type="%s" offset="%d"/>`, f.name, f.num, sbeType, offset); !bytes.Contains(sbe, []byte(want)) {
+			t.Errorf("capture.sbe.xml lacks %s", want)
+		}
+	}
+}
+
+// A reader takes messages from a newer schema: SBE blocks grown at the end,
+// protobuf fields it has no number for.
+func TestNewerSchema(t *testing.T) {
+	want := records[1]
+
+	b := SBE.Append(nil, want)
+	b[0] += 4 // blockLength
+	b = append(b, 0xAA, 0xBB, 0xCC, 0xDD)
+	b = SBE.Append(b, records[0])
+	r := bufio.NewReader(bytes.NewReader(b))
+	if got, err := SBE.Read(r); err != nil || got != want {
+		t.Fatalf("sbe: got %+v %v, want %+v", got, err, want)
+	}
+	if got, err := SBE.Read(r); err != nil || got != records[0] {
+		t.Fatalf("sbe after a longer block: got %+v %v", got, err)
+	}
+
+	var extra []byte
+	extra = append(binary.AppendUvarint(extra, 30<<3|wireBytes), 2, 'h', 'i')
+	extra = append(binary.AppendUvarint(extra, 31<<3|wireFixed32), 1, 2, 3, 4)
+	extra = binary.AppendUvarint(binary.AppendUvarint(extra, 20<<3|wireVarint), 300)
+	msg := Proto.Append(nil, want)
+	msg[0] += byte(len(extra))
+	msg = append(msg, extra...)
+	if got, err := Proto.Read(bufio.NewReader(bytes.NewReader(msg))); err != nil || got != want {
+		t.Fatalf("proto: got %+v %v, want %+v", got, err, want)
+	}
+}
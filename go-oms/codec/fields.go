@@ -0,0 +1,99 @@
+package codec
+
+import (
+	"fmt"
+	"reflect"
+
+	"oms/queue"
+)
+
+// field is an Order field as the self-describing codecs name it.
+type field struct {
+	name   string // JSON key and protobuf field name
+	num    uint64 // protobuf field number; never reused
+	index  int    // of the field in queue.Order
+	bits   int
+	signed bool
+}
+
+// seqField is the Record's own field, ahead of the order's.
+const (
+	seqName = "seq"
+	seqNum  = 1
+)
+
+// orderFields lists every Order field. TestFieldsCoverOrder fails when
+// the schema gains one this table lacks.
+var orderFields = fieldsOf([]struct {
+	goName, name string
+	num          uint64
+}{
+	{"OrderID", "order_id", 2},
+	{"Price", "price", 3},
+	{"Timestamp", "timestamp", 4},
+	{"ExpireAt", "expire_at", 5},
+	{"ClientID", "client_id", 6},
+	{"Quantity", "quantity", 7},
+	{"Symbol", "symbol", 8},
+	{"Side", "side", 9},
+	{"Status", "status", 10},
+	{"TimeInForce", "time_in_force", 11},
+	{"MsgType", "msg_type", 12},
+	{"Flags", "flags", 13},
+	{"Reason", "reason", 14},
+	{"Liquidity", "liquidity", 15},
+	{"SubAccount", "sub_account", 16},
+	{"Fee", "fee", 17},
+	{"ContraClientID", "contra_client_id", 18},
+	{"TriggerPrice", "trigger_price", 19},
+})
+
+var orderType = reflect.TypeFor[queue.Order]()
+
+func fieldsOf(defs []struct {
+	goName, name string
+	num          uint64
+}) []field {
+	fields := make([]field, len(defs))
+	for i, d := range defs {
+		f, ok := orderType.FieldByName(d.goName)
+		if !ok {
+			panic("codec: queue.Order has no field " + d.goName)
+		}
+		fields[i] = field{
+			name:   d.name,
+			num:    d.num,
+			index:  f.Index[0],
+			bits:   f.Type.Bits(),
+			signed: f.Type.Kind() >= reflect.Int && f.Type.Kind() <= reflect.Int64,
+		}
+	}
+	return fields
+}
+
+// get returns the field of o as a uint64, a signed field sign-extended.
+func (f *field) get(o *queue.Order) uint64 {
+	v := reflect.ValueOf(o).Elem().Field(f.index)
+	if f.signed {
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+// set stores v, which get returned or a decoder read, in the field of o,
+// refusing a value the field cannot hold.
+func (f *field) set(o *queue.Order, v uint64) error {
+	fv := reflect.ValueOf(o).Elem().Field(f.index)
+	if f.signed {
+		if fv.OverflowInt(int64(v)) {
+			return fmt.Errorf("%s: %d out of range", f.name, int64(v))
+		}
+		fv.SetInt(int64(v))
+		return nil
+	}
+	if fv.OverflowUint(v) {
+		return fmt.Errorf("%s: %d out of range", f.name, v)
+	}
+	fv.SetUint(v)
+	return nil
+}
@@ -0,0 +1,87 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// jsonCodec writes one object per line, seq first and then every order
+// field by its fields.go name, zero or not, so each line has the same
+// columns. Numbers are as the slot holds them: side 1, not "sell". A
+// reader ignores keys it does not know and leaves missing ones zero.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+func (jsonCodec) Ext() string  { return ".jsonl" }
+
+func (jsonCodec) Append(dst []byte, r Record) []byte {
+	dst = append(dst, `{"`+seqName+`":`...)
+	dst = strconv.AppendUint(dst, r.Seq, 10)
+	for i := range orderFields {
+		f := &orderFields[i]
+		dst = append(dst, `,"`...)
+		dst = append(dst, f.name...)
+		dst = append(dst, `":`...)
+		if f.signed {
+			dst = strconv.AppendInt(dst, int64(f.get(&r.Order)), 10)
+		} else {
+			dst = strconv.AppendUint(dst, f.get(&r.Order), 10)
+		}
+	}
+	return append(dst, "}\n"...)
+}
+
+func (jsonCodec) Read(r *bufio.Reader) (Record, error) {
+	var line []byte
+	for len(bytes.TrimSpace(line)) == 0 {
+		var err error
+		line, err = r.ReadBytes('\n')
+		if err == io.EOF && len(bytes.TrimSpace(line)) > 0 {
+			break // a last line without its newline
+		}
+		if err != nil {
+			return Record{}, err
+		}
+	}
+	var obj map[string]json.Number
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return Record{}, fmt.Errorf("json: %w", err)
+	}
+	var rec Record
+	if n, ok := obj[seqName]; ok {
+		v, err := strconv.ParseUint(string(n), 10, 64)
+		if err != nil {
+			return Record{}, fmt.Errorf("json: %s: %w", seqName, err)
+		}
+		rec.Seq = v
+	}
+	for i := range orderFields {
+		f := &orderFields[i]
+		n, ok := obj[f.name]
+		if !ok {
+			continue
+		}
+		var v uint64
+		var err error
+		if f.signed {
+			var s int64
+			s, err = strconv.ParseInt(string(n), 10, f.bits)
+			v = uint64(s)
+		} else {
+			v, err = strconv.ParseUint(string(n), 10, f.bits)
+		}
+		if err == nil {
+			err = f.set(&rec.Order, v)
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("json: %s: %w", f.name, err)
+		}
+	}
+	return rec, nil
+}
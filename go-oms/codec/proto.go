@@ -0,0 +1,131 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxProtoSize bounds a message: one with every field at its widest is
+// well under it, so a larger length means a damaged stream.
+const maxProtoSize = 512
+
+// Protobuf wire types the messages use, and the ones a reader skips in
+// messages from a newer schema.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoCodec writes each record as a CapturedOrder message from
+// capture.proto, prefixed with its length as a varint, as protobuf's
+// writeDelimitedTo and parseDelimitedFrom do. Zero fields are left out.
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return "proto" }
+func (protoCodec) Ext() string  { return ".pb" }
+
+func (protoCodec) Append(dst []byte, r Record) []byte {
+	var scratch [maxProtoSize]byte
+	msg := appendVarintField(scratch[:0], seqNum, r.Seq)
+	for i := range orderFields {
+		f := &orderFields[i]
+		v := f.get(&r.Order)
+		if f.signed {
+			v = zigzag(int64(v)) // sint32
+		}
+		msg = appendVarintField(msg, f.num, v)
+	}
+	dst = binary.AppendUvarint(dst, uint64(len(msg)))
+	return append(dst, msg...)
+}
+
+func appendVarintField(dst []byte, num, v uint64) []byte {
+	if v == 0 {
+		return dst
+	}
+	dst = binary.AppendUvarint(dst, num<<3|wireVarint)
+	return binary.AppendUvarint(dst, v)
+}
+
+func zigzag(v int64) uint64   { return uint64(v<<1) ^ uint64(v>>63) }
+func unzigzag(v uint64) int64 { return int64(v>>1) ^ -int64(v&1) }
+
+var errProto = errors.New("proto: malformed message")
+
+func (protoCodec) Read(r *bufio.Reader) (Record, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Record{}, err // io.EOF before the first byte, io.ErrUnexpectedEOF after
+	}
+	if n > maxProtoSize {
+		return Record{}, fmt.Errorf("%w: length %d", errProto, n)
+	}
+	msg := make([]byte, n)
+	if err := readFull(r, msg, false); err != nil {
+		return Record{}, err
+	}
+	var rec Record
+	for len(msg) > 0 {
+		key, k := binary.Uvarint(msg)
+		if k <= 0 {
+			return Record{}, errProto
+		}
+		msg = msg[k:]
+		num, wire := key>>3, key&7
+		if wire != wireVarint {
+			if msg, err = skipProto(msg, wire); err != nil {
+				return Record{}, err
+			}
+			continue
+		}
+		v, k := binary.Uvarint(msg)
+		if k <= 0 {
+			return Record{}, errProto
+		}
+		msg = msg[k:]
+		if num == seqNum {
+			rec.Seq = v
+			continue
+		}
+		for i := range orderFields {
+			if f := &orderFields[i]; f.num == num {
+				if f.signed {
+					v = uint64(unzigzag(v))
+				}
+				if err := f.set(&rec.Order, v); err != nil {
+					return Record{}, fmt.Errorf("proto: %w", err)
+				}
+				break
+			}
+		}
+	}
+	return rec, nil
+}
+
+// skipProto skips a field of a type the schema does not use yet.
+func skipProto(msg []byte, wire uint64) ([]byte, error) {
+	var n uint64
+	switch wire {
+	case wireFixed64:
+		n = 8
+	case wireFixed32:
+		n = 4
+	case wireBytes:
+		l, k := binary.Uvarint(msg)
+		if k <= 0 {
+			return nil, errProto
+		}
+		msg, n = msg[k:], l
+	default:
+		return nil, fmt.Errorf("%w: wire type %d", errProto, wire)
+	}
+	if n > uint64(len(msg)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return msg[n:], nil
+}
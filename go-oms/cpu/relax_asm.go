@@ -0,0 +1,13 @@
+//go:build amd64 || arm64
+
+// Package cpu holds spin-wait hints for busy loops.
+package cpu
+
+// Relax is a spin-wait hint: PAUSE on amd64, YIELD on arm64. Call it once
+// per iteration of a loop that polls memory another core writes. It keeps
+// the loop from flooding the pipeline with speculative loads, which leaves
+// the sibling hyperthread room to run when producer and consumer share a
+// physical core, and saves the pipeline flush when the awaited write lands.
+//
+//go:noescape
+func Relax()
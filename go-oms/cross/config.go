@@ -0,0 +1,78 @@
+package cross
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a rules file; fields left out take the defaults shown.
+//
+//	hold: 2ms          # how long an order waits for an opposing one
+//	min_qty: 0         # smallest order that crosses
+//	symbols: [1, 2]    # symbols that cross; all if left out
+//	self_cross: false  # let a client's orders cross each other
+//	midpoint: false    # cross at the engine's midpoint, not the limit
+type Config struct {
+	Hold      time.Duration `yaml:"hold"`
+	MinQty    uint32        `yaml:"min_qty"`
+	Symbols   []uint32      `yaml:"symbols"`
+	SelfCross bool          `yaml:"self_cross"`
+	Midpoint  bool          `yaml:"midpoint"`
+}
+
+// DefaultHold is the hold a rules file gets when it sets none.
+const DefaultHold = 2 * time.Millisecond
+
+// Load reads and validates a rules file.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates a rules file, filling in defaults. Unknown
+// keys are errors.
+func Parse(data []byte) (Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Hold == 0 {
+		cfg.Hold = DefaultHold
+	}
+	return cfg, cfg.Validate()
+}
+
+func (cfg Config) Validate() error {
+	if cfg.Hold < 0 {
+		return fmt.Errorf("hold must be positive")
+	}
+	if cfg.Symbols != nil && len(cfg.Symbols) == 0 {
+		return fmt.Errorf("symbols is empty; leave it out to cross every symbol")
+	}
+	return nil
+}
+
+// Rules builds the rules the file sets.
+func (cfg Config) Rules() Rules {
+	r := Rules{Hold: cfg.Hold, MinQty: cfg.MinQty, SelfCross: cfg.SelfCross, Midpoint: cfg.Midpoint}
+	if cfg.Symbols != nil {
+		r.Symbols = make(map[uint32]bool, len(cfg.Symbols))
+		for _, s := range cfg.Symbols {
+			r.Symbols[s] = true
+		}
+	}
+	return r
+}
@@ -0,0 +1,291 @@
+// Package cross internalizes order flow: it matches opposing client orders
+// inside the OMS before they reach the ring, so crossed quantity never
+// costs a round trip to the engine and both clients can trade inside the
+// spread. Only what is left of an order, once nothing in the OMS crosses
+// it, goes on to the engine.
+//
+// An order eligible under the Rules first crosses against the orders held
+// on the other side of its symbol, best price then oldest first, and is
+// then held itself for Rules.Hold in case an opposing order arrives. Held
+// orders go to the engine when their hold is up, with whatever quantity
+// is left. Internal executions are reported through Report as fills,
+// StatusPartial while part of the order remains, so the status stream
+// reads as though the engine had sent them.
+package cross
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"oms/book"
+	"oms/queue"
+)
+
+// TopOfBook is the engine's best prices, for crossing at the midpoint.
+// *book.Book implements it.
+type TopOfBook interface {
+	BestBid(symbol uint32) (book.Level, bool)
+	BestAsk(symbol uint32) (book.Level, bool)
+}
+
+var _ TopOfBook = (*book.Book)(nil)
+
+// Rules decide which orders cross and where.
+type Rules struct {
+	// Hold is how long an order waits in the OMS for an opposing order
+	// before going to the engine. Zero crosses incoming orders against
+	// held ones only, which then never exist: set it to cross at all.
+	Hold time.Duration
+	// MinQty is the smallest order that crosses; 0 for any.
+	MinQty uint32
+	// Symbols that cross; nil for every symbol.
+	Symbols map[uint32]bool
+	// SelfCross lets a client's orders cross each other.
+	SelfCross bool
+	// Midpoint crosses at the midpoint of the engine's best bid and offer
+	// when there is a Book and the midpoint is within both limits;
+	// otherwise crosses are at the held order's limit price.
+	Midpoint bool
+}
+
+// Eligible reports whether an order may cross. Post-only orders never
+// take liquidity and all-or-none orders cannot be split, so neither do.
+func (r Rules) Eligible(order queue.Order) bool {
+	return order.MsgType == queue.MsgNew && !order.IsStop() && order.Quantity > 0 &&
+		order.Quantity >= r.MinQty && (r.Symbols == nil || r.Symbols[order.Symbol]) &&
+		order.Flags&(queue.FlagPostOnly|queue.FlagAllOrNone) == 0
+}
+
+// Stats count what the internalizer has done.
+type Stats struct {
+	Crosses   uint64 `json:"crosses"`   // matches, each filling two orders
+	Shares    uint64 `json:"shares"`    // quantity crossed
+	Forwarded uint64 `json:"forwarded"` // orders sent to the engine after a hold
+	Held      int    `json:"held"`      // orders held now
+}
+
+type held struct {
+	order queue.Order // Quantity is what is left
+	until time.Time
+}
+
+// Internalizer wraps the order queue the engine reads. It must be the
+// only producer of that queue: held orders are forwarded under the same
+// lock as Enqueue.
+type Internalizer struct {
+	queue.OrderQueue
+	Rules Rules
+	Book  TopOfBook // optional; for Rules.Midpoint
+
+	// Report receives the status records the internalizer makes itself:
+	// two fills per cross, cancels of held orders, and rejections of held
+	// orders the queue refused. It must not call Enqueue.
+	Report func(queue.Order)
+
+	mu    sync.Mutex
+	held  map[uint32][]*held // by symbol, oldest first
+	stats Stats
+}
+
+var _ queue.OrderQueue = (*Internalizer)(nil)
+
+// New returns an internalizer in front of q.
+func New(q queue.OrderQueue, rules Rules) *Internalizer {
+	return &Internalizer{OrderQueue: q, Rules: rules, held: make(map[uint32][]*held)}
+}
+
+func (x *Internalizer) Enqueue(order queue.Order) error {
+	now := time.Now()
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	_ = x.flush(now) // refusals are reported to their own sessions
+
+	switch {
+	case order.MsgType == queue.MsgCancel:
+		x.cancelHeld(now, func(o queue.Order) bool { return o.OrderID == order.OrderID && o.ClientID == order.ClientID })
+	case order.MsgType == queue.MsgCancelAll:
+		x.cancelHeld(now, func(o queue.Order) bool { return o.ClientID == order.ClientID })
+	case order.MsgType == queue.MsgCancelAllSymbol:
+		x.cancelHeld(now, func(o queue.Order) bool { return o.Symbol == order.Symbol })
+	case x.Rules.Eligible(order):
+		if order = x.cross(order, now); order.Quantity == 0 {
+			return nil
+		}
+		if x.Rules.Hold > 0 {
+			x.held[order.Symbol] = append(x.held[order.Symbol], &held{order: order, until: now.Add(x.Rules.Hold)})
+			x.stats.Held++
+			return nil
+		}
+	}
+	// cancels still go on: the engine acks them, and the order may be there
+	return x.OrderQueue.Enqueue(order)
+}
+
+// cross matches order against the held orders on the other side of its
+// symbol and returns it with the quantity left. Called with x.mu held.
+func (x *Internalizer) cross(order queue.Order, now time.Time) queue.Order {
+	resting := x.held[order.Symbol]
+	buy := order.Side != 1
+	candidates := make([]*held, 0, len(resting))
+	for _, h := range resting {
+		o := h.order
+		if (o.Side != 1) == buy || (!x.Rules.SelfCross && o.ClientID == order.ClientID) {
+			continue
+		}
+		if (buy && o.Price <= order.Price) || (!buy && o.Price >= order.Price) {
+			candidates = append(candidates, h)
+		}
+	}
+	// best price first; SortStableFunc keeps the oldest first within a price
+	slices.SortStableFunc(candidates, func(a, b *held) int {
+		if buy {
+			return cmp.Compare(a.order.Price, b.order.Price)
+		}
+		return cmp.Compare(b.order.Price, a.order.Price)
+	})
+	for _, h := range candidates {
+		if order.Quantity == 0 {
+			break
+		}
+		qty := min(order.Quantity, h.order.Quantity)
+		price := x.price(order, h.order)
+		order.Quantity -= qty
+		h.order.Quantity -= qty
+		x.stats.Crosses++
+		x.stats.Shares += uint64(qty)
+		x.report(fillOf(h.order, order.ClientID, qty, price, queue.LiquidityMaker, now))
+		x.report(fillOf(order, h.order.ClientID, qty, price, queue.LiquidityTaker, now))
+	}
+	x.held[order.Symbol] = slices.DeleteFunc(resting, func(h *held) bool {
+		if h.order.Quantity == 0 {
+			x.stats.Held--
+			return true
+		}
+		return false
+	})
+	return order
+}
+
+// price is where incoming crosses resting: the midpoint when the rules ask
+// for it and it suits both, else the resting order's limit.
+func (x *Internalizer) price(incoming, resting queue.Order) uint64 {
+	if !x.Rules.Midpoint || x.Book == nil {
+		return resting.Price
+	}
+	bid, ok1 := x.Book.BestBid(incoming.Symbol)
+	ask, ok2 := x.Book.BestAsk(incoming.Symbol)
+	if !ok1 || !ok2 || bid.Price > ask.Price {
+		return resting.Price
+	}
+	mid := (bid.Price + ask.Price) / 2
+	lo, hi := min(incoming.Price, resting.Price), max(incoming.Price, resting.Price)
+	if mid < lo || mid > hi {
+		return resting.Price
+	}
+	return mid
+}
+
+// fillOf is the status record for qty of order crossed at price against
+// contra. order.Quantity is what is left after it.
+func fillOf(order queue.Order, contra uint32, qty uint32, price uint64, liquidity uint8, now time.Time) queue.Order {
+	fill := order
+	fill.Status = queue.StatusFilled
+	if order.Quantity > 0 {
+		fill.Status = queue.StatusPartial
+	}
+	fill.Quantity = qty
+	fill.Price = price
+	fill.Liquidity = liquidity
+	fill.ContraClientID = contra
+	fill.Fee = 0
+	fill.Timestamp = uint64(now.UnixNano())
+	return fill
+}
+
+// cancelHeld cancels the held orders match picks. Called with x.mu held.
+func (x *Internalizer) cancelHeld(now time.Time, match func(queue.Order) bool) {
+	for symbol, resting := range x.held {
+		x.held[symbol] = slices.DeleteFunc(resting, func(h *held) bool {
+			if !match(h.order) {
+				return false
+			}
+			canceled := h.order
+			canceled.Status = queue.StatusCanceled
+			canceled.Timestamp = uint64(now.UnixNano())
+			x.report(canceled)
+			x.stats.Held--
+			return true
+		})
+	}
+}
+
+// Flush sends the engine every held order whose hold is up at now. Run
+// calls it; Enqueue does too, so a busy queue needs no timer.
+func (x *Internalizer) Flush(now time.Time) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.flush(now)
+}
+
+// flush is Flush with x.mu held. An order the queue is too full for stays
+// held for the next flush; one it refuses is rejected back through Report.
+func (x *Internalizer) flush(now time.Time) error {
+	var errs []error
+	for symbol, resting := range x.held {
+		x.held[symbol] = slices.DeleteFunc(resting, func(h *held) bool {
+			if now.Before(h.until) {
+				return false
+			}
+			err := x.OrderQueue.Enqueue(h.order)
+			if errors.Is(err, queue.ErrQueueFull) {
+				return false
+			}
+			x.stats.Held--
+			if err != nil {
+				errs = append(errs, fmt.Errorf("order %d: %w", h.order.OrderID, err))
+				rejected := h.order
+				rejected.Status, rejected.Reason = queue.StatusRejected, queue.ReasonOf(err)
+				x.report(rejected)
+				return true
+			}
+			x.stats.Forwarded++
+			return true
+		})
+	}
+	return errors.Join(errs...)
+}
+
+// Run flushes held orders as their holds run out, until ctx is done.
+func (x *Internalizer) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(x.Rules.Hold/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := x.Flush(now); err != nil {
+				log.Printf("[CROSS] %v", err)
+			}
+		}
+	}
+}
+
+func (x *Internalizer) report(status queue.Order) {
+	if x.Report != nil {
+		x.Report(status)
+	}
+}
+
+// Stats returns the counts so far.
+func (x *Internalizer) Stats() Stats {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.stats
+}
@@ -0,0 +1,182 @@
+package cross
+
+import (
+	"testing"
+	"time"
+
+	"oms/book"
+	"oms/queue"
+)
+
+type reports []queue.Order
+
+func (r *reports) add(status queue.Order) { *r = append(*r, status) }
+
+func newInternalizer(t *testing.T, rules Rules) (*Internalizer, *queue.MemQueue, *reports) {
+	t.Helper()
+	ring := queue.NewInMemory(16)
+	x := New(ring, rules)
+	r := &reports{}
+	x.Report = r.add
+	return x, ring, r
+}
+
+func order(id uint64, client uint32, side uint8, qty uint32, price uint64) queue.Order {
+	return queue.Order{OrderID: id, ClientID: client, Symbol: 1, Side: side, Quantity: qty, Price: price}
+}
+
+func TestCrossImprovesTaker(t *testing.T) {
+	x, ring, r := newInternalizer(t, Rules{Hold: time.Hour})
+	if err := x.Enqueue(order(1, 7, 1, 100, 101)); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Enqueue(order(2, 8, 0, 100, 105)); err != nil {
+		t.Fatal(err)
+	}
+	if len(*r) != 2 {
+		t.Fatalf("reports = %+v", *r)
+	}
+	maker, taker := (*r)[0], (*r)[1]
+	if maker.OrderID != 1 || maker.Status != queue.StatusFilled || maker.Liquidity != queue.LiquidityMaker || maker.ContraClientID != 8 {
+		t.Errorf("maker fill = %+v", maker)
+	}
+	// the buyer bid 105 and paid the seller's 101
+	if taker.OrderID != 2 || taker.Status != queue.StatusFilled || taker.Price != 101 || taker.Quantity != 100 || taker.ContraClientID != 7 {
+		t.Errorf("taker fill = %+v", taker)
+	}
+	if rec, _ := ring.Dequeue(); rec != nil {
+		t.Errorf("crossed order reached the engine: %+v", rec)
+	}
+	if st := x.Stats(); st.Crosses != 1 || st.Shares != 100 || st.Held != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestResidualForwardedAfterHold(t *testing.T) {
+	x, ring, r := newInternalizer(t, Rules{Hold: time.Minute})
+	x.Enqueue(order(1, 7, 0, 30, 100))
+	x.Enqueue(order(2, 8, 1, 50, 99))
+	if len(*r) != 2 || (*r)[0].Status != queue.StatusFilled || (*r)[1].Status != queue.StatusPartial || (*r)[1].Quantity != 30 {
+		t.Fatalf("reports = %+v", *r)
+	}
+	if err := x.Flush(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if rec, _ := ring.Dequeue(); rec != nil {
+		t.Fatalf("forwarded before the hold was up: %+v", rec)
+	}
+	if err := x.Flush(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	rec, _ := ring.Dequeue()
+	if rec == nil || rec.OrderID != 2 || rec.Quantity != 20 {
+		t.Fatalf("forwarded = %+v, want order 2 for the 20 left", rec)
+	}
+	if st := x.Stats(); st.Forwarded != 1 || st.Held != 0 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestNoSelfCross(t *testing.T) {
+	x, _, r := newInternalizer(t, Rules{Hold: time.Hour})
+	x.Enqueue(order(1, 7, 0, 10, 100))
+	x.Enqueue(order(2, 7, 1, 10, 100))
+	if len(*r) != 0 {
+		t.Fatalf("client crossed itself: %+v", *r)
+	}
+	x.Rules.SelfCross = true
+	x.Enqueue(order(3, 7, 1, 10, 100))
+	if len(*r) != 2 || (*r)[0].OrderID != 1 || (*r)[1].OrderID != 3 {
+		t.Fatalf("reports = %+v", *r)
+	}
+}
+
+func TestCrossOrder(t *testing.T) {
+	x, _, r := newInternalizer(t, Rules{Hold: time.Hour})
+	x.Enqueue(order(1, 7, 1, 10, 102))
+	x.Enqueue(order(2, 8, 1, 10, 101))
+	x.Enqueue(order(3, 9, 1, 10, 101))
+	x.Enqueue(order(4, 5, 0, 25, 102))
+	var makers []uint64
+	for _, rec := range *r {
+		if rec.Liquidity == queue.LiquidityMaker {
+			makers = append(makers, rec.OrderID)
+		}
+	}
+	if len(makers) != 3 || makers[0] != 2 || makers[1] != 3 || makers[2] != 1 {
+		t.Errorf("makers = %v, want best price then oldest: [2 3 1]", makers)
+	}
+	if last := (*r)[len(*r)-1]; last.OrderID != 4 || last.Status != queue.StatusFilled || last.Quantity != 5 || last.Price != 102 {
+		t.Errorf("last fill = %+v", last)
+	}
+}
+
+func TestCancelHeld(t *testing.T) {
+	x, ring, r := newInternalizer(t, Rules{Hold: time.Hour})
+	x.Enqueue(order(1, 7, 0, 10, 100))
+	x.Enqueue(queue.Order{OrderID: 1, ClientID: 7, Symbol: 1, MsgType: queue.MsgCancel})
+	if len(*r) != 1 || (*r)[0].OrderID != 1 || (*r)[0].Status != queue.StatusCanceled {
+		t.Fatalf("reports = %+v", *r)
+	}
+	// the cancel still goes on to the engine
+	if rec, _ := ring.Dequeue(); rec == nil || rec.MsgType != queue.MsgCancel {
+		t.Errorf("engine got %+v, want the cancel", rec)
+	}
+	x.Enqueue(order(2, 8, 1, 10, 100))
+	if len(*r) != 1 {
+		t.Errorf("crossed a canceled order: %+v", *r)
+	}
+}
+
+func TestIneligible(t *testing.T) {
+	x, ring, r := newInternalizer(t, Rules{Hold: time.Hour, MinQty: 10, Symbols: map[uint32]bool{1: true}})
+	small := order(1, 7, 0, 5, 100)
+	other := order(2, 7, 0, 50, 100)
+	other.Symbol = 2
+	postOnly := order(3, 7, 0, 50, 100)
+	postOnly.Flags = queue.FlagPostOnly
+	for _, o := range []queue.Order{small, other, postOnly} {
+		x.Enqueue(o)
+		if rec, _ := ring.Dequeue(); rec == nil || rec.OrderID != o.OrderID {
+			t.Errorf("order %d was held, want it sent on", o.OrderID)
+		}
+	}
+	if len(*r) != 0 || x.Stats().Held != 0 {
+		t.Errorf("reports = %+v", *r)
+	}
+}
+
+type top struct{ bid, ask uint64 }
+
+func (b top) BestBid(uint32) (book.Level, bool) { return book.Level{Price: b.bid, Quantity: 1}, true }
+func (b top) BestAsk(uint32) (book.Level, bool) { return book.Level{Price: b.ask, Quantity: 1}, true }
+
+func TestMidpoint(t *testing.T) {
+	x, _, r := newInternalizer(t, Rules{Hold: time.Hour, Midpoint: true})
+	x.Book = top{bid: 100, ask: 104}
+	x.Enqueue(order(1, 7, 1, 10, 101))
+	x.Enqueue(order(2, 8, 0, 10, 103))
+	if len(*r) != 2 || (*r)[0].Price != 102 || (*r)[1].Price != 102 {
+		t.Fatalf("reports = %+v, want both at the 102 midpoint", *r)
+	}
+	// a midpoint outside the limits falls back to the resting price
+	x.Enqueue(order(3, 7, 1, 10, 103))
+	x.Enqueue(order(4, 8, 0, 10, 104))
+	if got := (*r)[3].Price; got != 103 {
+		t.Errorf("price = %d, want 103", got)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := Parse([]byte("min_qty: 100\nsymbols: [1, 2]\nmidpoint: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := cfg.Rules()
+	if rules.Hold != DefaultHold || rules.MinQty != 100 || !rules.Symbols[2] || rules.Symbols[3] || !rules.Midpoint {
+		t.Errorf("rules = %+v", rules)
+	}
+	if _, err := Parse([]byte("hold: 1ms\nbogus: 1\n")); err == nil {
+		t.Error("unknown key accepted")
+	}
+}
@@ -0,0 +1,262 @@
+// Package dlq is the dead-letter ring: orders refused by validation, risk or
+// a consumer that keeps rejecting them are parked here with a reason code,
+// so an operator can inspect them and re-drive them once the cause is fixed.
+//
+// The ring is a small file of fixed 64-byte entries. When it is full the
+// oldest entry is overwritten. Parking is off the hot path, so entries are
+// written with plain file I/O under an flock, which lets omsctl inspect and
+// re-drive while a producer keeps parking.
+package dlq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"oms/queue"
+)
+
+const (
+	magic      uint32 = 0x4F4D5344 // "OMSD"
+	version    uint32 = 2
+	headerSize        = 64 // magic u32, version u32, capacity u32, pad u32, head u64
+	entrySize         = 80 // order 64, parked at u64, reason u8, attempts u8, redriven u8, pad 5
+	orderSize         = 64
+
+	// DefaultCapacity is the number of entries a new ring holds.
+	DefaultCapacity = 4096
+)
+
+// Reason says why an order was parked.
+type Reason uint8
+
+const (
+	ReasonValidation  Reason = 1 // failed reference data or field validation
+	ReasonRisk        Reason = 2 // refused by a pre-trade risk check or kill switch
+	ReasonConsumerNak Reason = 3 // rejected by the engine too many times
+)
+
+func (r Reason) String() string {
+	switch r {
+	case ReasonValidation:
+		return "validation"
+	case ReasonRisk:
+		return "risk"
+	case ReasonConsumerNak:
+		return "consumer-nak"
+	}
+	return fmt.Sprintf("reason(%d)", uint8(r))
+}
+
+// ParseReason is the inverse of Reason.String.
+func ParseReason(s string) (Reason, error) {
+	for _, r := range []Reason{ReasonValidation, ReasonRisk, ReasonConsumerNak} {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dead-letter reason %q", s)
+}
+
+// Entry is one parked order.
+type Entry struct {
+	Seq      uint64 // position in the ring since it was created
+	Order    queue.Order
+	Reason   Reason
+	Attempts uint8
+	ParkedAt time.Time
+	Redriven bool
+}
+
+// Path is the dead-letter ring kept next to an order queue.
+func Path(queuePath string) string {
+	return queuePath + "_dlq"
+}
+
+// Store is an open dead-letter ring.
+type Store struct {
+	mu       sync.Mutex
+	f        *os.File
+	capacity uint64
+}
+
+// Open opens the ring at path, creating it with DefaultCapacity if missing.
+func Open(path string) (*Store, error) {
+	if err := queue.ValidatePath(path); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0660)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter ring: %w", err)
+	}
+	s := &Store{f: f}
+	err = s.locked(syscall.LOCK_EX, func() error {
+		var hdr [headerSize]byte
+		n, err := f.ReadAt(hdr[:], 0)
+		if n == 0 {
+			return s.init()
+		}
+		if err != nil && n < headerSize {
+			return fmt.Errorf("short dead-letter header: %w", err)
+		}
+		if binary.LittleEndian.Uint32(hdr[0:]) != magic {
+			return errors.New("invalid dead-letter magic number")
+		}
+		if v := binary.LittleEndian.Uint32(hdr[4:]); v != version {
+			return fmt.Errorf("unsupported dead-letter version %d", v)
+		}
+		s.capacity = uint64(binary.LittleEndian.Uint32(hdr[8:]))
+		return nil
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) init() error {
+	s.capacity = DefaultCapacity
+	var hdr [headerSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:], magic)
+	binary.LittleEndian.PutUint32(hdr[4:], version)
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(s.capacity))
+	if err := s.f.Truncate(headerSize + int64(s.capacity)*entrySize); err != nil {
+		return err
+	}
+	if _, err := s.f.WriteAt(hdr[:], 0); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Park appends an order to the ring. attempts is how often it was tried.
+func (s *Store) Park(o queue.Order, reason Reason, attempts int) error {
+	return s.locked(syscall.LOCK_EX, func() error {
+		head, err := s.head()
+		if err != nil {
+			return err
+		}
+		var e [entrySize]byte
+		if _, err := binary.Encode(e[:orderSize], binary.LittleEndian, &o); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(e[orderSize:], uint64(time.Now().UnixNano()))
+		e[orderSize+8] = uint8(reason)
+		e[orderSize+9] = uint8(min(attempts, 255))
+		if _, err := s.f.WriteAt(e[:], s.offset(head)); err != nil {
+			return fmt.Errorf("failed to park order %d: %w", o.OrderID, err)
+		}
+		return s.setHead(head + 1)
+	})
+}
+
+// List returns the entries still in the ring, oldest first.
+func (s *Store) List() ([]Entry, error) {
+	var out []Entry
+	err := s.locked(syscall.LOCK_SH, func() error {
+		head, err := s.head()
+		if err != nil {
+			return err
+		}
+		for seq := head - min(head, s.capacity); seq < head; seq++ {
+			e, err := s.read(seq)
+			if err != nil {
+				return err
+			}
+			out = append(out, e)
+		}
+		return nil
+	})
+	return out, err
+}
+
+// Redrive enqueues every entry not yet re-driven that match accepts (nil
+// accepts all) and marks it re-driven. It stops at the first enqueue error,
+// e.g. a full queue, and reports how many went through.
+func (s *Store) Redrive(q queue.OrderQueue, match func(Entry) bool) (int, error) {
+	sent := 0
+	err := s.locked(syscall.LOCK_EX, func() error {
+		head, err := s.head()
+		if err != nil {
+			return err
+		}
+		for seq := head - min(head, s.capacity); seq < head; seq++ {
+			e, err := s.read(seq)
+			if err != nil {
+				return err
+			}
+			if e.Redriven || (match != nil && !match(e)) {
+				continue
+			}
+			if err := q.Enqueue(e.Order); err != nil {
+				return fmt.Errorf("re-drive order %d: %w", e.Order.OrderID, err)
+			}
+			if _, err := s.f.WriteAt([]byte{1}, s.offset(seq)+orderSize+10); err != nil {
+				return err
+			}
+			sent++
+		}
+		return s.f.Sync()
+	})
+	return sent, err
+}
+
+// Close closes the ring file.
+func (s *Store) Close() error {
+	return s.f.Close()
+}
+
+func (s *Store) read(seq uint64) (Entry, error) {
+	var e [entrySize]byte
+	if _, err := s.f.ReadAt(e[:], s.offset(seq)); err != nil {
+		return Entry{}, fmt.Errorf("failed to read dead-letter entry %d: %w", seq, err)
+	}
+	entry := Entry{
+		Seq:      seq,
+		ParkedAt: time.Unix(0, int64(binary.LittleEndian.Uint64(e[orderSize:]))),
+		Reason:   Reason(e[orderSize+8]),
+		Attempts: e[orderSize+9],
+		Redriven: e[orderSize+10] != 0,
+	}
+	if _, err := binary.Decode(e[:orderSize], binary.LittleEndian, &entry.Order); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+func (s *Store) offset(seq uint64) int64 {
+	return headerSize + int64(seq%s.capacity)*entrySize
+}
+
+func (s *Store) head() (uint64, error) {
+	var b [8]byte
+	if _, err := s.f.ReadAt(b[:], 16); err != nil {
+		return 0, fmt.Errorf("failed to read dead-letter head: %w", err)
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+func (s *Store) setHead(head uint64) error {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], head)
+	if _, err := s.f.WriteAt(b[:], 16); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// locked serialises goroutines with mu and processes with flock.
+func (s *Store) locked(how int, fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := syscall.Flock(int(s.f.Fd()), how); err != nil {
+		return fmt.Errorf("failed to lock dead-letter ring: %w", err)
+	}
+	defer syscall.Flock(int(s.f.Fd()), syscall.LOCK_UN)
+	return fn()
+}
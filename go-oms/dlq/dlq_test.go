@@ -0,0 +1,81 @@
+package dlq
+
+import (
+	"path/filepath"
+	"testing"
+
+	"oms/queue"
+)
+
+func openStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "orders_dlq"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestParkListRedrive(t *testing.T) {
+	s := openStore(t)
+	for i, r := range []Reason{ReasonValidation, ReasonRisk, ReasonValidation} {
+		o := queue.Order{OrderID: uint64(i + 1), ClientID: 7, Symbol: 42, Quantity: 10, Price: 100}
+		if err := s.Park(o, r, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := s.List()
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("list: %v %v", entries, err)
+	}
+	if e := entries[1]; e.Seq != 1 || e.Reason != ReasonRisk || e.Order.OrderID != 2 || e.Order.Symbol != 42 {
+		t.Fatalf("entry 1: %+v", e)
+	}
+
+	q := queue.NewInMemory(8)
+	n, err := s.Redrive(q, func(e Entry) bool { return e.Reason == ReasonValidation })
+	if err != nil || n != 2 {
+		t.Fatalf("redrive: %d %v", n, err)
+	}
+	if o, _ := q.Dequeue(); o == nil || o.OrderID != 1 {
+		t.Fatalf("first re-driven order: %+v", o)
+	}
+	// already re-driven entries are not sent twice
+	if n, err := s.Redrive(q, nil); err != nil || n != 1 {
+		t.Fatalf("second redrive: %d %v", n, err)
+	}
+}
+
+func TestRingOverwritesOldest(t *testing.T) {
+	s := openStore(t)
+	for i := range DefaultCapacity + 5 {
+		if err := s.Park(queue.Order{OrderID: uint64(i)}, ReasonRisk, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := s.List()
+	if err != nil || len(entries) != DefaultCapacity {
+		t.Fatalf("list: %d entries, %v", len(entries), err)
+	}
+	if entries[0].Order.OrderID != 5 || entries[0].Seq != 5 {
+		t.Fatalf("oldest entry: %+v", entries[0])
+	}
+}
+
+func TestNaksParkAfterLimit(t *testing.T) {
+	s := openStore(t)
+	n := &Naks{Store: s, Limit: 2}
+	rejected := queue.Order{OrderID: 9, Symbol: 3, Status: queue.StatusRejected}
+	if parked, err := n.Observe(rejected); parked || err != nil {
+		t.Fatalf("first nak: %v %v", parked, err)
+	}
+	if parked, err := n.Observe(rejected); !parked || err != nil {
+		t.Fatalf("second nak: %v %v", parked, err)
+	}
+	entries, _ := s.List()
+	if len(entries) != 1 || entries[0].Reason != ReasonConsumerNak || entries[0].Attempts != 2 ||
+		entries[0].Order.Status != queue.StatusPending {
+		t.Fatalf("parked: %+v", entries)
+	}
+}
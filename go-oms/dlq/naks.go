@@ -0,0 +1,53 @@
+package dlq
+
+import (
+	"sync"
+
+	"oms/queue"
+)
+
+// DefaultNakLimit is how many rejections an order gets before it is parked.
+const DefaultNakLimit = 3
+
+// Naks watches the status ring for orders the engine keeps rejecting. A
+// producer that retries a rejected order under the same OrderID would loop
+// forever on a poisoned message; once an order has been rejected Limit
+// times it is parked with ReasonConsumerNak, and Observe reports it so the
+// producer stops retrying.
+type Naks struct {
+	Store *Store
+	Limit int // 0 means DefaultNakLimit
+
+	mu     sync.Mutex
+	counts map[uint64]int
+}
+
+// Observe feeds one status record. It returns true when the order has just
+// been parked. Any terminal status other than a rejection forgets the order.
+func (n *Naks) Observe(status queue.Order) (bool, error) {
+	if status.IsControl() || !status.Terminal() {
+		return false, nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if status.Status != queue.StatusRejected {
+		delete(n.counts, status.OrderID)
+		return false, nil
+	}
+	if n.counts == nil {
+		n.counts = make(map[uint64]int)
+	}
+	n.counts[status.OrderID]++
+	count := n.counts[status.OrderID]
+	limit := n.Limit
+	if limit <= 0 {
+		limit = DefaultNakLimit
+	}
+	if count < limit {
+		return false, nil
+	}
+	delete(n.counts, status.OrderID)
+	order := status
+	order.Status = queue.StatusPending
+	return true, n.Store.Park(order, ReasonConsumerNak, count)
+}
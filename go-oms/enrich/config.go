@@ -0,0 +1,119 @@
+package enrich
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"oms/queue"
+	"oms/refdata"
+)
+
+// Config is the JSON pipeline configuration:
+//
+//	{
+//	  "accounts": {"ACME-01": 7},
+//	  "default": {"tif": "gtc", "capacity": "agency", "mark_short_sells": true},
+//	  "clients": {"7": {"tif": "gtt:30m", "capacity": "principal", "aliases": {"BRK.B": "BRKB"}}}
+//	}
+//
+// A client entry replaces the default for that client rather than merging
+// with it.
+type Config struct {
+	Accounts map[string]uint32       `json:"accounts"`
+	Default  ClientConfig            `json:"default"`
+	Clients  map[string]ClientConfig `json:"clients"` // keyed by client id
+}
+
+// ClientConfig is the rule set for one client.
+type ClientConfig struct {
+	TIF            string            `json:"tif"`      // gtc, gtd or gtt:<duration>; empty leaves it alone
+	Capacity       string            `json:"capacity"` // agency, principal or riskless_principal
+	Aliases        map[string]string `json:"aliases"`  // ticker -> refdata ticker
+	MarkShortSells bool              `json:"mark_short_sells"`
+}
+
+// LoadConfig reads a Config from a JSON file.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read enrichment config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Build turns a Config into a Pipeline. ref resolves tickers and may be nil
+// for gateways that only carry symbol ids; position feeds MarkShortSells.
+func Build(cfg Config, ref *refdata.Store, position func(clientID, symbol uint32) int64) (*Pipeline, error) {
+	var global []Stage
+	if len(cfg.Accounts) > 0 {
+		global = append(global, LookupAccount(cfg.Accounts))
+	}
+	defaults, err := cfg.Default.stages(ref, position)
+	if err != nil {
+		return nil, fmt.Errorf("default: %w", err)
+	}
+	p := NewPipeline(global, defaults)
+	for key, cc := range cfg.Clients {
+		id, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("client %q: not a client id", key)
+		}
+		stages, err := cc.stages(ref, position)
+		if err != nil {
+			return nil, fmt.Errorf("client %d: %w", id, err)
+		}
+		p.SetClient(uint32(id), stages)
+	}
+	return p, nil
+}
+
+func (cc ClientConfig) stages(ref *refdata.Store, position func(clientID, symbol uint32) int64) ([]Stage, error) {
+	var stages []Stage
+	if ref != nil {
+		stages = append(stages, NormalizeSymbol(ref, cc.Aliases))
+	} else if len(cc.Aliases) > 0 {
+		return nil, errors.New("symbol aliases need reference data")
+	}
+	if cc.TIF != "" {
+		tif, ttl, err := parseTIF(cc.TIF)
+		if err != nil {
+			return nil, err
+		}
+		stages = append(stages, DefaultTIF(tif, ttl))
+	}
+	capacity, err := ParseCapacity(cc.Capacity)
+	if err != nil {
+		return nil, err
+	}
+	if capacity != CapacityUnset {
+		stages = append(stages, SetCapacity(capacity))
+	}
+	if cc.MarkShortSells {
+		stages = append(stages, MarkShortSells(position))
+	}
+	return stages, nil
+}
+
+func parseTIF(s string) (uint8, time.Duration, error) {
+	switch s {
+	case "gtc":
+		return queue.TIFGoodTillCancel, 0, nil
+	case "gtd":
+		return queue.TIFGoodTillDate, 0, nil
+	}
+	if arg, ok := strings.CutPrefix(s, "gtt:"); ok {
+		if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+			return queue.TIFGoodTillTime, d, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid tif %q (want gtc, gtd or gtt:<duration>)", s)
+}
@@ -0,0 +1,119 @@
+// Package enrich runs business rules on orders between a gateway and the
+// queue: account lookup, symbol normalization, default time in force and
+// capacity/short-sell flags. Rules are configured per client, so gateways
+// only translate their wire format and leave the rest to one Pipeline.
+package enrich
+
+import (
+	"fmt"
+	"sync"
+
+	"oms/queue"
+)
+
+// Capacity is the capacity a client trades in.
+type Capacity uint8
+
+const (
+	CapacityUnset Capacity = iota
+	CapacityAgency
+	CapacityPrincipal
+	CapacityRisklessPrincipal
+)
+
+func (c Capacity) String() string {
+	switch c {
+	case CapacityAgency:
+		return "agency"
+	case CapacityPrincipal:
+		return "principal"
+	case CapacityRisklessPrincipal:
+		return "riskless_principal"
+	}
+	return ""
+}
+
+// ParseCapacity is the inverse of Capacity.String; "" is CapacityUnset.
+func ParseCapacity(s string) (Capacity, error) {
+	for _, c := range []Capacity{CapacityUnset, CapacityAgency, CapacityPrincipal, CapacityRisklessPrincipal} {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown capacity %q", s)
+}
+
+// Request is an order on its way from a gateway to the queue. Besides the
+// Order it carries what the gateway knew in its own terms, and the flags the
+// ring slot has no field for: Capacity and ShortSell stay on the Go
+// side, for risk checks and audit records.
+type Request struct {
+	Order queue.Order
+
+	Account string // gateway account name; resolved to Order.ClientID
+	Ticker  string // symbol as the gateway received it; resolved to Order.Symbol
+	TIFSet  bool   // Order.TimeInForce was given explicitly
+
+	Capacity  Capacity
+	ShortSell bool
+}
+
+// Stage is one enrichment step. It edits the request in place; an error
+// rejects the order.
+type Stage func(*Request) error
+
+// Pipeline runs the global stages, then the stages of the order's client,
+// or the default stages for clients without their own. Global stages run
+// first because account lookup decides which client that is.
+// It is safe for concurrent use.
+type Pipeline struct {
+	global   []Stage
+	defaults []Stage
+
+	mu      sync.RWMutex
+	clients map[uint32][]Stage
+}
+
+// NewPipeline returns a pipeline applying defaults to every client.
+func NewPipeline(global, defaults []Stage) *Pipeline {
+	return &Pipeline{global: global, defaults: defaults, clients: make(map[uint32][]Stage)}
+}
+
+// SetClient replaces the default stages for one client.
+func (p *Pipeline) SetClient(clientID uint32, stages []Stage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients[clientID] = stages
+}
+
+// Run enriches req. Control messages are left alone.
+func (p *Pipeline) Run(req *Request) error {
+	if req.Order.IsControl() {
+		return nil
+	}
+	for _, stage := range p.global {
+		if err := stage(req); err != nil {
+			return err
+		}
+	}
+	p.mu.RLock()
+	stages, ok := p.clients[req.Order.ClientID]
+	p.mu.RUnlock()
+	if !ok {
+		stages = p.defaults
+	}
+	for _, stage := range stages {
+		if err := stage(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Order enriches a bare order, for gateways that only have the wire fields.
+// A wire order cannot say "no time in force", so GTC counts as unset.
+func (p *Pipeline) Order(o queue.Order) (queue.Order, error) {
+	req := Request{Order: o, TIFSet: o.TimeInForce != queue.TIFGoodTillCancel}
+	err := p.Run(&req)
+	return req.Order, err
+}
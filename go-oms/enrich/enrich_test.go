@@ -0,0 +1,74 @@
+package enrich
+
+import (
+	"errors"
+	"testing"
+
+	"oms/queue"
+	"oms/refdata"
+)
+
+func testPipeline(t *testing.T) *Pipeline {
+	t.Helper()
+	ref, err := refdata.New([]refdata.Instrument{
+		{ID: 1, Symbol: "AAPL", Active: true},
+		{ID: 2, Symbol: "BRKB", Active: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Accounts: map[string]uint32{"ACME-01": 7},
+		Default:  ClientConfig{TIF: "gtc", Capacity: "agency", MarkShortSells: true},
+		Clients: map[string]ClientConfig{
+			"7": {TIF: "gtd", Capacity: "principal", Aliases: map[string]string{"BRK.B": "BRKB"}},
+		},
+	}
+	positions := func(clientID, symbol uint32) int64 { return 100 }
+	p, err := Build(cfg, ref, positions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPerClientRules(t *testing.T) {
+	p := testPipeline(t)
+
+	req := Request{Account: "ACME-01", Ticker: " brk.b ", Order: queue.Order{Side: 1, Quantity: 500}}
+	if err := p.Run(&req); err != nil {
+		t.Fatal(err)
+	}
+	o := req.Order
+	if o.ClientID != 7 || o.Symbol != 2 || req.Ticker != "BRKB" {
+		t.Fatalf("account/symbol: %+v %q", o, req.Ticker)
+	}
+	if o.TimeInForce != queue.TIFGoodTillDate || o.ExpireAt == 0 {
+		t.Fatalf("default tif: %+v", o)
+	}
+	// client 7 replaces the default rules, so no short-sell marking
+	if req.Capacity != CapacityPrincipal || req.ShortSell {
+		t.Fatalf("flags: %v short=%v", req.Capacity, req.ShortSell)
+	}
+
+	req = Request{Ticker: "AAPL", Order: queue.Order{ClientID: 3, Side: 1, Quantity: 500}}
+	if err := p.Run(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Order.Symbol != 1 || req.Capacity != CapacityAgency || !req.ShortSell {
+		t.Fatalf("default client: %+v %v short=%v", req.Order, req.Capacity, req.ShortSell)
+	}
+}
+
+func TestRejects(t *testing.T) {
+	p := testPipeline(t)
+	if err := p.Run(&Request{Account: "NOPE"}); !errors.Is(err, ErrUnknownAccount) {
+		t.Fatalf("unknown account: %v", err)
+	}
+	if err := p.Run(&Request{Ticker: "BRK.B"}); !errors.Is(err, refdata.ErrUnknownSymbol) {
+		t.Fatalf("alias of another client: %v", err)
+	}
+	if _, err := Build(Config{Default: ClientConfig{TIF: "gtt"}}, nil, nil); err == nil {
+		t.Fatal("gtt without a duration accepted")
+	}
+}
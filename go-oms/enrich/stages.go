@@ -0,0 +1,107 @@
+package enrich
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"oms/queue"
+	"oms/refdata"
+)
+
+// ErrUnknownAccount rejects an order whose account has no client.
+var ErrUnknownAccount = errors.New("unknown account")
+
+// LookupAccount sets Order.ClientID from the request's account name.
+// Requests without an account keep the ClientID the gateway gave them.
+func LookupAccount(accounts map[string]uint32) Stage {
+	return func(req *Request) error {
+		if req.Account == "" {
+			return nil
+		}
+		id, ok := accounts[req.Account]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownAccount, req.Account)
+		}
+		req.Order.ClientID = id
+		return nil
+	}
+}
+
+// NormalizeSymbol resolves the request's ticker to Order.Symbol: it maps it
+// through the client's own aliases, then resolves it in ref, which knows the
+// native, RIC and Bloomberg names (see refdata.Store.Resolve). Both match on
+// refdata.Normalize'd form. Requests without a ticker keep the symbol id the
+// gateway gave them; resolved ones carry the native ticker afterwards.
+func NormalizeSymbol(ref *refdata.Store, aliases map[string]string) Stage {
+	normalized := make(map[string]string, len(aliases))
+	for from, to := range aliases {
+		normalized[refdata.Normalize(from)] = to
+	}
+	return func(req *Request) error {
+		if req.Ticker == "" {
+			return nil
+		}
+		name := req.Ticker
+		if alias, ok := normalized[refdata.Normalize(name)]; ok {
+			name = alias
+		}
+		inst, err := ref.Resolve(name)
+		if err != nil {
+			return err
+		}
+		req.Ticker = inst.Symbol
+		req.Order.Symbol = inst.ID
+		return nil
+	}
+}
+
+// DefaultTIF applies tif to orders that did not set one. GTD orders expire
+// at the end of the UTC day they were enriched on, GTT orders ttl later.
+func DefaultTIF(tif uint8, ttl time.Duration) Stage {
+	return func(req *Request) error {
+		if req.TIFSet {
+			return nil
+		}
+		req.Order.TimeInForce = tif
+		now := time.Now().UTC()
+		switch tif {
+		case queue.TIFGoodTillDate:
+			eod := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+			req.Order.ExpireAt = uint64(eod.UnixNano())
+		case queue.TIFGoodTillTime:
+			req.Order.ExpireAt = uint64(now.Add(ttl).UnixNano())
+		}
+		return nil
+	}
+}
+
+// SetCapacity marks orders with the client's capacity unless the gateway
+// already set one.
+func SetCapacity(c Capacity) Stage {
+	return func(req *Request) error {
+		if req.Capacity == CapacityUnset {
+			req.Capacity = c
+		}
+		return nil
+	}
+}
+
+// MarkShortSells flags sells larger than the client's long position in the
+// symbol. position may be nil, in which case every sell is short: without a
+// position the order cannot be shown to be covered.
+func MarkShortSells(position func(clientID, symbol uint32) int64) Stage {
+	return func(req *Request) error {
+		if req.Order.Side != 1 {
+			return nil
+		}
+		var held int64
+		if position != nil {
+			held = position(req.Order.ClientID, req.Order.Symbol)
+		}
+		if int64(req.Order.Quantity) > held {
+			req.ShortSell = true
+		}
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+// Package expiry sweeps GTD/GTT orders on the producer side, so orders whose
+// ExpireAt has passed are reported EXPIRED instead of sitting open forever.
+// The engine applies the same check when it consumes an order.
+package expiry
+
+import (
+	"container/heap"
+
+	"oms/queue"
+)
+
+type entry struct {
+	expireAt uint64
+	order    queue.Order
+	index    int // in the heap, for Done
+}
+
+type entries []*entry
+
+func (e entries) Len() int           { return len(e) }
+func (e entries) Less(i, j int) bool { return e[i].expireAt < e[j].expireAt }
+func (e entries) Swap(i, j int) {
+	e[i], e[j] = e[j], e[i]
+	e[i].index, e[j].index = i, j
+}
+func (e *entries) Push(x any) {
+	x.(*entry).index = len(*e)
+	*e = append(*e, x.(*entry))
+}
+func (e *entries) Pop() any {
+	old := *e
+	last := old[len(old)-1]
+	*e = old[:len(old)-1]
+	return last
+}
+
+// Sweeper tracks open orders with an expiry and emits them with
+// StatusExpired once they are due. It is not safe for concurrent use.
+type Sweeper struct {
+	due      entries
+	open     map[uint64]*entry
+	onExpire func(queue.Order)
+}
+
+// NewSweeper returns a Sweeper that hands every expired order, with Status
+// set to StatusExpired, to onExpire.
+func NewSweeper(onExpire func(queue.Order)) *Sweeper {
+	return &Sweeper{
+		open:     make(map[uint64]*entry),
+		onExpire: onExpire,
+	}
+}
+
+// Track registers an order sent to the engine, replacing any tracked under
+// its id. GTC orders are ignored.
+func (s *Sweeper) Track(order queue.Order) {
+	if order.TimeInForce == queue.TIFGoodTillCancel || order.ExpireAt == 0 {
+		return
+	}
+	s.Done(order.OrderID)
+	e := &entry{expireAt: order.ExpireAt, order: order}
+	s.open[order.OrderID] = e
+	heap.Push(&s.due, e)
+}
+
+// Done forgets an order that reached a terminal status (filled, rejected,
+// or already expired by the engine).
+func (s *Sweeper) Done(orderID uint64) {
+	if e, ok := s.open[orderID]; ok {
+		heap.Remove(&s.due, e.index)
+		delete(s.open, orderID)
+	}
+}
+
+// Sweep expires every still-open order with ExpireAt <= now (unix nanos) and
+// returns how many it expired.
+func (s *Sweeper) Sweep(now uint64) int {
+	n := 0
+	for len(s.due) > 0 && s.due[0].expireAt <= now {
+		e := heap.Pop(&s.due).(*entry)
+		delete(s.open, e.order.OrderID)
+		e.order.Status = queue.StatusExpired
+		s.onExpire(e.order)
+		n++
+	}
+	return n
+}
+
+// Open is the number of tracked orders that have not expired or completed.
+func (s *Sweeper) Open() int {
+	return len(s.open)
+}
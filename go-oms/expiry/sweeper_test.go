@@ -0,0 +1,65 @@
+package expiry
+
+import (
+	"testing"
+
+	"oms/queue"
+)
+
+func gtd(id, expireAt uint64) queue.Order {
+	return queue.Order{OrderID: id, TimeInForce: queue.TIFGoodTillDate, ExpireAt: expireAt}
+}
+
+func TestSweep(t *testing.T) {
+	var expired []uint64
+	s := NewSweeper(func(o queue.Order) {
+		if o.Status != queue.StatusExpired {
+			t.Errorf("order %d handed over with status %d", o.OrderID, o.Status)
+		}
+		expired = append(expired, o.OrderID)
+	})
+	s.Track(gtd(1, 300))
+	s.Track(gtd(2, 100))
+	s.Track(gtd(3, 200))
+	s.Track(queue.Order{OrderID: 4}) // good till cancel
+	if s.Open() != 3 {
+		t.Fatalf("%d open, want the 3 with an expiry", s.Open())
+	}
+
+	if n := s.Sweep(99); n != 0 {
+		t.Fatalf("swept %d before anything was due", n)
+	}
+	if n := s.Sweep(200); n != 2 || len(expired) != 2 || expired[0] != 2 || expired[1] != 3 {
+		t.Fatalf("swept %d: %v, want [2 3] in expiry order", n, expired)
+	}
+	if n := s.Sweep(1000); n != 1 || expired[2] != 1 || s.Open() != 0 {
+		t.Fatalf("swept %d: %v, %d still open", n, expired, s.Open())
+	}
+}
+
+func TestDone(t *testing.T) {
+	s := NewSweeper(func(o queue.Order) { t.Errorf("order %d expired after it was done", o.OrderID) })
+	for id := uint64(1); id <= 100; id++ {
+		s.Track(gtd(id, id))
+	}
+	for id := uint64(1); id <= 100; id++ {
+		s.Done(id)
+	}
+	s.Done(7) // twice
+	if s.Open() != 0 || len(s.due) != 0 {
+		t.Fatalf("%d open, %d in the heap after every order was done", s.Open(), len(s.due))
+	}
+	s.Sweep(1000)
+
+	// tracked again under the same id, only the new expiry counts
+	var got []queue.Order
+	s = NewSweeper(func(o queue.Order) { got = append(got, o) })
+	s.Track(gtd(1, 100))
+	s.Track(gtd(1, 500))
+	if s.Sweep(100) != 0 || len(s.due) != 1 {
+		t.Fatalf("expired on the replaced expiry: %v", got)
+	}
+	if s.Sweep(500) != 1 || got[0].ExpireAt != 500 {
+		t.Fatalf("got %v, want the order as tracked last", got)
+	}
+}
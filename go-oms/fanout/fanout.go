@@ -0,0 +1,223 @@
+// Package fanout drains a queue into a pool of workers, for Go consumers
+// whose per-message work (a database write, a webhook) is slower than the
+// ring fills. Records are spread across the workers by OrderID, so every
+// record of one order is handled by the same worker, in ring order, while
+// different orders are handled in parallel.
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oms/queue"
+)
+
+// Handler does the work for one record. An error is passed to
+// Config.OnError, or stops the pool when that is nil.
+type Handler func(o queue.Order) error
+
+// Config tunes a Pool. The zero value is usable.
+type Config struct {
+	// Workers is the number of goroutines handling records. Zero means
+	// GOMAXPROCS.
+	Workers int
+	// Buffer is how many records each worker can have waiting before the
+	// dispatcher stops dequeuing for it. Zero means 256.
+	Buffer int
+	// Batch is the most records taken off the ring at once, when the
+	// queue can dequeue in batches. Zero means 64.
+	Batch int
+	// PollInterval is the sleep after finding the queue empty. Zero means
+	// 100µs.
+	PollInterval time.Duration
+	// OnError, if set, is told of each failed record and the pool carries
+	// on. When nil the first failure stops the pool and Run returns it.
+	OnError func(o queue.Order, err error)
+}
+
+// Stats counts what a pool has done.
+type Stats struct {
+	Dispatched uint64 // taken off the queue and handed to a worker
+	Handled    uint64 // handler returned nil
+	Failed     uint64 // handler returned an error
+	// Stalls counts the times the dispatcher waited on a worker's full
+	// buffer: one order's records arriving faster than its worker keeps
+	// up. The ring backs up meanwhile; nothing is dropped.
+	Stalls uint64
+}
+
+// Pool fans one queue's records out to its workers.
+type Pool struct {
+	cfg    Config
+	handle Handler
+
+	dispatched atomic.Uint64
+	handled    atomic.Uint64
+	failed     atomic.Uint64
+	stalls     atomic.Uint64
+}
+
+// batchReader is implemented by Queue and MemQueue.
+type batchReader interface {
+	DequeueUpTo(n int, dst []queue.Order) ([]queue.Order, error)
+}
+
+// New returns a pool calling h for each record.
+func New(cfg Config, h Handler) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.GOMAXPROCS(0)
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = 256
+	}
+	if cfg.Batch <= 0 {
+		cfg.Batch = 64
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 100 * time.Microsecond
+	}
+	return &Pool{cfg: cfg, handle: h}
+}
+
+// Stats returns the pool's counts so far. It is safe to call while Run is
+// going.
+func (p *Pool) Stats() Stats {
+	return Stats{
+		Dispatched: p.dispatched.Load(),
+		Handled:    p.handled.Load(),
+		Failed:     p.failed.Load(),
+		Stalls:     p.stalls.Load(),
+	}
+}
+
+// Run dequeues from q until ctx is done, a dequeue fails, or a handler
+// fails without Config.OnError. Records already taken off the ring are
+// handled before Run returns, except after a handler failure: the records
+// waiting behind it on every worker are abandoned then, off the ring but
+// neither Handled nor Failed, so a consumer that must not lose any sets
+// OnError. Run returns nil when ctx ended it.
+func (p *Pool) Run(ctx context.Context, q queue.OrderQueue) error {
+	r := &run{Pool: p, workers: make([]chan queue.Order, p.cfg.Workers), stop: make(chan struct{})}
+	var wg sync.WaitGroup
+	for i := range r.workers {
+		ch := make(chan queue.Order, p.cfg.Buffer)
+		r.workers[i] = ch
+		wg.Go(func() { r.work(ch) })
+	}
+	err := r.dispatch(ctx, q)
+	for _, ch := range r.workers {
+		close(ch)
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return r.err
+}
+
+// run is one call of Run.
+type run struct {
+	*Pool
+	workers []chan queue.Order
+	stop    chan struct{} // closed on a handler failure
+	once    sync.Once
+	err     error // the failure; read once the workers are done
+}
+
+// fail stops the run after a handler failure.
+func (r *run) fail(err error) {
+	r.once.Do(func() {
+		r.err = err
+		close(r.stop)
+	})
+}
+
+func (r *run) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatch moves records from q to their workers until ctx is done or the
+// run stops.
+func (r *run) dispatch(ctx context.Context, q queue.OrderQueue) error {
+	batch := make([]queue.Order, 0, r.cfg.Batch)
+	br, batched := q.(batchReader)
+	for ctx.Err() == nil && !r.stopped() {
+		var err error
+		batch = batch[:0]
+		if batched {
+			batch, err = br.DequeueUpTo(r.cfg.Batch, batch)
+		} else {
+			var o *queue.Order
+			if o, err = q.Dequeue(); o != nil {
+				batch = append(batch, *o)
+			}
+		}
+		for _, o := range batch {
+			if !r.send(o) {
+				return nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("dequeue: %w", err)
+		}
+		if len(batch) == 0 {
+			select {
+			case <-ctx.Done():
+			case <-r.stop:
+			case <-time.After(r.cfg.PollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+// send hands o to the worker that owns its OrderID, waiting while that
+// worker's buffer is full. It reports false if the run stopped meanwhile.
+// A record off the ring is not dropped because the caller's ctx ended: the
+// workers drain until their channels close.
+func (r *run) send(o queue.Order) bool {
+	ch := r.workers[o.OrderID%uint64(len(r.workers))]
+	select {
+	case ch <- o:
+		r.dispatched.Add(1)
+		return true
+	default:
+	}
+	r.stalls.Add(1)
+	select {
+	case ch <- o:
+		r.dispatched.Add(1)
+		return true
+	case <-r.stop:
+		return false
+	}
+}
+
+// work handles the records on ch in order until it is closed.
+func (r *run) work(ch <-chan queue.Order) {
+	for o := range ch {
+		if r.stopped() {
+			continue // a handler failed; abandon the rest
+		}
+		err := r.handle(o)
+		if err == nil {
+			r.handled.Add(1)
+			continue
+		}
+		r.failed.Add(1)
+		if r.cfg.OnError != nil {
+			r.cfg.OnError(o, err)
+			continue
+		}
+		r.fail(fmt.Errorf("order %d: %w", o.OrderID, err))
+	}
+}
@@ -0,0 +1,103 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+// plain hides MemQueue's DequeueUpTo, so the pool dequeues one at a time.
+type plain struct{ queue.OrderQueue }
+
+func TestPerOrderOrdering(t *testing.T) {
+	const orders, updates = 50, 40
+	for name, wrap := range map[string]func(*queue.MemQueue) queue.OrderQueue{
+		"batched": func(q *queue.MemQueue) queue.OrderQueue { return q },
+		"single":  func(q *queue.MemQueue) queue.OrderQueue { return plain{q} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			q := queue.NewInMemory(orders * updates)
+			for u := range uint32(updates) {
+				for id := range uint64(orders) {
+					q.Enqueue(queue.Order{OrderID: id + 1, Quantity: u})
+				}
+			}
+			var mu sync.Mutex
+			seen := make(map[uint64][]uint32)
+			handled := 0
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			p := New(Config{Workers: 8, Buffer: 4}, func(o queue.Order) error {
+				time.Sleep(time.Duration(rand.IntN(50)) * time.Microsecond)
+				mu.Lock()
+				seen[o.OrderID] = append(seen[o.OrderID], o.Quantity)
+				if handled++; handled == orders*updates {
+					cancel()
+				}
+				mu.Unlock()
+				return nil
+			})
+			if err := p.Run(ctx, wrap(q)); err != nil {
+				t.Fatal(err)
+			}
+			for id, s := range seen {
+				for i, u := range s {
+					if u != uint32(i) {
+						t.Fatalf("order %d handled updates %v, want them in ring order", id, s)
+					}
+				}
+			}
+			if st := p.Stats(); st.Dispatched != orders*updates || st.Handled != orders*updates || st.Failed != 0 {
+				t.Errorf("stats %+v", st)
+			}
+		})
+	}
+}
+
+func TestHandlerFailure(t *testing.T) {
+	q := queue.NewInMemory(1024)
+	for id := range uint64(500) {
+		q.Enqueue(queue.Order{OrderID: id + 1})
+	}
+	boom := errors.New("boom")
+	p := New(Config{Workers: 4}, func(o queue.Order) error {
+		if o.OrderID == 100 {
+			return boom
+		}
+		return nil
+	})
+	err := p.Run(context.Background(), q)
+	if !errors.Is(err, boom) {
+		t.Fatalf("run = %v, want the handler's error", err)
+	}
+	if st := p.Stats(); st.Failed != 1 || st.Handled >= 500 {
+		t.Errorf("stats %+v", st)
+	}
+
+	var failed []uint64
+	p = New(Config{Workers: 4, OnError: func(o queue.Order, err error) { failed = append(failed, o.OrderID) }},
+		func(o queue.Order) error {
+			if o.OrderID%100 == 0 {
+				return boom
+			}
+			return nil
+		})
+	q = queue.NewInMemory(1024)
+	for id := range uint64(500) {
+		q.Enqueue(queue.Order{OrderID: id + 1})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := p.Run(ctx, q); err != nil {
+		t.Fatal(err)
+	}
+	// OrderIDs that are multiples of 100 share a worker, so no lock needed
+	if len(failed) != 5 || p.Stats().Handled != 495 {
+		t.Errorf("failed %v, stats %+v", failed, p.Stats())
+	}
+}
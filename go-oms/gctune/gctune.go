@@ -0,0 +1,248 @@
+// Package gctune sets up the garbage collector for the producer binaries
+// and measures its pauses. A producer allocates little on the hot path,
+// but what it does allocate, with the default GOGC on a small heap, adds
+// up to frequent collections whose stop-the-world pauses show up as dips
+// in throughput and spikes in latency. Raising GOGC, or giving the heap a
+// floor with a ballast or a memory limit with the GC otherwise off,
+// trades memory for fewer collections.
+//
+// Config.Flags adds -gogc, -memlimit and -ballast to a flag set; Apply
+// puts the parsed config in force. ReadPauses samples the runtime's GC
+// pause histogram, so a benchmark can report pauses next to throughput.
+package gctune
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is how the collector should run. The zero Config changes
+// nothing: the GOGC and GOMEMLIMIT environment variables, or the
+// runtime's defaults, stay in force.
+type Config struct {
+	// GOGC is the heap growth percent that triggers a collection, as in
+	// the GOGC environment variable; 0 leaves it, Off disables the
+	// collector until MemoryLimit is reached.
+	GOGC int
+	// MemoryLimit is the soft heap limit in bytes, as in GOMEMLIMIT; 0
+	// leaves it.
+	MemoryLimit int64
+	// Ballast is a heap allocation of this many bytes kept for the life
+	// of the process. It is never written, so it costs address space but
+	// no resident memory, and it raises the heap goal GOGC works from.
+	// MemoryLimit with GOGC Off does the same job more precisely; the
+	// ballast is for when no limit can be picked.
+	Ballast int64
+}
+
+// Off is the GOGC that disables the collector, as GOGC=off.
+const Off = -1
+
+// Flags adds -gogc, -memlimit and -ballast to fs, filling in c.
+func (c *Config) Flags(fs *flag.FlagSet) {
+	fs.Func("gogc", "GC target percent, or off (default: GOGC from the environment, else 100)", func(s string) error {
+		if strings.EqualFold(s, "off") {
+			c.GOGC = Off
+			return nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("want a positive percent or off")
+		}
+		c.GOGC = v
+		return nil
+	})
+	fs.Func("memlimit", "soft memory limit, e.g. 2GiB or 512MiB (default: GOMEMLIMIT from the environment, else none)", func(s string) (err error) {
+		c.MemoryLimit, err = ParseSize(s)
+		return err
+	})
+	fs.Func("ballast", "allocate and keep this much heap, e.g. 256MiB, so small heaps are not collected constantly", func(s string) (err error) {
+		c.Ballast, err = ParseSize(s)
+		return err
+	})
+}
+
+// ParseSize parses a byte count: a plain number, or one with a B, KiB,
+// MiB, GiB or TiB suffix, or K, M, G or T for the same powers of 1024.
+func ParseSize(s string) (int64, error) {
+	t := strings.TrimSpace(s)
+	upper := strings.ToUpper(t)
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	}
+	mult := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			mult, t = u.mult, strings.TrimSpace(t[:len(t)-len(u.suffix)])
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil || v < 0 || v*mult > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
+
+func (c Config) String() string {
+	var parts []string
+	switch {
+	case c.GOGC == Off:
+		parts = append(parts, "gogc=off")
+	case c.GOGC > 0:
+		parts = append(parts, fmt.Sprintf("gogc=%d", c.GOGC))
+	}
+	if c.MemoryLimit > 0 {
+		parts = append(parts, fmt.Sprintf("memlimit=%dMiB", c.MemoryLimit>>20))
+	}
+	if c.Ballast > 0 {
+		parts = append(parts, fmt.Sprintf("ballast=%dMiB", c.Ballast>>20))
+	}
+	if parts == nil {
+		return "runtime defaults"
+	}
+	return strings.Join(parts, " ")
+}
+
+// ballast keeps the Config.Ballast allocation reachable. A []byte holds
+// no pointers, so the collector never scans it.
+var ballast []byte
+
+// Apply puts cfg in force and returns a function that restores what it
+// changed. Only one ballast is kept: a second Apply replaces the first.
+func Apply(cfg Config) (restore func()) {
+	var prevGOGC int
+	var prevLimit int64
+	if cfg.GOGC != 0 {
+		prevGOGC = debug.SetGCPercent(cfg.GOGC)
+	}
+	if cfg.MemoryLimit > 0 {
+		prevLimit = debug.SetMemoryLimit(cfg.MemoryLimit)
+	}
+	prevBallast := ballast
+	if cfg.Ballast > 0 {
+		ballast = make([]byte, cfg.Ballast)
+	}
+	return func() {
+		if cfg.GOGC != 0 {
+			debug.SetGCPercent(prevGOGC)
+		}
+		if cfg.MemoryLimit > 0 {
+			debug.SetMemoryLimit(prevLimit)
+		}
+		ballast = prevBallast
+	}
+}
+
+// Runtime metrics ReadPauses samples.
+const (
+	pausesMetric = "/sched/pauses/total/gc:seconds"
+	cyclesMetric = "/gc/cycles/total:gc-cycles"
+)
+
+// Pauses is the runtime's cumulative GC pause histogram at one moment.
+// Subtract two to get the pauses between them.
+type Pauses struct {
+	Cycles  uint64    // collections completed
+	Counts  []uint64  // pauses per bucket
+	Buckets []float64 // bucket boundaries in seconds, len(Counts)+1
+}
+
+// ReadPauses samples the pause histogram. It does not stop the world, so
+// it is cheap enough to call once per benchmark interval.
+func ReadPauses() Pauses {
+	samples := []metrics.Sample{{Name: pausesMetric}, {Name: cyclesMetric}}
+	metrics.Read(samples)
+	var p Pauses
+	if samples[0].Value.Kind() == metrics.KindFloat64Histogram {
+		h := samples[0].Value.Float64Histogram()
+		p.Counts = append([]uint64(nil), h.Counts...)
+		p.Buckets = h.Buckets
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		p.Cycles = samples[1].Value.Uint64()
+	}
+	return p
+}
+
+// Sub returns the pauses in p that were not yet in prev.
+func (p Pauses) Sub(prev Pauses) Pauses {
+	d := Pauses{Cycles: p.Cycles - min(prev.Cycles, p.Cycles), Counts: make([]uint64, len(p.Counts)), Buckets: p.Buckets}
+	for i, n := range p.Counts {
+		if i < len(prev.Counts) {
+			n -= min(prev.Counts[i], n)
+		}
+		d.Counts[i] = n
+	}
+	return d
+}
+
+// PauseSummary describes a set of pauses, to the histogram's bucket
+// resolution: a percentile is the upper bound of the bucket it falls in,
+// and Total counts each pause at its bucket's midpoint.
+type PauseSummary struct {
+	Cycles uint64
+	N      uint64 // stop-the-world pauses, about two per cycle
+	P50    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+	Total  time.Duration
+}
+
+// Summary summarizes the pauses in p.
+func (p Pauses) Summary() PauseSummary {
+	s := PauseSummary{Cycles: p.Cycles}
+	for _, n := range p.Counts {
+		s.N += n
+	}
+	if s.N == 0 {
+		return s
+	}
+	rank50, rank99 := (s.N+1)/2, max(s.N*99/100, 1)
+	var seen uint64
+	var total float64
+	for i, n := range p.Counts {
+		if n == 0 {
+			continue
+		}
+		lo, hi := p.bound(i), p.bound(i+1)
+		if seen < rank50 && seen+n >= rank50 {
+			s.P50 = seconds(hi)
+		}
+		if seen < rank99 && seen+n >= rank99 {
+			s.P99 = seconds(hi)
+		}
+		s.Max = seconds(hi)
+		total += float64(n) * (lo + hi) / 2
+		seen += n
+	}
+	s.Total = seconds(total)
+	return s
+}
+
+// bound is bucket boundary i with the infinite ends clamped to their
+// neighbours.
+func (p Pauses) bound(i int) float64 {
+	b := p.Buckets[i]
+	switch {
+	case math.IsInf(b, -1):
+		return 0
+	case math.IsInf(b, 1):
+		return p.Buckets[i-1]
+	}
+	return b
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
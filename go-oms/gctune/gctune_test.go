@@ -0,0 +1,93 @@
+package gctune
+
+import (
+	"flag"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{
+		"0":       0,
+		"4096":    4096,
+		"512MiB":  512 << 20,
+		"2GiB":    2 << 30,
+		"1.5g":    3 << 29,
+		"64k":     64 << 10,
+		" 100B  ": 100,
+	} {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "lots", "-1MiB", "1PiB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) accepted", in)
+		}
+	}
+}
+
+func TestFlagsAndApply(t *testing.T) {
+	var cfg Config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.Flags(fs)
+	if err := fs.Parse([]string{"-gogc", "off", "-memlimit", "1GiB", "-ballast", "1MiB"}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg != (Config{GOGC: Off, MemoryLimit: 1 << 30, Ballast: 1 << 20}) {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	if got := cfg.String(); got != "gogc=off memlimit=1024MiB ballast=1MiB" {
+		t.Errorf("String() = %q", got)
+	}
+
+	gogc, limit := debug.SetGCPercent(-1), debug.SetMemoryLimit(-1)
+	debug.SetGCPercent(gogc)
+	restore := Apply(cfg)
+	if got := debug.SetGCPercent(-1); got != Off {
+		t.Errorf("GOGC = %d, want off", got)
+	}
+	if got := debug.SetMemoryLimit(-1); got != 1<<30 {
+		t.Errorf("memory limit = %d", got)
+	}
+	if len(ballast) != 1<<20 {
+		t.Errorf("ballast = %d bytes", len(ballast))
+	}
+	restore()
+	if got := debug.SetGCPercent(-1); got != gogc {
+		t.Errorf("GOGC after restore = %d, want %d", got, gogc)
+	}
+	debug.SetGCPercent(gogc)
+	if got := debug.SetMemoryLimit(-1); got != limit {
+		t.Errorf("memory limit after restore = %d, want %d", got, limit)
+	}
+	if ballast != nil {
+		t.Error("ballast kept after restore")
+	}
+}
+
+func TestPauseSummary(t *testing.T) {
+	p := Pauses{
+		Cycles:  3,
+		Counts:  []uint64{0, 4, 1, 1},
+		Buckets: []float64{math.Inf(-1), 0.00001, 0.0001, 0.001, math.Inf(1)},
+	}
+	s := p.Summary()
+	want := PauseSummary{Cycles: 3, N: 6, P50: 100 * time.Microsecond, P99: time.Millisecond, Max: time.Millisecond}
+	s.Total, want.Total = s.Total.Round(time.Microsecond), 4*55*time.Microsecond+550*time.Microsecond+time.Millisecond
+	if s != want {
+		t.Errorf("summary = %+v, want %+v", s, want)
+	}
+}
+
+func TestReadPauses(t *testing.T) {
+	before := ReadPauses()
+	runtime.GC()
+	d := ReadPauses().Sub(before).Summary()
+	if d.Cycles == 0 || d.N == 0 || d.Max <= 0 {
+		t.Errorf("after runtime.GC: %+v", d)
+	}
+}
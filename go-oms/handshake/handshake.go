@@ -0,0 +1,258 @@
+// Package handshake is the control plane between the OMS and the engine: a
+// Unix socket, next to the queue files, on which an engine introduces
+// itself, both sides agree on a protocol version and the capabilities they
+// share, the OMS announces the queue to attach to, and either side can
+// announce that it is shutting down. Engines no longer have to be started
+// with the same hardcoded path as the OMS and hope.
+//
+// The protocol is newline-terminated ASCII lines:
+//
+//	engine: HELLO <version> <cap,cap,...>
+//	oms:    WELCOME <version> <cap,cap,...>   (or ERROR <message>, then close)
+//	oms:    QUEUE <order queue path>          (status queue is queue.StatusPath)
+//	        or QUEUE_FD                       (order and status queue descriptors
+//	                                           attached, SCM_RIGHTS, to WELCOME)
+//	engine: READY                             (both rings mapped)
+//	either: SHUTDOWN <reason>
+//
+// The version is the highest each side speaks; WELCOME carries the one
+// both use and the capabilities both have. QUEUE_FD, for queues in memory
+// rather than files (queue.CreateQueueMemfd), is sent with WELCOME in one
+// message and only to engines with queue_fd; the engine must read that
+// message with recvmsg to receive the descriptors. rust-me/src/control.rs
+// is the engine side.
+package handshake
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	Version    = 1 // highest protocol version spoken here
+	MinVersion = 1 // lowest still accepted
+
+	// handshakeTimeout bounds HELLO through READY, so a stuck peer cannot
+	// hold the accept loop.
+	handshakeTimeout = 5 * time.Second
+)
+
+// Capabilities are the optional features this OMS uses; an engine lists
+// those it supports.
+var Capabilities = []string{
+	"flags",        // Order.Flags execution instructions
+	"reasons",      // Order.Reason on rejects
+	"fill_reports", // Liquidity, Fee and ContraClientID on fills
+	"bust_correct", // MsgBust and MsgCorrect
+	"rfq",          // MsgQuoteRequest, MsgQuote and MsgQuoteHit
+	"queue_fd",     // queues passed as descriptors, QUEUE_FD
+}
+
+var (
+	// ErrVersion is returned when the engine speaks no version accepted here.
+	ErrVersion = errors.New("unsupported protocol version")
+	// ErrProtocol is returned for a line out of sequence or malformed.
+	ErrProtocol = errors.New("control protocol error")
+	// ErrCapability is returned when the engine cannot take the queues the
+	// way the server passes them.
+	ErrCapability = errors.New("engine lacks a required capability")
+)
+
+// SocketPath is where the OMS serving queuePath listens.
+func SocketPath(queuePath string) string {
+	return queuePath + "_control"
+}
+
+// Server accepts engines and tells each which queue to attach to.
+type Server struct {
+	l          net.Listener
+	queuePath  string
+	queueFiles []*os.File // order and status queue, passed instead of queuePath
+}
+
+// Listen serves the handshake on socketPath, replacing a stale socket,
+// announcing queuePath to every engine.
+func Listen(socketPath, queuePath string) (*Server, error) {
+	_ = os.Remove(socketPath)
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	// owner and group only, like the queue files it points at
+	if err := os.Chmod(socketPath, 0o660); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to chmod control socket: %w", err)
+	}
+	return &Server{l: l, queuePath: queuePath}, nil
+}
+
+// ListenFiles is Listen for queues that have no path, such as memfd
+// queues: engines are passed the order and status queue descriptors, so
+// they only have to share the socket with the OMS, not a filesystem. The
+// files stay owned by the caller.
+func ListenFiles(socketPath string, orders, status *os.File) (*Server, error) {
+	s, err := Listen(socketPath, "")
+	if err != nil {
+		return nil, err
+	}
+	s.queueFiles = []*os.File{orders, status}
+	return s, nil
+}
+
+// Accept waits for an engine and runs the handshake through READY.
+func (s *Server) Accept() (*Engine, error) {
+	conn, err := s.l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	e, err := handshake(conn, s.queuePath, s.queueFiles)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *Server) Close() error {
+	return s.l.Close()
+}
+
+// Engine is an engine that completed the handshake.
+type Engine struct {
+	Version      int
+	Capabilities []string // shared by both sides
+
+	conn   net.Conn
+	wmu    sync.Mutex
+	done   chan struct{}
+	reason string // set before done closes
+}
+
+func handshake(conn net.Conn, queuePath string, queueFiles []*os.File) (*Engine, error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	r := bufio.NewReader(conn)
+
+	verb, args, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if verb != "HELLO" {
+		return nil, fmt.Errorf("%w: want HELLO, got %q", ErrProtocol, verb)
+	}
+	vs, capList, _ := strings.Cut(args, " ")
+	theirs, err := strconv.Atoi(vs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: HELLO version %q", ErrProtocol, vs)
+	}
+	version := min(Version, theirs)
+	if version < MinVersion {
+		fmt.Fprintf(conn, "ERROR version %d not supported, need %d..%d\n", theirs, MinVersion, Version)
+		return nil, fmt.Errorf("%w: engine speaks %d", ErrVersion, theirs)
+	}
+	var shared []string
+	for _, c := range strings.Split(capList, ",") {
+		if slices.Contains(Capabilities, c) {
+			shared = append(shared, c)
+		}
+	}
+	welcome := fmt.Sprintf("WELCOME %d %s\n", version, strings.Join(shared, ","))
+	if queueFiles == nil {
+		_, err = fmt.Fprintf(conn, "%sQUEUE %s\n", welcome, queuePath)
+	} else if !slices.Contains(shared, "queue_fd") {
+		fmt.Fprintf(conn, "ERROR queues are passed as descriptors, which needs queue_fd\n")
+		return nil, fmt.Errorf("%w: queue_fd", ErrCapability)
+	} else {
+		err = sendFiles(conn, welcome+"QUEUE_FD\n", queueFiles)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if verb, _, err = readLine(r); err != nil {
+		return nil, err
+	}
+	if verb != "READY" {
+		return nil, fmt.Errorf("%w: want READY, got %q", ErrProtocol, verb)
+	}
+	conn.SetDeadline(time.Time{})
+
+	e := &Engine{Version: version, Capabilities: shared, conn: conn, done: make(chan struct{})}
+	go e.watch(r)
+	return e, nil
+}
+
+// sendFiles writes msg with files attached as SCM_RIGHTS.
+func sendFiles(conn net.Conn, msg string, files []*os.File) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("cannot pass descriptors over %T", conn)
+	}
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+	_, _, err := uc.WriteMsgUnix([]byte(msg), syscall.UnixRights(fds...), nil)
+	return err
+}
+
+func readLine(r *bufio.Reader) (verb, args string, err error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", "", fmt.Errorf("control socket: %w", err)
+	}
+	verb, args, _ = strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+	return verb, args, nil
+}
+
+// watch waits for the engine's SHUTDOWN or disconnect.
+func (e *Engine) watch(r *bufio.Reader) {
+	defer close(e.done)
+	for {
+		verb, args, err := readLine(r)
+		if err != nil {
+			e.reason = "disconnected"
+			return
+		}
+		if verb == "SHUTDOWN" {
+			e.reason = args
+			return
+		}
+	}
+}
+
+// Has reports whether both sides support capability c.
+func (e *Engine) Has(c string) bool {
+	return slices.Contains(e.Capabilities, c)
+}
+
+// Done is closed when the engine announces shutdown or disconnects.
+func (e *Engine) Done() <-chan struct{} {
+	return e.done
+}
+
+// Reason is why the engine went away; valid once Done is closed.
+func (e *Engine) Reason() string {
+	<-e.done
+	return e.reason
+}
+
+// Shutdown tells the engine the OMS is going away.
+func (e *Engine) Shutdown(reason string) error {
+	e.wmu.Lock()
+	defer e.wmu.Unlock()
+	_, err := fmt.Fprintf(e.conn, "SHUTDOWN %s\n", strings.ReplaceAll(reason, "\n", " "))
+	return err
+}
+
+func (e *Engine) Close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,154 @@
+package handshake
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"oms/queue"
+)
+
+// fakeEngine dials the server and plays the engine side.
+func fakeEngine(t *testing.T, sock, hello string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "%s\n", hello)
+	return conn, bufio.NewReader(conn)
+}
+
+func TestHandshake(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "orders_control")
+	s, err := Listen(sock, "/run/oms/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	accepted := make(chan *Engine, 1)
+	go func() {
+		e, err := s.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- e
+	}()
+
+	conn, r := fakeEngine(t, sock, "HELLO 3 reasons,stops,flags")
+	for _, want := range []string{"WELCOME 1 reasons,flags\n", "QUEUE /run/oms/orders\n"} {
+		if line, _ := r.ReadString('\n'); line != want {
+			t.Fatalf("got %q, want %q", line, want)
+		}
+	}
+	fmt.Fprintln(conn, "READY")
+	e := <-accepted
+	if e == nil || e.Version != 1 || !e.Has("flags") || e.Has("stops") {
+		t.Fatalf("engine %+v", e)
+	}
+
+	if err := e.Shutdown("oms stopping"); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := r.ReadString('\n'); line != "SHUTDOWN oms stopping\n" {
+		t.Fatalf("got %q", line)
+	}
+	fmt.Fprintln(conn, "SHUTDOWN engine stopping")
+	if reason := e.Reason(); reason != "engine stopping" {
+		t.Fatalf("reason %q", reason)
+	}
+}
+
+func TestHandshakeRejectsOldVersion(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "orders_control")
+	s, err := Listen(sock, "/run/oms/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, r := fakeEngine(t, sock, "HELLO 0 flags")
+	if _, err := s.Accept(); !errors.Is(err, ErrVersion) {
+		t.Fatalf("accept: %v", err)
+	}
+	if line, _ := r.ReadString('\n'); !strings.HasPrefix(line, "ERROR ") {
+		t.Fatalf("got %q, want ERROR", line)
+	}
+}
+
+func TestHandshakeQueueFiles(t *testing.T) {
+	orders, err := queue.CreateQueueMemfd("orders")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer orders.Close()
+	status, err := queue.CreateQueueMemfd("orders_status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer status.Close()
+	sock := filepath.Join(t.TempDir(), "orders_control")
+	s, err := ListenFiles(sock, orders.File(), status.File())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	go func() {
+		for {
+			e, err := s.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if e != nil {
+				e.Close()
+			}
+		}
+	}()
+
+	conn, _ := fakeEngine(t, sock, "HELLO 1 flags,queue_fd")
+	buf, oob := make([]byte, 256), make([]byte, syscall.CmsgSpace(2*4))
+	n, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "WELCOME 1 flags,queue_fd\nQUEUE_FD\n" {
+		t.Fatalf("got %q", got)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("control messages %v, %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 2 {
+		t.Fatalf("descriptors %v, %v", fds, err)
+	}
+
+	// the engine's mapping is the producer's ring
+	engine, err := queue.OpenQueueFile(os.NewFile(uintptr(fds[0]), "orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	syscall.Close(fds[1])
+	fmt.Fprintln(conn, "READY")
+	if err := orders.Enqueue(queue.Order{OrderID: 7, Quantity: 1, Price: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := engine.Dequeue(); err != nil || o.OrderID != 7 {
+		t.Fatalf("dequeued %+v, %v", o, err)
+	}
+
+	// an engine that cannot take descriptors is turned away
+	_, r := fakeEngine(t, sock, "HELLO 1 flags")
+	if line, _ := r.ReadString('\n'); !strings.HasPrefix(line, "ERROR ") {
+		t.Fatalf("got %q, want ERROR", line)
+	}
+}
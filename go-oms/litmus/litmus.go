@@ -0,0 +1,398 @@
+// Package litmus stress-tests a single-producer single-consumer order ring
+// for the properties its lock-free handoff must keep, under as many
+// interleavings as a run can provoke: every order arrives exactly once, in
+// order, with no field torn by a slot read racing its write, and the depth
+// never leaves 0..Capacity.
+//
+// Each case runs a producer, a consumer and a depth observer under one
+// GOMAXPROCS setting, from one that forces every handoff through the
+// scheduler to every core the host has. Both sides yield and spin at
+// random points; a preemption storm can run alongside, flipping GOGC
+// between 1 and off and forcing collections, so goroutines are stopped
+// and moved at points no benchmark reaches. A passing run is evidence,
+// not proof, but a failing one is a bug.
+package litmus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oms/cpu"
+	"oms/queue"
+)
+
+// Reader is how the consumer takes orders off the ring.
+type Reader uint8
+
+const (
+	ReadDequeue     Reader = iota // Dequeue, one order at a time
+	ReadBatch                     // DequeueUpTo, random batch sizes
+	ReadPeekAdvance               // Peek, then Advance
+)
+
+var readerNames = [...]string{"dequeue", "batch", "peek_advance"}
+
+func (r Reader) String() string {
+	if int(r) < len(readerNames) {
+		return readerNames[r]
+	}
+	return fmt.Sprintf("Reader(%d)", uint8(r))
+}
+
+type batchReader interface {
+	DequeueUpTo(n int, dst []queue.Order) ([]queue.Order, error)
+}
+
+type peekReader interface {
+	Peek() (*queue.Order, error)
+	Advance()
+}
+
+// Supports reports whether q can be read with r.
+func (r Reader) Supports(q queue.OrderQueue) bool {
+	switch r {
+	case ReadBatch:
+		_, ok := q.(batchReader)
+		return ok
+	case ReadPeekAdvance:
+		_, ok := q.(peekReader)
+		return ok
+	}
+	return true
+}
+
+// Case is one run's setting.
+type Case struct {
+	Procs  int // GOMAXPROCS for the run
+	Reader Reader
+	Storm  bool // flip GOGC and force collections throughout
+}
+
+func (c Case) String() string {
+	s := fmt.Sprintf("procs=%d reader=%s", c.Procs, c.Reader)
+	if c.Storm {
+		s += " storm"
+	}
+	return s
+}
+
+// Config is a set of cases: every combination of Procs, Readers and
+// Storms the queue supports.
+type Config struct {
+	Orders  uint64        // per case; default 100000
+	Procs   []int         // default 1, 2 and runtime.NumCPU
+	Readers []Reader      // default all three
+	Storms  []bool        // default without, then with
+	Seed    uint64        // interleaving choices; 0 picks one from the clock
+	Timeout time.Duration // per case, after which a stalled ring fails it; default 30s
+}
+
+// Cases expands the config into the cases it runs.
+func (cfg Config) Cases() []Case {
+	procs := cfg.Procs
+	if procs == nil {
+		procs = []int{1, 2}
+		if n := runtime.NumCPU(); n > 2 {
+			procs = append(procs, n)
+		}
+	}
+	readers := cfg.Readers
+	if readers == nil {
+		readers = []Reader{ReadDequeue, ReadBatch, ReadPeekAdvance}
+	}
+	storms := cfg.Storms
+	if storms == nil {
+		storms = []bool{false, true}
+	}
+	var cases []Case
+	for _, p := range procs {
+		for _, r := range readers {
+			for _, s := range storms {
+				cases = append(cases, Case{Procs: p, Reader: r, Storm: s})
+			}
+		}
+	}
+	return cases
+}
+
+// Violation is a broken invariant.
+type Violation struct {
+	Kind   string // order, torn, depth, stall or error
+	Detail string
+}
+
+func (v Violation) String() string { return v.Kind + ": " + v.Detail }
+
+// Result is one case's outcome. The counters show how hard the run pushed
+// the handoff: a run that never filled or emptied the ring proved little.
+type Result struct {
+	Case       Case
+	Seed       uint64
+	Consumed   uint64
+	Full       uint64 // enqueues refused by a full ring
+	Empty      uint64 // reads that found the ring empty
+	MaxDepth   uint64 // deepest the observer saw
+	Elapsed    time.Duration
+	Violations []Violation // the first few only
+}
+
+// OK reports whether the case kept every invariant.
+func (r Result) OK() bool { return len(r.Violations) == 0 }
+
+// maxViolations bounds what a case records once it is already failing.
+const maxViolations = 8
+
+// Run runs every case the config expands to on a fresh queue from
+// newQueue, which the run closes, and returns the results in order. Cases
+// the queue cannot be read for are skipped. Run changes GOMAXPROCS and
+// GOGC while it runs and restores both.
+func Run(ctx context.Context, cfg Config, newQueue func() (queue.OrderQueue, error)) ([]Result, error) {
+	if cfg.Orders == 0 {
+		cfg.Orders = 100000
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = uint64(time.Now().UnixNano())
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	var results []Result
+	for i, c := range cfg.Cases() {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		q, err := newQueue()
+		if err != nil {
+			return results, err
+		}
+		if !c.Reader.Supports(q) {
+			q.Close()
+			continue
+		}
+		runtime.GOMAXPROCS(max(c.Procs, 1))
+		res := runCase(ctx, c, q, cfg.Orders, cfg.Seed+uint64(i), cfg.Timeout)
+		q.Close()
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// stamp fills every field of order n from n, so a reader can tell a slot
+// it read whole from one it read mid-write. Side stays 0 or 1, since
+// Dequeue refuses anything else as corrupt.
+func stamp(n uint64) queue.Order {
+	return queue.Order{
+		OrderID:   n,
+		ClientID:  uint32(n * 2654435761),
+		Symbol:    uint32(n>>3) ^ 0x5bd1,
+		Side:      uint8(n & 1),
+		Quantity:  uint32(n ^ 0x5bd1e995),
+		Price:     n*31 + 7,
+		Timestamp: ^n,
+		ExpireAt:  n << 7,
+	}
+}
+
+type recorder struct {
+	mu         sync.Mutex
+	violations []Violation
+	failed     atomic.Bool
+}
+
+func (r *recorder) add(kind, format string, args ...any) {
+	r.failed.Store(true)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.violations) < maxViolations {
+		r.violations = append(r.violations, Violation{kind, fmt.Sprintf(format, args...)})
+	}
+}
+
+func runCase(ctx context.Context, c Case, q queue.OrderQueue, orders, seed uint64, timeout time.Duration) Result {
+	res := Result{Case: c, Seed: seed}
+	rec := &recorder{}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+
+	var consumed, full, empty, maxDepth atomic.Uint64
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if c.Storm {
+		wg.Go(func() { storm(done) })
+	}
+	wg.Go(func() { observe(q, done, rec, &maxDepth) })
+	wg.Go(func() { produce(ctx, q, orders, rand.New(rand.NewPCG(seed, 1)), rec, &full) })
+	consume(ctx, c.Reader, q, orders, rand.New(rand.NewPCG(seed, 2)), rec, &consumed, &empty)
+	close(done)
+	wg.Wait()
+
+	res.Consumed, res.Full, res.Empty, res.MaxDepth = consumed.Load(), full.Load(), empty.Load(), maxDepth.Load()
+	res.Elapsed = time.Since(start)
+	if res.Consumed != orders && !rec.failed.Load() {
+		rec.add("stall", "consumed %d of %d orders in %v", res.Consumed, orders, timeout)
+	}
+	if d := q.Depth(); d != 0 && !rec.failed.Load() {
+		rec.add("depth", "%d left on the ring after every order was consumed", d)
+	}
+	res.Violations = rec.violations
+	return res
+}
+
+// jitter yields or spins at random, about once every 64 calls, so the two
+// sides meet at different points of each other's handoff.
+func jitter(r *rand.Rand) {
+	switch r.IntN(64) {
+	case 0:
+		runtime.Gosched()
+	case 1:
+		for range r.IntN(256) {
+			cpu.Relax()
+		}
+	}
+}
+
+func produce(ctx context.Context, q queue.OrderQueue, orders uint64, r *rand.Rand, rec *recorder, full *atomic.Uint64) {
+	for n := uint64(1); n <= orders; n++ {
+		for {
+			err := q.Enqueue(stamp(n))
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, queue.ErrQueueFull) {
+				rec.add("error", "enqueue %d: %v", n, err)
+				return
+			}
+			full.Add(1)
+			if ctx.Err() != nil || rec.failed.Load() {
+				return
+			}
+			jitter(r)
+		}
+		jitter(r)
+	}
+}
+
+func consume(ctx context.Context, reader Reader, q queue.OrderQueue, orders uint64, r *rand.Rand, rec *recorder, consumed, empty *atomic.Uint64) {
+	next := uint64(1)
+	check := func(o queue.Order) bool {
+		if o.OrderID != next {
+			rec.add("order", "got order %d, want %d", o.OrderID, next)
+			return false
+		}
+		if o != stamp(next) {
+			rec.add("torn", "order %d read as %+v", next, o)
+			return false
+		}
+		next++
+		consumed.Add(1)
+		return true
+	}
+	var batch []queue.Order
+	for next <= orders {
+		if ctx.Err() != nil || rec.failed.Load() {
+			return
+		}
+		var got int
+		switch reader {
+		case ReadBatch:
+			var err error
+			batch, err = q.(batchReader).DequeueUpTo(1+r.IntN(64), batch[:0])
+			if err != nil {
+				rec.add("error", "dequeue batch after %d: %v", next-1, err)
+				return
+			}
+			for _, o := range batch {
+				if !check(o) {
+					return
+				}
+			}
+			got = len(batch)
+		case ReadPeekAdvance:
+			pr := q.(peekReader)
+			o, err := pr.Peek()
+			if err != nil {
+				rec.add("error", "peek after %d: %v", next-1, err)
+				return
+			}
+			if o != nil {
+				if !check(*o) {
+					return
+				}
+				pr.Advance()
+				got = 1
+			}
+		default:
+			o, err := q.Dequeue()
+			if err != nil {
+				rec.add("error", "dequeue after %d: %v", next-1, err)
+				return
+			}
+			if o != nil {
+				if !check(*o) {
+					return
+				}
+				got = 1
+			}
+		}
+		if got == 0 {
+			empty.Add(1)
+		}
+		jitter(r)
+	}
+}
+
+// observe samples the depth from a third goroutine, as monitoring does.
+func observe(q queue.OrderQueue, done <-chan struct{}, rec *recorder, maxDepth *atomic.Uint64) {
+	capacity := q.Capacity()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		d := q.Depth()
+		if d > capacity {
+			rec.add("depth", "depth %d over capacity %d", d, capacity)
+			return
+		}
+		if d > maxDepth.Load() {
+			maxDepth.Store(d)
+		}
+		runtime.Gosched()
+	}
+}
+
+// storm forces collections until done: each stops the world, preempting
+// producer and consumer wherever they are, and GOGC flips between 1,
+// which collects on almost every allocation, and off.
+func storm(done <-chan struct{}) {
+	prev := debug.SetGCPercent(1)
+	defer debug.SetGCPercent(prev)
+	var garbage [][]byte
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if i%2 == 0 {
+			debug.SetGCPercent(1)
+		} else {
+			debug.SetGCPercent(-1)
+		}
+		garbage = append(garbage[:0], make([]byte, 64<<10))
+		if i%8 == 0 {
+			runtime.GC()
+		}
+		runtime.Gosched()
+	}
+}
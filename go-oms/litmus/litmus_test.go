@@ -0,0 +1,98 @@
+package litmus
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"oms/queue"
+)
+
+func check(t *testing.T, results []Result, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("no cases ran")
+	}
+	for _, r := range results {
+		if !r.OK() {
+			t.Errorf("%s (seed %d): %v", r.Case, r.Seed, r.Violations)
+		}
+	}
+}
+
+func TestMemQueue(t *testing.T) {
+	// a tiny ring wraps and fills constantly
+	results, err := Run(context.Background(), Config{Orders: 20000}, func() (queue.OrderQueue, error) {
+		return queue.NewInMemory(7), nil
+	})
+	check(t, results, err)
+	for _, r := range results {
+		if r.Full == 0 || r.Empty == 0 {
+			t.Logf("%s never found the ring full (%d) or empty (%d)", r.Case, r.Full, r.Empty)
+		}
+	}
+}
+
+func TestMappedQueue(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+	results, err := Run(context.Background(), Config{Orders: 150000}, func() (queue.OrderQueue, error) {
+		n++
+		return queue.CreateQueue(filepath.Join(dir, "q"+strconv.Itoa(n)))
+	})
+	check(t, results, err)
+	if want := len(Config{}.Cases()); len(results) != want {
+		t.Errorf("ran %d cases, want %d", len(results), want)
+	}
+}
+
+// lossy drops an order, reorders two or tears one, so the harness can be
+// seen to catch each.
+type lossy struct {
+	*queue.MemQueue
+	at   uint64
+	kind string
+	held *queue.Order
+}
+
+func (q *lossy) Enqueue(o queue.Order) error {
+	if o.OrderID != q.at {
+		return q.MemQueue.Enqueue(o)
+	}
+	switch q.kind {
+	case "drop":
+		return nil
+	case "swap":
+		if q.held == nil {
+			q.held = &o
+			q.at++
+			return nil
+		}
+		if err := q.MemQueue.Enqueue(o); err != nil {
+			return err
+		}
+		return q.MemQueue.Enqueue(*q.held)
+	default:
+		o.Price++
+		return q.MemQueue.Enqueue(o)
+	}
+}
+
+func TestCatchesBrokenQueue(t *testing.T) {
+	for kind, want := range map[string]string{"drop": "order", "swap": "order", "tear": "torn"} {
+		cfg := Config{Orders: 2000, Procs: []int{2}, Readers: []Reader{ReadDequeue}, Storms: []bool{false}}
+		results, err := Run(context.Background(), cfg, func() (queue.OrderQueue, error) {
+			return &lossy{MemQueue: queue.NewInMemory(64), at: 1000, kind: kind}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].OK() || results[0].Violations[0].Kind != want {
+			t.Errorf("%s: results = %+v, want a %s violation", kind, results, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+//go:build litmus
+
+package litmus
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+// Run with: go test -tags litmus -run TestLong -timeout 1h ./litmus
+//
+// The same cases as the default tests with a hundred times the orders,
+// and with -race too, before a change to the ring's handoff ships.
+
+func TestLongMemQueue(t *testing.T) {
+	results, err := Run(context.Background(), Config{Orders: 2_000_000, Timeout: 10 * time.Minute}, func() (queue.OrderQueue, error) {
+		return queue.NewInMemory(7), nil
+	})
+	check(t, results, err)
+}
+
+func TestLongMappedQueue(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+	results, err := Run(context.Background(), Config{Orders: 10_000_000, Timeout: 10 * time.Minute}, func() (queue.OrderQueue, error) {
+		n++
+		return queue.CreateQueue(filepath.Join(dir, "q"+strconv.Itoa(n)))
+	})
+	check(t, results, err)
+	for _, r := range results {
+		t.Logf("%s: %d full, %d empty, max depth %d in %v", r.Case, r.Full, r.Empty, r.MaxDepth, r.Elapsed)
+	}
+}
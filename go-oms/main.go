@@ -1,21 +1,43 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
 	"time"
 
+	"oms/admin"
+	"oms/audit"
+	"oms/monitor"
+	"oms/orderid"
 	"oms/queue"
+	"oms/scenario"
+	"oms/store"
+	_ "oms/store/drivers"
+	"oms/surveillance"
 )
 
-const queueFilePath = "/tmp/sex"
+var queueFilePath string
 
 func main() {
+	flag.StringVar(&queueFilePath, "queue", queue.DefaultPath(),
+		"order queue stream directory or file (env "+queue.EnvQueuePath+"); status queue is <queue>_status")
+	flag.Usage = printUsage
+	flag.Parse()
+	args := flag.Args()
+
 	// Parse command line args for different test scenarios
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	if len(args) > 0 {
+		switch args[0] {
 		case "init":
 			testInit()
 		case "single":
@@ -23,9 +45,19 @@ func main() {
 		case "batch":
 			testBatch()
 		case "stream":
-			testContinuousStream()
+			if len(args) > 1 {
+				playScenario(args[1])
+			} else {
+				testContinuousStream()
+			}
 		case "monitor":
-			testMonitor()
+			testMonitor(args[1:])
+		case "admin":
+			runAdmin(args[1:])
+		case "cancel-all":
+			cancelAll(args[1:])
+		case "cancel-symbol":
+			cancelAllSymbol(args[1:])
 		default:
 			printUsage()
 		}
@@ -36,21 +68,39 @@ func main() {
 
 func printUsage() {
 	fmt.Println(`
-Usage: go run main.go [command]
+Usage: go run main.go [-queue path] [command]
+
+The queue path defaults to $OMS_QUEUE_PATH, else $XDG_RUNTIME_DIR/oms/orders.
 
 Commands:
   init       - Initialize queue with validation
   single     - Send a single test order
   batch      - Send 10,000 orders in rapid succession
   stream     - Continuously stream orders (press Ctrl+C to stop)
-  monitor    - Monitor queue depth in real-time (requires queue already open)`)
+  stream <scenario.yaml>    - Play a scenario file's phases, rates and faults
+  monitor [--record out.csv] [queue...]
+                            - Live dashboard of order and status queues (Ctrl+C
+                              to stop): the queue and every other order stream
+                              beside it, e.g. one per shard, each with its
+                              status queue, or the queues named; --record
+                              writes each sample's depth, lag and rates to a
+                              CSV file
+  admin [addr]              - Serve the admin API over the queues (token from
+                              OMS_ADMIN_TOKEN, audit log at OMS_AUDIT_LOG,
+                              default oms-audit.log, order history from
+                              OMS_STORE, see omsbroker -store, surveillance
+                              rules from OMS_SURVEILLANCE); open orders,
+                              positions, limits, kill switch and session
+                              are served by omsbroker -admin
+  cancel-all <clientID>     - Cancel every open order of a client
+  cancel-symbol <symbol>    - Cancel every open order in a symbol`)
 }
 
 // testInit initializes the queue and validates structure
 func testInit() {
 	fmt.Println("[TEST] Initializing shared memory queue...")
 
-	q, err := queue.CreateQueue(queueFilePath)
+	q, err := queue.CreateStream(queueFilePath, queue.StreamMeta{Kind: queue.StreamOrders}, queue.CreateOptions{})
 	if err != nil {
 		log.Fatalf("Failed to create queue: %v", err)
 	}
@@ -59,18 +109,21 @@ func testInit() {
 	fmt.Printf("[TEST] Queue initialized successfully\n")
 	fmt.Printf("[TEST] Capacity: %d orders\n", q.Capacity())
 	fmt.Printf("[TEST] Queue depth: %d\n", q.Depth())
-	fmt.Printf("[TEST] File: %s (size: ~3.2 MB)\n", queueFilePath)
+	fmt.Printf("[TEST] Stream: %s (data file ~3.2 MB)\n", queueFilePath)
 
 	// Create status queue too
 	fmt.Println("\n[TEST] Initializing status feedback queue...")
-	statusQ, err := queue.CreateQueue(queueFilePath + "_status")
+	statusQ, err := queue.CreateStream(queue.StatusPath(queueFilePath), queue.StreamMeta{
+		Kind: queue.StreamStatus,
+		Pair: filepath.Base(queueFilePath),
+	}, queue.CreateOptions{})
 	if err != nil {
 		log.Fatalf("Failed to create status queue: %v", err)
 	}
 	defer statusQ.Close()
 
 	fmt.Printf("[TEST] Status queue initialized successfully\n")
-	fmt.Printf("[TEST] File: %s_status (size: ~3.2 MB)\n", queueFilePath)
+	fmt.Printf("[TEST] Stream: %s (data file ~3.2 MB)\n", queue.StatusPath(queueFilePath))
 }
 
 // testSingleOrder sends a single test order
@@ -98,7 +151,7 @@ func testSingleOrder() {
 
 	fmt.Printf("[TEST] Single order sent successfully\n")
 	fmt.Printf("       OrderID: %d\n", order.OrderID)
-	fmt.Printf("       Symbol: %s\n", string(order.Symbol))
+	fmt.Printf("       Symbol: %d\n", order.Symbol)
 	fmt.Printf("       Qty: %d @ %d\n", order.Quantity, order.Price)
 	fmt.Printf("       Queue depth: %d\n", q.Depth())
 }
@@ -112,18 +165,22 @@ func testBatch() {
 		log.Fatalf("Failed to open queue: %v", err)
 	}
 	defer q.Close()
+	q.RecordHistory(queue.HistoryInterval)
 
 	//symbols := []string{"KOHLI", "ROHIT", "DHONI"}
 	sides := []uint8{0, 1} // buy, sell
 	clients := []uint32{1001, 1002, 1003}
 
+	ids := openOrderIDs()
+	defer ids.Close()
+
 	startTime := time.Now()
 	successCount := 0
 	backpressureCount := 0
 
 	for i := 1; i <= 100000; i++ {
 		order := queue.Order{
-			OrderID:   uint64(i),
+			OrderID:   nextOrderID(ids),
 			ClientID:  clients[i%len(clients)],
 			Quantity:  uint32(100 + (i % 900)),
 			Price:     uint64(50000 + (i % 5000)),
@@ -175,6 +232,32 @@ func testBatch() {
 	fmt.Printf("       Queue depth: %d\n", q.Depth())
 }
 
+// openOrderIDs resumes order ids from the state file next to the queue, so
+// repeated runs never reuse an id the engine has already seen.
+func openOrderIDs() *orderid.Allocator {
+	ids, err := orderid.Open(orderid.StatePath(queueFilePath), 1)
+	if err != nil {
+		log.Fatalf("Failed to open order id state: %v", err)
+	}
+	return ids
+}
+
+func nextOrderID(ids *orderid.Allocator) uint64 {
+	id, err := ids.Next()
+	if err != nil {
+		log.Fatalf("Failed to allocate order id: %v", err)
+	}
+	return id
+}
+
+// controlID allocates a mass cancel's id from the same sequence as orders:
+// the engine takes a skipped id for a lost order and asks for a resend.
+func controlID() uint64 {
+	ids := openOrderIDs()
+	defer ids.Close()
+	return nextOrderID(ids)
+}
+
 // testContinuousStream continuously generates orders
 func testContinuousStream() {
 	fmt.Println("[TEST] Starting continuous order stream (Ctrl+C to stop)...")
@@ -184,12 +267,15 @@ func testContinuousStream() {
 		log.Fatalf("Failed to open queue: %v", err)
 	}
 	defer q.Close()
+	q.RecordHistory(queue.HistoryInterval)
 
 	//symbols := []string{"KOHLI", "ROHIT", "DHONI", "SMITH", "WARNER"}
 	sides := []uint8{0, 1}
 	clients := []uint32{1001, 1002, 1003, 1004, 1005}
 
-	orderID := uint64(1)
+	ids := openOrderIDs()
+	defer ids.Close()
+	orderID := nextOrderID(ids)
 	ticker := time.NewTicker(10 * time.Millisecond)
 	defer ticker.Stop()
 
@@ -224,7 +310,7 @@ func testContinuousStream() {
 			}
 
 			totalSent++
-			orderID++
+			orderID = nextOrderID(ids)
 
 		case <-statsTicket.C:
 			elapsed := time.Since(startTime).Seconds()
@@ -235,41 +321,256 @@ func testContinuousStream() {
 	}
 }
 
-// testMonitor continuously monitors queue depth
-func testMonitor() {
-	fmt.Println("[TEST] Monitoring queue depth (Ctrl+C to stop)...")
-	fmt.Println("[TEST] Waiting for queue to be created...")
+// playScenario sends a scenario file's order flow to the engine
+func playScenario(path string) {
+	sc, err := scenario.Load(path)
+	if err != nil {
+		log.Fatalf("Failed to load scenario: %v", err)
+	}
+	q, err := queue.OpenQueue(queueFilePath)
+	if err != nil {
+		log.Fatalf("Failed to open queue: %v", err)
+	}
+	defer q.Close()
+	q.RecordHistory(queue.HistoryInterval)
+	ids := openOrderIDs()
+	defer ids.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var prog scenario.Progress
+	start := time.Now()
+	err = scenario.Play(ctx, sc, q, scenario.Options{
+		NextID: func() uint64 { return nextOrderID(ids) },
+		OnPhase: func(i int, ph *scenario.Phase) {
+			fmt.Printf("[TEST] Phase %s: %v at %.0f orders/sec, %d faults (%d sent so far)\n",
+				ph.Name, ph.Duration, ph.Rate, len(ph.Faults), prog.Sent.Load())
+		},
+	}, &prog)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("Scenario stopped: %v", err)
+	}
+	fmt.Printf("[TEST] Scenario %s: %d messages in %v\n", sc.Name, prog.Sent.Load(), time.Since(start).Round(time.Millisecond))
+}
+
+// testMonitor shows a live dashboard of order queues and their status
+// queues: the ones named, else the default pair and every other order
+// stream in its directory.
+func testMonitor(args []string) {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	record := fs.String("record", "", "write every sample's depth, lag and rates to this CSV file")
+	fs.Parse(args)
+	paths := fs.Args()
+	fmt.Println("[TEST] Waiting for queues to be created...")
+
+	wait := len(paths) == 0
+	if wait {
+		paths = []string{queueFilePath}
+		if streams, err := queue.List(filepath.Dir(queueFilePath)); err == nil {
+			for _, s := range streams {
+				if s.Meta.Kind == queue.StreamOrders && filepath.Clean(s.Dir) != filepath.Clean(queueFilePath) {
+					paths = append(paths, s.Dir)
+				}
+			}
+		}
+	}
+	var targets []monitor.Target
+	for i, path := range paths {
+		q := openWhenReady(path)
+		defer q.Close()
+		status := false
+		if meta, err := queue.ReadStreamMeta(path); err == nil {
+			status = meta.Kind == queue.StreamStatus
+		}
+		targets = append(targets, monitor.Target{Name: filepath.Base(path), Q: q, Status: status})
+		if status {
+			continue
+		}
+		// the default status queue is waited for, others only shown if there
+		statusPath := queue.StatusPath(path)
+		if _, err := os.Stat(statusPath); err != nil && !(wait && i == 0) {
+			continue
+		}
+		statusQ := openWhenReady(statusPath)
+		defer statusQ.Close()
+		targets = append(targets, monitor.Target{Name: filepath.Base(statusPath), Q: statusQ, Status: true})
+	}
+
+	width := 100
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		width = cols
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m := monitor.New(targets...)
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *record, err)
+		}
+		defer f.Close()
+		m.Record(f)
+	}
+	m.ShowStreams(filepath.Dir(queueFilePath))
+	m.Run(ctx, os.Stdout, 500*time.Millisecond, width)
+}
 
-	// Keep trying to open until it exists
-	var q *queue.Queue
-	var err error
+// openWhenReady keeps trying to open a queue read-only until it exists
+func openWhenReady(path string) *queue.ReadOnlyQueue {
 	for {
-		q, err = queue.OpenQueue(queueFilePath)
+		q, err := queue.OpenQueueReadOnly(path)
 		if err == nil {
-			break
+			return q
 		}
-		fmt.Printf("[TEST] Queue not ready, retrying... %v\n", err)
+		fmt.Printf("[TEST] Queue %s not ready, retrying... %v\n", path, err)
 		time.Sleep(1 * time.Second)
 	}
+}
+
+// cancelAll sends a CancelAll control message for one client
+func cancelAll(args []string) {
+	if len(args) != 1 {
+		log.Fatalf("usage: cancel-all <clientID>")
+	}
+	clientID, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		log.Fatalf("Invalid client ID %q: %v", args[0], err)
+	}
+	now := uint64(time.Now().UnixNano())
+	sendControl(queue.CancelAll(controlID(), uint32(clientID), now))
+	fmt.Printf("[TEST] CancelAll sent for client %d\n", clientID)
+}
+
+// cancelAllSymbol sends a CancelAllSymbol control message
+func cancelAllSymbol(args []string) {
+	if len(args) != 1 {
+		log.Fatalf("usage: cancel-symbol <symbol>")
+	}
+	symbol, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		log.Fatalf("Invalid symbol %q: %v", args[0], err)
+	}
+	now := uint64(time.Now().UnixNano())
+	sendControl(queue.CancelAllSymbol(controlID(), uint32(symbol), now))
+	fmt.Printf("[TEST] CancelAllSymbol sent for symbol %d\n", symbol)
+}
+
+// sendControl enqueues a control message, waiting out backpressure: a
+// mass cancel must not be dropped just because the ring is busy.
+func sendControl(msg queue.Order) {
+	q, err := queue.OpenQueue(queueFilePath)
+	if err != nil {
+		log.Fatalf("Failed to open queue: %v", err)
+	}
 	defer q.Close()
 
-	fmt.Println("[TEST] Queue opened, starting monitoring...")
+	for {
+		err := q.Enqueue(msg)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, queue.ErrQueueFull) {
+			log.Fatalf("Failed to enqueue control message: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
 
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
+// runAdmin serves the admin API over the order and status queues. Open
+// orders, positions, risk limits, the kill switch and the session belong
+// to the process producing the orders, so they are served by omsbroker
+// -admin, not here.
+func runAdmin(args []string) {
+	addr := "127.0.0.1:8080"
+	if len(args) > 0 {
+		addr = args[0]
+	}
+	token := os.Getenv("OMS_ADMIN_TOKEN")
+	if token == "" {
+		log.Fatalf("OMS_ADMIN_TOKEN must be set")
+	}
 
-	maxDepth := uint64(0)
+	q, err := queue.OpenQueue(queueFilePath)
+	if err != nil {
+		log.Fatalf("Failed to open queue: %v", err)
+	}
+	defer q.Close()
+	statusQ, err := queue.OpenQueue(queue.StatusPath(queueFilePath))
+	if err != nil {
+		log.Fatalf("Failed to open status queue: %v", err)
+	}
+	defer statusQ.Close()
 
-	for range ticker.C {
-		depth := q.Depth()
-		if depth > maxDepth {
-			maxDepth = depth
+	auditPath := os.Getenv("OMS_AUDIT_LOG")
+	if auditPath == "" {
+		auditPath = "oms-audit.log"
+	}
+	auditLog, err := audit.Open(auditPath)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+
+	var history store.Backend
+	if spec := os.Getenv("OMS_STORE"); spec != "" {
+		db, err := store.Open(spec)
+		if err != nil {
+			log.Fatalf("Failed to open order history: %v", err)
 		}
+		defer db.Close()
+		history = db
+	}
+	var watch *surveillance.Engine
+	if rulesPath := os.Getenv("OMS_SURVEILLANCE"); rulesPath != "" {
+		watch, err = startSurveillance(rulesPath, auditLog)
+		if err != nil {
+			log.Fatalf("Failed to start surveillance: %v", err)
+		}
+	}
+	srv := &admin.Server{
+		Token: token,
+		Queues: map[string]admin.QueueStats{
+			"orders": q,
+			"status": statusQ,
+		},
+		Streams:      filepath.Dir(queueFilePath),
+		Audit:        auditLog,
+		History:      history,
+		Control:      q,
+		Surveillance: watch,
+	}
 
-		capacity := q.Capacity()
-		fillPercent := float64(depth) / float64(capacity) * 100
+	fmt.Printf("[ADMIN] Serving admin API on %s\n", addr)
+	log.Fatal(http.ListenAndServe(addr, srv.Handler()))
+}
 
-		fmt.Printf("[MONITOR] Depth: %8d / %8d (%.1f%%), Max: %d\n",
-			depth, capacity, fillPercent, maxDepth)
+// startSurveillance runs the rules file's rules over read-only views of the
+// order and status queues, writing every alert to the audit log.
+func startSurveillance(rulesPath string, auditLog *audit.Log) (*surveillance.Engine, error) {
+	cfg, err := surveillance.Load(rulesPath)
+	if err != nil {
+		return nil, err
 	}
+	orders, err := queue.OpenQueueReadOnly(queueFilePath)
+	if err != nil {
+		return nil, err
+	}
+	status, err := queue.OpenQueueReadOnly(queue.StatusPath(queueFilePath))
+	if err != nil {
+		orders.Close()
+		return nil, err
+	}
+	e := surveillance.New(cfg.Rules()...)
+	e.OnAlert(surveillance.LogAlerts("[SURVEILLANCE]"))
+	e.OnAlert(func(a surveillance.Alert) {
+		target := "client/" + strconv.FormatUint(uint64(a.ClientID), 10)
+		if _, err := auditLog.Append("surveillance", "surveillance."+a.Rule, target, a); err != nil {
+			log.Printf("[SURVEILLANCE] audit log: %v", err)
+		}
+	})
+	go surveillance.Follow(context.Background(), orders, status, e, 10*time.Millisecond)
+	return e, nil
 }
@@ -0,0 +1,84 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// KafkaREST publishes through a Kafka REST Proxy (the v2 API of Confluent's
+// REST Proxy and compatible gateways), so the broker needs nothing beyond
+// HTTP to reach the cluster.
+type KafkaREST struct {
+	URL    string // base URL, e.g. http://kafka-rest:8082
+	Client *http.Client
+}
+
+var _ Publisher = (*KafkaREST)(nil)
+
+func NewKafkaREST(baseURL string) *KafkaREST {
+	return &KafkaREST{URL: baseURL, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type restRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type restOffset struct {
+	Partition int     `json:"partition"`
+	ErrorCode *int    `json:"error_code"`
+	Error     *string `json:"error"`
+}
+
+// Publish POSTs records to the topic in one request. The proxy answers
+// with an offset or an error per record; any error fails the batch, and a
+// retry may publish the records that did land twice.
+func (k *KafkaREST) Publish(ctx context.Context, topic string, records []Record) error {
+	body := struct {
+		Records []restRecord `json:"records"`
+	}{Records: make([]restRecord, len(records))}
+	for i, r := range records {
+		body.Records[i] = restRecord{Key: r.Key, Value: r.Value}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.URL+"/topics/"+url.PathEscape(topic), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := k.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("topic %s: %s: %s", topic, resp.Status, bytes.TrimSpace(msg))
+	}
+	var result struct {
+		Offsets []restOffset `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("topic %s: decode response: %w", topic, err)
+	}
+	for _, o := range result.Offsets {
+		if o.ErrorCode != nil || o.Error != nil {
+			msg := ""
+			if o.Error != nil {
+				msg = *o.Error
+			}
+			return fmt.Errorf("topic %s partition %d: %s", topic, o.Partition, msg)
+		}
+	}
+	return nil
+}
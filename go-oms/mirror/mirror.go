@@ -0,0 +1,266 @@
+// Package mirror publishes the order flow off shared memory: every order
+// accepted onto the ring and every execution report off the status ring to
+// Kafka, for analytics and surveillance, and execution reports to a NATS
+// subject per client, for UIs and bots that only want their own fills.
+//
+// The trading path never waits on either: events go into a bounded buffer
+// and a single goroutine batches them out. When the buffer is full, because
+// the far end is slow or down, events are dropped and counted rather than
+// holding up the broker.
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"oms/queue"
+)
+
+// Event kinds, and what Record.Value holds.
+const (
+	KindOrder     = "order"
+	KindExecution = "execution"
+)
+
+// Event is one mirrored record, the order fields as the ring carries them.
+type Event struct {
+	Kind           string    `json:"kind"`
+	At             time.Time `json:"at"` // when the broker saw it
+	OrderID        uint64    `json:"order_id"`
+	ClientID       uint32    `json:"client_id"`
+	SubAccount     uint8     `json:"sub_account,omitempty"`
+	Symbol         uint32    `json:"symbol"`
+	Side           uint8     `json:"side"`
+	Quantity       uint32    `json:"qty"`
+	Price          uint64    `json:"price"`
+	MsgType        uint8     `json:"msg_type"`
+	Status         uint8     `json:"status"`
+	TimeInForce    uint8     `json:"tif"`
+	Flags          string    `json:"flags,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	Liquidity      uint8     `json:"liquidity,omitempty"`
+	Fee            int32     `json:"fee,omitempty"`
+	ContraClientID uint32    `json:"contra_client_id,omitempty"`
+	TriggerPrice   uint32    `json:"trigger_price,omitempty"`
+	ExpireAt       uint64    `json:"expire_at,omitempty"`
+	Timestamp      uint64    `json:"timestamp"`
+}
+
+// NewEvent is the mirrored form of o, seen at at. The webhook package
+// delivers execution reports in the same form.
+func NewEvent(kind string, o queue.Order, at time.Time) Event {
+	e := Event{
+		Kind: kind, At: at,
+		OrderID: o.OrderID, ClientID: o.ClientID, SubAccount: o.SubAccount, Symbol: o.Symbol, Side: o.Side,
+		Quantity: o.Quantity, Price: o.Price, MsgType: o.MsgType, Status: o.Status,
+		TimeInForce: o.TimeInForce, Liquidity: o.Liquidity, Fee: o.Fee,
+		ContraClientID: o.ContraClientID, TriggerPrice: o.TriggerPrice,
+		ExpireAt: o.ExpireAt, Timestamp: o.Timestamp,
+	}
+	if o.Flags != 0 {
+		e.Flags = queue.FlagString(o.Flags)
+	}
+	if o.Reason != 0 {
+		e.Reason = queue.ReasonName(o.Reason)
+	}
+	return e
+}
+
+// Record is one message. The key is the client id, so each client's events
+// land on one Kafka partition, in order, or on one NATS subject.
+type Record struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// Publisher writes a batch of records to a topic, all or nothing.
+// KafkaREST and NATS are the ones this package provides.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, records []Record) error
+}
+
+// Config tunes a Mirror; zero values take the defaults.
+type Config struct {
+	OrderTopic     string        // default oms.orders
+	ExecutionTopic string        // default oms.executions
+	Buffer         int           // events held while publishing; default 65536
+	Batch          int           // most records per publish; default 500
+	Linger         time.Duration // longest an event waits for its batch to fill; default 50ms
+	Retries        int           // further attempts at a failed batch; default 3, negative for none
+}
+
+func (c *Config) defaults() {
+	if c.OrderTopic == "" {
+		c.OrderTopic = "oms.orders"
+	}
+	if c.ExecutionTopic == "" {
+		c.ExecutionTopic = "oms.executions"
+	}
+	if c.Buffer <= 0 {
+		c.Buffer = 65536
+	}
+	if c.Batch <= 0 {
+		c.Batch = 500
+	}
+	if c.Linger <= 0 {
+		c.Linger = 50 * time.Millisecond
+	}
+	switch {
+	case c.Retries == 0:
+		c.Retries = 3
+	case c.Retries < 0:
+		c.Retries = 0
+	}
+}
+
+type pending struct {
+	kind  string
+	order queue.Order
+	at    time.Time
+}
+
+// Stats counts events by what became of them.
+type Stats struct {
+	Published uint64
+	Dropped   uint64 // buffer full
+	Failed    uint64 // publish failed after every retry
+}
+
+// Mirror buffers events for a Publisher. Order and Execution are safe for
+// concurrent use and never block; Run does the publishing.
+type Mirror struct {
+	pub    Publisher
+	cfg    Config
+	events chan pending
+
+	published, dropped, failed atomic.Uint64
+}
+
+func New(pub Publisher, cfg Config) *Mirror {
+	cfg.defaults()
+	return &Mirror{pub: pub, cfg: cfg, events: make(chan pending, cfg.Buffer)}
+}
+
+// Order mirrors an order the ring accepted.
+func (m *Mirror) Order(o queue.Order) { m.add(KindOrder, o) }
+
+// Execution mirrors a record from the status ring.
+func (m *Mirror) Execution(o queue.Order) { m.add(KindExecution, o) }
+
+func (m *Mirror) add(kind string, o queue.Order) {
+	select {
+	case m.events <- pending{kind: kind, order: o, at: time.Now()}:
+	default:
+		m.dropped.Add(1)
+	}
+}
+
+func (m *Mirror) Stats() Stats {
+	return Stats{Published: m.published.Load(), Dropped: m.dropped.Load(), Failed: m.failed.Load()}
+}
+
+// Run publishes batches until ctx is done, then publishes what is still
+// buffered, giving up on it after five seconds.
+func (m *Mirror) Run(ctx context.Context) {
+	var batch []pending
+	linger := time.NewTimer(m.cfg.Linger)
+	linger.Stop()
+	var lastDropped uint64
+	flush := func(ctx context.Context) {
+		if len(batch) > 0 {
+			m.publish(ctx, batch)
+			batch = batch[:0]
+		}
+		if d := m.dropped.Load(); d != lastDropped {
+			log.Printf("[MIRROR] %d events dropped with the buffer full", d-lastDropped)
+			lastDropped = d
+		}
+	}
+	for {
+		select {
+		case p := <-m.events:
+			if len(batch) == 0 {
+				linger.Reset(m.cfg.Linger)
+			}
+			batch = append(batch, p)
+			if len(batch) >= m.cfg.Batch {
+				linger.Stop()
+				flush(ctx)
+			}
+		case <-linger.C:
+			flush(ctx)
+		case <-ctx.Done():
+			drain, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case p := <-m.events:
+					batch = append(batch, p)
+					if len(batch) >= m.cfg.Batch {
+						flush(drain)
+					}
+				default:
+					flush(drain)
+					return
+				}
+			}
+		}
+	}
+}
+
+// publish sends a batch, split by topic, retrying each part with backoff.
+func (m *Mirror) publish(ctx context.Context, batch []pending) {
+	byTopic := make(map[string][]Record)
+	for _, p := range batch {
+		value, err := json.Marshal(NewEvent(p.kind, p.order, p.at))
+		if err != nil {
+			m.failed.Add(1)
+			continue
+		}
+		topic := m.cfg.OrderTopic
+		if p.kind == KindExecution {
+			topic = m.cfg.ExecutionTopic
+		}
+		byTopic[topic] = append(byTopic[topic], Record{Key: strconv.FormatUint(uint64(p.order.ClientID), 10), Value: value})
+	}
+	for topic, records := range byTopic {
+		backoff := 100 * time.Millisecond
+		for attempt := 0; ; attempt++ {
+			err := m.pub.Publish(ctx, topic, records)
+			if err == nil {
+				m.published.Add(uint64(len(records)))
+				break
+			}
+			if attempt == m.cfg.Retries || ctx.Err() != nil {
+				log.Printf("[MIRROR] %d events to %s lost: %v", len(records), topic, err)
+				m.failed.Add(uint64(len(records)))
+				break
+			}
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// Queue wraps an order queue and mirrors every order it accepts.
+type Queue struct {
+	queue.OrderQueue
+	Mirror *Mirror
+}
+
+var _ queue.OrderQueue = (*Queue)(nil)
+
+func (q *Queue) Enqueue(order queue.Order) error {
+	if err := q.OrderQueue.Enqueue(order); err != nil {
+		return err
+	}
+	q.Mirror.Order(order)
+	return nil
+}
@@ -0,0 +1,229 @@
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+type fakePublisher struct {
+	mu      sync.Mutex
+	topics  map[string][]Event
+	batches int
+	fail    int // fail this many publishes first
+	block   chan struct{}
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, topic string, records []Record) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail > 0 {
+		f.fail--
+		return errors.New("broker unavailable")
+	}
+	f.batches++
+	for _, r := range records {
+		var e Event
+		if err := json.Unmarshal(r.Value, &e); err != nil {
+			return err
+		}
+		f.topics[topic] = append(f.topics[topic], e)
+	}
+	return nil
+}
+
+func TestMirrorOrdersAndExecutions(t *testing.T) {
+	pub := &fakePublisher{topics: make(map[string][]Event), fail: 1}
+	m := New(pub, Config{Batch: 2, Linger: time.Millisecond})
+	ring := &Queue{OrderQueue: queue.NewInMemory(1), Mirror: m}
+	if err := ring.Enqueue(queue.Order{OrderID: 1, ClientID: 7, Quantity: 10, Price: 100}); err != nil {
+		t.Fatal(err)
+	}
+	// full ring: not accepted, not mirrored
+	if err := ring.Enqueue(queue.Order{OrderID: 2, ClientID: 7}); !errors.Is(err, queue.ErrQueueFull) {
+		t.Fatalf("enqueue: %v", err)
+	}
+	m.Execution(queue.Order{OrderID: 1, ClientID: 7, Status: queue.StatusFilled, Quantity: 10, Price: 100})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().Published < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	orders, execs := pub.topics["oms.orders"], pub.topics["oms.executions"]
+	if len(orders) != 1 || orders[0].Kind != KindOrder || orders[0].OrderID != 1 || orders[0].ClientID != 7 {
+		t.Fatalf("orders topic %+v", orders)
+	}
+	if len(execs) != 1 || execs[0].Kind != KindExecution || execs[0].Status != queue.StatusFilled {
+		t.Fatalf("executions topic %+v", execs)
+	}
+	if s := m.Stats(); s.Published != 2 || s.Dropped != 0 || s.Failed != 0 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestMirrorDropsWhenFull(t *testing.T) {
+	pub := &fakePublisher{topics: make(map[string][]Event), block: make(chan struct{})}
+	m := New(pub, Config{Buffer: 4, Batch: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+
+	// one event held by the blocked publish, four buffered, the rest
+	// dropped without blocking the caller
+	start := time.Now()
+	for i := range 100 {
+		m.Order(queue.Order{OrderID: uint64(i + 1)})
+		if i == 0 {
+			for len(m.events) > 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Fatalf("producer held up for %v", took)
+	}
+	cancel()
+	close(pub.block)
+	<-done
+	if s := m.Stats(); s.Published != 5 || s.Dropped != 95 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestKafkaREST(t *testing.T) {
+	var got struct {
+		Records []restRecord `json:"records"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/oms.orders" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.Records[0].Key == "13" {
+			w.Write([]byte(`{"offsets":[{"partition":0,"offset":null,"error_code":50002,"error":"not leader"}]}`))
+			return
+		}
+		w.Write([]byte(`{"offsets":[{"partition":2,"offset":41,"error_code":null,"error":null}]}`))
+	}))
+	defer srv.Close()
+
+	k := NewKafkaREST(srv.URL)
+	if err := k.Publish(context.Background(), "oms.orders", []Record{{Key: "7", Value: json.RawMessage(`{"order_id":1}`)}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Records) != 1 || got.Records[0].Key != "7" || string(got.Records[0].Value) != `{"order_id":1}` {
+		t.Fatalf("proxy got %+v", got)
+	}
+	if err := k.Publish(context.Background(), "oms.orders", []Record{{Key: "13", Value: json.RawMessage(`{}`)}}); err == nil {
+		t.Fatal("record error not reported")
+	}
+	if err := k.Publish(context.Background(), "other", []Record{{Key: "7", Value: json.RawMessage(`{}`)}}); err == nil {
+		t.Fatal("HTTP error not reported")
+	}
+}
+
+// fakeNATS accepts one client at a time and records what it publishes.
+func fakeNATS(t *testing.T, token string) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	pubs := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"auth_required\":true}\r\n")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					break
+				}
+				switch verb, args, _ := strings.Cut(strings.TrimSpace(line), " "); verb {
+				case "CONNECT":
+					if !strings.Contains(args, `"auth_token":"`+token+`"`) {
+						fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+						conn.Close()
+					}
+				case "PING":
+					fmt.Fprint(conn, "PONG\r\n")
+				case "PUB":
+					subject, size, _ := strings.Cut(args, " ")
+					n, _ := strconv.Atoi(size)
+					payload := make([]byte, n+2)
+					io.ReadFull(r, payload)
+					pubs <- subject + " " + string(payload[:n])
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), pubs
+}
+
+func TestNATS(t *testing.T) {
+	addr, pubs := fakeNATS(t, "s3cret")
+
+	bad := NewNATS("nats://wrong@" + addr)
+	if err := bad.Publish(context.Background(), "oms.status", []Record{{Key: "7", Value: json.RawMessage(`{}`)}}); err == nil {
+		t.Fatal("authorization error not reported")
+	}
+
+	n := NewNATS("nats://s3cret@" + addr)
+	defer n.Close()
+	records := []Record{{Key: "7", Value: json.RawMessage(`{"order_id":1}`)}, {Key: "9", Value: json.RawMessage(`{"order_id":2}`)}}
+	if err := n.Publish(context.Background(), "oms.status", records); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`oms.status.7 {"order_id":1}`, `oms.status.9 {"order_id":2}`} {
+		if got := <-pubs; got != want {
+			t.Fatalf("published %q, want %q", got, want)
+		}
+	}
+
+	// a dropped connection fails one batch, and the next dials again
+	n.conn.Close()
+	if err := n.Publish(context.Background(), "oms.status", records[:1]); err == nil {
+		t.Fatal("publish on a closed connection succeeded")
+	}
+	if err := n.Publish(context.Background(), "oms.status", records[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-pubs; got != `oms.status.7 {"order_id":1}` {
+		t.Fatalf("published %q after reconnect", got)
+	}
+}
@@ -0,0 +1,187 @@
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATS publishes each record on the subject <topic>.<key>, so with the
+// client id as the key every client has its own subject: a UI or bot
+// subscribes to oms.status.42 for its fills, and a JetStream stream on
+// oms.status.> keeps them all. It speaks the plain NATS client protocol;
+// the server must not require TLS.
+type NATS struct {
+	URL  string // nats://[user:pass@|token@]host:4222
+	Name string // connection name shown by the server
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+var _ Publisher = (*NATS)(nil)
+
+func NewNATS(serverURL string) *NATS {
+	return &NATS{URL: serverURL, Name: "oms"}
+}
+
+// Publish sends every record, then a PING, and counts the batch published
+// once the server's PONG shows it processed them all. On any error the
+// connection is dropped and the next Publish dials again; some of the
+// batch may have been delivered, so a retry can repeat records.
+func (n *NATS) Publish(ctx context.Context, topic string, records []Record) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := n.publish(ctx, topic, records); err != nil {
+		n.conn.Close()
+		n.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (n *NATS) publish(ctx context.Context, topic string, records []Record) error {
+	n.setDeadline(ctx)
+	w := bufio.NewWriter(n.conn)
+	for _, r := range records {
+		subject := topic
+		if r.Key != "" {
+			subject += "." + r.Key
+		}
+		fmt.Fprintf(w, "PUB %s %d\r\n", subject, len(r.Value))
+		w.Write(r.Value)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return n.pong()
+}
+
+func (n *NATS) setDeadline(ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	n.conn.SetDeadline(deadline)
+}
+
+func (n *NATS) connect(ctx context.Context) error {
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "nats" {
+		return fmt.Errorf("nats: URL %q: want nats://host:port", n.URL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("nats: %w", err)
+	}
+	n.conn, n.r = conn, bufio.NewReader(conn)
+	if err := n.handshake(ctx, u); err != nil {
+		conn.Close()
+		n.conn = nil
+		return fmt.Errorf("nats: %w", err)
+	}
+	return nil
+}
+
+// handshake reads the server's INFO and answers with CONNECT, then PINGs
+// so an authorization error surfaces here rather than on the first batch.
+func (n *NATS) handshake(ctx context.Context, u *url.URL) error {
+	n.setDeadline(ctx)
+	line, err := n.readLine()
+	if err != nil {
+		return err
+	}
+	info, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("want INFO, got %q", line)
+	}
+	var server struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(info), &server); err != nil {
+		return fmt.Errorf("INFO: %w", err)
+	}
+	if server.TLSRequired {
+		return errors.New("server requires TLS")
+	}
+	opts := map[string]any{"verbose": false, "pedantic": false, "lang": "go", "version": "1", "protocol": 1, "name": n.Name}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts["user"], opts["pass"] = u.User.Username(), pass
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	connect, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(n.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		return err
+	}
+	return n.pong()
+}
+
+// pong reads until the server's PONG, answering its own PINGs meanwhile.
+func (n *NATS) pong() error {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates need no answer
+	}
+}
+
+func (n *NATS) readLine() (string, error) {
+	line, err := n.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Close drops the connection, if any.
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
@@ -0,0 +1,324 @@
+// Package monitor renders a live terminal view of one or more queues: a
+// combined table of depth, rates and lag across every queue watched, depth
+// gauges and throughput sparklines, top symbols and recent rejects,
+// optionally followed by every queue stream on the host. Samples can also
+// be recorded to CSV, to line a run's depth and lag up with its throughput
+// logs afterwards.
+package monitor
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"oms/queue"
+)
+
+// Source is the read side of a queue the monitor samples.
+type Source interface {
+	Depth() uint64
+	Capacity() uint64
+	ProducerHead() uint64
+	ConsumerTail() uint64
+	Recent(n int) []queue.Order
+}
+
+// Target is one queue on screen. Status queues contribute recent rejects,
+// order queues contribute top symbols.
+type Target struct {
+	Name   string
+	Q      Source
+	Status bool
+}
+
+const (
+	historyLen  = 60   // sparkline samples
+	recentSlots = 4096 // slots scanned for top symbols / rejects
+	topSymbols  = 5
+	maxRejects  = 5
+	// maxGauges is how many queues get a gauge and sparkline each; past
+	// that, e.g. a ring pair per shard, the table alone fits the screen.
+	maxGauges = 4
+)
+
+type series struct {
+	target   Target
+	rates    []float64 // enqueue rate history, oldest first
+	lastHead uint64
+	lastTail uint64
+	inRate   float64
+	outRate  float64
+	maxDepth uint64
+}
+
+// Monitor keeps per-target history between samples.
+type Monitor struct {
+	series   []*series
+	lastTime time.Time
+	maxTotal uint64 // deepest all targets were together
+
+	record    *csv.Writer // see Record
+	recordErr error
+
+	streamDir  string
+	streams    []queue.StreamInfo
+	streamsErr error
+}
+
+func New(targets ...Target) *Monitor {
+	m := &Monitor{lastTime: time.Now()}
+	for _, t := range targets {
+		m.series = append(m.series, &series{
+			target:   t,
+			lastHead: t.Q.ProducerHead(),
+			lastTail: t.Q.ConsumerTail(),
+		})
+	}
+	return m
+}
+
+// ShowStreams adds a table of the queue streams under dir, listed again on
+// every sample, so streams that come and go show up without a restart.
+func (m *Monitor) ShowStreams(dir string) {
+	m.streamDir = dir
+}
+
+// recordHeader is the first row Record writes. Rates are per second over
+// the interval ending at time; lag is the depth.
+var recordHeader = []string{"time", "queue", "head", "tail", "lag", "capacity", "in_rate", "out_rate"}
+
+// Record writes a CSV row per target on every Sample to w, after a header
+// row. A write error stops the recording and is shown on screen.
+func (m *Monitor) Record(w io.Writer) {
+	m.record = csv.NewWriter(w)
+	m.recordErr = m.writeRecord(recordHeader)
+}
+
+func (m *Monitor) writeRecord(row []string) error {
+	m.record.Write(row)
+	m.record.Flush()
+	return m.record.Error()
+}
+
+// Sample reads every target once and updates rates and history.
+func (m *Monitor) Sample(now time.Time) {
+	elapsed := now.Sub(m.lastTime).Seconds()
+	m.lastTime = now
+	var total uint64
+	for _, s := range m.series {
+		// the tail first, as Queue.Depth reads them: the head can only be
+		// further on, so head-tail never wraps, and capping it at the
+		// capacity keeps a producer racing ahead from poisoning maxDepth
+		tail := s.target.Q.ConsumerTail()
+		head := s.target.Q.ProducerHead()
+		depth := min(head-tail, s.target.Q.Capacity())
+		if elapsed > 0 {
+			s.inRate = float64(head-s.lastHead) / elapsed
+			s.outRate = float64(tail-s.lastTail) / elapsed
+		}
+		s.lastHead, s.lastTail = head, tail
+		s.maxDepth = max(s.maxDepth, depth)
+		total += depth
+		s.rates = append(s.rates, s.inRate)
+		if len(s.rates) > historyLen {
+			s.rates = s.rates[1:]
+		}
+		if m.record != nil && m.recordErr == nil {
+			m.recordErr = m.writeRecord([]string{
+				now.Format(time.RFC3339Nano), s.target.Name,
+				strconv.FormatUint(head, 10), strconv.FormatUint(tail, 10),
+				strconv.FormatUint(depth, 10), strconv.FormatUint(s.target.Q.Capacity(), 10),
+				strconv.FormatFloat(s.inRate, 'f', 1, 64), strconv.FormatFloat(s.outRate, 'f', 1, 64),
+			})
+		}
+	}
+	m.maxTotal = max(m.maxTotal, total)
+	if m.streamDir != "" {
+		m.streams, m.streamsErr = queue.List(m.streamDir)
+	}
+}
+
+// Render draws one frame, starting from the top-left corner.
+func (m *Monitor) Render(w io.Writer, width int) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "OMS queue monitor  %s  (Ctrl+C to quit)\n\n", m.lastTime.Format("15:04:05"))
+
+	if m.recordErr != nil {
+		fmt.Fprintf(&b, "Recording stopped: %v\n\n", m.recordErr)
+	}
+	writeTable(&b, m.series, m.maxTotal)
+	if len(m.series) <= maxGauges {
+		gaugeWidth := max(width-50, 10)
+		for _, s := range m.series {
+			depth, capacity := s.target.Q.Depth(), s.target.Q.Capacity()
+			fill := float64(depth) / float64(capacity)
+			fmt.Fprintf(&b, "%-10s %s %5.1f%%  %d/%d (max %d)\n",
+				s.target.Name, gauge(fill, gaugeWidth), fill*100, depth, capacity, s.maxDepth)
+			fmt.Fprintf(&b, "%-10s %s\n\n", "", sparkline(s.rates))
+		}
+	}
+
+	for _, s := range m.series {
+		recent := s.target.Q.Recent(recentSlots)
+		if s.target.Status {
+			writeRejects(&b, s.target.Name, recent)
+		} else {
+			writeTopSymbols(&b, s.target.Name, recent)
+		}
+	}
+	if m.streamDir != "" {
+		writeStreams(&b, m.streamDir, m.streams, m.streamsErr)
+	}
+	io.WriteString(w, b.String())
+}
+
+// Run samples and redraws every interval until ctx is done, then restores
+// the cursor.
+func (m *Monitor) Run(ctx context.Context, w io.Writer, interval time.Duration, width int) error {
+	io.WriteString(w, "\x1b[?25l")
+	defer io.WriteString(w, "\x1b[?25h\n")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			m.Sample(now)
+			m.Render(w, width)
+		}
+	}
+}
+
+// writeTable writes a row per queue and, for more than one, their total.
+// Lag is the orders waiting; drain is how long the consumer takes to clear
+// them at its current rate.
+func writeTable(b *strings.Builder, series []*series, maxTotal uint64) {
+	nameWidth := len("total")
+	for _, s := range series {
+		nameWidth = max(nameWidth, len(s.target.Name))
+	}
+	row := func(name string, depth, capacity, maxDepth uint64, in, out float64) {
+		fmt.Fprintf(b, "%-*s %10d %6.1f%% %12.0f %12.0f %10d %10s\n", nameWidth, name,
+			depth, float64(depth)/float64(max(capacity, 1))*100, in, out, maxDepth, drain(depth, out))
+	}
+	fmt.Fprintf(b, "%-*s %10s %7s %12s %12s %10s %10s\n", nameWidth, "queue",
+		"lag", "fill", "in/s", "out/s", "max lag", "drain")
+	var depth, capacity uint64
+	var in, out float64
+	for _, s := range series {
+		d, c := s.target.Q.Depth(), s.target.Q.Capacity()
+		row(s.target.Name, d, c, s.maxDepth, s.inRate, s.outRate)
+		depth, capacity = depth+d, capacity+c
+		in, out = in+s.inRate, out+s.outRate
+	}
+	if len(series) > 1 {
+		row("total", depth, capacity, maxTotal, in, out)
+	}
+	b.WriteString("\n")
+}
+
+// drain is how long out orders a second takes to clear depth.
+func drain(depth uint64, out float64) string {
+	switch {
+	case depth == 0:
+		return "-"
+	case out <= 0:
+		return "stalled"
+	}
+	return time.Duration(float64(depth) / out * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+func writeTopSymbols(b *strings.Builder, name string, recent []queue.Order) {
+	counts := make(map[uint32]int)
+	for _, o := range recent {
+		if !o.IsControl() {
+			counts[o.Symbol]++
+		}
+	}
+	symbols := make([]uint32, 0, len(counts))
+	for sym := range counts {
+		symbols = append(symbols, sym)
+	}
+	slices.SortFunc(symbols, func(a, b uint32) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	fmt.Fprintf(b, "Top symbols (%s, last %d):", name, len(recent))
+	for _, sym := range symbols[:min(topSymbols, len(symbols))] {
+		fmt.Fprintf(b, "  %d:%d", sym, counts[sym])
+	}
+	b.WriteString("\n")
+}
+
+func writeRejects(b *strings.Builder, name string, recent []queue.Order) {
+	fmt.Fprintf(b, "Recent rejects (%s):\n", name)
+	shown := 0
+	for i := len(recent) - 1; i >= 0 && shown < maxRejects; i-- {
+		if o := recent[i]; o.Status == queue.StatusRejected {
+			fmt.Fprintf(b, "  order %d client %d symbol %d %d@%d %s\n",
+				o.OrderID, o.ClientID, o.Symbol, o.Quantity, o.Price, queue.ReasonName(o.Reason))
+			shown++
+		}
+	}
+	if shown == 0 {
+		b.WriteString("  none\n")
+	}
+}
+
+func writeStreams(b *strings.Builder, dir string, streams []queue.StreamInfo, err error) {
+	fmt.Fprintf(b, "\nStreams in %s:\n", dir)
+	if err != nil {
+		fmt.Fprintf(b, "  %v\n", err)
+		return
+	}
+	if len(streams) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, s := range streams {
+		pids := "-"
+		if len(s.PIDs) > 0 {
+			pids = strings.Trim(fmt.Sprint(s.PIDs), "[]")
+		} else if s.InUse {
+			pids = "?"
+		}
+		fmt.Fprintf(b, "  %-16s %-7s %7d/%-7d pids %s", s.Name, s.Meta.Kind, s.Stats.Depth, s.Stats.Capacity, pids)
+		if !s.Meta.Created.IsZero() {
+			fmt.Fprintf(b, "  since %s", s.Meta.Created.Local().Format("Jan 2 15:04:05"))
+		}
+		if s.Err != nil {
+			fmt.Fprintf(b, "  (%v)", s.Err)
+		}
+		b.WriteString("\n")
+	}
+}
+
+func gauge(fill float64, width int) string {
+	filled := min(int(fill*float64(width)+0.5), width)
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("·", width-filled) + "]"
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+func sparkline(values []float64) string {
+	peak := 0.0
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	out := make([]rune, len(values))
+	for i, v := range values {
+		idx := 0
+		if peak > 0 {
+			idx = int(v / peak * float64(len(sparks)-1))
+		}
+		out[i] = sparks[idx]
+	}
+	return string(out)
+}
@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestCombinedTable(t *testing.T) {
+	var targets []Target
+	var rings []*queue.MemQueue
+	for _, name := range []string{"shard-1", "shard-1_status", "shard-2", "shard-2_status", "shard-3"} {
+		q := queue.NewInMemory(100)
+		rings = append(rings, q)
+		targets = append(targets, Target{Name: name, Q: memSource{q}, Status: strings.HasSuffix(name, "_status")})
+	}
+	m := New(targets...)
+	for i := range 30 {
+		rings[0].Enqueue(queue.Order{OrderID: uint64(i)})
+	}
+	for i := range 10 {
+		rings[2].Enqueue(queue.Order{OrderID: uint64(i)})
+	}
+	for range 10 {
+		rings[2].Dequeue()
+	}
+	m.Sample(m.lastTime.Add(time.Second))
+
+	var out strings.Builder
+	m.Render(&out, 100)
+	frame := out.String()
+	for _, want := range []string{
+		"shard-1                30   30.0%           30            0         30    stalled",
+		"shard-2                 0    0.0%           10           10          0          -",
+		"total                  30    6.0%           40           10         30         3s",
+	} {
+		if !strings.Contains(frame, want) {
+			t.Errorf("frame lacks %q:\n%s", want, frame)
+		}
+	}
+	if strings.Contains(frame, "█") || strings.Contains(frame, "·]") {
+		t.Errorf("gauges drawn for %d queues:\n%s", len(targets), frame)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	for _, c := range []struct {
+		depth uint64
+		out   float64
+		want  string
+	}{{0, 0, "-"}, {10, 0, "stalled"}, {500, 1000, "500ms"}} {
+		if got := drain(c.depth, c.out); got != c.want {
+			t.Errorf("drain(%d, %g) = %q, want %q", c.depth, c.out, got, c.want)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	q := queue.NewInMemory(100)
+	m := New(Target{Name: "orders", Q: memSource{q}})
+	var csv strings.Builder
+	m.Record(&csv)
+	for i := range 20 {
+		q.Enqueue(queue.Order{OrderID: uint64(i)})
+	}
+	for range 5 {
+		q.Dequeue()
+	}
+	at := m.lastTime.Add(2 * time.Second)
+	m.Sample(at)
+	m.Sample(at.Add(time.Second))
+	want := "time,queue,head,tail,lag,capacity,in_rate,out_rate\n" +
+		at.Format(time.RFC3339Nano) + ",orders,20,5,15,100,10.0,2.5\n" +
+		at.Add(time.Second).Format(time.RFC3339Nano) + ",orders,20,5,15,100,0.0,0.0\n"
+	if csv.String() != want {
+		t.Errorf("recorded:\n%s\nwant:\n%s", csv.String(), want)
+	}
+}
+
+// memSource adds the Recent a MemQueue lacks.
+type memSource struct{ *queue.MemQueue }
+
+func (memSource) Recent(int) []queue.Order { return nil }
+
+// racing is a ring both sides of which move on by step orders between any
+// two reads, as a busy producer and consumer do between two loads.
+type racing struct {
+	head, tail, step uint64
+}
+
+func (r *racing) ProducerHead() uint64     { r.head += r.step; r.tail += r.step; return r.head }
+func (r *racing) ConsumerTail() uint64     { r.head += r.step; r.tail += r.step; return r.tail }
+func (r *racing) Depth() uint64            { return r.head - r.tail }
+func (r *racing) Capacity() uint64         { return 100 }
+func (r *racing) Recent(int) []queue.Order { return nil }
+
+func TestSampleRacingRing(t *testing.T) {
+	r := &racing{head: 50, tail: 0, step: 80}
+	m := New(Target{Name: "orders", Q: r})
+	m.Sample(m.lastTime.Add(time.Second))
+	m.Sample(m.lastTime.Add(time.Second))
+	if s := m.series[0]; s.maxDepth > 100 || m.maxTotal > 100 {
+		t.Fatalf("max depth %d, total %d past the capacity", s.maxDepth, m.maxTotal)
+	}
+}
@@ -0,0 +1,235 @@
+// Package orderfile parses order scenarios authored as CSV or JSON, for
+// tools that load test flows into the queue.
+package orderfile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"oms/queue"
+)
+
+// Record is one order as written in a file. Symbol is a ticker or a numeric
+// symbol id; Side is "buy"/"sell"; TIF is "gtc" (default), "gtd" or "gtt".
+// Account is optional and left to an enrichment pipeline to resolve.
+// Flags lists execution instructions joined by "|", e.g. "post_only|hidden".
+// ActivateAt (unix nanos) holds the order back until then; 0 sends it now.
+type Record struct {
+	OrderID  uint64 `json:"order_id"`
+	ClientID uint32 `json:"client_id"`
+	Account  string `json:"account"`
+	Symbol   string `json:"symbol"`
+	Side     string `json:"side"`
+	Quantity uint32 `json:"qty"`
+	Price    uint64 `json:"price"`
+	TIF      string `json:"tif"`
+	ExpireAt uint64 `json:"expire_at"`
+	Flags    string `json:"flags"`
+
+	ActivateAt uint64 `json:"activate_at"`
+}
+
+// Row is a parsed record with its source line, or the reason it was rejected.
+type Row struct {
+	Line   int
+	Record Record
+	Err    error
+}
+
+// Format is the file encoding.
+type Format int
+
+const (
+	CSV Format = iota
+	JSON
+	JSONLines
+)
+
+// FormatOf picks the format from the file extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV, nil
+	case ".json":
+		return JSON, nil
+	case ".jsonl", ".ndjson":
+		return JSONLines, nil
+	}
+	return 0, fmt.Errorf("unknown order file extension %q", filepath.Ext(path))
+}
+
+// Read parses every record. Malformed rows come back with Err set rather than
+// aborting the file; only an unreadable file returns an error.
+func Read(r io.Reader, format Format) ([]Row, error) {
+	switch format {
+	case CSV:
+		return readCSV(r)
+	case JSON:
+		return readJSON(r)
+	case JSONLines:
+		var rows []Row
+		dec := json.NewDecoder(r)
+		for line := 1; ; line++ {
+			var rec Record
+			err := dec.Decode(&rec)
+			if errors.Is(err, io.EOF) {
+				return rows, nil
+			}
+			if _, syntax := err.(*json.SyntaxError); syntax {
+				return rows, fmt.Errorf("line %d: %w", line, err)
+			}
+			rows = append(rows, Row{Line: line, Record: rec, Err: err})
+		}
+	}
+	return nil, fmt.Errorf("unknown format %d", format)
+}
+
+// readJSON reads an array of records one element at a time, so a record
+// of the wrong shape only fails its own row. Line is the element's place in
+// the array, from 1. Only a file that is not a JSON array is an error.
+func readJSON(r io.Reader) ([]Row, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("invalid JSON order file: want an array of orders")
+	}
+	var rows []Row
+	for line := 1; dec.More(); line++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return rows, fmt.Errorf("invalid JSON order file: element %d: %w", line, err)
+		}
+		var rec Record
+		err := json.Unmarshal(raw, &rec)
+		rows = append(rows, Row{Line: line, Record: rec, Err: err})
+	}
+	if _, err := dec.Token(); err != nil {
+		return rows, fmt.Errorf("invalid JSON order file: %w", err)
+	}
+	return rows, nil
+}
+
+// readCSV expects a header row naming the columns; order_id, account, tif,
+// expire_at, flags and activate_at are optional.
+func readCSV(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing CSV header: %w", err)
+	}
+	col := make(map[string]int)
+	for i, name := range header {
+		col[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"client_id", "symbol", "side", "qty", "price"} {
+		if _, ok := col[required]; !ok {
+			return nil, fmt.Errorf("CSV header missing column %q", required)
+		}
+	}
+
+	var rows []Row
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			rows = append(rows, Row{Line: line, Err: err})
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := col[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		var errs []error
+		num := func(name string, bits int) uint64 {
+			s := field(name)
+			if s == "" {
+				return 0
+			}
+			v, err := strconv.ParseUint(s, 10, bits)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			return v
+		}
+		row := Row{Line: line, Record: Record{
+			OrderID:  num("order_id", 64),
+			ClientID: uint32(num("client_id", 32)),
+			Account:  field("account"),
+			Symbol:   field("symbol"),
+			Side:     field("side"),
+			Quantity: uint32(num("qty", 32)),
+			Price:    num("price", 64),
+			TIF:      field("tif"),
+			ExpireAt: num("expire_at", 64),
+			Flags:    field("flags"),
+
+			ActivateAt: num("activate_at", 64),
+		}}
+		row.Err = errors.Join(errs...)
+		rows = append(rows, row)
+	}
+}
+
+// Order converts a record, resolving the symbol with resolve.
+func (rec Record) Order(resolve func(string) (uint32, error)) (queue.Order, error) {
+	symbol, err := resolve(rec.Symbol)
+	if err != nil {
+		return queue.Order{}, err
+	}
+	order := queue.Order{
+		OrderID:  rec.OrderID,
+		ClientID: rec.ClientID,
+		Symbol:   symbol,
+		Quantity: rec.Quantity,
+		Price:    rec.Price,
+		ExpireAt: rec.ExpireAt,
+	}
+	switch strings.ToLower(rec.Side) {
+	case "buy", "b", "0":
+		order.Side = 0
+	case "sell", "s", "1":
+		order.Side = 1
+	default:
+		return queue.Order{}, fmt.Errorf("invalid side %q", rec.Side)
+	}
+	switch strings.ToLower(rec.TIF) {
+	case "", "gtc":
+		order.TimeInForce = queue.TIFGoodTillCancel
+	case "gtd":
+		order.TimeInForce = queue.TIFGoodTillDate
+	case "gtt":
+		order.TimeInForce = queue.TIFGoodTillTime
+	default:
+		return queue.Order{}, fmt.Errorf("invalid tif %q", rec.TIF)
+	}
+	if order.TimeInForce != queue.TIFGoodTillCancel && order.ExpireAt == 0 {
+		return queue.Order{}, fmt.Errorf("tif %s needs expire_at", rec.TIF)
+	}
+	if order.Flags, err = queue.ParseFlags(rec.Flags); err != nil {
+		return queue.Order{}, err
+	}
+	if err := order.ValidateFlags(); err != nil {
+		return queue.Order{}, err
+	}
+	return order, nil
+}
+
+// NumericSymbol resolves symbols written as plain numeric ids, for files
+// used without refdata.
+func NumericSymbol(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("symbol %q is not a numeric id (pass --refdata to use tickers)", s)
+	}
+	return uint32(v), nil
+}
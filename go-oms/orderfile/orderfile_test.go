@@ -0,0 +1,102 @@
+package orderfile
+
+import (
+	"strings"
+	"testing"
+
+	"oms/queue"
+)
+
+func TestReadCSV(t *testing.T) {
+	in := `client_id, symbol, side, qty, price, tif, expire_at, flags
+7,1,buy,10,100,,,
+7,2,sell,x,101,,,
+8,3,s,5,99,gtd,9000,post_only
+`
+	rows, err := Read(strings.NewReader(in), CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if r := rows[0]; r.Err != nil || r.Line != 2 || r.Record.ClientID != 7 || r.Record.Quantity != 10 || r.Record.Side != "buy" {
+		t.Errorf("row 1: %+v", r)
+	}
+	if r := rows[1]; r.Err == nil || r.Line != 3 || !strings.Contains(r.Err.Error(), "qty") {
+		t.Errorf("row 2: want a qty error, got %+v", r)
+	}
+	if r := rows[2]; r.Err != nil || r.Record.ExpireAt != 9000 || r.Record.TIF != "gtd" {
+		t.Errorf("row 3: %+v", r)
+	}
+
+	o, err := rows[2].Record.Order(NumericSymbol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Symbol != 3 || o.Side != 1 || o.TimeInForce != queue.TIFGoodTillDate || o.ExpireAt != 9000 || o.Flags == 0 {
+		t.Errorf("order %+v", o)
+	}
+
+	if _, err := Read(strings.NewReader("client_id,symbol\n"), CSV); err == nil {
+		t.Error("header without qty, side and price accepted")
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	in := `[
+		{"client_id": 7, "symbol": "1", "side": "buy", "qty": 10, "price": 100},
+		{"client_id": 7, "symbol": "2", "side": "sell", "qty": "ten", "price": 101},
+		{"client_id": 8, "symbol": "3", "side": "sell", "qty": 5, "price": 99}
+	]`
+	rows, err := Read(strings.NewReader(in), JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if r := rows[0]; r.Err != nil || r.Line != 1 || r.Record.Quantity != 10 {
+		t.Errorf("element 1: %+v", r)
+	}
+	if r := rows[1]; r.Err == nil || r.Line != 2 {
+		t.Errorf("element 2: want an error, got %+v", r)
+	}
+	if r := rows[2]; r.Err != nil || r.Line != 3 || r.Record.ClientID != 8 {
+		t.Errorf("element 3: %+v", r)
+	}
+
+	for _, bad := range []string{`{"client_id": 7}`, `[{"client_id": 7}, {`} {
+		if _, err := Read(strings.NewReader(bad), JSON); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestReadJSONLines(t *testing.T) {
+	in := `{"client_id": 7, "symbol": "1", "side": "buy", "qty": 10, "price": 100}
+{"client_id": 7, "symbol": "2", "side": "sell", "qty": -1, "price": 101}
+{"client_id": 8, "symbol": "3", "side": "sell", "qty": 5, "price": 99}
+`
+	rows, err := Read(strings.NewReader(in), JSONLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Err != nil || rows[1].Err == nil || rows[2].Err != nil || rows[2].Record.ClientID != 8 {
+		t.Fatalf("rows %+v", rows)
+	}
+}
+
+func TestRecordOrder(t *testing.T) {
+	for _, rec := range []Record{
+		{Symbol: "AAPL", Side: "buy"},
+		{Symbol: "1", Side: "hold"},
+		{Symbol: "1", Side: "buy", TIF: "ioc"},
+		{Symbol: "1", Side: "buy", TIF: "gtt"},
+		{Symbol: "1", Side: "buy", Flags: "nonsense"},
+	} {
+		if _, err := rec.Order(NumericSymbol); err == nil {
+			t.Errorf("%+v converted", rec)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Package orderid hands out OrderIDs that survive producer restarts. The
+// tracker and the engine key orders by id, so a producer that restarts at 1
+// makes them treat a new order as an old one.
+//
+// The allocator persists a high-water mark ahead of the ids it issues,
+// reserving a block per disk write. A crash skips at most one block; it
+// never reissues an id.
+package orderid
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultReserve is the number of ids reserved per state file write.
+const DefaultReserve = 4096
+
+// StatePath is where producers on queuePath keep their id state.
+func StatePath(queuePath string) string {
+	return queuePath + "_ids"
+}
+
+// Allocator issues increasing ids backed by a state file.
+type Allocator struct {
+	mu       sync.Mutex
+	path     string
+	reserve  uint64
+	next     uint64 // next id to issue
+	reserved uint64 // ids below this are covered by the state file
+}
+
+// Open loads the state file at path, creating it if missing. Ids start at
+// the persisted mark or floor, whichever is higher, so a producer can keep
+// a time-seeded floor while the file is new.
+func Open(path string, floor uint64) (*Allocator, error) {
+	if floor == 0 {
+		floor = 1
+	}
+	a := &Allocator{path: path, reserve: DefaultReserve, next: floor}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		mark, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt order id state %s: %w", path, err)
+		}
+		a.next = max(a.next, mark)
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read order id state: %w", err)
+	}
+
+	a.reserved = a.next
+	return a, nil
+}
+
+// Next returns the next id, writing a new high-water mark first whenever
+// the reserved block is used up.
+func (a *Allocator) Next() (uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.next >= a.reserved {
+		if err := a.persist(a.next + a.reserve); err != nil {
+			return 0, err
+		}
+		a.reserved = a.next + a.reserve
+	}
+	id := a.next
+	a.next++
+	return id, nil
+}
+
+// Close records the exact next id so a clean shutdown skips nothing.
+func (a *Allocator) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.persist(a.next); err != nil {
+		return err
+	}
+	a.reserved = a.next
+	return nil
+}
+
+// persist replaces the state file atomically: write a temp file, fsync it,
+// rename over the old one, then fsync the directory so the rename sticks.
+func (a *Allocator) persist(mark uint64) error {
+	tmp := a.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write order id state: %w", err)
+	}
+	_, err = f.WriteString(strconv.FormatUint(mark, 10) + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, a.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write order id state: %w", err)
+	}
+	if dir, err := os.Open(filepath.Dir(a.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// The enqueue path must not allocate: at millions of orders per second any
+// garbage turns into GC pauses, which show up as tail latency. These tests
+// gate that; the benchmarks report the same numbers with -benchmem.
+
+func assertNoAllocs(t *testing.T, name string, fn func()) {
+	t.Helper()
+	if n := testing.AllocsPerRun(1000, fn); n != 0 {
+		t.Errorf("%s: %.1f allocs per run, want 0", name, n)
+	}
+}
+
+func TestEnqueueZeroAlloc(t *testing.T) {
+	q, err := CreateQueue(filepath.Join(t.TempDir(), "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	mem := NewInMemory(4096)
+	order := Order{OrderID: 1, ClientID: 7, Symbol: 3, Quantity: 100, Price: 10000}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name string
+		q    OrderQueue
+	}{{"Queue", q}, {"MemQueue", mem}} {
+		assertNoAllocs(t, tc.name+" enqueue", func() { tc.q.Enqueue(order) })
+		assertNoAllocs(t, tc.name+" backoff enqueue", func() { DefaultBackoff.Enqueue(ctx, tc.q, order) })
+		drain(tc.q)
+	}
+
+	assertNoAllocs(t, "control helpers", func() {
+		mem.Enqueue(Cancel(1, 7, 1))
+		mem.Enqueue(CancelAll(2, 7, 1))
+	})
+	stamps := NewStamper(Coarse(64))
+	assertNoAllocs(t, "stamper", func() { stamps.Next() })
+
+	// a full ring is the case that spins, so its error must be free too
+	for int(q.Depth()) < QueueCapacity {
+		q.Enqueue(order)
+	}
+	for mem.Depth() < mem.Capacity() {
+		mem.Enqueue(order)
+	}
+	assertNoAllocs(t, "full Queue", func() { q.Enqueue(order) })
+	assertNoAllocs(t, "full MemQueue", func() { mem.Enqueue(order) })
+}
+
+// drain empties q without Dequeue, which hands out a copy and allocates.
+func drain(q OrderQueue) {
+	switch q := q.(type) {
+	case *Queue:
+		for q.Depth() > 0 {
+			q.Advance()
+		}
+	case *MemQueue:
+		q.tail.Store(q.head.Load())
+	}
+}
+
+func BenchmarkQueueEnqueue(b *testing.B) {
+	q, err := CreateQueue(filepath.Join(b.TempDir(), "queue"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer q.Close()
+	order := Order{OrderID: 1, Quantity: 100, Price: 10000}
+	b.ReportAllocs()
+	for b.Loop() {
+		if q.Enqueue(order) != nil {
+			b.StopTimer()
+			drain(q)
+			b.StartTimer()
+		}
+	}
+}
+
+func BenchmarkMemQueueEnqueue(b *testing.B) {
+	q := NewInMemory(1024)
+	order := Order{OrderID: 1, Quantity: 100, Price: 10000}
+	b.ReportAllocs()
+	for b.Loop() {
+		if q.Enqueue(order) != nil {
+			drain(q)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Every process that maps a queue writable claims an entry in the header's
+// Attached registry: its PID, when it attached and, once it has, whether it
+// publishes or consumes. Close frees the entry. A process that dies without
+// closing leaves its entry behind; like the owner of a robust futex, it is
+// found dead by the next process to attach, which frees the entry, and
+// until then tools report it as orphaned. The Rust engine registers the
+// same way. A dead PID reused before anyone reaps it looks alive.
+//
+// Each entry also records its process's PID namespace, in AttachedNS. The
+// PID of an attacher in another namespace, such as another container of a
+// pod sharing only the queue's volume, means nothing here: such an entry
+// is never reaped and is reported Foreign, alive as far as anyone here can
+// tell. An entry without a namespace, from a writer that predates it, is
+// taken to be in ours.
+
+// Attached is a registry entry as tools see it.
+type Attached struct {
+	PID   int
+	Roles uint32 // RoleProducer, RoleConsumer
+	Since time.Time
+	Alive bool // false for an orphan: the process died without closing
+	// Foreign is set for a process in another PID namespace, whose
+	// liveness cannot be checked; Alive is then true.
+	Foreign bool
+}
+
+// Orphan reports whether the process died without detaching.
+func (a Attached) Orphan() bool { return !a.Alive }
+
+func (a Attached) String() string {
+	roles := RoleString(a.Roles)
+	if roles == "" {
+		roles = "idle"
+	}
+	s := fmt.Sprintf("%d %s", a.PID, roles)
+	switch {
+	case !a.Alive:
+		s += " (dead)"
+	case a.Foreign:
+		s += " (other pid namespace)"
+	}
+	return s
+}
+
+// RoleString names the roles set in r, joined by "|", e.g.
+// "producer|consumer".
+func RoleString(r uint32) string {
+	var names []string
+	for i, name := range roleNames {
+		if r&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if rest := r &^ RolesKnown; rest != 0 {
+		names = append(names, fmt.Sprintf("0x%x", rest))
+	}
+	return strings.Join(names, "|")
+}
+
+// Attachments lists the registry entries in use, orphans included. A file
+// in a layout from before the registry has none.
+func (q *Queue) Attachments() []Attached {
+	if !q.layout.hasRegistry() {
+		return nil
+	}
+	var out []Attached
+	for i := range q.header.Attached {
+		a := &q.header.Attached[i]
+		pid := swap32(atomic.LoadUint32(&a.PID), q.swap)
+		if pid == 0 {
+			continue
+		}
+		foreign := q.foreign(i)
+		out = append(out, Attached{
+			PID:     int(pid),
+			Roles:   swap32(atomic.LoadUint32(&a.Roles), q.swap),
+			Since:   time.Unix(0, int64(swap64(atomic.LoadUint64(&a.AttachedAt), q.swap))),
+			Alive:   foreign || processAlive(pid),
+			Foreign: foreign,
+		})
+	}
+	return out
+}
+
+// Attachments lists the processes attached to the queue.
+func (r *ReadOnlyQueue) Attachments() []Attached { return r.q.Attachments() }
+
+// attach frees the entries of dead processes and claims one for this
+// queue. With every entry taken the queue works unregistered.
+func (q *Queue) attach() {
+	pid := uint32(os.Getpid())
+	for i := range q.header.Attached {
+		a := &q.header.Attached[i]
+		owner := atomic.LoadUint32(&a.PID)
+		if owner != 0 && !q.foreign(i) && !processAlive(owner) && atomic.CompareAndSwapUint32(&a.PID, owner, 0) {
+			owner = 0
+		}
+		if owner == 0 && q.entry == nil && atomic.CompareAndSwapUint32(&a.PID, 0, pid) {
+			atomic.StoreUint32(&q.header.AttachedNS[i].Inode, pidNamespace())
+			atomic.StoreUint32(&a.Roles, 0)
+			atomic.StoreUint64(&a.AttachedAt, uint64(time.Now().UnixNano()))
+			q.entry = a
+		}
+	}
+}
+
+// foreign reports whether registry entry i belongs to another PID
+// namespace than this process's. Unknown namespaces, either side's, are
+// taken to be the same.
+func (q *Queue) foreign(i int) bool {
+	ns := swap32(atomic.LoadUint32(&q.header.AttachedNS[i].Inode), q.swap)
+	self := pidNamespace()
+	return ns != 0 && self != 0 && ns != self
+}
+
+// pidNamespace is the inode of this process's PID namespace, 0 where
+// /proc does not show it.
+var pidNamespace = sync.OnceValue(func() uint32 {
+	info, err := os.Stat("/proc/self/ns/pid")
+	if err != nil {
+		return 0
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+	return uint32(st.Ino)
+})
+
+// markRole records role in the registry the first time the queue is used
+// for it; the callers check q.roles first, so the hot paths pay a branch.
+// q.roles is atomic because one handle may serve a producer and a consumer
+// goroutine at once.
+func (q *Queue) markRole(role uint32) {
+	atomic.OrUint32(&q.roles, role)
+	if q.entry != nil {
+		atomic.OrUint32(&q.entry.Roles, role)
+	}
+}
+
+// detach frees the queue's registry entry.
+func (q *Queue) detach() {
+	if q.entry != nil {
+		atomic.StoreUint32(&q.entry.PID, 0)
+		q.entry = nil
+	}
+}
+
+// processAlive reports whether pid exists, even if it belongs to another
+// user.
+func processAlive(pid uint32) bool {
+	err := syscall.Kill(int(pid), 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	producer, err := CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	consumer, err := OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.Enqueue(Order{OrderID: 1, Quantity: 1, Price: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumer.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+
+	view, err := OpenQueueReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Close()
+	got := view.Attachments()
+	if len(got) != 2 || got[0].Roles != RoleProducer || got[1].Roles != RoleConsumer {
+		t.Fatalf("attachments %v, want a producer and a consumer", got)
+	}
+	for _, a := range got {
+		if a.PID != os.Getpid() || !a.Alive || a.Since.IsZero() {
+			t.Fatalf("attachment %+v", a)
+		}
+	}
+	consumer.Close()
+	if got := view.Attachments(); len(got) != 1 || got[0].Roles != RoleProducer {
+		t.Fatalf("after the consumer closed: %v", got)
+	}
+
+	// a process that exited without closing leaves an orphan
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip(err)
+	}
+	producer.header.Attached[5].PID = uint32(cmd.Process.Pid)
+	got = view.Attachments()
+	if len(got) != 2 || !got[1].Orphan() || got[1].PID != cmd.Process.Pid {
+		t.Fatalf("attachments %v, want an orphan", got)
+	}
+	// which the next process to attach reaps
+	again, err := OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if got := view.Attachments(); len(got) != 2 || got[0].Orphan() || got[1].Orphan() {
+		t.Fatalf("attachments %v, want the orphan reaped", got)
+	}
+}
+
+func TestAttachmentsOtherNamespace(t *testing.T) {
+	if pidNamespace() == 0 {
+		t.Skip("no /proc/self/ns/pid")
+	}
+	path := filepath.Join(t.TempDir(), "queue")
+	q, err := CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip(err)
+	}
+	// a PID that is dead here, registered from another container
+	q.header.Attached[5].PID = uint32(cmd.Process.Pid)
+	q.header.AttachedNS[5].Inode = pidNamespace() + 1
+	got := q.Attachments()
+	if len(got) != 2 || !got[1].Foreign || got[1].Orphan() {
+		t.Fatalf("attachments %v, want a live foreign entry", got)
+	}
+	again, err := OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if got := q.Attachments(); len(got) != 3 || got[2].PID != cmd.Process.Pid {
+		t.Fatalf("attachments %v, want the foreign entry kept", got)
+	}
+
+	// an entry from before namespaces were recorded is taken to be ours
+	q.header.AttachedNS[5].Inode = 0
+	if got := q.Attachments(); !got[2].Orphan() || got[2].Foreign {
+		t.Fatalf("attachments %v, want an orphan", got)
+	}
+}
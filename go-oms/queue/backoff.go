@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+
+	"oms/cpu"
+)
+
+// Backoff tunes how a producer waits for space on a full ring: spin first,
+// then sleep with exponential backoff. The right numbers depend on the host.
+// A co-located benchmark with a pinned consumer wants a long spin and no
+// sleep (SpinBackoff); a shared production host wants a short spin that
+// gives the CPU back quickly (DefaultBackoff).
+type Backoff struct {
+	Spins      int           // retries spent busy-spinning before sleeping
+	Pause      bool          // issue a CPU pause hint (PAUSE/YIELD) per spin
+	YieldEvery int           // runtime.Gosched every N spins; 0 never yields
+	MaxSleep   time.Duration // cap of the doubling sleep after the spins; 0 keeps spinning
+}
+
+var (
+	// DefaultBackoff suits a shared host. The zero Backoff means this.
+	DefaultBackoff = Backoff{Spins: 128, Pause: true, YieldEvery: 16, MaxSleep: time.Millisecond}
+	// SpinBackoff never sleeps: lowest latency, one core burnt while full.
+	SpinBackoff = Backoff{Spins: 1 << 20, Pause: true}
+)
+
+// Enqueue retries q.Enqueue while the ring is full, waiting per b, until it
+// succeeds, fails with another error or ctx is done. On ctx expiry the
+// error wraps both ErrQueueFull and the context error.
+func (b Backoff) Enqueue(ctx context.Context, q OrderQueue, o Order) error {
+	if b == (Backoff{}) {
+		b = DefaultBackoff
+	}
+	var timer *time.Timer
+	for attempt := 0; ; attempt++ {
+		err := q.Enqueue(o)
+		if !errors.Is(err, ErrQueueFull) {
+			return err
+		}
+		if err := b.wait(ctx, attempt, &timer); err != nil {
+			return errors.Join(ErrQueueFull, err)
+		}
+	}
+}
+
+// EnqueueSeq is Enqueue for a queue that reports slot sequences; it
+// returns the sequence the order was published at.
+func (b Backoff) EnqueueSeq(ctx context.Context, q Sequencer, o Order) (uint64, error) {
+	if b == (Backoff{}) {
+		b = DefaultBackoff
+	}
+	var timer *time.Timer
+	for attempt := 0; ; attempt++ {
+		seq, err := q.EnqueueSeq(o)
+		if !errors.Is(err, ErrQueueFull) {
+			return seq, err
+		}
+		if err := b.wait(ctx, attempt, &timer); err != nil {
+			return 0, errors.Join(ErrQueueFull, err)
+		}
+	}
+}
+
+// step is what follows failed attempt: a spin, yielding every YieldEvery
+// of them, for the first Spins attempts, then a sleep doubling from a
+// microsecond up to MaxSleep.
+func (b Backoff) step(attempt int) (yield bool, sleep time.Duration) {
+	if attempt < b.Spins || b.MaxSleep <= 0 {
+		return b.YieldEvery > 0 && (attempt+1)%b.YieldEvery == 0, 0
+	}
+	return false, min(time.Microsecond<<min(attempt-b.Spins, 20), b.MaxSleep)
+}
+
+func (b Backoff) wait(ctx context.Context, attempt int, timer **time.Timer) error {
+	yield, d := b.step(attempt)
+	if d == 0 {
+		if b.Pause {
+			cpu.Relax()
+		}
+		if yield {
+			runtime.Gosched()
+		}
+		if attempt&63 == 63 {
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	if *timer == nil {
+		*timer = time.NewTimer(d)
+	} else {
+		(*timer).Reset(d)
+	}
+	select {
+	case <-ctx.Done():
+		(*timer).Stop()
+		return ctx.Err()
+	case <-(*timer).C:
+		return nil
+	}
+}
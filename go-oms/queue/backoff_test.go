@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoffSteps(t *testing.T) {
+	b := Backoff{Spins: 8, YieldEvery: 4, MaxSleep: 100 * time.Microsecond}
+	for attempt, want := range []struct {
+		yield bool
+		sleep time.Duration
+	}{
+		{false, 0}, {false, 0}, {false, 0}, {true, 0}, // spins, yielding every 4th
+		{false, 0}, {false, 0}, {false, 0}, {true, 0},
+		{false, time.Microsecond}, // then sleeps, doubling
+		{false, 2 * time.Microsecond},
+		{false, 4 * time.Microsecond},
+		{false, 8 * time.Microsecond},
+		{false, 16 * time.Microsecond},
+		{false, 32 * time.Microsecond},
+		{false, 64 * time.Microsecond},
+		{false, 100 * time.Microsecond}, // up to MaxSleep
+		{false, 100 * time.Microsecond},
+	} {
+		yield, sleep := b.step(attempt)
+		if yield != want.yield || sleep != want.sleep {
+			t.Errorf("attempt %d: yield %v, sleep %v; want %v, %v", attempt, yield, sleep, want.yield, want.sleep)
+		}
+	}
+	// the shift is capped, so far attempts still sleep MaxSleep
+	if _, sleep := b.step(1 << 30); sleep != b.MaxSleep {
+		t.Errorf("attempt 1<<30: sleep %v, want %v", sleep, b.MaxSleep)
+	}
+}
+
+func TestSpinBackoffNeverSleeps(t *testing.T) {
+	for _, attempt := range []int{0, 1, SpinBackoff.Spins - 1, SpinBackoff.Spins, 1 << 30} {
+		if yield, sleep := SpinBackoff.step(attempt); yield || sleep != 0 {
+			t.Errorf("attempt %d: yield %v, sleep %v; want a bare spin", attempt, yield, sleep)
+		}
+	}
+}
+
+// countingFull is a ring that is always full, counting attempts.
+type countingFull struct {
+	OrderQueue
+	attempts int
+}
+
+func (q *countingFull) Enqueue(Order) error {
+	q.attempts++
+	return ErrQueueFull
+}
+
+func TestBackoffEnqueueDeadline(t *testing.T) {
+	for name, b := range map[string]Backoff{"zero": {}, "default": DefaultBackoff, "spin": SpinBackoff} {
+		q := &countingFull{OrderQueue: NewInMemory(1)}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := b.Enqueue(ctx, q, Order{OrderID: 1})
+		cancel()
+		if !errors.Is(err, ErrQueueFull) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: got %v, want ErrQueueFull and DeadlineExceeded", name, err)
+		}
+		// the zero Backoff is DefaultBackoff: it sleeps after its spins
+		// rather than spinning out the whole deadline
+		if name != "spin" && q.attempts > 1000 {
+			t.Errorf("%s: %d attempts in 20ms, want DefaultBackoff's few hundred", name, q.attempts)
+		}
+	}
+}
+
+func TestBackoffEnqueueLands(t *testing.T) {
+	q := NewInMemory(1)
+	q.Enqueue(Order{OrderID: 1})
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		q.Dequeue()
+	}()
+	if err := DefaultBackoff.Enqueue(context.Background(), q, Order{OrderID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := q.Dequeue(); o == nil || o.OrderID != 2 {
+		t.Fatalf("got %+v, want order 2", o)
+	}
+}
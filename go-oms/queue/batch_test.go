@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDequeueUpTo(t *testing.T) {
+	q, err := CreateQueue(filepath.Join(t.TempDir(), "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	mem := NewInMemory(16)
+
+	for _, tc := range []struct {
+		name string
+		q    interface {
+			OrderQueue
+			DequeueUpTo(int, []Order) ([]Order, error)
+		}
+	}{{"Queue", q}, {"MemQueue", mem}} {
+		for i := uint64(1); i <= 10; i++ {
+			tc.q.Enqueue(Order{OrderID: i})
+		}
+		buf := make([]Order, 0, 16)
+		got, err := tc.q.DequeueUpTo(4, buf)
+		if err != nil || len(got) != 4 || got[0].OrderID != 1 || got[3].OrderID != 4 {
+			t.Fatalf("%s: first batch %v %v", tc.name, got, err)
+		}
+		got, err = tc.q.DequeueUpTo(16, got[:0])
+		if err != nil || len(got) != 6 || got[0].OrderID != 5 || got[5].OrderID != 10 {
+			t.Fatalf("%s: second batch %v %v", tc.name, got, err)
+		}
+		if got, err = tc.q.DequeueUpTo(16, got[:0]); err != nil || len(got) != 0 || tc.q.Depth() != 0 {
+			t.Fatalf("%s: empty ring gave %v %v", tc.name, got, err)
+		}
+		tc.q.Enqueue(Order{OrderID: 11})
+		if n := testing.AllocsPerRun(100, func() { tc.q.DequeueUpTo(16, buf[:0]) }); n != 0 {
+			t.Fatalf("%s: %.1f allocs per batch", tc.name, n)
+		}
+	}
+}
+
+func TestDequeueUpToStopsAtCorruptOrder(t *testing.T) {
+	q, err := CreateQueue(filepath.Join(t.TempDir(), "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.Enqueue(Order{OrderID: 1})
+	q.Enqueue(Order{OrderID: 2, Side: 9})
+	q.Enqueue(Order{OrderID: 3})
+
+	got, err := q.DequeueUpTo(8, nil)
+	if !errors.Is(err, ErrCorruptedOrder) || len(got) != 1 || got[0].OrderID != 1 {
+		t.Fatalf("got %v %v", got, err)
+	}
+	if q.Depth() != 2 {
+		t.Fatalf("corrupt slot consumed: depth %d", q.Depth())
+	}
+}
+
+// BenchmarkDequeue compares one-at-a-time Dequeue with DequeueUpTo on a ring
+// kept full, as a consumer catching up with a burst sees it.
+func BenchmarkDequeue(b *testing.B) {
+	q, err := CreateQueue(filepath.Join(b.TempDir(), "queue"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer q.Close()
+	refill := func() {
+		for q.Enqueue(Order{OrderID: 1}) == nil {
+		}
+	}
+
+	b.Run("single", func(b *testing.B) {
+		refill()
+		for b.Loop() {
+			if o, _ := q.Dequeue(); o == nil {
+				b.StopTimer()
+				refill()
+				b.StartTimer()
+			}
+		}
+	})
+	b.Run("batch64", func(b *testing.B) {
+		refill()
+		buf := make([]Order, 0, 64)
+		var n int
+		for b.Loop() {
+			// one batch per 64 iterations keeps ns/op per order
+			if n == 0 {
+				buf, _ = q.DequeueUpTo(64, buf[:0])
+				if n = len(buf); n == 0 {
+					b.StopTimer()
+					refill()
+					b.StartTimer()
+					continue
+				}
+			}
+			n--
+		}
+	})
+}
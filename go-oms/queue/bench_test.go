@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"oms/cpu"
+)
+
+// Microbenchmarks for queue internals, to weigh a change here without the
+// full omsbench harness:
+//
+//	go test ./queue -run '^$' -bench 'Capacity|PeekAdvance|SPSC' -benchmem
+//
+// The mmap ring's capacity is fixed by the layout shared with Rust, so
+// capacity sweeps use MemQueue, which shares its algorithm.
+
+var benchCapacities = []int{256, 4096, 65536, 1 << 20}
+
+// BenchmarkEnqueueCapacity enqueues into rings of growing size with the
+// consumer keeping them half full, so larger rings show their cache cost.
+func BenchmarkEnqueueCapacity(b *testing.B) {
+	order := Order{OrderID: 1, Quantity: 100, Price: 10000}
+	for _, capacity := range benchCapacities {
+		b.Run(fmt.Sprintf("cap=%d", capacity), func(b *testing.B) {
+			q := NewInMemory(capacity)
+			half := uint64(capacity / 2)
+			b.ReportAllocs()
+			for b.Loop() {
+				if q.Enqueue(order) != nil {
+					b.StopTimer()
+					q.tail.Store(q.head.Load() - half)
+					b.StartTimer()
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkPeekAdvance is the consumer path that handles an order before
+// releasing its slot, against plain Dequeue in BenchmarkDequeue.
+func BenchmarkPeekAdvance(b *testing.B) {
+	q, err := CreateQueue(filepath.Join(b.TempDir(), "queue"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer q.Close()
+	refill := func() {
+		for q.Enqueue(Order{OrderID: 1}) == nil {
+		}
+	}
+	refill()
+	var sum uint64
+	b.ReportAllocs()
+	for b.Loop() {
+		o, _ := q.Peek()
+		if o == nil {
+			b.StopTimer()
+			refill()
+			b.StartTimer()
+			continue
+		}
+		sum += o.OrderID
+		q.Advance()
+	}
+	_ = sum
+}
+
+// BenchmarkSPSC runs a real consumer on another goroutine and times the
+// producer. The consumer kinds set the contention: "spin" drains every
+// order at once, so both sides fight over the same cache lines; "batch64"
+// drains in batches and touches the tail index a 64th as often; "slow"
+// spends time per order, so the producer mostly meets a full ring. With
+// fewer than two CPUs the numbers measure the scheduler instead.
+func BenchmarkSPSC(b *testing.B) {
+	rings := []struct {
+		name string
+		new  func(b *testing.B) OrderQueue
+	}{
+		{"mmap", func(b *testing.B) OrderQueue {
+			q, err := CreateQueue(filepath.Join(b.TempDir(), "queue"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			return q
+		}},
+		{"mem", func(*testing.B) OrderQueue { return NewInMemory(QueueCapacity) }},
+	}
+	consumers := []struct {
+		name    string
+		consume func(q OrderQueue, stop *atomic.Bool)
+	}{
+		{"spin", func(q OrderQueue, stop *atomic.Bool) {
+			for !stop.Load() {
+				if o, _ := q.Dequeue(); o == nil {
+					cpu.Relax()
+				}
+			}
+		}},
+		{"batch64", func(q OrderQueue, stop *atomic.Bool) {
+			bq := q.(interface {
+				DequeueUpTo(int, []Order) ([]Order, error)
+			})
+			buf := make([]Order, 0, 64)
+			for !stop.Load() {
+				if buf, _ = bq.DequeueUpTo(64, buf[:0]); len(buf) == 0 {
+					cpu.Relax()
+				}
+			}
+		}},
+		{"slow", func(q OrderQueue, stop *atomic.Bool) {
+			for !stop.Load() {
+				if o, _ := q.Dequeue(); o != nil {
+					for range 32 {
+						cpu.Relax()
+					}
+				}
+			}
+		}},
+	}
+
+	order := Order{OrderID: 1, Quantity: 100, Price: 10000}
+	for _, ring := range rings {
+		for _, consumer := range consumers {
+			b.Run(ring.name+"/"+consumer.name, func(b *testing.B) {
+				q := ring.new(b)
+				defer q.Close()
+				var stop atomic.Bool
+				done := make(chan struct{})
+				go func() {
+					consumer.consume(q, &stop)
+					close(done)
+				}()
+				var full uint64
+				for b.Loop() {
+					for q.Enqueue(order) != nil {
+						full++
+						cpu.Relax()
+					}
+				}
+				stop.Store(true)
+				<-done
+				b.ReportMetric(float64(full)/float64(b.N), "full/op")
+			})
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+)
+
+// ByteOrderMark is stored in the header by the producer in its native byte
+// order. A reader on a host with the opposite order sees 0x04030201.
+const ByteOrderMark uint32 = 0x01020304
+
+var ErrForeignByteOrder = errors.New("queue written with foreign byte order")
+
+// checkByteOrder reports whether the header mark needs swapping to be read on
+// this host. Foreign files are only accepted when allowForeign is set.
+func checkByteOrder(mark uint32, allowForeign bool) (bool, error) {
+	switch mark {
+	case ByteOrderMark:
+		return false, nil
+	case bits.ReverseBytes32(ByteOrderMark):
+		if !allowForeign {
+			return true, fmt.Errorf("%w (use OpenQueueForeign to replay it)", ErrForeignByteOrder)
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid byte order mark 0x%08X", mark)
+	}
+}
+
+func swap32(v uint32, swap bool) uint32 {
+	if swap {
+		return bits.ReverseBytes32(v)
+	}
+	return v
+}
+
+func swap64(v uint64, swap bool) uint64 {
+	if swap {
+		return bits.ReverseBytes64(v)
+	}
+	return v
+}
+
+// Swapped reports whether the queue was written with the opposite byte order.
+func (q *Queue) Swapped() bool {
+	return q.swap
+}
+
+// dequeueDecoded is the Dequeue path for foreign-order files and older
+// slot layouts: indices and slots are decoded on read and the tail is
+// written back in the file's order.
+func (q *Queue) dequeueDecoded() (*Order, error) {
+	producerHead := swap64(atomic.LoadUint64(&q.header.ProducerHead), q.swap)
+	consumerTail := swap64(atomic.LoadUint64(&q.header.ConsumerTail), q.swap)
+
+	if consumerTail == producerHead {
+		return nil, nil
+	}
+	if producerHead-consumerTail > QueueCapacity {
+		return nil, ErrCorruptedIndices
+	}
+
+	order := q.slot(consumerTail)
+	if order.Side > 1 {
+		return nil, ErrCorruptedOrder
+	}
+
+	if !ackDropped(consumerTail) {
+		atomic.StoreUint64(&q.header.ConsumerTail, swap64(consumerTail+1, q.swap))
+	}
+	return &order, nil
+}
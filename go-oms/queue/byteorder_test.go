@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"errors"
+	"math/bits"
+	"testing"
+	"unsafe"
+)
+
+// writeForeignQueue lays out a queue file as a host with the opposite byte
+// order would have written it, with orders published and none consumed.
+func writeForeignQueue(t *testing.T, orders []Order) string {
+	t.Helper()
+	h := QueueHeader{
+		ProducerHead: bits.ReverseBytes64(uint64(len(orders))),
+		Magic:        bits.ReverseBytes32(QueueMagic),
+		Capacity:     bits.ReverseBytes32(QueueCapacity),
+		ByteOrder:    bits.ReverseBytes32(ByteOrderMark),
+	}
+	var slots []byte
+	for _, o := range orders {
+		swapped := SwapOrder(o)
+		slots = append(slots, unsafe.Slice((*byte)(unsafe.Pointer(&swapped)), OrderSize)...)
+	}
+	return writeQueueFile(t, unsafe.Slice((*byte)(unsafe.Pointer(&h)), HeaderSize), slots, 0)
+}
+
+func TestForeignByteOrder(t *testing.T) {
+	orders := []Order{
+		{OrderID: 0x0102030405060708, ClientID: 1001, Symbol: 3, Quantity: 100, Price: 50000, Timestamp: 1700000000000000000},
+		{OrderID: 2, ClientID: 7, Symbol: 1 << 20, Side: 1, Quantity: 1 << 24, Price: 101, ExpireAt: 1, TimeInForce: TIFGoodTillTime, Fee: -3},
+	}
+	path := writeForeignQueue(t, orders)
+
+	if _, err := OpenQueue(path); !errors.Is(err, ErrForeignByteOrder) {
+		t.Fatalf("OpenQueue: got %v, want ErrForeignByteOrder", err)
+	}
+	q, err := OpenQueueForeign(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Swapped() || q.Depth() != 2 {
+		t.Fatalf("swapped %v depth %d, want a swapped queue holding 2", q.Swapped(), q.Depth())
+	}
+	for _, want := range orders {
+		if o, err := q.Dequeue(); err != nil || o == nil || *o != want {
+			t.Fatalf("got %+v %v, want %+v", o, err, want)
+		}
+	}
+	if o, err := q.Dequeue(); o != nil || err != nil {
+		t.Fatalf("drained queue gave %+v %v", o, err)
+	}
+	q.Close()
+
+	// the tail went back in the file's order, so the orders stay consumed
+	q, err = OpenQueueForeign(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if d := q.Depth(); d != 0 {
+		t.Fatalf("reopened with depth %d, want 0", d)
+	}
+}
@@ -0,0 +1,196 @@
+//go:build chaos
+
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Run with: go test -tags chaos -run TestChaos ./queue
+//
+// The consumer runs as a child process (this test binary re-executed) that
+// appends every order ID to a log before releasing its slot. The parent
+// SIGKILLs it at random points, checks the producer notices the stall, and
+// restarts it. At the end the log must hold every ID exactly once, in order.
+
+const (
+	chaosOrders = 200000
+	chaosKills  = 5
+)
+
+func TestChaosConsumerProcess(t *testing.T) {
+	queuePath := os.Getenv("CHAOS_QUEUE")
+	logPath := os.Getenv("CHAOS_LOG")
+	if queuePath == "" || logPath == "" {
+		t.Skip("helper process for TestChaosKillConsumer")
+	}
+
+	last, err := lastLoggedID(logPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	log, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	q, err := OpenQueue(queuePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	for {
+		order, err := q.Peek()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if order == nil {
+			runtime.Gosched()
+			continue
+		}
+		// killed after logging but before Advance last time: skip the replay
+		if order.OrderID > last {
+			if _, err := log.WriteString(strconv.FormatUint(order.OrderID, 10) + "\n"); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			last = order.OrderID
+		}
+		q.Advance()
+		if last == chaosOrders {
+			os.Exit(0)
+		}
+	}
+}
+
+// lastLoggedID returns the last order ID in the consumer log, or 0.
+func lastLoggedID(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(data[bytes.LastIndexByte(data, '\n')+1:]), 10, 64)
+}
+
+func startConsumer(t *testing.T, queuePath, logPath string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestChaosConsumerProcess$")
+	cmd.Env = append(os.Environ(), "CHAOS_QUEUE="+queuePath, "CHAOS_LOG="+logPath)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start consumer: %v", err)
+	}
+	return cmd
+}
+
+func TestChaosKillConsumer(t *testing.T) {
+	dir := t.TempDir()
+	queuePath := filepath.Join(dir, "queue")
+	logPath := filepath.Join(dir, "consumed.log")
+
+	q, err := CreateQueue(queuePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	var stalls atomic.Int64
+	producerDone := make(chan struct{})
+	go func() {
+		defer close(producerDone)
+		detector := NewStallDetector(q, 50*time.Millisecond)
+		stalled := false
+		for id := uint64(1); id <= chaosOrders; {
+			if err := q.Enqueue(Order{OrderID: id, Quantity: 1, Price: 1}); err == nil {
+				id++
+				continue
+			} else if !errors.Is(err, ErrQueueFull) {
+				t.Errorf("enqueue %d: %v", id, err)
+				return
+			}
+			now := detector.Stalled(time.Now())
+			if now && !stalled {
+				stalls.Add(1)
+			}
+			stalled = now
+			runtime.Gosched()
+		}
+	}()
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for kill := range chaosKills {
+		cmd := startConsumer(t, queuePath, logPath)
+		time.Sleep(time.Duration(10+rng.Intn(90)) * time.Millisecond)
+		if err := cmd.Process.Kill(); err != nil {
+			t.Fatalf("kill %d: %v", kill, err)
+		}
+		_ = cmd.Wait()
+
+		// a dead consumer with orders waiting must be noticed by the producer,
+		// unless the producer already finished and is no longer sampling
+		before := stalls.Load()
+		deadline := time.Now().Add(5 * time.Second)
+	wait:
+		for q.Depth() > 0 && stalls.Load() == before {
+			select {
+			case <-producerDone:
+				break wait
+			default:
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("kill %d: producer did not detect stall (depth %d)", kill, q.Depth())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	cmd := startConsumer(t, queuePath, logPath)
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("final consumer: %v", err)
+	}
+	<-producerDone
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := uint64(1)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		got, err := strconv.ParseUint(scanner.Text(), 10, 64)
+		if err != nil {
+			t.Fatalf("bad log line %q", scanner.Text())
+		}
+		if got != want {
+			t.Fatalf("consumed order %d, want %d (lost or duplicated)", got, want)
+		}
+		want++
+	}
+	if want != chaosOrders+1 {
+		t.Fatalf("consumed %d orders, want %d", want-1, chaosOrders)
+	}
+	t.Logf("%d kills, %d stalls detected", chaosKills, stalls.Load())
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ErrQueueBusy is returned by Compact when the indices move while it
+// watches them, i.e. a producer or consumer is still attached.
+var ErrQueueBusy = errors.New("queue in use")
+
+// CompactStats describes one compaction.
+type CompactStats struct {
+	Live        uint64 // unconsumed orders kept, now in slots 0..Live-1
+	Dropped     uint64 // consumed orders discarded
+	BytesBefore int64  // disk space allocated to the file before
+	BytesAfter  int64  // and after
+}
+
+// Compact rewrites the queue file at path with only its unconsumed orders,
+// moved to the start of the ring, and the indices reset to tail 0, head
+// Live. Every other slot is left a hole in a sparse file, so a capture that
+// once ran deep goes back to the disk space its live orders need and
+// mapping it at a cold start faults in only those pages.
+//
+// Nothing may have the file mapped: the new file replaces the old one by
+// rename, so an attached process would go on with the old copy. Compact
+// watches the indices for settle first and returns ErrQueueBusy if they
+// move, but a process that is attached and idle cannot be detected. A file
+// in foreign byte order comes out in this host's order, and one in an older
+// build's layout in this build's, so OpenQueue takes it again. Given a stream
+// directory, Compact holds the stream's lock exclusively throughout, which
+// catches idle processes too.
+func Compact(path string, settle time.Duration) (CompactStats, error) {
+	var stats CompactStats
+	if IsStream(path) {
+		lock, err := lockStream(path, CreateOptions{}.withDefaults(), syscall.LOCK_EX)
+		if err != nil {
+			return stats, err
+		}
+		defer lock.Close()
+		path = filepath.Join(path, StreamDataFile)
+	}
+	q, err := OpenQueueForeign(path)
+	if err != nil {
+		return stats, err
+	}
+	defer q.Close()
+
+	head, tail := q.ProducerHead(), q.ConsumerTail()
+	time.Sleep(settle)
+	if q.ProducerHead() != head || q.ConsumerTail() != tail {
+		return stats, fmt.Errorf("%w: indices moved while settling", ErrQueueBusy)
+	}
+	live := make([]Order, head-tail)
+	for i := range live {
+		live[i] = q.slot(tail + uint64(i))
+	}
+	stats.Live, stats.Dropped = uint64(len(live)), tail
+
+	info, err := q.file.Stat()
+	if err != nil {
+		return stats, fmt.Errorf("failed to stat file: %w", err)
+	}
+	stats.BytesBefore = allocated(info)
+
+	tmp := path + ".compact"
+	if err := writeCompacted(tmp, info, live); err != nil {
+		os.Remove(tmp)
+		return stats, err
+	}
+	if q.ProducerHead() != head || q.ConsumerTail() != tail {
+		os.Remove(tmp)
+		return stats, fmt.Errorf("%w: indices moved while compacting", ErrQueueBusy)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return stats, fmt.Errorf("failed to replace queue file: %w", err)
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	if info, err := os.Stat(path); err == nil {
+		stats.BytesAfter = allocated(info)
+	}
+	return stats, nil
+}
+
+// writeCompacted creates a sparse queue file at path holding live from
+// slot 0, with the mode and ownership of the file described by like.
+func writeCompacted(path string, like os.FileInfo, live []Order) error {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, like.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+	if err := file.Chmod(like.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to chmod queue file: %w", err)
+	}
+	if st, ok := like.Sys().(*syscall.Stat_t); ok {
+		// keeps the group producers rely on; fails harmlessly for non-owners
+		file.Chown(int(st.Uid), int(st.Gid))
+	}
+	if err := file.Truncate(int64(TotalSize)); err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
+
+	header := QueueHeader{
+		ProducerHead: uint64(len(live)),
+		Magic:        QueueMagic,
+		Capacity:     QueueCapacity,
+		ByteOrder:    ByteOrderMark,
+	}
+	if _, err := file.WriteAt(unsafe.Slice((*byte)(unsafe.Pointer(&header)), HeaderSize), 0); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if len(live) > 0 {
+		slots := unsafe.Slice((*byte)(unsafe.Pointer(&live[0])), uintptr(len(live))*OrderSize)
+		if _, err := file.WriteAt(slots, int64(HeaderSize)); err != nil {
+			return fmt.Errorf("failed to write orders: %w", err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	return nil
+}
+
+// allocated is the disk space behind a file, which for a sparse queue is
+// less than its size.
+func allocated(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512
+	}
+	return info.Size()
+}
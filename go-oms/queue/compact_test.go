@@ -0,0 +1,55 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	q, err := CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// run the ring past a full lap, leaving 3 orders unconsumed
+	for id := uint64(1); id <= QueueCapacity+10; id++ {
+		if err := q.Enqueue(Order{OrderID: id, Quantity: 1, Price: 1}); err != nil {
+			drain(q)
+			q.Enqueue(Order{OrderID: id, Quantity: 1, Price: 1})
+		}
+	}
+	for q.Depth() > 3 {
+		q.Advance()
+	}
+	q.Close()
+	before, _ := os.Stat(path)
+
+	stats, err := Compact(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Live != 3 || stats.Dropped != QueueCapacity+7 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if stats.BytesAfter >= stats.BytesBefore {
+		t.Fatalf("compacted file not smaller on disk: %+v", stats)
+	}
+
+	q, err = OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.ConsumerTail() != 0 || q.ProducerHead() != 3 {
+		t.Fatalf("indices head=%d tail=%d, want 3 and 0", q.ProducerHead(), q.ConsumerTail())
+	}
+	for id := uint64(QueueCapacity + 8); id <= QueueCapacity+10; id++ {
+		if o, err := q.Dequeue(); err != nil || o == nil || o.OrderID != id {
+			t.Fatalf("got %+v %v, want order %d", o, err, id)
+		}
+	}
+	if after, _ := os.Stat(path); after.Mode() != before.Mode() {
+		t.Fatalf("mode %v, want %v", after.Mode(), before.Mode())
+	}
+}
@@ -0,0 +1,102 @@
+package queue
+
+// Cancel returns a control message cancelling one order. It carries the
+// target's OrderID and ClientID; the engine reports the order with
+// StatusCanceled if it was still resting, then acks the cancel.
+func Cancel(orderID uint64, clientID uint32, timestamp uint64) Order {
+	return Order{
+		OrderID:   orderID,
+		ClientID:  clientID,
+		Timestamp: timestamp,
+		MsgType:   MsgCancel,
+	}
+}
+
+// CancelAll returns a control message cancelling every open order of
+// clientID. The engine reports each cancelled order with StatusCanceled and
+// then echoes the control message with StatusAcked.
+func CancelAll(orderID uint64, clientID uint32, timestamp uint64) Order {
+	return Order{
+		OrderID:   orderID,
+		ClientID:  clientID,
+		Timestamp: timestamp,
+		MsgType:   MsgCancelAll,
+	}
+}
+
+// CancelAllSymbol is CancelAll for every open order in symbol, across clients.
+func CancelAllSymbol(orderID uint64, symbol uint32, timestamp uint64) Order {
+	return Order{
+		OrderID:   orderID,
+		Symbol:    symbol,
+		Timestamp: timestamp,
+		MsgType:   MsgCancelAllSymbol,
+	}
+}
+
+// ResendFrom returns the request a consumer posts on the status ring after
+// it detects a gap: the producer republishes every order it logged with
+// OrderID >= fromID. Order ids only increase, so they double as the sequence.
+// Resent orders are unchanged, so the consumer must drop ids it already has.
+// A producer logging through wal.Publisher answers it with AnswerResends.
+func ResendFrom(fromID uint64, timestamp uint64) Order {
+	return Order{
+		OrderID:   fromID,
+		Timestamp: timestamp,
+		MsgType:   MsgResend,
+	}
+}
+
+// Bust returns a control message reversing the fill of an erroneous trade.
+// Like Cancel it carries the filled order's OrderID and ClientID. The engine
+// reports the reversed fill with StatusBusted, carrying the quantity, price
+// and fee as originally filled, then acks the bust.
+func Bust(orderID uint64, clientID uint32, timestamp uint64) Order {
+	return Order{
+		OrderID:   orderID,
+		ClientID:  clientID,
+		Timestamp: timestamp,
+		MsgType:   MsgBust,
+	}
+}
+
+// Correct returns a control message replacing the fill of orderID with one
+// at price for quantity. The engine reports it as a bust of the original
+// fill (StatusBusted) followed by the replacement (StatusCorrected), so
+// consumers reverse one and apply the other, then acks the correction.
+func Correct(orderID uint64, clientID uint32, price uint64, quantity uint32, timestamp uint64) Order {
+	return Order{
+		OrderID:   orderID,
+		ClientID:  clientID,
+		Price:     price,
+		Quantity:  quantity,
+		Timestamp: timestamp,
+		MsgType:   MsgCorrect,
+	}
+}
+
+// IsControl reports whether o is a control message rather than an order.
+func (o *Order) IsControl() bool {
+	return o.MsgType != MsgNew
+}
+
+// Terminal reports whether a status record closes the order it refers to.
+// Busts and corrections amend a fill after the order closed and are not;
+// nor is a partial fill.
+func (o *Order) Terminal() bool {
+	switch o.Status {
+	case StatusFilled, StatusRejected, StatusExpired, StatusCanceled:
+		return true
+	}
+	return false
+}
+
+// IsTrade reports whether a status record carries a trade of an order: a
+// fill, a partial fill or a correction's replacement fill.
+func (o *Order) IsTrade() bool {
+	switch o.Status {
+	case StatusFilled, StatusPartial, StatusCorrected:
+		return o.MsgType == MsgNew
+	}
+	return false
+}
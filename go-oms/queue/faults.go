@@ -0,0 +1,99 @@
+//go:build queuefaults
+
+package queue
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+// Built with -tags queuefaults, every mmap-backed Queue in the process can
+// be made to misbehave on demand, so the layers above can exercise their
+// error handling deterministically:
+//
+//	go test -tags queuefaults ./...
+//
+// Release builds compile the hooks to nothing; see faults_off.go.
+
+// Faults describes what the queues get wrong. The zero value is a healthy
+// queue. Sequence numbers are ring positions: the producer head an order is
+// published at, or the consumer tail being released.
+type Faults struct {
+	// PublishDelay holds each Enqueue between writing its slot and
+	// publishing it, widening the window a consumer sees the old head in.
+	PublishDelay time.Duration
+	// DropAck reports whether releasing slots from a tail is lost:
+	// Dequeue, DequeueUpTo and Advance return as usual but leave the tail
+	// alone, so the same orders are delivered again. A redelivery asks
+	// again with the same tail; At answers each one once.
+	DropAck func(tail uint64) bool
+	// Corrupt reports whether Enqueue writes the slot at a head with a side
+	// no producer writes, so the consumer gets ErrCorruptedOrder.
+	Corrupt func(head uint64) bool
+	// MapError fails CreateQueue and OpenQueue at the mmap step.
+	MapError error
+}
+
+var faults atomic.Pointer[Faults]
+
+// InjectFaults applies f to every Queue until restore is called, which puts
+// back whatever was injected before. Tests injecting faults must not run in
+// parallel with tests that expect a healthy queue.
+func InjectFaults(f Faults) (restore func()) {
+	prev := faults.Swap(&f)
+	return func() { faults.Store(prev) }
+}
+
+// At returns a predicate for DropAck or Corrupt that is true once for each
+// of seqs.
+func At(seqs ...uint64) func(uint64) bool {
+	var mu sync.Mutex
+	pending := make(map[uint64]bool, len(seqs))
+	for _, s := range seqs {
+		pending[s] = true
+	}
+	return func(seq uint64) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if !pending[seq] {
+			return false
+		}
+		delete(pending, seq)
+		return true
+	}
+}
+
+// Every returns a predicate for Corrupt that is true for every nth head.
+// As a DropAck it would redeliver the same orders forever.
+func Every(n uint64) func(uint64) bool {
+	return func(seq uint64) bool { return (seq+1)%n == 0 }
+}
+
+func publishFault(slot *Order, head uint64) {
+	f := faults.Load()
+	if f == nil {
+		return
+	}
+	if f.Corrupt != nil && f.Corrupt(head) {
+		slot.Side = 0xFF
+	}
+	if f.PublishDelay > 0 {
+		time.Sleep(f.PublishDelay)
+	}
+}
+
+func ackDropped(tail uint64) bool {
+	f := faults.Load()
+	return f != nil && f.DropAck != nil && f.DropAck(tail)
+}
+
+func mapFile(file *os.File, prot int) (mmap.MMap, error) {
+	if f := faults.Load(); f != nil && f.MapError != nil {
+		return nil, f.MapError
+	}
+	return mmap.Map(file, prot, 0)
+}
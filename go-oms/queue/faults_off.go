@@ -0,0 +1,19 @@
+//go:build !queuefaults
+
+package queue
+
+import (
+	"os"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+// Without -tags queuefaults the fault hooks inline away.
+
+func publishFault(*Order, uint64) {}
+
+func ackDropped(uint64) bool { return false }
+
+func mapFile(file *os.File, prot int) (mmap.MMap, error) {
+	return mmap.Map(file, prot, 0)
+}
@@ -0,0 +1,73 @@
+//go:build queuefaults
+
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Run with: go test -tags queuefaults ./queue
+
+func TestInjectedFaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	q, err := CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	restore := InjectFaults(Faults{Corrupt: At(1), DropAck: At(0, 2)})
+	for id := uint64(1); id <= 4; id++ {
+		if err := q.Enqueue(Order{OrderID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []uint64
+	for range 2 {
+		o, err := q.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, o.OrderID)
+	}
+	if got[0] != 1 || got[1] != 1 {
+		t.Fatalf("dequeued %v, want order 1 twice after its ack was dropped", got)
+	}
+	if _, err := q.Dequeue(); !errors.Is(err, ErrCorruptedOrder) {
+		t.Fatalf("slot 1: err = %v, want ErrCorruptedOrder", err)
+	}
+	q.Advance() // skip the corrupted slot
+	for range 2 {
+		if o, _ := q.Peek(); o == nil || o.OrderID != 3 {
+			t.Fatalf("peek = %+v, want order 3 until an ack lands", o)
+		}
+		q.Advance()
+	}
+	if o, _ := q.Peek(); o == nil || o.OrderID != 4 {
+		t.Fatalf("peek = %+v, want order 4", o)
+	}
+	restore()
+
+	restore = InjectFaults(Faults{PublishDelay: 20 * time.Millisecond})
+	start := time.Now()
+	if err := q.Enqueue(Order{OrderID: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("publish took %v, want at least the injected delay", d)
+	}
+	restore()
+
+	mapErr := errors.New("injected: cannot allocate memory")
+	restore = InjectFaults(Faults{MapError: mapErr})
+	defer restore()
+	if _, err := OpenQueue(path); !errors.Is(err, mapErr) {
+		t.Fatalf("open: err = %v, want the injected mmap error", err)
+	}
+	if _, err := CreateQueue(filepath.Join(t.TempDir(), "queue")); !errors.Is(err, mapErr) {
+		t.Fatalf("create: err = %v, want the injected mmap error", err)
+	}
+}
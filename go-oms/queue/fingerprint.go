@@ -0,0 +1,25 @@
+package queue
+
+// An order's fingerprint hashes the fields that say what its producer
+// asked for (see the fingerprint marks in schema.json) and leaves out the
+// send timestamp and what the engine writes back, so the same message
+// logged, resent or replayed fingerprints the same. The hash is 64-bit
+// FNV-1a over each field's little-endian bytes, which is simple enough to
+// write identically in every language that reads the ring: the Go method
+// and the C function are generated by gen_schema.go, the Rust one by
+// rust-me/build.rs. It is not cryptographic; anyone can forge a collision.
+const (
+	fingerprintBasis = 14695981039346656037
+	fingerprintPrime = 1099511628211
+)
+
+// fingerprintAdd hashes the low n bytes of v into h, least significant
+// first.
+func fingerprintAdd(h, v uint64, n int) uint64 {
+	for range n {
+		h ^= v & 0xff
+		h *= fingerprintPrime
+		v >>= 8
+	}
+	return h
+}
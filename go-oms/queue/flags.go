@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidFlags is returned by ValidateFlags and ParseFlags.
+var ErrInvalidFlags = NewReject(ReasonInvalidFlags, "invalid order flags")
+
+// SetFlag sets the flags in f.
+func (o *Order) SetFlag(f uint8) {
+	o.Flags |= f
+}
+
+// ClearFlag clears the flags in f.
+func (o *Order) ClearFlag(f uint8) {
+	o.Flags &^= f
+}
+
+// HasFlag reports whether every flag in f is set.
+func (o *Order) HasFlag(f uint8) bool {
+	return o.Flags&f == f
+}
+
+// ValidateFlags checks o.Flags against the order type. Control messages
+// carry no flags; post-only cannot be all-or-none, since a post-only order
+// never executes on arrival and the engine only holds all-or-none quantity
+// on the taking side. Short and short-exempt mark sells only, and at most
+// one of them.
+func (o *Order) ValidateFlags() error {
+	switch {
+	case o.Flags&^FlagsKnown != 0:
+		return fmt.Errorf("%w: unknown bits 0x%02x", ErrInvalidFlags, o.Flags&^FlagsKnown)
+	case o.Flags != 0 && o.IsControl():
+		return fmt.Errorf("%w: %s on a control message", ErrInvalidFlags, FlagString(o.Flags))
+	case o.HasFlag(FlagPostOnly | FlagAllOrNone):
+		return fmt.Errorf("%w: post_only with all_or_none", ErrInvalidFlags)
+	case o.Flags&(FlagShort|FlagShortExempt) != 0 && o.Side != 1:
+		return fmt.Errorf("%w: %s on a buy", ErrInvalidFlags, FlagString(o.Flags&(FlagShort|FlagShortExempt)))
+	case o.HasFlag(FlagShort | FlagShortExempt):
+		return fmt.Errorf("%w: short with short_exempt", ErrInvalidFlags)
+	}
+	return nil
+}
+
+// FlagString names the flags set in f, joined by "|", e.g. "post_only|hidden".
+func FlagString(f uint8) string {
+	var names []string
+	for i, name := range flagNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if rest := f &^ FlagsKnown; rest != 0 {
+		names = append(names, fmt.Sprintf("0x%02x", rest))
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseFlags is the inverse of FlagString for known flags. An empty string
+// is no flags.
+func ParseFlags(s string) (uint8, error) {
+	var f uint8
+	for _, name := range strings.Split(s, "|") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		i := slices.Index(flagNames[:], name)
+		if i < 0 {
+			return 0, fmt.Errorf("%w: unknown flag %q", ErrInvalidFlags, name)
+		}
+		f |= 1 << i
+	}
+	return f, nil
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func TestOrderLayout(t *testing.T) {
+	// must match rust-me/src/queue.rs
+	var o Order
+	if OrderSize != 64 || binary.Size(o) != 64 {
+		t.Fatalf("Order is %d bytes, %d encoded, want 64", OrderSize, binary.Size(o))
+	}
+	for name, off := range map[string][2]uintptr{
+		"Flags":          {unsafe.Offsetof(o.Flags), 48},
+		"Reason":         {unsafe.Offsetof(o.Reason), 49},
+		"Liquidity":      {unsafe.Offsetof(o.Liquidity), 50},
+		"Fee":            {unsafe.Offsetof(o.Fee), 52},
+		"ContraClientID": {unsafe.Offsetof(o.ContraClientID), 56},
+		"TriggerPrice":   {unsafe.Offsetof(o.TriggerPrice), 60},
+	} {
+		if off[0] != off[1] {
+			t.Errorf("%s at offset %d, want %d", name, off[0], off[1])
+		}
+	}
+}
+
+func TestFlags(t *testing.T) {
+	f, err := ParseFlags("post_only| Hidden")
+	if err != nil || f != FlagPostOnly|FlagHidden || FlagString(f) != "post_only|hidden" {
+		t.Fatalf("parse: %#x %v", f, err)
+	}
+	if _, err := ParseFlags("fill_or_kill"); !errors.Is(err, ErrInvalidFlags) {
+		t.Fatalf("unknown flag: %v", err)
+	}
+
+	o := Order{}
+	o.SetFlag(FlagReduceOnly | FlagAllOrNone)
+	o.ClearFlag(FlagAllOrNone)
+	if !o.HasFlag(FlagReduceOnly) || o.HasFlag(FlagAllOrNone) || o.ValidateFlags() != nil {
+		t.Fatalf("flags %s", FlagString(o.Flags))
+	}
+
+	if sell := (Order{Side: 1, Flags: FlagShort | FlagHidden}); sell.ValidateFlags() != nil {
+		t.Fatalf("short sell: %v", sell.ValidateFlags())
+	}
+
+	for name, bad := range map[string]Order{
+		"unknown bits": {Flags: 0x80},
+		"control":      {Flags: FlagHidden, MsgType: MsgCancelAll},
+		"post aon":     {Flags: FlagPostOnly | FlagAllOrNone},
+		"short buy":    {Flags: FlagShort},
+		"exempt buy":   {Flags: FlagShortExempt},
+		"short exempt": {Flags: FlagShort | FlagShortExempt, Side: 1},
+	} {
+		if err := bad.ValidateFlags(); !errors.Is(err, ErrInvalidFlags) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// TestSchemaGenerated catches a schema_gen.go or oms_queue.h left stale
+// after editing schema.json, which the Rust engine builds its side from
+// directly, and checks the C header compiles where a C compiler is at hand.
+func TestSchemaGenerated(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the generator")
+	}
+	dir := t.TempDir()
+	if msg, err := exec.Command("go", "run", "gen_schema.go", dir).CombinedOutput(); err != nil {
+		t.Fatalf("gen_schema: %v\n%s", err, msg)
+	}
+	for _, name := range []string{"schema_gen.go", "oms_queue.h"} {
+		want, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s does not match schema.json; run go generate ./queue", name)
+		}
+	}
+
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler to check oms_queue.h with")
+	}
+	if msg, err := exec.Command(cc, "-std=c11", "-fsyntax-only", "-x", "c", "oms_queue.h").CombinedOutput(); err != nil {
+		t.Fatalf("oms_queue.h: %v\n%s", err, msg)
+	}
+}
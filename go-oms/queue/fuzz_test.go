@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+// validHeader returns the header bytes CreateQueue would write.
+func validHeader() []byte {
+	h := QueueHeader{
+		Magic:     QueueMagic,
+		Capacity:  QueueCapacity,
+		ByteOrder: ByteOrderMark,
+	}
+	return append([]byte(nil), unsafe.Slice((*byte)(unsafe.Pointer(&h)), HeaderSize)...)
+}
+
+// writeQueueFile lays out a queue file from fuzzed parts: header bytes at
+// offset 0, slot bytes right after the header, and a size delta applied to
+// the expected file size to produce truncated or oversized files.
+func writeQueueFile(t *testing.T, header, slots []byte, sizeDelta int64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "queue")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	size := max(int64(TotalSize)+sizeDelta%4096, 0)
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(header, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(slots, int64(HeaderSize)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func FuzzOpenQueue(f *testing.F) {
+	slot := Order{OrderID: 1, ClientID: 1001, Quantity: 100, Price: 50000}
+	slotBytes := unsafe.Slice((*byte)(unsafe.Pointer(&slot)), OrderSize)
+
+	published := validHeader()
+	published[0] = 1 // ProducerHead = 1 on little-endian hosts
+
+	f.Add(validHeader(), []byte(nil), int64(0), false)
+	f.Add(published, slotBytes, int64(0), false)
+	f.Add(published, slotBytes, int64(0), true)
+	f.Add(validHeader()[:64], []byte(nil), int64(-1), false)
+	f.Add(validHeader(), []byte(nil), int64(8), false)
+	f.Add([]byte{0xEF, 0xBE, 0xAD, 0xDE}, []byte{0xFF}, int64(0), true)
+
+	f.Fuzz(func(t *testing.T, header, slots []byte, sizeDelta int64, foreign bool) {
+		if len(header) > int(HeaderSize) || len(slots) > 64*int(OrderSize) {
+			t.Skip()
+		}
+		path := writeQueueFile(t, header, slots, sizeDelta)
+
+		open := OpenQueue
+		if foreign {
+			open = OpenQueueForeign
+		}
+		q, err := open(path)
+		if err != nil {
+			return
+		}
+		defer q.Close()
+
+		if d := q.Depth(); d > QueueCapacity {
+			t.Fatalf("opened queue reports depth %d > capacity", d)
+		}
+		for range 128 {
+			order, err := q.Dequeue()
+			if err != nil {
+				if !errors.Is(err, ErrCorruptedIndices) && !errors.Is(err, ErrCorruptedOrder) {
+					t.Fatalf("unexpected dequeue error: %v", err)
+				}
+				return
+			}
+			if order == nil {
+				return
+			}
+			if order.Side > 1 {
+				t.Fatalf("dequeued garbage order: %+v", *order)
+			}
+		}
+	})
+}
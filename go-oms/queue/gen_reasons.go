@@ -0,0 +1,98 @@
+//go:build ignore
+
+// gen_reasons writes the reject reason table, the single source of truth for
+// reason codes, as Go constants (reasons_gen.go) and as reasons.json, which
+// rust-me/build.rs turns into Rust constants. Codes go over shared memory in
+// Order.Reason, so never renumber one; append new reasons at the end.
+//
+// Run with go generate ./queue after editing the table.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+)
+
+type reason struct {
+	Code uint8  `json:"code"`
+	Name string `json:"name"`
+	Doc  string `json:"doc"`
+}
+
+var reasons = []reason{
+	{0, "none", "not rejected"},
+	{1, "validation", "malformed order or failed a static instrument rule"},
+	{2, "risk", "failed a pre- or post-trade risk limit"},
+	{3, "session_closed", "the trading session is not open"},
+	{4, "throttled", "shed by a rate limit or load threshold"},
+	{5, "unknown_symbol", "symbol not in the reference data"},
+	{6, "killed", "the client's kill switch is engaged"},
+	{7, "invalid_flags", "execution flags not valid for the order type"},
+	{8, "duplicate_id", "order id reused or not increasing"},
+	{9, "unknown_order", "cancel for an order that is not open"},
+	{10, "engine", "refused by the matching engine"},
+	{11, "no_locate", "short sale without a locate for the shares"},
+	{12, "locate_unavailable", "the locate source could not be asked; the short sale may be retried"},
+	{13, "price_band", "priced through the symbol's limit up-limit down band"},
+	{14, "quote_expired", "quote hit after it expired or was already traded"},
+}
+
+func main() {
+	for i, r := range reasons {
+		if int(r.Code) != i || strings.ContainsAny(r.Doc+r.Name, `"\`) {
+			log.Fatalf("reason %q: codes must be dense and text free of quotes", r.Name)
+		}
+	}
+
+	var g bytes.Buffer
+	g.WriteString("// Code generated by gen_reasons.go; DO NOT EDIT.\n\npackage queue\n\n")
+	g.WriteString("// Order.Reason values, set on StatusRejected records.\nconst (\n")
+	for _, r := range reasons {
+		fmt.Fprintf(&g, "\tReason%s uint8 = %d // %s\n", camel(r.Name), r.Code, r.Doc)
+	}
+	g.WriteString(")\n\nvar reasonNames = [...]string{\n")
+	for _, r := range reasons {
+		fmt.Fprintf(&g, "\t%q,\n", r.Name)
+	}
+	g.WriteString("}\n")
+	src, err := format.Source(g.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("reasons_gen.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	// one reason per line keeps build.rs's reader trivial
+	var j bytes.Buffer
+	j.WriteString("[\n")
+	for i, r := range reasons {
+		line, _ := json.Marshal(r)
+		j.Write(line)
+		if i < len(reasons)-1 {
+			j.WriteByte(',')
+		}
+		j.WriteByte('\n')
+	}
+	j.WriteString("]\n")
+	if err := os.WriteFile("reasons.json", j.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func camel(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "id" {
+			b.WriteString("ID")
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
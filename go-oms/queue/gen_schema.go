@@ -0,0 +1,502 @@
+//go:build ignore
+
+// gen_schema writes the shared-memory ABI described by schema.json, the
+// single source of truth for both sides, as Go (schema_gen.go): the Order
+// and QueueHeader structs, their constants, SwapOrder, Order.Fingerprint,
+// and compile-time assertions that the compiler laid the structs out as
+// declared.
+// rust-me/build.rs generates the Rust structs, constants and assertions from
+// the same file, so a field can no longer be moved on one side only. Reject
+// reasons have their own table; see gen_reasons.go.
+//
+// It also writes oms_queue.h, the same layout and constants for C and C++
+// consumers attaching to a queue file, with the reason codes from
+// reasons.json and the file constants from queue.go and byteorder.go. Go
+// never compiles it; nothing here needs cgo.
+//
+// schema.json holds one entry per line: a struct followed by its fields in
+// memory order, or a constant group followed by its values. A field's type
+// is a scalar, or a struct declared earlier with a count, for an array of
+// them. Never renumber a constant or move a field; append instead. A field
+// marked fingerprint is hashed by the struct's Fingerprint, the same on
+// every side; marking or unmarking one changes every fingerprint.
+//
+// Run with go generate ./queue after editing schema.json; it runs after
+// gen_reasons, whose reasons.json it reads. A directory
+// argument writes both files there instead, which is how the tests spot a
+// stale one.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+type entry struct {
+	// struct or constant group header
+	Struct string `json:"struct"`
+	Const  string `json:"const"`
+	Align  int    `json:"align"`
+	Bits   bool   `json:"bits"`
+	// field
+	Go     string `json:"go"`
+	Rust   string `json:"rust"`
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Size   int    `json:"size"`
+	Count  int    `json:"count"` // elements, for a field of struct type
+	// Fingerprint includes the field in the struct's fingerprint
+	Fingerprint bool `json:"fingerprint"`
+	// constant
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+
+	Doc string `json:"doc"`
+}
+
+type group struct {
+	entry
+	members []entry
+}
+
+var goTypes = map[string]string{
+	"u8": "uint8", "u32": "uint32", "u64": "uint64", "i32": "int32",
+	"atomic_u32": "uint32", "atomic_u64": "uint64",
+}
+
+func main() {
+	data, err := os.ReadFile("schema.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Fatalf("schema.json: %v", err)
+	}
+	var structs, consts []*group
+	var cur *group
+	for _, e := range entries {
+		switch {
+		case e.Struct != "":
+			cur = &group{entry: e}
+			structs = append(structs, cur)
+		case e.Const != "":
+			cur = &group{entry: e}
+			consts = append(consts, cur)
+		case cur == nil:
+			log.Fatalf("%+v before any struct or constant group", e)
+		default:
+			cur.members = append(cur.members, e)
+		}
+	}
+
+	var g bytes.Buffer
+	g.WriteString("// Code generated by gen_schema.go from schema.json; DO NOT EDIT.\n\npackage queue\n\n")
+	g.WriteString("import (\n\t\"math/bits\"\n\t\"unsafe\"\n)\n\n")
+	declared := make(map[string]*group)
+	for _, s := range structs {
+		checkLayout(s, declared)
+		declared[s.Struct] = s
+		writeStruct(&g, s)
+	}
+	for _, c := range consts {
+		writeConsts(&g, c)
+	}
+	for _, s := range structs {
+		writeSwap(&g, s)
+		writeFingerprint(&g, s)
+	}
+	g.WriteString("// Each line compiles only if both sides are equal: a larger left side\n")
+	g.WriteString("// makes an array too long for [0]struct{}, a smaller one a negative length.\n")
+	g.WriteString("var (\n")
+	for _, s := range structs {
+		fmt.Fprintf(&g, "\t_ [0]struct{} = [unsafe.Sizeof(%s{}) - %d]struct{}{}\n", s.Struct, s.Size)
+		fmt.Fprintf(&g, "\t_ [0]struct{} = [unsafe.Alignof(%s{}) - %d]struct{}{}\n", s.Struct, s.Align)
+		for _, f := range s.members {
+			if f.Go == "_" {
+				continue
+			}
+			fmt.Fprintf(&g, "\t_ [0]struct{} = [unsafe.Offsetof(%s{}.%s) - %d]struct{}{}\n", s.Struct, f.Go, f.Offset)
+			fmt.Fprintf(&g, "\t_ [0]struct{} = [unsafe.Sizeof(%s{}.%s) - %d]struct{}{}\n", s.Struct, f.Go, f.Size)
+		}
+	}
+	g.WriteString(")\n")
+
+	src, err := format.Source(g.Bytes())
+	if err != nil {
+		log.Fatalf("%v\n%s", err, g.Bytes())
+	}
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	if err := os.WriteFile(filepath.Join(dir, "schema_gen.go"), src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oms_queue.h"), cHeader(structs, consts), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// checkLayout insists the declared offsets are the natural C layout, so
+// neither compiler inserts padding the schema does not name.
+func checkLayout(s *group, declared map[string]*group) {
+	if s.Size == 0 || s.Align == 0 || s.Size%s.Align != 0 {
+		log.Fatalf("%s: size %d and align %d", s.Struct, s.Size, s.Align)
+	}
+	end := 0
+	for _, f := range s.members {
+		align := f.Size
+		if elem, ok := declared[f.Type]; ok {
+			if f.Count == 0 || f.Size != f.Count*elem.Size {
+				log.Fatalf("%s.%s: %d bytes is not %d %s", s.Struct, f.Rust, f.Size, f.Count, f.Type)
+			}
+			align = elem.Align
+		} else if f.Type == "pad" {
+			align = 1
+		} else if _, ok := goTypes[f.Type]; !ok || f.Count != 0 {
+			log.Fatalf("%s.%s: unknown type %q", s.Struct, f.Rust, f.Type)
+		}
+		if f.Size == 0 || f.Offset != end || f.Offset%align != 0 {
+			log.Fatalf("%s.%s: offset %d is not right after the field before and aligned", s.Struct, f.Rust, f.Offset)
+		}
+		end = f.Offset + f.Size
+	}
+	// only the trailing padding up to the alignment is implicit
+	if (end+s.Align-1)/s.Align*s.Align != s.Size {
+		log.Fatalf("%s: fields end at %d, size is %d", s.Struct, end, s.Size)
+	}
+}
+
+func writeStruct(g *bytes.Buffer, s *group) {
+	writeDoc(g, s.Doc)
+	fmt.Fprintf(g, "type %s struct {\n", s.Struct)
+	for _, f := range s.members {
+		typ := goTypes[f.Type]
+		if f.Type == "pad" {
+			typ = "uint8"
+			if f.Size > 1 {
+				typ = fmt.Sprintf("[%d]byte", f.Size)
+			}
+		} else if f.Count > 0 {
+			typ = fmt.Sprintf("[%d]%s", f.Count, f.Type)
+		}
+		fmt.Fprintf(g, "\t%s %s", f.Go, typ)
+		if f.Doc != "" {
+			fmt.Fprintf(g, " // %s", f.Doc)
+		}
+		g.WriteString("\n")
+	}
+	g.WriteString("}\n\n")
+}
+
+func writeConsts(g *bytes.Buffer, c *group) {
+	writeDoc(g, c.Doc)
+	g.WriteString("const (\n")
+	var names, all []string
+	for _, v := range c.members {
+		name := c.Const + camel(v.Name)
+		value := fmt.Sprint(v.Value)
+		if c.Bits {
+			if bits.OnesCount(uint(v.Value)) != 1 {
+				log.Fatalf("%s: %d is not a single bit", name, v.Value)
+			}
+			value = fmt.Sprintf("1 << %d", bits.TrailingZeros(uint(v.Value)))
+		}
+		fmt.Fprintf(g, "\t%s %s = %s", name, goTypes[c.Type], value)
+		if v.Doc != "" {
+			fmt.Fprintf(g, " // %s", v.Doc)
+		}
+		g.WriteString("\n")
+		names = append(names, fmt.Sprintf("%q", v.Name))
+		all = append(all, name)
+	}
+	if c.Bits {
+		fmt.Fprintf(g, "\n\t// %ssKnown is every bit defined above; other bits are invalid.\n", c.Const)
+		fmt.Fprintf(g, "\t%ssKnown = %s\n", c.Const, strings.Join(all, " | "))
+	}
+	g.WriteString(")\n\n")
+	if c.Bits {
+		fmt.Fprintf(g, "var %sNames = [...]string{%s}\n\n", strings.ToLower(c.Const), strings.Join(names, ", "))
+	}
+}
+
+// writeSwap writes Swap<Struct> for structs read from foreign captures;
+// structs with atomic fields are swapped by their users field by field.
+func writeSwap(g *bytes.Buffer, s *group) {
+	for _, f := range s.members {
+		if strings.HasPrefix(f.Type, "atomic_") {
+			return
+		}
+	}
+	fmt.Fprintf(g, "// Swap%s returns o with every multi-byte field byte-swapped. It is its own\n", s.Struct)
+	g.WriteString("// inverse, so it serves both to decode foreign captures and to produce them.\n")
+	fmt.Fprintf(g, "func Swap%s(o %s) %s {\n", s.Struct, s.Struct, s.Struct)
+	for _, f := range s.members {
+		switch f.Type {
+		case "u64":
+			fmt.Fprintf(g, "\to.%s = bits.ReverseBytes64(o.%s)\n", f.Go, f.Go)
+		case "u32":
+			fmt.Fprintf(g, "\to.%s = bits.ReverseBytes32(o.%s)\n", f.Go, f.Go)
+		case "i32":
+			fmt.Fprintf(g, "\to.%s = int32(bits.ReverseBytes32(uint32(o.%s)))\n", f.Go, f.Go)
+		}
+	}
+	g.WriteString("\treturn o\n}\n\n")
+}
+
+// writeFingerprint writes Fingerprint for a struct with fingerprint
+// fields: FNV-1a over each field's little-endian bytes in schema order, so
+// it depends on neither the host's byte order nor the fields left out.
+// build.rs and cHeader write the same function for Rust and C.
+func writeFingerprint(g *bytes.Buffer, s *group) {
+	var fields []entry
+	for _, f := range s.members {
+		if f.Fingerprint {
+			fields = append(fields, f)
+		}
+	}
+	if fields == nil {
+		return
+	}
+	fmt.Fprintf(g, "// Fingerprint is a stable 64-bit hash of the %s fields schema.json marks\n", s.Struct)
+	g.WriteString("// fingerprint, the same on every host and on the Rust and C sides; see\n// fingerprint.go.\n")
+	fmt.Fprintf(g, "func (o *%s) Fingerprint() uint64 {\n\th := uint64(fingerprintBasis)\n", s.Struct)
+	for _, f := range fields {
+		v := fmt.Sprintf("uint64(o.%s)", f.Go)
+		if f.Type == "i32" {
+			v = fmt.Sprintf("uint64(uint32(o.%s))", f.Go)
+		}
+		fmt.Fprintf(g, "\th = fingerprintAdd(h, %s, %d)\n", v, f.Size)
+	}
+	g.WriteString("\treturn h\n}\n\n")
+}
+
+// writeDoc writes doc as a comment wrapped at 76 columns.
+func writeDoc(g *bytes.Buffer, doc string) {
+	line := "//"
+	for _, word := range strings.Fields(doc) {
+		if len(line)+1+len(word) > 76 && line != "//" {
+			g.WriteString(line + "\n")
+			line = "//"
+		}
+		line += " " + word
+	}
+	g.WriteString(line + "\n")
+}
+
+func camel(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "id" {
+			b.WriteString("ID")
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+var cTypes = map[string]string{
+	"u8": "uint8_t", "u32": "uint32_t", "u64": "uint64_t", "i32": "int32_t",
+	"atomic_u32": "uint32_t", "atomic_u64": "uint64_t",
+}
+
+const cPreamble = `/* Code generated by gen_schema.go from schema.json; DO NOT EDIT. */
+
+/*
+ * Layout of an OMS queue file, for C and C++ consumers attaching to the
+ * same rings as the Go producer and the Rust engine.
+ *
+ * A file is an oms_queue_header followed by OMS_QUEUE_CAPACITY oms_order
+ * slots; map all OMS_QUEUE_FILE_SIZE bytes shared. producer_head and
+ * consumer_tail count slots forever; slot i lives at i % OMS_QUEUE_CAPACITY.
+ * The producer writes a slot and then stores producer_head + 1 with release
+ * order; the consumer loads producer_head with acquire order, copies the
+ * slot, then stores consumer_tail + 1 with release order. Touch the header
+ * fields only through atomics, e.g. __atomic_load_n(&h->producer_head,
+ * __ATOMIC_ACQUIRE). A byte_order other than OMS_BYTE_ORDER_MARK means the
+ * file was written on a host with the opposite byte order. A process
+ * mapping the file writable should register in attached: claim an entry by
+ * compare-and-swap of pid from 0, free it on exit, and free the entries of
+ * pids that no longer exist; see attach.go.
+ */
+#ifndef OMS_QUEUE_H
+#define OMS_QUEUE_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+`
+
+// cHeader renders oms_queue.h.
+func cHeader(structs, consts []*group) []byte {
+	var h bytes.Buffer
+	h.WriteString(cPreamble)
+	for _, name := range []string{"QueueMagic", "QueueCapacity", "ByteOrderMark"} {
+		fmt.Fprintf(&h, "#define OMS_%s %su\n", upperSnake(name), goConst(name))
+	}
+	h.WriteString("#define OMS_QUEUE_FILE_SIZE \\\n")
+	h.WriteString("\t(sizeof(struct oms_queue_header) + OMS_QUEUE_CAPACITY * sizeof(struct oms_order))\n\n")
+
+	var asserts bytes.Buffer
+	for _, s := range structs {
+		name := "oms_" + strings.ToLower(upperSnake(s.Struct))
+		fmt.Fprintf(&h, "/* %s */\nstruct %s {\n", s.Doc, name)
+		fmt.Fprintf(&asserts, "OMS_STATIC_ASSERT(sizeof(struct %s) == %d, \"%s must be %d bytes\");\n", name, s.Size, name, s.Size)
+		for _, f := range s.members {
+			field := fmt.Sprintf("%s %s", cTypes[f.Type], f.Rust)
+			if f.Type == "pad" {
+				field = "uint8_t " + f.Rust
+				if f.Size > 1 {
+					field += fmt.Sprintf("[%d]", f.Size)
+				}
+			} else if f.Count > 0 {
+				field = fmt.Sprintf("struct oms_%s %s[%d]", strings.ToLower(upperSnake(f.Type)), f.Rust, f.Count)
+			}
+			doc := f.Doc
+			if strings.HasPrefix(f.Type, "atomic_") {
+				doc = strings.TrimSuffix("atomic; "+doc, "; ")
+			}
+			if doc != "" {
+				fmt.Fprintf(&h, "\t%-32s /* %s */\n", field+";", doc)
+			} else {
+				fmt.Fprintf(&h, "\t%s;\n", field)
+			}
+			fmt.Fprintf(&asserts, "OMS_STATIC_ASSERT(offsetof(struct %s, %s) == %d, \"%s.%s must be at offset %d\");\n",
+				name, f.Rust, f.Offset, name, f.Rust, f.Offset)
+		}
+		h.WriteString("};\n\n")
+	}
+
+	for _, c := range consts {
+		fmt.Fprintf(&h, "/* %s */\n", c.Doc)
+		var all []string
+		for _, v := range c.members {
+			name := fmt.Sprintf("OMS_%s_%s", c.Rust, strings.ToUpper(v.Name))
+			all = append(all, name)
+			if v.Doc != "" {
+				fmt.Fprintf(&h, "#define %-32s %-4d /* %s */\n", name, v.Value, v.Doc)
+			} else {
+				fmt.Fprintf(&h, "#define %-32s %d\n", name, v.Value)
+			}
+		}
+		if c.Bits {
+			fmt.Fprintf(&h, "#define OMS_%sS_KNOWN (%s)\n", c.Rust, strings.Join(all, " | "))
+		}
+		h.WriteString("\n")
+	}
+
+	var reasons []struct {
+		Code uint8
+		Name string
+		Doc  string
+	}
+	data, err := os.ReadFile("reasons.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &reasons); err != nil {
+		log.Fatalf("reasons.json: %v", err)
+	}
+	h.WriteString("/* Order.Reason values, set on rejected status records; see reasons.json. */\n")
+	for _, r := range reasons {
+		fmt.Fprintf(&h, "#define %-32s %-4d /* %s */\n", "OMS_REASON_"+strings.ToUpper(r.Name), r.Code, r.Doc)
+	}
+
+	h.WriteString(cFingerprintAdd)
+	for _, s := range structs {
+		cFingerprint(&h, s)
+	}
+
+	h.WriteString("\n#ifdef __cplusplus\n#define OMS_STATIC_ASSERT static_assert\n#else\n#define OMS_STATIC_ASSERT _Static_assert\n#endif\n\n")
+	h.Write(asserts.Bytes())
+	h.WriteString("\n#endif /* OMS_QUEUE_H */\n")
+	return h.Bytes()
+}
+
+const cFingerprintAdd = `/* FNV-1a over the low n bytes of v, least significant first. */
+static inline uint64_t oms_fingerprint_add(uint64_t h, uint64_t v, int n) {
+	for (; n > 0; n--, v >>= 8) {
+		h ^= v & 0xff;
+		h *= 1099511628211ull;
+	}
+	return h;
+}
+
+`
+
+// cFingerprint writes oms_<struct>_fingerprint, writeFingerprint for C.
+func cFingerprint(h *bytes.Buffer, s *group) {
+	var fields []entry
+	for _, f := range s.members {
+		if f.Fingerprint {
+			fields = append(fields, f)
+		}
+	}
+	if fields == nil {
+		return
+	}
+	name := "oms_" + strings.ToLower(upperSnake(s.Struct))
+	fmt.Fprintf(h, "/* The %s's fingerprint, as %s.Fingerprint in Go. */\n", s.Struct, s.Struct)
+	fmt.Fprintf(h, "static inline uint64_t %s_fingerprint(const struct %s *o) {\n", name, name)
+	h.WriteString("\tuint64_t h = 14695981039346656037ull;\n")
+	for _, f := range fields {
+		v := "o->" + f.Rust
+		if f.Type == "i32" {
+			v = "(uint32_t)" + v
+		}
+		fmt.Fprintf(h, "\th = oms_fingerprint_add(h, %s, %d);\n", v, f.Size)
+	}
+	h.WriteString("\treturn h;\n}\n\n")
+}
+
+// goConst is the literal a constant of this package is declared with in
+// queue.go or byteorder.go.
+func goConst(name string) string {
+	for _, file := range []string{"queue.go", "byteorder.go"} {
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, id := range vs.Names {
+					if lit, ok := vs.Values[i].(*ast.BasicLit); ok && id.Name == name {
+						return lit.Value
+					}
+				}
+			}
+		}
+	}
+	log.Fatalf("constant %s not declared as a literal in queue.go or byteorder.go", name)
+	return ""
+}
+
+// upperSnake turns QueueMagic into QUEUE_MAGIC.
+func upperSnake(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
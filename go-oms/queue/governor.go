@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Lagged is what a Governor reads from the ring header. *Queue and
+// *MemQueue implement it.
+type Lagged interface {
+	Depth() uint64
+	Capacity() uint64
+	ConsumerTail() uint64
+}
+
+// GovernorConfig tunes a Governor. Zero fields take the defaults noted.
+type GovernorConfig struct {
+	Target   float64       // ring utilization to hold, 0..1; default 0.5
+	Interval time.Duration // control period; default 10ms
+	// Horizon is how long the governor takes to close the gap between the
+	// current and the target depth; longer is smoother. Default 10 Intervals.
+	Horizon time.Duration
+	MinRate float64 // orders/sec floor, so a stalled consumer is still probed; default 100
+	MaxRate float64 // orders/sec ceiling; 0 = none
+}
+
+// Governor paces a producer so the ring sits around a target utilization.
+// Every Interval it measures the consumer's drain rate from ConsumerTail and
+// sets the send rate to that rate plus a correction that moves the depth to
+// the target over Horizon. Matching the drain rate is what keeps it from
+// swinging between an empty and a full ring, as a pure threshold would.
+//
+// A Governor serves the ring's single producer and is not safe for
+// concurrent use.
+type Governor struct {
+	q   Lagged
+	cfg GovernorConfig
+
+	rate     float64 // orders/sec
+	drain    float64 // smoothed consumer orders/sec
+	lastTail uint64
+	lastAt   time.Time
+	next     time.Time // when the next order may go
+}
+
+// NewGovernor starts a Governor for q at MinRate.
+func NewGovernor(q Lagged, cfg GovernorConfig) *Governor {
+	if cfg.Target <= 0 || cfg.Target > 1 {
+		cfg.Target = 0.5
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Millisecond
+	}
+	if cfg.Horizon <= 0 {
+		cfg.Horizon = 10 * cfg.Interval
+	}
+	if cfg.MinRate <= 0 {
+		cfg.MinRate = 100
+	}
+	now := time.Now()
+	return &Governor{
+		q:        q,
+		cfg:      cfg,
+		rate:     cfg.MinRate,
+		lastTail: q.ConsumerTail(),
+		lastAt:   now,
+		next:     now,
+	}
+}
+
+// Rate is the current target send rate in orders per second.
+func (g *Governor) Rate() float64 {
+	return g.rate
+}
+
+// Update runs one control step at now. Wait calls it every Interval.
+func (g *Governor) Update(now time.Time) {
+	dt := now.Sub(g.lastAt).Seconds()
+	if dt <= 0 {
+		return
+	}
+	tail := g.q.ConsumerTail()
+	measured := float64(tail-g.lastTail) / dt
+	g.lastTail, g.lastAt = tail, now
+	// smooth over about four periods so one slow poll does not whipsaw it
+	g.drain += (measured - g.drain) / 4
+
+	capacity := float64(g.q.Capacity())
+	gap := g.cfg.Target*capacity - float64(g.q.Depth())
+	rate := g.drain + gap/g.cfg.Horizon.Seconds()
+	rate = max(rate, g.cfg.MinRate)
+	if g.cfg.MaxRate > 0 {
+		rate = min(rate, g.cfg.MaxRate)
+	}
+	g.rate = rate
+}
+
+// Wait blocks until the producer may send its next order, or ctx is done.
+func (g *Governor) Wait(ctx context.Context) error {
+	now := time.Now()
+	if now.Sub(g.lastAt) >= g.cfg.Interval {
+		g.Update(now)
+	}
+	// never bank more than one Interval of sends after an idle spell
+	if floor := now.Add(-g.cfg.Interval); g.next.Before(floor) {
+		g.next = floor
+	}
+	due := g.next
+	g.next = g.next.Add(time.Duration(float64(time.Second) / g.rate))
+	wait := due.Sub(now)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
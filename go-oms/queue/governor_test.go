@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+// TestGovernorHoldsTarget simulates a producer sending at the governor's
+// rate into a consumer draining 50k orders/sec, on a fake clock, and checks
+// the ring settles near the target instead of filling or running dry.
+func TestGovernorHoldsTarget(t *testing.T) {
+	q := NewInMemory(4096)
+	g := NewGovernor(q, GovernorConfig{Target: 0.5, Interval: 10 * time.Millisecond})
+	now := g.lastAt
+	const drainRate = 50000
+
+	var sendDebt, drainDebt float64
+	var depths []uint64
+	for step := 0; step < 300; step++ {
+		dt := g.cfg.Interval.Seconds()
+		for sendDebt += g.Rate() * dt; sendDebt >= 1; sendDebt-- {
+			if q.Enqueue(Order{}) != nil {
+				break
+			}
+		}
+		for drainDebt += drainRate * dt; drainDebt >= 1; drainDebt-- {
+			if o, _ := q.Dequeue(); o == nil {
+				break
+			}
+		}
+		now = now.Add(g.cfg.Interval)
+		g.Update(now)
+		depths = append(depths, q.Depth())
+	}
+
+	for i, d := range depths[200:] {
+		if d < 1024 || d > 3072 {
+			t.Fatalf("step %d: depth %d strays from target 2048", 200+i, d)
+		}
+	}
+	if r := g.Rate(); r < drainRate*0.9 || r > drainRate*1.1 {
+		t.Fatalf("rate %.0f did not settle on the drain rate %d", r, drainRate)
+	}
+}
@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// The header keeps a small ring of depth and publish rate samples, written
+// by the producer, so the last few minutes of a queue can be read back
+// after an incident even if no monitor was watching. One producer per file
+// records; a second one would interleave its samples with the first's. The
+// Rust engine does not record its status queue.
+
+// HistoryInterval is the sampling interval producers use: with the 128
+// samples the header holds, the last four minutes or so.
+const HistoryInterval = 2 * time.Second
+
+// HistoryPoint is one history sample as tools see it.
+type HistoryPoint struct {
+	At    time.Time
+	Depth uint64
+	Rate  uint64 // orders published per second since the sample before
+}
+
+// RecordHistory samples the queue into the header's history ring every
+// interval until Close. It runs on its own goroutine and only reads the
+// indices, so it is safe alongside Enqueue. Calling it again, or on a
+// foreign capture or a file in a layout from before the ring, does nothing.
+func (q *Queue) RecordHistory(interval time.Duration) {
+	if q.swap || !q.layout.hasHistory() || q.historyStop != nil {
+		return
+	}
+	q.historyStop, q.historyDone = make(chan struct{}), make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastHead, last := q.ProducerHead(), time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				head := q.ProducerHead()
+				rate := float64(head-lastHead) / now.Sub(last).Seconds()
+				q.recordSample(now, q.Depth(), rate)
+				lastHead, last = head, now
+			}
+		}
+	}(q.historyStop, q.historyDone)
+}
+
+// stopHistory stops RecordHistory's goroutine, before Close unmaps the
+// header under it.
+func (q *Queue) stopHistory() {
+	if q.historyStop != nil {
+		close(q.historyStop)
+		<-q.historyDone
+		q.historyStop = nil
+	}
+}
+
+// recordSample writes the next history slot and then publishes it.
+func (q *Queue) recordSample(at time.Time, depth uint64, rate float64) {
+	seq := atomic.LoadUint64(&q.header.HistorySeq)
+	s := &q.header.History[seq%uint64(len(q.header.History))]
+	atomic.StoreUint64(&s.At, uint64(at.UnixNano()))
+	atomic.StoreUint32(&s.Depth, uint32(min(depth, math.MaxUint32)))
+	atomic.StoreUint32(&s.Rate, uint32(min(rate+0.5, math.MaxUint32)))
+	atomic.StoreUint64(&q.header.HistorySeq, seq+1)
+}
+
+// History returns the samples in the header's ring, oldest first. Like
+// Recent it is meant for monitoring: the oldest sample can be overwritten
+// while it is read. A file in a layout from before the ring has none.
+func (q *Queue) History() []HistoryPoint {
+	if !q.layout.hasHistory() {
+		return nil
+	}
+	seq := swap64(atomic.LoadUint64(&q.header.HistorySeq), q.swap)
+	n := min(seq, uint64(len(q.header.History)))
+	out := make([]HistoryPoint, 0, n)
+	for i := seq - n; i < seq; i++ {
+		s := &q.header.History[i%uint64(len(q.header.History))]
+		out = append(out, HistoryPoint{
+			At:    time.Unix(0, int64(swap64(atomic.LoadUint64(&s.At), q.swap))),
+			Depth: uint64(swap32(atomic.LoadUint32(&s.Depth), q.swap)),
+			Rate:  uint64(swap32(atomic.LoadUint32(&s.Rate), q.swap)),
+		})
+	}
+	return out
+}
+
+// History returns the queue's recorded depth and rate samples, oldest
+// first.
+func (r *ReadOnlyQueue) History() []HistoryPoint { return r.q.History() }
@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	q, err := CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1_700_000_000, 0)
+	ring := uint64(len(q.header.History))
+	for i := range ring + 2 {
+		q.recordSample(start.Add(time.Duration(i)*time.Second), i, float64(i)*10)
+	}
+	got := q.History()
+	if uint64(len(got)) != ring || got[0].Depth != 2 || got[0].Rate != 20 || !got[0].At.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("oldest sample %+v of %d", got[0], len(got))
+	}
+	if last := got[len(got)-1]; last.Depth != ring+1 {
+		t.Fatalf("newest sample %+v", last)
+	}
+
+	q.RecordHistory(5 * time.Millisecond)
+	for id := uint64(1); id <= 100; id++ {
+		q.Enqueue(Order{OrderID: id, Quantity: 1, Price: 1})
+	}
+	time.Sleep(50 * time.Millisecond)
+	q.Close()
+
+	// the samples outlive the producer
+	view, err := OpenQueueReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Close()
+	last := view.History()[ring-1]
+	if last.Depth != 100 || last.At.Before(start.Add(time.Hour)) {
+		t.Fatalf("recorded sample %+v", last)
+	}
+}
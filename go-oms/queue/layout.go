@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// The file layout has changed five times since the first build, which
+// wrote 40-byte slots after a 136-byte header: the byte order mark grew the
+// header to 144 bytes (v2), expiry, time in force and message type grew
+// the slot to 48 (v3), the slot was padded to 64 so new fields stop moving
+// the ring (v4), and the attachment registry (v5) and history ring (v6)
+// grew the header again. Headers carry no version, but every layout starts
+// with the same indices, magic and capacity and each has a different file
+// size, so the size tells them apart, and a capture written by an older
+// build can still be dumped and replayed: OpenQueueReadOnly and
+// OpenQueueForeign map it with its ring where that build put it, decoding
+// a slot narrower than Order field by field. A file from before the byte
+// order mark is read in this host's order, as the build that wrote it did.
+// What the layout lacks reads as zero or empty (no Attachments, no
+// History) and is never written, and nothing is enqueued on narrower
+// slots. Compact rewrites a file in this build's layout, which is how to
+// upgrade one for OpenQueue.
+
+// Layout is a queue file layout this build can read.
+type Layout struct {
+	Version    int
+	HeaderSize uintptr
+	SlotSize   uintptr
+	slot       *slotLayout // where an older slot keeps each field; nil for Order's
+}
+
+// Layouts lists the readable layouts, oldest first. The last is the one
+// this build creates. Keep at least the one before it when the header
+// grows again.
+var Layouts = []Layout{
+	{1, 136, 40, &slotV1},           // indices, magic and capacity; the first build's slots
+	{2, 144, 40, &slotV1},           // and the byte order mark
+	{3, 144, 48, &slotV3},           // with expiry, time in force and message type in the slot
+	{4, 144, OrderSize, nil},        // with slots padded to 64 bytes
+	{5, 320, OrderSize, nil},        // and the attachment registry, Attached
+	{6, HeaderSize, OrderSize, nil}, // and the history ring, History
+}
+
+// CurrentLayout is the layout this build creates.
+var CurrentLayout = Layouts[len(Layouts)-1]
+
+// ErrOldLayout is returned by OpenQueue for a file in an older build's
+// layout, which it cannot produce to or attach to.
+var ErrOldLayout = errors.New("queue file in an older layout")
+
+// Size is the size of a queue file in the layout.
+func (l Layout) Size() int64 { return int64(l.HeaderSize + QueueCapacity*l.SlotSize) }
+
+func (l Layout) String() string { return fmt.Sprintf("v%d", l.Version) }
+
+// hasByteOrder, hasRegistry and hasHistory report whether the header has
+// the fields that came in with later layouts.
+func (l Layout) hasByteOrder() bool { return l.Version >= 2 }
+func (l Layout) hasRegistry() bool  { return l.Version >= 5 }
+func (l Layout) hasHistory() bool   { return l.Version >= 6 }
+
+// layoutOf finds the layout a file of size bytes is in.
+func layoutOf(size int64) (Layout, bool) {
+	for _, l := range Layouts {
+		if l.Size() == size {
+			return l, true
+		}
+	}
+	return Layout{}, false
+}
+
+// Layout is the layout the queue's file is in.
+func (q *Queue) Layout() Layout { return q.layout }
+
+// Layout is the layout the queue's file is in.
+func (r *ReadOnlyQueue) Layout() Layout { return r.q.Layout() }
+
+// slot reads the order published at seq, in this host's byte order and
+// Order's layout whatever the file's.
+func (q *Queue) slot(seq uint64) Order {
+	var order Order
+	if l := q.layout; l.slot != nil {
+		at := l.HeaderSize + uintptr(seq%QueueCapacity)*l.SlotSize
+		order = l.slot.decode(q.mmap[at : at+l.SlotSize])
+	} else {
+		order = q.orders[seq%QueueCapacity]
+	}
+	if q.swap {
+		order = SwapOrder(order)
+	}
+	return order
+}
+
+// slotLayout is where an older build's slot kept each Order field it had.
+type slotLayout []slotField
+
+type slotField struct {
+	offset uintptr // in the old slot
+	field  uintptr // in Order
+	size   uintptr
+}
+
+var (
+	// the first build's: three uint64s, three uint32s, side and status
+	slotV1 = slotLayout{
+		{0, unsafe.Offsetof(Order{}.OrderID), 8},
+		{8, unsafe.Offsetof(Order{}.Price), 8},
+		{16, unsafe.Offsetof(Order{}.Timestamp), 8},
+		{24, unsafe.Offsetof(Order{}.ClientID), 4},
+		{28, unsafe.Offsetof(Order{}.Quantity), 4},
+		{32, unsafe.Offsetof(Order{}.Symbol), 4},
+		{36, unsafe.Offsetof(Order{}.Side), 1},
+		{37, unsafe.Offsetof(Order{}.Status), 1},
+	}
+	// ExpireAt among the uint64s, then time in force and message type
+	slotV3 = slotLayout{
+		{0, unsafe.Offsetof(Order{}.OrderID), 8},
+		{8, unsafe.Offsetof(Order{}.Price), 8},
+		{16, unsafe.Offsetof(Order{}.Timestamp), 8},
+		{24, unsafe.Offsetof(Order{}.ExpireAt), 8},
+		{32, unsafe.Offsetof(Order{}.ClientID), 4},
+		{36, unsafe.Offsetof(Order{}.Quantity), 4},
+		{40, unsafe.Offsetof(Order{}.Symbol), 4},
+		{44, unsafe.Offsetof(Order{}.Side), 1},
+		{45, unsafe.Offsetof(Order{}.Status), 1},
+		{46, unsafe.Offsetof(Order{}.TimeInForce), 1},
+		{47, unsafe.Offsetof(Order{}.MsgType), 1},
+	}
+)
+
+// decode copies an old slot's fields into an Order, still in the file's
+// byte order; fields the slot lacks are zero.
+func (s slotLayout) decode(slot []byte) Order {
+	var order Order
+	dst := unsafe.Slice((*byte)(unsafe.Pointer(&order)), OrderSize)
+	for _, f := range s {
+		copy(dst[f.field:f.field+f.size], slot[f.offset:f.offset+f.size])
+	}
+	return order
+}
@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+// writeOldQueue writes a queue file in layout l, as the build that wrote l
+// would have, holding orders unconsumed. It only knows 64-byte slots; the
+// layouts before them come from testdata.
+func writeOldQueue(t *testing.T, l Layout, orders []Order) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "queue")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := f.Truncate(l.Size()); err != nil {
+		t.Fatal(err)
+	}
+	h := QueueHeader{ProducerHead: uint64(len(orders)), Magic: QueueMagic, Capacity: QueueCapacity, ByteOrder: ByteOrderMark}
+	if _, err := f.WriteAt(unsafe.Slice((*byte)(unsafe.Pointer(&h)), l.HeaderSize), 0); err != nil {
+		t.Fatal(err)
+	}
+	slots := unsafe.Slice((*byte)(unsafe.Pointer(&orders[0])), uintptr(len(orders))*OrderSize)
+	if _, err := f.WriteAt(slots, int64(l.HeaderSize)); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fixture unpacks testdata/layout-v<n>.gz, a queue file written by the
+// build that introduced layout n: three orders enqueued, one consumed.
+func fixture(t *testing.T, l Layout) string {
+	t.Helper()
+	in, err := os.Open(filepath.Join("testdata", fmt.Sprintf("layout-%s.gz", l)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	z, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "queue")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, z); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fixtureOrders are the two orders the fixtures of each slot layout hold
+// unconsumed, as this build reads them.
+var fixtureOrders = map[*slotLayout][]Order{
+	&slotV1: {
+		{OrderID: 2, Price: 101, Timestamp: 2000, ClientID: 7, Quantity: 5, Symbol: 1, Side: 1},
+		{OrderID: 3, Price: 99, Timestamp: 3000, ClientID: 8, Quantity: 20, Symbol: 2, Status: StatusFilled},
+	},
+	&slotV3: {
+		{OrderID: 2, Price: 101, Timestamp: 2000, ExpireAt: 9000, ClientID: 7, Quantity: 5, Symbol: 1, Side: 1, TimeInForce: TIFGoodTillDate},
+		{OrderID: 3, Timestamp: 3000, ClientID: 8, Symbol: 2, MsgType: MsgCancelAll},
+	},
+}
+
+func TestOldLayouts(t *testing.T) {
+	for _, l := range Layouts[:len(Layouts)-1] {
+		t.Run(l.String(), func(t *testing.T) {
+			orders := []Order{
+				{OrderID: 1, ClientID: 7, Symbol: 1, Quantity: 10, Price: 100},
+				{OrderID: 2, ClientID: 7, Symbol: 1, Side: 1, Quantity: 5, Price: 101},
+			}
+			var path string
+			if l.slot == nil {
+				path = writeOldQueue(t, l, orders)
+			} else {
+				path, orders = fixture(t, l), fixtureOrders[l.slot]
+			}
+			if _, err := OpenQueue(path); !errors.Is(err, ErrOldLayout) {
+				t.Fatalf("OpenQueue: got %v, want ErrOldLayout", err)
+			}
+
+			r, err := OpenQueueReadOnly(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Layout() != l {
+				t.Errorf("layout %s, want %s", r.Layout(), l)
+			}
+			got := r.Unconsumed(10)
+			if len(got) != len(orders) || got[0] != orders[0] || got[1] != orders[1] {
+				t.Errorf("unconsumed %+v, want %+v", got, orders)
+			}
+			if h := r.History(); h != nil {
+				t.Errorf("history %+v from a layout without the ring", h)
+			}
+			r.Close()
+
+			q, err := OpenQueueForeign(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.slot != nil {
+				if err := q.Enqueue(orders[0]); !errors.Is(err, ErrOldLayout) {
+					t.Errorf("enqueue on %s slots: got %v, want ErrOldLayout", l, err)
+				}
+			}
+			if o, err := q.Dequeue(); err != nil || o == nil || *o != orders[0] {
+				t.Fatalf("replay got %+v %v, want %+v", o, err, orders[0])
+			}
+			q.Close()
+
+			if _, err := Compact(path, 0); err != nil {
+				t.Fatal(err)
+			}
+			q, err = OpenQueue(path)
+			if err != nil {
+				t.Fatalf("after compact: %v", err)
+			}
+			defer q.Close()
+			if q.Layout() != CurrentLayout || q.Depth() != 1 {
+				t.Fatalf("compacted to layout %s depth %d, want %s depth 1", q.Layout(), q.Depth(), CurrentLayout)
+			}
+			if o, err := q.Dequeue(); err != nil || o == nil || *o != orders[1] {
+				t.Fatalf("got %+v %v, want %+v", o, err, orders[1])
+			}
+		})
+	}
+}
+
+func TestLayoutSizes(t *testing.T) {
+	seen := map[int64]Layout{}
+	for _, l := range Layouts {
+		if l.slot == nil && l.SlotSize != OrderSize {
+			t.Errorf("%s: %d-byte slots without a slot layout", l, l.SlotSize)
+		}
+		if other, ok := seen[l.Size()]; ok {
+			t.Errorf("%s and %s are both %d bytes", other, l, l.Size())
+		}
+		seen[l.Size()] = l
+	}
+}
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// A queue can live in anonymous shared memory instead of a file: memfd
+// memory belongs to whoever holds its descriptor, so producer and consumer
+// can run in containers that share a Unix socket to pass it over (see
+// package handshake) and no host path. Tools that open queues by path do
+// not see it.
+
+// CreateQueueMemfd creates a queue in a new memfd. name only labels it, in
+// /proc/<pid>/fd. The memory is sealed at its size, so a process it is
+// passed to can map it without fear of it shrinking under the mapping.
+func CreateQueueMemfd(name string) (*Queue, error) {
+	fd, err := unix.MemfdCreate("oms-"+name, unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, fmt.Errorf("memfd_create: %w", err)
+	}
+	file := os.NewFile(uintptr(fd), "memfd:oms-"+name)
+	if err := file.Truncate(int64(TotalSize)); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to size memfd: %w", err)
+	}
+	if _, err := unix.FcntlInt(file.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_SEAL); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seal memfd: %w", err)
+	}
+	return initQueue(file)
+}
+
+// OpenQueueFile attaches to a queue through an open descriptor, such as a
+// memfd received from the producer, taking ownership of it. A memfd must be
+// sealed against shrinking.
+func OpenQueueFile(file *os.File) (*Queue, error) {
+	link, _ := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", file.Fd()))
+	if strings.HasPrefix(link, "/memfd:") {
+		seals, err := unix.FcntlInt(file.Fd(), unix.F_GET_SEALS, 0)
+		if err != nil || seals&unix.F_SEAL_SHRINK == 0 {
+			file.Close()
+			return nil, fmt.Errorf("%s is not sealed against shrinking", link)
+		}
+	}
+	return mapQueue(file, false, false)
+}
+
+// File is the descriptor the queue is mapped from, e.g. to pass a memfd
+// queue to its consumer. It stays owned by the queue.
+func (q *Queue) File() *os.File { return q.file }
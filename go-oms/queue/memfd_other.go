@@ -0,0 +1,23 @@
+//go:build !linux
+
+package queue
+
+import (
+	"errors"
+	"os"
+)
+
+// CreateQueueMemfd needs memfd_create, which only Linux has.
+func CreateQueueMemfd(name string) (*Queue, error) {
+	return nil, errors.New("memfd queues need Linux")
+}
+
+// OpenQueueFile attaches to a queue through an open descriptor, taking
+// ownership of it.
+func OpenQueueFile(file *os.File) (*Queue, error) {
+	return mapQueue(file, false, false)
+}
+
+// File is the descriptor the queue is mapped from. It stays owned by the
+// queue.
+func (q *Queue) File() *os.File { return q.file }
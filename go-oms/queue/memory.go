@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrClosed = errors.New("queue closed")
+
+// MemQueue is a heap-backed SPSC ring with the same semantics as Queue. All
+// cross-goroutine handoff goes through sync/atomic, so it is clean under -race.
+type MemQueue struct {
+	head     atomic.Uint64
+	_pad1    [56]byte
+	tail     atomic.Uint64
+	_pad2    [56]byte
+	closed   atomic.Bool
+	capacity uint64
+	orders   []Order
+	alerts   depthAlerts
+	watchers depthWatchers
+}
+
+var _ Sequencer = (*MemQueue)(nil)
+
+// NewInMemory returns an empty in-memory queue holding up to capacity orders.
+func NewInMemory(capacity int) *MemQueue {
+	if capacity <= 0 {
+		panic("queue: in-memory capacity must be positive")
+	}
+	return &MemQueue{
+		capacity: uint64(capacity),
+		orders:   make([]Order, capacity),
+	}
+}
+
+func (q *MemQueue) Enqueue(order Order) error {
+	_, err := q.EnqueueSeq(order)
+	return err
+}
+
+// EnqueueSeq is Queue.EnqueueSeq for the in-memory ring.
+func (q *MemQueue) EnqueueSeq(order Order) (uint64, error) {
+	if q.closed.Load() {
+		return 0, ErrClosed
+	}
+	consumerTail := q.tail.Load()
+	producerHead := q.head.Load()
+
+	if producerHead+1-consumerTail > q.capacity {
+		q.alerts.check(q.capacity, q.capacity)
+		return 0, ErrQueueFull
+	}
+
+	q.orders[producerHead%q.capacity] = order
+	q.head.Store(producerHead + 1)
+	q.alerts.check(producerHead+1-consumerTail, q.capacity)
+	return producerHead, nil
+}
+
+// OnDepthThreshold is Queue.OnDepthThreshold for the in-memory ring.
+func (q *MemQueue) OnDepthThreshold(pct float64, fn func(DepthEvent)) {
+	q.alerts.add(pct, fn)
+}
+
+// PollDepth is Queue.PollDepth for the in-memory ring.
+func (q *MemQueue) PollDepth() {
+	q.alerts.check(q.Depth(), q.capacity)
+}
+
+func (q *MemQueue) Dequeue() (*Order, error) {
+	producerHead := q.head.Load()
+	consumerTail := q.tail.Load()
+
+	if consumerTail == producerHead {
+		if q.closed.Load() {
+			return nil, ErrClosed
+		}
+		return nil, nil
+	}
+
+	order := q.orders[consumerTail%q.capacity]
+	q.tail.Store(consumerTail + 1)
+	return &order, nil
+}
+
+// DequeueUpTo is Queue.DequeueUpTo for the in-memory ring. It returns
+// ErrClosed only once the ring is closed and drained.
+func (q *MemQueue) DequeueUpTo(n int, dst []Order) ([]Order, error) {
+	producerHead := q.head.Load()
+	consumerTail := q.tail.Load()
+	if consumerTail == producerHead && q.closed.Load() {
+		return dst, ErrClosed
+	}
+
+	end := min(producerHead, consumerTail+uint64(max(n, 0)))
+	for tail := consumerTail; tail < end; tail++ {
+		dst = append(dst, q.orders[tail%q.capacity])
+	}
+	q.tail.Store(end)
+	return dst, nil
+}
+
+// ProducerHead is the number of orders enqueued so far.
+func (q *MemQueue) ProducerHead() uint64 {
+	return q.head.Load()
+}
+
+// ConsumerTail is the number of orders dequeued so far.
+func (q *MemQueue) ConsumerTail() uint64 {
+	return q.tail.Load()
+}
+
+// Depth loads the tail first, as Queue.Depth does.
+func (q *MemQueue) Depth() uint64 {
+	tail := q.tail.Load()
+	return min(q.head.Load()-tail, q.capacity)
+}
+
+func (q *MemQueue) Capacity() uint64 {
+	return q.capacity
+}
+
+// Close stops further Enqueues and every WatchDepth. Orders already
+// published can still be dequeued; after that Dequeue reports ErrClosed.
+func (q *MemQueue) Close() error {
+	q.closed.Store(true)
+	q.watchers.close()
+	return nil
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMemQueueSPSC(t *testing.T) {
+	const n = 100000
+	q := NewInMemory(64)
+
+	go func() {
+		for i := uint64(1); i <= n; {
+			if err := q.Enqueue(Order{OrderID: i}); err == nil {
+				i++
+			} else if errors.Is(err, ErrQueueFull) {
+				runtime.Gosched()
+			} else {
+				t.Errorf("enqueue: %v", err)
+				return
+			}
+		}
+		q.Close()
+	}()
+
+	want := uint64(1)
+	for {
+		order, err := q.Dequeue()
+		if errors.Is(err, ErrClosed) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if order == nil {
+			runtime.Gosched()
+			continue
+		}
+		if order.OrderID != want {
+			t.Fatalf("got order %d, want %d", order.OrderID, want)
+		}
+		want++
+	}
+	if want != n+1 {
+		t.Fatalf("received %d orders, want %d", want-1, n)
+	}
+}
+
+func TestDepthThresholdEdges(t *testing.T) {
+	q := NewInMemory(10)
+	var events []DepthEvent
+	q.OnDepthThreshold(0.5, func(e DepthEvent) { events = append(events, e) })
+
+	for i := range 8 {
+		q.Enqueue(Order{OrderID: uint64(i)})
+	}
+	if len(events) != 1 || !events[0].Rising || events[0].Depth != 5 {
+		t.Fatalf("after filling: %+v, want one rising event at depth 5", events)
+	}
+	for range 6 {
+		q.Dequeue()
+	}
+	q.PollDepth()
+	q.PollDepth()
+	if len(events) != 2 || events[1].Rising || events[1].Depth != 2 {
+		t.Fatalf("after draining: %+v, want one falling event at depth 2", events)
+	}
+}
+
+func TestEnqueueSeq(t *testing.T) {
+	q := NewInMemory(2)
+	for want := uint64(0); want < 5; want++ {
+		seq, err := q.EnqueueSeq(Order{OrderID: want + 1})
+		if err != nil || seq != want {
+			t.Fatalf("order %d: seq %d, %v; want %d", want+1, seq, err, want)
+		}
+		if _, err := q.Dequeue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.EnqueueSeq(Order{OrderID: 6})
+	q.EnqueueSeq(Order{OrderID: 7})
+	if seq, err := q.EnqueueSeq(Order{OrderID: 8}); !errors.Is(err, ErrQueueFull) || seq != 0 {
+		t.Fatalf("full ring: seq %d, %v", seq, err)
+	}
+}
+
+func TestWatchDepth(t *testing.T) {
+	q := NewInMemory(10)
+	samples := q.WatchDepth(time.Millisecond, 0.5)
+	next := func() DepthReading {
+		t.Helper()
+		select {
+		case s, ok := <-samples:
+			if !ok {
+				t.Fatal("watch closed early")
+			}
+			return s
+		case <-time.After(5 * time.Second):
+			t.Fatal("no sample")
+		}
+		panic("unreachable")
+	}
+	if s := next(); s.Depth != 0 || s.Capacity != 10 || s.Crossed != nil {
+		t.Fatalf("first sample %+v, want an empty ring", s)
+	}
+	// idle: nothing is sent
+	select {
+	case s := <-samples:
+		t.Fatalf("sample %+v from an idle ring", s)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	for i := range 6 {
+		q.Enqueue(Order{OrderID: uint64(i)})
+	}
+	s := next()
+	for s.Depth != 6 {
+		s = next()
+	}
+	if s.Head != 6 || s.Tail != 0 || len(s.Crossed) != 1 || !s.Crossed[0].Rising {
+		t.Fatalf("after filling: %+v, want one rising crossing", s)
+	}
+	for range 6 {
+		q.Dequeue()
+	}
+	s = next()
+	for s.Depth != 0 {
+		s = next()
+	}
+	if s.Tail != 6 || len(s.Crossed) != 1 || s.Crossed[0].Rising {
+		t.Fatalf("after draining: %+v, want one falling crossing", s)
+	}
+
+	q.Close()
+	for range samples {
+	}
+	if _, ok := <-q.WatchDepth(time.Millisecond); ok {
+		t.Fatal("watch after Close delivered a sample")
+	}
+}
@@ -0,0 +1,238 @@
+/* Code generated by gen_schema.go from schema.json; DO NOT EDIT. */
+
+/*
+ * Layout of an OMS queue file, for C and C++ consumers attaching to the
+ * same rings as the Go producer and the Rust engine.
+ *
+ * A file is an oms_queue_header followed by OMS_QUEUE_CAPACITY oms_order
+ * slots; map all OMS_QUEUE_FILE_SIZE bytes shared. producer_head and
+ * consumer_tail count slots forever; slot i lives at i % OMS_QUEUE_CAPACITY.
+ * The producer writes a slot and then stores producer_head + 1 with release
+ * order; the consumer loads producer_head with acquire order, copies the
+ * slot, then stores consumer_tail + 1 with release order. Touch the header
+ * fields only through atomics, e.g. __atomic_load_n(&h->producer_head,
+ * __ATOMIC_ACQUIRE). A byte_order other than OMS_BYTE_ORDER_MARK means the
+ * file was written on a host with the opposite byte order. A process
+ * mapping the file writable should register in attached: claim an entry by
+ * compare-and-swap of pid from 0, free it on exit, and free the entries of
+ * pids that no longer exist; see attach.go.
+ */
+#ifndef OMS_QUEUE_H
+#define OMS_QUEUE_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#define OMS_QUEUE_MAGIC 0xDEADBEEFu
+#define OMS_QUEUE_CAPACITY 65536u
+#define OMS_BYTE_ORDER_MARK 0x01020304u
+#define OMS_QUEUE_FILE_SIZE \
+	(sizeof(struct oms_queue_header) + OMS_QUEUE_CAPACITY * sizeof(struct oms_order))
+
+/* Order is one 64-byte ring slot: orders, control messages and status records all use it. Fields marked fingerprint are what Order.Fingerprint hashes: what the producer asked for, not when it was sent or what the engine made of it. */
+struct oms_order {
+	uint64_t order_id;
+	uint64_t price;
+	uint64_t timestamp;
+	uint64_t expire_at;              /* unix nanos; only meaningful for good-till-date and good-till-time */
+	uint32_t client_id;
+	uint32_t shares_qty;
+	uint32_t symbol;
+	uint8_t side;                    /* 0=buy, 1=sell */
+	uint8_t status;                  /* status value; pending on the order ring */
+	uint8_t time_in_force;           /* time-in-force value, good-till-cancel by default */
+	uint8_t msg_type;                /* message type, a new order by default or a control message */
+	uint8_t flags;                   /* execution instructions, flag bits */
+	uint8_t reason;                  /* reject reason on a rejected status record, see reasons.json */
+	uint8_t liquidity;               /* liquidity value on a filled status record */
+	uint8_t sub_account;             /* sub-account of the client the order is for, 0 for the client's own account; see refdata.Accounts */
+	int32_t fee;                     /* price units for the whole fill; negative is a rebate */
+	uint32_t contra_client_id;       /* client on the other side of a fill, 0 if not disclosed */
+	uint32_t trigger_price;          /* stop trigger; Go holds stops until they trigger, so the engine ignores it */
+};
+
+/* Attachment is one process attached to a queue file, an entry in the QueueHeader registry. */
+struct oms_attachment {
+	uint32_t pid;                    /* atomic; 0 while the entry is free */
+	uint32_t roles;                  /* atomic; Role bits for what the process has done with the queue so far */
+	uint64_t attached_at;            /* atomic; unix nanos */
+};
+
+/* PIDNamespace identifies the PID namespace an Attachment's PID belongs to. */
+struct oms_p_i_d_namespace {
+	uint32_t inode;                  /* atomic; inode of the attacher's /proc/self/ns/pid; 0 if unknown, as in files from before it was recorded */
+};
+
+/* DepthSample is one entry of the QueueHeader history ring, recorded by the producer. */
+struct oms_depth_sample {
+	uint64_t at;                     /* atomic; unix nanos */
+	uint32_t depth;                  /* atomic */
+	uint32_t rate;                   /* atomic; orders published per second since the sample before */
+};
+
+/* QueueHeader starts a queue file, with the producer and consumer indices on separate cache lines. */
+struct oms_queue_header {
+	uint64_t producer_head;          /* atomic; slots published so far */
+	uint8_t _pad1[56];
+	uint64_t consumer_tail;          /* atomic; slots released so far */
+	uint8_t _pad2[56];
+	uint32_t magic;                  /* atomic */
+	uint32_t capacity;               /* atomic */
+	uint32_t byte_order;             /* atomic; byte order mark as written by the producer */
+	struct oms_p_i_d_namespace attached_ns[8]; /* the PID namespace of each Attached entry, for telling a dead process from one in another container; see attach.go */
+	uint8_t _pad3[20];
+	struct oms_attachment attached[8]; /* processes attached to the file, claimed and reaped by each attacher; see attach.go */
+	uint64_t history_seq;            /* atomic; samples recorded so far; sample i is History[i % len(History)] */
+	uint8_t _pad4[56];
+	struct oms_depth_sample history[128]; /* the last samples of depth and rate; see history.go */
+};
+
+/* Order.Status values. The consumer echoes orders back on the status queue with one of the terminal values set. */
+#define OMS_STATUS_PENDING               0
+#define OMS_STATUS_FILLED                1
+#define OMS_STATUS_REJECTED              2
+#define OMS_STATUS_EXPIRED               3
+#define OMS_STATUS_CANCELED              4
+#define OMS_STATUS_ACKED                 5    /* control message applied by the engine */
+#define OMS_STATUS_BUSTED                6    /* fill reversed; carries the fill as it was */
+#define OMS_STATUS_CORRECTED             7    /* replacement fill after a bust; carries the new fill */
+#define OMS_STATUS_TRIGGERED             8    /* stop order released to the engine by Go; never sent by the engine */
+#define OMS_STATUS_PARTIAL               9    /* part of the order filled; carries that fill, and the rest stays open until a record of its own closes it */
+
+/* Order.MsgType values. Control messages share the order layout and ride the same ring, so they are ordered with respect to the orders they act on. */
+#define OMS_MSG_NEW                      0
+#define OMS_MSG_CANCEL_ALL               1    /* cancel every open order of the client */
+#define OMS_MSG_CANCEL_ALL_SYMBOL        2    /* cancel every open order in the symbol */
+#define OMS_MSG_CANCEL                   3    /* cancel the single order with the order id */
+#define OMS_MSG_RESEND                   4    /* status ring only: resend orders from the order id on */
+#define OMS_MSG_BUST                     5    /* reverse the fill of the order id */
+#define OMS_MSG_CORRECT                  6    /* replace the fill of the order id with price and quantity */
+#define OMS_MSG_QUOTE_REQUEST            7    /* ask for a firm price to trade quantity in the symbol on the side; Price is a reference, e.g. the mid */
+#define OMS_MSG_QUOTE                    8    /* status ring only: a firm price for the quote request with the order id, good until ExpireAt */
+#define OMS_MSG_QUOTE_HIT                9    /* trade the quote for the order id at its price, for up to its quantity */
+
+/* Order.TimeInForce values. GTD and GTT both carry an absolute ExpireAt; GTD producers set it to the end of the trading day. */
+#define OMS_TIF_GOOD_TILL_CANCEL         0
+#define OMS_TIF_GOOD_TILL_DATE           1
+#define OMS_TIF_GOOD_TILL_TIME           2
+
+/* Order.Liquidity values on fills. */
+#define OMS_LIQUIDITY_UNKNOWN            0
+#define OMS_LIQUIDITY_MAKER              1    /* the order was resting and added liquidity */
+#define OMS_LIQUIDITY_TAKER              2    /* the order executed on arrival and removed liquidity */
+
+/* refdata.Instrument.Type values. An order carries only Order.Symbol, so each future or option contract is a symbol of its own and its terms live in the reference data; the codes are shared so every side of the queue reads them alike. */
+#define OMS_INSTRUMENT_EQUITY            0
+#define OMS_INSTRUMENT_FUTURE            1    /* delivers or settles the underlying at maturity */
+#define OMS_INSTRUMENT_CALL              2    /* option to buy the underlying at the strike */
+#define OMS_INSTRUMENT_PUT               3    /* option to sell the underlying at the strike */
+
+/* Order.Flags bits: execution instructions for new orders. The engine rejects an order whose flags are not valid, so producers should check first. */
+#define OMS_FLAG_POST_ONLY               1    /* rest on the book only; rejected if it would take liquidity */
+#define OMS_FLAG_REDUCE_ONLY             2    /* may only reduce the client's position in the symbol */
+#define OMS_FLAG_HIDDEN                  4    /* rests without showing in market data */
+#define OMS_FLAG_ALL_OR_NONE             8    /* fills in one execution for the whole quantity, or not at all */
+#define OMS_FLAG_SHORT                   16   /* sell short: the client does not own the shares, so the broker needs a locate first; sells only */
+#define OMS_FLAG_SHORT_EXEMPT            32   /* short sale exempt from the locate requirement, e.g. a market maker's; sells only, not with short */
+#define OMS_FLAGS_KNOWN (OMS_FLAG_POST_ONLY | OMS_FLAG_REDUCE_ONLY | OMS_FLAG_HIDDEN | OMS_FLAG_ALL_OR_NONE | OMS_FLAG_SHORT | OMS_FLAG_SHORT_EXEMPT)
+
+/* Attachment.Roles bits, set the first time a process publishes to or consumes from the queue. */
+#define OMS_ROLE_PRODUCER                1
+#define OMS_ROLE_CONSUMER                2
+#define OMS_ROLES_KNOWN (OMS_ROLE_PRODUCER | OMS_ROLE_CONSUMER)
+
+/* Order.Reason values, set on rejected status records; see reasons.json. */
+#define OMS_REASON_NONE                  0    /* not rejected */
+#define OMS_REASON_VALIDATION            1    /* malformed order or failed a static instrument rule */
+#define OMS_REASON_RISK                  2    /* failed a pre- or post-trade risk limit */
+#define OMS_REASON_SESSION_CLOSED        3    /* the trading session is not open */
+#define OMS_REASON_THROTTLED             4    /* shed by a rate limit or load threshold */
+#define OMS_REASON_UNKNOWN_SYMBOL        5    /* symbol not in the reference data */
+#define OMS_REASON_KILLED                6    /* the client's kill switch is engaged */
+#define OMS_REASON_INVALID_FLAGS         7    /* execution flags not valid for the order type */
+#define OMS_REASON_DUPLICATE_ID          8    /* order id reused or not increasing */
+#define OMS_REASON_UNKNOWN_ORDER         9    /* cancel for an order that is not open */
+#define OMS_REASON_ENGINE                10   /* refused by the matching engine */
+#define OMS_REASON_NO_LOCATE             11   /* short sale without a locate for the shares */
+#define OMS_REASON_LOCATE_UNAVAILABLE    12   /* the locate source could not be asked; the short sale may be retried */
+#define OMS_REASON_PRICE_BAND            13   /* priced through the symbol's limit up-limit down band */
+#define OMS_REASON_QUOTE_EXPIRED         14   /* quote hit after it expired or was already traded */
+/* FNV-1a over the low n bytes of v, least significant first. */
+static inline uint64_t oms_fingerprint_add(uint64_t h, uint64_t v, int n) {
+	for (; n > 0; n--, v >>= 8) {
+		h ^= v & 0xff;
+		h *= 1099511628211ull;
+	}
+	return h;
+}
+
+/* The Order's fingerprint, as Order.Fingerprint in Go. */
+static inline uint64_t oms_order_fingerprint(const struct oms_order *o) {
+	uint64_t h = 14695981039346656037ull;
+	h = oms_fingerprint_add(h, o->order_id, 8);
+	h = oms_fingerprint_add(h, o->price, 8);
+	h = oms_fingerprint_add(h, o->expire_at, 8);
+	h = oms_fingerprint_add(h, o->client_id, 4);
+	h = oms_fingerprint_add(h, o->shares_qty, 4);
+	h = oms_fingerprint_add(h, o->symbol, 4);
+	h = oms_fingerprint_add(h, o->side, 1);
+	h = oms_fingerprint_add(h, o->time_in_force, 1);
+	h = oms_fingerprint_add(h, o->msg_type, 1);
+	h = oms_fingerprint_add(h, o->flags, 1);
+	h = oms_fingerprint_add(h, o->sub_account, 1);
+	h = oms_fingerprint_add(h, o->trigger_price, 4);
+	return h;
+}
+
+
+#ifdef __cplusplus
+#define OMS_STATIC_ASSERT static_assert
+#else
+#define OMS_STATIC_ASSERT _Static_assert
+#endif
+
+OMS_STATIC_ASSERT(sizeof(struct oms_order) == 64, "oms_order must be 64 bytes");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, order_id) == 0, "oms_order.order_id must be at offset 0");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, price) == 8, "oms_order.price must be at offset 8");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, timestamp) == 16, "oms_order.timestamp must be at offset 16");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, expire_at) == 24, "oms_order.expire_at must be at offset 24");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, client_id) == 32, "oms_order.client_id must be at offset 32");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, shares_qty) == 36, "oms_order.shares_qty must be at offset 36");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, symbol) == 40, "oms_order.symbol must be at offset 40");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, side) == 44, "oms_order.side must be at offset 44");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, status) == 45, "oms_order.status must be at offset 45");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, time_in_force) == 46, "oms_order.time_in_force must be at offset 46");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, msg_type) == 47, "oms_order.msg_type must be at offset 47");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, flags) == 48, "oms_order.flags must be at offset 48");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, reason) == 49, "oms_order.reason must be at offset 49");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, liquidity) == 50, "oms_order.liquidity must be at offset 50");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, sub_account) == 51, "oms_order.sub_account must be at offset 51");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, fee) == 52, "oms_order.fee must be at offset 52");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, contra_client_id) == 56, "oms_order.contra_client_id must be at offset 56");
+OMS_STATIC_ASSERT(offsetof(struct oms_order, trigger_price) == 60, "oms_order.trigger_price must be at offset 60");
+OMS_STATIC_ASSERT(sizeof(struct oms_attachment) == 16, "oms_attachment must be 16 bytes");
+OMS_STATIC_ASSERT(offsetof(struct oms_attachment, pid) == 0, "oms_attachment.pid must be at offset 0");
+OMS_STATIC_ASSERT(offsetof(struct oms_attachment, roles) == 4, "oms_attachment.roles must be at offset 4");
+OMS_STATIC_ASSERT(offsetof(struct oms_attachment, attached_at) == 8, "oms_attachment.attached_at must be at offset 8");
+OMS_STATIC_ASSERT(sizeof(struct oms_p_i_d_namespace) == 4, "oms_p_i_d_namespace must be 4 bytes");
+OMS_STATIC_ASSERT(offsetof(struct oms_p_i_d_namespace, inode) == 0, "oms_p_i_d_namespace.inode must be at offset 0");
+OMS_STATIC_ASSERT(sizeof(struct oms_depth_sample) == 16, "oms_depth_sample must be 16 bytes");
+OMS_STATIC_ASSERT(offsetof(struct oms_depth_sample, at) == 0, "oms_depth_sample.at must be at offset 0");
+OMS_STATIC_ASSERT(offsetof(struct oms_depth_sample, depth) == 8, "oms_depth_sample.depth must be at offset 8");
+OMS_STATIC_ASSERT(offsetof(struct oms_depth_sample, rate) == 12, "oms_depth_sample.rate must be at offset 12");
+OMS_STATIC_ASSERT(sizeof(struct oms_queue_header) == 2432, "oms_queue_header must be 2432 bytes");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, producer_head) == 0, "oms_queue_header.producer_head must be at offset 0");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, _pad1) == 8, "oms_queue_header._pad1 must be at offset 8");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, consumer_tail) == 64, "oms_queue_header.consumer_tail must be at offset 64");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, _pad2) == 72, "oms_queue_header._pad2 must be at offset 72");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, magic) == 128, "oms_queue_header.magic must be at offset 128");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, capacity) == 132, "oms_queue_header.capacity must be at offset 132");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, byte_order) == 136, "oms_queue_header.byte_order must be at offset 136");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, attached_ns) == 140, "oms_queue_header.attached_ns must be at offset 140");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, _pad3) == 172, "oms_queue_header._pad3 must be at offset 172");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, attached) == 192, "oms_queue_header.attached must be at offset 192");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, history_seq) == 320, "oms_queue_header.history_seq must be at offset 320");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, _pad4) == 328, "oms_queue_header._pad4 must be at offset 328");
+OMS_STATIC_ASSERT(offsetof(struct oms_queue_header, history) == 384, "oms_queue_header.history must be at offset 384");
+
+#endif /* OMS_QUEUE_H */
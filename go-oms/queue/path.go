@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// EnvQueuePath overrides the default order queue path for every binary.
+const EnvQueuePath = "OMS_QUEUE_PATH"
+
+// EnvRuntimeDir overrides RuntimeDir, to put the queues and sockets on a
+// volume the processes share, such as an emptyDir with medium Memory
+// mounted into every container of a pod.
+const EnvRuntimeDir = "OMS_RUNTIME_DIR"
+
+// EnvStartupWait is how long a process waits for its peer at startup, as
+// a duration like "30s": for the queues to be created, or the control
+// socket to be served. Containers of a pod start in no particular order.
+// Unset, nothing is waited for.
+const EnvStartupWait = "OMS_STARTUP_WAIT"
+
+// RuntimeDir is where queues and sockets live by default: $OMS_RUNTIME_DIR,
+// else $XDG_RUNTIME_DIR/oms, else a per-user directory in /dev/shm, which
+// containers without a session get and can share with each other, or
+// under the system temp dir without it. Any local user can create that
+// last one first, so ValidatePath refuses queues in it unless it is this
+// user's and private.
+func RuntimeDir() string {
+	if dir := os.Getenv(EnvRuntimeDir); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "oms")
+	}
+	return fallbackDir()
+}
+
+// fallbackDir is the per-user directory RuntimeDir falls back to.
+func fallbackDir() string {
+	base := os.TempDir()
+	if fi, err := os.Stat(ShmDir); err == nil && fi.IsDir() {
+		base = ShmDir
+	}
+	return filepath.Join(base, "oms-"+strconv.Itoa(os.Getuid()))
+}
+
+// ShmDir is the tmpfs RuntimeDir falls back to, memory rather than disk
+// like the runtime dir.
+const ShmDir = "/dev/shm"
+
+// DefaultPath is the order queue path: $OMS_QUEUE_PATH, else the stream
+// directory RuntimeDir()/orders. With $OMS_RUNTIME_DIR set, a relative
+// $OMS_QUEUE_PATH is a name under it.
+func DefaultPath() string {
+	if p := os.Getenv(EnvQueuePath); p != "" {
+		if os.Getenv(EnvRuntimeDir) != "" && !filepath.IsAbs(p) {
+			return filepath.Join(RuntimeDir(), p)
+		}
+		return p
+	}
+	return filepath.Join(RuntimeDir(), "orders")
+}
+
+// StartupWait is $OMS_STARTUP_WAIT, or 0 when it is unset.
+func StartupWait() (time.Duration, error) {
+	s := os.Getenv(EnvStartupWait)
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q: want a duration like 30s", EnvStartupWait, s)
+	}
+	return d, nil
+}
+
+// StatusPath is the status queue paired with an order queue.
+func StatusPath(orderPath string) string {
+	return orderPath + "_status"
+}
+
+// ValidatePath rejects queue paths that could be redirected by another
+// local user: a symlink or non-regular file at the path itself, or a parent
+// that is a symlink, not a directory, or world-writable without the sticky
+// bit. Under RuntimeDir's per-user fallback in a shared temp dir, that
+// directory must also be owned by this user and mode 0700 or 0750. The
+// path need not exist yet.
+func ValidatePath(path string) error {
+	if err := checkFallback(path); err != nil {
+		return err
+	}
+
+	if fi, err := os.Lstat(path); err == nil {
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("queue path %s is a symlink", path)
+		case fi.IsDir():
+			return fmt.Errorf("queue path %s is a directory", path)
+		case !fi.Mode().IsRegular():
+			return fmt.Errorf("queue path %s is not a regular file", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat queue path: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	fi, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil // CreateQueueWith makes it with CreateOptions.DirMode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat queue directory: %w", err)
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		return fmt.Errorf("queue directory %s is a symlink", dir)
+	case !fi.IsDir():
+		return fmt.Errorf("queue directory %s is not a directory", dir)
+	case fi.Mode().Perm()&0o002 != 0 && fi.Mode()&os.ModeSticky == 0:
+		return fmt.Errorf("queue directory %s is world-writable without the sticky bit", dir)
+	}
+	return nil
+}
+
+// checkFallback refuses path if it lies under RuntimeDir's fallback and
+// someone else made that directory, or opened it up.
+func checkFallback(path string) error {
+	fallback := fallbackDir()
+	abs, err := filepath.Abs(path)
+	if err != nil || (abs != fallback && !strings.HasPrefix(abs, fallback+string(filepath.Separator))) {
+		return nil
+	}
+	return checkPrivate(fallback, os.Geteuid())
+}
+
+// checkPrivate reports whether dir, if it exists, is a directory owned by
+// uid that no one outside its group can write to or enter.
+func checkPrivate(dir string, uid int) error {
+	fi, err := os.Lstat(dir)
+	if os.IsNotExist(err) {
+		return nil // CreateQueueWith makes it with CreateOptions.DirMode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat queue directory: %w", err)
+	}
+	if fi.Mode()&os.ModeSymlink != 0 || !fi.IsDir() {
+		return fmt.Errorf("runtime directory %s is not a directory", dir)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != uid {
+		return fmt.Errorf("runtime directory %s is owned by uid %d, not %d: set %s", dir, st.Uid, uid, EnvRuntimeDir)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o700 && perm != 0o750 {
+		return fmt.Errorf("runtime directory %s has mode %v, want 0700 or 0750", dir, perm)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckPrivate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "oms")
+	if err := checkPrivate(dir, os.Geteuid()); err != nil {
+		t.Errorf("missing directory refused: %v", err)
+	}
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for mode, ok := range map[os.FileMode]bool{0o700: true, 0o750: true, 0o770: false, 0o755: false, 0o777: false} {
+		if err := os.Chmod(dir, mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkPrivate(dir, os.Geteuid()); (err == nil) != ok {
+			t.Errorf("mode %v: got %v", mode, err)
+		}
+	}
+	if err := os.Chmod(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivate(dir, os.Geteuid()+1); err == nil {
+		t.Error("directory of another user accepted")
+	}
+
+	link := filepath.Join(filepath.Dir(dir), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrivate(link, os.Geteuid()); err == nil {
+		t.Error("symlink accepted")
+	}
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// ErrWorldWritable is returned for queue files or directories any local user
+// could write to, unless CreateOptions.AllowWorldWritable is set.
+var ErrWorldWritable = errors.New("refusing world-writable queue")
+
+// CreateOptions controls who can attach to a new queue file.
+type CreateOptions struct {
+	Mode    os.FileMode // file mode, applied exactly regardless of umask; default 0660
+	DirMode os.FileMode // mode for a missing parent directory; default 0750
+	Group   string      // group name or gid to own the file (and created directory); empty keeps the default
+
+	// AllowWorldWritable permits a mode with the "other" write bit. Live
+	// order flow in a world-writable file can be forged by any local user.
+	AllowWorldWritable bool
+}
+
+func (o CreateOptions) withDefaults() CreateOptions {
+	if o.Mode == 0 {
+		o.Mode = 0o660
+	}
+	if o.DirMode == 0 {
+		o.DirMode = 0o750
+	}
+	return o
+}
+
+func (o CreateOptions) check() error {
+	if o.AllowWorldWritable {
+		return nil
+	}
+	if o.Mode&0o002 != 0 {
+		return fmt.Errorf("%w: file mode %v", ErrWorldWritable, o.Mode)
+	}
+	if o.DirMode&0o002 != 0 {
+		return fmt.Errorf("%w: directory mode %v", ErrWorldWritable, o.DirMode)
+	}
+	return nil
+}
+
+func (o CreateOptions) gid() (int, error) {
+	if o.Group == "" {
+		return -1, nil
+	}
+	if gid, err := strconv.Atoi(o.Group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(o.Group)
+	if err != nil {
+		return -1, fmt.Errorf("unknown group %q: %w", o.Group, err)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// prepareDir creates the queue's directory if it is missing. One that
+// exists must not be world-writable either, sticky or not: any local user
+// could plant files in it for the next process to attach to.
+func (o CreateOptions) prepareDir(dir string) error {
+	if fi, err := os.Stat(dir); err == nil {
+		if fi.Mode().Perm()&0o002 != 0 && !o.AllowWorldWritable {
+			return fmt.Errorf("%w: directory %s has mode %v", ErrWorldWritable, dir, fi.Mode().Perm())
+		}
+		return nil
+	}
+	if err := os.MkdirAll(dir, o.DirMode); err != nil {
+		return fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	if err := os.Chmod(dir, o.DirMode); err != nil {
+		return fmt.Errorf("failed to chmod queue directory: %w", err)
+	}
+	gid, err := o.gid()
+	if err != nil {
+		return err
+	}
+	if gid >= 0 {
+		if err := os.Chown(dir, -1, gid); err != nil {
+			return fmt.Errorf("failed to chown queue directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// apply sets the exact mode and group on a freshly created file.
+func (o CreateOptions) apply(file *os.File) error {
+	gid, err := o.gid()
+	if err != nil {
+		return err
+	}
+	if gid >= 0 {
+		if err := file.Chown(-1, gid); err != nil {
+			return fmt.Errorf("failed to chown queue file: %w", err)
+		}
+	}
+	// OpenFile's mode is filtered through the umask; set it explicitly
+	if err := file.Chmod(o.Mode); err != nil {
+		return fmt.Errorf("failed to chmod queue file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorldWritable(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CreateQueueWith(filepath.Join(dir, "q"), CreateOptions{Mode: 0o666}); !errors.Is(err, ErrWorldWritable) {
+		t.Errorf("world-writable file: got %v, want ErrWorldWritable", err)
+	}
+	if _, err := CreateQueueWith(filepath.Join(dir, "new", "q"), CreateOptions{DirMode: 0o777}); !errors.Is(err, ErrWorldWritable) {
+		t.Errorf("world-writable new directory: got %v, want ErrWorldWritable", err)
+	}
+
+	// an existing directory anyone can write to, even with the sticky bit
+	shared := filepath.Join(dir, "shared")
+	if err := os.Mkdir(shared, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(shared, 0o777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateQueue(filepath.Join(shared, "q")); !errors.Is(err, ErrWorldWritable) {
+		t.Errorf("existing world-writable directory: got %v, want ErrWorldWritable", err)
+	}
+	if s, err := CreateStream(filepath.Join(shared, "orders"), StreamMeta{}, CreateOptions{}); err != nil {
+		t.Errorf("private stream directory in a shared one: %v", err)
+	} else {
+		s.Close()
+	}
+	stream := filepath.Join(dir, "stream")
+	if err := os.Mkdir(stream, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(stream, 0o777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateStream(stream, StreamMeta{}, CreateOptions{}); !errors.Is(err, ErrWorldWritable) {
+		t.Errorf("existing world-writable stream directory: got %v, want ErrWorldWritable", err)
+	}
+
+	q, err := CreateQueueWith(filepath.Join(shared, "q"), CreateOptions{AllowWorldWritable: true})
+	if err != nil {
+		t.Fatalf("with AllowWorldWritable: %v", err)
+	}
+	q.Close()
+}
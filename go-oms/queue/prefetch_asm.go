@@ -0,0 +1,11 @@
+//go:build amd64 || arm64
+
+package queue
+
+import "unsafe"
+
+// prefetch hints that the cache line at p will be read soon: PREFETCHT0 on
+// amd64, PRFM PLDL1KEEP on arm64.
+//
+//go:noescape
+func prefetch(p unsafe.Pointer)
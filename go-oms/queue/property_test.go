@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"pgregory.net/rapid"
+)
+
+// ringModel drives a queue with random enqueue/dequeue batches and checks it
+// against a plain slice: FIFO order, no loss, no duplicates, and
+// Depth == enqueued - dequeued after every step. It runs both sides on one
+// goroutine; concurrentRun below interleaves them for real, and the litmus
+// package checks the memory ordering underneath.
+type ringModel struct {
+	q        OrderQueue
+	inFlight []uint64
+	nextID   uint64
+	maxBatch int
+}
+
+func (m *ringModel) enqueue(t *rapid.T) {
+	n := rapid.IntRange(1, m.maxBatch).Draw(t, "enqueue")
+	for range n {
+		err := m.q.Enqueue(Order{OrderID: m.nextID})
+		if uint64(len(m.inFlight)) == m.q.Capacity() {
+			if !errors.Is(err, ErrQueueFull) {
+				t.Fatalf("enqueue into full ring: got %v, want ErrQueueFull", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("enqueue %d: %v", m.nextID, err)
+		}
+		m.inFlight = append(m.inFlight, m.nextID)
+		m.nextID++
+	}
+}
+
+func (m *ringModel) dequeue(t *rapid.T) {
+	n := rapid.IntRange(1, m.maxBatch).Draw(t, "dequeue")
+	for range n {
+		order, err := m.q.Dequeue()
+		if err != nil {
+			t.Fatalf("dequeue: %v", err)
+		}
+		if len(m.inFlight) == 0 {
+			if order != nil {
+				t.Fatalf("dequeued order %d from empty ring", order.OrderID)
+			}
+			return
+		}
+		if order == nil {
+			t.Fatalf("ring empty with %d orders in flight", len(m.inFlight))
+		}
+		if order.OrderID != m.inFlight[0] {
+			t.Fatalf("got order %d, want %d", order.OrderID, m.inFlight[0])
+		}
+		m.inFlight = m.inFlight[1:]
+	}
+}
+
+func (m *ringModel) check(t *rapid.T) {
+	if got := m.q.Depth(); got != uint64(len(m.inFlight)) {
+		t.Fatalf("depth %d, want %d", got, len(m.inFlight))
+	}
+}
+
+func (m *ringModel) run(t *rapid.T) {
+	t.Repeat(map[string]func(*rapid.T){
+		"enqueue": m.enqueue,
+		"dequeue": m.dequeue,
+		"":        m.check,
+	})
+}
+
+func TestRingPropertiesInMemory(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		// tiny capacities make nearly every step wrap around the ring
+		capacity := rapid.IntRange(1, 17).Draw(t, "capacity")
+		q := NewInMemory(capacity)
+		m := &ringModel{q: q, nextID: 1, maxBatch: 2*capacity + 1}
+		m.run(t)
+	})
+}
+
+func TestRingPropertiesMmap(t *testing.T) {
+	dir := t.TempDir()
+	rapid.Check(t, func(t *rapid.T) {
+		q, err := CreateQueue(filepath.Join(dir, "queue"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer q.Close()
+
+		// start just short of a lap boundary so batches cross the slot wrap
+		laps := uint64(rapid.IntRange(0, 3).Draw(t, "laps"))
+		start := laps*QueueCapacity + QueueCapacity - uint64(rapid.IntRange(1, 64).Draw(t, "offset"))
+		q.header.ProducerHead = start
+		q.header.ConsumerTail = start
+
+		m := &ringModel{q: q, nextID: 1, maxBatch: 128}
+		m.run(t)
+	})
+}
+
+// concurrentRun has a producer goroutine and the consumer race over q with
+// random batch sizes and pauses, drawn up front since rapid draws from one
+// goroutine only. The consumer must see every id once, in order, and never
+// more than Capacity in flight.
+func concurrentRun(t *rapid.T, q OrderQueue, maxBatch int) {
+	n := rapid.IntRange(1, 4096).Draw(t, "orders")
+	produce := rapid.SliceOfN(rapid.IntRange(1, maxBatch), 1, 64).Draw(t, "produce")
+	consume := rapid.SliceOfN(rapid.IntRange(1, maxBatch), 1, 64).Draw(t, "consume")
+
+	errs := make(chan error, 1)
+	stop := make(chan struct{})
+	defer func() {
+		close(stop)
+		<-errs // before q is closed under the producer
+	}()
+	go func() {
+		defer close(errs)
+		id := uint64(1)
+		for i := 0; id <= uint64(n); i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for range produce[i%len(produce)] {
+				if id > uint64(n) {
+					break
+				}
+				err := q.Enqueue(Order{OrderID: id})
+				if errors.Is(err, ErrQueueFull) {
+					break
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				id++
+			}
+			runtime.Gosched()
+		}
+	}()
+
+	want := uint64(1)
+	for i := 0; want <= uint64(n); i++ {
+		for range consume[i%len(consume)] {
+			if d := q.Depth(); d > q.Capacity() {
+				t.Fatalf("depth %d above capacity %d", d, q.Capacity())
+			}
+			order, err := q.Dequeue()
+			if err != nil {
+				t.Fatalf("dequeue: %v", err)
+			}
+			if order == nil {
+				select {
+				case err := <-errs:
+					if err != nil {
+						t.Fatalf("enqueue: %v", err)
+					}
+				default:
+				}
+				break
+			}
+			if order.OrderID != want {
+				t.Fatalf("got order %d, want %d", order.OrderID, want)
+			}
+			want++
+		}
+		runtime.Gosched()
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if order, err := q.Dequeue(); order != nil || err != nil {
+		t.Fatalf("drained ring gave %+v %v", order, err)
+	}
+}
+
+func TestRingConcurrentInMemory(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		capacity := rapid.IntRange(1, 17).Draw(t, "capacity")
+		concurrentRun(t, NewInMemory(capacity), 2*capacity+1)
+	})
+}
+
+func TestRingConcurrentMmap(t *testing.T) {
+	dir := t.TempDir()
+	rapid.Check(t, func(t *rapid.T) {
+		q, err := CreateQueue(filepath.Join(dir, "queue"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer q.Close()
+		start := QueueCapacity - uint64(rapid.IntRange(1, 64).Draw(t, "offset"))
+		q.header.ProducerHead = start
+		q.header.ConsumerTail = start
+		concurrentRun(t, q, 128)
+	})
+}
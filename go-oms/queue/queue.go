@@ -1,36 +1,19 @@
 package queue
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"unsafe"
 	"github.com/edsrzf/mmap-go"
 )
 
-type Order struct {
-	// All uint64s first (8-byte aligned)
-	OrderID   uint64
-	Price     uint64
-	Timestamp uint64
-	// Then uint32s (4-byte aligned)
-	ClientID uint32
-	Quantity uint32
-	Symbol uint32
-	// Then uint8s (1-byte aligned)
-	Side   uint8 // 0=buy, 1=sell
-	Status uint8 // 0=pending, 1=filled, 2=rejected
-	// Array of bytes last
-	
-}
-
-type QueueHeader struct {
-	ProducerHead uint64   // Offset 0 4 byte interger 
-	_pad1        [56]byte // Padding to cache line
-	ConsumerTail uint64   // Offset 64
-	_pad2        [56]byte // Padding
-	Magic        uint32   // Offset 128
-	Capacity     uint32   // Offset 132
+// Expired reports whether a GTD/GTT order has reached its ExpireAt at now
+// (unix nanos). GTC orders never expire.
+func (o *Order) Expired(now uint64) bool {
+	return o.TimeInForce != TIFGoodTillCancel && o.ExpireAt != 0 && now >= o.ExpireAt
 }
 
 const (
@@ -41,20 +24,88 @@ const (
 	TotalSize     = HeaderSize + (QueueCapacity * OrderSize)
 )
 
+var (
+	// ErrQueueFull is returned by Enqueue when the consumer has not freed a slot.
+	ErrQueueFull = errors.New("queue full")
+	// ErrCorruptedIndices means the head/tail pair cannot describe a valid ring.
+	ErrCorruptedIndices = errors.New("corrupted queue indices")
+	// ErrCorruptedOrder means a published slot holds values no producer writes.
+	ErrCorruptedOrder = errors.New("corrupted order detected")
+)
+
+// OrderQueue is the surface shared by the mmap-backed Queue and the in-memory
+// queue, so code built on top of a queue can be tested without touching /tmp.
+type OrderQueue interface {
+	Enqueue(order Order) error
+	Dequeue() (*Order, error)
+	Depth() uint64
+	Capacity() uint64
+	Close() error
+}
+
+var _ OrderQueue = (*Queue)(nil)
+
+// Sequencer is a queue that reports the slot sequence each order was
+// published at, so a producer can line its own records (acks, gap reports,
+// WAL entries) up with the ring without keeping a counter of its own.
+// Queue, MemQueue and SegmentedQueue implement it.
+type Sequencer interface {
+	OrderQueue
+	EnqueueSeq(order Order) (uint64, error)
+}
+
+var _ Sequencer = (*Queue)(nil)
+
 type Queue struct {
 	file   *os.File
 	mmap   mmap.MMap   // this is the array of bytes wich we will use to read and write 
 	header *QueueHeader
 	orders []Order
+	swap   bool // file was written on a host with the opposite byte order
+	decode bool // slots are read through slot: swap, or an older slot layout
+	alerts depthAlerts
+	// nonTemporal writes slots with cache-bypassing stores; see SetNonTemporal
+	nonTemporal bool
+	lock        *os.File // held shared while attached to a stream; see stream.go
+	entry       *Attachment // this queue's registry entry, nil if unregistered; see attach.go
+	roles       uint32      // roles already marked in entry; atomic, see markRole
+	// stop and wait for RecordHistory's goroutine; see history.go
+	historyStop chan struct{}
+	historyDone chan struct{}
+	watchers    depthWatchers // WatchDepth goroutines; see watch.go
+	layout      Layout        // the file's; older ones lack later header fields, see layout.go
 }
 
+// CreateQueue creates a queue file with the default CreateOptions.
 func CreateQueue(filePath string) (*Queue, error) {
+	return CreateQueueWith(filePath, CreateOptions{})
+}
+
+// CreateQueueWith creates (replacing any existing file) and maps a queue
+// file with the given ownership and permissions.
+func CreateQueueWith(filePath string, opts CreateOptions) (*Queue, error) {
+	opts = opts.withDefaults()
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	if err := ValidatePath(filePath); err != nil {
+		return nil, err
+	}
+	if err := opts.prepareDir(filepath.Dir(filePath)); err != nil {
+		return nil, err
+	}
+
 	_ = os.Remove(filePath)
 
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o666)
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, opts.Mode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
+	if err := opts.apply(file); err != nil {
+		file.Close()
+		os.Remove(filePath)
+		return nil, err
+	}
 
 	// set the size of the file
 	if err := file.Truncate(int64(TotalSize)); err != nil {
@@ -67,8 +118,13 @@ func CreateQueue(filePath string) (*Queue, error) {
 		file.Close()
 		return nil, fmt.Errorf("failed to sync file: %w", err)
 	}
+	return initQueue(file)
+}
+
+// initQueue maps a new, zeroed queue file and writes its header.
+func initQueue(file *os.File) (*Queue, error) {
 	// m is just a byte array that is mapped to the real file on the Ram 
-	m, err := mmap.Map(file, mmap.RDWR, 0)
+	m, err := mapFile(file, mmap.RDWR)
 	if err != nil {
 		file.Close()
 		return nil, fmt.Errorf("failed to mmap: %w", err)
@@ -86,6 +142,7 @@ func CreateQueue(filePath string) (*Queue, error) {
 	atomic.StoreUint64(&header.ConsumerTail, 0)
 	atomic.StoreUint32(&header.Magic, QueueMagic)
 	atomic.StoreUint32(&header.Capacity, QueueCapacity)
+	atomic.StoreUint32(&header.ByteOrder, ByteOrderMark)
 
 	// flush to disk
 	if err := m.Flush(); err != nil {
@@ -104,113 +161,373 @@ func CreateQueue(filePath string) (*Queue, error) {
 	}
 	orders := unsafe.Slice((*Order)(unsafe.Pointer(&ordersData[0])), QueueCapacity)
 
-	return &Queue{
+	q := &Queue{
 		file:   file,
 		mmap:   m,
 		header: header,
 		orders: orders,
-	}, nil
-
+		nonTemporal: defaultNonTemporal,
+		layout: CurrentLayout,
+	}
+	q.attach()
+	return q, nil
 }
 
 // open queue from file on disk and return *Queue mmap-ed
 func OpenQueue(filePath string) (*Queue, error) {
-	file, err := os.OpenFile(filePath, os.O_RDWR, 0o666)
+	return openQueue(filePath, false, false)
+}
+
+// OpenQueueForeign is like OpenQueue but also accepts files written on a host
+// with the opposite byte order (e.g. captures replayed on another arch).
+// Orders and indices of such files are byte-swapped on the way out.
+func OpenQueueForeign(filePath string) (*Queue, error) {
+	return openQueue(filePath, true, false)
+}
+
+func openQueueFile(filePath string, allowForeign, readOnly bool) (*Queue, error) {
+	if err := ValidatePath(filePath); err != nil {
+		return nil, err
+	}
+	fileFlag := os.O_RDWR
+	if readOnly {
+		fileFlag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(filePath, fileFlag, 0o666)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	return mapQueue(file, allowForeign, readOnly)
+}
 
+// mapQueue maps an open queue file and validates its header.
+func mapQueue(file *os.File, allowForeign, readOnly bool) (*Queue, error) {
+	mapProt := mmap.RDWR
+	if readOnly {
+		mapProt = mmap.RDONLY
+	}
 	// verify file size
 	stat, err := file.Stat()
 	if err != nil {
 		file.Close()
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
-	if stat.Size() != int64(TotalSize) {
+	layout, ok := layoutOf(stat.Size())
+	if !ok {
 		file.Close()
 		return nil, fmt.Errorf("invalid file size: got %d, expected %d", stat.Size(), int64(TotalSize))
 	}
+	if layout != CurrentLayout && !allowForeign {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s, this build writes %s (open it read-only, or compact it to upgrade)", ErrOldLayout, layout, CurrentLayout)
+	}
 
-	m, err := mmap.Map(file, mmap.RDWR, 0)
+	m, err := mapFile(file, mapProt)
 	if err != nil {
 		file.Close()
 		return nil, fmt.Errorf("failed to mmap: %w", err)
 	}
 
-	if err := m.Lock(); err != nil {
-		// non-fatal; continue without lock
+	// viewers do not need the ring resident
+	if !readOnly {
+		if err := m.Lock(); err != nil {
+			// non-fatal; continue without lock
+		}
 	}
 
 	// validate header
 	header := (*QueueHeader)(unsafe.Pointer(&m[0]))
-	if atomic.LoadUint32(&header.Magic) != QueueMagic {
+	swap := false
+	if layout.hasByteOrder() {
+		swap, err = checkByteOrder(atomic.LoadUint32(&header.ByteOrder), allowForeign)
+		if err != nil {
+			m.Unlock()
+			m.Unmap()
+			file.Close()
+			return nil, err
+		}
+	}
+	if swap32(atomic.LoadUint32(&header.Magic), swap) != QueueMagic {
 		m.Unlock()
 		m.Unmap()
 		file.Close()
 		return nil, fmt.Errorf("invalid queue magic number")
 	}
-	if atomic.LoadUint32(&header.Capacity) != QueueCapacity {
+	if capacity := swap32(atomic.LoadUint32(&header.Capacity), swap); capacity != QueueCapacity {
 		m.Unlock()
 		m.Unmap()
 		file.Close()
-		return nil, fmt.Errorf("capacity mismatch: file=%d code=%d", header.Capacity, QueueCapacity)
+		return nil, fmt.Errorf("capacity mismatch: file=%d code=%d", capacity, QueueCapacity)
+	}
+	producerHead := swap64(atomic.LoadUint64(&header.ProducerHead), swap)
+	consumerTail := swap64(atomic.LoadUint64(&header.ConsumerTail), swap)
+	if producerHead < consumerTail || producerHead-consumerTail > QueueCapacity {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
+		return nil, fmt.Errorf("%w: head=%d tail=%d", ErrCorruptedIndices, producerHead, consumerTail)
 	}
 
-	ordersData := m[int(HeaderSize):int(TotalSize)]
+	// an older layout's ring starts where its shorter header ends
+	ordersData := m[int(layout.HeaderSize):int(layout.Size())]
 	if len(ordersData) == 0 {
 		m.Unlock()
 		m.Unmap()
 		file.Close()
 		return nil, fmt.Errorf("orders region empty")
 	}
-	orders := unsafe.Slice((*Order)(unsafe.Pointer(&ordersData[0])), QueueCapacity)
+	var orders []Order
+	if layout.slot == nil {
+		orders = unsafe.Slice((*Order)(unsafe.Pointer(&ordersData[0])), QueueCapacity)
+	}
 
-	return &Queue{
+	q := &Queue{
 		file:   file,
 		mmap:   m,
 		header: header,
 		orders: orders,
-	}, nil
+		swap:   swap,
+		decode: swap || layout.slot != nil,
+		nonTemporal: defaultNonTemporal,
+		layout: layout,
+	}
+	// viewers, foreign captures and old layouts stay out of the registry
+	if !readOnly && !swap && layout.hasRegistry() {
+		q.attach()
+	}
+	return q, nil
 }
 
+// errBackpressure is built once: a full ring is exactly when the producer
+// retries in a tight loop, and formatting an error per attempt would allocate.
+var errBackpressure = fmt.Errorf("%w - consumer too slow, backpressure at depth %d/%d",
+	ErrQueueFull, QueueCapacity+1, QueueCapacity)
+
 func (q *Queue) Enqueue(order Order) error {
+	_, err := q.EnqueueSeq(order)
+	return err
+}
+
+// EnqueueSeq is Enqueue that also returns the slot sequence the order was
+// published at: the producer head before the publish, which counts every
+// order ever enqueued on the file. The consumer releases the order at the
+// same number, ReadOnlyQueue.Follow resumes from it, and a gap between two
+// sequences a producer got back is orders another writer slipped in.
+func (q *Queue) EnqueueSeq(order Order) (uint64, error) {
+	if q.decode {
+		if q.swap {
+			return 0, ErrForeignByteOrder
+		}
+		return 0, fmt.Errorf("%w: %s slots", ErrOldLayout, q.layout)
+	}
+	if atomic.LoadUint32(&q.roles)&RoleProducer == 0 {
+		q.markRole(RoleProducer)
+	}
 	consumerTail := atomic.LoadUint64(&q.header.ConsumerTail)
 	producerHead := atomic.LoadUint64(&q.header.ProducerHead)
 
 	nextHead := producerHead + 1
 	if nextHead-consumerTail > QueueCapacity {
-		return fmt.Errorf("queue full - consumer too slow, backpressure at depth %d/%d",
-			nextHead-consumerTail, QueueCapacity)
+		q.alerts.check(QueueCapacity, QueueCapacity)
+		return 0, errBackpressure
 	}
 
 	pos := producerHead % QueueCapacity
-	q.orders[pos] = order
+	if q.nonTemporal {
+		writeSlotNT(&q.orders[pos], &order)
+		storeFence()
+	} else {
+		q.orders[pos] = order
+	}
+	publishFault(&q.orders[pos], producerHead)
 
 	// Publish after write; seq-cst store is sufficient
 	atomic.StoreUint64(&q.header.ProducerHead, nextHead)
-	return nil
+	q.alerts.check(nextHead-consumerTail, QueueCapacity)
+	return producerHead, nil
+}
+
+// SetNonTemporal switches slot writes to non-temporal stores, which go to
+// memory without pulling the slot into the producer's cache: the producer
+// never reads a slot back, so caching it only evicts the producer's own
+// working set. A store fence orders the slot before the producer head is
+// published, which stays a normal store. It reports whether the mode is
+// available; only amd64 has it. Queues start in the mode chosen by the
+// slotcopy_nt build tag, off by default.
+//
+// It is a trade-off, not a free win: slots straddle cache lines, so each
+// publish flushes partially written lines and the enqueue itself gets
+// several times slower. It pays off only when the producer's own state is
+// what is missing the cache; BenchmarkEnqueueCachePressure measures both.
+func (q *Queue) SetNonTemporal(on bool) bool {
+	q.nonTemporal = on && haveNonTemporal
+	return q.nonTemporal == on
+}
+
+// OnDepthThreshold calls fn each time the fill fraction crosses pct (0..1),
+// once on the way up and once on the way down, so a gateway can shed load
+// before the ring is full. Depth is sampled by Enqueue and PollDepth; fn
+// runs synchronously on the producer and should be quick. Register from the
+// producer goroutine before enqueueing.
+func (q *Queue) OnDepthThreshold(pct float64, fn func(DepthEvent)) {
+	q.alerts.add(pct, fn)
+}
+
+// PollDepth re-evaluates the thresholds without enqueueing, so an idle
+// producer still sees the consumer drain the ring.
+func (q *Queue) PollDepth() {
+	q.alerts.check(q.Depth(), QueueCapacity)
 }
 
 func (q *Queue) Dequeue() (*Order, error) {
+	if atomic.LoadUint32(&q.roles)&RoleConsumer == 0 {
+		q.markRole(RoleConsumer)
+	}
+	if q.decode {
+		return q.dequeueDecoded()
+	}
 	producerHead := atomic.LoadUint64(&q.header.ProducerHead)
 	consumerTail := atomic.LoadUint64(&q.header.ConsumerTail)
 
 	if consumerTail == producerHead {
 		return nil, nil
 	}
+	if producerHead-consumerTail > QueueCapacity {
+		return nil, ErrCorruptedIndices
+	}
 
 	pos := consumerTail % QueueCapacity
 	order := q.orders[pos]
+	if order.Side > 1 {
+		return nil, ErrCorruptedOrder
+	}
 
 	// Mark consumed; seq-cst store is sufficient
-	atomic.StoreUint64(&q.header.ConsumerTail, consumerTail+1)
+	if !ackDropped(consumerTail) {
+		atomic.StoreUint64(&q.header.ConsumerTail, consumerTail+1)
+	}
 	return &order, nil
 }
 
-func (q *Queue) Depth() uint64 {
+// prefetchAhead is how many slots DequeueUpTo prefetches ahead of the one
+// it copies: far enough to cover memory latency at a few ns per order,
+// near enough not to evict what it has not read yet.
+const prefetchAhead = 8
+
+// DequeueUpTo appends up to n orders to dst and returns it, releasing them
+// with a single consumer tail store. It prefetches the slots ahead of the
+// copy and allocates nothing when dst has room, which is what lets a Go
+// consumer keep pace with the Rust producer on reverse-direction queues.
+// On a corrupted order it returns the orders before it with
+// ErrCorruptedOrder; the corrupted slot is not consumed.
+func (q *Queue) DequeueUpTo(n int, dst []Order) ([]Order, error) {
+	if atomic.LoadUint32(&q.roles)&RoleConsumer == 0 {
+		q.markRole(RoleConsumer)
+	}
+	if q.decode {
+		// replaying a capture, not racing a producer: one at a time
+		for range max(n, 0) {
+			order, err := q.dequeueDecoded()
+			if order == nil || err != nil {
+				return dst, err
+			}
+			dst = append(dst, *order)
+		}
+		return dst, nil
+	}
 	producerHead := atomic.LoadUint64(&q.header.ProducerHead)
 	consumerTail := atomic.LoadUint64(&q.header.ConsumerTail)
-	return producerHead - consumerTail
+	if producerHead-consumerTail > QueueCapacity {
+		return dst, ErrCorruptedIndices
+	}
+
+	end := min(producerHead, consumerTail+uint64(max(n, 0)))
+	for next := consumerTail; next < min(end, consumerTail+prefetchAhead); next++ {
+		prefetch(unsafe.Pointer(&q.orders[next%QueueCapacity]))
+	}
+	var err error
+	tail := consumerTail
+	for ; tail < end; tail++ {
+		if ahead := tail + prefetchAhead; ahead < end {
+			prefetch(unsafe.Pointer(&q.orders[ahead%QueueCapacity]))
+		}
+		order := q.orders[tail%QueueCapacity]
+		if order.Side > 1 {
+			err = ErrCorruptedOrder
+			break
+		}
+		dst = append(dst, order)
+	}
+	if tail != consumerTail && !ackDropped(consumerTail) {
+		atomic.StoreUint64(&q.header.ConsumerTail, tail)
+	}
+	return dst, err
+}
+
+// Peek returns the next order without consuming it, or nil if the queue is
+// empty. Consumers that must record an order before releasing its slot call
+// Advance once the order is safely handled, so a crash in between replays it.
+func (q *Queue) Peek() (*Order, error) {
+	producerHead := swap64(atomic.LoadUint64(&q.header.ProducerHead), q.swap)
+	consumerTail := swap64(atomic.LoadUint64(&q.header.ConsumerTail), q.swap)
+
+	if consumerTail == producerHead {
+		return nil, nil
+	}
+	if producerHead-consumerTail > QueueCapacity {
+		return nil, ErrCorruptedIndices
+	}
+
+	order := q.slot(consumerTail)
+	if order.Side > 1 {
+		return nil, ErrCorruptedOrder
+	}
+	return &order, nil
+}
+
+// Advance releases the slot returned by the last Peek.
+func (q *Queue) Advance() {
+	if atomic.LoadUint32(&q.roles)&RoleConsumer == 0 {
+		q.markRole(RoleConsumer)
+	}
+	consumerTail := swap64(atomic.LoadUint64(&q.header.ConsumerTail), q.swap)
+	if ackDropped(consumerTail) {
+		return
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, swap64(consumerTail+1, q.swap))
+}
+
+// ProducerHead is the number of orders published so far.
+func (q *Queue) ProducerHead() uint64 {
+	return swap64(atomic.LoadUint64(&q.header.ProducerHead), q.swap)
+}
+
+// Recent copies up to n of the most recently published slots, oldest first,
+// whether or not they have been consumed. It is meant for monitoring: a slot
+// can be overwritten while it is copied if the ring laps during the call.
+func (q *Queue) Recent(n int) []Order {
+	head := q.ProducerHead()
+	n = int(min(uint64(n), head, QueueCapacity))
+	out := make([]Order, n)
+	for i := range out {
+		out[i] = q.slot(head - uint64(n) + uint64(i))
+	}
+	return out
+}
+
+// ConsumerTail is the number of orders the consumer has released so far.
+func (q *Queue) ConsumerTail() uint64 {
+	return swap64(atomic.LoadUint64(&q.header.ConsumerTail), q.swap)
+}
+
+// Depth is safe to call from any goroutine or process. The tail is loaded
+// before the head, so a consumer advancing in between cannot pass the head
+// and wrap the difference; a producer filling in between can stretch it,
+// so it is capped at the capacity.
+func (q *Queue) Depth() uint64 {
+	consumerTail := swap64(atomic.LoadUint64(&q.header.ConsumerTail), q.swap)
+	producerHead := swap64(atomic.LoadUint64(&q.header.ProducerHead), q.swap)
+	return min(producerHead-consumerTail, QueueCapacity)
 }
 
 func (q *Queue) Capacity() uint64 {
@@ -222,6 +539,12 @@ func (q *Queue) Flush() error {
 }
 
 func (q *Queue) Close() error {
+	if q.lock != nil {
+		defer q.lock.Close()
+	}
+	q.stopHistory()
+	q.watchers.close()
+	q.detach()
 	_ = q.mmap.Flush()
 	_ = q.mmap.Unlock()
 	if err := q.mmap.Unmap(); err != nil {
@@ -0,0 +1,105 @@
+package queue
+
+// ReadOnlyQueue is a view of a queue file mapped without write permission,
+// for monitoring and dump tools. It has no Enqueue, Dequeue or Advance, and
+// the mapping itself is read-only, so even a bug in the tool faults instead
+// of corrupting the ring for the producer and consumer.
+type ReadOnlyQueue struct {
+	q *Queue
+}
+
+// Stats is a point-in-time view of a queue's indices.
+type Stats struct {
+	ProducerHead uint64 // orders published so far
+	ConsumerTail uint64 // orders consumed so far
+	Depth        uint64
+	Capacity     uint64
+}
+
+// OpenQueueReadOnly maps the queue at path read-only. Files in either byte
+// order are accepted; orders and indices come out in this host's order.
+func OpenQueueReadOnly(path string) (*ReadOnlyQueue, error) {
+	q, err := openQueue(path, true, true)
+	if err != nil {
+		return nil, err
+	}
+	return &ReadOnlyQueue{q: q}, nil
+}
+
+func (r *ReadOnlyQueue) Depth() uint64        { return r.q.Depth() }
+func (r *ReadOnlyQueue) Capacity() uint64     { return r.q.Capacity() }
+func (r *ReadOnlyQueue) ProducerHead() uint64 { return r.q.ProducerHead() }
+func (r *ReadOnlyQueue) ConsumerTail() uint64 { return r.q.ConsumerTail() }
+
+// Stats reads both indices. The producer and consumer keep moving, so the
+// values are only consistent with each other to within a few orders.
+func (r *ReadOnlyQueue) Stats() Stats {
+	tail := r.q.ConsumerTail()
+	head := r.q.ProducerHead()
+	return Stats{
+		ProducerHead: head,
+		ConsumerTail: tail,
+		Depth:        head - min(tail, head),
+		Capacity:     QueueCapacity,
+	}
+}
+
+// Peek returns a copy of the next order the consumer will take, or nil if
+// the queue is empty.
+func (r *ReadOnlyQueue) Peek() (*Order, error) {
+	return r.q.Peek()
+}
+
+// Recent copies up to n of the most recently published slots, oldest first;
+// see Queue.Recent.
+func (r *ReadOnlyQueue) Recent(n int) []Order {
+	return r.q.Recent(n)
+}
+
+// Unconsumed copies up to n orders the consumer has not taken yet, oldest
+// first. Like Recent it is a dump, not a consistent snapshot: slots the
+// consumer releases during the call may be rewritten by the producer.
+func (r *ReadOnlyQueue) Unconsumed(n int) []Order {
+	s := r.Stats()
+	n = int(min(uint64(n), s.Depth))
+	out := make([]Order, n)
+	for i := range out {
+		out[i] = r.q.slot(s.ConsumerTail + uint64(i))
+	}
+	return out
+}
+
+// Follow copies orders published from seq on, up to len(dst), so a
+// monitor can see every order go by without consuming any. Pass the
+// returned next as seq on the following call, starting from ProducerHead.
+// A consumer that lets the producer lap the follower, by releasing slots
+// it has not read yet, costs it those orders; lost counts them.
+func (r *ReadOnlyQueue) Follow(seq uint64, dst []Order) (out []Order, next, lost uint64) {
+	head := r.q.ProducerHead()
+	if seq > head {
+		return dst[:0], head, 0 // the queue was recreated under us
+	}
+	// the producer may be writing slot head already, so the oldest order
+	// intact is head-QueueCapacity+1
+	if head-seq >= QueueCapacity {
+		lost = head - QueueCapacity + 1 - seq
+		seq += lost
+	}
+	n := min(head-seq, uint64(len(dst)))
+	for i := range n {
+		dst[i] = r.q.slot(seq + i)
+	}
+	// and if it moved on while we copied, so may some of the copies be
+	if after := r.q.ProducerHead(); after >= seq+QueueCapacity {
+		torn := min(after-QueueCapacity+1-seq, n)
+		copy(dst, dst[torn:n])
+		n -= torn
+		lost += torn
+		seq += torn
+	}
+	return dst[:n], seq + n, lost
+}
+
+func (r *ReadOnlyQueue) Close() error {
+	return r.q.Close()
+}
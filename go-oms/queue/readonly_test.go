@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+)
+
+func TestReadOnlyQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	q, err := CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	for id := uint64(1); id <= 5; id++ {
+		q.Enqueue(Order{OrderID: id, Quantity: 1, Price: 1})
+	}
+	q.Dequeue()
+
+	r, err := OpenQueueReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if s := r.Stats(); s != (Stats{ProducerHead: 5, ConsumerTail: 1, Depth: 4, Capacity: QueueCapacity}) {
+		t.Fatalf("stats %+v", s)
+	}
+	if o, err := r.Peek(); err != nil || o.OrderID != 2 || r.Depth() != 4 {
+		t.Fatalf("peek %+v %v consumed a slot", o, err)
+	}
+	if got := r.Unconsumed(10); len(got) != 4 || got[0].OrderID != 2 || got[3].OrderID != 5 {
+		t.Fatalf("unconsumed %+v", got)
+	}
+
+	// the mapping itself must refuse writes
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	faulted := func() (faulted bool) {
+		defer func() { faulted = recover() != nil }()
+		r.q.header.ConsumerTail = 0
+		return false
+	}()
+	if !faulted || q.ConsumerTail() != 1 {
+		t.Fatal("write through the read-only mapping succeeded")
+	}
+}
+
+func TestReadOnlyFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+	q, err := CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	r, err := OpenQueueReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	buf := make([]Order, 3)
+	seq := r.ProducerHead()
+	for id := uint64(1); id <= 4; id++ {
+		q.Enqueue(Order{OrderID: id, Quantity: 1, Price: 1})
+	}
+	q.Dequeue() // consuming does not hide orders from a follower
+	got, seq, lost := r.Follow(seq, buf)
+	if len(got) != 3 || got[0].OrderID != 1 || seq != 3 || lost != 0 {
+		t.Fatalf("follow %+v, next %d, lost %d", got, seq, lost)
+	}
+	if got, seq, _ = r.Follow(seq, buf); len(got) != 1 || got[0].OrderID != 4 || seq != 4 {
+		t.Fatalf("follow %+v, next %d", got, seq)
+	}
+
+	// lapped: of the last QueueCapacity slots, the one the producer fills
+	// next cannot be trusted
+	for id := uint64(5); id <= QueueCapacity+10; id++ {
+		q.Enqueue(Order{OrderID: id, Quantity: 1, Price: 1})
+		q.Dequeue()
+	}
+	got, seq, lost = r.Follow(seq, buf)
+	if lost != 7 || len(got) != 3 || got[0].OrderID != 12 || seq != 14 {
+		t.Fatalf("lapped follow %d orders from %d, next %d, lost %d", len(got), got[0].OrderID, seq, lost)
+	}
+}
@@ -0,0 +1,60 @@
+package queue
+
+//go:generate go run gen_reasons.go
+//go:generate go run gen_schema.go
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ReasonName returns the canonical name of a reject reason, as listed in
+// reasons.json, e.g. "session_closed".
+func ReasonName(reason uint8) string {
+	if int(reason) < len(reasonNames) {
+		return reasonNames[reason]
+	}
+	return fmt.Sprintf("reason(%d)", reason)
+}
+
+// ParseReason is the inverse of ReasonName.
+func ParseReason(name string) (uint8, error) {
+	for i, n := range reasonNames {
+		if n == name {
+			return uint8(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown reject reason %q", name)
+}
+
+// RejectError is a refusal sentinel that carries its reject reason. Packages
+// declare their refusals with NewReject so ReasonOf can classify an error
+// however deeply it is wrapped.
+type RejectError struct {
+	Reason uint8
+	msg    string
+}
+
+// NewReject returns a sentinel error for refusals with the given reason.
+func NewReject(reason uint8, msg string) error {
+	return &RejectError{Reason: reason, msg: msg}
+}
+
+func (e *RejectError) Error() string { return e.msg }
+
+// RejectReason implements the interface ReasonOf looks for.
+func (e *RejectError) RejectReason() uint8 { return e.Reason }
+
+// ReasonOf maps an error refusing an order to the reason reported in its
+// StatusRejected record: the first error in the chain with a
+// RejectReason() uint8 method decides; anything else is ReasonValidation.
+func ReasonOf(err error) uint8 {
+	if err == nil {
+		return ReasonNone
+	}
+	var r interface{ RejectReason() uint8 }
+	if errors.As(err, &r) {
+		return r.RejectReason()
+	}
+	return ReasonValidation
+}
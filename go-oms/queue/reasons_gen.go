@@ -0,0 +1,40 @@
+// Code generated by gen_reasons.go; DO NOT EDIT.
+
+package queue
+
+// Order.Reason values, set on StatusRejected records.
+const (
+	ReasonNone              uint8 = 0  // not rejected
+	ReasonValidation        uint8 = 1  // malformed order or failed a static instrument rule
+	ReasonRisk              uint8 = 2  // failed a pre- or post-trade risk limit
+	ReasonSessionClosed     uint8 = 3  // the trading session is not open
+	ReasonThrottled         uint8 = 4  // shed by a rate limit or load threshold
+	ReasonUnknownSymbol     uint8 = 5  // symbol not in the reference data
+	ReasonKilled            uint8 = 6  // the client's kill switch is engaged
+	ReasonInvalidFlags      uint8 = 7  // execution flags not valid for the order type
+	ReasonDuplicateID       uint8 = 8  // order id reused or not increasing
+	ReasonUnknownOrder      uint8 = 9  // cancel for an order that is not open
+	ReasonEngine            uint8 = 10 // refused by the matching engine
+	ReasonNoLocate          uint8 = 11 // short sale without a locate for the shares
+	ReasonLocateUnavailable uint8 = 12 // the locate source could not be asked; the short sale may be retried
+	ReasonPriceBand         uint8 = 13 // priced through the symbol's limit up-limit down band
+	ReasonQuoteExpired      uint8 = 14 // quote hit after it expired or was already traded
+)
+
+var reasonNames = [...]string{
+	"none",
+	"validation",
+	"risk",
+	"session_closed",
+	"throttled",
+	"unknown_symbol",
+	"killed",
+	"invalid_flags",
+	"duplicate_id",
+	"unknown_order",
+	"engine",
+	"no_locate",
+	"locate_unavailable",
+	"price_band",
+	"quote_expired",
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestReasonOf(t *testing.T) {
+	errClosed := NewReject(ReasonSessionClosed, "closed")
+	for err, want := range map[error]uint8{
+		nil:                                     ReasonNone,
+		errors.New("bad"):                       ReasonValidation,
+		fmt.Errorf("gate: %w", errClosed):       ReasonSessionClosed,
+		fmt.Errorf("%w: 0x80", ErrInvalidFlags): ReasonInvalidFlags,
+	} {
+		if got := ReasonOf(err); got != want {
+			t.Errorf("ReasonOf(%v) = %s, want %s", err, ReasonName(got), ReasonName(want))
+		}
+	}
+}
+
+// TestReasonsJSON catches a reasons.json left stale after editing the table
+// in gen_reasons.go: the Rust engine builds its constants from it.
+func TestReasonsJSON(t *testing.T) {
+	data, err := os.ReadFile("reasons.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var table []struct {
+		Code uint8
+		Name string
+	}
+	if err := json.Unmarshal(data, &table); err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != len(reasonNames) {
+		t.Fatalf("reasons.json has %d reasons, Go has %d; run go generate", len(table), len(reasonNames))
+	}
+	for _, r := range table {
+		if got, err := ParseReason(r.Name); err != nil || got != r.Code {
+			t.Errorf("%s: Go code %d, reasons.json %d; run go generate", r.Name, got, r.Code)
+		}
+	}
+}
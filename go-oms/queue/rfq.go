@@ -0,0 +1,64 @@
+package queue
+
+// Request for quote: a dealer-style flow alongside the order book, over the
+// same queue pair.
+//
+//  1. The client sends a QuoteRequest with an OrderID of its own.
+//  2. The engine answers on the status ring with a MsgQuote record under
+//     that OrderID, a firm Price and Quantity good until ExpireAt, or
+//     rejects the request with StatusRejected.
+//  3. The client trades the quote with a Hit, which carries the request's
+//     OrderID like a Cancel. The engine reports the trade as a fill of the
+//     request, a MsgNew record with StatusFilled, so positions, busts and
+//     fees treat it like any order's fill, then acks the hit. A hit on a
+//     quote that expired or was already traded is rejected with
+//     ReasonQuoteExpired.
+//
+// A quote the client lets expire closes the request without a record.
+
+// QuoteRequest returns a request for a firm price to trade quantity in
+// symbol on side. reference is the price the client expects, e.g. the mid;
+// the engine quotes around it.
+func QuoteRequest(orderID uint64, clientID, symbol uint32, side uint8, quantity uint32, reference, timestamp uint64) Order {
+	return Order{
+		OrderID:   orderID,
+		ClientID:  clientID,
+		Symbol:    symbol,
+		Side:      side,
+		Quantity:  quantity,
+		Price:     reference,
+		Timestamp: timestamp,
+		MsgType:   MsgQuoteRequest,
+	}
+}
+
+// Hit returns the message trading quote, a MsgQuote status record, for
+// quantity, or for all of it if quantity is 0. It carries the quote's
+// price, so the engine refuses it if the quote has since changed.
+func Hit(quote Order, quantity uint32, timestamp uint64) Order {
+	if quantity == 0 {
+		quantity = quote.Quantity
+	}
+	return Order{
+		OrderID:   quote.OrderID,
+		ClientID:  quote.ClientID,
+		Symbol:    quote.Symbol,
+		Side:      quote.Side,
+		Quantity:  quantity,
+		Price:     quote.Price,
+		Timestamp: timestamp,
+		MsgType:   MsgQuoteHit,
+	}
+}
+
+// QuoteLive reports whether a MsgQuote record may still be hit at now, in
+// unix nanos.
+func (o *Order) QuoteLive(now uint64) bool {
+	return o.MsgType == MsgQuote && (o.ExpireAt == 0 || now < o.ExpireAt)
+}
+
+// Trades reports whether o can execute: a new order or a quote hit. Risk
+// checks apply to these, while other control messages pass unchecked.
+func (o *Order) Trades() bool {
+	return o.MsgType == MsgNew || o.MsgType == MsgQuoteHit
+}
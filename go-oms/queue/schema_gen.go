@@ -0,0 +1,285 @@
+// Code generated by gen_schema.go from schema.json; DO NOT EDIT.
+
+package queue
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// Order is one 64-byte ring slot: orders, control messages and status
+// records all use it. Fields marked fingerprint are what Order.Fingerprint
+// hashes: what the producer asked for, not when it was sent or what the
+// engine made of it.
+type Order struct {
+	OrderID        uint64
+	Price          uint64
+	Timestamp      uint64
+	ExpireAt       uint64 // unix nanos; only meaningful for good-till-date and good-till-time
+	ClientID       uint32
+	Quantity       uint32
+	Symbol         uint32
+	Side           uint8  // 0=buy, 1=sell
+	Status         uint8  // status value; pending on the order ring
+	TimeInForce    uint8  // time-in-force value, good-till-cancel by default
+	MsgType        uint8  // message type, a new order by default or a control message
+	Flags          uint8  // execution instructions, flag bits
+	Reason         uint8  // reject reason on a rejected status record, see reasons.json
+	Liquidity      uint8  // liquidity value on a filled status record
+	SubAccount     uint8  // sub-account of the client the order is for, 0 for the client's own account; see refdata.Accounts
+	Fee            int32  // price units for the whole fill; negative is a rebate
+	ContraClientID uint32 // client on the other side of a fill, 0 if not disclosed
+	TriggerPrice   uint32 // stop trigger; Go holds stops until they trigger, so the engine ignores it
+}
+
+// Attachment is one process attached to a queue file, an entry in the
+// QueueHeader registry.
+type Attachment struct {
+	PID        uint32 // 0 while the entry is free
+	Roles      uint32 // Role bits for what the process has done with the queue so far
+	AttachedAt uint64 // unix nanos
+}
+
+// PIDNamespace identifies the PID namespace an Attachment's PID belongs to.
+type PIDNamespace struct {
+	Inode uint32 // inode of the attacher's /proc/self/ns/pid; 0 if unknown, as in files from before it was recorded
+}
+
+// DepthSample is one entry of the QueueHeader history ring, recorded by the
+// producer.
+type DepthSample struct {
+	At    uint64 // unix nanos
+	Depth uint32
+	Rate  uint32 // orders published per second since the sample before
+}
+
+// QueueHeader starts a queue file, with the producer and consumer indices
+// on separate cache lines.
+type QueueHeader struct {
+	ProducerHead uint64 // slots published so far
+	_pad1        [56]byte
+	ConsumerTail uint64 // slots released so far
+	_pad2        [56]byte
+	Magic        uint32
+	Capacity     uint32
+	ByteOrder    uint32          // byte order mark as written by the producer
+	AttachedNS   [8]PIDNamespace // the PID namespace of each Attached entry, for telling a dead process from one in another container; see attach.go
+	_pad3        [20]byte
+	Attached     [8]Attachment // processes attached to the file, claimed and reaped by each attacher; see attach.go
+	HistorySeq   uint64        // samples recorded so far; sample i is History[i % len(History)]
+	_pad4        [56]byte
+	History      [128]DepthSample // the last samples of depth and rate; see history.go
+}
+
+// Order.Status values. The consumer echoes orders back on the status queue
+// with one of the terminal values set.
+const (
+	StatusPending   uint8 = 0
+	StatusFilled    uint8 = 1
+	StatusRejected  uint8 = 2
+	StatusExpired   uint8 = 3
+	StatusCanceled  uint8 = 4
+	StatusAcked     uint8 = 5 // control message applied by the engine
+	StatusBusted    uint8 = 6 // fill reversed; carries the fill as it was
+	StatusCorrected uint8 = 7 // replacement fill after a bust; carries the new fill
+	StatusTriggered uint8 = 8 // stop order released to the engine by Go; never sent by the engine
+	StatusPartial   uint8 = 9 // part of the order filled; carries that fill, and the rest stays open until a record of its own closes it
+)
+
+// Order.MsgType values. Control messages share the order layout and ride
+// the same ring, so they are ordered with respect to the orders they act
+// on.
+const (
+	MsgNew             uint8 = 0
+	MsgCancelAll       uint8 = 1 // cancel every open order of the client
+	MsgCancelAllSymbol uint8 = 2 // cancel every open order in the symbol
+	MsgCancel          uint8 = 3 // cancel the single order with the order id
+	MsgResend          uint8 = 4 // status ring only: resend orders from the order id on
+	MsgBust            uint8 = 5 // reverse the fill of the order id
+	MsgCorrect         uint8 = 6 // replace the fill of the order id with price and quantity
+	MsgQuoteRequest    uint8 = 7 // ask for a firm price to trade quantity in the symbol on the side; Price is a reference, e.g. the mid
+	MsgQuote           uint8 = 8 // status ring only: a firm price for the quote request with the order id, good until ExpireAt
+	MsgQuoteHit        uint8 = 9 // trade the quote for the order id at its price, for up to its quantity
+)
+
+// Order.TimeInForce values. GTD and GTT both carry an absolute ExpireAt;
+// GTD producers set it to the end of the trading day.
+const (
+	TIFGoodTillCancel uint8 = 0
+	TIFGoodTillDate   uint8 = 1
+	TIFGoodTillTime   uint8 = 2
+)
+
+// Order.Liquidity values on fills.
+const (
+	LiquidityUnknown uint8 = 0
+	LiquidityMaker   uint8 = 1 // the order was resting and added liquidity
+	LiquidityTaker   uint8 = 2 // the order executed on arrival and removed liquidity
+)
+
+// refdata.Instrument.Type values. An order carries only Order.Symbol, so
+// each future or option contract is a symbol of its own and its terms live
+// in the reference data; the codes are shared so every side of the queue
+// reads them alike.
+const (
+	InstrumentEquity uint8 = 0
+	InstrumentFuture uint8 = 1 // delivers or settles the underlying at maturity
+	InstrumentCall   uint8 = 2 // option to buy the underlying at the strike
+	InstrumentPut    uint8 = 3 // option to sell the underlying at the strike
+)
+
+// Order.Flags bits: execution instructions for new orders. The engine
+// rejects an order whose flags are not valid, so producers should check
+// first.
+const (
+	FlagPostOnly    uint8 = 1 << 0 // rest on the book only; rejected if it would take liquidity
+	FlagReduceOnly  uint8 = 1 << 1 // may only reduce the client's position in the symbol
+	FlagHidden      uint8 = 1 << 2 // rests without showing in market data
+	FlagAllOrNone   uint8 = 1 << 3 // fills in one execution for the whole quantity, or not at all
+	FlagShort       uint8 = 1 << 4 // sell short: the client does not own the shares, so the broker needs a locate first; sells only
+	FlagShortExempt uint8 = 1 << 5 // short sale exempt from the locate requirement, e.g. a market maker's; sells only, not with short
+
+	// FlagsKnown is every bit defined above; other bits are invalid.
+	FlagsKnown = FlagPostOnly | FlagReduceOnly | FlagHidden | FlagAllOrNone | FlagShort | FlagShortExempt
+)
+
+var flagNames = [...]string{"post_only", "reduce_only", "hidden", "all_or_none", "short", "short_exempt"}
+
+// Attachment.Roles bits, set the first time a process publishes to or
+// consumes from the queue.
+const (
+	RoleProducer uint32 = 1 << 0
+	RoleConsumer uint32 = 1 << 1
+
+	// RolesKnown is every bit defined above; other bits are invalid.
+	RolesKnown = RoleProducer | RoleConsumer
+)
+
+var roleNames = [...]string{"producer", "consumer"}
+
+// SwapOrder returns o with every multi-byte field byte-swapped. It is its own
+// inverse, so it serves both to decode foreign captures and to produce them.
+func SwapOrder(o Order) Order {
+	o.OrderID = bits.ReverseBytes64(o.OrderID)
+	o.Price = bits.ReverseBytes64(o.Price)
+	o.Timestamp = bits.ReverseBytes64(o.Timestamp)
+	o.ExpireAt = bits.ReverseBytes64(o.ExpireAt)
+	o.ClientID = bits.ReverseBytes32(o.ClientID)
+	o.Quantity = bits.ReverseBytes32(o.Quantity)
+	o.Symbol = bits.ReverseBytes32(o.Symbol)
+	o.Fee = int32(bits.ReverseBytes32(uint32(o.Fee)))
+	o.ContraClientID = bits.ReverseBytes32(o.ContraClientID)
+	o.TriggerPrice = bits.ReverseBytes32(o.TriggerPrice)
+	return o
+}
+
+// Fingerprint is a stable 64-bit hash of the Order fields schema.json marks
+// fingerprint, the same on every host and on the Rust and C sides; see
+// fingerprint.go.
+func (o *Order) Fingerprint() uint64 {
+	h := uint64(fingerprintBasis)
+	h = fingerprintAdd(h, uint64(o.OrderID), 8)
+	h = fingerprintAdd(h, uint64(o.Price), 8)
+	h = fingerprintAdd(h, uint64(o.ExpireAt), 8)
+	h = fingerprintAdd(h, uint64(o.ClientID), 4)
+	h = fingerprintAdd(h, uint64(o.Quantity), 4)
+	h = fingerprintAdd(h, uint64(o.Symbol), 4)
+	h = fingerprintAdd(h, uint64(o.Side), 1)
+	h = fingerprintAdd(h, uint64(o.TimeInForce), 1)
+	h = fingerprintAdd(h, uint64(o.MsgType), 1)
+	h = fingerprintAdd(h, uint64(o.Flags), 1)
+	h = fingerprintAdd(h, uint64(o.SubAccount), 1)
+	h = fingerprintAdd(h, uint64(o.TriggerPrice), 4)
+	return h
+}
+
+// Each line compiles only if both sides are equal: a larger left side
+// makes an array too long for [0]struct{}, a smaller one a negative length.
+var (
+	_ [0]struct{} = [unsafe.Sizeof(Order{}) - 64]struct{}{}
+	_ [0]struct{} = [unsafe.Alignof(Order{}) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.OrderID) - 0]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.OrderID) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Price) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Price) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Timestamp) - 16]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Timestamp) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.ExpireAt) - 24]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.ExpireAt) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.ClientID) - 32]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.ClientID) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Quantity) - 36]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Quantity) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Symbol) - 40]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Symbol) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Side) - 44]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Side) - 1]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Status) - 45]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Status) - 1]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.TimeInForce) - 46]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.TimeInForce) - 1]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.MsgType) - 47]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.MsgType) - 1]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Flags) - 48]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Flags) - 1]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Reason) - 49]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Reason) - 1]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Liquidity) - 50]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Liquidity) - 1]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.SubAccount) - 51]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.SubAccount) - 1]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.Fee) - 52]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.Fee) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.ContraClientID) - 56]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.ContraClientID) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Order{}.TriggerPrice) - 60]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Order{}.TriggerPrice) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Attachment{}) - 16]struct{}{}
+	_ [0]struct{} = [unsafe.Alignof(Attachment{}) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Attachment{}.PID) - 0]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Attachment{}.PID) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Attachment{}.Roles) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Attachment{}.Roles) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(Attachment{}.AttachedAt) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(Attachment{}.AttachedAt) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(PIDNamespace{}) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Alignof(PIDNamespace{}) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(PIDNamespace{}.Inode) - 0]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(PIDNamespace{}.Inode) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(DepthSample{}) - 16]struct{}{}
+	_ [0]struct{} = [unsafe.Alignof(DepthSample{}) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(DepthSample{}.At) - 0]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(DepthSample{}.At) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(DepthSample{}.Depth) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(DepthSample{}.Depth) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(DepthSample{}.Rate) - 12]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(DepthSample{}.Rate) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}) - 2432]struct{}{}
+	_ [0]struct{} = [unsafe.Alignof(QueueHeader{}) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.ProducerHead) - 0]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.ProducerHead) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}._pad1) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}._pad1) - 56]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.ConsumerTail) - 64]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.ConsumerTail) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}._pad2) - 72]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}._pad2) - 56]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.Magic) - 128]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.Magic) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.Capacity) - 132]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.Capacity) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.ByteOrder) - 136]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.ByteOrder) - 4]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.AttachedNS) - 140]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.AttachedNS) - 32]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}._pad3) - 172]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}._pad3) - 20]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.Attached) - 192]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.Attached) - 128]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.HistorySeq) - 320]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.HistorySeq) - 8]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}._pad4) - 328]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}._pad4) - 56]struct{}{}
+	_ [0]struct{} = [unsafe.Offsetof(QueueHeader{}.History) - 384]struct{}{}
+	_ [0]struct{} = [unsafe.Sizeof(QueueHeader{}.History) - 2048]struct{}{}
+)
@@ -0,0 +1,247 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const segmentSuffix = ".seg"
+
+// SegmentedQueue is an unbounded queue for capture-style use: a chain of
+// segment files in one directory, each an ordinary queue file written once
+// from slot 0 to the end without wrapping. When the producer fills its
+// segment it rolls to a new one, and the consumer follows once it has
+// consumed the old one, removing it unless KeepSegments is set. A slow
+// consumer therefore costs disk space instead of ErrQueueFull.
+//
+// The producer and consumer may be separate processes, each with its own
+// SegmentedQueue over the same directory. The Rust engine only reads a
+// single ring, so this is for Go-to-Go flows such as captures and replays.
+type SegmentedQueue struct {
+	dir string
+
+	// KeepSegments keeps consumed segments on disk, e.g. to replay a
+	// capture later, instead of removing them as the consumer moves on.
+	KeepSegments bool
+
+	mu      sync.Mutex
+	prod    *Queue // newest segment, the one being written
+	prodSeg uint64
+	cons    *Queue // oldest segment not fully consumed
+	consSeg uint64
+}
+
+var _ Sequencer = (*SegmentedQueue)(nil)
+
+// SegmentPath is the file of segment n in dir.
+func SegmentPath(dir string, n uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d%s", n, segmentSuffix))
+}
+
+// CreateSegmented starts an empty segmented queue in dir, removing any
+// segments already there.
+func CreateSegmented(dir string) (*SegmentedQueue, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create segment directory: %w", err)
+	}
+	segs, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range segs {
+		if err := os.Remove(SegmentPath(dir, n)); err != nil {
+			return nil, fmt.Errorf("failed to remove old segment: %w", err)
+		}
+	}
+	if err := createSegment(dir, 0); err != nil {
+		return nil, err
+	}
+	return OpenSegmented(dir)
+}
+
+// OpenSegmented attaches to the segmented queue in dir.
+func OpenSegmented(dir string) (*SegmentedQueue, error) {
+	segs, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("no segments in %s", dir)
+	}
+	s := &SegmentedQueue{dir: dir, consSeg: segs[0], prodSeg: segs[len(segs)-1]}
+	if s.cons, err = OpenQueue(SegmentPath(dir, s.consSeg)); err != nil {
+		return nil, err
+	}
+	if s.prod, err = OpenQueue(SegmentPath(dir, s.prodSeg)); err != nil {
+		s.cons.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// listSegments returns the segment numbers in dir, ascending.
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+	var segs []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), segmentSuffix)
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(name, 10, 64); err == nil {
+			segs = append(segs, n)
+		}
+	}
+	slices.Sort(segs)
+	return segs, nil
+}
+
+// createSegment creates segment n under a temporary name and renames it
+// into place, so a consumer never opens a file whose header is not written.
+func createSegment(dir string, n uint64) error {
+	tmp := SegmentPath(dir, n) + ".tmp"
+	q, err := CreateQueue(tmp)
+	if err != nil {
+		return err
+	}
+	q.Close()
+	if err := os.Rename(tmp, SegmentPath(dir, n)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to publish segment: %w", err)
+	}
+	return nil
+}
+
+// sealed reports whether a segment's producer has written its last slot.
+func sealed(q *Queue) bool {
+	return q.ProducerHead() >= QueueCapacity
+}
+
+// followProducer moves the producer handle to the next segment if another
+// producer has already rolled to it; roll creates it if missing.
+func (s *SegmentedQueue) followProducer(roll bool) error {
+	for sealed(s.prod) {
+		next := SegmentPath(s.dir, s.prodSeg+1)
+		if _, err := os.Stat(next); errors.Is(err, fs.ErrNotExist) {
+			if !roll {
+				return nil
+			}
+			if err := createSegment(s.dir, s.prodSeg+1); err != nil {
+				return err
+			}
+		}
+		q, err := OpenQueue(next)
+		if err != nil {
+			return err
+		}
+		s.prod.Close()
+		s.prod, s.prodSeg = q, s.prodSeg+1
+	}
+	return nil
+}
+
+// followConsumer moves the consumer handle past fully consumed segments
+// whose successor exists, removing them unless KeepSegments is set.
+func (s *SegmentedQueue) followConsumer() error {
+	for s.cons.ConsumerTail() >= QueueCapacity {
+		next := s.consSeg + 1
+		q, err := OpenQueue(SegmentPath(s.dir, next))
+		if errors.Is(err, fs.ErrNotExist) {
+			// either the producer has not rolled yet, or another handle on
+			// the directory consumed and removed the next segment too
+			segs, listErr := listSegments(s.dir)
+			if listErr != nil {
+				return listErr
+			}
+			i, _ := slices.BinarySearch(segs, next)
+			if i == len(segs) {
+				return nil
+			}
+			next = segs[i]
+			q, err = OpenQueue(SegmentPath(s.dir, next))
+		}
+		if err != nil {
+			return err
+		}
+		s.cons.Close()
+		if !s.KeepSegments {
+			// another handle may have removed it first
+			if err := os.Remove(SegmentPath(s.dir, s.consSeg)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				q.Close()
+				return fmt.Errorf("failed to remove consumed segment: %w", err)
+			}
+		}
+		s.cons, s.consSeg = q, next
+	}
+	return nil
+}
+
+// Enqueue appends order, rolling to a new segment when the current one is
+// full. It only fails if a segment cannot be created.
+func (s *SegmentedQueue) Enqueue(order Order) error {
+	_, err := s.EnqueueSeq(order)
+	return err
+}
+
+// EnqueueSeq is Enqueue that also returns the order's sequence across
+// segments: segment n holds sequences n*QueueCapacity onwards.
+func (s *SegmentedQueue) EnqueueSeq(order Order) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.followProducer(true); err != nil {
+		return 0, err
+	}
+	seq, err := s.prod.EnqueueSeq(order)
+	if err != nil {
+		return 0, err
+	}
+	return s.prodSeg*QueueCapacity + seq, nil
+}
+
+func (s *SegmentedQueue) Dequeue() (*Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.followConsumer(); err != nil {
+		return nil, err
+	}
+	return s.cons.Dequeue()
+}
+
+// Depth counts unconsumed orders across every segment.
+func (s *SegmentedQueue) Depth() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.followProducer(false)
+	s.followConsumer()
+	return (s.prodSeg-s.consSeg)*QueueCapacity + s.prod.ProducerHead() - s.cons.ConsumerTail()
+}
+
+// Capacity is unbounded; disk space is the limit.
+func (s *SegmentedQueue) Capacity() uint64 {
+	return math.MaxUint64
+}
+
+// Segments is the number of segments from the consumer's to the
+// producer's, inclusive.
+func (s *SegmentedQueue) Segments() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prodSeg - s.consSeg + 1
+}
+
+func (s *SegmentedQueue) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.prod.Close(), s.cons.Close())
+}
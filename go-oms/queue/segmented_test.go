@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSegmentedQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "capture")
+	prod, err := CreateSegmented(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prod.Close()
+	cons, err := OpenSegmented(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cons.Close()
+
+	// more than two segments' worth with no consumer: never full
+	const total = 2*QueueCapacity + 100
+	for id := uint64(1); id <= total; id++ {
+		seq, err := prod.EnqueueSeq(Order{OrderID: id, Quantity: 1, Price: 1})
+		if err != nil {
+			t.Fatalf("order %d: %v", id, err)
+		}
+		if seq != id-1 {
+			t.Fatalf("order %d published at %d, want %d", id, seq, id-1)
+		}
+	}
+	if prod.Segments() != 3 || cons.Depth() != total {
+		t.Fatalf("%d segments, depth %d", prod.Segments(), cons.Depth())
+	}
+
+	for id := uint64(1); id <= total; id++ {
+		o, err := cons.Dequeue()
+		if err != nil || o == nil || o.OrderID != id {
+			t.Fatalf("got %+v %v, want order %d", o, err, id)
+		}
+	}
+	if o, _ := cons.Dequeue(); o != nil {
+		t.Fatalf("dequeued %+v past the end", o)
+	}
+	segs, _ := listSegments(dir)
+	if len(segs) != 1 || segs[0] != 2 || prod.Depth() != 0 {
+		t.Fatalf("segments left %v, depth %d", segs, prod.Depth())
+	}
+}
@@ -0,0 +1,15 @@
+package queue
+
+const haveNonTemporal = true
+
+// writeSlotNT copies an order into its ring slot with non-temporal stores
+// (MOVNTDQ). dst must be 16-byte aligned, which ring slots are: the mapping
+// is page aligned and the header and Order are multiples of 16 bytes. The
+// stores are weakly ordered; call storeFence before publishing.
+//
+//go:noescape
+func writeSlotNT(dst, src *Order)
+
+// storeFence is SFENCE: it orders preceding non-temporal stores before any
+// later store.
+func storeFence()
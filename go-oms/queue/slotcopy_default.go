@@ -0,0 +1,5 @@
+//go:build !slotcopy_nt
+
+package queue
+
+const defaultNonTemporal = false
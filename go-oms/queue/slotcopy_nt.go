@@ -0,0 +1,6 @@
+//go:build slotcopy_nt
+
+package queue
+
+// Built with -tags slotcopy_nt, queues start with SetNonTemporal(true).
+const defaultNonTemporal = haveNonTemporal
@@ -0,0 +1,9 @@
+//go:build !amd64
+
+package queue
+
+const haveNonTemporal = false
+
+func writeSlotNT(dst, src *Order) { *dst = *src }
+
+func storeFence() {}
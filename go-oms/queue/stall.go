@@ -0,0 +1,41 @@
+package queue
+
+import "time"
+
+// consumerProgress is implemented by both Queue and MemQueue.
+type consumerProgress interface {
+	ConsumerTail() uint64
+	Depth() uint64
+}
+
+// StallDetector lets a producer notice a consumer that has stopped draining
+// the ring (crashed, killed, or wedged) while orders are waiting for it.
+type StallDetector struct {
+	q        consumerProgress
+	after    time.Duration
+	lastTail uint64
+	lastMove time.Time
+}
+
+// NewStallDetector reports a stall once the consumer tail hasn't moved for
+// after while the queue is non-empty.
+func NewStallDetector(q consumerProgress, after time.Duration) *StallDetector {
+	return &StallDetector{
+		q:        q,
+		after:    after,
+		lastTail: q.ConsumerTail(),
+		lastMove: time.Now(),
+	}
+}
+
+// Stalled samples the queue and reports whether the consumer is stalled.
+// Call it from the producer loop; it is not safe for concurrent use.
+func (d *StallDetector) Stalled(now time.Time) bool {
+	tail := d.q.ConsumerTail()
+	if tail != d.lastTail || d.q.Depth() == 0 {
+		d.lastTail = tail
+		d.lastMove = now
+		return false
+	}
+	return now.Sub(d.lastMove) >= d.after
+}
@@ -0,0 +1,39 @@
+package queue
+
+import "fmt"
+
+// A new order with TriggerPrice set is a stop order: it is held on the
+// producer side (see package stops) until a trade prints at or through the
+// trigger, then released to the engine like any other order. A buy stop
+// triggers on a trade at or above TriggerPrice, a sell stop at or below.
+//
+// With Price set it is a stop-limit and keeps that limit once released. A
+// plain stop has Price 0 and is released at the price of the triggering
+// trade, since the engine only takes priced orders.
+//
+// The engine ignores TriggerPrice, so a released stop carries it unchanged.
+
+// ErrInvalidStop is returned by ValidateStop.
+var ErrInvalidStop = NewReject(ReasonValidation, "invalid stop order")
+
+// IsStop reports whether o is a stop or stop-limit order.
+func (o *Order) IsStop() bool {
+	return o.TriggerPrice != 0 && !o.IsControl()
+}
+
+// Triggered reports whether a trade at price sets off the stop order o.
+func (o *Order) Triggered(price uint64) bool {
+	if o.Side == 0 {
+		return price >= uint64(o.TriggerPrice)
+	}
+	return price <= uint64(o.TriggerPrice)
+}
+
+// ValidateStop checks the stop fields of o: control messages carry no
+// trigger.
+func (o *Order) ValidateStop() error {
+	if o.TriggerPrice != 0 && o.IsControl() {
+		return fmt.Errorf("%w: trigger price on a control message", ErrInvalidStop)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A stream is a directory holding one ring and what describes it:
+//
+//	orders/
+//	  data       the queue file itself
+//	  meta.json  StreamMeta, written once at creation
+//	  lock       flock'd shared by every process attached to the ring
+//
+// OpenQueue and friends accept the directory wherever they accept a queue
+// file, so callers only choose where the stream lives. Every attachment
+// holds the lock shared, which lets CreateStream and Compact refuse to
+// replace a ring that is in use, and ListStreams tell live streams from
+// leftovers, and on Linux name the attached processes, without asking
+// anyone.
+const (
+	StreamDataFile = "data"
+	StreamMetaFile = "meta.json"
+	StreamLockFile = "lock"
+)
+
+// Stream kinds recorded in StreamMeta.Kind.
+const (
+	StreamOrders = "orders"
+	StreamStatus = "status"
+)
+
+// StreamMeta describes a stream. CreateStream fills in everything but
+// Kind and Pair.
+type StreamMeta struct {
+	Name     string    `json:"name"`
+	Kind     string    `json:"kind"`           // what the ring carries, e.g. StreamOrders
+	Pair     string    `json:"pair,omitempty"` // the stream this one answers, for a status stream its order stream
+	Capacity uint64    `json:"capacity"`
+	SlotSize uint64    `json:"slot_size"`
+	Created  time.Time `json:"created"`
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"`
+}
+
+// StreamInfo is one stream found by List.
+type StreamInfo struct {
+	Name  string
+	Dir   string
+	Meta  StreamMeta
+	InUse bool  // some process is attached
+	PIDs  []int // the attached processes, where the OS tells; see /proc/locks
+	Stats Stats // zero if the ring could not be read
+	// Attached is the header's registry, which also names each process's
+	// role and shows orphans; see attach.go
+	Attached []Attached
+	Err      error // why Meta or Stats are missing
+}
+
+// IsStream reports whether path is a stream directory.
+func IsStream(path string) bool {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.IsDir() {
+		return false
+	}
+	fi, err = os.Lstat(filepath.Join(path, StreamDataFile))
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// CreateStream creates (replacing any existing ring) the stream directory
+// dir and returns its queue, attached. It fails with ErrQueueBusy if
+// another process is attached to the stream.
+func CreateStream(dir string, meta StreamMeta, opts CreateOptions) (*Queue, error) {
+	opts = opts.withDefaults()
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(dir); err == nil && (!fi.IsDir() || fi.Mode()&os.ModeSymlink != 0) {
+		return nil, fmt.Errorf("stream path %s is not a directory", dir)
+	}
+	data := filepath.Join(dir, StreamDataFile)
+	if err := ValidatePath(data); err != nil {
+		return nil, err
+	}
+	if err := opts.prepareDir(dir); err != nil {
+		return nil, err
+	}
+	lock, err := lockStream(dir, opts, syscall.LOCK_EX)
+	if err != nil {
+		return nil, err
+	}
+	q, err := CreateQueueWith(data, opts)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	meta.Name = filepath.Base(dir)
+	meta.Capacity, meta.SlotSize = QueueCapacity, uint64(OrderSize)
+	meta.Created, meta.PID = time.Now().UTC(), os.Getpid()
+	meta.Host, _ = os.Hostname()
+	if err := writeStreamMeta(dir, meta, opts); err != nil {
+		q.Close()
+		lock.Close()
+		return nil, err
+	}
+	// stay attached like any other opener
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_SH); err != nil {
+		q.Close()
+		lock.Close()
+		return nil, fmt.Errorf("failed to lock stream: %w", err)
+	}
+	q.lock = lock
+	return q, nil
+}
+
+// ReadStreamMeta reads the meta.json of the stream directory dir.
+func ReadStreamMeta(dir string) (StreamMeta, error) {
+	var meta StreamMeta
+	b, err := os.ReadFile(filepath.Join(dir, StreamMetaFile))
+	if err != nil {
+		return meta, fmt.Errorf("failed to read stream metadata: %w", err)
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return meta, fmt.Errorf("invalid stream metadata %s: %w", dir, err)
+	}
+	return meta, nil
+}
+
+// List returns the streams directly under baseDir, by name, with their
+// metadata, indices and attached processes. Bare queue files and other
+// entries are skipped. It maps nothing writable and takes no lock that an
+// attaching process could trip over for longer than a probe.
+func List(baseDir string) ([]StreamInfo, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list streams: %w", err)
+	}
+	holders := lockHolders()
+	var streams []StreamInfo
+	for _, e := range entries {
+		dir := filepath.Join(baseDir, e.Name())
+		if !e.IsDir() || !IsStream(dir) {
+			continue
+		}
+		info := StreamInfo{Name: e.Name(), Dir: dir, InUse: streamInUse(dir)}
+		if fi, err := os.Stat(filepath.Join(dir, StreamLockFile)); err == nil {
+			info.PIDs = holders[fileID(fi)]
+		}
+		info.Meta, info.Err = ReadStreamMeta(dir)
+		if r, err := OpenQueueReadOnly(dir); err == nil {
+			info.Stats = r.Stats()
+			info.Attached = r.Attachments()
+			r.Close()
+		} else if info.Err == nil {
+			info.Err = err
+		}
+		streams = append(streams, info)
+	}
+	return streams, nil // ReadDir sorts by name
+}
+
+// openQueue opens a queue file or, given a stream directory, its data file
+// with the stream's lock held shared until Close. Viewers take no lock.
+func openQueue(path string, allowForeign, readOnly bool) (*Queue, error) {
+	if !IsStream(path) {
+		return openQueueFile(path, allowForeign, readOnly)
+	}
+	var lock *os.File
+	if !readOnly {
+		var err error
+		if lock, err = lockStream(path, CreateOptions{}.withDefaults(), syscall.LOCK_SH); err != nil {
+			return nil, err
+		}
+	}
+	q, err := openQueueFile(filepath.Join(path, StreamDataFile), allowForeign, readOnly)
+	if err != nil {
+		if lock != nil {
+			lock.Close()
+		}
+		return nil, err
+	}
+	q.lock = lock
+	return q, nil
+}
+
+// lockStream flocks dir's lock file without blocking, creating it with
+// opts if it is missing. Closing the file releases the lock.
+func lockStream(dir string, opts CreateOptions, how int) (*os.File, error) {
+	path := filepath.Join(dir, StreamLockFile)
+	if err := ValidatePath(path); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, opts.Mode)
+	if err == nil {
+		if err := opts.apply(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else if errors.Is(err, os.ErrExist) {
+		// the lock only needs an fd; attaching needs no write access
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream lock: %w", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%w: stream %s", ErrQueueBusy, dir)
+		}
+		return nil, fmt.Errorf("failed to lock stream: %w", err)
+	}
+	return file, nil
+}
+
+// streamInUse reports whether any process holds dir's lock.
+func streamInUse(dir string) bool {
+	file, err := os.Open(filepath.Join(dir, StreamLockFile))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return errors.Is(syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB), syscall.EWOULDBLOCK)
+}
+
+// lockHolders maps the files with flocks on them, by fileID, to the PIDs
+// holding them, from /proc/locks. Elsewhere it is empty.
+func lockHolders() map[string][]int {
+	f, err := os.Open("/proc/locks")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	holders := make(map[string][]int)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// 1: FLOCK  ADVISORY  READ 4242 fe:00:9617448 0 EOF
+		// waiters are listed after their blocker as "1: -> FLOCK ..."
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 || fields[1] != "FLOCK" {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil {
+			continue
+		}
+		if id := fields[5]; !slices.Contains(holders[id], pid) {
+			holders[id] = append(holders[id], pid)
+		}
+	}
+	for _, pids := range holders {
+		slices.Sort(pids)
+	}
+	return holders
+}
+
+// fileID formats a file's device and inode the way /proc/locks does.
+func fileID(fi os.FileInfo) string {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	dev := uint64(st.Dev)
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	return fmt.Sprintf("%02x:%02x:%d", major, minor, st.Ino)
+}
+
+// writeStreamMeta replaces dir's meta.json atomically, so a lister never
+// reads half of it.
+func writeStreamMeta(dir string, meta StreamMeta, opts CreateOptions) error {
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, StreamMetaFile)
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, opts.Mode)
+	if err != nil {
+		return fmt.Errorf("failed to write stream metadata: %w", err)
+	}
+	_, err = file.Write(append(b, '\n'))
+	if err == nil {
+		err = opts.apply(file)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write stream metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "orders")
+	q, err := CreateStream(dir, StreamMeta{Kind: StreamOrders}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{StreamDataFile, StreamMetaFile, StreamLockFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Enqueue(Order{OrderID: 1, Quantity: 1, Price: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// a bare queue file next to the stream is not listed
+	bare, err := CreateQueue(filepath.Join(root, "orders_book"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bare.Close()
+
+	consumer, err := OpenQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, err := consumer.Dequeue(); err != nil || o == nil || o.OrderID != 1 {
+		t.Fatalf("got %+v %v through the stream directory", o, err)
+	}
+	if _, err := CreateStream(dir, StreamMeta{Kind: StreamOrders}, CreateOptions{}); !errors.Is(err, ErrQueueBusy) {
+		t.Fatalf("recreating an attached stream: %v", err)
+	}
+	if _, err := Compact(dir, 0); !errors.Is(err, ErrQueueBusy) {
+		t.Fatalf("compacting an attached stream: %v", err)
+	}
+
+	streams, err := List(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 {
+		t.Fatalf("listed %+v", streams)
+	}
+	s := streams[0]
+	if s.Err != nil || !s.InUse || s.Name != "orders" || s.Meta.Name != "orders" || s.Meta.Kind != StreamOrders ||
+		s.Meta.Capacity != QueueCapacity || s.Meta.PID != os.Getpid() || s.Stats.ProducerHead != 1 {
+		t.Fatalf("listed %+v", s)
+	}
+	if _, err := os.Stat("/proc/locks"); err == nil && !slices.Equal(s.PIDs, []int{os.Getpid()}) {
+		t.Fatalf("attached pids %v, want only this process", s.PIDs)
+	}
+
+	q.Close()
+	consumer.Close()
+	if streams, _ = List(root); streams[0].InUse || len(streams[0].PIDs) != 0 {
+		t.Fatal("stream still in use after every queue closed")
+	}
+	if _, err := Compact(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The slot has no padding (gen_schema insists on the natural layout with
+// every byte named), but on the order ring part of it is reserved: the
+// engine's half, which only status records fill in, and ExpireAt on an
+// order that never expires. Nothing stops a producer from leaving stale
+// values there, e.g. from an Order reused for the next message or a status
+// record copied back. Strict mode zeroes them, so the engine can give those
+// bytes a meaning later without misreading old producers, and a message
+// fingerprints the same however its producer filled in what it did not
+// use.
+
+// ErrReservedSet is returned by CheckReserved for a message with a
+// reserved field that is not zero.
+var ErrReservedSet = errors.New("reserved field set")
+
+// ClearReserved returns o with the fields reserved on the order ring
+// zeroed: Status, Reason, Liquidity, Fee and ContraClientID, and ExpireAt
+// on a good-till-cancel message.
+func ClearReserved(o Order) Order {
+	o.Status, o.Reason, o.Liquidity = StatusPending, 0, 0
+	o.Fee, o.ContraClientID = 0, 0
+	if o.TimeInForce == TIFGoodTillCancel {
+		o.ExpireAt = 0
+	}
+	return o
+}
+
+// CheckReserved reports the first field ClearReserved would change,
+// wrapping ErrReservedSet.
+func CheckReserved(o Order) error {
+	var field string
+	switch {
+	case o.Status != StatusPending:
+		field = "status"
+	case o.Reason != 0:
+		field = "reason"
+	case o.Liquidity != 0:
+		field = "liquidity"
+	case o.Fee != 0:
+		field = "fee"
+	case o.ContraClientID != 0:
+		field = "contra client id"
+	case o.TimeInForce == TIFGoodTillCancel && o.ExpireAt != 0:
+		field = "expire at on a good-till-cancel order"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%w: order %d: %s", ErrReservedSet, o.OrderID, field)
+}
+
+// Strict wraps an order ring and clears the reserved fields of every
+// message it enqueues. Wrap the ring itself, so nothing wrapped around it
+// can set them again.
+type Strict struct {
+	OrderQueue
+}
+
+var _ OrderQueue = (*Strict)(nil)
+
+func (s *Strict) Enqueue(order Order) error {
+	return s.OrderQueue.Enqueue(ClearReserved(order))
+}
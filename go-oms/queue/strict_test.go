@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStrictClearsReserved(t *testing.T) {
+	clean := Order{OrderID: 1, ClientID: 7, Symbol: 3, Quantity: 10, Price: 100, Timestamp: 5}
+	if err := CheckReserved(clean); err != nil {
+		t.Fatalf("clean order: %v", err)
+	}
+	// a status record reused as the next order, with a stale ExpireAt
+	stale := clean
+	stale.Status, stale.Reason, stale.Liquidity = StatusFilled, ReasonRisk, LiquidityTaker
+	stale.Fee, stale.ContraClientID, stale.ExpireAt = 4, 9, 12345
+	if err := CheckReserved(stale); !errors.Is(err, ErrReservedSet) {
+		t.Fatalf("stale order: err = %v", err)
+	}
+	for _, set := range []func(*Order){
+		func(o *Order) { o.Status = StatusAcked },
+		func(o *Order) { o.Reason = 1 },
+		func(o *Order) { o.Liquidity = LiquidityMaker },
+		func(o *Order) { o.Fee = -1 },
+		func(o *Order) { o.ContraClientID = 2 },
+		func(o *Order) { o.ExpireAt = 1 },
+	} {
+		o := clean
+		set(&o)
+		if CheckReserved(o) == nil {
+			t.Errorf("%+v passed the check", o)
+		}
+	}
+	gtt := clean
+	gtt.TimeInForce, gtt.ExpireAt = TIFGoodTillTime, 12345
+	if err := CheckReserved(gtt); err != nil || ClearReserved(gtt) != gtt {
+		t.Errorf("good-till-time expiry treated as reserved: %v", err)
+	}
+
+	ring := NewInMemory(4)
+	if err := (&Strict{OrderQueue: ring}).Enqueue(stale); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ring.Dequeue()
+	if err := CheckReserved(*got); err != nil || *got != clean {
+		t.Fatalf("published %+v (%v), want %+v", *got, err, clean)
+	}
+	if got.Fingerprint() != clean.Fingerprint() {
+		t.Error("stale expiry changed the fingerprint after Strict")
+	}
+}
@@ -0,0 +1,44 @@
+package queue
+
+import "time"
+
+// DepthEvent reports a queue crossing a fill threshold.
+type DepthEvent struct {
+	Threshold float64 // the registered fraction, 0..1
+	Depth     uint64
+	Capacity  uint64
+	Rising    bool // true when filling past Threshold, false when draining below it
+	At        time.Time
+}
+
+type depthThreshold struct {
+	pct   float64
+	fn    func(DepthEvent)
+	above bool
+}
+
+// depthAlerts is shared by Queue and MemQueue. It is only touched by the
+// producer, so it needs no locking.
+type depthAlerts struct {
+	thresholds []*depthThreshold
+}
+
+func (a *depthAlerts) add(pct float64, fn func(DepthEvent)) {
+	a.thresholds = append(a.thresholds, &depthThreshold{pct: min(max(pct, 0), 1), fn: fn})
+}
+
+// check fires fn for every threshold whose side of depth changed.
+func (a *depthAlerts) check(depth, capacity uint64) {
+	if len(a.thresholds) == 0 {
+		return
+	}
+	fill := float64(depth) / float64(capacity)
+	for _, t := range a.thresholds {
+		above := fill >= t.pct
+		if above == t.above {
+			continue
+		}
+		t.above = above
+		t.fn(DepthEvent{Threshold: t.pct, Depth: depth, Capacity: capacity, Rising: above, At: time.Now()})
+	}
+}
@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type timestampKind uint8
+
+const (
+	perOrder timestampKind = iota
+	coarseCount
+	coarseDuration
+)
+
+// TimestampMode trades Order.Timestamp precision for fewer clock reads.
+type TimestampMode struct {
+	kind  timestampKind
+	every int
+	tick  time.Duration
+}
+
+// PerOrder reads the clock for every order.
+func PerOrder() TimestampMode { return TimestampMode{kind: perOrder} }
+
+// Coarse reads the clock once every n orders; the orders in between share
+// the stamp.
+func Coarse(n int) TimestampMode {
+	return TimestampMode{kind: coarseCount, every: max(n, 1)}
+}
+
+// CoarseDuration refreshes the stamp from a background ticker every d, so
+// the hot path never reads the clock. Stop the Stamper to release it.
+func CoarseDuration(d time.Duration) TimestampMode {
+	return TimestampMode{kind: coarseDuration, tick: max(d, time.Microsecond)}
+}
+
+// ParseTimestampMode reads a flag value: "order", "coarse:N" (every N
+// orders) or "coarse:D" with a duration such as "coarse:1ms".
+func ParseTimestampMode(v string) (TimestampMode, error) {
+	if v == "" || v == "order" {
+		return PerOrder(), nil
+	}
+	arg, ok := strings.CutPrefix(v, "coarse:")
+	if ok {
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+			return Coarse(n), nil
+		}
+		if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+			return CoarseDuration(d), nil
+		}
+	}
+	return TimestampMode{}, fmt.Errorf("invalid timestamp mode %q (want order, coarse:N or coarse:<duration>)", v)
+}
+
+// Stamper issues Order.Timestamp values for one producer. Stamps are wall
+// clock unix nanos, but advanced by the monotonic clock from a base taken at
+// creation, so an NTP step back never makes them go backwards. They never
+// decrease within a Stamper, and only coarse modes repeat a value.
+//
+// Next is not safe for concurrent use; give each producer its own Stamper.
+type Stamper struct {
+	mode  TimestampMode
+	base  time.Time // carries the monotonic reading
+	wall  uint64    // base as unix nanos
+	last  uint64
+	count int
+
+	shared atomic.Uint64 // coarseDuration: refreshed by the ticker
+	stop   chan struct{}
+}
+
+// NewStamper starts a Stamper in the given mode.
+func NewStamper(mode TimestampMode) *Stamper {
+	base := time.Now()
+	s := &Stamper{mode: mode, base: base, wall: uint64(base.UnixNano())}
+	if mode.kind == coarseDuration {
+		s.shared.Store(s.now())
+		s.stop = make(chan struct{})
+		go s.refresh(s.stop)
+	}
+	return s
+}
+
+func (s *Stamper) now() uint64 {
+	return s.wall + uint64(time.Since(s.base))
+}
+
+func (s *Stamper) refresh(stop <-chan struct{}) {
+	t := time.NewTicker(s.mode.tick)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			s.shared.Store(s.now())
+		}
+	}
+}
+
+// Next returns the timestamp for the next order.
+func (s *Stamper) Next() uint64 {
+	var ts uint64
+	switch s.mode.kind {
+	case coarseCount:
+		if s.count%s.mode.every == 0 {
+			s.last = max(s.last, s.now())
+		}
+		s.count++
+		return s.last
+	case coarseDuration:
+		ts = s.shared.Load()
+	default:
+		ts = s.now()
+	}
+	s.last = max(s.last, ts)
+	return s.last
+}
+
+// Stop releases the CoarseDuration ticker. It is a no-op for other modes.
+func (s *Stamper) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStamperNeverGoesBackwards(t *testing.T) {
+	modes := map[string]TimestampMode{
+		"per-order": PerOrder(),
+		"coarse-n":  Coarse(100),
+		"coarse-d":  CoarseDuration(50 * time.Microsecond),
+	}
+	for name, mode := range modes {
+		t.Run(name, func(t *testing.T) {
+			s := NewStamper(mode)
+			defer s.Stop()
+			// A stamp a second ahead of the clock, as issued before a step
+			// back; later stamps must not drop below it.
+			s.Next()
+			s.last += uint64(time.Second)
+			prev := s.last
+			for range 10000 {
+				ts := s.Next()
+				if ts < prev {
+					t.Fatalf("timestamp went backwards: %d after %d", ts, prev)
+				}
+				prev = ts
+			}
+		})
+	}
+}
+
+func TestCoarseSharesStamp(t *testing.T) {
+	s := NewStamper(Coarse(4))
+	first := s.Next()
+	for range 3 {
+		if ts := s.Next(); ts != first {
+			t.Fatalf("coarse(4) refreshed early: %d != %d", ts, first)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// OpenQueueWait is OpenQueue for a process that may start before the one
+// creating the queue, as the containers of a pod do: while the queue does
+// not exist yet, or its stream is still being created, it retries until
+// wait has passed or ctx is done. Any other error is returned at once.
+func OpenQueueWait(ctx context.Context, path string, wait time.Duration) (*Queue, error) {
+	deadline := time.Now().Add(wait)
+	delay := 10 * time.Millisecond
+	for {
+		q, err := OpenQueue(path)
+		if err == nil || !notCreatedYet(path, err) || time.Now().After(deadline) {
+			return q, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(delay, time.Until(deadline))):
+		}
+		delay = min(2*delay, time.Second)
+	}
+}
+
+// notCreatedYet reports whether err opening path means its creator has not
+// got there yet: nothing at path, a stream directory without its data file,
+// or a stream CreateStream holds locked.
+func notCreatedYet(path string, err error) bool {
+	if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrQueueBusy) {
+		return true
+	}
+	fi, statErr := os.Stat(path)
+	return statErr == nil && fi.IsDir() && !IsStream(path)
+}
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenQueueWait(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "orders")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		q, err := CreateStream(dir, StreamMeta{Kind: StreamOrders}, CreateOptions{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		q.Close()
+	}()
+	q, err := OpenQueueWait(context.Background(), dir, 5*time.Second)
+	if err != nil {
+		t.Fatalf("created after the open started: %v", err)
+	}
+	q.Close()
+
+	start := time.Now()
+	_, err = OpenQueueWait(context.Background(), filepath.Join(t.TempDir(), "never"), 100*time.Millisecond)
+	if !errors.Is(err, os.ErrNotExist) || time.Since(start) < 100*time.Millisecond {
+		t.Fatalf("after %v: %v, want ErrNotExist after the wait", time.Since(start), err)
+	}
+
+	// not a queue at all: no point waiting
+	bad := filepath.Join(t.TempDir(), "bad")
+	if err := os.WriteFile(bad, []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	if _, err := OpenQueueWait(context.Background(), bad, time.Minute); err == nil || time.Since(start) > time.Second {
+		t.Fatalf("after %v: %v", time.Since(start), err)
+	}
+}
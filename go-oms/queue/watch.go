@@ -0,0 +1,133 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// DepthReading is what WatchDepth delivers. (DepthSample is the history
+// ring's entry in the header.)
+type DepthReading struct {
+	At       time.Time
+	Depth    uint64
+	Capacity uint64
+	Head     uint64 // producer head: orders published so far
+	Tail     uint64 // consumer tail: orders released so far
+	// Crossed lists the watched thresholds the depth crossed since the
+	// sample before, oldest first.
+	Crossed []DepthEvent
+}
+
+// watched is what a depth watcher reads. Queue, MemQueue and ReadOnlyQueue
+// implement it.
+type watched interface {
+	Lagged
+	ProducerHead() uint64
+}
+
+// depthWatchers runs a queue's WatchDepth goroutines and stops them on
+// Close, before the queue is unmapped under them.
+type depthWatchers struct {
+	mu     sync.Mutex
+	stop   chan struct{}
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// watch samples q every interval and sends a sample when the head or tail
+// moved since the last one sent, or a threshold was crossed. The first
+// sample is always sent. A receiver that falls behind gets the newest
+// sample, carrying the crossings of the ones it missed.
+func (w *depthWatchers) watch(q watched, interval time.Duration, thresholds []float64) <-chan DepthReading {
+	out := make(chan DepthReading, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		close(out)
+		return out
+	}
+	if w.stop == nil {
+		w.stop = make(chan struct{})
+	}
+	var crossed []DepthEvent
+	var alerts depthAlerts
+	for _, pct := range thresholds {
+		alerts.add(pct, func(e DepthEvent) { crossed = append(crossed, e) })
+	}
+	w.wg.Go(func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last DepthReading
+		sent := false
+		for {
+			capacity := q.Capacity()
+			// tail first, as in Depth
+			tail := q.ConsumerTail()
+			head := q.ProducerHead()
+			depth := min(head-tail, capacity)
+			alerts.check(depth, capacity)
+			if !sent || head != last.Head || tail != last.Tail || crossed != nil {
+				last = DepthReading{At: time.Now(), Depth: depth, Capacity: capacity, Head: head, Tail: tail, Crossed: crossed}
+				send(out, last)
+				crossed, sent = nil, true
+			}
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+	return out
+}
+
+// send puts s on out without blocking its only sender: a sample the
+// receiver has not taken yet is replaced, its crossings kept.
+func send(out chan DepthReading, s DepthReading) {
+	select {
+	case out <- s:
+		return
+	default:
+	}
+	select {
+	case old := <-out:
+		s.Crossed = append(old.Crossed, s.Crossed...)
+	default:
+	}
+	out <- s
+}
+
+// close stops every watcher and waits for them; later watches get a
+// closed channel.
+func (w *depthWatchers) close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		if w.stop != nil {
+			close(w.stop)
+		}
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
+
+// WatchDepth samples the depth every interval from a goroutine of its own
+// and delivers it on the returned channel, edge-triggered: only when
+// orders were published or released since the last sample, or the fill
+// crossed one of thresholds (fractions 0..1, as OnDepthThreshold), so an
+// idle ring sends nothing. Unlike OnDepthThreshold it costs the producer
+// nothing and any goroutine may watch. The channel is closed by Close.
+func (q *Queue) WatchDepth(interval time.Duration, thresholds ...float64) <-chan DepthReading {
+	return q.watchers.watch(q, interval, thresholds)
+}
+
+// WatchDepth is Queue.WatchDepth for the in-memory ring.
+func (q *MemQueue) WatchDepth(interval time.Duration, thresholds ...float64) <-chan DepthReading {
+	return q.watchers.watch(q, interval, thresholds)
+}
+
+// WatchDepth is Queue.WatchDepth for a read-only view.
+func (r *ReadOnlyQueue) WatchDepth(interval time.Duration, thresholds ...float64) <-chan DepthReading {
+	return r.q.WatchDepth(interval, thresholds...)
+}
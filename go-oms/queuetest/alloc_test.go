@@ -0,0 +1,37 @@
+package queuetest
+
+import (
+	"testing"
+
+	"oms/queue"
+	"oms/risk"
+	"oms/session"
+	"oms/stats"
+)
+
+// TestMiddlewareChainZeroAlloc runs an accepted order through the decorators
+// omsbroker stacks in front of the ring. Refusals may allocate their error;
+// the accept path may not.
+func TestMiddlewareChainZeroAlloc(t *testing.T) {
+	mem := queue.NewInMemory(4096)
+	sess := &session.Session{}
+	sess.Set(session.Open)
+	checker := risk.NewChecker(risk.Limits{MaxPosition: 1 << 40, MaxMsgRate: 1 << 30})
+	var q queue.OrderQueue = &stats.Counted{OrderQueue: mem, Symbols: stats.NewSymbols()}
+	q = &session.Gate{OrderQueue: q, Session: sess}
+	q = &risk.Guard{OrderQueue: q, Checker: checker, Switch: risk.NewKillSwitch(nil)}
+
+	order := queue.Order{OrderID: 1, ClientID: 7, Symbol: 3, Quantity: 100, Price: 10000}
+	// the first order for a client creates its risk state
+	if err := q.Enqueue(order); err != nil {
+		t.Fatal(err)
+	}
+	n := testing.AllocsPerRun(1000, func() {
+		if err := q.Enqueue(order); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if n != 0 {
+		t.Fatalf("%.1f allocs per order through the chain, want 0", n)
+	}
+}
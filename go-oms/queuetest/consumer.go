@@ -0,0 +1,132 @@
+// Package queuetest provides a scripted stand-in for the matching engine so
+// producer backpressure and recovery paths can be tested without Rust.
+package queuetest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"oms/queue"
+	"oms/risk"
+)
+
+// Consumer drains an order queue and, like the engine, echoes every order
+// back on the status queue as filled or rejected.
+type Consumer struct {
+	Orders queue.OrderQueue
+	Status queue.OrderQueue // optional; statuses are not sent when nil
+
+	// RejectEvery rejects every Nth consumed order. Zero never rejects.
+	RejectEvery uint64
+
+	// Bands, when set, rejects orders priced through their symbol's band
+	// with ReasonPriceBand, as the engine's limit up-limit down check
+	// would, and moves the bands with the fills.
+	Bands *risk.Bands
+
+	consumed      uint64
+	rejected      uint64
+	statusDropped uint64
+}
+
+// Phase is one step of a consumer script.
+type Phase struct {
+	Rate int // orders per second; zero stalls for the whole phase
+	For  time.Duration
+}
+
+// Consume returns a phase draining rate orders/sec for d.
+func Consume(rate int, d time.Duration) Phase {
+	return Phase{Rate: rate, For: d}
+}
+
+// Stall returns a phase that consumes nothing for d.
+func Stall(d time.Duration) Phase {
+	return Phase{For: d}
+}
+
+// Step synchronously consumes up to n orders and returns how many it took.
+// It never sleeps, so tests driving it are fully deterministic.
+func (c *Consumer) Step(n int) (int, error) {
+	for i := range n {
+		order, err := c.Orders.Dequeue()
+		if err != nil {
+			return i, err
+		}
+		if order == nil {
+			return i, nil
+		}
+		c.consumed++
+
+		status := *order
+		status.Status = queue.StatusFilled
+		now := time.Now()
+		if c.Bands != nil && !order.IsControl() {
+			if err := c.Bands.Check(*order, now); err != nil {
+				status.Status = queue.StatusRejected
+				status.Reason = queue.ReasonOf(err)
+			}
+		}
+		if status.Status == queue.StatusFilled && c.RejectEvery > 0 && c.consumed%c.RejectEvery == 0 {
+			status.Status = queue.StatusRejected
+			status.Reason = queue.ReasonEngine
+		}
+		if status.Status == queue.StatusRejected {
+			c.rejected++
+		} else if c.Bands != nil {
+			c.Bands.OnTrade(status, now)
+		}
+		if c.Status != nil {
+			if err := c.Status.Enqueue(status); errors.Is(err, queue.ErrQueueFull) {
+				c.statusDropped++
+			} else if err != nil {
+				return i + 1, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Run plays the phases in order and returns when the script ends or ctx is
+// done. Consumption is paced on a 1ms tick.
+func (c *Consumer) Run(ctx context.Context, phases ...Phase) error {
+	const tick = time.Millisecond
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for _, p := range phases {
+		start := time.Now()
+		budget := 0.0
+		for time.Since(start) < p.For {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+			if p.Rate == 0 {
+				continue
+			}
+			budget += float64(p.Rate) * tick.Seconds()
+			if budget < 1 {
+				continue
+			}
+			n, err := c.Step(int(budget))
+			if err != nil {
+				return err
+			}
+			// an empty queue doesn't bank credit for later bursts
+			budget = min(budget-float64(n), 1)
+		}
+	}
+	return nil
+}
+
+// Consumed is the number of orders dequeued so far.
+func (c *Consumer) Consumed() uint64 { return c.consumed }
+
+// Rejected is the number of orders answered with StatusRejected.
+func (c *Consumer) Rejected() uint64 { return c.rejected }
+
+// StatusDropped is the number of statuses lost to a full status queue.
+func (c *Consumer) StatusDropped() uint64 { return c.statusDropped }
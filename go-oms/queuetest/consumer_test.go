@@ -0,0 +1,65 @@
+package queuetest
+
+import (
+	"testing"
+
+	"oms/queue"
+	"oms/refdata"
+	"oms/risk"
+)
+
+func TestConsumerStepRejectsEveryNth(t *testing.T) {
+	orders := queue.NewInMemory(16)
+	status := queue.NewInMemory(16)
+	for i := uint64(1); i <= 10; i++ {
+		if err := orders.Enqueue(queue.Order{OrderID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &Consumer{Orders: orders, Status: status, RejectEvery: 3}
+	n, err := c.Step(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 || c.Consumed() != 10 || c.Rejected() != 3 {
+		t.Fatalf("step=%d consumed=%d rejected=%d", n, c.Consumed(), c.Rejected())
+	}
+
+	for i := uint64(1); i <= 10; i++ {
+		s, _ := status.Dequeue()
+		want := queue.StatusFilled
+		if i%3 == 0 {
+			want = queue.StatusRejected
+		}
+		if s.OrderID != i || s.Status != want {
+			t.Fatalf("status %d: got order %d status %d", i, s.OrderID, s.Status)
+		}
+	}
+}
+
+func TestConsumerPriceBands(t *testing.T) {
+	store, err := refdata.New([]refdata.Instrument{{ID: 1, Symbol: "AAPL", Active: true, RefPrice: 10000, BandBps: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := queue.NewInMemory(16)
+	status := queue.NewInMemory(16)
+	for i, price := range []uint64{10100, 10300, 10150} {
+		if err := orders.Enqueue(queue.Order{OrderID: uint64(i + 1), Symbol: 1, Quantity: 1, Price: price}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &Consumer{Orders: orders, Status: status, Bands: risk.NewBands(refdata.NewLive(store), 0)}
+	if _, err := c.Step(3); err != nil {
+		t.Fatal(err)
+	}
+	// the fill at 10100 moves the band up to 10201
+	for _, want := range []uint8{queue.StatusFilled, queue.StatusRejected, queue.StatusFilled} {
+		s, _ := status.Dequeue()
+		if s.Status != want || (want == queue.StatusRejected) != (s.Reason == queue.ReasonPriceBand) {
+			t.Errorf("order %d: status %d reason %d", s.OrderID, s.Status, s.Reason)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package refdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Level is a tier of the account hierarchy: a firm has clients, and a
+// client has sub-accounts. Orders carry the client in Order.ClientID and
+// the sub-account in Order.SubAccount, 0 being the client's own account.
+type Level uint8
+
+const (
+	LevelFirm Level = iota + 1
+	LevelClient
+	LevelSubAccount
+)
+
+var levelNames = map[Level]string{LevelFirm: "firm", LevelClient: "client", LevelSubAccount: "sub_account"}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", uint8(l))
+}
+
+// ParseLevel is the level a name from Level.String stands for.
+func ParseLevel(name string) (Level, error) {
+	for l, n := range levelNames {
+		if n == name {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown account level %q", name)
+}
+
+// AccountRef names one account at one level: a firm by ID, a client by ID,
+// or a sub-account by its client's ID and Sub.
+type AccountRef struct {
+	Level Level
+	ID    uint32
+	Sub   uint8
+}
+
+// FirmRef, ClientRef and SubAccountRef build the refs of each level.
+func FirmRef(firm uint32) AccountRef     { return AccountRef{Level: LevelFirm, ID: firm} }
+func ClientRef(client uint32) AccountRef { return AccountRef{Level: LevelClient, ID: client} }
+func SubAccountRef(client uint32, sub uint8) AccountRef {
+	return AccountRef{Level: LevelSubAccount, ID: client, Sub: sub}
+}
+
+// String is "firm:1", "client:1001" or "sub:1001.2", as ParseAccountRef
+// reads it.
+func (r AccountRef) String() string {
+	switch r.Level {
+	case LevelFirm:
+		return "firm:" + strconv.FormatUint(uint64(r.ID), 10)
+	case LevelClient:
+		return "client:" + strconv.FormatUint(uint64(r.ID), 10)
+	case LevelSubAccount:
+		return fmt.Sprintf("sub:%d.%d", r.ID, r.Sub)
+	}
+	return fmt.Sprintf("%v:%d.%d", r.Level, r.ID, r.Sub)
+}
+
+func ParseAccountRef(s string) (AccountRef, error) {
+	level, id, ok := strings.Cut(s, ":")
+	if !ok {
+		return AccountRef{}, fmt.Errorf("account %q is not firm:N, client:N or sub:N.M", s)
+	}
+	var sub uint64
+	var err error
+	if level == "sub" {
+		var subText string
+		if id, subText, ok = strings.Cut(id, "."); !ok {
+			return AccountRef{}, fmt.Errorf("sub-account %q is not sub:client.sub", s)
+		}
+		sub, err = strconv.ParseUint(subText, 10, 8)
+		if err != nil {
+			return AccountRef{}, fmt.Errorf("sub-account %q: %w", s, err)
+		}
+	}
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return AccountRef{}, fmt.Errorf("account %q: %w", s, err)
+	}
+	switch level {
+	case "firm":
+		return FirmRef(uint32(n)), nil
+	case "client":
+		return ClientRef(uint32(n)), nil
+	case "sub":
+		return SubAccountRef(uint32(n), uint8(sub)), nil
+	}
+	return AccountRef{}, fmt.Errorf("account %q is not firm:N, client:N or sub:N.M", s)
+}
+
+// Account is one node of the hierarchy. A firm has only Firm set; a
+// client has Firm and Client; a sub-account has all three, Sub from 1.
+type Account struct {
+	Firm   uint32 `json:"firm"`
+	Client uint32 `json:"client,omitempty"`
+	Sub    uint8  `json:"sub_account,omitempty"`
+	Name   string `json:"name"`
+}
+
+// Ref is the account's own ref.
+func (a Account) Ref() AccountRef {
+	switch {
+	case a.Client == 0:
+		return FirmRef(a.Firm)
+	case a.Sub == 0:
+		return ClientRef(a.Client)
+	}
+	return SubAccountRef(a.Client, a.Sub)
+}
+
+// Accounts indexes the hierarchy. It is read-only once built.
+type Accounts struct {
+	byRef   map[AccountRef]Account
+	clients map[uint32][]uint32 // firm → its clients
+}
+
+// NewAccounts builds the hierarchy, rejecting duplicates and any client
+// or sub-account whose parent is not listed.
+func NewAccounts(accounts []Account) (*Accounts, error) {
+	a := &Accounts{byRef: make(map[AccountRef]Account, len(accounts)), clients: make(map[uint32][]uint32)}
+	for _, acct := range accounts {
+		if acct.Firm == 0 {
+			return nil, fmt.Errorf("account %q has no firm", acct.Name)
+		}
+		ref := acct.Ref()
+		if _, dup := a.byRef[ref]; dup {
+			return nil, fmt.Errorf("duplicate account %v", ref)
+		}
+		a.byRef[ref] = acct
+	}
+	for ref, acct := range a.byRef {
+		switch ref.Level {
+		case LevelClient:
+			if _, ok := a.byRef[FirmRef(acct.Firm)]; !ok {
+				return nil, fmt.Errorf("client %d: firm %d not listed", acct.Client, acct.Firm)
+			}
+			a.clients[acct.Firm] = append(a.clients[acct.Firm], acct.Client)
+		case LevelSubAccount:
+			parent, ok := a.byRef[ClientRef(acct.Client)]
+			if !ok || parent.Firm != acct.Firm {
+				return nil, fmt.Errorf("%v: client %d not listed under firm %d", ref, acct.Client, acct.Firm)
+			}
+		}
+	}
+	return a, nil
+}
+
+// LoadAccounts reads a CSV account file with the header
+// firm,client,sub_account,name, one account per line. A line with the
+// client empty is a firm, one with only the sub-account empty a client:
+//
+//	firm,client,sub_account,name
+//	1,,,Acme Capital
+//	1,1001,,Acme Fund I
+//	1,1001,1,Acme Fund I long/short
+func LoadAccounts(path string) (*Accounts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open accounts: %w", err)
+	}
+	defer f.Close()
+	accounts, err := ReadAccountsCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewAccounts(accounts)
+}
+
+// ReadAccountsCSV parses accounts in the LoadAccounts format.
+func ReadAccountsCSV(r io.Reader) ([]Account, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 4
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	var accounts []Account
+	for i, rec := range records[1:] {
+		optional := func(s string, bits int) (uint64, error) {
+			if s = strings.TrimSpace(s); s == "" {
+				return 0, nil
+			}
+			return strconv.ParseUint(s, 10, bits)
+		}
+		firm, err1 := strconv.ParseUint(strings.TrimSpace(rec[0]), 10, 32)
+		client, err2 := optional(rec[1], 32)
+		sub, err3 := optional(rec[2], 8)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		if client == 0 && sub != 0 {
+			return nil, fmt.Errorf("line %d: sub-account without a client", i+2)
+		}
+		accounts = append(accounts, Account{
+			Firm:   uint32(firm),
+			Client: uint32(client),
+			Sub:    uint8(sub),
+			Name:   strings.TrimSpace(rec[3]),
+		})
+	}
+	return accounts, nil
+}
+
+// Account returns the account ref names.
+func (a *Accounts) Account(ref AccountRef) (Account, bool) {
+	acct, ok := a.byRef[ref]
+	return acct, ok
+}
+
+// FirmOf returns the firm a client belongs to.
+func (a *Accounts) FirmOf(client uint32) (uint32, bool) {
+	acct, ok := a.byRef[ClientRef(client)]
+	return acct.Firm, ok
+}
+
+// Clients returns the clients of a firm, in no particular order.
+func (a *Accounts) Clients(firm uint32) []uint32 {
+	return a.clients[firm]
+}
+
+// Accounts returns every account, in no particular order.
+func (a *Accounts) Accounts() []Account {
+	out := make([]Account, 0, len(a.byRef))
+	for _, acct := range a.byRef {
+		out = append(out, acct)
+	}
+	return out
+}
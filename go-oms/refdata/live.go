@@ -0,0 +1,49 @@
+package refdata
+
+import (
+	"sync/atomic"
+
+	"oms/queue"
+)
+
+// Live holds the Store in force. A reload builds a whole new Store and
+// swaps it in, so readers on the order path see either the old reference
+// data or the new, never a half-built index.
+type Live struct {
+	store atomic.Pointer[Store]
+}
+
+// NewLive returns a Live serving s.
+func NewLive(s *Store) *Live {
+	l := &Live{}
+	l.store.Store(s)
+	return l
+}
+
+// Store is the Store in force.
+func (l *Live) Store() *Store {
+	return l.store.Load()
+}
+
+// Swap puts s in force and returns the Store it replaced.
+func (l *Live) Swap(s *Store) *Store {
+	return l.store.Swap(s)
+}
+
+// Gate wraps an order queue with Validate against the Store in force.
+// Control messages pass through unchecked.
+type Gate struct {
+	queue.OrderQueue
+	Ref *Live
+}
+
+var _ queue.OrderQueue = (*Gate)(nil)
+
+func (g *Gate) Enqueue(order queue.Order) error {
+	if !order.IsControl() {
+		if err := g.Ref.Store().Validate(order); err != nil {
+			return err
+		}
+	}
+	return g.OrderQueue.Enqueue(order)
+}
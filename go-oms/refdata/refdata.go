@@ -0,0 +1,360 @@
+// Package refdata holds instrument reference data: the interned symbol IDs
+// carried in Order.Symbol and the static rules orders are validated against.
+//
+// Upstream systems name instruments differently (native ticker, Reuters RIC,
+// Bloomberg ticker, venue aliases). Resolve maps any of them to the one
+// interned instrument, so gateways normalize at the boundary and everything
+// past it only sees Order.Symbol.
+//
+// It also holds the account hierarchy, firm → client → sub-account, that
+// risk limits and positions roll up through; see Accounts.
+package refdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"oms/queue"
+)
+
+// Instrument is one tradable symbol.
+type Instrument struct {
+	ID       uint32 `json:"id"`        // value carried in Order.Symbol
+	Symbol   string `json:"symbol"`    // native ticker
+	TickSize uint64 `json:"tick_size"` // price increment; 0 allows any price
+	LotSize  uint32 `json:"lot_size"`  // quantity increment; 0 allows any quantity
+	Active   bool   `json:"active"`
+
+	RIC     string   `json:"ric,omitempty"`     // e.g. "AAPL.OQ"
+	BBG     string   `json:"bbg,omitempty"`     // e.g. "AAPL US Equity"
+	Aliases []string `json:"aliases,omitempty"` // any other names upstream systems use
+
+	// The limit up-limit down band is BandBps basis points either side of
+	// the reference price: RefPrice, such as the previous close, until the
+	// symbol trades, then the recent average trade price (see risk.Bands).
+	// Zero BandBps leaves the symbol unbanded.
+	RefPrice uint64 `json:"ref_price,omitempty"`
+	BandBps  uint32 `json:"band_bps,omitempty"`
+
+	// Derivative contracts: Type is a queue.Instrument value, equity by
+	// default. Futures have a Maturity, options a Maturity and a Strike.
+	// A contract's prices are per unit of the underlying and Multiplier
+	// units make one contract; 0 counts as 1.
+	Type       uint8  `json:"type,omitempty"`
+	Underlying uint32 `json:"underlying,omitempty"` // ID of the underlying instrument, 0 if not listed
+	Maturity   string `json:"maturity,omitempty"`   // last trading day, 2006-01-02
+	Strike     uint64 `json:"strike,omitempty"`     // price units
+	Multiplier uint32 `json:"multiplier,omitempty"`
+}
+
+var typeNames = [...]string{
+	queue.InstrumentEquity: "equity",
+	queue.InstrumentFuture: "future",
+	queue.InstrumentCall:   "call",
+	queue.InstrumentPut:    "put",
+}
+
+// TypeName names an Instrument.Type value, e.g. "future".
+func TypeName(t uint8) string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return fmt.Sprintf("type(%d)", t)
+}
+
+// ParseType is the inverse of TypeName; "" is equity.
+func ParseType(name string) (uint8, error) {
+	if name == "" {
+		return queue.InstrumentEquity, nil
+	}
+	for t, n := range typeNames {
+		if n == strings.ToLower(name) {
+			return uint8(t), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown instrument type %q", name)
+}
+
+// ContractMultiplier is the number of units of the underlying one lot of
+// the instrument stands for: the value of a fill is Quantity × Price ×
+// ContractMultiplier.
+func (i Instrument) ContractMultiplier() int64 {
+	return int64(max(i.Multiplier, 1))
+}
+
+// validateTerms checks that the contract terms fit the instrument type.
+func (i Instrument) validateTerms() error {
+	switch i.Type {
+	case queue.InstrumentEquity:
+		if i.Maturity != "" || i.Strike != 0 {
+			return fmt.Errorf("equity with a maturity or strike")
+		}
+		return nil
+	case queue.InstrumentFuture:
+		if i.Strike != 0 {
+			return fmt.Errorf("future with a strike")
+		}
+	case queue.InstrumentCall, queue.InstrumentPut:
+		if i.Strike == 0 {
+			return fmt.Errorf("option without a strike")
+		}
+	default:
+		return fmt.Errorf("unknown instrument type %d", i.Type)
+	}
+	if i.Maturity == "" {
+		return fmt.Errorf("%s without a maturity", TypeName(i.Type))
+	}
+	if _, err := time.Parse(time.DateOnly, i.Maturity); err != nil {
+		return fmt.Errorf("maturity: %w", err)
+	}
+	return nil
+}
+
+var (
+	ErrUnknownSymbol = queue.NewReject(queue.ReasonUnknownSymbol, "unknown symbol")
+	ErrInactive      = errors.New("instrument not active")
+)
+
+// Identifier schemes accepted as a prefix by Resolve, e.g. "RIC:AAPL.OQ".
+// Without a prefix an identifier is matched against every scheme.
+const (
+	SchemeNative = "NATIVE"
+	SchemeRIC    = "RIC"
+	SchemeBBG    = "BBG"
+)
+
+// Store indexes instruments by ID, by ticker and by every identifier
+// Resolve accepts. It is read-only once built.
+type Store struct {
+	byID     map[uint32]Instrument
+	bySymbol map[string]Instrument
+	byName   map[string]uint32 // Normalize(identifier), with and without scheme
+}
+
+// New builds a Store, rejecting duplicate IDs and tickers, and any
+// identifier that would resolve to two different instruments.
+func New(instruments []Instrument) (*Store, error) {
+	s := &Store{
+		byID:     make(map[uint32]Instrument, len(instruments)),
+		bySymbol: make(map[string]Instrument, len(instruments)),
+		byName:   make(map[string]uint32, 3*len(instruments)),
+	}
+	for _, inst := range instruments {
+		if _, dup := s.byID[inst.ID]; dup {
+			return nil, fmt.Errorf("duplicate instrument id %d", inst.ID)
+		}
+		if _, dup := s.bySymbol[inst.Symbol]; dup {
+			return nil, fmt.Errorf("duplicate symbol %q", inst.Symbol)
+		}
+		if err := inst.validateTerms(); err != nil {
+			return nil, fmt.Errorf("instrument %s: %w", inst.Symbol, err)
+		}
+		s.byID[inst.ID] = inst
+		s.bySymbol[inst.Symbol] = inst
+	}
+	for _, inst := range instruments {
+		if _, ok := s.byID[inst.Underlying]; inst.Underlying != 0 && !ok {
+			return nil, fmt.Errorf("instrument %s: underlying %d not listed", inst.Symbol, inst.Underlying)
+		}
+	}
+	for _, inst := range instruments {
+		names := [][2]string{{SchemeNative, inst.Symbol}, {SchemeRIC, inst.RIC}, {SchemeBBG, inst.BBG}}
+		for _, alias := range inst.Aliases {
+			names = append(names, [2]string{"", alias})
+		}
+		for _, n := range names {
+			if n[1] == "" {
+				continue
+			}
+			keys := []string{Normalize(n[1])}
+			if n[0] != "" {
+				keys = append(keys, n[0]+":"+keys[0])
+			}
+			for _, key := range keys {
+				if other, dup := s.byName[key]; dup && other != inst.ID {
+					return nil, fmt.Errorf("identifier %q names both %s and %s",
+						n[1], s.byID[other].Symbol, inst.Symbol)
+				}
+				s.byName[key] = inst.ID
+			}
+		}
+	}
+	return s, nil
+}
+
+// Normalize canonicalizes an identifier for matching: surrounding space is
+// trimmed, inner runs of space collapse to one, and letters are upper-cased.
+// "aapl us  equity" and "AAPL US Equity" normalize alike.
+func Normalize(identifier string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(identifier), " "))
+}
+
+// Load reads a CSV instrument file with the header
+// id,symbol,tick_size,lot_size,active[,ric,bbg,aliases[,ref_price,band_bps
+// [,type,underlying,maturity,strike,multiplier]]]. The identifier, band
+// and contract columns are optional; aliases are separated by "|". A
+// December call on instrument 1, for 100 shares a contract:
+//
+//	id,symbol,tick_size,lot_size,active,ric,bbg,aliases,ref_price,band_bps,type,underlying,maturity,strike,multiplier
+//	101,AAPL 261218C200,1,1,true,,,,,,call,1,2026-12-18,20000,100
+func Load(path string) (*Store, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open refdata: %w", err)
+	}
+	defer f.Close()
+	instruments, err := ReadCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return New(instruments)
+}
+
+// ReadCSV parses instruments in the Load format.
+func ReadCSV(r io.Reader) ([]Instrument, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // identifier columns are optional
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	var instruments []Instrument
+	for i, rec := range records[1:] {
+		if len(rec) < 5 || len(rec) > 15 {
+			return nil, fmt.Errorf("line %d: want 5 to 15 fields, got %d", i+2, len(rec))
+		}
+		id, err1 := strconv.ParseUint(rec[0], 10, 32)
+		tick, err2 := strconv.ParseUint(rec[2], 10, 64)
+		lot, err3 := strconv.ParseUint(rec[3], 10, 32)
+		active, err4 := strconv.ParseBool(rec[4])
+		if err := errors.Join(err1, err2, err3, err4); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		inst := Instrument{
+			ID:       uint32(id),
+			Symbol:   strings.TrimSpace(rec[1]),
+			TickSize: tick,
+			LotSize:  uint32(lot),
+			Active:   active,
+		}
+		optional := func(i int) string {
+			if i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		inst.RIC, inst.BBG = optional(5), optional(6)
+		for _, alias := range strings.Split(optional(7), "|") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				inst.Aliases = append(inst.Aliases, alias)
+			}
+		}
+		if ref := optional(8); ref != "" {
+			if inst.RefPrice, err = strconv.ParseUint(ref, 10, 64); err != nil {
+				return nil, fmt.Errorf("line %d: ref_price: %w", i+2, err)
+			}
+		}
+		if bps := optional(9); bps != "" {
+			n, err := strconv.ParseUint(bps, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: band_bps: %w", i+2, err)
+			}
+			inst.BandBps = uint32(n)
+		}
+		if inst.Type, err = ParseType(optional(10)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		inst.Maturity = optional(12)
+		for _, col := range []struct {
+			i    int
+			name string
+			bits int
+			set  func(uint64)
+		}{
+			{11, "underlying", 32, func(n uint64) { inst.Underlying = uint32(n) }},
+			{13, "strike", 64, func(n uint64) { inst.Strike = n }},
+			{14, "multiplier", 32, func(n uint64) { inst.Multiplier = uint32(n) }},
+		} {
+			if text := optional(col.i); text != "" {
+				n, err := strconv.ParseUint(text, 10, col.bits)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s: %w", i+2, col.name, err)
+				}
+				col.set(n)
+			}
+		}
+		instruments = append(instruments, inst)
+	}
+	return instruments, nil
+}
+
+// ByID returns the instrument with the interned id.
+func (s *Store) ByID(id uint32) (Instrument, bool) {
+	inst, ok := s.byID[id]
+	return inst, ok
+}
+
+// Lookup resolves a ticker to its instrument.
+func (s *Store) Lookup(symbol string) (Instrument, bool) {
+	inst, ok := s.bySymbol[symbol]
+	return inst, ok
+}
+
+// Resolve maps any known identifier to its instrument: the native ticker,
+// RIC, Bloomberg ticker or an alias, optionally prefixed with its scheme
+// ("RIC:AAPL.OQ", "BBG:AAPL US Equity"). Matching is on Normalize'd form.
+func (s *Store) Resolve(identifier string) (Instrument, error) {
+	if id, ok := s.byName[Normalize(identifier)]; ok {
+		return s.byID[id], nil
+	}
+	return Instrument{}, fmt.Errorf("%w: %q", ErrUnknownSymbol, identifier)
+}
+
+// Instruments returns every instrument, in no particular order.
+func (s *Store) Instruments() []Instrument {
+	out := make([]Instrument, 0, len(s.byID))
+	for _, inst := range s.byID {
+		out = append(out, inst)
+	}
+	return out
+}
+
+// Validate checks a new order against the static instrument rules.
+func (s *Store) Validate(order queue.Order) error {
+	inst, ok := s.byID[order.Symbol]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownSymbol, order.Symbol)
+	}
+	if !inst.Active {
+		return fmt.Errorf("%w: %s", ErrInactive, inst.Symbol)
+	}
+	if order.Quantity == 0 {
+		return fmt.Errorf("zero quantity")
+	}
+	if inst.LotSize > 0 && order.Quantity%inst.LotSize != 0 {
+		return fmt.Errorf("quantity %d not a multiple of lot size %d", order.Quantity, inst.LotSize)
+	}
+	if order.Price == 0 && !order.IsStop() {
+		// a plain stop takes its price from the trade that triggers it
+		return fmt.Errorf("zero price")
+	}
+	if inst.TickSize > 0 && order.Price%inst.TickSize != 0 {
+		return fmt.Errorf("price %d not on tick size %d", order.Price, inst.TickSize)
+	}
+	if inst.TickSize > 0 && uint64(order.TriggerPrice)%inst.TickSize != 0 {
+		return fmt.Errorf("trigger price %d not on tick size %d", order.TriggerPrice, inst.TickSize)
+	}
+	if err := order.ValidateStop(); err != nil {
+		return err
+	}
+	return order.ValidateFlags()
+}
@@ -0,0 +1,148 @@
+package refdata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"oms/queue"
+)
+
+const instrumentsCSV = `id,symbol,tick_size,lot_size,active,ric,bbg,aliases,ref_price,band_bps
+1,AAPL,1,1,true,AAPL.OQ,AAPL US Equity,APPLE|XNAS:AAPL,15000,500
+2,BRKB,1,1,true,BRK_b.N,BRK/B US Equity,
+3,MSFT,1,1,true
+`
+
+func TestResolveAliases(t *testing.T) {
+	instruments, err := ReadCSV(strings.NewReader(instrumentsCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(instruments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]uint32{
+		"AAPL":               1,
+		" aapl.oq ":          1,
+		"aapl  us   equity":  1,
+		"BBG:AAPL US Equity": 1,
+		"RIC:AAPL.OQ":        1,
+		"xnas:aapl":          1,
+		"brk_B.n":            2,
+		"NATIVE:msft":        3,
+	} {
+		inst, err := s.Resolve(name)
+		if err != nil || inst.ID != want {
+			t.Errorf("Resolve(%q) = %d, %v; want %d", name, inst.ID, err, want)
+		}
+	}
+	if aapl, _ := s.ByID(1); aapl.RefPrice != 15000 || aapl.BandBps != 500 {
+		t.Errorf("AAPL band %d bps around %d", aapl.BandBps, aapl.RefPrice)
+	}
+	if _, err := s.Resolve("RIC:AAPL"); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("native ticker under the RIC scheme: %v", err)
+	}
+}
+
+func TestConflictingIdentifier(t *testing.T) {
+	_, err := New([]Instrument{
+		{ID: 1, Symbol: "AAPL", RIC: "AAPL.OQ"},
+		{ID: 2, Symbol: "AAPX", Aliases: []string{"aapl.oq"}},
+	})
+	if err == nil {
+		t.Fatal("alias shared by two instruments accepted")
+	}
+}
+
+func TestContracts(t *testing.T) {
+	instruments, err := ReadCSV(strings.NewReader(`id,symbol,tick_size,lot_size,active,ric,bbg,aliases,ref_price,band_bps,type,underlying,maturity,strike,multiplier
+1,AAPL,1,1,true
+101,AAPL 261218C200,1,1,true,,,,,,call,1,2026-12-18,20000,100
+201,ESZ6,25,1,true,,,,,,future,,2026-12-18,,50
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(instruments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call, _ := s.ByID(101)
+	if call.Type != queue.InstrumentCall || call.Underlying != 1 || call.Strike != 20000 || call.ContractMultiplier() != 100 {
+		t.Errorf("call %+v", call)
+	}
+	if aapl, _ := s.ByID(1); aapl.ContractMultiplier() != 1 || TypeName(aapl.Type) != "equity" {
+		t.Errorf("equity %+v", aapl)
+	}
+
+	for name, bad := range map[string]Instrument{
+		"future without maturity": {Type: queue.InstrumentFuture},
+		"option without strike":   {Type: queue.InstrumentPut, Maturity: "2026-12-18"},
+		"equity with strike":      {Strike: 100},
+		"bad maturity":            {Type: queue.InstrumentFuture, Maturity: "Dec26"},
+		"unknown underlying":      {Type: queue.InstrumentFuture, Maturity: "2026-12-18", Underlying: 9},
+		"unknown type":            {Type: 9},
+	} {
+		bad.ID, bad.Symbol = 1, "X"
+		if _, err := New([]Instrument{bad}); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
+
+const accountsCSV = `firm,client,sub_account,name
+1,,,Acme Capital
+1,1001,,Acme Fund I
+1,1001,2,Acme Fund I long/short
+1,1002,,Acme Fund II
+2,,,Other Firm
+2,2001,,Other Fund
+`
+
+func TestAccounts(t *testing.T) {
+	accounts, err := ReadAccountsCSV(strings.NewReader(accountsCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewAccounts(accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firm, ok := a.FirmOf(1002); !ok || firm != 1 {
+		t.Fatalf("firm of 1002: %d, %v", firm, ok)
+	}
+	if clients := a.Clients(1); len(clients) != 2 {
+		t.Fatalf("clients of firm 1: %v", clients)
+	}
+	if acct, ok := a.Account(SubAccountRef(1001, 2)); !ok || acct.Name != "Acme Fund I long/short" {
+		t.Fatalf("sub:1001.2 = %+v", acct)
+	}
+
+	for _, s := range []string{"firm:1", "client:1001", "sub:1001.2"} {
+		ref, err := ParseAccountRef(s)
+		if err != nil || ref.String() != s {
+			t.Errorf("%s parsed as %v, %v", s, ref, err)
+		}
+	}
+	for _, s := range []string{"1001", "desk:1", "sub:1001", "sub:1001.300"} {
+		if _, err := ParseAccountRef(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+
+	for _, bad := range []string{
+		"1,1001,,Orphan client\n",               // firm 1 not listed
+		"1,,,A\n1,,,B\n",                        // duplicate firm
+		"1,,,A\n2,,,B\n1,1001,,C\n2,1001,7,D\n", // sub-account under the wrong firm
+	} {
+		accounts, err := ReadAccountsCSV(strings.NewReader("firm,client,sub_account,name\n" + bad))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewAccounts(accounts); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package reload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"oms/refdata"
+	"oms/risk"
+)
+
+func TestReloadIsAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	limitsPath := filepath.Join(dir, "limits.json")
+	refPath := filepath.Join(dir, "instruments.csv")
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(limitsPath, `{"defaults": {"max_msg_rate": 100}, "clients": {"7": {"max_position": 500}}}`)
+	write(refPath, "id,symbol,tick_size,lot_size,active\n1,AAPL,1,1,true\n")
+
+	checker := risk.NewChecker(risk.Limits{})
+	checker.SetLimits(9, risk.Limits{MaxLoss: 1000}) // operator override
+	live := refdata.NewLive(nil)
+	r := &Reloader{}
+	r.Add(RiskLimits(limitsPath, checker))
+	r.Add(Refdata(refPath, live))
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if checker.Limits(7).MaxPosition != 500 || checker.Limits(8).MaxMsgRate != 100 || checker.Limits(9).MaxLoss != 1000 {
+		t.Fatalf("limits 7=%+v 8=%+v 9=%+v", checker.Limits(7), checker.Limits(8), checker.Limits(9))
+	}
+	if _, err := live.Store().Resolve("AAPL"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a valid refdata edit alongside a bad limits edit changes neither
+	write(refPath, "id,symbol,tick_size,lot_size,active\n2,MSFT,1,1,true\n")
+	write(limitsPath, `{"defaults": {"max_msg_rate": -1}}`)
+	if err := r.Reload(); err == nil {
+		t.Fatal("reload accepted negative limits")
+	}
+	if checker.Limits(8).MaxMsgRate != 100 {
+		t.Fatalf("limits changed by a failed reload: %+v", checker.Limits(8))
+	}
+	if _, err := live.Store().Resolve("AAPL"); err != nil {
+		t.Fatalf("refdata changed by a failed reload: %v", err)
+	}
+}
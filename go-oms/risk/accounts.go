@@ -0,0 +1,221 @@
+package risk
+
+import (
+	"fmt"
+	"maps"
+
+	"oms/queue"
+	"oms/refdata"
+)
+
+// Positions roll up the account hierarchy: every fill counts against its
+// sub-account (Order.SubAccount, 0 being the client's own account), its
+// client and, when the hierarchy is set, the client's firm. MaxPosition
+// and MaxLoss apply at every level; the message rate and price collar are
+// per client only. A breach at firm or sub-account level is charged to
+// the client whose fill made it, which the kill switch then fences off.
+
+// SetAccounts gives the checker the account hierarchy, for limits and
+// exposures at firm level; nil forgets it. Firm positions are summed from
+// the clients', so swapping in a new hierarchy takes effect at once.
+func (c *Checker) SetAccounts(a *refdata.Accounts) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accounts = a
+}
+
+// sub is the books of one of the client's sub-accounts. Its limits live
+// in the Checker, by ref, so they can be set before it first trades.
+func (cs *clientState) sub(n uint8) *clientState {
+	s, ok := cs.subs[n]
+	if !ok {
+		s = &clientState{positions: make(map[uint32]int64), marks: make(map[uint32]uint64)}
+		if cs.subs == nil {
+			cs.subs = make(map[uint8]*clientState)
+		}
+		cs.subs[n] = s
+	}
+	return s
+}
+
+// accountLimits is the firm or sub-account limit in force: set by an
+// operator, else from the limits file, else none.
+func (c *Checker) accountLimits(ref refdata.AccountRef) Limits {
+	if limits, ok := c.accountOverrides[ref]; ok {
+		return limits
+	}
+	return c.configuredAccounts[ref]
+}
+
+// firmOf is the client's firm, if the hierarchy is set and lists it.
+func (c *Checker) firmOf(client uint32) (uint32, bool) {
+	if c.accounts == nil {
+		return 0, false
+	}
+	return c.accounts.FirmOf(client)
+}
+
+// firmPosition sums the firm's clients' positions in symbol.
+func (c *Checker) firmPosition(firm, symbol uint32) int64 {
+	var pos int64
+	for _, client := range c.accounts.Clients(firm) {
+		if cs, ok := c.clients[client]; ok {
+			pos += cs.positions[symbol]
+		}
+	}
+	return pos
+}
+
+// checkAccountOrder is CheckOrder's position check at sub-account and firm
+// level.
+func (c *Checker) checkAccountOrder(order queue.Order) error {
+	qty := signedQty(order)
+	ref := refdata.SubAccountRef(order.ClientID, order.SubAccount)
+	if lim := c.accountLimits(ref).MaxPosition; lim > 0 {
+		var pos int64
+		if cs, ok := c.clients[order.ClientID]; ok {
+			if s, ok := cs.subs[order.SubAccount]; ok {
+				pos = s.positions[order.Symbol]
+			}
+		}
+		if pos += qty; abs(pos) > lim {
+			return fmt.Errorf("%w: order %d would take %v position in symbol %d to %d (limit %d)",
+				ErrLimit, order.OrderID, ref, order.Symbol, pos, lim)
+		}
+	}
+	if firm, ok := c.firmOf(order.ClientID); ok {
+		if lim := c.accountLimits(refdata.FirmRef(firm)).MaxPosition; lim > 0 {
+			if pos := c.firmPosition(firm, order.Symbol) + qty; abs(pos) > lim {
+				return fmt.Errorf("%w: order %d would take firm %d position in symbol %d to %d (limit %d)",
+					ErrLimit, order.OrderID, firm, order.Symbol, pos, lim)
+			}
+		}
+	}
+	return nil
+}
+
+// checkAccountFill is ApplyFill's breach check at sub-account and firm
+// level, after the fill is applied.
+func (c *Checker) checkAccountFill(cs *clientState, status queue.Order) error {
+	breach := func(reason string, args ...any) error {
+		return &BreachError{ClientID: status.ClientID, Reason: fmt.Sprintf(reason, args...)}
+	}
+	ref := refdata.SubAccountRef(status.ClientID, status.SubAccount)
+	s := cs.sub(status.SubAccount)
+	limits := c.accountLimits(ref)
+	if lim := limits.MaxPosition; lim > 0 && abs(s.positions[status.Symbol]) > lim {
+		return breach("%v position %d in symbol %d above %d", ref, s.positions[status.Symbol], status.Symbol, lim)
+	}
+	if lim := limits.MaxLoss; lim > 0 && -s.pnl() > lim {
+		return breach("%v loss %d above %d", ref, -s.pnl(), lim)
+	}
+
+	firm, ok := c.firmOf(status.ClientID)
+	if !ok {
+		return nil
+	}
+	limits = c.accountLimits(refdata.FirmRef(firm))
+	if lim := limits.MaxPosition; lim > 0 {
+		if pos := c.firmPosition(firm, status.Symbol); abs(pos) > lim {
+			return breach("firm %d position %d in symbol %d above %d", firm, pos, status.Symbol, lim)
+		}
+	}
+	if lim := limits.MaxLoss; lim > 0 {
+		var pnl int64
+		for _, client := range c.accounts.Clients(firm) {
+			if cs, ok := c.clients[client]; ok {
+				pnl += cs.pnl()
+			}
+		}
+		if -pnl > lim {
+			return breach("firm %d loss %d above %d", firm, -pnl, lim)
+		}
+	}
+	return nil
+}
+
+// AccountLimits returns the limits in force for an account at any level.
+func (c *Checker) AccountLimits(ref refdata.AccountRef) Limits {
+	if ref.Level == refdata.LevelClient {
+		return c.Limits(ref.ID)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accountLimits(ref)
+}
+
+// SetAccountLimits replaces the limits of an account at any level.
+func (c *Checker) SetAccountLimits(ref refdata.AccountRef, limits Limits) {
+	if ref.Level == refdata.LevelClient {
+		c.SetLimits(ref.ID, limits)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.accountOverrides == nil {
+		c.accountOverrides = make(map[refdata.AccountRef]Limits)
+	}
+	c.accountOverrides[ref] = limits
+}
+
+// ClearAccountLimits drops limits set with SetAccountLimits, so the limits
+// file applies again.
+func (c *Checker) ClearAccountLimits(ref refdata.AccountRef) {
+	if ref.Level == refdata.LevelClient {
+		c.ClearLimits(ref.ID)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.accountOverrides, ref)
+}
+
+// AccountExposures returns a snapshot for every account at level that has
+// traded. Firms need the hierarchy; clients it does not list are left out
+// of every firm.
+func (c *Checker) AccountExposures(level refdata.Level) []Exposure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := []Exposure{}
+	switch level {
+	case refdata.LevelClient:
+		for id, cs := range c.clients {
+			out = append(out, cs.exposure(refdata.ClientRef(id)))
+		}
+	case refdata.LevelSubAccount:
+		for id, cs := range c.clients {
+			for n, s := range cs.subs {
+				out = append(out, s.exposure(refdata.SubAccountRef(id, n)))
+			}
+		}
+	case refdata.LevelFirm:
+		firms := make(map[uint32]*Exposure)
+		for id, cs := range c.clients {
+			firm, ok := c.firmOf(id)
+			if !ok {
+				continue
+			}
+			e, ok := firms[firm]
+			if !ok {
+				e = &Exposure{Account: refdata.FirmRef(firm).String(), Positions: make(map[uint32]int64)}
+				firms[firm] = e
+			}
+			for symbol, pos := range cs.positions {
+				e.Positions[symbol] += pos
+			}
+			e.PnL += cs.pnl()
+			e.Fees += cs.fees
+			e.MakerQty += cs.maker
+			e.TakerQty += cs.taker
+		}
+		for _, e := range firms {
+			out = append(out, *e)
+		}
+	}
+	return out
+}
+
+func (cs *clientState) exposure(ref refdata.AccountRef) Exposure {
+	return Exposure{ClientID: ref.ID, Account: ref.String(), Positions: maps.Clone(cs.positions), PnL: cs.pnl(),
+		Fees: cs.fees, MakerQty: cs.maker, TakerQty: cs.taker}
+}
@@ -0,0 +1,89 @@
+package risk
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"oms/queue"
+	"oms/refdata"
+)
+
+func TestAccountRollup(t *testing.T) {
+	accounts, err := refdata.NewAccounts([]refdata.Account{
+		{Firm: 1, Name: "Acme"},
+		{Firm: 1, Client: 7, Name: "Acme I"},
+		{Firm: 1, Client: 8, Name: "Acme II"},
+		{Firm: 1, Client: 7, Sub: 2, Name: "Acme I desk 2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewChecker(Limits{})
+	c.SetAccounts(accounts)
+	c.Apply(Config{Accounts: map[string]Limits{"firm:1": {MaxPosition: 150}}})
+	c.SetAccountLimits(refdata.SubAccountRef(7, 2), Limits{MaxPosition: 50})
+
+	fill := func(client uint32, sub uint8, qty uint32) error {
+		return c.ApplyFill(queue.Order{ClientID: client, SubAccount: sub, Symbol: 1, Quantity: qty, Price: 10, Status: queue.StatusFilled})
+	}
+	if err := fill(7, 0, 60); err != nil {
+		t.Fatal(err)
+	}
+	if err := fill(7, 2, 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := fill(8, 0, 30); err != nil {
+		t.Fatal(err)
+	}
+
+	// sub-account 2 holds 40 of its 50, the firm 130 of its 150
+	order := queue.Order{ClientID: 7, SubAccount: 2, Symbol: 1, Quantity: 20, Price: 10}
+	if err := c.CheckOrder(order, time.Now()); !errors.Is(err, ErrLimit) || !strings.Contains(err.Error(), "sub:7.2") {
+		t.Fatalf("sub-account limit: %v", err)
+	}
+	order.SubAccount = 0
+	if err := c.CheckOrder(order, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	order.ClientID, order.Quantity = 8, 21
+	if err := c.CheckOrder(order, time.Now()); !errors.Is(err, ErrLimit) || !strings.Contains(err.Error(), "firm 1") {
+		t.Fatalf("firm limit: %v", err)
+	}
+	var breach *BreachError
+	if err := fill(8, 0, 21); !errors.As(err, &breach) || breach.ClientID != 8 {
+		t.Fatalf("firm breach: %v", err)
+	}
+
+	exposure := func(level refdata.Level, account string) Exposure {
+		for _, e := range c.AccountExposures(level) {
+			if e.Account == account {
+				return e
+			}
+		}
+		t.Fatalf("no %s exposure", account)
+		return Exposure{}
+	}
+	if e := exposure(refdata.LevelFirm, "firm:1"); e.Positions[1] != 151 {
+		t.Fatalf("firm exposure %+v", e)
+	}
+	if e := exposure(refdata.LevelClient, "client:7"); e.Positions[1] != 100 {
+		t.Fatalf("client exposure %+v", e)
+	}
+	if e := exposure(refdata.LevelSubAccount, "sub:7.2"); e.Positions[1] != 40 || e.ClientID != 7 {
+		t.Fatalf("sub-account exposure %+v", e)
+	}
+
+	// the file names sub:7.2 now, replacing the operator's limit
+	c.Apply(Config{Accounts: map[string]Limits{"sub:7.2": {MaxPosition: 500}}})
+	if got := c.AccountLimits(refdata.SubAccountRef(7, 2)); got.MaxPosition != 500 {
+		t.Fatalf("sub:7.2 limits %+v", got)
+	}
+	if got := c.AccountLimits(refdata.FirmRef(1)); got.MaxPosition != 0 {
+		t.Fatalf("firm:1 limits %+v after the file dropped them", got)
+	}
+	if err := (Config{Accounts: map[string]Limits{"client:7": {}}}).Validate(); err == nil {
+		t.Fatal("client limits accepted under accounts")
+	}
+}
@@ -0,0 +1,133 @@
+package risk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"oms/queue"
+	"oms/refdata"
+)
+
+// ErrPriceBand refuses an order priced through its symbol's limit up-limit
+// down band.
+var ErrPriceBand = queue.NewReject(queue.ReasonPriceBand, "outside price band")
+
+// DefaultBandWindow is how far back Bands averages trades for the
+// reference price, as in limit up-limit down.
+const DefaultBandWindow = 5 * time.Minute
+
+// Band is a symbol's price band in force.
+type Band struct {
+	Symbol    uint32 `json:"symbol"`
+	Reference uint64 `json:"reference"`
+	Low       uint64 `json:"low"`
+	High      uint64 `json:"high"`
+}
+
+// Bands enforces per-symbol price bands: a buy may not be priced above the
+// band, nor a sell below it. Each band is the instrument's BandBps either
+// side of a reference price that follows the market, the average trade
+// price over the last Window, or the last trade once the window is quiet,
+// starting from the instrument's RefPrice. Symbols without a BandBps, or
+// with no reference price yet, are not banded. It is safe for concurrent
+// use.
+type Bands struct {
+	Ref    *refdata.Live
+	Window time.Duration // DefaultBandWindow if zero
+
+	mu     sync.Mutex
+	trades map[uint32][]trade // symbol → trades within the window, oldest first
+	last   map[uint32]uint64  // symbol → last trade price
+}
+
+type trade struct {
+	at    time.Time
+	price uint64
+}
+
+// NewBands returns bands over the instruments in ref.
+func NewBands(ref *refdata.Live, window time.Duration) *Bands {
+	return &Bands{Ref: ref, Window: window}
+}
+
+// Check refuses order if it is priced through the band at now. Plain stop
+// orders, which carry no price, pass.
+func (b *Bands) Check(order queue.Order, now time.Time) error {
+	if order.IsControl() || order.Price == 0 {
+		return nil
+	}
+	band, ok := b.Band(order.Symbol, now)
+	if !ok {
+		return nil
+	}
+	if order.Side == 1 && order.Price < band.Low {
+		return fmt.Errorf("%w: order %d sell price %d below band %d-%d in symbol %d",
+			ErrPriceBand, order.OrderID, order.Price, band.Low, band.High, order.Symbol)
+	}
+	if order.Side != 1 && order.Price > band.High {
+		return fmt.Errorf("%w: order %d buy price %d above band %d-%d in symbol %d",
+			ErrPriceBand, order.OrderID, order.Price, band.Low, band.High, order.Symbol)
+	}
+	return nil
+}
+
+// Band returns the band in force for symbol at now.
+func (b *Bands) Band(symbol uint32, now time.Time) (Band, bool) {
+	inst, ok := b.Ref.Store().ByID(symbol)
+	if !ok || inst.BandBps == 0 {
+		return Band{}, false
+	}
+	b.mu.Lock()
+	ref := b.reference(symbol, now)
+	b.mu.Unlock()
+	if ref == 0 {
+		ref = inst.RefPrice
+	}
+	if ref == 0 {
+		return Band{}, false
+	}
+	width := ref * uint64(inst.BandBps) / 10000
+	return Band{Symbol: symbol, Reference: ref, Low: ref - min(width, ref), High: ref + width}, true
+}
+
+// OnTrade moves the reference price with a fill from the status queue. A
+// busted fill stays in the average: the market traded there all the same.
+func (b *Bands) OnTrade(status queue.Order, at time.Time) {
+	if !status.IsTrade() || status.Price == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.trades == nil {
+		b.trades = make(map[uint32][]trade)
+		b.last = make(map[uint32]uint64)
+	}
+	b.trades[status.Symbol] = append(b.trades[status.Symbol], trade{at, status.Price})
+	b.last[status.Symbol] = status.Price
+}
+
+// reference is the average trade price in the window ending at now, after
+// dropping trades that fell out of it, else the last trade, else 0.
+func (b *Bands) reference(symbol uint32, now time.Time) uint64 {
+	window := b.Window
+	if window <= 0 {
+		window = DefaultBandWindow
+	}
+	trades := b.trades[symbol]
+	i := 0
+	for i < len(trades) && now.Sub(trades[i].at) > window {
+		i++
+	}
+	trades = trades[i:]
+	if len(trades) == 0 {
+		delete(b.trades, symbol)
+		return b.last[symbol]
+	}
+	b.trades[symbol] = trades
+	var sum uint64
+	for _, t := range trades {
+		sum += t.price
+	}
+	return sum / uint64(len(trades))
+}
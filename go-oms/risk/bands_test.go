@@ -0,0 +1,59 @@
+package risk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"oms/queue"
+	"oms/refdata"
+)
+
+func TestBands(t *testing.T) {
+	store, err := refdata.New([]refdata.Instrument{
+		{ID: 1, Symbol: "AAPL", Active: true, RefPrice: 10000, BandBps: 500},
+		{ID: 2, Symbol: "MSFT", Active: true, BandBps: 500},
+		{ID: 3, Symbol: "IBM", Active: true, RefPrice: 10000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBands(refdata.NewLive(store), time.Minute)
+	now := time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC)
+	order := func(symbol uint32, side uint8, price uint64) queue.Order {
+		return queue.Order{OrderID: 1, Symbol: symbol, Side: side, Quantity: 1, Price: price}
+	}
+	for _, tc := range []struct {
+		order queue.Order
+		ok    bool
+	}{
+		{order(1, 0, 10500), true},
+		{order(1, 0, 10501), false},
+		{order(1, 0, 1), true}, // a passive buy is never through the band
+		{order(1, 1, 9499), false},
+		{order(1, 1, 20000), true},
+		{order(2, 0, 1e6), true}, // no reference price yet
+		{order(3, 0, 1e6), true}, // not banded
+	} {
+		err := b.Check(tc.order, now)
+		if tc.ok != (err == nil) || (err != nil && !errors.Is(err, ErrPriceBand)) {
+			t.Errorf("symbol %d side %d price %d: %v", tc.order.Symbol, tc.order.Side, tc.order.Price, err)
+		}
+	}
+
+	for _, price := range []uint64{11000, 11200} {
+		b.OnTrade(queue.Order{Symbol: 1, Quantity: 1, Price: price, Status: queue.StatusFilled}, now)
+	}
+	b.OnTrade(queue.Order{Symbol: 1, Quantity: 1, Price: 1, Status: queue.StatusRejected}, now)
+	if band, _ := b.Band(1, now); band != (Band{Symbol: 1, Reference: 11100, Low: 10545, High: 11655}) {
+		t.Errorf("band after trades %+v", band)
+	}
+	if band, _ := b.Band(1, now.Add(2*time.Minute)); band.Reference != 11200 {
+		t.Errorf("quiet window: reference %d, want the last trade", band.Reference)
+	}
+
+	g := &Guard{OrderQueue: queue.NewInMemory(16), Checker: NewChecker(Limits{}), Switch: NewKillSwitch(nil), Bands: b}
+	if err := g.Enqueue(order(1, 1, 100)); queue.ReasonOf(err) != queue.ReasonPriceBand {
+		t.Errorf("guard: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"oms/refdata"
+)
+
+// Config is a limits file: the defaults, per-client overrides and limits
+// for firms and sub-accounts, by refdata.AccountRef. Firms and
+// sub-accounts have no defaults.
+//
+//	{"defaults": {"max_msg_rate": 1000},
+//	 "clients": {"1001": {"max_position": 50000, "max_msg_rate": 5000}},
+//	 "accounts": {"firm:1": {"max_loss": 2000000}, "sub:1001.2": {"max_position": 10000}}}
+type Config struct {
+	Defaults Limits            `json:"defaults"`
+	Clients  map[uint32]Limits `json:"clients"`
+	Accounts map[string]Limits `json:"accounts"`
+}
+
+// Validate rejects limits that no check could use.
+func (l Limits) Validate() error {
+	if l.MaxPosition < 0 || l.MaxLoss < 0 || l.MaxMsgRate < 0 || l.PriceCollarBps < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+func (cfg Config) Validate() error {
+	if err := cfg.Defaults.Validate(); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	for id, limits := range cfg.Clients {
+		if err := limits.Validate(); err != nil {
+			return fmt.Errorf("client %d: %w", id, err)
+		}
+	}
+	_, err := cfg.accounts()
+	return err
+}
+
+// accounts parses the Accounts keys.
+func (cfg Config) accounts() (map[refdata.AccountRef]Limits, error) {
+	out := make(map[refdata.AccountRef]Limits, len(cfg.Accounts))
+	for name, limits := range cfg.Accounts {
+		ref, err := refdata.ParseAccountRef(name)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Level == refdata.LevelClient {
+			return nil, fmt.Errorf("account %s: client limits go under clients", name)
+		}
+		if err := limits.Validate(); err != nil {
+			return nil, fmt.Errorf("account %s: %w", name, err)
+		}
+		out[ref] = limits
+	}
+	return out, nil
+}
+
+// LoadConfig reads and validates a limits file.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Apply swaps in a limits file in one step, so no order is checked against
+// a mix of old and new limits. Clients the file names get its limits;
+// clients it does not name fall back to the new defaults, except those
+// whose limits an operator set with SetLimits, which the file only
+// overrides by naming them. Firm and sub-account limits are replaced the
+// same way. Positions, P&L and rate windows carry over. cfg must be valid.
+func (c *Checker) Apply(cfg Config) {
+	configured := make(map[uint32]Limits, len(cfg.Clients))
+	for id, limits := range cfg.Clients {
+		configured[id] = limits
+	}
+	accounts, _ := cfg.accounts()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaults, c.configured, c.configuredAccounts = cfg.Defaults, configured, accounts
+	for ref := range accounts {
+		delete(c.accountOverrides, ref)
+	}
+	for id, cs := range c.clients {
+		if limits, ok := configured[id]; ok {
+			cs.limits, cs.source = limits, fromConfig
+		} else if cs.source != fromAdmin {
+			cs.limits, cs.source = c.defaults, fromDefaults
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"oms/dlq"
+	"oms/queue"
+)
+
+// Guard wraps an order queue with the risk checks and kill switch. Control
+// messages other than quote hits pass through unchecked so mass cancels are
+// never blocked.
+// Short sales also need Locate's approval, see locate.go, and when Bands
+// is set orders must be priced within their symbol's band. Refused orders
+// are parked in DeadLetter when it is set.
+type Guard struct {
+	queue.OrderQueue
+	Checker    *Checker
+	Switch     *KillSwitch
+	Locate     Locator
+	Bands      *Bands
+	DeadLetter *dlq.Store
+}
+
+var _ queue.OrderQueue = (*Guard)(nil)
+
+func (g *Guard) Enqueue(order queue.Order) error {
+	if order.Trades() {
+		if b, ok := g.Switch.Engaged(order.ClientID); ok {
+			return g.park(order, fmt.Errorf("%w: %s", ErrKilled, b.Reason))
+		}
+		if err := g.Checker.CheckOrder(order, time.Now()); err != nil {
+			g.trip(err)
+			return g.park(order, err)
+		}
+		if g.Bands != nil {
+			if err := g.Bands.Check(order, time.Now()); err != nil {
+				return g.park(order, err)
+			}
+		}
+		if err := g.locate(order); err != nil {
+			return g.park(order, err)
+		}
+	}
+	return g.OrderQueue.Enqueue(order)
+}
+
+// OnStatus feeds a status record from the engine into the post-trade checks
+// and the price bands. It returns the breach, if any, after engaging the
+// kill switch.
+func (g *Guard) OnStatus(status queue.Order) error {
+	if g.Bands != nil {
+		g.Bands.OnTrade(status, time.Now())
+	}
+	err := g.Checker.ApplyFill(status)
+	if err != nil {
+		g.trip(err)
+	}
+	return err
+}
+
+// park records a refused order in the dead-letter ring and returns the
+// refusal; a failure to park is joined to it.
+func (g *Guard) park(order queue.Order, err error) error {
+	if g.DeadLetter == nil {
+		return err
+	}
+	if perr := g.DeadLetter.Park(order, dlq.ReasonRisk, 1); perr != nil {
+		return errors.Join(err, perr)
+	}
+	return err
+}
+
+func (g *Guard) trip(err error) {
+	var breach *BreachError
+	if !errors.As(err, &breach) {
+		return
+	}
+	// Trip only fails if the mass cancel could not be sent; the client is
+	// fenced off regardless and the operator sees it in Breaches.
+	_ = g.Switch.Trip(Breach{ClientID: breach.ClientID, Reason: breach.Reason, At: time.Now()})
+}
@@ -0,0 +1,104 @@
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+// ErrKilled is returned for orders of a client whose kill switch is engaged.
+var ErrKilled = queue.NewReject(queue.ReasonKilled, "client kill switch engaged")
+
+// Breach records why and when a client's kill switch was engaged.
+type Breach struct {
+	ClientID uint32
+	Reason   string
+	At       time.Time
+}
+
+// KillSwitch fences clients off after a hard limit breach. Engaging it sends
+// a mass cancel once; only an explicit Reset lets the client trade again.
+type KillSwitch struct {
+	mu      sync.RWMutex
+	engaged map[uint32]Breach
+	cancel  func(clientID uint32) error
+}
+
+// NewKillSwitch returns a KillSwitch that calls cancel to pull a client's
+// open orders when it engages. With a nil cancel it only fences the client
+// off from new orders.
+func NewKillSwitch(cancel func(clientID uint32) error) *KillSwitch {
+	return &KillSwitch{
+		engaged: make(map[uint32]Breach),
+		cancel:  cancel,
+	}
+}
+
+// Trip engages the switch for b.ClientID. Tripping an engaged client is a
+// no-op, so a burst of breaching orders sends a single mass cancel.
+func (k *KillSwitch) Trip(b Breach) error {
+	k.mu.Lock()
+	if _, ok := k.engaged[b.ClientID]; ok {
+		k.mu.Unlock()
+		return nil
+	}
+	k.engaged[b.ClientID] = b
+	k.mu.Unlock()
+
+	if k.cancel == nil {
+		return nil
+	}
+	if err := k.cancel(b.ClientID); err != nil {
+		return fmt.Errorf("mass cancel for client %d: %w", b.ClientID, err)
+	}
+	return nil
+}
+
+// Engaged reports whether a client is fenced off, and why.
+func (k *KillSwitch) Engaged(clientID uint32) (Breach, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	b, ok := k.engaged[clientID]
+	return b, ok
+}
+
+// Breaches lists every engaged client.
+func (k *KillSwitch) Breaches() []Breach {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	breaches := make([]Breach, 0, len(k.engaged))
+	for _, b := range k.engaged {
+		breaches = append(breaches, b)
+	}
+	return breaches
+}
+
+// Reset is the operator action that re-enables a client. It reports whether
+// the client was engaged.
+func (k *KillSwitch) Reset(clientID uint32) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, ok := k.engaged[clientID]
+	delete(k.engaged, clientID)
+	return ok
+}
+
+// CancelVia returns a KillSwitch cancel func that enqueues a CancelAll on q,
+// waiting out backpressure for up to a second: a mass cancel must not be
+// dropped just because the ring is busy.
+func CancelVia(q queue.OrderQueue, nextID func() uint64) func(uint32) error {
+	return func(clientID uint32) error {
+		msg := queue.CancelAll(nextID(), clientID, uint64(time.Now().UnixNano()))
+		deadline := time.Now().Add(time.Second)
+		for {
+			err := q.Enqueue(msg)
+			if !errors.Is(err, queue.ErrQueueFull) || time.Now().After(deadline) {
+				return err
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package risk
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestKillSwitch(t *testing.T) {
+	ring := queue.NewInMemory(16)
+	var id uint64
+	k := NewKillSwitch(CancelVia(ring, func() uint64 { id++; return id }))
+
+	for range 3 { // a burst of breaches
+		if err := k.Trip(Breach{ClientID: 7, Reason: "max loss", At: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msg, _ := ring.Dequeue(); msg == nil || msg.MsgType != queue.MsgCancelAll || msg.ClientID != 7 {
+		t.Fatalf("ring got %+v, want client 7's mass cancel", msg)
+	}
+	if msg, _ := ring.Dequeue(); msg != nil {
+		t.Fatalf("second mass cancel %+v", msg)
+	}
+	if b, ok := k.Engaged(7); !ok || b.Reason != "max loss" {
+		t.Fatalf("engaged %+v %v", b, ok)
+	}
+	if _, ok := k.Engaged(8); ok {
+		t.Fatal("client 8 fenced off with client 7")
+	}
+	if got := k.Breaches(); len(got) != 1 || got[0].ClientID != 7 {
+		t.Fatalf("breaches %+v", got)
+	}
+
+	if !k.Reset(7) {
+		t.Fatal("reset of an engaged client reported false")
+	}
+	if _, ok := k.Engaged(7); ok {
+		t.Fatal("client 7 still fenced off after the reset")
+	}
+	if k.Reset(7) {
+		t.Error("second reset reported true")
+	}
+	// tripped again after the reset, it cancels again
+	k.Trip(Breach{ClientID: 7, Reason: "max loss", At: time.Now()})
+	if msg, _ := ring.Dequeue(); msg == nil || msg.MsgType != queue.MsgCancelAll {
+		t.Fatalf("ring got %+v after the second trip, want a mass cancel", msg)
+	}
+}
+
+func TestKillSwitchCancelFails(t *testing.T) {
+	k := NewKillSwitch(func(uint32) error { return errors.New("ring closed") })
+	if err := k.Trip(Breach{ClientID: 7}); err == nil {
+		t.Fatal("failed mass cancel not reported")
+	}
+	if _, ok := k.Engaged(7); !ok {
+		t.Fatal("client not fenced off after its mass cancel failed")
+	}
+}
+
+func TestGuardKillSwitch(t *testing.T) {
+	ring := queue.NewInMemory(16)
+	checker := NewChecker(Limits{})
+	checker.SetLimits(7, Limits{MaxMsgRate: 1})
+	g := &Guard{OrderQueue: ring, Checker: checker, Switch: NewKillSwitch(nil)}
+	order := queue.Order{OrderID: 1, ClientID: 7, Symbol: 1, Quantity: 1, Price: 100}
+
+	if err := g.Enqueue(order); err != nil {
+		t.Fatal(err)
+	}
+	// the second order in the second breaches the rate and trips the switch
+	order.OrderID = 2
+	var breach *BreachError
+	if err := g.Enqueue(order); !errors.As(err, &breach) || breach.ClientID != 7 {
+		t.Fatalf("got %v, want client 7's breach", err)
+	}
+	if b, ok := g.Switch.Engaged(7); !ok || b.Reason != breach.Reason {
+		t.Fatalf("engaged %+v %v, want the breach", b, ok)
+	}
+
+	// fenced off: new orders and quote hits are refused, cancels go through
+	order.OrderID = 3
+	if err := g.Enqueue(order); !errors.Is(err, ErrKilled) {
+		t.Fatalf("new order: got %v, want ErrKilled", err)
+	}
+	if err := g.Enqueue(queue.Order{OrderID: 1, ClientID: 7, MsgType: queue.MsgQuoteHit, Quantity: 1, Price: 100}); !errors.Is(err, ErrKilled) {
+		t.Fatalf("quote hit: got %v, want ErrKilled", err)
+	}
+	for _, msg := range []queue.Order{queue.Cancel(1, 7, 0), queue.CancelAll(4, 7, 0)} {
+		if err := g.Enqueue(msg); err != nil {
+			t.Fatalf("%d while fenced off: %v", msg.MsgType, err)
+		}
+	}
+	if d := ring.Depth(); d != 3 {
+		t.Fatalf("ring depth %d, want the first order and both cancels", d)
+	}
+	if _, ok := g.Switch.Engaged(8); ok {
+		t.Fatal("client 8 fenced off with client 7")
+	}
+}
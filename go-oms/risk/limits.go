@@ -0,0 +1,346 @@
+// Package risk holds per-client pre- and post-trade limits and the kill
+// switch that fences a client off once it breaches one of them.
+package risk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"oms/book"
+	"oms/queue"
+	"oms/refdata"
+)
+
+// Limits are per-client hard limits. A zero field disables that limit.
+type Limits struct {
+	MaxPosition int64 `json:"max_position"` // absolute net position per symbol, in shares
+	MaxLoss     int64 `json:"max_loss"`     // mark-to-market loss across symbols, in price units
+	MaxMsgRate  int   `json:"max_msg_rate"` // messages per second
+	// PriceCollarBps rejects orders priced more than this many basis points
+	// through the opposite side's best price. Needs a book (SetBook).
+	PriceCollarBps int64 `json:"price_collar_bps"`
+}
+
+// BreachError reports a hard limit breach. Guard trips the kill switch on it.
+type BreachError struct {
+	ClientID uint32
+	Reason   string
+}
+
+func (e *BreachError) Error() string {
+	return fmt.Sprintf("client %d breached risk limit: %s", e.ClientID, e.Reason)
+}
+
+// RejectReason reports breaches as queue.ReasonRisk, see queue.ReasonOf.
+func (e *BreachError) RejectReason() uint8 { return queue.ReasonRisk }
+
+// ErrLimit wraps the pre-trade rejections that are not a breach.
+var ErrLimit = queue.NewReject(queue.ReasonRisk, "risk limit")
+
+// Where a client's limits came from, so a reload knows which to replace.
+const (
+	fromDefaults uint8 = iota
+	fromConfig         // the limits file, see Apply
+	fromAdmin          // SetLimits
+)
+
+type clientState struct {
+	limits      Limits
+	source      uint8
+	positions   map[uint32]int64  // symbol -> net shares
+	marks       map[uint32]uint64 // symbol -> value of one lot at the last fill price
+	cash        int64
+	fees        int64
+	maker       int64 // shares filled adding liquidity
+	taker       int64 // shares filled removing liquidity
+	windowStart time.Time
+	windowCount int
+	subs        map[uint8]*clientState // by Order.SubAccount; see accounts.go
+}
+
+// Checker tracks client positions and message rates against their Limits.
+// It is safe for concurrent use.
+type Checker struct {
+	mu         sync.Mutex
+	defaults   Limits
+	configured map[uint32]Limits // per-client limits from the last Apply
+	clients    map[uint32]*clientState
+	book       *book.Book
+	ref        *refdata.Live
+
+	accounts           *refdata.Accounts
+	configuredAccounts map[refdata.AccountRef]Limits // firm and sub-account limits from the last Apply
+	accountOverrides   map[refdata.AccountRef]Limits // from SetAccountLimits
+}
+
+// NewChecker returns a Checker applying defaults to clients without their
+// own limits.
+func NewChecker(defaults Limits) *Checker {
+	return &Checker{
+		defaults: defaults,
+		clients:  make(map[uint32]*clientState),
+	}
+}
+
+func (c *Checker) client(clientID uint32) *clientState {
+	cs, ok := c.clients[clientID]
+	if !ok {
+		cs = &clientState{
+			limits:    c.defaults,
+			positions: make(map[uint32]int64),
+			marks:     make(map[uint32]uint64),
+		}
+		if limits, ok := c.configured[clientID]; ok {
+			cs.limits, cs.source = limits, fromConfig
+		}
+		c.clients[clientID] = cs
+	}
+	return cs
+}
+
+// SetBook gives the price collar live top-of-book prices. Without a book,
+// or for a symbol the engine has no book for, the collar is not applied.
+func (c *Checker) SetBook(b *book.Book) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.book = b
+}
+
+// SetRefdata gives P&L the contract multipliers of futures and options.
+// Without it every fill is valued as Quantity × Price.
+func (c *Checker) SetRefdata(ref *refdata.Live) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ref = ref
+}
+
+// multiplier is the contract multiplier of symbol, 1 if not known.
+func (c *Checker) multiplier(symbol uint32) int64 {
+	if c.ref == nil {
+		return 1
+	}
+	inst, ok := c.ref.Store().ByID(symbol)
+	if !ok {
+		return 1
+	}
+	return inst.ContractMultiplier()
+}
+
+// SetLimits replaces the limits of one client.
+func (c *Checker) SetLimits(clientID uint32, limits Limits) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs := c.client(clientID)
+	cs.limits, cs.source = limits, fromAdmin
+}
+
+// Limits returns the limits in force for a client.
+func (c *Checker) Limits(clientID uint32) Limits {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cs, ok := c.clients[clientID]; ok {
+		return cs.limits
+	}
+	if limits, ok := c.configured[clientID]; ok {
+		return limits
+	}
+	return c.defaults
+}
+
+// ClearLimits drops a client's own limits so the limits file, or failing
+// that the defaults, apply again.
+func (c *Checker) ClearLimits(clientID uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cs, ok := c.clients[clientID]; ok {
+		cs.limits, cs.source = c.defaults, fromDefaults
+		if limits, ok := c.configured[clientID]; ok {
+			cs.limits, cs.source = limits, fromConfig
+		}
+	}
+}
+
+// Exposure is a snapshot of one client's positions and marked-to-market P&L.
+// PnL is net of Fees; MakerQty and TakerQty split the filled shares by
+// liquidity indicator, for fee tier and billing checks. Account names the
+// account at whatever level the snapshot is of, see AccountExposures;
+// ClientID is 0 for a firm.
+type Exposure struct {
+	ClientID  uint32           `json:"client_id"`
+	Account   string           `json:"account"`
+	Positions map[uint32]int64 `json:"positions"`
+	PnL       int64            `json:"pnl"`
+	Fees      int64            `json:"fees"`
+	MakerQty  int64            `json:"maker_qty"`
+	TakerQty  int64            `json:"taker_qty"`
+}
+
+// Exposures returns a snapshot for every client that has traded.
+func (c *Checker) Exposures() []Exposure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Exposure, 0, len(c.clients))
+	for id, cs := range c.clients {
+		out = append(out, cs.exposure(refdata.ClientRef(id)))
+	}
+	return out
+}
+
+// Position returns a client's net position in a symbol, in shares.
+func (c *Checker) Position(clientID, symbol uint32) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cs, ok := c.clients[clientID]; ok {
+		return cs.positions[symbol]
+	}
+	return 0
+}
+
+// CheckOrder runs the pre-trade checks for a new order. Exceeding the
+// message rate is a hard breach (*BreachError); an order that would take the
+// position past its limit or is priced outside the collar is only rejected.
+func (c *Checker) CheckOrder(order queue.Order, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs := c.client(order.ClientID)
+
+	if cs.limits.MaxMsgRate > 0 {
+		if now.Sub(cs.windowStart) >= time.Second {
+			cs.windowStart = now
+			cs.windowCount = 0
+		}
+		cs.windowCount++
+		if cs.windowCount > cs.limits.MaxMsgRate {
+			return &BreachError{ClientID: order.ClientID,
+				Reason: fmt.Sprintf("message rate above %d/s", cs.limits.MaxMsgRate)}
+		}
+	}
+
+	if cs.limits.MaxPosition > 0 {
+		pos := cs.positions[order.Symbol] + signedQty(order)
+		if abs(pos) > cs.limits.MaxPosition {
+			return fmt.Errorf("%w: order %d would take position in symbol %d to %d (limit %d)",
+				ErrLimit, order.OrderID, order.Symbol, pos, cs.limits.MaxPosition)
+		}
+	}
+
+	if err := c.checkAccountOrder(order); err != nil {
+		return err
+	}
+
+	if bps := cs.limits.PriceCollarBps; bps > 0 && c.book != nil {
+		return c.checkCollar(order, bps)
+	}
+	return nil
+}
+
+// checkCollar bounds a buy by the best ask and a sell by the best bid.
+func (c *Checker) checkCollar(order queue.Order, bps int64) error {
+	if order.Side == 1 {
+		bid, ok := c.book.BestBid(order.Symbol)
+		if !ok {
+			return nil
+		}
+		floor := bid.Price * uint64(10000-min(bps, 10000)) / 10000
+		if order.Price < floor {
+			return fmt.Errorf("%w: order %d sell price %d below collar %d (best bid %d)",
+				ErrLimit, order.OrderID, order.Price, floor, bid.Price)
+		}
+		return nil
+	}
+	ask, ok := c.book.BestAsk(order.Symbol)
+	if !ok {
+		return nil
+	}
+	ceiling := ask.Price * uint64(10000+bps) / 10000
+	if order.Price > ceiling {
+		return fmt.Errorf("%w: order %d buy price %d above collar %d (best ask %d)",
+			ErrLimit, order.OrderID, order.Price, ceiling, ask.Price)
+	}
+	return nil
+}
+
+// ApplyFill updates positions and P&L from a filled status record and
+// returns a *BreachError if the client is now past a position or loss limit.
+// A StatusBusted record reverses the fill it carries and a StatusCorrected
+// record is applied as a new fill, so a correction nets out to the change.
+func (c *Checker) ApplyFill(status queue.Order) error {
+	if status.IsControl() {
+		return nil
+	}
+	var sign int64
+	switch status.Status {
+	case queue.StatusFilled, queue.StatusPartial, queue.StatusCorrected:
+		sign = 1
+	case queue.StatusBusted:
+		sign = -1
+	default:
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cs := c.client(status.ClientID)
+	mult := c.multiplier(status.Symbol)
+	cs.apply(status, sign, mult)
+	cs.sub(status.SubAccount).apply(status, sign, mult)
+	if sign < 0 {
+		// an operator bust is not the client's breach, whatever it leaves
+		return nil
+	}
+
+	if lim := cs.limits.MaxPosition; lim > 0 && abs(cs.positions[status.Symbol]) > lim {
+		return &BreachError{ClientID: status.ClientID,
+			Reason: fmt.Sprintf("position %d in symbol %d above %d", cs.positions[status.Symbol], status.Symbol, lim)}
+	}
+	if lim := cs.limits.MaxLoss; lim > 0 {
+		if loss := -cs.pnl(); loss > lim {
+			return &BreachError{ClientID: status.ClientID,
+				Reason: fmt.Sprintf("loss %d above %d", loss, lim)}
+		}
+	}
+	return c.checkAccountFill(cs, status)
+}
+
+// apply adds a fill to the client's books, or with sign -1 takes it out
+// again; mult is the symbol's contract multiplier. The mark stays at the
+// last price traded: a bust does not un-trade the market.
+func (cs *clientState) apply(status queue.Order, sign, mult int64) {
+	qty := sign * signedQty(status)
+	fee := sign * int64(status.Fee)
+	cs.positions[status.Symbol] += qty
+	cs.cash -= qty*int64(status.Price)*mult + fee
+	cs.fees += fee
+	if sign > 0 {
+		cs.marks[status.Symbol] = status.Price * uint64(mult)
+	}
+	switch status.Liquidity {
+	case queue.LiquidityMaker:
+		cs.maker += sign * int64(status.Quantity)
+	case queue.LiquidityTaker:
+		cs.taker += sign * int64(status.Quantity)
+	}
+}
+
+// pnl marks every open position to its last fill price.
+func (cs *clientState) pnl() int64 {
+	pnl := cs.cash
+	for symbol, pos := range cs.positions {
+		pnl += pos * int64(cs.marks[symbol])
+	}
+	return pnl
+}
+
+func signedQty(order queue.Order) int64 {
+	if order.Side == 1 {
+		return -int64(order.Quantity)
+	}
+	return int64(order.Quantity)
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,37 @@
+package risk
+
+import (
+	"testing"
+
+	"oms/queue"
+	"oms/refdata"
+)
+
+func TestContractMultiplier(t *testing.T) {
+	store, err := refdata.New([]refdata.Instrument{
+		{ID: 1, Symbol: "AAPL", Active: true},
+		{ID: 2, Symbol: "ESZ6", Active: true, Type: queue.InstrumentFuture, Maturity: "2026-12-18", Multiplier: 50},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewChecker(Limits{})
+	c.SetRefdata(refdata.NewLive(store))
+	c.SetLimits(7, Limits{MaxLoss: 1000})
+	for _, fill := range []queue.Order{
+		{Symbol: 1, Quantity: 10, Price: 100},
+		{Symbol: 2, Quantity: 2, Price: 5000},
+		{Symbol: 2, Quantity: 1, Price: 4995, Side: 1}, // 2 contracts × 5 points × 50 down
+	} {
+		fill.ClientID, fill.Status = 7, queue.StatusFilled
+		if err := c.ApplyFill(fill); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pnl := c.Exposures()[0].PnL; pnl != -500 {
+		t.Errorf("P&L %d, want -500", pnl)
+	}
+	if err := c.ApplyFill(queue.Order{ClientID: 7, Symbol: 2, Quantity: 1, Price: 4975, Side: 1, Status: queue.StatusFilled}); err == nil {
+		t.Error("loss of 1500 on the future not a breach")
+	}
+}
@@ -0,0 +1,164 @@
+package risk
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"oms/queue"
+)
+
+// Short sales: a sell marked queue.FlagShort must have a locate, shares the
+// broker has found to borrow, before it reaches the engine. Guard asks its
+// Locator after the limit checks; a sell marked queue.FlagShortExempt, or
+// not marked at all, is not asked about.
+
+// ErrNoLocate refuses a short sale the Locator would not approve.
+var ErrNoLocate = queue.NewReject(queue.ReasonNoLocate, "no locate")
+
+// ErrLocateUnavailable refuses a short sale the Locator could not be
+// asked about: none is set, or it failed. Unlike ErrNoLocate, the order
+// may succeed if sent again.
+var ErrLocateUnavailable = queue.NewReject(queue.ReasonLocateUnavailable, "locate unavailable")
+
+// Locator approves short sales. Locate returns nil to approve the order,
+// an error wrapping ErrNoLocate to refuse it, and any other error when it
+// cannot tell.
+type Locator interface {
+	Locate(order queue.Order) error
+}
+
+// LocateFunc adapts a function to Locator, e.g. one calling a stock loan
+// desk.
+type LocateFunc func(order queue.Order) error
+
+func (f LocateFunc) Locate(order queue.Order) error { return f(order) }
+
+// EasyToBorrow in a Locates inventory approves every short sale in the
+// symbol.
+const EasyToBorrow int64 = -1
+
+// Locates is an in-memory Locator over a day's borrow inventory: shares
+// available per symbol, or EasyToBorrow. Each approved short sale uses up
+// its quantity, whatever becomes of the order; symbols not listed have
+// nothing to borrow. It is safe for concurrent use.
+type Locates struct {
+	mu        sync.Mutex
+	available map[uint32]int64
+}
+
+var _ Locator = (*Locates)(nil)
+
+// NewLocates starts an inventory of shares available per symbol.
+func NewLocates(inventory map[uint32]int64) *Locates {
+	return &Locates{available: maps.Clone(inventory)}
+}
+
+func (l *Locates) Locate(order queue.Order) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	avail, ok := l.available[order.Symbol]
+	switch {
+	case avail == EasyToBorrow:
+		return nil
+	case !ok:
+		return fmt.Errorf("%w: order %d: symbol %d not in the borrow inventory", ErrNoLocate, order.OrderID, order.Symbol)
+	case avail < int64(order.Quantity):
+		return fmt.Errorf("%w: order %d sells %d short in symbol %d, %d left to borrow",
+			ErrNoLocate, order.OrderID, order.Quantity, order.Symbol, avail)
+	}
+	l.available[order.Symbol] = avail - int64(order.Quantity)
+	return nil
+}
+
+// Available returns the shares left to borrow per symbol.
+func (l *Locates) Available() map[uint32]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return maps.Clone(l.available)
+}
+
+// Replace swaps in a new inventory, such as the stock loan desk's next
+// file; what was used of the old one is forgotten.
+func (l *Locates) Replace(inventory map[uint32]int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.available = maps.Clone(inventory)
+}
+
+// LoadLocates reads a CSV borrow inventory with the header symbol,shares,
+// one symbol per line; shares "etb" is EasyToBorrow:
+//
+//	symbol,shares
+//	1,5000
+//	2,etb
+func LoadLocates(path string) (map[uint32]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open locates: %w", err)
+	}
+	defer f.Close()
+	inventory, err := ReadLocatesCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return inventory, nil
+}
+
+// ReadLocatesCSV parses an inventory in the LoadLocates format.
+func ReadLocatesCSV(r io.Reader) (map[uint32]int64, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	inventory := make(map[uint32]int64)
+	if len(records) == 0 {
+		return inventory, nil
+	}
+	for i, rec := range records[1:] {
+		symbol, err := strconv.ParseUint(strings.TrimSpace(rec[0]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		if _, dup := inventory[uint32(symbol)]; dup {
+			return nil, fmt.Errorf("line %d: duplicate symbol %d", i+2, symbol)
+		}
+		shares := strings.TrimSpace(rec[1])
+		if strings.EqualFold(shares, "etb") {
+			inventory[uint32(symbol)] = EasyToBorrow
+			continue
+		}
+		n, err := strconv.ParseInt(shares, 10, 64)
+		if err == nil && n < 0 {
+			err = errors.New("shares must not be negative")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		inventory[uint32(symbol)] = n
+	}
+	return inventory, nil
+}
+
+// locate is Guard's check of a short sale.
+func (g *Guard) locate(order queue.Order) error {
+	if !order.HasFlag(queue.FlagShort) {
+		return nil
+	}
+	if g.Locate == nil {
+		return fmt.Errorf("%w: order %d is marked short and no locate source is set", ErrLocateUnavailable, order.OrderID)
+	}
+	err := g.Locate.Locate(order)
+	if err != nil && !errors.Is(err, ErrNoLocate) {
+		return fmt.Errorf("%w: order %d: %w", ErrLocateUnavailable, order.OrderID, err)
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package risk
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"oms/queue"
+)
+
+func TestLocate(t *testing.T) {
+	inventory, err := ReadLocatesCSV(strings.NewReader("symbol,shares\n1,100\n2,ETB\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := queue.NewInMemory(16)
+	g := &Guard{OrderQueue: ring, Checker: NewChecker(Limits{}), Switch: NewKillSwitch(nil)}
+	sell := func(id uint64, symbol, qty uint32, flags uint8) error {
+		return g.Enqueue(queue.Order{OrderID: id, ClientID: 7, Symbol: symbol, Side: 1, Quantity: qty, Price: 10, Flags: flags})
+	}
+
+	if err := sell(1, 1, 10, queue.FlagShort); !errors.Is(err, ErrLocateUnavailable) || queue.ReasonOf(err) != queue.ReasonLocateUnavailable {
+		t.Fatalf("no locator: %v", err)
+	}
+	g.Locate = NewLocates(inventory)
+	for _, tc := range []struct {
+		symbol, qty uint32
+		flags       uint8
+		want        error
+	}{
+		{1, 60, queue.FlagShort, nil},
+		{1, 60, queue.FlagShort, ErrNoLocate}, // 40 left
+		{1, 60, 0, nil},                       // a long sale needs no locate
+		{1, 60, queue.FlagShortExempt, nil},
+		{1, 40, queue.FlagShort, nil},
+		{2, 1e6, queue.FlagShort, nil},
+		{3, 1, queue.FlagShort, ErrNoLocate},
+	} {
+		if err := sell(2, tc.symbol, tc.qty, tc.flags); !errors.Is(err, tc.want) || (err != nil) != (tc.want != nil) {
+			t.Errorf("sell %d of %d (%s): %v, want %v", tc.qty, tc.symbol, queue.FlagString(tc.flags), err, tc.want)
+		}
+	}
+	if got := g.Locate.(*Locates).Available()[1]; got != 0 {
+		t.Errorf("symbol 1 has %d left, want 0", got)
+	}
+
+	g.Locate = LocateFunc(func(queue.Order) error { return errors.New("desk down") })
+	if err := sell(3, 1, 1, queue.FlagShort); queue.ReasonOf(err) != queue.ReasonLocateUnavailable {
+		t.Errorf("failing locator: %v", err)
+	}
+
+	for _, bad := range []string{"symbol,shares\n1,-5\n", "symbol,shares\n1,5\n1,6\n", "symbol,shares\nx,5\n"} {
+		if _, err := ReadLocatesCSV(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"oms/book"
+	"oms/queue"
+)
+
+// Config is the JSON routing table. Destinations name queue files; each
+// engine's status ring is at queue.StatusPath of its queue.
+//
+//	{
+//	  "destinations": {"eng-a": "/dev/shm/oms_a", "eng-b": "/dev/shm/oms_b"},
+//	  "routes": [{"symbols": [1, 2, 3], "to": ["eng-a", "eng-b"], "strategy": "best_price"}],
+//	  "default": {"to": ["eng-b", "eng-a"]}
+//	}
+//
+// A destination's top of book is read from book.PathFor of its queue when
+// the engine publishes one.
+type Config struct {
+	Destinations map[string]string `json:"destinations"`
+	Routes       []RouteConfig     `json:"routes"`
+	Default      RouteConfig       `json:"default"` // Symbols is ignored
+	MaxErrors    int               `json:"max_errors"`
+}
+
+// RouteConfig sends Symbols to the destinations in To, in order of
+// preference, picking the first to try with Strategy (see ParseStrategy).
+type RouteConfig struct {
+	Symbols  []uint32 `json:"symbols"`
+	To       []string `json:"to"`
+	Strategy string   `json:"strategy"`
+}
+
+// LoadConfig reads a Config from a JSON file.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read routing config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Open opens every destination's order and status rings and builds the
+// routing table.
+func Open(cfg Config) (*Router, error) {
+	var dests []Destination
+	closeAll := func() {
+		for _, d := range dests {
+			d.Orders.Close()
+			d.Status.Close()
+			if b, ok := d.Book.(*book.Book); ok {
+				b.Close()
+			}
+		}
+	}
+	for name, path := range cfg.Destinations {
+		orders, err := queue.OpenQueue(path)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("destination %s: %w", name, err)
+		}
+		status, err := queue.OpenQueue(queue.StatusPath(path))
+		if err != nil {
+			orders.Close()
+			closeAll()
+			return nil, fmt.Errorf("destination %s status: %w", name, err)
+		}
+		d := Destination{Name: name, Orders: orders, Status: status}
+		b, err := book.Open(book.PathFor(path))
+		switch {
+		case err == nil:
+			d.Book = b
+		case !errors.Is(err, fs.ErrNotExist):
+			orders.Close()
+			status.Close()
+			closeAll()
+			return nil, fmt.Errorf("destination %s book: %w", name, err)
+		}
+		dests = append(dests, d)
+	}
+	r, err := New(dests...)
+	if err == nil {
+		err = r.configure(cfg)
+	}
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Router) configure(cfg Config) error {
+	r.MaxErrors = cfg.MaxErrors
+	for i, rc := range cfg.Routes {
+		strategy, err := ParseStrategy(rc.Strategy)
+		if err == nil {
+			err = r.Route(rc.Symbols, strategy, rc.To...)
+		}
+		if err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+	if len(cfg.Default.To) > 0 {
+		strategy, err := ParseStrategy(cfg.Default.Strategy)
+		if err == nil {
+			err = r.SetDefault(strategy, cfg.Default.To...)
+		}
+		if err != nil {
+			return fmt.Errorf("default route: %w", err)
+		}
+	}
+	return nil
+}
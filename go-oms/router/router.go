@@ -0,0 +1,384 @@
+// Package router lets one OMS front several matching engines: it maps
+// symbols to destination queues (Rust engine instances or external venue
+// adapters) and fails a symbol over to its next destination when the
+// current one stops accepting orders.
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"oms/queue"
+)
+
+var (
+	// ErrNoRoute is returned for a symbol with no route and no default.
+	ErrNoRoute = errors.New("no route for symbol")
+	// ErrAllDown is returned when every destination of a route is down.
+	ErrAllDown = errors.New("all destinations down")
+	// ErrUnknownOrder is returned for a cancel of an order the router did
+	// not place.
+	ErrUnknownOrder = errors.New("order not placed by this router")
+	// ErrProducerOnly is returned by Router.Dequeue; statuses come from
+	// Statuses.
+	ErrProducerOnly = errors.New("router is producer side only")
+)
+
+// DefaultMaxErrors is how many consecutive enqueue errors take a
+// destination down.
+const DefaultMaxErrors = 3
+
+// Destination is one engine or venue adapter. Status is its status ring and
+// may be nil for adapters that report elsewhere; Book is its top of book
+// for price-based strategies and may be nil too.
+type Destination struct {
+	Name   string
+	Orders queue.OrderQueue
+	Status queue.OrderQueue
+	Book   TopOfBook
+}
+
+type dest struct {
+	Destination
+	down   bool
+	errors int
+}
+
+// Health is a destination's state as seen by the router.
+type Health struct {
+	Name     string `json:"name"`
+	Up       bool   `json:"up"`
+	Errors   int    `json:"errors"` // consecutive enqueue errors
+	Depth    uint64 `json:"depth"`
+	Capacity uint64 `json:"capacity"`
+}
+
+type route struct {
+	dests    []*dest
+	strategy Strategy
+	// scratch for Enqueue, reused under Router.mu so routing does not allocate
+	up     []*dest
+	venues []Venue
+}
+
+// Router routes orders by symbol. Each route lists destinations in order of
+// preference and a Strategy that picks which of those that are up a new
+// order tries first; it falls over to the rest in route order. An enqueue
+// error other than a full queue counts against the destination and the
+// order is tried on the next one; MaxErrors errors in a row take it down
+// until MarkUp. A full queue is returned as is: the engine is slow, not dead, and
+// moving the symbol would split its book across engines.
+//
+// Cancels follow the order to the destination that took it, mass cancels
+// for a symbol go to every destination on its route, and a global mass
+// cancel goes everywhere. It is safe for concurrent use.
+type Router struct {
+	MaxErrors int // 0 means DefaultMaxErrors
+
+	mu       sync.Mutex
+	dests    []*dest
+	byName   map[string]*dest
+	routes   map[uint32]*route
+	fallback *route
+	placed   map[uint64]*dest // OrderID -> destination, until a terminal status
+}
+
+var _ queue.OrderQueue = (*Router)(nil)
+
+// New returns a router over dests with no routes yet.
+func New(dests ...Destination) (*Router, error) {
+	r := &Router{
+		byName: make(map[string]*dest, len(dests)),
+		routes: make(map[uint32]*route),
+		placed: make(map[uint64]*dest),
+	}
+	for _, d := range dests {
+		if _, dup := r.byName[d.Name]; dup {
+			return nil, fmt.Errorf("duplicate destination %q", d.Name)
+		}
+		nd := &dest{Destination: d}
+		r.dests = append(r.dests, nd)
+		r.byName[d.Name] = nd
+	}
+	return r, nil
+}
+
+func (r *Router) lookup(names []string) ([]*dest, error) {
+	if len(names) == 0 {
+		return nil, errors.New("route needs at least one destination")
+	}
+	out := make([]*dest, len(names))
+	for i, name := range names {
+		d, ok := r.byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown destination %q", name)
+		}
+		out[i] = d
+	}
+	return out, nil
+}
+
+// Route sends symbols to the named destinations, in order of preference.
+// A nil strategy is Preference.
+func (r *Router) Route(symbols []uint32, strategy Strategy, names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, err := r.newRoute(strategy, names)
+	if err != nil {
+		return err
+	}
+	for _, s := range symbols {
+		r.routes[s] = rt
+	}
+	return nil
+}
+
+// SetDefault routes every symbol without a route of its own.
+func (r *Router) SetDefault(strategy Strategy, names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, err := r.newRoute(strategy, names)
+	if err != nil {
+		return err
+	}
+	r.fallback = rt
+	return nil
+}
+
+func (r *Router) newRoute(strategy Strategy, names []string) (*route, error) {
+	ds, err := r.lookup(names)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == nil {
+		strategy = Preference{}
+	}
+	return &route{dests: ds, strategy: strategy}, nil
+}
+
+// MarkDown takes a destination out of routing, e.g. from a health check.
+func (r *Router) MarkDown(name string) error {
+	return r.mark(name, true)
+}
+
+// MarkUp puts a destination back; symbols that failed over return to it.
+func (r *Router) MarkUp(name string) error {
+	return r.mark(name, false)
+}
+
+func (r *Router) mark(name string, down bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.byName[name]
+	if !ok {
+		return fmt.Errorf("unknown destination %q", name)
+	}
+	d.down, d.errors = down, 0
+	return nil
+}
+
+// Health returns every destination's state.
+func (r *Router) Health() []Health {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Health, len(r.dests))
+	for i, d := range r.dests {
+		out[i] = Health{
+			Name:     d.Name,
+			Up:       !d.down,
+			Errors:   d.errors,
+			Depth:    d.Orders.Depth(),
+			Capacity: d.Orders.Capacity(),
+		}
+	}
+	return out
+}
+
+func (r *Router) route(symbol uint32) *route {
+	if rt, ok := r.routes[symbol]; ok {
+		return rt
+	}
+	return r.fallback
+}
+
+func (r *Router) Enqueue(order queue.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch order.MsgType {
+	case queue.MsgCancel:
+		d, ok := r.placed[order.OrderID]
+		if !ok {
+			return fmt.Errorf("%w: %d", ErrUnknownOrder, order.OrderID)
+		}
+		return d.Orders.Enqueue(order)
+	case queue.MsgCancelAll:
+		return r.broadcast(r.dests, order)
+	case queue.MsgCancelAllSymbol:
+		if rt := r.route(order.Symbol); rt != nil {
+			return r.broadcast(rt.dests, order)
+		}
+		return nil
+	}
+
+	rt := r.route(order.Symbol)
+	if rt == nil {
+		return fmt.Errorf("%w: %d", ErrNoRoute, order.Symbol)
+	}
+	up, venues := rt.up[:0], rt.venues[:0]
+	for _, d := range rt.dests {
+		if !d.down {
+			up = append(up, d)
+			venues = append(venues, Venue{Name: d.Name, Book: d.Book})
+		}
+	}
+	rt.up, rt.venues = up, venues
+	if len(up) == 0 {
+		return fmt.Errorf("%w for symbol %d", ErrAllDown, order.Symbol)
+	}
+	if first := rt.strategy.Choose(order, venues); first > 0 && first < len(up) {
+		// move the chosen one to the front, keeping the rest in route order
+		chosen := up[first]
+		copy(up[1:first+1], up[:first])
+		up[0] = chosen
+	}
+	var errs []error
+	for _, d := range up {
+		err := d.Orders.Enqueue(order)
+		if err == nil {
+			d.errors = 0
+			r.placed[order.OrderID] = d
+			return nil
+		}
+		if errors.Is(err, queue.ErrQueueFull) {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", d.Name, err))
+		if d.errors++; d.errors >= r.maxErrors() {
+			d.down = true
+		}
+	}
+	return fmt.Errorf("%w for symbol %d: %w", ErrAllDown, order.Symbol, errors.Join(errs...))
+}
+
+// broadcast sends a mass cancel to every destination, down ones included:
+// a destination taken down may still hold live orders.
+func (r *Router) broadcast(ds []*dest, order queue.Order) error {
+	var errs []error
+	for _, d := range ds {
+		if err := d.Orders.Enqueue(order); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Router) maxErrors() int {
+	if r.MaxErrors > 0 {
+		return r.MaxErrors
+	}
+	return DefaultMaxErrors
+}
+
+func (r *Router) Dequeue() (*queue.Order, error) {
+	return nil, ErrProducerOnly
+}
+
+// Depth is the total depth across destinations.
+func (r *Router) Depth() uint64 {
+	var n uint64
+	for _, d := range r.dests {
+		n += d.Orders.Depth()
+	}
+	return n
+}
+
+// Capacity is the total capacity across destinations.
+func (r *Router) Capacity() uint64 {
+	var n uint64
+	for _, d := range r.dests {
+		n += d.Orders.Capacity()
+	}
+	return n
+}
+
+// Close closes every destination's queues, and its book if it has one.
+func (r *Router) Close() error {
+	var errs []error
+	for _, d := range r.dests {
+		errs = append(errs, d.Orders.Close())
+		if d.Status != nil {
+			errs = append(errs, d.Status.Close())
+		}
+		if c, ok := d.Book.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Statuses merges the destinations' status rings into one consumer-side
+// queue, taking from each in turn. Terminal statuses release the order's
+// placement, so cancels for it are no longer routed.
+func (r *Router) Statuses() queue.OrderQueue {
+	return &statuses{r: r}
+}
+
+type statuses struct {
+	r    *Router
+	next int
+}
+
+func (s *statuses) Dequeue() (*queue.Order, error) {
+	ds := s.r.dests
+	for range ds {
+		d := ds[s.next%len(ds)]
+		s.next++
+		if d.Status == nil {
+			continue
+		}
+		rec, err := d.Status.Dequeue()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.Name, err)
+		}
+		if rec == nil {
+			continue
+		}
+		if !rec.IsControl() && rec.Terminal() {
+			s.r.mu.Lock()
+			delete(s.r.placed, rec.OrderID)
+			s.r.mu.Unlock()
+		}
+		return rec, nil
+	}
+	return nil, nil
+}
+
+func (s *statuses) Enqueue(queue.Order) error {
+	return errors.New("router statuses are consumer side only")
+}
+
+func (s *statuses) Depth() uint64 {
+	var n uint64
+	for _, d := range s.r.dests {
+		if d.Status != nil {
+			n += d.Status.Depth()
+		}
+	}
+	return n
+}
+
+func (s *statuses) Capacity() uint64 {
+	var n uint64
+	for _, d := range s.r.dests {
+		if d.Status != nil {
+			n += d.Status.Capacity()
+		}
+	}
+	return n
+}
+
+// Close is a no-op; Router.Close closes the status rings.
+func (s *statuses) Close() error { return nil }
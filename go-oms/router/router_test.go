@@ -0,0 +1,116 @@
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"oms/book"
+	"oms/queue"
+)
+
+// broken fails every enqueue, like an engine whose ring went away.
+type broken struct{ *queue.MemQueue }
+
+func (broken) Enqueue(queue.Order) error { return errors.New("ring unmapped") }
+
+func TestRouteAndFailover(t *testing.T) {
+	a, b := queue.NewInMemory(16), queue.NewInMemory(16)
+	r, err := New(
+		Destination{Name: "a", Orders: broken{a}},
+		Destination{Name: "b", Orders: b},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.MaxErrors = 2
+	if err := r.Route([]uint32{1}, nil, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Enqueue(queue.Order{OrderID: 1, Symbol: 9}); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("unrouted symbol: %v", err)
+	}
+
+	for id := uint64(1); id <= 3; id++ {
+		if err := r.Enqueue(queue.Order{OrderID: id, Symbol: 1}); err != nil {
+			t.Fatalf("order %d: %v", id, err)
+		}
+	}
+	if b.Depth() != 3 {
+		t.Fatalf("backup depth %d, want 3", b.Depth())
+	}
+	if h := r.Health(); h[0].Up || !h[1].Up {
+		t.Fatalf("health after failover: %+v", h)
+	}
+
+	// cancels follow the order, mass cancels reach every destination
+	if err := r.Enqueue(queue.Order{OrderID: 2, MsgType: queue.MsgCancel}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Enqueue(queue.Order{OrderID: 99, MsgType: queue.MsgCancel}); !errors.Is(err, ErrUnknownOrder) {
+		t.Fatalf("cancel of unknown order: %v", err)
+	}
+	if b.Depth() != 4 {
+		t.Fatalf("cancel not routed to b: depth %d", b.Depth())
+	}
+}
+
+func TestStatusesReleasePlacement(t *testing.T) {
+	orders, status := queue.NewInMemory(16), queue.NewInMemory(16)
+	r, _ := New(Destination{Name: "a", Orders: orders, Status: status})
+	r.SetDefault(nil, "a")
+	if err := r.Enqueue(queue.Order{OrderID: 5, Symbol: 3}); err != nil {
+		t.Fatal(err)
+	}
+	status.Enqueue(queue.Order{OrderID: 5, Symbol: 3, Status: queue.StatusFilled})
+
+	rec, err := r.Statuses().Dequeue()
+	if err != nil || rec == nil || rec.OrderID != 5 {
+		t.Fatalf("merged status: %+v %v", rec, err)
+	}
+	if err := r.Enqueue(queue.Order{OrderID: 5, MsgType: queue.MsgCancel}); !errors.Is(err, ErrUnknownOrder) {
+		t.Fatalf("cancel after fill: %v", err)
+	}
+}
+
+// quotes is a fixed top of book.
+type quotes struct{ bid, ask uint64 }
+
+func (q quotes) BestBid(uint32) (book.Level, bool) {
+	return book.Level{Price: q.bid, Quantity: 1}, q.bid != 0
+}
+func (q quotes) BestAsk(uint32) (book.Level, bool) {
+	return book.Level{Price: q.ask, Quantity: 1}, q.ask != 0
+}
+
+func TestBestPrice(t *testing.T) {
+	a, b, c := queue.NewInMemory(16), queue.NewInMemory(16), queue.NewInMemory(16)
+	r, _ := New(
+		Destination{Name: "a", Orders: a, Book: quotes{bid: 99, ask: 102}},
+		Destination{Name: "b", Orders: b, Book: quotes{bid: 100, ask: 101}},
+		Destination{Name: "c", Orders: c}, // no market data
+	)
+	if err := r.SetDefault(BestPrice{}, "c", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	r.Enqueue(queue.Order{OrderID: 1, Side: 0}) // buy: lowest ask is b
+	r.Enqueue(queue.Order{OrderID: 2, Side: 1}) // sell: highest bid is b
+	r.MarkDown("b")
+	r.Enqueue(queue.Order{OrderID: 3, Side: 1}) // b down: a has the best bid left
+	if a.Depth() != 1 || b.Depth() != 2 || c.Depth() != 0 {
+		t.Fatalf("depths a=%d b=%d c=%d", a.Depth(), b.Depth(), c.Depth())
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	a, b := queue.NewInMemory(16), queue.NewInMemory(16)
+	r, _ := New(Destination{Name: "a", Orders: a}, Destination{Name: "b", Orders: b})
+	r.SetDefault(&RoundRobin{}, "a", "b")
+	for id := uint64(1); id <= 4; id++ {
+		if err := r.Enqueue(queue.Order{OrderID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Depth() != 2 || b.Depth() != 2 {
+		t.Fatalf("depths a=%d b=%d", a.Depth(), b.Depth())
+	}
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"oms/book"
+	"oms/queue"
+)
+
+// TopOfBook is a venue's best prices. *book.Book implements it.
+type TopOfBook interface {
+	BestBid(symbol uint32) (book.Level, bool)
+	BestAsk(symbol uint32) (book.Level, bool)
+}
+
+var _ TopOfBook = (*book.Book)(nil)
+
+// Venue is a destination as a Strategy sees it. Book is nil for venues
+// without market data.
+type Venue struct {
+	Name string
+	Book TopOfBook
+}
+
+// Strategy picks the destination a new order tries first. venues are the
+// route's destinations that are up, in route order; Choose returns an index
+// into them. If the chosen venue fails the order falls over to the others
+// in route order, as without a strategy.
+type Strategy interface {
+	Choose(order queue.Order, venues []Venue) int
+}
+
+// Preference always picks the first venue: plain route order.
+type Preference struct{}
+
+func (Preference) Choose(queue.Order, []Venue) int { return 0 }
+
+// RoundRobin spreads orders evenly over the venues.
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+func (r *RoundRobin) Choose(_ queue.Order, venues []Venue) int {
+	return int((r.next.Add(1) - 1) % uint64(len(venues)))
+}
+
+// BestPrice sends a buy to the venue with the lowest best ask and a sell to
+// the one with the highest best bid. Venues without a quote for the symbol
+// are passed over; with no quote anywhere it falls back to route order.
+// Ties go to the venue earlier in the route.
+type BestPrice struct{}
+
+func (BestPrice) Choose(order queue.Order, venues []Venue) int {
+	best, found := 0, false
+	var bestPrice uint64
+	for i, v := range venues {
+		if v.Book == nil {
+			continue
+		}
+		var l book.Level
+		var ok bool
+		if order.Side == 0 {
+			l, ok = v.Book.BestAsk(order.Symbol)
+		} else {
+			l, ok = v.Book.BestBid(order.Symbol)
+		}
+		if !ok {
+			continue
+		}
+		better := l.Price < bestPrice
+		if order.Side != 0 {
+			better = l.Price > bestPrice
+		}
+		if !found || better {
+			best, bestPrice, found = i, l.Price, true
+		}
+	}
+	return best
+}
+
+// ParseStrategy reads a config value: "" or "preference", "round_robin",
+// "best_price".
+func ParseStrategy(name string) (Strategy, error) {
+	switch name {
+	case "", "preference":
+		return Preference{}, nil
+	case "round_robin":
+		return &RoundRobin{}, nil
+	case "best_price":
+		return BestPrice{}, nil
+	}
+	return nil, fmt.Errorf("unknown routing strategy %q", name)
+}
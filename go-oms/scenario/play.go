@@ -0,0 +1,222 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"oms/cpu"
+	"oms/queue"
+)
+
+// maxOpen bounds the orders a Generator remembers for cancels.
+const maxOpen = 4096
+
+type openOrder struct {
+	id     uint64
+	client uint32
+}
+
+// Generator makes a scenario's messages: the same sequence for the same
+// seed and ids. Timestamps are left to the sender.
+type Generator struct {
+	sc     *Scenario
+	rng    *rand.Rand
+	nextID func() uint64
+	open   []openOrder // recent new orders, for cancels to pick from
+}
+
+func NewGenerator(sc *Scenario, nextID func() uint64) *Generator {
+	return &Generator{sc: sc, rng: rand.New(rand.NewSource(sc.Seed)), nextID: nextID}
+}
+
+// Next returns the phase's next message: with its cancel ratio a cancel of
+// a recent order, otherwise a new limit order.
+func (g *Generator) Next(ph *Phase) queue.Order {
+	if ph.CancelRatio > 0 && len(g.open) > 0 && g.rng.Float64() < ph.CancelRatio {
+		i := g.rng.Intn(len(g.open))
+		o := g.open[i]
+		g.open[i] = g.open[len(g.open)-1]
+		g.open = g.open[:len(g.open)-1]
+		return queue.Cancel(o.id, o.client, 0)
+	}
+	order := g.newOrder(ph)
+	if ph.CancelRatio > 0 {
+		if len(g.open) < maxOpen {
+			g.open = append(g.open, openOrder{order.OrderID, order.ClientID})
+		} else {
+			g.open[g.rng.Intn(maxOpen)] = openOrder{order.OrderID, order.ClientID}
+		}
+	}
+	return order
+}
+
+// Reject returns a new order the engine must refuse: it has no quantity.
+func (g *Generator) Reject(ph *Phase) queue.Order {
+	order := g.newOrder(ph)
+	order.Quantity = 0
+	return order
+}
+
+func (g *Generator) newOrder(ph *Phase) queue.Order {
+	return queue.Order{
+		OrderID:  g.nextID(),
+		ClientID: g.sc.Clients[g.rng.Intn(len(g.sc.Clients))],
+		Symbol:   g.symbol(ph),
+		Side:     uint8(g.rng.Intn(2)),
+		Price:    g.between(g.sc.Price),
+		Quantity: uint32(g.between(g.sc.Quantity)),
+	}
+}
+
+func (g *Generator) symbol(ph *Phase) uint32 {
+	x := g.rng.Float64() * ph.picks[len(ph.picks)-1].upTo
+	for _, p := range ph.picks {
+		if x < p.upTo {
+			return p.symbol
+		}
+	}
+	return ph.picks[len(ph.picks)-1].symbol
+}
+
+func (g *Generator) between(r Range) uint64 {
+	return r.Min + uint64(g.rng.Int63n(int64(r.Max-r.Min+1)))
+}
+
+// Options adapt Play to where its orders go.
+type Options struct {
+	// NextID allocates order ids; the default counts up from 1.
+	NextID func() uint64
+	// StampEvery timestamps every Nth message and leaves the rest zero,
+	// where reading the clock per message would cost throughput. Zero or
+	// one stamps them all.
+	StampEvery uint64
+	// StallConsumer stops the consumer for d. stall_consumer faults are
+	// skipped without it.
+	StallConsumer func(d time.Duration)
+	// OnPhase runs as each phase starts.
+	OnPhase func(i int, ph *Phase)
+}
+
+// Progress can be read while Play runs, e.g. by a sampler.
+type Progress struct {
+	Sent  atomic.Uint64 // messages enqueued, fault traffic included
+	Phase atomic.Int64  // index of the phase being played
+}
+
+// Play sends the scenario to q, phase by phase, until it ends or ctx is
+// done. A full queue is retried; any other enqueue error stops the play.
+// prog may be nil.
+func Play(ctx context.Context, sc *Scenario, q queue.OrderQueue, opts Options, prog *Progress) error {
+	if prog == nil {
+		prog = &Progress{}
+	}
+	nextID := opts.NextID
+	if nextID == nil {
+		var id uint64
+		nextID = func() uint64 { id++; return id }
+	}
+	gen := NewGenerator(sc, nextID)
+
+	var stamped uint64
+	send := func(o queue.Order) error {
+		stamped++
+		if opts.StampEvery <= 1 || stamped%opts.StampEvery == 0 {
+			o.Timestamp = uint64(time.Now().UnixNano())
+		}
+		for {
+			err := q.Enqueue(o)
+			if err == nil {
+				prog.Sent.Add(1)
+				return nil
+			}
+			if !errors.Is(err, queue.ErrQueueFull) {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			cpu.Relax()
+		}
+	}
+
+	start := time.Now()
+	for i := range sc.Phases {
+		ph := &sc.Phases[i]
+		prog.Phase.Store(int64(i))
+		if opts.OnPhase != nil {
+			opts.OnPhase(i, ph)
+		}
+		end := start.Add(ph.Duration)
+		faults := ph.Faults
+		paceFrom, paced := start, 0.0
+		// unpaced phases without faults read the clock every 256 messages
+		everyMessage := ph.Rate > 0 || len(faults) > 0
+		now := time.Now()
+		for k := 0; now.Before(end); k++ {
+			if everyMessage || k%256 == 0 {
+				now = time.Now()
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			for len(faults) > 0 && now.Sub(start) >= faults[0].At {
+				f := faults[0]
+				faults = faults[1:]
+				everyMessage = ph.Rate > 0 || len(faults) > 0
+				switch f.Kind {
+				case FaultPause:
+					wait := min(f.Duration, end.Sub(now))
+					if err := sleep(ctx, wait); err != nil {
+						return err
+					}
+					paceFrom = paceFrom.Add(wait) // no catching up afterwards
+					now = time.Now()
+				case FaultBurst, FaultReject:
+					for range f.Count {
+						msg := gen.Next(ph)
+						if f.Kind == FaultReject {
+							msg = gen.Reject(ph)
+						}
+						if err := send(msg); err != nil {
+							return err
+						}
+					}
+				case FaultStallConsumer:
+					if opts.StallConsumer != nil {
+						opts.StallConsumer(f.Duration)
+					}
+				}
+			}
+			if ph.Rate > 0 && paced >= ph.Rate*now.Sub(paceFrom).Seconds() {
+				// ahead of the rate: wait for the next message's slot
+				due := paceFrom.Add(time.Duration((paced + 1) / ph.Rate * float64(time.Second)))
+				if wait := due.Sub(now); wait > 50*time.Microsecond {
+					time.Sleep(min(wait, end.Sub(now)))
+				} else {
+					cpu.Relax()
+				}
+				continue
+			}
+			if err := send(gen.Next(ph)); err != nil {
+				return err
+			}
+			paced++
+		}
+		start = end
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,212 @@
+// Package scenario describes synthetic order flow in YAML files, so QA can
+// script market conditions for omsbench and the stream simulator without
+// writing Go:
+//
+//	name: open-then-halt
+//	seed: 42
+//	clients: [1001, 1002]
+//	symbols: {1: 5, 2: 1}          # symbol id: weight
+//	price: {min: 50000, max: 55000}
+//	quantity: {min: 100, max: 1000}
+//	phases:
+//	  - name: open
+//	    duration: 10s
+//	    rate: 50000                # orders per second; 0 = as fast as taken
+//	    cancel_ratio: 0.2          # share of messages cancelling an open order
+//	    measure: true
+//	    faults:
+//	      - {at: 4s, kind: burst, count: 20000}
+//	      - {at: 6s, kind: stall_consumer, duration: 500ms}
+//	  - name: halt
+//	    duration: 3s
+//	    symbols: {2: 1}            # replaces the scenario weights
+//	    faults:
+//	      - {at: 0s, kind: pause, duration: 3s}
+//
+// Phases run back to back for their full duration; faults fire at an
+// offset into their phase.
+package scenario
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Fault kinds.
+const (
+	FaultPause         = "pause"          // send nothing for Duration
+	FaultBurst         = "burst"          // send Count orders at once, ignoring the rate
+	FaultReject        = "reject"         // send Count orders the engine must reject
+	FaultStallConsumer = "stall_consumer" // stop the consumer for Duration, where the player can
+)
+
+type Range struct {
+	Min uint64 `yaml:"min"`
+	Max uint64 `yaml:"max"`
+}
+
+type Fault struct {
+	At       time.Duration `yaml:"at"`
+	Kind     string        `yaml:"kind"`
+	Duration time.Duration `yaml:"duration"`
+	Count    int           `yaml:"count"`
+}
+
+type Phase struct {
+	Name        string             `yaml:"name"`
+	Duration    time.Duration      `yaml:"duration"`
+	Rate        float64            `yaml:"rate"`
+	Symbols     map[uint32]float64 `yaml:"symbols"`
+	CancelRatio float64            `yaml:"cancel_ratio"`
+	Measure     bool               `yaml:"measure"`
+	Faults      []Fault            `yaml:"faults"`
+
+	picks []pick // cumulative symbol weights, from Symbols or the scenario's
+}
+
+type pick struct {
+	symbol uint32
+	upTo   float64
+}
+
+type Scenario struct {
+	Name     string             `yaml:"name"`
+	Seed     int64              `yaml:"seed"`
+	Clients  []uint32           `yaml:"clients"`
+	Symbols  map[uint32]float64 `yaml:"symbols"`
+	Price    Range              `yaml:"price"`
+	Quantity Range              `yaml:"quantity"`
+	Phases   []Phase            `yaml:"phases"`
+}
+
+// Load reads and validates a scenario file.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// Parse decodes and validates a scenario, filling in defaults: client
+// 1001, symbol 1, prices 50000-55000 and quantities 100-1000. Unknown keys
+// are errors, so a typo does not silently change a test.
+func Parse(data []byte) (*Scenario, error) {
+	var sc Scenario
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&sc); err != nil {
+		return nil, err
+	}
+	if len(sc.Clients) == 0 {
+		sc.Clients = []uint32{1001}
+	}
+	if len(sc.Symbols) == 0 {
+		sc.Symbols = map[uint32]float64{1: 1}
+	}
+	if sc.Price == (Range{}) {
+		sc.Price = Range{Min: 50000, Max: 55000}
+	}
+	if sc.Quantity == (Range{}) {
+		sc.Quantity = Range{Min: 100, Max: 1000}
+	}
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// Validate checks a scenario and prepares its phases for play; Parse
+// calls it, and scenarios built in Go must too.
+func (sc *Scenario) Validate() error {
+	if len(sc.Phases) == 0 {
+		return fmt.Errorf("no phases")
+	}
+	if sc.Price.Min == 0 || sc.Price.Min > sc.Price.Max {
+		return fmt.Errorf("price range %d-%d", sc.Price.Min, sc.Price.Max)
+	}
+	if sc.Quantity.Min == 0 || sc.Quantity.Min > sc.Quantity.Max || sc.Quantity.Max > 1<<32-1 {
+		return fmt.Errorf("quantity range %d-%d", sc.Quantity.Min, sc.Quantity.Max)
+	}
+	for i := range sc.Phases {
+		ph := &sc.Phases[i]
+		if ph.Name == "" {
+			ph.Name = fmt.Sprintf("phase%d", i+1)
+		}
+		if err := ph.validate(sc.Symbols); err != nil {
+			return fmt.Errorf("phase %s: %w", ph.Name, err)
+		}
+	}
+	return nil
+}
+
+func (ph *Phase) validate(defaults map[uint32]float64) error {
+	switch {
+	case ph.Duration <= 0:
+		return fmt.Errorf("duration must be positive")
+	case ph.Rate < 0:
+		return fmt.Errorf("rate must not be negative")
+	case ph.CancelRatio < 0 || ph.CancelRatio >= 1:
+		return fmt.Errorf("cancel_ratio %v not in [0, 1)", ph.CancelRatio)
+	}
+	weights := ph.Symbols
+	if len(weights) == 0 {
+		weights = defaults
+	}
+	symbols := make([]uint32, 0, len(weights))
+	for s, w := range weights {
+		if w < 0 {
+			return fmt.Errorf("symbol %d: negative weight", s)
+		}
+		symbols = append(symbols, s)
+	}
+	slices.Sort(symbols) // map order would make runs differ for one seed
+	ph.picks = ph.picks[:0]
+	var total float64
+	for _, s := range symbols {
+		total += weights[s]
+		ph.picks = append(ph.picks, pick{symbol: s, upTo: total})
+	}
+	if total == 0 {
+		return fmt.Errorf("symbol weights sum to zero")
+	}
+
+	for _, f := range ph.Faults {
+		if f.At < 0 || f.At >= ph.Duration {
+			return fmt.Errorf("fault %s at %v outside the phase", f.Kind, f.At)
+		}
+		switch f.Kind {
+		case FaultPause, FaultStallConsumer:
+			if f.Duration <= 0 {
+				return fmt.Errorf("fault %s needs a duration", f.Kind)
+			}
+		case FaultBurst, FaultReject:
+			if f.Count <= 0 {
+				return fmt.Errorf("fault %s needs a count", f.Kind)
+			}
+		default:
+			return fmt.Errorf("unknown fault kind %q", f.Kind)
+		}
+	}
+	slices.SortStableFunc(ph.Faults, func(a, b Fault) int { return cmp.Compare(a.At, b.At) })
+	return nil
+}
+
+// Duration is the length of all phases together.
+func (sc *Scenario) Duration() time.Duration {
+	var d time.Duration
+	for _, ph := range sc.Phases {
+		d += ph.Duration
+	}
+	return d
+}
@@ -0,0 +1,167 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+const example = `
+name: open-then-halt
+seed: 42
+clients: [1001, 1002]
+symbols: {1: 5, 2: 1}
+price: {min: 50000, max: 55000}
+quantity: {min: 100, max: 1000}
+phases:
+  - name: open
+    duration: 10s
+    rate: 50000
+    cancel_ratio: 0.2
+    measure: true
+    faults:
+      - {at: 6s, kind: stall_consumer, duration: 500ms}
+      - {at: 4s, kind: burst, count: 20000}
+  - duration: 3s
+    symbols: {2: 1}
+    faults:
+      - {at: 0s, kind: pause, duration: 3s}
+`
+
+func TestParse(t *testing.T) {
+	sc, err := Parse([]byte(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Duration() != 13*time.Second || len(sc.Phases) != 2 {
+		t.Fatalf("phases: %+v", sc.Phases)
+	}
+	open := sc.Phases[0]
+	if open.Rate != 50000 || !open.Measure || open.Faults[0].Kind != FaultBurst || open.Faults[1].Duration != 500*time.Millisecond {
+		t.Fatalf("open phase: %+v", open)
+	}
+	if sc.Phases[1].Name != "phase2" || len(sc.Phases[1].picks) != 1 {
+		t.Fatalf("second phase: %+v", sc.Phases[1])
+	}
+
+	sc, err = Parse([]byte("phases: [{duration: 1s}]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Clients[0] != 1001 || sc.Price.Min != 50000 || sc.Quantity.Max != 1000 {
+		t.Fatalf("defaults: %+v", sc)
+	}
+
+	for _, bad := range []string{
+		"phases: [{duration: 1s, rat: 5}]",
+		"phases: []",
+		"phases: [{duration: 1s, faults: [{at: 2s, kind: pause, duration: 1s}]}]",
+		"phases: [{duration: 1s, faults: [{at: 0s, kind: burst}]}]",
+		"phases: [{duration: 1s, faults: [{at: 0s, kind: crash}]}]",
+		"phases: [{duration: 1s, cancel_ratio: 1}]",
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+func TestGeneratorDeterministic(t *testing.T) {
+	sc, err := Parse([]byte(example))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter := func() func() uint64 {
+		var id uint64
+		return func() uint64 { id++; return id }
+	}
+	a, b := NewGenerator(sc, counter()), NewGenerator(sc, counter())
+	cancels := 0
+	for range 10000 {
+		x, y := a.Next(&sc.Phases[0]), b.Next(&sc.Phases[0])
+		if x != y {
+			t.Fatalf("same seed diverged: %+v != %+v", x, y)
+		}
+		if x.MsgType == queue.MsgCancel {
+			cancels++
+		} else if x.Symbol != 1 && x.Symbol != 2 || x.Price < 50000 || x.Price > 55000 {
+			t.Fatalf("order outside the scenario: %+v", x)
+		}
+	}
+	if cancels < 1500 || cancels > 2500 {
+		t.Fatalf("%d cancels in 10000 messages at ratio 0.2", cancels)
+	}
+	if o := a.Next(&sc.Phases[1]); o.Symbol != 2 {
+		t.Fatalf("phase weights ignored: symbol %d", o.Symbol)
+	}
+}
+
+func TestPlay(t *testing.T) {
+	sc, err := Parse([]byte(`
+phases:
+  - duration: 200ms
+    rate: 1000
+    faults:
+      - {at: 50ms, kind: burst, count: 300}
+      - {at: 100ms, kind: reject, count: 20}
+      - {at: 120ms, kind: stall_consumer, duration: 1ms}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := queue.NewInMemory(4096)
+	var stalls int
+	var prog Progress
+	start := time.Now()
+	err = Play(context.Background(), sc, q, Options{
+		StallConsumer: func(time.Duration) { stalls++ },
+	}, &prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Fatalf("played in %v", d)
+	}
+
+	var paced, rejects int
+	for {
+		o, err := q.Dequeue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o == nil {
+			break
+		}
+		if o.Timestamp == 0 {
+			t.Fatalf("unstamped order %+v", o)
+		}
+		if o.Quantity == 0 {
+			rejects++
+		} else {
+			paced++
+		}
+	}
+	paced -= 300
+	if rejects != 20 || stalls != 1 || uint64(paced+320) != prog.Sent.Load() {
+		t.Fatalf("rejects %d, stalls %d, sent %d", rejects, stalls, prog.Sent.Load())
+	}
+	// 1000/s for 200ms, with slack for a slow machine
+	if paced < 150 || paced > 210 {
+		t.Fatalf("%d paced orders, want about 200", paced)
+	}
+}
+
+func TestPlayCanceled(t *testing.T) {
+	sc, err := Parse([]byte("phases: [{duration: 1h, rate: 10}]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Play(ctx, sc, queue.NewInMemory(64), Options{}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Package scheduled holds orders with a future activation time on the
+// producer side and releases them to the queue when they come due, for
+// opening-auction orders and scheduled strategies. The engine never sees an
+// order before its activation, so cancelling one before then is local.
+package scheduled
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+// ErrDuplicate is returned when an order id is already scheduled.
+var ErrDuplicate = errors.New("order already scheduled")
+
+type entry struct {
+	order    queue.Order
+	rounds   uint64 // full turns of the wheel left before it is due
+	canceled bool
+}
+
+// Wheel is a hashed timer wheel: a ring of buckets, one per tick. An order
+// lands in the bucket of its activation tick, with the number of full turns
+// left before it is due, so scheduling and cancelling are O(1) and Advance
+// only looks at the buckets it passes. Activation times are rounded up to
+// the next tick.
+//
+// Wheel is safe for concurrent use: producers schedule and cancel while one
+// goroutine drives Advance.
+type Wheel struct {
+	tick    time.Duration
+	release func(queue.Order) error
+
+	mu      sync.Mutex
+	slots   [][]*entry
+	current uint64 // last tick processed, in ticks since the unix epoch
+	pending map[uint64]*entry
+}
+
+// NewWheel returns a wheel starting at now that hands due orders to
+// release. An order whose release fails stays pending and is retried on the
+// next tick.
+func NewWheel(tick time.Duration, slots int, now time.Time, release func(queue.Order) error) *Wheel {
+	tick, slots = max(tick, time.Microsecond), max(slots, 1)
+	return &Wheel{
+		tick:    tick,
+		release: release,
+		slots:   make([][]*entry, slots),
+		current: uint64(now.UnixNano()) / uint64(tick),
+		pending: make(map[uint64]*entry),
+	}
+}
+
+// Schedule holds order until at. An activation time already passed is due
+// on the next Advance.
+func (w *Wheel) Schedule(order queue.Order, at time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, dup := w.pending[order.OrderID]; dup {
+		return fmt.Errorf("%w: %d", ErrDuplicate, order.OrderID)
+	}
+	ns := uint64(max(at.UnixNano(), 0))
+	due := (ns + uint64(w.tick) - 1) / uint64(w.tick)
+	e := &entry{order: order}
+	w.pending[order.OrderID] = e
+	w.place(e, max(due, w.current+1))
+	return nil
+}
+
+// place puts e in the bucket of tick due, which must be after w.current.
+func (w *Wheel) place(e *entry, due uint64) {
+	n := uint64(len(w.slots))
+	e.rounds = (due - w.current - 1) / n
+	w.slots[due%n] = append(w.slots[due%n], e)
+}
+
+// Cancel drops a scheduled order before activation. It reports false if the
+// order was not pending, e.g. already released.
+func (w *Wheel) Cancel(orderID uint64) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e, ok := w.pending[orderID]
+	if ok {
+		e.canceled = true
+		delete(w.pending, orderID)
+	}
+	return ok
+}
+
+// Advance releases every order due by now and returns how many it
+// released, with the first release error other than a full queue.
+func (w *Wheel) Advance(now time.Time) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	target := uint64(max(now.UnixNano(), 0)) / uint64(w.tick)
+	released := 0
+	var firstErr error
+	for w.current < target {
+		w.current++
+		idx := w.current % uint64(len(w.slots))
+		bucket := w.slots[idx]
+		if len(bucket) == 0 {
+			continue
+		}
+		w.slots[idx] = nil
+		var retry []*entry
+		for _, e := range bucket {
+			switch {
+			case e.canceled:
+			case e.rounds > 0:
+				e.rounds--
+				w.slots[idx] = append(w.slots[idx], e)
+			default:
+				err := w.release(e.order)
+				if err == nil {
+					delete(w.pending, e.order.OrderID)
+					released++
+					continue
+				}
+				retry = append(retry, e)
+				if firstErr == nil && !errors.Is(err, queue.ErrQueueFull) {
+					firstErr = fmt.Errorf("release order %d: %w", e.order.OrderID, err)
+				}
+			}
+		}
+		for _, e := range retry {
+			w.place(e, w.current+1)
+		}
+	}
+	return released, firstErr
+}
+
+// Pending is the number of orders waiting for activation.
+func (w *Wheel) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
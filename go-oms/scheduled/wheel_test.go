@@ -0,0 +1,81 @@
+package scheduled
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestReleaseInActivationOrder(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	q := queue.NewInMemory(16)
+	w := NewWheel(time.Millisecond, 8, start, q.Enqueue)
+
+	// 20ms is past one turn of the 8-slot wheel and shares a bucket with 4ms
+	for id, at := range map[uint64]time.Duration{1: 4 * time.Millisecond, 2: 20 * time.Millisecond, 3: 12 * time.Millisecond} {
+		if err := w.Schedule(queue.Order{OrderID: id}, start.Add(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Schedule(queue.Order{OrderID: 1}, start); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("duplicate: %v", err)
+	}
+
+	for _, step := range []struct {
+		at   time.Duration
+		want []uint64
+	}{
+		{3 * time.Millisecond, nil},
+		{4 * time.Millisecond, []uint64{1}},
+		{19 * time.Millisecond, []uint64{3}},
+		{time.Second, []uint64{2}},
+	} {
+		if _, err := w.Advance(start.Add(step.at)); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range step.want {
+			if o, _ := q.Dequeue(); o == nil || o.OrderID != id {
+				t.Fatalf("at %v: got %+v, want order %d", step.at, o, id)
+			}
+		}
+		if q.Depth() != 0 {
+			t.Fatalf("at %v: %d orders released early", step.at, q.Depth())
+		}
+	}
+	if w.Pending() != 0 {
+		t.Fatalf("%d still pending", w.Pending())
+	}
+}
+
+func TestCancelBeforeActivation(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	q := queue.NewInMemory(16)
+	w := NewWheel(time.Millisecond, 8, start, q.Enqueue)
+	w.Schedule(queue.Order{OrderID: 1}, start.Add(5*time.Millisecond))
+
+	if !w.Cancel(1) || w.Cancel(1) {
+		t.Fatal("cancel should succeed exactly once")
+	}
+	w.Advance(start.Add(time.Second))
+	if q.Depth() != 0 {
+		t.Fatal("canceled order released")
+	}
+}
+
+func TestRetryOnFullQueue(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	q := queue.NewInMemory(1)
+	w := NewWheel(time.Millisecond, 8, start, q.Enqueue)
+	w.Schedule(queue.Order{OrderID: 1}, start.Add(time.Millisecond))
+	w.Schedule(queue.Order{OrderID: 2}, start.Add(time.Millisecond))
+
+	if n, err := w.Advance(start.Add(time.Millisecond)); n != 1 || err != nil {
+		t.Fatalf("advance: %d %v", n, err)
+	}
+	q.Dequeue()
+	if n, _ := w.Advance(start.Add(2 * time.Millisecond)); n != 1 || w.Pending() != 0 {
+		t.Fatalf("retry: released %d, %d pending", n, w.Pending())
+	}
+}
@@ -0,0 +1,150 @@
+// Package sdnotify lets the long-running components run as systemd
+// services with Type=notify (or notify-reload): they report READY=1 once
+// they are serving, STOPPING=1 on the way down and RELOADING=1 around a
+// SIGHUP reload, ping the service watchdog while healthy, and can take
+// their listening socket from a .socket unit instead of binding it. Outside
+// systemd, with none of its variables set, everything here is a no-op.
+//
+//	[Service]
+//	Type=notify-reload
+//	ExecStart=/opt/oms/omsbroker -queue /run/oms/orders
+//	WatchdogSec=10s
+//	Restart=on-failure
+//	RestartPreventExitStatus=78
+package sdnotify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// States sent to Notify.
+const (
+	Ready     = "READY=1"
+	Stopping  = "STOPPING=1"
+	Reloading = "RELOADING=1" // see Reload, which adds the timestamp systemd wants
+	KeepAlive = "WATCHDOG=1"
+)
+
+// Exit codes the commands use so a unit can tell failures apart, e.g. with
+// RestartPreventExitStatus=78 so a bad config is not restarted in a loop.
+// A stop on SIGTERM or SIGINT exits 0.
+const (
+	ExitFailure = 1  // anything else: worth a restart
+	ExitConfig  = 78 // EX_CONFIG: a flag or config file is invalid
+)
+
+// Notify sends states, such as Ready, to the service manager. It does
+// nothing, successfully, when NOTIFY_SOCKET is unset.
+func Notify(states ...string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	// a leading @ is an abstract socket, which net understands as is
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	return nil
+}
+
+// Status sets the one-line status systemctl status shows.
+func Status(format string, args ...any) error {
+	return Notify("STATUS=" + fmt.Sprintf(format, args...))
+}
+
+// Reload reports a reload starting; send Ready when it is done.
+func Reload() error {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return err
+	}
+	return Notify(Reloading, "MONOTONIC_USEC="+strconv.FormatInt(ts.Nano()/1000, 10))
+}
+
+// WatchdogInterval is the unit's WatchdogSec, or 0 when the service
+// watchdog is off or meant for another process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog pings the service watchdog at half its interval until ctx is
+// done, skipping pings while healthy, if set, reports false, so that
+// systemd restarts a process that is running but stuck. It returns at once
+// when the watchdog is off.
+func Watchdog(ctx context.Context, healthy func() bool) {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if healthy == nil || healthy() {
+				Notify(KeepAlive)
+			}
+		}
+	}
+}
+
+// Listeners returns the sockets a .socket unit passed this process, in the
+// order they are listed there, or nil when started without any. The
+// LISTEN_ variables are cleared so child processes do not claim them too.
+func Listeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	const first = 3 // SD_LISTEN_FDS_START
+	var out []net.Listener
+	for i := range n {
+		fd := first + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range out {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %s from systemd: %w", name, err)
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
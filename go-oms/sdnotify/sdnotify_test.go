@@ -0,0 +1,84 @@
+package sdnotify
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify(Ready); err != nil {
+		t.Fatalf("outside systemd: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	recv := func() string {
+		t.Helper()
+		buf := make([]byte, 256)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+
+	if err := Notify(Ready, "STATUS=serving"); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv(); got != "READY=1\nSTATUS=serving" {
+		t.Fatalf("got %q", got)
+	}
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv(); !strings.HasPrefix(got, "RELOADING=1\nMONOTONIC_USEC=") {
+		t.Fatalf("got %q", got)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if got := WatchdogInterval(); got != 20*time.Millisecond {
+		t.Fatalf("interval %v", got)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Watchdog(ctx, nil)
+		close(done)
+	}()
+	if got := recv(); got != KeepAlive {
+		t.Fatalf("got %q", got)
+	}
+	cancel()
+	<-done
+
+	t.Setenv("WATCHDOG_PID", "1")
+	if got := WatchdogInterval(); got != 0 {
+		t.Fatalf("interval %v for another process's watchdog", got)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	ls, err := Listeners()
+	if err != nil || ls != nil {
+		t.Fatalf("sockets meant for another process: %v, %v", ls, err)
+	}
+	if _, set := os.LookupEnv("LISTEN_FDS"); set {
+		t.Fatal("LISTEN_FDS left set")
+	}
+}
@@ -0,0 +1,72 @@
+// Package session holds the trading session state shared by everything that
+// decides whether new orders may go to the engine.
+package session
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"oms/queue"
+)
+
+type State uint32
+
+const (
+	PreOpen State = iota
+	Open
+	Halted
+	Closed
+)
+
+var stateNames = [...]string{"preopen", "open", "halted", "closed"}
+
+func (s State) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return fmt.Sprintf("State(%d)", uint32(s))
+}
+
+// ParseState is the inverse of State.String.
+func ParseState(name string) (State, error) {
+	for i, n := range stateNames {
+		if n == name {
+			return State(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown session state %q", name)
+}
+
+// ErrNotOpen is returned for new orders outside the Open state.
+var ErrNotOpen = queue.NewReject(queue.ReasonSessionClosed, "session not open")
+
+// Session is the current state; the zero value is PreOpen.
+type Session struct {
+	state atomic.Uint32
+}
+
+func (s *Session) State() State {
+	return State(s.state.Load())
+}
+
+func (s *Session) Set(state State) {
+	s.state.Store(uint32(state))
+}
+
+// Gate passes new orders to the wrapped queue only while the session is
+// Open. Control messages (mass cancels) always pass.
+type Gate struct {
+	queue.OrderQueue
+	Session *Session
+}
+
+var _ queue.OrderQueue = (*Gate)(nil)
+
+func (g *Gate) Enqueue(order queue.Order) error {
+	if !order.IsControl() {
+		if state := g.Session.State(); state != Open {
+			return fmt.Errorf("%w: %s", ErrNotOpen, state)
+		}
+	}
+	return g.OrderQueue.Enqueue(order)
+}
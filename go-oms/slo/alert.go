@@ -0,0 +1,26 @@
+package slo
+
+import (
+	"log"
+
+	"oms/alertpost"
+)
+
+// LogAlerts returns a hook that logs every alert with prefix.
+func LogAlerts(prefix string) func(Alert) {
+	return func(a Alert) {
+		if a.Firing {
+			log.Printf("%s SLO %s burning: %.1fx budget (%.1fx recently), %d events at %.0f/s, target %.3g%% within %v",
+				prefix, a.Objective, a.Burn, a.ShortBurn, a.Events, a.Rate, a.Goal*100, a.Threshold)
+		} else {
+			log.Printf("%s SLO %s recovered: %.1fx budget", prefix, a.Objective, a.Burn)
+		}
+	}
+}
+
+// Webhook returns a hook that POSTs every alert to url as JSON. Posts run
+// in the background so a slow receiver never holds up Check; failures are
+// logged.
+func Webhook(url string) func(Alert) {
+	return alertpost.Webhook[Alert](url, "[SLO]")
+}
@@ -0,0 +1,167 @@
+// Package slo checks rolling latency against service level objectives and
+// raises alerts on fast error-budget burn, so a regression in production
+// pages someone instead of waiting for a benchmark.
+//
+// An objective says that a fraction Goal of events finish within Threshold.
+// The error budget is the remaining 1-Goal; the burn rate is the observed
+// slow fraction divided by the budget, so a burn of 1 spends the budget
+// exactly over the window. An alert fires while both the full window and
+// its last twelfth burn at MaxBurn or faster: the long window keeps one
+// slow burst from paging, the short one stops the alert soon after the
+// cause is gone.
+package slo
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	buckets      = 60
+	shortBuckets = buckets / 12
+
+	// DefaultMaxBurn spends a 30-day budget in about two days.
+	DefaultMaxBurn = 14.4
+)
+
+// Objective is one latency target.
+type Objective struct {
+	Name      string
+	Threshold time.Duration // an event slower than this is bad
+	Goal      float64       // fraction of events that must be good, e.g. 0.999
+	Window    time.Duration // rolling window the burn rate is taken over
+	MaxBurn   float64       // burn rate that alerts; 0 means DefaultMaxBurn
+	MinEvents uint64        // events the window needs before it can alert
+}
+
+func (o Objective) Validate() error {
+	switch {
+	case o.Threshold <= 0:
+		return fmt.Errorf("slo %s: threshold must be positive", o.Name)
+	case o.Goal <= 0 || o.Goal >= 1:
+		return fmt.Errorf("slo %s: goal %v not between 0 and 1", o.Name, o.Goal)
+	case o.Window < buckets*time.Millisecond:
+		return fmt.Errorf("slo %s: window %v too short", o.Name, o.Window)
+	case o.MaxBurn < 0:
+		return fmt.Errorf("slo %s: max burn must not be negative", o.Name)
+	}
+	return nil
+}
+
+// Alert reports an objective starting or stopping to burn too fast.
+type Alert struct {
+	Objective string        `json:"objective"`
+	Threshold time.Duration `json:"threshold_ns"`
+	Goal      float64       `json:"goal"`
+	Firing    bool          `json:"firing"`
+	Burn      float64       `json:"burn"`       // over the window
+	ShortBurn float64       `json:"short_burn"` // over its last twelfth
+	Events    uint64        `json:"events"`     // in the window
+	Rate      float64       `json:"rate"`       // events per second over the window
+	At        time.Time     `json:"at"`
+}
+
+type bucket struct {
+	index     int64 // time / width; tells a stale slot from a current one
+	good, bad uint64
+}
+
+// Tracker keeps one objective's rolling counts. Observe and Check are safe
+// for concurrent use; OnAlert must be called before either.
+type Tracker struct {
+	obj   Objective
+	width time.Duration
+
+	mu      sync.Mutex
+	buckets [buckets]bucket
+	firing  bool
+	hooks   []func(Alert)
+}
+
+func NewTracker(obj Objective) (*Tracker, error) {
+	if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+	if obj.MaxBurn == 0 {
+		obj.MaxBurn = DefaultMaxBurn
+	}
+	return &Tracker{obj: obj, width: obj.Window / buckets}, nil
+}
+
+func (t *Tracker) Objective() Objective { return t.obj }
+
+// OnAlert registers fn to run, from Check, whenever the alert starts or
+// stops firing.
+func (t *Tracker) OnAlert(fn func(Alert)) {
+	t.hooks = append(t.hooks, fn)
+}
+
+// Observe records one event that took latency and finished at now.
+func (t *Tracker) Observe(latency time.Duration, now time.Time) {
+	t.record(latency <= t.obj.Threshold, now)
+}
+
+func (t *Tracker) record(good bool, now time.Time) {
+	index := now.UnixNano() / int64(t.width)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[index%buckets]
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+	if good {
+		b.good++
+	} else {
+		b.bad++
+	}
+}
+
+// burn sums the last n buckets up to now. Call with t.mu held.
+func (t *Tracker) burn(now time.Time, n int) (burn float64, events uint64) {
+	index := now.UnixNano() / int64(t.width)
+	var bad uint64
+	for i := int64(0); i < int64(n); i++ {
+		b := &t.buckets[(index-i)%buckets]
+		if b.index != index-i {
+			continue
+		}
+		events += b.good + b.bad
+		bad += b.bad
+	}
+	if events == 0 {
+		return 0, 0
+	}
+	return float64(bad) / float64(events) / (1 - t.obj.Goal), events
+}
+
+// Check evaluates the objective at now, runs the hooks if the alert
+// changed state, and returns the current figures.
+func (t *Tracker) Check(now time.Time) Alert {
+	t.mu.Lock()
+	burn, events := t.burn(now, buckets)
+	short, _ := t.burn(now, shortBuckets)
+	firing := events > 0 && events >= t.obj.MinEvents &&
+		burn >= t.obj.MaxBurn && short >= t.obj.MaxBurn
+	changed := firing != t.firing
+	t.firing = firing
+	t.mu.Unlock()
+
+	a := Alert{
+		Objective: t.obj.Name,
+		Threshold: t.obj.Threshold,
+		Goal:      t.obj.Goal,
+		Firing:    firing,
+		Burn:      burn,
+		ShortBurn: short,
+		Events:    events,
+		Rate:      float64(events) / t.obj.Window.Seconds(),
+		At:        now,
+	}
+	if changed {
+		for _, fn := range t.hooks {
+			fn(a)
+		}
+	}
+	return a
+}
@@ -0,0 +1,90 @@
+package slo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestBurnRateAlertFiresAndResolves(t *testing.T) {
+	tr, err := NewTracker(Objective{Name: "ack", Threshold: time.Millisecond, Goal: 0.99, Window: time.Minute, MinEvents: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alerts []Alert
+	tr.OnAlert(func(a Alert) { alerts = append(alerts, a) })
+
+	now := time.Unix(1_700_000_000, 0)
+	for i := range 1000 {
+		tr.Observe(100*time.Microsecond, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if a := tr.Check(now.Add(time.Second)); a.Firing || a.Burn != 0 {
+		t.Fatalf("healthy traffic alerting: %+v", a)
+	}
+
+	// half slow is 50x a 1% budget
+	now = now.Add(10 * time.Second)
+	for i := range 500 {
+		lat := 100 * time.Microsecond
+		if i%2 == 0 {
+			lat = 5 * time.Millisecond
+		}
+		tr.Observe(lat, now)
+	}
+	a := tr.Check(now)
+	if !a.Firing || a.ShortBurn < 49 || len(alerts) != 1 {
+		t.Fatalf("want firing alert, got %+v (%d hooks)", a, len(alerts))
+	}
+	tr.Check(now) // still firing: no second hook
+	if len(alerts) != 1 {
+		t.Fatalf("hook ran %d times", len(alerts))
+	}
+
+	// once the short window is clean again the alert resolves, even though
+	// the long window still holds the slow burst
+	later := now.Add(10 * time.Second)
+	for range 100 {
+		tr.Observe(100*time.Microsecond, later)
+	}
+	if a := tr.Check(later); a.Firing || a.Burn == 0 || len(alerts) != 2 {
+		t.Fatalf("want resolved alert, got %+v (%d hooks)", a, len(alerts))
+	}
+}
+
+func TestUnackedOrdersBurnAckBudget(t *testing.T) {
+	ack, _ := NewTracker(Objective{Name: "ack", Threshold: time.Millisecond, Goal: 0.99, Window: time.Minute})
+	timed := NewTimed(queue.NewInMemory(16), nil, ack)
+
+	got := make(chan Alert, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error(err)
+		}
+		got <- a
+	}))
+	defer srv.Close()
+	ack.OnAlert(Webhook(srv.URL))
+
+	if err := timed.Enqueue(queue.Order{OrderID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := timed.Enqueue(queue.Order{OrderID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	timed.OnStatus(queue.Order{OrderID: 1, Status: queue.StatusAcked})
+	timed.Check(time.Now().Add(time.Second)) // order 2 never answered
+
+	select {
+	case a := <-got:
+		if !a.Firing || a.Objective != "ack" || a.Events != 2 {
+			t.Fatalf("webhook got %+v", a)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no webhook")
+	}
+}
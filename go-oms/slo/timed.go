@@ -0,0 +1,100 @@
+package slo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+// Timed wraps an order queue and times every accepted Enqueue against
+// EnqueueSLO, and the wait from enqueue to an order's first status record
+// against AckSLO. Either may be nil. A full ring is not timed: the producer
+// retries, and the attempt that lands is.
+type Timed struct {
+	queue.OrderQueue
+	EnqueueSLO *Tracker
+	AckSLO     *Tracker
+
+	mu   sync.Mutex
+	sent map[uint64]time.Time // order id -> enqueued, awaiting first status
+}
+
+var _ queue.OrderQueue = (*Timed)(nil)
+
+func NewTimed(q queue.OrderQueue, enqueue, ack *Tracker) *Timed {
+	return &Timed{OrderQueue: q, EnqueueSLO: enqueue, AckSLO: ack, sent: make(map[uint64]time.Time)}
+}
+
+func (t *Timed) Enqueue(order queue.Order) error {
+	start := time.Now()
+	err := t.OrderQueue.Enqueue(order)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if t.EnqueueSLO != nil {
+		t.EnqueueSLO.Observe(now.Sub(start), now)
+	}
+	if t.AckSLO != nil && !order.IsControl() {
+		t.mu.Lock()
+		t.sent[order.OrderID] = now
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+// OnStatus takes each record from the status ring; the first one for an
+// order ends its ack wait.
+func (t *Timed) OnStatus(status queue.Order) {
+	if t.AckSLO == nil || status.IsControl() {
+		return
+	}
+	t.mu.Lock()
+	sent, ok := t.sent[status.OrderID]
+	delete(t.sent, status.OrderID)
+	t.mu.Unlock()
+	if ok {
+		now := time.Now()
+		t.AckSLO.Observe(now.Sub(sent), now)
+	}
+}
+
+// Check counts orders still unacknowledged past the ack threshold as slow,
+// so a silent engine burns the budget too, then checks both objectives.
+func (t *Timed) Check(now time.Time) {
+	if t.AckSLO != nil {
+		limit := t.AckSLO.Objective().Threshold
+		var late int
+		t.mu.Lock()
+		for id, sent := range t.sent {
+			if now.Sub(sent) > limit {
+				delete(t.sent, id)
+				late++
+			}
+		}
+		t.mu.Unlock()
+		for range late {
+			t.AckSLO.record(false, now)
+		}
+		t.AckSLO.Check(now)
+	}
+	if t.EnqueueSLO != nil {
+		t.EnqueueSLO.Check(now)
+	}
+}
+
+// Run calls Check every interval until ctx is done.
+func (t *Timed) Run(ctx context.Context, every time.Duration) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case now := <-tick.C:
+			t.Check(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
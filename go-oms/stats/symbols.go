@@ -0,0 +1,154 @@
+// Package stats counts queue traffic per symbol, to see which instruments
+// dominate the ring, and exposes the counters as JSON and in the Prometheus
+// text format.
+package stats
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"oms/queue"
+)
+
+// MaxSymbols bounds the counters: symbol ids index a fixed array, and ids at
+// or above it share one overflow bucket, so memory never grows with traffic.
+const MaxSymbols = 1024
+
+// Other is the Symbol reported for the overflow bucket.
+const Other = MaxSymbols
+
+type counter struct {
+	enqueued atomic.Uint64
+	rejected atomic.Uint64
+	_        [48]byte // keep hot symbols off each other's cache lines
+}
+
+// Symbols holds the per-symbol counters. Observe is safe for concurrent use
+// and lock free.
+type Symbols struct {
+	counters [MaxSymbols + 1]counter
+
+	mu       sync.Mutex
+	last     [MaxSymbols + 1]uint64 // enqueued at the previous Snapshot
+	lastTime time.Time
+}
+
+func NewSymbols() *Symbols {
+	return &Symbols{lastTime: time.Now()}
+}
+
+// Observe records one enqueue attempt and its outcome. A full ring is not a
+// reject: the producer retries, and the attempt that lands is counted.
+func (s *Symbols) Observe(symbol uint32, err error) {
+	if errors.Is(err, queue.ErrQueueFull) {
+		return
+	}
+	c := &s.counters[min(symbol, Other)]
+	if err != nil {
+		c.rejected.Add(1)
+		return
+	}
+	c.enqueued.Add(1)
+}
+
+// SymbolStat is one symbol's counters. Rate is enqueues per second since
+// the previous Snapshot. Other marks the overflow bucket, whose Symbol is
+// Other but which counts every symbol id from MaxSymbols up.
+type SymbolStat struct {
+	Symbol   uint32  `json:"symbol"`
+	Other    bool    `json:"other,omitempty"`
+	Enqueued uint64  `json:"enqueued"`
+	Rejected uint64  `json:"rejected"`
+	Rate     float64 `json:"rate"`
+}
+
+// Snapshot returns every symbol with traffic, busiest first.
+func (s *Symbols) Snapshot(now time.Time) []SymbolStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := now.Sub(s.lastTime).Seconds()
+	s.lastTime = now
+
+	var out []SymbolStat
+	for i := range s.counters {
+		enq, rej := s.counters[i].enqueued.Load(), s.counters[i].rejected.Load()
+		if enq == 0 && rej == 0 {
+			continue
+		}
+		st := SymbolStat{Symbol: uint32(i), Other: i == Other, Enqueued: enq, Rejected: rej}
+		if elapsed > 0 {
+			st.Rate = float64(enq-s.last[i]) / elapsed
+		}
+		s.last[i] = enq
+		out = append(out, st)
+	}
+	slices.SortFunc(out, func(a, b SymbolStat) int { return cmp.Compare(b.Enqueued, a.Enqueued) })
+	return out
+}
+
+// WritePrometheus writes the counters in the Prometheus text format. Rates
+// are left to the server (rate() over the counters).
+func (s *Symbols) WritePrometheus(w io.Writer) error {
+	if _, err := io.WriteString(w, "# HELP oms_symbol_enqueued_total Orders enqueued per symbol.\n"+
+		"# TYPE oms_symbol_enqueued_total counter\n"); err != nil {
+		return err
+	}
+	s.each(func(label string, c *counter) {
+		if n := c.enqueued.Load(); n > 0 {
+			fmt.Fprintf(w, "oms_symbol_enqueued_total{symbol=%q} %d\n", label, n)
+		}
+	})
+	if _, err := io.WriteString(w, "# HELP oms_symbol_rejected_total Enqueue attempts rejected per symbol.\n"+
+		"# TYPE oms_symbol_rejected_total counter\n"); err != nil {
+		return err
+	}
+	s.each(func(label string, c *counter) {
+		if n := c.rejected.Load(); n > 0 {
+			fmt.Fprintf(w, "oms_symbol_rejected_total{symbol=%q} %d\n", label, n)
+		}
+	})
+	return nil
+}
+
+func (s *Symbols) each(fn func(label string, c *counter)) {
+	for i := range s.counters {
+		label := fmt.Sprint(i)
+		if i == Other {
+			label = "other"
+		}
+		fn(label, &s.counters[i])
+	}
+}
+
+// ServeHTTP serves the Prometheus text format, for a /metrics endpoint.
+func (s *Symbols) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = s.WritePrometheus(w)
+}
+
+// Counted wraps an order queue and records every Enqueue in Symbols.
+// Control messages are not counted: they are not symbol traffic. Wrap it
+// around the gates that refuse orders, such as risk.Guard, and anything
+// that fills them without the ring, such as cross.Internalizer, so those
+// orders count too.
+type Counted struct {
+	queue.OrderQueue
+	Symbols *Symbols
+}
+
+var _ queue.OrderQueue = (*Counted)(nil)
+
+func (c *Counted) Enqueue(order queue.Order) error {
+	err := c.OrderQueue.Enqueue(order)
+	if !order.IsControl() {
+		c.Symbols.Observe(order.Symbol, err)
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestObserve(t *testing.T) {
+	s := NewSymbols()
+	s.Observe(7, nil)
+	s.Observe(7, nil)
+	s.Observe(7, errors.New("risk"))
+	s.Observe(7, fmt.Errorf("wrapped: %w", queue.ErrQueueFull)) // retried, not a reject
+	s.Observe(MaxSymbols, nil)
+	s.Observe(1<<31, errors.New("refdata"))
+
+	got := s.Snapshot(time.Now())
+	want := []SymbolStat{
+		{Symbol: 7, Enqueued: 2, Rejected: 1},
+		{Symbol: Other, Other: true, Enqueued: 1, Rejected: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("snapshot %+v, want %+v", got, want)
+	}
+	for i := range want {
+		got[i].Rate = 0
+		if got[i] != want[i] {
+			t.Errorf("snapshot[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSnapshotRate(t *testing.T) {
+	s := NewSymbols()
+	start := time.Now()
+	s.Snapshot(start)
+	for range 4 {
+		s.Observe(1, nil)
+	}
+	for range 10 {
+		s.Observe(2, nil)
+	}
+	got := s.Snapshot(start.Add(2 * time.Second))
+	if len(got) != 2 || got[0].Symbol != 2 || got[1].Symbol != 1 {
+		t.Fatalf("snapshot %+v, want symbol 2 then 1", got)
+	}
+	if got[0].Rate != 5 || got[1].Rate != 2 {
+		t.Errorf("rates %v and %v, want 5 and 2", got[0].Rate, got[1].Rate)
+	}
+
+	// only what was enqueued since the last snapshot
+	s.Observe(1, nil)
+	got = s.Snapshot(start.Add(3 * time.Second))
+	for _, st := range got {
+		if want := map[uint32]float64{1: 1, 2: 0}[st.Symbol]; st.Rate != want {
+			t.Errorf("symbol %d: rate %v, want %v", st.Symbol, st.Rate, want)
+		}
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	s := NewSymbols()
+	s.Observe(3, nil)
+	s.Observe(3, errors.New("halted"))
+	s.Observe(5000, nil)
+	var b strings.Builder
+	if err := s.WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP oms_symbol_enqueued_total Orders enqueued per symbol.
+# TYPE oms_symbol_enqueued_total counter
+oms_symbol_enqueued_total{symbol="3"} 1
+oms_symbol_enqueued_total{symbol="other"} 1
+# HELP oms_symbol_rejected_total Enqueue attempts rejected per symbol.
+# TYPE oms_symbol_rejected_total counter
+oms_symbol_rejected_total{symbol="3"} 1
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// refusing rejects every new order, like a gate.
+type refusing struct{ *queue.MemQueue }
+
+func (r refusing) Enqueue(o queue.Order) error {
+	if o.IsControl() {
+		return r.MemQueue.Enqueue(o)
+	}
+	return errors.New("refused")
+}
+
+func TestCounted(t *testing.T) {
+	s := NewSymbols()
+	q := &Counted{OrderQueue: queue.NewInMemory(8), Symbols: s}
+	q.Enqueue(queue.Order{OrderID: 1, Symbol: 4})
+	q.Enqueue(queue.CancelAll(2, 7, 0))
+	q.Enqueue(queue.CancelAllSymbol(3, 4, 0))
+
+	refused := &Counted{OrderQueue: refusing{queue.NewInMemory(8)}, Symbols: s}
+	if err := refused.Enqueue(queue.Order{OrderID: 4, Symbol: 4}); err == nil {
+		t.Fatal("refusal not passed on")
+	}
+	refused.Enqueue(queue.Cancel(1, 7, 0))
+
+	got := s.Snapshot(time.Now())
+	if len(got) != 1 || got[0].Symbol != 4 || got[0].Enqueued != 1 || got[0].Rejected != 1 {
+		t.Errorf("snapshot %+v, want symbol 4 with one enqueued and one rejected", got)
+	}
+}
@@ -0,0 +1,208 @@
+// Package stops holds stop and stop-limit orders on the producer side and
+// releases them to the queue once a trade prints through their trigger. The
+// engine never sees a stop before it triggers, so cancelling one before then
+// is local, as with package scheduled.
+package stops
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"oms/queue"
+)
+
+var (
+	// ErrDuplicate is returned when an order id is already held.
+	ErrDuplicate = errors.New("stop order already held")
+	// ErrNotStop is returned by Add for an order without a trigger price.
+	ErrNotStop = errors.New("not a stop order")
+)
+
+type entry struct {
+	order    queue.Order
+	canceled bool
+}
+
+// side holds one side's stops in trigger order: buys ascending, so the
+// next to trigger on a rising price is first, and sells descending.
+type side struct {
+	stops []*entry
+	buy   bool
+}
+
+func (s *side) insert(e *entry) {
+	i, _ := slices.BinarySearchFunc(s.stops, e, func(a, b *entry) int {
+		c := cmp.Compare(a.order.TriggerPrice, b.order.TriggerPrice)
+		if !s.buy {
+			c = -c
+		}
+		if c == 0 {
+			// time priority among equal triggers
+			return cmp.Compare(a.order.OrderID, b.order.OrderID)
+		}
+		return c
+	})
+	s.stops = slices.Insert(s.stops, i, e)
+}
+
+// takeTriggered removes and returns the front run of stops a trade at price
+// sets off, skipping cancelled ones.
+func (s *side) takeTriggered(price uint64) []*entry {
+	n := 0
+	for n < len(s.stops) && (s.stops[n].canceled || s.stops[n].order.Triggered(price)) {
+		n++
+	}
+	out := slices.Clone(s.stops[:n])
+	s.stops = slices.Delete(s.stops, 0, n)
+	return out
+}
+
+type book struct {
+	buys, sells side
+	due         []*entry // triggered but not yet accepted by release
+}
+
+// Monitor watches last-trade prices and releases stops as they trigger.
+//
+// Monitor is safe for concurrent use: producers add and cancel while the
+// status reader feeds trades.
+type Monitor struct {
+	release func(queue.Order) error
+
+	// Report, when set, gets each stop as released, with StatusTriggered,
+	// so the OMS can show the transition the engine never reports.
+	Report func(queue.Order)
+
+	mu      sync.Mutex
+	books   map[uint32]*book
+	pending map[uint64]*entry
+	last    map[uint32]uint64 // last trade price per symbol
+}
+
+// NewMonitor returns a monitor that hands triggered stops to release. A stop
+// whose release fails stays due and is retried on the symbol's next trade.
+func NewMonitor(release func(queue.Order) error) *Monitor {
+	return &Monitor{
+		release: release,
+		books:   make(map[uint32]*book),
+		pending: make(map[uint64]*entry),
+		last:    make(map[uint32]uint64),
+	}
+}
+
+// Add holds a stop order until it triggers. A stop the last trade in its
+// symbol has already set off is only released on the next trade, so it
+// never goes out at a stale price.
+func (m *Monitor) Add(order queue.Order) error {
+	if !order.IsStop() {
+		return fmt.Errorf("%w: order %d", ErrNotStop, order.OrderID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, dup := m.pending[order.OrderID]; dup {
+		return fmt.Errorf("%w: %d", ErrDuplicate, order.OrderID)
+	}
+	e := &entry{order: order}
+	m.pending[order.OrderID] = e
+	b := m.book(order.Symbol)
+	if order.Side == 0 {
+		b.buys.insert(e)
+	} else {
+		b.sells.insert(e)
+	}
+	return nil
+}
+
+func (m *Monitor) book(symbol uint32) *book {
+	b, ok := m.books[symbol]
+	if !ok {
+		b = &book{buys: side{buy: true}}
+		m.books[symbol] = b
+	}
+	return b
+}
+
+// Cancel drops a stop before it triggers. It reports false if the order was
+// not held, e.g. already released.
+func (m *Monitor) Cancel(orderID uint64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.pending[orderID]
+	if ok {
+		e.canceled = true
+		delete(m.pending, orderID)
+	}
+	return ok
+}
+
+// Trade feeds a last-trade price and releases every stop in the symbol it
+// sets off. It returns how many it released, with the first release error
+// other than a full queue.
+func (m *Monitor) Trade(symbol uint32, price uint64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.last[symbol] = price
+	b, ok := m.books[symbol]
+	if !ok {
+		return 0, nil
+	}
+	b.due = append(b.due, b.buys.takeTriggered(price)...)
+	b.due = append(b.due, b.sells.takeTriggered(price)...)
+
+	released := 0
+	var firstErr error
+	retry := b.due[:0]
+	for _, e := range b.due {
+		if e.canceled {
+			continue
+		}
+		order := e.order
+		if order.Price == 0 {
+			order.Price = price
+		}
+		err := m.release(order)
+		if err != nil {
+			retry = append(retry, e)
+			if firstErr == nil && !errors.Is(err, queue.ErrQueueFull) {
+				firstErr = fmt.Errorf("release stop %d: %w", order.OrderID, err)
+			}
+			continue
+		}
+		delete(m.pending, order.OrderID)
+		released++
+		if m.Report != nil {
+			order.Status = queue.StatusTriggered
+			m.Report(order)
+		}
+	}
+	clear(b.due[len(retry):])
+	b.due = retry
+	return released, firstErr
+}
+
+// Observe feeds a status record: fills, partial fills and corrected fills
+// are trades at their price. Other records are ignored.
+func (m *Monitor) Observe(status queue.Order) (int, error) {
+	if !status.IsTrade() {
+		return 0, nil
+	}
+	return m.Trade(status.Symbol, status.Price)
+}
+
+// Last returns the last trade price seen in symbol.
+func (m *Monitor) Last(symbol uint32) (uint64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.last[symbol]
+	return p, ok
+}
+
+// Pending is the number of stops not yet released.
+func (m *Monitor) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.pending)
+}
@@ -0,0 +1,82 @@
+package stops
+
+import (
+	"errors"
+	"testing"
+
+	"oms/queue"
+)
+
+func TestReleaseOnTrigger(t *testing.T) {
+	q := queue.NewInMemory(4)
+	m := NewMonitor(q.Enqueue)
+	var reports []queue.Order
+	m.Report = func(o queue.Order) { reports = append(reports, o) }
+
+	for _, o := range []queue.Order{
+		{OrderID: 1, Symbol: 7, Side: 0, TriggerPrice: 105},             // buy stop
+		{OrderID: 2, Symbol: 7, Side: 0, TriggerPrice: 102, Price: 103}, // buy stop-limit
+		{OrderID: 3, Symbol: 7, Side: 1, TriggerPrice: 95},              // sell stop
+		{OrderID: 4, Symbol: 7, Side: 1, TriggerPrice: 98},
+	} {
+		if err := m.Add(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Add(queue.Order{OrderID: 1, Symbol: 7, TriggerPrice: 1}); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("duplicate: %v", err)
+	}
+	if err := m.Add(queue.Order{OrderID: 9, Price: 100}); !errors.Is(err, ErrNotStop) {
+		t.Fatalf("plain order: %v", err)
+	}
+	if !m.Cancel(4) || m.Cancel(4) {
+		t.Fatal("cancel should drop a held stop once")
+	}
+
+	for _, step := range []struct {
+		symbol uint32
+		price  uint64
+		want   []queue.Order // as released, in order
+	}{
+		{8, 200, nil}, // other symbol
+		{7, 100, nil},
+		{7, 103, []queue.Order{{OrderID: 2, Price: 103}}},
+		{7, 90, []queue.Order{{OrderID: 3, Price: 90}}}, // plain stop takes the trade price
+		{7, 110, []queue.Order{{OrderID: 1, Price: 110}}},
+	} {
+		if _, err := m.Trade(step.symbol, step.price); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range step.want {
+			o, _ := q.Dequeue()
+			if o == nil || o.OrderID != want.OrderID || o.Price != want.Price {
+				t.Fatalf("trade %d@%d: got %+v, want order %d at %d", step.symbol, step.price, o, want.OrderID, want.Price)
+			}
+		}
+		if q.Depth() != 0 {
+			t.Fatalf("trade %d@%d: %d unexpected releases", step.symbol, step.price, q.Depth())
+		}
+	}
+	if m.Pending() != 0 || len(reports) != 3 || reports[0].Status != queue.StatusTriggered {
+		t.Fatalf("pending %d, reports %+v", m.Pending(), reports)
+	}
+}
+
+func TestRetryWhenFull(t *testing.T) {
+	q := queue.NewInMemory(1)
+	m := NewMonitor(q.Enqueue)
+	for id := uint64(1); id <= 2; id++ {
+		m.Add(queue.Order{OrderID: id, Symbol: 1, TriggerPrice: 10, Price: 10})
+	}
+	if n, err := m.Observe(queue.Order{Symbol: 1, Price: 10, Status: queue.StatusFilled}); n != 1 || err != nil {
+		t.Fatalf("released %d, %v", n, err)
+	}
+	q.Dequeue()
+	// the price has moved away, but a triggered stop still goes out
+	if n, err := m.Trade(1, 5); n != 1 || err != nil {
+		t.Fatalf("retry released %d, %v", n, err)
+	}
+	if o, _ := q.Dequeue(); o == nil || o.OrderID != 2 || m.Pending() != 0 {
+		t.Fatalf("got %+v, %d pending", o, m.Pending())
+	}
+}
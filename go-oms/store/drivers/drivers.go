@@ -0,0 +1,12 @@
+// Package drivers links the database/sql drivers store.Open uses into a
+// binary: SQLite (github.com/mattn/go-sqlite3, registered as sqlite3, which
+// needs cgo) and Postgres (github.com/lib/pq, registered as postgres).
+// Import it for its side effect in any command taking a -store spec:
+//
+//	import _ "oms/store/drivers"
+package drivers
+
+import (
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
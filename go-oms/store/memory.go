@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+// Memory keeps the history in the process, for tests and for running
+// without a database; it is gone when the process exits.
+type Memory struct {
+	mu         sync.Mutex
+	orders     []Record
+	executions []Record
+}
+
+var _ Backend = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Write(ctx context.Context, orders, executions []Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.orders = append(m.orders, orders...)
+	m.executions = append(m.executions, executions...)
+	return nil
+}
+
+func (m *Memory) Summary(ctx context.Context, from, to time.Time) ([]Summary, error) {
+	type key struct{ client, symbol uint32 }
+	byKey := make(map[key]*Summary)
+	get := func(r Record) *Summary {
+		k := key{r.ClientID, r.Symbol}
+		s, ok := byKey[k]
+		if !ok {
+			s = &Summary{ClientID: r.ClientID, Symbol: r.Symbol}
+			byKey[k] = s
+		}
+		return s
+	}
+	in := func(r Record) bool { return !r.At.Before(from) && r.At.Before(to) }
+
+	m.mu.Lock()
+	for _, r := range m.orders {
+		if in(r) && r.MsgType == queue.MsgNew {
+			get(r).Orders++
+		}
+	}
+	for _, r := range m.executions {
+		if in(r) && r.MsgType == queue.MsgNew {
+			get(r).addExecution(r)
+		}
+	}
+	m.mu.Unlock()
+
+	sums := make([]Summary, 0, len(byKey))
+	for _, s := range byKey {
+		sums = append(sums, *s)
+	}
+	sortSummaries(sums)
+	return sums, nil
+}
+
+func (m *Memory) Orders(ctx context.Context, q Query) (Page, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := make(map[uint64]uint8)
+	for _, r := range m.executions {
+		if r.MsgType == queue.MsgNew {
+			status[r.OrderID] = r.Status
+		}
+	}
+	var page Page
+	limit := q.limit()
+	for i, r := range m.orders {
+		o := OrderState{Seq: uint64(i + 1), Record: r}
+		o.Status = status[r.OrderID]
+		o.State = StateName(o.Status)
+		if !q.matches(o) {
+			continue
+		}
+		if len(page.Orders) == limit {
+			page.Next = page.Orders[limit-1].Seq
+			break
+		}
+		page.Orders = append(page.Orders, o)
+	}
+	return page, nil
+}
+
+func (m *Memory) Executions(ctx context.Context, orderID uint64) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Record
+	for _, r := range m.executions {
+		if r.OrderID == orderID {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) EachExecution(ctx context.Context, from, to time.Time, fn func(Record) error) error {
+	m.mu.Lock()
+	var in []Record
+	for _, r := range m.executions {
+		if !r.At.Before(from) && r.At.Before(to) {
+			in = append(in, r)
+		}
+	}
+	m.mu.Unlock()
+	for _, r := range in {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Close() error { return nil }
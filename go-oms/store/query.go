@@ -0,0 +1,89 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"oms/queue"
+)
+
+// stateNames names an order's state after its latest execution report.
+var stateNames = map[uint8]string{
+	queue.StatusPending:   "pending",
+	queue.StatusFilled:    "filled",
+	queue.StatusPartial:   "partially_filled",
+	queue.StatusRejected:  "rejected",
+	queue.StatusExpired:   "expired",
+	queue.StatusCanceled:  "canceled",
+	queue.StatusBusted:    "busted",
+	queue.StatusCorrected: "corrected",
+}
+
+// StateName names a status as an order state, "pending" before any report.
+func StateName(status uint8) string {
+	if name, ok := stateNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("status(%d)", status)
+}
+
+// ParseState is the status a state name stands for.
+func ParseState(name string) (uint8, error) {
+	for status, n := range stateNames {
+		if n == name {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown order state %q", name)
+}
+
+// MaxLimit bounds Query.Limit; DefaultLimit is used when it is 0.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Query selects stored orders, new orders only, oldest first. Nil and
+// zero fields match everything.
+type Query struct {
+	ClientID *uint32
+	Symbol   *uint32
+	From, To time.Time // accepted in [From, To)
+	State    *uint8    // status of the latest execution report, StatusPending for none
+	After    uint64    // Page.Next of the previous page
+	Limit    int       // orders per page, up to MaxLimit
+}
+
+func (q *Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultLimit
+	case q.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return q.Limit
+}
+
+func (q *Query) matches(o OrderState) bool {
+	return o.MsgType == queue.MsgNew && o.Seq > q.After &&
+		(q.ClientID == nil || o.ClientID == *q.ClientID) &&
+		(q.Symbol == nil || o.Symbol == *q.Symbol) &&
+		(q.From.IsZero() || !o.At.Before(q.From)) &&
+		(q.To.IsZero() || o.At.Before(q.To)) &&
+		(q.State == nil || o.Status == *q.State)
+}
+
+// OrderState is a stored order with its Status set from its latest
+// execution report; State names it.
+type OrderState struct {
+	Seq uint64 // position in the history, what Query.After pages by
+	Record
+	State string
+}
+
+// Page is one page of a Query. Next is the Query.After for the page after
+// it, 0 on the last page.
+type Page struct {
+	Orders []OrderState
+	Next   uint64
+}
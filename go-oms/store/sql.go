@@ -0,0 +1,381 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"oms/queue"
+)
+
+// Dialect is the SQL flavour of a database.
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+// DialectOf maps a database/sql driver name to its dialect.
+func DialectOf(driver string) (Dialect, error) {
+	switch driver {
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "pgx":
+		return Postgres, nil
+	}
+	return 0, fmt.Errorf("store: driver %q is neither SQLite (sqlite, sqlite3) nor Postgres (postgres, pgx)", driver)
+}
+
+// SQL keeps the history in two tables, orders and executions, created if
+// missing. Times are unix nanoseconds.
+type SQL struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var _ Backend = (*SQL)(nil)
+
+// Open opens spec, "driver:dsn", e.g. "sqlite:/var/lib/oms/history.db" or
+// "pgx:postgres://oms@db/oms". A driver must be linked into the binary with
+// a blank import, as database/sql requires; package oms/store/drivers links
+// one per dialect. Either name of a dialect opens whichever of its drivers
+// is linked, so "sqlite:" works with sqlite3 and "pgx:" with postgres.
+func Open(spec string) (*SQL, error) {
+	driver, dsn, ok := strings.Cut(spec, ":")
+	if !ok || dsn == "" {
+		return nil, fmt.Errorf("store: %q is not driver:dsn", spec)
+	}
+	dialect, err := DialectOf(driver)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(linked(driver, dialect), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+	s, err := NewSQL(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// linked returns driver if it is registered, else a registered driver of
+// the same dialect, else driver, for sql.Open to report as unknown.
+func linked(driver string, dialect Dialect) string {
+	names := sql.Drivers()
+	if slices.Contains(names, driver) {
+		return driver
+	}
+	for _, name := range names {
+		if d, err := DialectOf(name); err == nil && d == dialect {
+			return name
+		}
+	}
+	return driver
+}
+
+// NewSQL uses db, creating the tables and indexes if missing.
+func NewSQL(db *sql.DB, dialect Dialect) (*SQL, error) {
+	s := &SQL{db: db, dialect: dialect}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, stmt := range s.schema() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("store: create schema: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// The columns of each table besides seq, in insert order.
+var (
+	orderColumns     = []string{"order_id", "client_id", "symbol", "side", "msg_type", "qty", "price", "tif", "flags", "trigger_price", "expire_at", "ts", "at"}
+	executionColumns = []string{"order_id", "client_id", "symbol", "side", "msg_type", "status", "qty", "price", "reason", "liquidity", "fee", "contra_client_id", "ts", "at"}
+)
+
+func (s *SQL) schema() []string {
+	seq := "seq INTEGER PRIMARY KEY AUTOINCREMENT"
+	if s.dialect == Postgres {
+		seq = "seq BIGSERIAL PRIMARY KEY"
+	}
+	columns := func(names []string) string {
+		cols := make([]string, len(names))
+		for i, name := range names {
+			cols[i] = name + " BIGINT NOT NULL"
+		}
+		return strings.Join(cols, ", ")
+	}
+	return []string{
+		"CREATE TABLE IF NOT EXISTS orders (" + seq + ", " + columns(orderColumns) + ")",
+		"CREATE TABLE IF NOT EXISTS executions (" + seq + ", " + columns(executionColumns) + ")",
+		"CREATE INDEX IF NOT EXISTS orders_client_at ON orders (client_id, at)",
+		"CREATE INDEX IF NOT EXISTS orders_symbol_at ON orders (symbol, at)",
+		"CREATE INDEX IF NOT EXISTS orders_at ON orders (at)",
+		"CREATE INDEX IF NOT EXISTS orders_order_id ON orders (order_id)",
+		"CREATE INDEX IF NOT EXISTS executions_client_at ON executions (client_id, at)",
+		"CREATE INDEX IF NOT EXISTS executions_symbol_at ON executions (symbol, at)",
+		"CREATE INDEX IF NOT EXISTS executions_at ON executions (at)",
+		"CREATE INDEX IF NOT EXISTS executions_order_id ON executions (order_id)",
+	}
+}
+
+// insert is the statement adding one row to table.
+func (s *SQL) insert(table string, columns []string) string {
+	marks := make([]string, len(columns))
+	for i := range marks {
+		marks[i] = s.placeholder(i + 1)
+	}
+	return "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(marks, ", ") + ")"
+}
+
+func (s *SQL) placeholder(n int) string {
+	if s.dialect == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// Order ids, prices and times are uint64 on the ring; BIGINT holds them
+// as int64, which database/sql requires anyway.
+func orderArgs(r Record) []any {
+	return []any{int64(r.OrderID), int64(r.ClientID), int64(r.Symbol), int64(r.Side), int64(r.MsgType),
+		int64(r.Quantity), int64(r.Price), int64(r.TimeInForce), int64(r.Flags), int64(r.TriggerPrice),
+		int64(r.ExpireAt), int64(r.Timestamp), r.At.UnixNano()}
+}
+
+func executionArgs(r Record) []any {
+	return []any{int64(r.OrderID), int64(r.ClientID), int64(r.Symbol), int64(r.Side), int64(r.MsgType),
+		int64(r.Status), int64(r.Quantity), int64(r.Price), int64(r.Reason), int64(r.Liquidity),
+		int64(r.Fee), int64(r.ContraClientID), int64(r.Timestamp), r.At.UnixNano()}
+}
+
+func (s *SQL) Write(ctx context.Context, orders, executions []Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := insertAll(ctx, tx, s.insert("orders", orderColumns), orders, orderArgs); err != nil {
+		return fmt.Errorf("insert orders: %w", err)
+	}
+	if err := insertAll(ctx, tx, s.insert("executions", executionColumns), executions, executionArgs); err != nil {
+		return fmt.Errorf("insert executions: %w", err)
+	}
+	return tx.Commit()
+}
+
+func insertAll(ctx context.Context, tx *sql.Tx, query string, recs []Record, args func(Record) []any) error {
+	if len(recs) == 0 {
+		return nil
+	}
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range recs {
+		if _, err := stmt.ExecContext(ctx, args(r)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQL) Summary(ctx context.Context, from, to time.Time) ([]Summary, error) {
+	type key struct{ client, symbol uint32 }
+	byKey := make(map[key]*Summary)
+	get := func(client, symbol int64) *Summary {
+		k := key{uint32(client), uint32(symbol)}
+		sum, ok := byKey[k]
+		if !ok {
+			sum = &Summary{ClientID: k.client, Symbol: k.symbol}
+			byKey[k] = sum
+		}
+		return sum
+	}
+	p1, p2 := s.placeholder(1), s.placeholder(2)
+
+	rows, err := s.db.QueryContext(ctx, "SELECT client_id, symbol, COUNT(*) FROM orders"+
+		" WHERE at >= "+p1+" AND at < "+p2+" AND msg_type = "+strconv.Itoa(int(queue.MsgNew))+
+		" GROUP BY client_id, symbol", from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var client, symbol int64
+		var n uint64
+		if err := rows.Scan(&client, &symbol, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		get(client, symbol).Orders = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the same arithmetic as Summary.addExecution, in SQL
+	when := func(status uint8, then string) string {
+		return "COALESCE(SUM(CASE WHEN status = " + strconv.Itoa(int(status)) + " THEN " + then + " ELSE 0 END), 0)"
+	}
+	fills := "COALESCE(SUM(CASE WHEN status IN (" + strconv.Itoa(int(queue.StatusFilled)) + ", " +
+		strconv.Itoa(int(queue.StatusPartial)) + ") THEN 1 ELSE 0 END), 0)"
+	signed := func(expr string) string {
+		return "COALESCE(SUM(CASE WHEN status IN (" + strconv.Itoa(int(queue.StatusFilled)) + ", " +
+			strconv.Itoa(int(queue.StatusPartial)) + ", " +
+			strconv.Itoa(int(queue.StatusCorrected)) + ") THEN " + expr + " WHEN status = " +
+			strconv.Itoa(int(queue.StatusBusted)) + " THEN -(" + expr + ") ELSE 0 END), 0)"
+	}
+	rows, err = s.db.QueryContext(ctx, "SELECT client_id, symbol, "+
+		fills+", "+signed("qty")+", "+signed("qty * price")+", "+signed("fee")+", "+
+		when(queue.StatusCanceled, "1")+", "+when(queue.StatusRejected, "1")+", "+
+		when(queue.StatusExpired, "1")+", "+when(queue.StatusBusted, "1")+
+		" FROM executions WHERE at >= "+p1+" AND at < "+p2+" AND msg_type = "+strconv.Itoa(int(queue.MsgNew))+
+		" GROUP BY client_id, symbol", from.UnixNano(), to.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var client, symbol int64
+		var e Summary
+		if err := rows.Scan(&client, &symbol, &e.Fills, &e.FilledQty, &e.Notional, &e.Fees,
+			&e.Canceled, &e.Rejected, &e.Expired, &e.Busts); err != nil {
+			return nil, err
+		}
+		sum := get(client, symbol)
+		e.ClientID, e.Symbol, e.Orders = sum.ClientID, sum.Symbol, sum.Orders
+		*sum = e
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sums := make([]Summary, 0, len(byKey))
+	for _, sum := range byKey {
+		sums = append(sums, *sum)
+	}
+	sortSummaries(sums)
+	return sums, nil
+}
+
+// latestStatus is an order's state in SQL, as Memory.Orders works it out.
+const latestStatus = "COALESCE((SELECT e.status FROM executions e WHERE e.order_id = o.order_id" +
+	" AND e.msg_type = 0 ORDER BY e.seq DESC LIMIT 1), 0)"
+
+func (s *SQL) Orders(ctx context.Context, q Query) (Page, error) {
+	var where []string
+	var args []any
+	cond := func(expr string, arg any) {
+		args = append(args, arg)
+		where = append(where, expr+" "+s.placeholder(len(args)))
+	}
+	cond("o.msg_type =", int64(queue.MsgNew))
+	cond("o.seq >", int64(q.After))
+	if q.ClientID != nil {
+		cond("o.client_id =", int64(*q.ClientID))
+	}
+	if q.Symbol != nil {
+		cond("o.symbol =", int64(*q.Symbol))
+	}
+	if !q.From.IsZero() {
+		cond("o.at >=", q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		cond("o.at <", q.To.UnixNano())
+	}
+	if q.State != nil {
+		cond(latestStatus+" =", int64(*q.State))
+	}
+	limit := q.limit()
+	cols := make([]string, len(orderColumns))
+	for i, c := range orderColumns {
+		cols[i] = "o." + c
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT o.seq, "+strings.Join(cols, ", ")+", "+latestStatus+
+		" FROM orders o WHERE "+strings.Join(where, " AND ")+
+		" ORDER BY o.seq LIMIT "+strconv.Itoa(limit+1), args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+	var page Page
+	for rows.Next() {
+		var v [15]int64
+		dest := make([]any, len(v))
+		for i := range v {
+			dest[i] = &v[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return Page{}, err
+		}
+		if len(page.Orders) == limit {
+			page.Next = page.Orders[limit-1].Seq
+			break
+		}
+		o := OrderState{Seq: uint64(v[0]), Record: Record{Order: queue.Order{
+			OrderID: uint64(v[1]), ClientID: uint32(v[2]), Symbol: uint32(v[3]), Side: uint8(v[4]),
+			MsgType: uint8(v[5]), Quantity: uint32(v[6]), Price: uint64(v[7]), TimeInForce: uint8(v[8]),
+			Flags: uint8(v[9]), TriggerPrice: uint32(v[10]), ExpireAt: uint64(v[11]), Timestamp: uint64(v[12]),
+			Status: uint8(v[14]),
+		}, At: time.Unix(0, v[13])}}
+		o.State = StateName(o.Status)
+		page.Orders = append(page.Orders, o)
+	}
+	return page, rows.Err()
+}
+
+func (s *SQL) Executions(ctx context.Context, orderID uint64) ([]Record, error) {
+	var out []Record
+	err := s.eachExecution(ctx, "order_id = "+s.placeholder(1), []any{int64(orderID)}, func(r Record) error {
+		out = append(out, r)
+		return nil
+	})
+	return out, err
+}
+
+func (s *SQL) EachExecution(ctx context.Context, from, to time.Time, fn func(Record) error) error {
+	return s.eachExecution(ctx, "at >= "+s.placeholder(1)+" AND at < "+s.placeholder(2),
+		[]any{from.UnixNano(), to.UnixNano()}, fn)
+}
+
+// eachExecution scans the status records matching where, oldest first.
+func (s *SQL) eachExecution(ctx context.Context, where string, args []any, fn func(Record) error) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+strings.Join(executionColumns, ", ")+
+		" FROM executions WHERE "+where+" ORDER BY seq", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v [14]int64
+		dest := make([]any, len(v))
+		for i := range v {
+			dest[i] = &v[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err := fn(Record{Order: queue.Order{
+			OrderID: uint64(v[0]), ClientID: uint32(v[1]), Symbol: uint32(v[2]), Side: uint8(v[3]),
+			MsgType: uint8(v[4]), Status: uint8(v[5]), Quantity: uint32(v[6]), Price: uint64(v[7]),
+			Reason: uint8(v[8]), Liquidity: uint8(v[9]), Fee: int32(v[10]), ContraClientID: uint32(v[11]),
+			Timestamp: uint64(v[12]),
+		}, At: time.Unix(0, v[13])}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
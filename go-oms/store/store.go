@@ -0,0 +1,261 @@
+// Package store persists the order and execution history: every order
+// accepted onto the ring and every record off the status ring, for
+// historical queries and end-of-day reports. The backend is pluggable; SQL
+// keeps the history in SQLite or Postgres, Memory in the process.
+//
+// As with package mirror, the trading path never waits on the database: a
+// Writer buffers records and one goroutine writes them in batches, one
+// transaction each. A full buffer drops records and counts them, leaving a
+// gap in the history rather than stalling the broker.
+package store
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"oms/queue"
+)
+
+// Record is an order or status record as it crossed the broker.
+type Record struct {
+	queue.Order
+	At time.Time // when the broker accepted the order or read the status
+}
+
+// Summary is one client's activity in one symbol over a period, from its
+// orders and their execution reports; control messages are not counted.
+// Busts reverse fills and corrections replace them, so
+// FilledQty, Notional and Fees are net of both.
+type Summary struct {
+	ClientID  uint32 `json:"client_id"`
+	Symbol    uint32 `json:"symbol"`
+	Orders    uint64 `json:"orders"` // new orders accepted
+	Fills     uint64 `json:"fills"`
+	FilledQty int64  `json:"filled_qty"`
+	Notional  int64  `json:"notional"` // price × quantity over fills
+	Fees      int64  `json:"fees"`
+	Canceled  uint64 `json:"canceled"`
+	Rejected  uint64 `json:"rejected"`
+	Expired   uint64 `json:"expired"`
+	Busts     uint64 `json:"busts"`
+}
+
+// addExecution counts one status record into s.
+func (s *Summary) addExecution(r Record) {
+	qty, notional := int64(r.Quantity), int64(r.Quantity)*int64(r.Price)
+	switch r.Status {
+	case queue.StatusFilled, queue.StatusPartial:
+		s.Fills++
+		s.FilledQty += qty
+		s.Notional += notional
+		s.Fees += int64(r.Fee)
+	case queue.StatusCorrected:
+		s.FilledQty += qty
+		s.Notional += notional
+		s.Fees += int64(r.Fee)
+	case queue.StatusBusted:
+		s.Busts++
+		s.FilledQty -= qty
+		s.Notional -= notional
+		s.Fees -= int64(r.Fee)
+	case queue.StatusCanceled:
+		s.Canceled++
+	case queue.StatusRejected:
+		s.Rejected++
+	case queue.StatusExpired:
+		s.Expired++
+	}
+}
+
+// sortSummaries orders by client, then symbol.
+func sortSummaries(sums []Summary) {
+	slices.SortFunc(sums, func(a, b Summary) int {
+		return cmp.Or(cmp.Compare(a.ClientID, b.ClientID), cmp.Compare(a.Symbol, b.Symbol))
+	})
+}
+
+// Backend stores records. Write is all or nothing.
+type Backend interface {
+	Write(ctx context.Context, orders, executions []Record) error
+	// Summary reports every client and symbol with records in [from, to),
+	// ordered by client, then symbol.
+	Summary(ctx context.Context, from, to time.Time) ([]Summary, error)
+	// Orders returns a page of the orders q selects.
+	Orders(ctx context.Context, q Query) (Page, error)
+	// Executions returns every status record for an order, oldest first.
+	Executions(ctx context.Context, orderID uint64) ([]Record, error)
+	// EachExecution calls fn with every status record in [from, to),
+	// oldest first, stopping at fn's first error.
+	EachExecution(ctx context.Context, from, to time.Time, fn func(Record) error) error
+	Close() error
+}
+
+// WriterConfig tunes a Writer; zero values take the defaults.
+type WriterConfig struct {
+	Buffer  int           // records held while writing; default 65536
+	Batch   int           // most records per transaction; default 1000
+	Linger  time.Duration // longest a record waits for its batch to fill; default 100ms
+	Retries int           // further attempts at a failed batch; default 3, negative for none
+}
+
+func (c *WriterConfig) defaults() {
+	if c.Buffer <= 0 {
+		c.Buffer = 65536
+	}
+	if c.Batch <= 0 {
+		c.Batch = 1000
+	}
+	if c.Linger <= 0 {
+		c.Linger = 100 * time.Millisecond
+	}
+	switch {
+	case c.Retries == 0:
+		c.Retries = 3
+	case c.Retries < 0:
+		c.Retries = 0
+	}
+}
+
+type pending struct {
+	execution bool
+	rec       Record
+}
+
+// Stats counts records by what became of them.
+type Stats struct {
+	Written uint64
+	Dropped uint64 // buffer full
+	Failed  uint64 // write failed after every retry
+}
+
+// Writer buffers records for a Backend. Order and Execution are safe for
+// concurrent use and never block; Run does the writing.
+type Writer struct {
+	b       Backend
+	cfg     WriterConfig
+	records chan pending
+
+	written, dropped, failed atomic.Uint64
+}
+
+func NewWriter(b Backend, cfg WriterConfig) *Writer {
+	cfg.defaults()
+	return &Writer{b: b, cfg: cfg, records: make(chan pending, cfg.Buffer)}
+}
+
+// Order records an order the ring accepted.
+func (w *Writer) Order(o queue.Order) { w.add(false, o) }
+
+// Execution records a record from the status ring.
+func (w *Writer) Execution(o queue.Order) { w.add(true, o) }
+
+func (w *Writer) add(execution bool, o queue.Order) {
+	select {
+	case w.records <- pending{execution: execution, rec: Record{Order: o, At: time.Now()}}:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+func (w *Writer) Stats() Stats {
+	return Stats{Written: w.written.Load(), Dropped: w.dropped.Load(), Failed: w.failed.Load()}
+}
+
+// Run writes batches until ctx is done, then writes what is still
+// buffered, giving up on it after ten seconds.
+func (w *Writer) Run(ctx context.Context) {
+	var batch []pending
+	linger := time.NewTimer(w.cfg.Linger)
+	linger.Stop()
+	var lastDropped uint64
+	flush := func(ctx context.Context) {
+		if len(batch) > 0 {
+			w.write(ctx, batch)
+			batch = batch[:0]
+		}
+		if d := w.dropped.Load(); d != lastDropped {
+			log.Printf("[STORE] %d records dropped with the buffer full", d-lastDropped)
+			lastDropped = d
+		}
+	}
+	for {
+		select {
+		case p := <-w.records:
+			if len(batch) == 0 {
+				linger.Reset(w.cfg.Linger)
+			}
+			batch = append(batch, p)
+			if len(batch) >= w.cfg.Batch {
+				linger.Stop()
+				flush(ctx)
+			}
+		case <-linger.C:
+			flush(ctx)
+		case <-ctx.Done():
+			drain, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			for {
+				select {
+				case p := <-w.records:
+					batch = append(batch, p)
+					if len(batch) >= w.cfg.Batch {
+						flush(drain)
+					}
+				default:
+					flush(drain)
+					return
+				}
+			}
+		}
+	}
+}
+
+// write stores a batch in one transaction, retrying with backoff.
+func (w *Writer) write(ctx context.Context, batch []pending) {
+	var orders, executions []Record
+	for _, p := range batch {
+		if p.execution {
+			executions = append(executions, p.rec)
+		} else {
+			orders = append(orders, p.rec)
+		}
+	}
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := w.b.Write(ctx, orders, executions)
+		if err == nil {
+			w.written.Add(uint64(len(batch)))
+			return
+		}
+		if attempt == w.cfg.Retries || ctx.Err() != nil {
+			log.Printf("[STORE] %d records lost: %v", len(batch), err)
+			w.failed.Add(uint64(len(batch)))
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+		backoff *= 2
+	}
+}
+
+// Queue wraps an order queue and records every order it accepts.
+type Queue struct {
+	queue.OrderQueue
+	Writer *Writer
+}
+
+var _ queue.OrderQueue = (*Queue)(nil)
+
+func (q *Queue) Enqueue(order queue.Order) error {
+	if err := q.OrderQueue.Enqueue(order); err != nil {
+		return err
+	}
+	q.Writer.Order(order)
+	return nil
+}
@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"oms/queue"
+	_ "oms/store/drivers"
+)
+
+func TestWriterSummary(t *testing.T) {
+	mem := NewMemory()
+	w := NewWriter(mem, WriterConfig{Batch: 3, Linger: time.Millisecond})
+	ring := &Queue{OrderQueue: queue.NewInMemory(8), Writer: w}
+	for _, o := range []queue.Order{
+		{OrderID: 1, ClientID: 7, Symbol: 1, Quantity: 10, Price: 100},
+		{OrderID: 2, ClientID: 7, Symbol: 1, Quantity: 5, Price: 101},
+		{OrderID: 3, ClientID: 9, Symbol: 2, Quantity: 1, Price: 50},
+		queue.Cancel(2, 7, 0),
+	} {
+		if err := ring.Enqueue(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range []queue.Order{
+		{OrderID: 1, ClientID: 7, Symbol: 1, Quantity: 10, Price: 100, Fee: 3, Status: queue.StatusFilled},
+		{OrderID: 2, ClientID: 7, Symbol: 1, Quantity: 5, Price: 101, Status: queue.StatusCanceled},
+		{OrderID: 2, ClientID: 7, MsgType: queue.MsgCancel, Status: queue.StatusAcked},
+		{OrderID: 3, ClientID: 9, Symbol: 2, Quantity: 1, Price: 50, Fee: 1, Status: queue.StatusFilled},
+		// the fill of 3 busted and corrected to 1 @ 49
+		{OrderID: 3, ClientID: 9, Symbol: 2, Quantity: 1, Price: 50, Fee: 1, Status: queue.StatusBusted},
+		{OrderID: 3, ClientID: 9, Symbol: 2, Quantity: 1, Price: 49, Fee: 1, Status: queue.StatusCorrected},
+	} {
+		w.Execution(s)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done
+	if s := w.Stats(); s.Written != 10 || s.Dropped != 0 || s.Failed != 0 {
+		t.Fatalf("stats %+v", s)
+	}
+
+	sums, err := mem.Summary(context.Background(), time.Now().Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Summary{
+		{ClientID: 7, Symbol: 1, Orders: 2, Fills: 1, FilledQty: 10, Notional: 1000, Fees: 3, Canceled: 1},
+		{ClientID: 9, Symbol: 2, Orders: 1, Fills: 1, FilledQty: 1, Notional: 49, Fees: 1, Busts: 1},
+	}
+	if len(sums) != len(want) {
+		t.Fatalf("summaries %+v", sums)
+	}
+	for i := range want {
+		if sums[i] != want[i] {
+			t.Errorf("summary %d: got %+v, want %+v", i, sums[i], want[i])
+		}
+	}
+	if sums, _ := mem.Summary(context.Background(), time.Now(), time.Now().Add(time.Hour)); len(sums) != 0 {
+		t.Fatalf("summaries outside the period: %+v", sums)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	mem := NewMemory()
+	start := time.Now()
+	var orders, execs []Record
+	for i := range 10 {
+		o := queue.Order{OrderID: uint64(i + 1), ClientID: uint32(7 + i%2), Symbol: 1, Quantity: 1, Price: 100}
+		orders = append(orders, Record{Order: o, At: start.Add(time.Duration(i) * time.Second)})
+		if i%3 == 0 {
+			o.Status = queue.StatusFilled
+			execs = append(execs, Record{Order: o, At: start.Add(time.Duration(i) * time.Second)})
+		}
+	}
+	// order 4 filled, then busted
+	busted := execs[1]
+	busted.Status = queue.StatusBusted
+	execs = append(execs, busted)
+	orders = append(orders, Record{Order: queue.Cancel(2, 8, 0), At: start})
+	if err := mem.Write(context.Background(), orders, execs); err != nil {
+		t.Fatal(err)
+	}
+
+	// client 7 has orders 1, 3, 5, 7, 9: pages of two
+	client := uint32(7)
+	var ids []uint64
+	q := Query{ClientID: &client, Limit: 2}
+	for pages := 0; ; pages++ {
+		page, err := mem.Orders(context.Background(), q)
+		if err != nil || pages > 3 {
+			t.Fatalf("page %d: %+v, %v", pages, page, err)
+		}
+		for _, o := range page.Orders {
+			ids = append(ids, o.OrderID)
+		}
+		if page.Next == 0 {
+			break
+		}
+		q.After = page.Next
+	}
+	if fmt.Sprint(ids) != "[1 3 5 7 9]" {
+		t.Fatalf("client 7 orders %v", ids)
+	}
+
+	filled := queue.StatusFilled
+	page, _ := mem.Orders(context.Background(), Query{State: &filled, From: start.Add(time.Second), To: start.Add(9 * time.Second)})
+	if len(page.Orders) != 1 || page.Orders[0].OrderID != 7 || page.Orders[0].State != "filled" {
+		t.Fatalf("filled in (1s, 9s] %+v", page.Orders)
+	}
+	bust, _ := ParseState("busted")
+	if page, _ := mem.Orders(context.Background(), Query{State: &bust}); len(page.Orders) != 1 || page.Orders[0].OrderID != 4 {
+		t.Fatalf("busted %+v", page.Orders)
+	}
+	if recs, _ := mem.Executions(context.Background(), 4); len(recs) != 2 || recs[1].Status != queue.StatusBusted {
+		t.Fatalf("executions of 4: %+v", recs)
+	}
+	var day []uint64
+	mem.EachExecution(context.Background(), start, start.Add(4*time.Second), func(r Record) error {
+		day = append(day, r.OrderID)
+		return nil
+	})
+	if fmt.Sprint(day) != "[1 4 4]" {
+		t.Fatalf("executions in [0s, 4s) %v", day)
+	}
+	if _, err := ParseState("done"); err == nil {
+		t.Fatal("unknown state parsed")
+	}
+}
+
+// recorder is a database/sql driver that records every statement run
+// through it; queries return no rows.
+type recorder struct {
+	mu        sync.Mutex
+	execs     []string
+	queries   []string
+	commits   int
+	rollbacks int
+}
+
+func (r *recorder) Open(string) (driver.Conn, error) { return &recConn{r}, nil }
+
+type recConn struct{ r *recorder }
+
+func (c *recConn) Prepare(query string) (driver.Stmt, error) { return &recStmt{c.r, query}, nil }
+func (c *recConn) Close() error                              { return nil }
+func (c *recConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *recConn) Commit() error                             { c.r.mu.Lock(); c.r.commits++; c.r.mu.Unlock(); return nil }
+func (c *recConn) Rollback() error                           { c.r.mu.Lock(); c.r.rollbacks++; c.r.mu.Unlock(); return nil }
+
+type recStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s *recStmt) Close() error  { return nil }
+func (s *recStmt) NumInput() int { return -1 }
+func (s *recStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	if n := strings.Count(s.query, "?") + strings.Count(s.query, "$"); n != len(args) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	s.r.execs = append(s.r.execs, s.query)
+	return driver.RowsAffected(1), nil
+}
+func (s *recStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	if n := strings.Count(s.query, "?") + strings.Count(s.query, "$"); n != len(args) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	s.r.queries = append(s.r.queries, s.query)
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func TestSQL(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		dialect Dialect
+		mark    string
+		arg     string // the client id's placeholder in an Orders query
+	}{{"sqlite", SQLite, "?", "?"}, {"postgres", Postgres, "$13", "$3"}} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := &recorder{}
+			s, err := NewSQL(sql.OpenDB(connector{rec}), tc.dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if len(rec.execs) != len(s.schema()) || !strings.HasPrefix(rec.execs[0], "CREATE TABLE IF NOT EXISTS orders") {
+				t.Fatalf("schema %q", rec.execs)
+			}
+			rec.execs = nil
+
+			now := time.Now()
+			orders := []Record{{Order: queue.Order{OrderID: 1, ClientID: 7}, At: now}, {Order: queue.Order{OrderID: 2, ClientID: 7}, At: now}}
+			execs := []Record{{Order: queue.Order{OrderID: 1, ClientID: 7, Status: queue.StatusFilled}, At: now}}
+			if err := s.Write(context.Background(), orders, execs); err != nil {
+				t.Fatal(err)
+			}
+			if len(rec.execs) != 3 || !strings.HasPrefix(rec.execs[0], "INSERT INTO orders") ||
+				!strings.HasPrefix(rec.execs[2], "INSERT INTO executions") || !strings.Contains(rec.execs[0], tc.mark+")") {
+				t.Fatalf("inserts %q", rec.execs)
+			}
+			if rec.commits != 1 {
+				t.Fatalf("%d commits", rec.commits)
+			}
+			if sums, err := s.Summary(context.Background(), now.Add(-time.Hour), now); err != nil || len(sums) != 0 {
+				t.Fatalf("summary %+v, %v", sums, err)
+			}
+			client, state := uint32(7), queue.StatusPending
+			q := Query{ClientID: &client, State: &state, From: now.Add(-time.Hour), To: now, After: 10}
+			if page, err := s.Orders(context.Background(), q); err != nil || len(page.Orders) != 0 {
+				t.Fatalf("orders %+v, %v", page, err)
+			}
+			if err := s.EachExecution(context.Background(), now.Add(-time.Hour), now, func(Record) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+			if recs, err := s.Executions(context.Background(), 1); err != nil || len(recs) != 0 {
+				t.Fatalf("executions %+v, %v", recs, err)
+			}
+			if last := rec.queries[len(rec.queries)-3]; !strings.Contains(last, "o.client_id = "+tc.arg) || !strings.HasSuffix(last, "LIMIT 101") {
+				t.Fatalf("orders query %q", last)
+			}
+		})
+	}
+	if _, err := DialectOf("mysql"); err == nil {
+		t.Fatal("mysql accepted")
+	}
+}
+
+type connector struct{ r *recorder }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &recConn{c.r}, nil }
+func (c connector) Driver() driver.Driver                        { return c.r }
+
+func TestOpenSQLite(t *testing.T) {
+	s, err := Open("sqlite:" + filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+	now := time.Now()
+	orders := []Record{
+		{Order: queue.Order{OrderID: 1, ClientID: 7, Symbol: 1, Quantity: 10, Price: 100}, At: now},
+		{Order: queue.Order{OrderID: 2, ClientID: 7, Symbol: 1, Quantity: 5, Price: 101}, At: now},
+	}
+	execs := []Record{
+		{Order: queue.Order{OrderID: 1, ClientID: 7, Symbol: 1, Quantity: 10, Price: 100, Fee: 3, Status: queue.StatusFilled}, At: now},
+		{Order: queue.Order{OrderID: 2, ClientID: 7, Symbol: 1, Quantity: 5, Price: 101, Status: queue.StatusCanceled}, At: now},
+	}
+	if err := s.Write(ctx, orders, execs); err != nil {
+		t.Fatal(err)
+	}
+	sums, err := s.Summary(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	want := Summary{ClientID: 7, Symbol: 1, Orders: 2, Fills: 1, FilledQty: 10, Notional: 1000, Fees: 3, Canceled: 1}
+	if err != nil || len(sums) != 1 || sums[0] != want {
+		t.Fatalf("summary %+v, %v", sums, err)
+	}
+	client := uint32(7)
+	if page, err := s.Orders(ctx, Query{ClientID: &client, From: now.Add(-time.Hour), To: now.Add(time.Hour)}); err != nil || len(page.Orders) != 2 {
+		t.Fatalf("orders %+v, %v", page, err)
+	}
+	if recs, err := s.Executions(ctx, 1); err != nil || len(recs) != 1 || recs[0].Status != queue.StatusFilled {
+		t.Fatalf("executions %+v, %v", recs, err)
+	}
+
+	if _, err := Open("sqlite"); err == nil {
+		t.Error("spec without a dsn accepted")
+	}
+}
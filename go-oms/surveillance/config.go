@@ -0,0 +1,131 @@
+package surveillance
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a rules file. A rule runs when its section is present; fields
+// left out take the defaults shown.
+//
+//	wash_trade:
+//	  groups: [[7, 9], [12, 13, 14]]   # clients under common control
+//	layering:
+//	  min_orders: 3
+//	  min_levels: 3
+//	  window: 5s
+//	cancel_ratio:
+//	  max: 0.95
+//	  min_orders: 100
+//	  window: 1m
+type Config struct {
+	WashTrade   *WashTradeConfig   `yaml:"wash_trade"`
+	Layering    *LayeringConfig    `yaml:"layering"`
+	CancelRatio *CancelRatioConfig `yaml:"cancel_ratio"`
+}
+
+type WashTradeConfig struct {
+	Groups [][]uint32 `yaml:"groups"`
+}
+
+type LayeringConfig struct {
+	MinOrders int           `yaml:"min_orders"`
+	MinLevels int           `yaml:"min_levels"`
+	Window    time.Duration `yaml:"window"`
+}
+
+type CancelRatioConfig struct {
+	Max       float64       `yaml:"max"`
+	MinOrders int           `yaml:"min_orders"`
+	Window    time.Duration `yaml:"window"`
+}
+
+// Load reads and validates a rules file.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates a rules file, filling in defaults. Unknown
+// keys are errors.
+func Parse(data []byte) (Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, err
+	}
+	if l := cfg.Layering; l != nil {
+		if l.MinOrders == 0 {
+			l.MinOrders = 3
+		}
+		if l.MinLevels == 0 {
+			l.MinLevels = 3
+		}
+		if l.Window == 0 {
+			l.Window = 5 * time.Second
+		}
+	}
+	if c := cfg.CancelRatio; c != nil {
+		if c.Max == 0 {
+			c.Max = 0.95
+		}
+		if c.MinOrders == 0 {
+			c.MinOrders = 100
+		}
+		if c.Window == 0 {
+			c.Window = time.Minute
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+func (cfg Config) Validate() error {
+	if cfg.WashTrade == nil && cfg.Layering == nil && cfg.CancelRatio == nil {
+		return fmt.Errorf("no rules")
+	}
+	if w := cfg.WashTrade; w != nil {
+		seen := make(map[uint32]bool)
+		for _, g := range w.Groups {
+			for _, c := range g {
+				if seen[c] {
+					return fmt.Errorf("wash_trade: client %d is in more than one group", c)
+				}
+				seen[c] = true
+			}
+		}
+	}
+	if l := cfg.Layering; l != nil && (l.MinOrders < 1 || l.MinLevels < 1 || l.Window < 0) {
+		return fmt.Errorf("layering: min_orders and min_levels must be at least 1, window positive")
+	}
+	if c := cfg.CancelRatio; c != nil && (c.Max <= 0 || c.MinOrders < 1 || c.Window < 0) {
+		return fmt.Errorf("cancel_ratio: max must be positive, min_orders at least 1, window positive")
+	}
+	return nil
+}
+
+// Rules builds the rules the file turns on.
+func (cfg Config) Rules() []Rule {
+	var rules []Rule
+	if w := cfg.WashTrade; w != nil {
+		rules = append(rules, NewWashTrade(w.Groups))
+	}
+	if l := cfg.Layering; l != nil {
+		rules = append(rules, &Layering{MinOrders: l.MinOrders, MinLevels: l.MinLevels, Window: l.Window})
+	}
+	if c := cfg.CancelRatio; c != nil {
+		rules = append(rules, &CancelRatio{Max: c.Max, MinOrders: c.MinOrders, Window: c.Window})
+	}
+	return rules
+}
@@ -0,0 +1,43 @@
+package surveillance
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"oms/queue"
+)
+
+// Follow feeds e every order and status record published from now on,
+// polling both rings every interval until ctx is done. It only reads the
+// rings, so it can run beside the broker and engine; records overwritten
+// before it reads them are logged as lost.
+func Follow(ctx context.Context, orders, status *queue.ReadOnlyQueue, e *Engine, interval time.Duration) {
+	buf := make([]queue.Order, 1024)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	next := [2]uint64{orders.ProducerHead(), status.ProducerHead()}
+	for {
+		for i, q := range [2]*queue.ReadOnlyQueue{orders, status} {
+			for {
+				got, n, lost := q.Follow(next[i], buf)
+				next[i] = n
+				if lost > 0 {
+					log.Printf("[SURVEILLANCE] %d records lost off the %s ring", lost, [2]string{"order", "status"}[i])
+				}
+				now := time.Now()
+				for _, o := range got {
+					e.Observe(Event{Order: o, Execution: i == 1, At: now})
+				}
+				if len(got) < len(buf) {
+					break
+				}
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
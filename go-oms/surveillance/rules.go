@@ -0,0 +1,227 @@
+package surveillance
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"oms/queue"
+)
+
+// sideName names an order side for alert details.
+func sideName(side uint8) string {
+	if side == 0 {
+		return "buy"
+	}
+	return "sell"
+}
+
+// WashTrade flags fills between a client and itself, or between two
+// clients in one group, such as accounts under common control. Fills whose
+// contra client is not disclosed are not checked.
+type WashTrade struct {
+	group map[uint32]int // client → index into the groups, from 1
+}
+
+// NewWashTrade treats the clients of each group as one beneficial owner.
+func NewWashTrade(groups [][]uint32) *WashTrade {
+	w := &WashTrade{group: make(map[uint32]int)}
+	for i, g := range groups {
+		for _, c := range g {
+			w.group[c] = i + 1
+		}
+	}
+	return w
+}
+
+func (*WashTrade) Name() string { return "wash_trade" }
+
+func (w *WashTrade) Observe(e Event) []Alert {
+	// both sides of a fill are reported; alert on the buy side only
+	if !e.Execution || e.MsgType != queue.MsgNew || (e.Status != queue.StatusFilled && e.Status != queue.StatusPartial) ||
+		e.Side != 0 || e.ContraClientID == 0 {
+		return nil
+	}
+	detail := ""
+	switch g := w.group[e.ClientID]; {
+	case e.ContraClientID == e.ClientID:
+		detail = fmt.Sprintf("bought %d @ %d from itself", e.Quantity, e.Price)
+	case g != 0 && w.group[e.ContraClientID] == g:
+		detail = fmt.Sprintf("bought %d @ %d from client %d of the same group", e.Quantity, e.Price, e.ContraClientID)
+	default:
+		return nil
+	}
+	return []Alert{{ClientID: e.ClientID, Symbol: e.Symbol, Orders: []uint64{e.OrderID}, Detail: detail}}
+}
+
+// Layering flags a client that rests MinOrders or more orders at MinLevels
+// or more prices on one side of a symbol, trades on the other side, then
+// cancels at least MinOrders of the resting orders within Window of the
+// trade: orders placed to move the price, never meant to execute.
+type Layering struct {
+	MinOrders int
+	MinLevels int
+	Window    time.Duration
+
+	open     map[uint32]map[uint64]resting // client → order id → order
+	suspects []*layered
+}
+
+type resting struct {
+	symbol uint32
+	side   uint8
+	price  uint64
+}
+
+// layered is a trade with layers on the other side, waiting to see whether
+// they are canceled.
+type layered struct {
+	client, symbol uint32
+	fill           queue.Order
+	layers         map[uint64]bool
+	levels         int
+	canceled       []uint64
+	at             time.Time // of the fill
+}
+
+func (*Layering) Name() string { return "layering" }
+
+func (l *Layering) Observe(e Event) []Alert {
+	if l.open == nil {
+		l.open = make(map[uint32]map[uint64]resting)
+	}
+	l.suspects = slices.DeleteFunc(l.suspects, func(s *layered) bool { return e.At.Sub(s.at) > l.Window })
+	if e.MsgType != queue.MsgNew {
+		return nil
+	}
+	if !e.Execution {
+		orders := l.open[e.ClientID]
+		if orders == nil {
+			orders = make(map[uint64]resting)
+			l.open[e.ClientID] = orders
+		}
+		orders[e.OrderID] = resting{symbol: e.Symbol, side: e.Side, price: e.Price}
+		return nil
+	}
+
+	switch e.Status {
+	case queue.StatusPartial:
+		l.suspect(e)
+	case queue.StatusFilled:
+		delete(l.open[e.ClientID], e.OrderID)
+		l.suspect(e)
+	case queue.StatusCanceled:
+		delete(l.open[e.ClientID], e.OrderID)
+		for i, s := range l.suspects {
+			if s.client != e.ClientID || !s.layers[e.OrderID] {
+				continue
+			}
+			s.canceled = append(s.canceled, e.OrderID)
+			if len(s.canceled) < l.MinOrders {
+				continue
+			}
+			l.suspects = slices.Delete(l.suspects, i, i+1)
+			return []Alert{{
+				ClientID: s.client,
+				Symbol:   s.symbol,
+				Orders:   append([]uint64{s.fill.OrderID}, s.canceled...),
+				Detail: fmt.Sprintf("%s %d @ %d against %d %s orders at %d prices, %d canceled within %v",
+					sideName(s.fill.Side), s.fill.Quantity, s.fill.Price, len(s.layers),
+					sideName(1-s.fill.Side), s.levels, len(s.canceled), e.At.Sub(s.at).Round(time.Millisecond)),
+			}}
+		}
+	case queue.StatusRejected, queue.StatusExpired:
+		delete(l.open[e.ClientID], e.OrderID)
+	}
+	return nil
+}
+
+// suspect starts watching the client's orders on the other side of fill,
+// if there are enough of them to be layers.
+func (l *Layering) suspect(fill Event) {
+	for _, s := range l.suspects {
+		if s.client == fill.ClientID && s.symbol == fill.Symbol && s.fill.Side == fill.Side {
+			return // already watching these layers
+		}
+	}
+	layers := make(map[uint64]bool)
+	prices := make(map[uint64]bool)
+	for id, o := range l.open[fill.ClientID] {
+		if o.symbol == fill.Symbol && o.side != fill.Side {
+			layers[id] = true
+			prices[o.price] = true
+		}
+	}
+	if len(layers) < l.MinOrders || len(prices) < l.MinLevels {
+		return
+	}
+	l.suspects = append(l.suspects, &layered{
+		client: fill.ClientID,
+		symbol: fill.Symbol,
+		fill:   fill.Order,
+		layers: layers,
+		levels: len(prices),
+		at:     fill.At,
+	})
+}
+
+// CancelRatio flags a client whose canceled orders in a symbol reach Max
+// of its new orders there, over at least MinOrders new orders in the last
+// Window. A client is flagged at most once per symbol per Window.
+type CancelRatio struct {
+	Max       float64
+	MinOrders int
+	Window    time.Duration
+
+	activity map[clientSymbol]*activity
+}
+
+type clientSymbol struct{ client, symbol uint32 }
+
+type activity struct {
+	orders, cancels []time.Time
+	quiet           time.Time // no alert before
+}
+
+// prune forgets what happened before since.
+func (a *activity) prune(since time.Time) {
+	old := func(ts []time.Time) int {
+		i, _ := slices.BinarySearchFunc(ts, since, time.Time.Compare)
+		return i
+	}
+	a.orders = a.orders[old(a.orders):]
+	a.cancels = a.cancels[old(a.cancels):]
+}
+
+func (*CancelRatio) Name() string { return "cancel_ratio" }
+
+func (c *CancelRatio) Observe(e Event) []Alert {
+	if e.MsgType != queue.MsgNew || (e.Execution && e.Status != queue.StatusCanceled) {
+		return nil
+	}
+	if c.activity == nil {
+		c.activity = make(map[clientSymbol]*activity)
+	}
+	k := clientSymbol{e.ClientID, e.Symbol}
+	a := c.activity[k]
+	if a == nil {
+		a = &activity{}
+		c.activity[k] = a
+	}
+	a.prune(e.At.Add(-c.Window))
+	if !e.Execution {
+		a.orders = append(a.orders, e.At)
+		return nil
+	}
+	a.cancels = append(a.cancels, e.At)
+	orders, cancels := len(a.orders), len(a.cancels)
+	if orders < c.MinOrders || float64(cancels) < c.Max*float64(orders) || e.At.Before(a.quiet) {
+		return nil
+	}
+	a.quiet = e.At.Add(c.Window)
+	return []Alert{{
+		ClientID: e.ClientID,
+		Symbol:   e.Symbol,
+		Detail:   fmt.Sprintf("canceled %d of %d orders in %v", cancels, orders, c.Window),
+	}}
+}
@@ -0,0 +1,124 @@
+// Package surveillance watches the live order and status streams for
+// market abuse: wash trades, layering and excessive cancellation. Rules
+// are pluggable; each sees every event in stream order and raises alerts,
+// which the Engine keeps for the admin API and hands to its hooks, the
+// audit log among them.
+//
+// Rules are heuristics over what the OMS sees, not findings: an alert is a
+// prompt for a compliance officer to look, and thresholds are tuned per
+// venue in the rules file, see Config.
+package surveillance
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+// Event is one record off the order ring, or off the status ring when
+// Execution is set.
+type Event struct {
+	queue.Order
+	Execution bool
+	At        time.Time
+}
+
+// Alert is one suspected case.
+type Alert struct {
+	Seq      uint64    `json:"seq"`
+	Rule     string    `json:"rule"`
+	ClientID uint32    `json:"client_id"`
+	Symbol   uint32    `json:"symbol"`
+	Orders   []uint64  `json:"orders,omitempty"` // the orders involved
+	Detail   string    `json:"detail"`
+	At       time.Time `json:"at"`
+}
+
+// Rule looks for one pattern. Observe is called for every event, one at a
+// time, and returns the alerts it raises; the Engine fills in Seq and Rule.
+type Rule interface {
+	Name() string
+	Observe(e Event) []Alert
+}
+
+// Keep is how many recent alerts an Engine holds for Alerts.
+const Keep = 10000
+
+// Engine runs rules over the event stream. Observe is meant for one
+// goroutine, see Follow; Alerts and OnAlert are safe alongside it.
+type Engine struct {
+	rules []Rule
+
+	mu     sync.Mutex
+	seq    uint64
+	recent []Alert
+	hooks  []func(Alert)
+}
+
+func New(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// OnAlert registers fn to be called with every alert, on the goroutine
+// that calls Observe.
+func (e *Engine) OnAlert(fn func(Alert)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hooks = append(e.hooks, fn)
+}
+
+// Observe runs every rule over ev.
+func (e *Engine) Observe(ev Event) {
+	for _, r := range e.rules {
+		alerts := r.Observe(ev)
+		if len(alerts) == 0 {
+			continue
+		}
+		e.mu.Lock()
+		for i := range alerts {
+			e.seq++
+			alerts[i].Seq, alerts[i].Rule = e.seq, r.Name()
+			if alerts[i].At.IsZero() {
+				alerts[i].At = ev.At
+			}
+		}
+		e.recent = append(e.recent, alerts...)
+		if n := len(e.recent) - Keep; n > 0 {
+			e.recent = append(e.recent[:0], e.recent[n:]...)
+		}
+		hooks := e.hooks
+		e.mu.Unlock()
+		for _, a := range alerts {
+			for _, fn := range hooks {
+				fn(a)
+			}
+		}
+	}
+}
+
+// Alerts returns up to limit of the recent alerts with Seq >= from, oldest
+// first; limit <= 0 means all.
+func (e *Engine) Alerts(from uint64, limit int) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := []Alert{}
+	for _, a := range e.recent {
+		if a.Seq < from {
+			continue
+		}
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// LogAlerts returns a hook that logs every alert with prefix.
+func LogAlerts(prefix string) func(Alert) {
+	return func(a Alert) {
+		log.Printf("%s %s client %d symbol %d: %s", prefix, a.Rule, a.ClientID, a.Symbol, a.Detail)
+	}
+}
@@ -0,0 +1,143 @@
+package surveillance
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+// stream builds events a millisecond apart.
+type stream struct {
+	e   *Engine
+	now time.Time
+}
+
+func (s *stream) order(o queue.Order) {
+	s.now = s.now.Add(time.Millisecond)
+	s.e.Observe(Event{Order: o, At: s.now})
+}
+
+func (s *stream) status(o queue.Order, status uint8) {
+	s.now = s.now.Add(time.Millisecond)
+	o.Status = status
+	s.e.Observe(Event{Order: o, Execution: true, At: s.now})
+}
+
+func TestWashTrade(t *testing.T) {
+	s := &stream{e: New(NewWashTrade([][]uint32{{7, 9}})), now: time.Now()}
+	fill := func(buyer, seller uint32) {
+		s.status(queue.Order{OrderID: 1, ClientID: buyer, Side: 0, Quantity: 10, Price: 100, ContraClientID: seller}, queue.StatusFilled)
+		s.status(queue.Order{OrderID: 2, ClientID: seller, Side: 1, Quantity: 10, Price: 100, ContraClientID: buyer}, queue.StatusFilled)
+	}
+	fill(7, 7)
+	fill(7, 9)
+	fill(7, 8)
+	fill(7, 0) // not disclosed
+	alerts := s.e.Alerts(0, 0)
+	if len(alerts) != 2 || alerts[0].Detail != "bought 10 @ 100 from itself" ||
+		!strings.Contains(alerts[1].Detail, "client 9 of the same group") {
+		t.Fatalf("alerts %+v", alerts)
+	}
+	if alerts[1].Seq != 2 || alerts[1].Rule != "wash_trade" || alerts[1].ClientID != 7 {
+		t.Fatalf("alert %+v", alerts[1])
+	}
+	if got := s.e.Alerts(2, 1); len(got) != 1 || got[0].Seq != 2 {
+		t.Fatalf("alerts from 2: %+v", got)
+	}
+}
+
+func TestLayering(t *testing.T) {
+	var alerts []Alert
+	s := &stream{e: New(&Layering{MinOrders: 3, MinLevels: 3, Window: time.Second}), now: time.Now()}
+	s.e.OnAlert(func(a Alert) { alerts = append(alerts, a) })
+
+	// four bids stacked under the market, a sell into them, the bids pulled
+	layers := []queue.Order{
+		{OrderID: 1, ClientID: 7, Symbol: 3, Side: 0, Quantity: 100, Price: 99},
+		{OrderID: 2, ClientID: 7, Symbol: 3, Side: 0, Quantity: 100, Price: 98},
+		{OrderID: 3, ClientID: 7, Symbol: 3, Side: 0, Quantity: 100, Price: 97},
+		{OrderID: 4, ClientID: 7, Symbol: 3, Side: 0, Quantity: 100, Price: 97},
+		{OrderID: 5, ClientID: 7, Symbol: 4, Side: 0, Quantity: 100, Price: 97}, // other symbol
+	}
+	for _, o := range layers {
+		s.order(o)
+	}
+	sell := queue.Order{OrderID: 6, ClientID: 7, Symbol: 3, Side: 1, Quantity: 10, Price: 100}
+	s.order(sell)
+	s.status(sell, queue.StatusFilled)
+	s.status(layers[0], queue.StatusCanceled)
+	s.status(layers[1], queue.StatusCanceled)
+	if len(alerts) != 0 {
+		t.Fatalf("alert after two cancels: %+v", alerts)
+	}
+	s.status(layers[2], queue.StatusCanceled)
+	if len(alerts) != 1 || alerts[0].Symbol != 3 || len(alerts[0].Orders) != 4 || alerts[0].Orders[0] != 6 {
+		t.Fatalf("alerts %+v", alerts)
+	}
+	if !strings.HasPrefix(alerts[0].Detail, "sell 10 @ 100 against 4 buy orders at 3 prices, 3 canceled") {
+		t.Fatalf("detail %q", alerts[0].Detail)
+	}
+
+	// the same pattern, but the layers are pulled after the window
+	for _, o := range layers[:3] {
+		s.order(o)
+	}
+	s.status(sell, queue.StatusFilled)
+	s.now = s.now.Add(2 * time.Second)
+	for _, o := range layers[:3] {
+		s.status(o, queue.StatusCanceled)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("alert outside the window: %+v", alerts[1:])
+	}
+}
+
+func TestCancelRatio(t *testing.T) {
+	s := &stream{e: New(&CancelRatio{Max: 0.9, MinOrders: 10, Window: time.Minute}), now: time.Now()}
+	for i := range 10 {
+		s.order(queue.Order{OrderID: uint64(i + 1), ClientID: 7, Symbol: 1})
+	}
+	for i := range 10 {
+		s.status(queue.Order{OrderID: uint64(i + 1), ClientID: 7, Symbol: 1}, queue.StatusCanceled)
+	}
+	// flagged at the ninth cancel, then quiet for the window
+	alerts := s.e.Alerts(0, 0)
+	if len(alerts) != 1 || alerts[0].Detail != "canceled 9 of 10 orders in 1m0s" {
+		t.Fatalf("alerts %+v", alerts)
+	}
+
+	// a window later the old orders no longer count
+	s.now = s.now.Add(2 * time.Minute)
+	for i := range 5 {
+		s.order(queue.Order{OrderID: uint64(i + 11), ClientID: 7, Symbol: 1})
+		s.status(queue.Order{OrderID: uint64(i + 11), ClientID: 7, Symbol: 1}, queue.StatusCanceled)
+	}
+	if alerts := s.e.Alerts(0, 0); len(alerts) != 1 {
+		t.Fatalf("alerts %+v", alerts)
+	}
+}
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte("wash_trade: {groups: [[7, 9]]}\nlayering: {window: 2s}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Layering.MinOrders != 3 || cfg.Layering.Window != 2*time.Second || cfg.CancelRatio != nil {
+		t.Fatalf("config %+v", cfg)
+	}
+	if rules := cfg.Rules(); len(rules) != 2 || rules[1].Name() != "layering" {
+		t.Fatalf("rules %v", rules)
+	}
+	for _, bad := range []string{
+		"",
+		"wash_trade: {groups: [[7, 9], [9]]}",
+		"cancel_ratio: {max: -1}",
+		"spoofing: {}",
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
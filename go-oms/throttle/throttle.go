@@ -0,0 +1,184 @@
+// Package throttle limits each client's message rate by message type, the
+// way venues throttle order entry: new orders and quote traffic each have
+// their own budget, and cancels are never throttled, since pulling orders
+// only ever takes risk off. A message over its budget is rejected, not
+// delayed, so the client sees at once that it is sending too fast.
+package throttle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+// ErrThrottled refuses a message sent faster than its class allows.
+var ErrThrottled = queue.NewReject(queue.ReasonThrottled, "throttled")
+
+// Class is a budget messages are counted against.
+type Class uint8
+
+const (
+	// Exempt messages are never throttled: cancels, busts and corrections.
+	Exempt Class = iota
+	// NewOrders are new orders, stops included.
+	NewOrders
+	// Quotes are quote requests and quote hits.
+	Quotes
+)
+
+var classNames = [...]string{"exempt", "new_orders", "quotes"}
+
+func (c Class) String() string {
+	if int(c) < len(classNames) {
+		return classNames[c]
+	}
+	return fmt.Sprintf("Class(%d)", uint8(c))
+}
+
+// ClassOf returns the budget order is counted against.
+func ClassOf(order queue.Order) Class {
+	switch order.MsgType {
+	case queue.MsgNew:
+		return NewOrders
+	case queue.MsgQuoteRequest, queue.MsgQuoteHit:
+		return Quotes
+	}
+	return Exempt
+}
+
+// Rate is a sustained message rate with room for a burst: Burst messages
+// may go at once, and the budget refills at PerSecond. The zero Rate is
+// unlimited.
+type Rate struct {
+	PerSecond float64
+	Burst     float64 // default one second's worth, at least 1
+}
+
+// ParseRate accepts "N/s" or "N" with an optional k suffix and an optional
+// burst after a colon: "100/s", "2k/s", "50/s:200". "0" is unlimited.
+func ParseRate(s string) (Rate, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	rate, burst, hasBurst := strings.Cut(s, ":")
+	rate = strings.TrimSuffix(rate, "/s")
+	mult := 1.0
+	if strings.HasSuffix(rate, "k") {
+		mult, rate = 1e3, strings.TrimSuffix(rate, "k")
+	}
+	v, err := strconv.ParseFloat(rate, 64)
+	if err != nil || v < 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q", s)
+	}
+	r := Rate{PerSecond: v * mult}
+	if hasBurst {
+		if r.Burst, err = strconv.ParseFloat(burst, 64); err != nil || r.Burst < 1 {
+			return Rate{}, fmt.Errorf("invalid burst %q in rate %q", burst, s)
+		}
+	}
+	return r, nil
+}
+
+func (r Rate) String() string {
+	if r.PerSecond == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g/s:%g", r.PerSecond, r.burst())
+}
+
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return max(r.PerSecond, 1)
+}
+
+// Limits are the rates every client is held to.
+type Limits struct {
+	NewOrders Rate
+	Quotes    Rate
+}
+
+// Enabled reports whether any class is limited.
+func (l Limits) Enabled() bool {
+	return l.NewOrders.PerSecond > 0 || l.Quotes.PerSecond > 0
+}
+
+func (l Limits) rate(c Class) Rate {
+	switch c {
+	case NewOrders:
+		return l.NewOrders
+	case Quotes:
+		return l.Quotes
+	}
+	return Rate{}
+}
+
+// Stats count messages by outcome.
+type Stats struct {
+	Allowed   uint64 `json:"allowed"`
+	Throttled uint64 `json:"throttled"`
+	Exempt    uint64 `json:"exempt"`
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// Throttle holds every client to Limits with a token bucket per client and
+// class. It is safe for concurrent use.
+type Throttle struct {
+	limits Limits
+
+	mu      sync.Mutex
+	buckets map[uint32]*[len(classNames)]bucket
+	stats   Stats
+}
+
+// New returns a throttle enforcing limits.
+func New(limits Limits) *Throttle {
+	return &Throttle{limits: limits, buckets: make(map[uint32]*[len(classNames)]bucket)}
+}
+
+// Allow counts order against its client's budget for its class at now and
+// refuses it with ErrThrottled when the budget is spent. A refused message
+// does not count.
+func (t *Throttle) Allow(order queue.Order, now time.Time) error {
+	class := ClassOf(order)
+	rate := t.limits.rate(class)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if class == Exempt || rate.PerSecond <= 0 {
+		t.stats.Exempt++
+		return nil
+	}
+	b, ok := t.buckets[order.ClientID]
+	if !ok {
+		b = new([len(classNames)]bucket)
+		t.buckets[order.ClientID] = b
+	}
+	k := &b[class]
+	if k.at.IsZero() {
+		k.tokens = rate.burst()
+	} else if elapsed := now.Sub(k.at); elapsed > 0 {
+		k.tokens = min(rate.burst(), k.tokens+elapsed.Seconds()*rate.PerSecond)
+	}
+	k.at = now
+	if k.tokens < 1 {
+		t.stats.Throttled++
+		return fmt.Errorf("%w: client %d over %s rate %s", ErrThrottled, order.ClientID, class, rate)
+	}
+	k.tokens--
+	t.stats.Allowed++
+	return nil
+}
+
+// Stats returns the counts so far.
+func (t *Throttle) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
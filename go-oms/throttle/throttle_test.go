@@ -0,0 +1,78 @@
+package throttle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestCancelsNeverThrottled(t *testing.T) {
+	th := New(Limits{NewOrders: Rate{PerSecond: 10, Burst: 2}})
+	now := time.Now()
+	order := queue.Order{OrderID: 1, ClientID: 7, Quantity: 1, Price: 100}
+	for i := range 2 {
+		if err := th.Allow(order, now); err != nil {
+			t.Fatalf("order %d: %v", i, err)
+		}
+	}
+	err := th.Allow(order, now)
+	if !errors.Is(err, ErrThrottled) || queue.ReasonOf(err) != queue.ReasonThrottled {
+		t.Fatalf("third order: err = %v, want ErrThrottled", err)
+	}
+	for _, msg := range []queue.Order{
+		queue.Cancel(1, 7, 0),
+		queue.CancelAll(2, 7, 0),
+		{OrderID: 3, ClientID: 7, Symbol: 1, MsgType: queue.MsgCancelAllSymbol},
+	} {
+		if err := th.Allow(msg, now); err != nil {
+			t.Errorf("msg type %d throttled: %v", msg.MsgType, err)
+		}
+	}
+	// another client has its own budget
+	if err := th.Allow(queue.Order{ClientID: 8}, now); err != nil {
+		t.Errorf("client 8: %v", err)
+	}
+	// the budget refills at the rate
+	if err := th.Allow(order, now.Add(100*time.Millisecond)); err != nil {
+		t.Errorf("after refill: %v", err)
+	}
+	if st := th.Stats(); st.Allowed != 4 || st.Throttled != 1 || st.Exempt != 3 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestClassesSeparate(t *testing.T) {
+	th := New(Limits{NewOrders: Rate{PerSecond: 1}, Quotes: Rate{PerSecond: 1}})
+	now := time.Now()
+	if err := th.Allow(queue.Order{ClientID: 7}, now); err != nil {
+		t.Fatal(err)
+	}
+	rfq := queue.QuoteRequest(2, 7, 1, 0, 10, 100, 0)
+	if err := th.Allow(rfq, now); err != nil {
+		t.Fatalf("quote request counted against new orders: %v", err)
+	}
+	if err := th.Allow(queue.Hit(queue.Order{OrderID: 2, ClientID: 7, MsgType: queue.MsgQuote}, 0, 0), now); !errors.Is(err, ErrThrottled) {
+		t.Errorf("hit over the quote budget: err = %v", err)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for in, want := range map[string]Rate{
+		"0":        {},
+		"100/s":    {PerSecond: 100},
+		"2k/s":     {PerSecond: 2000},
+		"50/s:200": {PerSecond: 50, Burst: 200},
+	} {
+		got, err := ParseRate(in)
+		if err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"fast", "-1/s", "10/s:0"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) accepted", in)
+		}
+	}
+}
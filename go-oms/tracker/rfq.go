@@ -0,0 +1,80 @@
+package tracker
+
+import "oms/queue"
+
+// RFQ is a quote request the producer sent and the quote the engine
+// answered it with, if any yet. See queue.QuoteRequest for the workflow.
+type RFQ struct {
+	Request queue.Order
+	Quote   queue.Order // the MsgQuote record; zero until quoted
+}
+
+// Quoted reports whether the engine has answered with a quote.
+func (r RFQ) Quoted() bool { return r.Quote.MsgType == queue.MsgQuote }
+
+// applyRFQ folds a status record for a quote request into its RFQ: the
+// quote, or the record that closes it, a fill from a hit or a rejection.
+// It reports whether the record was for an RFQ. Called with t.mu held.
+func (t *Tracker) applyRFQ(status queue.Order) (closed []queue.Order, ok bool) {
+	rfq, ok := t.rfqs[status.OrderID]
+	if !ok {
+		return nil, false
+	}
+	switch {
+	case status.MsgType == queue.MsgQuote:
+		rfq.Quote = status
+		t.rfqs[status.OrderID] = rfq
+		return nil, true
+	case status.MsgType == queue.MsgNew && status.Terminal():
+		// the fill of a hit
+	case status.MsgType == queue.MsgQuoteRequest && status.Status == queue.StatusRejected:
+		// the engine declined to quote
+	default:
+		// hit acks and rejections leave the quote as it was
+		return nil, true
+	}
+	delete(t.rfqs, status.OrderID)
+	if status.Status == queue.StatusFilled {
+		t.fills[status.OrderID] = fill{status: status}
+	}
+	rfq.Request.Status = status.Status
+	return []queue.Order{rfq.Request}, true
+}
+
+// RFQ returns an open quote request by its OrderID.
+func (t *Tracker) RFQ(orderID uint64) (RFQ, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rfq, ok := t.rfqs[orderID]
+	return rfq, ok
+}
+
+// RFQs returns the open quote requests of clientID, quoted or not.
+func (t *Tracker) RFQs(clientID uint32) []RFQ {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []RFQ
+	for _, rfq := range t.rfqs {
+		if rfq.Request.ClientID == clientID {
+			out = append(out, rfq)
+		}
+	}
+	return out
+}
+
+// ExpireQuotes closes the quote requests whose quote can no longer be hit
+// at now, in unix nanos, and returns them with StatusExpired. The engine
+// sends nothing when a quote lapses, so call it periodically.
+func (t *Tracker) ExpireQuotes(now uint64) []queue.Order {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var expired []queue.Order
+	for id, rfq := range t.rfqs {
+		if rfq.Quoted() && !rfq.Quote.QuoteLive(now) {
+			delete(t.rfqs, id)
+			rfq.Request.Status = queue.StatusExpired
+			expired = append(expired, rfq.Request)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,47 @@
+package tracker
+
+import (
+	"testing"
+
+	"oms/queue"
+)
+
+func TestRFQ(t *testing.T) {
+	tr := New()
+	tr.Submit(queue.QuoteRequest(1, 7, 3, 0, 100, 10000, 0))
+	tr.Submit(queue.QuoteRequest(2, 7, 3, 1, 100, 10000, 0))
+	if rfqs := tr.RFQs(7); len(rfqs) != 2 || rfqs[0].Quoted() {
+		t.Fatalf("rfqs %+v", rfqs)
+	}
+
+	quote := queue.Order{OrderID: 1, ClientID: 7, Symbol: 3, Quantity: 100, Price: 10005, ExpireAt: 50,
+		MsgType: queue.MsgQuote, Status: queue.StatusAcked}
+	tr.Apply(quote)
+	tr.Apply(queue.Order{OrderID: 2, ClientID: 7, Symbol: 3, Quantity: 100, Price: 9995, ExpireAt: 10,
+		MsgType: queue.MsgQuote, Status: queue.StatusAcked})
+	if rfq, ok := tr.RFQ(1); !ok || rfq.Quote.Price != 10005 {
+		t.Fatalf("quoted rfq %+v", rfq)
+	}
+	if expired := tr.ExpireQuotes(20); len(expired) != 1 || expired[0].OrderID != 2 || expired[0].Status != queue.StatusExpired {
+		t.Fatalf("expired %+v", expired)
+	}
+
+	hit := queue.Hit(quote, 40, 30)
+	tr.Submit(hit)
+	hit.Status, hit.Reason = queue.StatusRejected, queue.ReasonValidation
+	if closed := tr.Apply(hit); len(closed) != 0 {
+		t.Fatalf("rejected hit closed %+v", closed)
+	}
+	fill := quote
+	fill.MsgType, fill.Status, fill.Quantity = queue.MsgNew, queue.StatusFilled, 40
+	closed := tr.Apply(fill)
+	if len(closed) != 1 || closed[0].MsgType != queue.MsgQuoteRequest || closed[0].Status != queue.StatusFilled {
+		t.Fatalf("fill closed %+v", closed)
+	}
+	if _, ok := tr.RFQ(1); ok {
+		t.Error("rfq still open after its fill")
+	}
+	if f, ok := tr.Fill(1); !ok || f.Quantity != 40 {
+		t.Errorf("fill %+v, %v", f, ok)
+	}
+}
@@ -0,0 +1,215 @@
+package tracker
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"oms/queue"
+)
+
+// Stage is a point in an order's life the tracker times, to show which
+// step of the path to the engine is spending the latency budget.
+type Stage uint8
+
+const (
+	StageGatewayIn Stage = iota // a gateway read the order off its session
+	StageRiskDone               // refdata and risk checks passed
+	StageEnqueued               // on the order ring (Submit)
+	StageAcked                  // first status record back from the engine
+	StageFilled                 // filled in full
+	numStages
+)
+
+var stageNames = [numStages]string{"gateway_in", "risk_done", "enqueued", "acked", "filled"}
+
+func (s Stage) String() string {
+	if s < numStages {
+		return stageNames[s]
+	}
+	return fmt.Sprintf("Stage(%d)", uint8(s))
+}
+
+// Timing is when an order reached each stage. Stages nobody stamped, or
+// the order has not reached, are zero.
+type Timing struct {
+	OrderID uint64
+	At      [numStages]time.Time
+}
+
+// Spent returns how long the order took to reach stage s from the stage
+// stamped before it, and false if either is missing.
+func (tm Timing) Spent(s Stage) (time.Duration, bool) {
+	if s >= numStages || tm.At[s].IsZero() {
+		return 0, false
+	}
+	for prev := int(s) - 1; prev >= 0; prev-- {
+		if !tm.At[prev].IsZero() {
+			return max(tm.At[s].Sub(tm.At[prev]), 0), true
+		}
+	}
+	return 0, false
+}
+
+// latencyBuckets are the histogram bounds, from a fast in-process hop to
+// an engine that has stalled.
+var latencyBuckets = [...]time.Duration{
+	time.Microsecond, 5 * time.Microsecond, 10 * time.Microsecond, 50 * time.Microsecond,
+	100 * time.Microsecond, 500 * time.Microsecond, time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, time.Second,
+}
+
+type latency struct {
+	buckets [len(latencyBuckets)]uint64 // not cumulative; summed on export
+	count   uint64
+	sum     time.Duration
+}
+
+func (l *latency) observe(d time.Duration) {
+	for i, bound := range latencyBuckets {
+		if d <= bound {
+			l.buckets[i]++
+			break
+		}
+	}
+	l.count++
+	l.sum += d
+}
+
+// startTiming begins the timing of a new order, stamped enqueued now.
+// Called with t.mu held.
+func (t *Tracker) startTiming(order queue.Order, now time.Time) {
+	tm := &Timing{OrderID: order.OrderID}
+	tm.At[StageEnqueued] = now
+	t.timings[order.OrderID] = tm
+}
+
+// timeStatus stamps the stages a status record for an open order reaches,
+// and folds the timing into the histograms once the order is done. Called
+// with t.mu held.
+func (t *Tracker) timeStatus(status queue.Order, now time.Time) {
+	tm, ok := t.timings[status.OrderID]
+	if !ok {
+		return
+	}
+	if tm.At[StageAcked].IsZero() {
+		tm.At[StageAcked] = now
+	}
+	if status.Status == queue.StatusFilled {
+		tm.At[StageFilled] = now
+	}
+	if status.Terminal() {
+		t.endTiming(status.OrderID)
+	}
+}
+
+// endTiming folds an order's timing into the histograms and drops it.
+// Called with t.mu held.
+func (t *Tracker) endTiming(orderID uint64) {
+	tm, ok := t.timings[orderID]
+	if !ok {
+		return
+	}
+	delete(t.timings, orderID)
+	for s := StageGatewayIn + 1; s < numStages; s++ {
+		if d, ok := tm.Spent(s); ok {
+			t.latency[s].observe(d)
+		}
+	}
+}
+
+// Mark stamps stage on an open order at at, for the stages the tracker
+// does not see itself: gateway in and risk done. Gateways and decorators
+// (see Stamp) mark once the order is on the ring, so a mark for an order
+// the tracker does not know, or no longer does, is dropped.
+func (t *Tracker) Mark(orderID uint64, stage Stage, at time.Time) {
+	if stage >= numStages || at.IsZero() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tm, ok := t.timings[orderID]; ok {
+		tm.At[stage] = at
+	}
+}
+
+// Timing returns the stages an open order has reached so far. Closed
+// orders are only in the histograms.
+func (t *Tracker) Timing(orderID uint64) (Timing, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tm, ok := t.timings[orderID]
+	if !ok {
+		return Timing{}, false
+	}
+	return *tm, true
+}
+
+// WritePrometheus writes a histogram per stage of the time closed orders
+// took to reach it from the stage before, as oms_order_stage_seconds.
+func (t *Tracker) WritePrometheus(w io.Writer) error {
+	t.mu.Lock()
+	hists := t.latency
+	t.mu.Unlock()
+	if _, err := io.WriteString(w, "# HELP oms_order_stage_seconds Time orders took to reach each stage from the one before.\n"+
+		"# TYPE oms_order_stage_seconds histogram\n"); err != nil {
+		return err
+	}
+	for s := StageGatewayIn + 1; s < numStages; s++ {
+		h := hists[s]
+		if h.count == 0 {
+			continue
+		}
+		var cum uint64
+		for i, bound := range latencyBuckets {
+			cum += h.buckets[i]
+			fmt.Fprintf(w, "oms_order_stage_seconds_bucket{stage=%q,le=\"%g\"} %d\n", s, bound.Seconds(), cum)
+		}
+		fmt.Fprintf(w, "oms_order_stage_seconds_bucket{stage=%q,le=\"+Inf\"} %d\n", s, h.count)
+		fmt.Fprintf(w, "oms_order_stage_seconds_sum{stage=%q} %g\n", s, h.sum.Seconds())
+		if _, err := fmt.Fprintf(w, "oms_order_stage_seconds_count{stage=%q} %d\n", s, h.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Queue wraps the order ring and Submits every message it accepts to
+// Tracker, which stamps new orders enqueued.
+type Queue struct {
+	queue.OrderQueue
+	Tracker *Tracker
+}
+
+var _ queue.OrderQueue = (*Queue)(nil)
+
+func (q *Queue) Enqueue(order queue.Order) error {
+	if err := q.OrderQueue.Enqueue(order); err != nil {
+		return err
+	}
+	q.Tracker.Submit(order)
+	return nil
+}
+
+// Stamp wraps an order queue and marks Stage on each new order when it is
+// handed to Enqueue, once the queues behind have accepted it. Wrap the
+// queue a check passes orders to, e.g. inside risk.Guard for
+// StageRiskDone.
+type Stamp struct {
+	queue.OrderQueue
+	Tracker *Tracker
+	Stage   Stage
+}
+
+var _ queue.OrderQueue = (*Stamp)(nil)
+
+func (s *Stamp) Enqueue(order queue.Order) error {
+	at := time.Now()
+	if err := s.OrderQueue.Enqueue(order); err != nil {
+		return err
+	}
+	if order.MsgType == queue.MsgNew {
+		s.Tracker.Mark(order.OrderID, s.Stage, at)
+	}
+	return nil
+}
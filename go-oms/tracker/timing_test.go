@@ -0,0 +1,75 @@
+package tracker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestStageTimings(t *testing.T) {
+	tr := New()
+	ring := queue.NewInMemory(16)
+	q := &Stamp{OrderQueue: &Queue{OrderQueue: ring, Tracker: tr}, Tracker: tr, Stage: StageRiskDone}
+	order := queue.Order{OrderID: 1, ClientID: 7, Symbol: 1, Quantity: 10, Price: 100}
+	in := time.Now()
+	if err := q.Enqueue(order); err != nil {
+		t.Fatal(err)
+	}
+	tr.Mark(1, StageGatewayIn, in.Add(-time.Millisecond))
+	tm, ok := tr.Timing(1)
+	if !ok {
+		t.Fatal("no timing for an open order")
+	}
+	for s := StageGatewayIn; s <= StageEnqueued; s++ {
+		if tm.At[s].IsZero() {
+			t.Errorf("%s not stamped", s)
+		}
+	}
+	if d, ok := tm.Spent(StageRiskDone); !ok || d < time.Millisecond {
+		t.Errorf("gateway to risk = %v, %v; want at least 1ms", d, ok)
+	}
+	if _, ok := tm.Spent(StageAcked); ok {
+		t.Error("acked before any status")
+	}
+
+	order.Status = queue.StatusPartial
+	order.Quantity = 4
+	tr.Apply(order)
+	order.Status = queue.StatusFilled
+	order.Quantity = 6
+	tr.Apply(order)
+	if _, ok := tr.Timing(1); ok {
+		t.Error("timing kept after the fill")
+	}
+	tr.Mark(1, StageGatewayIn, in) // late marks for closed orders are dropped
+	if _, ok := tr.Timing(1); ok {
+		t.Error("late mark revived the timing")
+	}
+
+	var out strings.Builder
+	if err := tr.WritePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`oms_order_stage_seconds_bucket{stage="risk_done",le="0.005"} 1`,
+		`oms_order_stage_seconds_count{stage="enqueued"} 1`,
+		`oms_order_stage_seconds_count{stage="acked"} 1`,
+		`oms_order_stage_seconds_count{stage="filled"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics lack %s:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestTimingMassCancel(t *testing.T) {
+	tr := New()
+	tr.Submit(queue.Order{OrderID: 1, ClientID: 7, Quantity: 1})
+	tr.Submit(queue.CancelAll(2, 7, 0))
+	tr.Apply(queue.Order{OrderID: 2, ClientID: 7, MsgType: queue.MsgCancelAll, Status: queue.StatusAcked})
+	if _, ok := tr.Timing(1); ok {
+		t.Error("timing kept for an order the mass cancel closed")
+	}
+}
@@ -0,0 +1,363 @@
+// Package tracker keeps the OMS view of open orders, built from what the
+// producer sends and the status records the engine returns.
+package tracker
+
+import (
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+// Tracker is safe for concurrent use by the producer and the status reader.
+type Tracker struct {
+	mu       sync.Mutex
+	open     map[uint64]queue.Order
+	controls map[uint64]queue.Order // control messages awaiting StatusAcked
+	parents  map[uint64]*Parent
+	parentOf map[uint64]uint64 // child OrderID -> parent OrderID
+	fills    map[uint64]fill   // filled orders, for busts and corrections
+	filled   []uint64          // fills' keys, oldest first
+	maxFills int               // fills kept; the oldest go first past it
+	rfqs     map[uint64]RFQ    // open quote requests; see rfq.go
+
+	timings map[uint64]*Timing // open orders' stages; see timing.go
+	latency [numStages]latency // closed orders, by stage reached
+}
+
+type fill struct {
+	status queue.Order
+	parent uint64 // parent OrderID if the order was a child, else 0
+	busted bool
+}
+
+// Parent is an order worked through child orders (see package algo). It
+// never goes to the engine itself; its fills are the sum of its children's.
+type Parent struct {
+	Order    queue.Order // Quantity is the total to work
+	Filled   uint32      // quantity filled across children
+	Notional uint64      // sum of price * quantity over child fills
+	Fees     int64       // sum of child fill fees; negative is net rebate
+	Live     uint32      // quantity in children still open
+	Children []uint64    // every child sent, oldest first
+}
+
+// AvgPrice is the quantity-weighted fill price, 0 before any fill. Set
+// against the arrival price it gives the parent's slippage.
+func (p Parent) AvgPrice() uint64 {
+	if p.Filled == 0 {
+		return 0
+	}
+	return p.Notional / uint64(p.Filled)
+}
+
+// Remaining is the quantity neither filled nor working in a child.
+func (p Parent) Remaining() uint32 {
+	return p.Order.Quantity - min(p.Order.Quantity, p.Filled+p.Live)
+}
+
+// FillHistory is how many fills a Tracker keeps for busts and corrections;
+// past it the oldest are forgotten, as ForgetFills forgets them all.
+const FillHistory = 1 << 20
+
+func New() *Tracker {
+	return &Tracker{
+		open:     make(map[uint64]queue.Order),
+		controls: make(map[uint64]queue.Order),
+		parents:  make(map[uint64]*Parent),
+		parentOf: make(map[uint64]uint64),
+		fills:    make(map[uint64]fill),
+		maxFills: FillHistory,
+		rfqs:     make(map[uint64]RFQ),
+		timings:  make(map[uint64]*Timing),
+	}
+}
+
+// AddParent starts tracking a parent order.
+func (t *Tracker) AddParent(parent queue.Order) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.parents[parent.OrderID] = &Parent{Order: parent}
+}
+
+// SubmitChild records a child order the producer has enqueued for parentID.
+func (t *Tracker) SubmitChild(parentID uint64, child queue.Order) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.parents[parentID]
+	if !ok {
+		return
+	}
+	t.open[child.OrderID] = child
+	t.startTiming(child, time.Now())
+	t.parentOf[child.OrderID] = parentID
+	p.Live += child.Quantity
+	p.Children = append(p.Children, child.OrderID)
+}
+
+// Parent returns a copy of a parent's state.
+func (t *Tracker) Parent(parentID uint64) (Parent, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.parents[parentID]
+	if !ok {
+		return Parent{}, false
+	}
+	out := *p
+	out.Children = append([]uint64(nil), p.Children...)
+	return out, true
+}
+
+// RemoveParent stops tracking a parent that is done. Its children still
+// open stay tracked as plain orders.
+func (t *Tracker) RemoveParent(parentID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.parents[parentID]
+	if !ok {
+		return
+	}
+	for _, id := range p.Children {
+		delete(t.parentOf, id)
+	}
+	delete(t.parents, parentID)
+}
+
+// closeChild folds a child's terminal status into its parent. Called with
+// t.mu held.
+func (t *Tracker) closeChild(child, status queue.Order) {
+	parentID, ok := t.parentOf[child.OrderID]
+	if !ok {
+		return
+	}
+	delete(t.parentOf, child.OrderID)
+	p := t.parents[parentID]
+	p.Live -= min(p.Live, child.Quantity)
+	if status.Status == queue.StatusFilled {
+		p.Filled += status.Quantity
+		p.Notional += status.Price * uint64(status.Quantity)
+		p.Fees += int64(status.Fee)
+	}
+}
+
+// Submit records a message the producer has enqueued.
+func (t *Tracker) Submit(order queue.Order) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if targetsOrder(order) {
+		// single cancels, busts and corrections carry the target's id and
+		// resolve through its own status reports
+		return
+	}
+	if order.MsgType == queue.MsgQuoteRequest {
+		t.rfqs[order.OrderID] = RFQ{Request: order}
+		return
+	}
+	if order.IsControl() {
+		t.controls[order.OrderID] = order
+		return
+	}
+	t.open[order.OrderID] = order
+	t.startTiming(order, time.Now())
+}
+
+// Apply folds a status record from the engine into the open-order view and
+// returns the orders it closed.
+//
+// A mass-cancel ack also closes any order of the targeted client or symbol
+// that was sent before the control message and is still open: the status
+// ring is FIFO, so the engine already handled those, and their individual
+// cancel reports were lost (e.g. dropped on status backpressure).
+func (t *Tracker) Apply(status queue.Order) []queue.Order {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if closed, ok := t.applyRFQ(status); ok {
+		return closed
+	}
+	if !status.IsControl() {
+		if status.Status == queue.StatusBusted || status.Status == queue.StatusCorrected {
+			t.amendFill(status)
+			return nil
+		}
+		order, ok := t.open[status.OrderID]
+		if ok {
+			t.timeStatus(status, time.Now())
+		}
+		if ok && status.Status == queue.StatusTriggered {
+			// a released stop goes on as the order the engine got
+			t.open[status.OrderID] = status
+			return nil
+		}
+		if ok && status.Status == queue.StatusPartial {
+			t.partialFill(order, status)
+			return nil
+		}
+		if !ok || !status.Terminal() {
+			return nil
+		}
+		delete(t.open, status.OrderID)
+		if status.Status == queue.StatusFilled {
+			t.addFill(fill{status: status, parent: t.parentOf[status.OrderID]})
+		}
+		t.closeChild(order, status)
+		order.Status = status.Status
+		return []queue.Order{order}
+	}
+
+	if targetsOrder(status) {
+		return nil
+	}
+	ctrl, ok := t.controls[status.OrderID]
+	if !ok || status.Status != queue.StatusAcked {
+		return nil
+	}
+	delete(t.controls, status.OrderID)
+
+	var closed []queue.Order
+	for id, order := range t.open {
+		if id < ctrl.OrderID && matches(ctrl, order) {
+			delete(t.open, id)
+			t.endTiming(id)
+			order.Status = queue.StatusCanceled
+			t.closeChild(order, order)
+			closed = append(closed, order)
+		}
+	}
+	return closed
+}
+
+// partialFill takes a partial fill off the open order, which stays open
+// for the rest, and adds it to the order's parent. Only the fill that
+// closes an order is kept for busts and corrections. Called with t.mu
+// held.
+func (t *Tracker) partialFill(order, status queue.Order) {
+	qty := min(status.Quantity, order.Quantity)
+	order.Quantity -= qty
+	t.open[order.OrderID] = order
+	if p, ok := t.parents[t.parentOf[order.OrderID]]; ok {
+		p.Live -= min(p.Live, qty)
+		p.Filled += qty
+		p.Notional += status.Price * uint64(qty)
+		p.Fees += int64(status.Fee)
+	}
+}
+
+// addFill keeps a fill for busts and corrections, forgetting the oldest
+// past maxFills. Called with t.mu held.
+func (t *Tracker) addFill(f fill) {
+	if _, ok := t.fills[f.status.OrderID]; !ok {
+		t.filled = append(t.filled, f.status.OrderID)
+	}
+	t.fills[f.status.OrderID] = f
+	for len(t.fills) > t.maxFills {
+		delete(t.fills, t.filled[0])
+		t.filled = t.filled[1:]
+	}
+}
+
+// amendFill folds a bust or correction into the recorded fill and its
+// parent. A bust carries the fill as it was, a correction the replacement,
+// so each moves the parent's totals by its own quantity, price and fee.
+// Called with t.mu held.
+func (t *Tracker) amendFill(status queue.Order) {
+	f, ok := t.fills[status.OrderID]
+	if !ok || f.busted == (status.Status == queue.StatusBusted) {
+		return // not ours, or a duplicate report
+	}
+	p := t.parents[f.parent]
+	if status.Status == queue.StatusBusted {
+		f.busted = true
+		if p != nil {
+			p.Filled -= min(p.Filled, status.Quantity)
+			p.Notional -= min(p.Notional, status.Price*uint64(status.Quantity))
+			p.Fees -= int64(status.Fee)
+		}
+	} else {
+		f.status, f.busted = status, false
+		if p != nil {
+			p.Filled += status.Quantity
+			p.Notional += status.Price * uint64(status.Quantity)
+			p.Fees += int64(status.Fee)
+		}
+	}
+	t.fills[status.OrderID] = f
+}
+
+// Fill returns the fill in force for an order: the original, the
+// correction that replaced it, or false if it was busted or never filled.
+func (t *Tracker) Fill(orderID uint64) (queue.Order, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, ok := t.fills[orderID]
+	return f.status, ok && !f.busted
+}
+
+// ForgetFills drops the fill history kept for busts and corrections, e.g.
+// once the trading day is settled; the admin API calls it when the session
+// closes.
+func (t *Tracker) ForgetFills() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.fills)
+	t.filled = nil
+}
+
+// targetsOrder reports whether a control message acts on one order by id
+// rather than carrying an id of its own.
+func targetsOrder(o queue.Order) bool {
+	switch o.MsgType {
+	case queue.MsgCancel, queue.MsgBust, queue.MsgCorrect, queue.MsgQuoteHit:
+		return true
+	}
+	return false
+}
+
+func matches(ctrl, order queue.Order) bool {
+	switch ctrl.MsgType {
+	case queue.MsgCancelAll:
+		return order.ClientID == ctrl.ClientID
+	case queue.MsgCancelAllSymbol:
+		return order.Symbol == ctrl.Symbol
+	}
+	return false
+}
+
+// Get returns an open order by ID.
+func (t *Tracker) Get(orderID uint64) (queue.Order, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	order, ok := t.open[orderID]
+	return order, ok
+}
+
+// OpenOrders returns the open orders of clientID.
+func (t *Tracker) OpenOrders(clientID uint32) []queue.Order {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var orders []queue.Order
+	for _, order := range t.open {
+		if order.ClientID == clientID {
+			orders = append(orders, order)
+		}
+	}
+	return orders
+}
+
+// All returns every open order.
+func (t *Tracker) All() []queue.Order {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	orders := make([]queue.Order, 0, len(t.open))
+	for _, order := range t.open {
+		orders = append(orders, order)
+	}
+	return orders
+}
+
+// Open is the number of open orders across all clients.
+func (t *Tracker) Open() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.open)
+}
@@ -0,0 +1,38 @@
+package tracker
+
+import (
+	"testing"
+
+	"oms/queue"
+)
+
+func TestFillHistory(t *testing.T) {
+	tr := New()
+	tr.maxFills = 3
+	for id := uint64(1); id <= 5; id++ {
+		order := queue.Order{OrderID: id, ClientID: 7, Quantity: 10, Price: 100}
+		tr.Submit(order)
+		order.Status = queue.StatusFilled
+		tr.Apply(order)
+	}
+	for id, kept := range map[uint64]bool{1: false, 2: false, 3: true, 4: true, 5: true} {
+		if _, ok := tr.Fill(id); ok != kept {
+			t.Errorf("fill of %d kept %v, want %v", id, ok, kept)
+		}
+	}
+
+	// a bust of a fill already forgotten changes nothing
+	tr.Apply(queue.Order{OrderID: 1, Quantity: 10, Price: 100, Status: queue.StatusBusted})
+	tr.Apply(queue.Order{OrderID: 3, Quantity: 10, Price: 100, Status: queue.StatusBusted})
+	if _, ok := tr.Fill(3); ok {
+		t.Error("fill of 3 in force after its bust")
+	}
+	if len(tr.fills) != 3 || len(tr.filled) != 3 {
+		t.Errorf("%d fills, %d ids kept, want 3", len(tr.fills), len(tr.filled))
+	}
+
+	tr.ForgetFills()
+	if _, ok := tr.Fill(5); ok || len(tr.filled) != 0 {
+		t.Errorf("fills kept after ForgetFills: %d ids", len(tr.filled))
+	}
+}
@@ -0,0 +1,485 @@
+package wal
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"oms/queue"
+)
+
+// A capture at millions of orders a second fills a disk overnight, and
+// orders, mostly zero bytes and ids that count up, compress well. Once the
+// log rolls past a segment it is never appended to again, so with
+// Options.Compression set the log rewrites each sealed segment, in the
+// background, as a compressed one: its records cut into frames of about
+// frameSize raw bytes, each compressed (and, with a key, sealed) on its
+// own, and an index of the frames at the end, so Replay from a sequence
+// number and SeqAt a time decompress only the frames they need. The
+// segment being appended to stays plain: it must survive a crash mid
+// record, which a compressed frame would not.
+//
+// A compressed segment, <first seq>.walz:
+//
+//	header   magic u32, version u16, flags u16, first seq u64
+//	frames   stored length u32, raw length u32, crc u32, records u32, data
+//	index    per frame: first seq, min and max order timestamp, offset: u64 each
+//	trailer  next seq u64, index offset u64, frames u32, magic u32
+//
+// The flags are the plain segment's, with the Compression in the high
+// byte. A frame decompresses to records exactly as a plain segment holds
+// them, but never encrypted: with a key, the compressed frame is sealed
+// whole instead, with its first sequence number as additional data.
+
+// Compression is how sealed segments are compressed.
+type Compression uint8
+
+const (
+	NoCompression Compression = iota
+	Zstd                      // smaller
+	LZ4                       // faster
+)
+
+var compressionNames = [...]string{"none", "zstd", "lz4"}
+
+func (c Compression) String() string {
+	if int(c) < len(compressionNames) {
+		return compressionNames[c]
+	}
+	return fmt.Sprintf("Compression(%d)", uint8(c))
+}
+
+// ParseCompression parses none, zstd or lz4.
+func ParseCompression(s string) (Compression, error) {
+	for i, name := range compressionNames {
+		if strings.EqualFold(s, name) {
+			return Compression(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown wal compression %q (want none, zstd or lz4)", s)
+}
+
+const (
+	compressedMagic   = 0x4F4D535A // "OMSZ"
+	compressedVersion = 1
+	compressedExt     = ".walz"
+
+	frameHeaderSize = 16
+	indexEntrySize  = 32
+	trailerSize     = 24
+
+	// frameSize is about 12k orders of raw records: the most a seek has
+	// to decompress to reach its record.
+	frameSize = 1 << 20
+	// maxFrameSize bounds what a frame header may claim.
+	maxFrameSize = 4 * frameSize
+)
+
+// frameIndex is an index entry: first is the sequence number of the first
+// order in the frame, though commit markers of orders before it may come
+// ahead of it.
+type frameIndex struct {
+	first            uint64
+	minTime, maxTime uint64 // of the frame's orders, unix nanos
+	offset           int64
+}
+
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		e, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return e
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxFrameSize))
+		return d
+	})
+)
+
+func compressFrame(c Compression, raw []byte) ([]byte, error) {
+	switch c {
+	case Zstd:
+		return zstdEncoder().EncodeAll(raw, nil), nil
+	case LZ4:
+		return lz4Compress(nil, raw), nil
+	}
+	return nil, fmt.Errorf("unsupported wal compression %s", c)
+}
+
+func decompressFrame(c Compression, data []byte, size int) ([]byte, error) {
+	var raw []byte
+	var err error
+	switch c {
+	case Zstd:
+		raw, err = zstdDecoder().DecodeAll(data, make([]byte, 0, size))
+	case LZ4:
+		raw, err = lz4Decompress(make([]byte, 0, size), data, size)
+	default:
+		return nil, fmt.Errorf("unsupported wal compression %s", c)
+	}
+	if err != nil || len(raw) != size {
+		return nil, fmt.Errorf("%w: frame does not decompress", ErrCorrupt)
+	}
+	return raw, nil
+}
+
+// compressSegment rewrites the sealed plain segment name in dir as a
+// compressed one and removes it. The compressed segment only appears, by
+// rename, once it is complete and synced, so a crash leaves one or the
+// other.
+func compressSegment(dir, name string, aead cipher.AEAD, c Compression) error {
+	src, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to open wal segment: %w", err)
+	}
+	defer src.Close()
+	first, _ := segmentSeq(name)
+	base := strings.TrimSuffix(name, segmentExt)
+	tmp := filepath.Join(dir, base+compressedExt+".tmp")
+	out, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create compressed wal segment: %w", err)
+	}
+	defer os.Remove(tmp) // fails harmlessly once renamed
+	defer out.Close()
+
+	var hdr [segmentHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:], compressedMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], compressedVersion)
+	flags := uint16(c) << 8
+	if aead != nil {
+		flags |= flagEncrypted
+	}
+	binary.LittleEndian.PutUint16(hdr[6:], flags)
+	binary.LittleEndian.PutUint64(hdr[8:], first)
+	w := &countingWriter{w: out}
+	w.Write(hdr[:])
+
+	var (
+		index   []frameIndex
+		raw     []byte
+		records uint32
+		frame   = frameIndex{first: first, minTime: math.MaxUint64}
+	)
+	flush := func(next uint64) error {
+		if records == 0 {
+			return nil
+		}
+		data, err := compressFrame(c, raw)
+		if err != nil {
+			return err
+		}
+		if aead != nil {
+			if data, err = seal(aead, nil, data, binary.LittleEndian.AppendUint64(nil, frame.first)); err != nil {
+				return err
+			}
+		}
+		var fh [frameHeaderSize]byte
+		binary.LittleEndian.PutUint32(fh[0:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(fh[4:], uint32(len(raw)))
+		binary.LittleEndian.PutUint32(fh[8:], crc32.Checksum(data, crcTable))
+		binary.LittleEndian.PutUint32(fh[12:], records)
+		frame.offset = w.n
+		w.Write(fh[:])
+		w.Write(data)
+		if frame.minTime > frame.maxTime {
+			frame.minTime = 0 // markers only
+		}
+		index = append(index, frame)
+		raw, records = raw[:0], 0
+		frame = frameIndex{first: next, minTime: math.MaxUint64}
+		return w.err
+	}
+	var plain [orderSize]byte
+	nextOrder := first
+	_, next, err := scan(src, aead, func(seq uint64, o *queue.Order) error {
+		p := plain[:markerSize]
+		if o != nil {
+			binary.Encode(plain[:], binary.LittleEndian, o)
+			p = plain[:]
+			frame.minTime, frame.maxTime = min(frame.minTime, o.Timestamp), max(frame.maxTime, o.Timestamp)
+			nextOrder = seq + 1
+		} else {
+			binary.LittleEndian.PutUint64(p, seq)
+		}
+		var err error
+		if raw, err = appendRecord(raw, nil, seq, p); err != nil {
+			return err
+		}
+		records++
+		if len(raw) < frameSize {
+			return nil
+		}
+		return flush(nextOrder)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := flush(next); err != nil {
+		return err
+	}
+
+	indexOffset := w.n
+	var entry [indexEntrySize]byte
+	for _, f := range index {
+		binary.LittleEndian.PutUint64(entry[0:], f.first)
+		binary.LittleEndian.PutUint64(entry[8:], f.minTime)
+		binary.LittleEndian.PutUint64(entry[16:], f.maxTime)
+		binary.LittleEndian.PutUint64(entry[24:], uint64(f.offset))
+		w.Write(entry[:])
+	}
+	var trailer [trailerSize]byte
+	binary.LittleEndian.PutUint64(trailer[0:], next)
+	binary.LittleEndian.PutUint64(trailer[8:], uint64(indexOffset))
+	binary.LittleEndian.PutUint32(trailer[16:], uint32(len(index)))
+	binary.LittleEndian.PutUint32(trailer[20:], compressedMagic)
+	w.Write(trailer[:])
+	if w.err != nil {
+		return fmt.Errorf("failed to write compressed wal segment: %w", w.err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to sync compressed wal segment: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, base+compressedExt)); err != nil {
+		return fmt.Errorf("failed to install compressed wal segment: %w", err)
+	}
+	syncDir(dir)
+	return os.Remove(filepath.Join(dir, name))
+}
+
+// removeLeftovers removes what a compression stopped by a crash left: a
+// partial compressed segment, or a plain one already installed compressed.
+func removeLeftovers(dir string) {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, compressedExt+".tmp") {
+			os.Remove(filepath.Join(dir, name))
+		} else if base, ok := strings.CutSuffix(name, segmentExt); ok {
+			if _, err := os.Stat(filepath.Join(dir, base+compressedExt)); err == nil {
+				os.Remove(filepath.Join(dir, name))
+			}
+		}
+	}
+}
+
+// countingWriter keeps the offset and the first error, so a run of writes
+// can be checked once.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// compressedSegment is an open compressed segment with its index read.
+type compressedSegment struct {
+	f         *os.File
+	c         Compression
+	encrypted bool
+	next      uint64
+	frames    []frameIndex
+}
+
+func openCompressed(f *os.File) (*compressedSegment, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var hdr [segmentHeaderSize]byte
+	var trailer [trailerSize]byte
+	if _, err := f.ReadAt(hdr[:], 0); err != nil {
+		return nil, fmt.Errorf("%w: short segment header", ErrCorrupt)
+	}
+	if binary.LittleEndian.Uint32(hdr[0:]) != compressedMagic {
+		return nil, fmt.Errorf("%s: not a compressed wal segment", f.Name())
+	}
+	if v := binary.LittleEndian.Uint16(hdr[4:]); v != compressedVersion {
+		return nil, fmt.Errorf("%s: unsupported compressed wal version %d", f.Name(), v)
+	}
+	if _, err := f.ReadAt(trailer[:], info.Size()-trailerSize); err != nil || binary.LittleEndian.Uint32(trailer[20:]) != compressedMagic {
+		return nil, fmt.Errorf("%w: %s: no index", ErrCorrupt, f.Name())
+	}
+	flags := binary.LittleEndian.Uint16(hdr[6:])
+	z := &compressedSegment{
+		f:         f,
+		c:         Compression(flags >> 8),
+		encrypted: flags&flagEncrypted != 0,
+		next:      binary.LittleEndian.Uint64(trailer[0:]),
+	}
+	off := int64(binary.LittleEndian.Uint64(trailer[8:]))
+	n := int64(binary.LittleEndian.Uint32(trailer[16:]))
+	if off < segmentHeaderSize || off+n*indexEntrySize != info.Size()-trailerSize {
+		return nil, fmt.Errorf("%w: %s: bad index", ErrCorrupt, f.Name())
+	}
+	index := make([]byte, n*indexEntrySize)
+	if _, err := f.ReadAt(index, off); err != nil {
+		return nil, fmt.Errorf("%w: %s: short index", ErrCorrupt, f.Name())
+	}
+	for e := index; len(e) > 0; e = e[indexEntrySize:] {
+		z.frames = append(z.frames, frameIndex{
+			first:   binary.LittleEndian.Uint64(e[0:]),
+			minTime: binary.LittleEndian.Uint64(e[8:]),
+			maxTime: binary.LittleEndian.Uint64(e[16:]),
+			offset:  int64(binary.LittleEndian.Uint64(e[24:])),
+		})
+	}
+	return z, nil
+}
+
+// frame reads, checks, opens and decompresses frame i into its records.
+func (z *compressedSegment) frame(i int, aead cipher.AEAD) ([]byte, error) {
+	switch {
+	case z.encrypted && aead == nil:
+		return nil, ErrEncrypted
+	case !z.encrypted && aead != nil:
+		return nil, ErrNotEncrypted
+	}
+	fi := z.frames[i]
+	var fh [frameHeaderSize]byte
+	if _, err := z.f.ReadAt(fh[:], fi.offset); err != nil {
+		return nil, fmt.Errorf("%w: short frame header at offset %d", ErrCorrupt, fi.offset)
+	}
+	stored, size := binary.LittleEndian.Uint32(fh[0:]), binary.LittleEndian.Uint32(fh[4:])
+	if stored > maxFrameSize || size > maxFrameSize {
+		return nil, fmt.Errorf("%w: bad frame header at offset %d", ErrCorrupt, fi.offset)
+	}
+	data := make([]byte, stored)
+	if _, err := z.f.ReadAt(data, fi.offset+frameHeaderSize); err != nil {
+		return nil, fmt.Errorf("%w: short frame at offset %d", ErrCorrupt, fi.offset)
+	}
+	if crc32.Checksum(data, crcTable) != binary.LittleEndian.Uint32(fh[8:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch on frame at offset %d", ErrCorrupt, fi.offset)
+	}
+	if aead != nil {
+		var err error
+		if data, err = open(aead, data, binary.LittleEndian.AppendUint64(nil, fi.first)); err != nil {
+			return nil, fmt.Errorf("frame at offset %d: %w", fi.offset, err)
+		}
+	}
+	return decompressFrame(z.c, data, int(size))
+}
+
+// scanCompressed walks the records of a compressed segment from the frame
+// holding order from on, as scan walks a plain one.
+func scanCompressed(f *os.File, aead cipher.AEAD, from uint64, fn func(uint64, *queue.Order) error) error {
+	z, err := openCompressed(f)
+	if err != nil {
+		return err
+	}
+	start := sort.Search(len(z.frames), func(i int) bool { return z.frames[i].first > from })
+	for i := max(start-1, 0); i < len(z.frames); i++ {
+		raw, err := z.frame(i, aead)
+		if err != nil {
+			return err
+		}
+		if _, _, err := scanRecords(bytes.NewReader(raw), nil, 0, z.frames[i].first, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errFound stops a scan that found what it was looking for.
+var errFound = errors.New("found")
+
+// SeqAt returns the sequence number of the first order, in log order,
+// timestamped at or after at, or the next sequence number to be written
+// if there is none. A compressed segment's index lets it skip every frame
+// whose orders are all older, so with Replay it seeks a capture by time.
+func SeqAt(dir string, opts Options, at time.Time) (uint64, error) {
+	aead, err := newAEAD(opts.Key)
+	if err != nil {
+		return 0, err
+	}
+	t := uint64(at.UnixNano())
+	segs, err := segments(dir)
+	if err != nil {
+		return 0, err
+	}
+	var found, next uint64
+	match := func(seq uint64, o *queue.Order) error {
+		if o == nil {
+			return nil
+		}
+		next = seq + 1
+		if o.Timestamp >= t {
+			found = seq
+			return errFound
+		}
+		return nil
+	}
+	for i, name := range segs {
+		f, err := openSegment(dir, name)
+		if err != nil {
+			return 0, err
+		}
+		if strings.HasSuffix(f.Name(), compressedExt) {
+			err = seekCompressed(f, aead, t, &next, match)
+		} else {
+			_, _, err = scan(f, aead, match)
+		}
+		f.Close()
+		if errors.Is(err, errFound) {
+			return found, nil
+		}
+		if err != nil && (!errors.Is(err, ErrCorrupt) || i != len(segs)-1) {
+			return 0, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if next == 0 {
+		next = 1
+	}
+	return next, nil
+}
+
+// seekCompressed runs match over the frames of a compressed segment that
+// may hold an order timestamped at t or later.
+func seekCompressed(f *os.File, aead cipher.AEAD, t uint64, next *uint64, match func(uint64, *queue.Order) error) error {
+	z, err := openCompressed(f)
+	if err != nil {
+		return err
+	}
+	for i, fi := range z.frames {
+		if fi.maxTime < t {
+			continue
+		}
+		raw, err := z.frame(i, aead)
+		if err != nil {
+			return err
+		}
+		if _, _, err := scanRecords(bytes.NewReader(raw), nil, 0, fi.first, match); err != nil {
+			return err
+		}
+	}
+	*next = max(*next, z.next)
+	return nil
+}
@@ -0,0 +1,149 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"oms/queue"
+)
+
+// ErrInDoubt is returned when an order was logged but the handoff did not
+// finish: it may or may not be on the queue. Do not resubmit it; call
+// Recover, which settles it one way or the other.
+var ErrInDoubt = errors.New("order handoff in doubt")
+
+// Ring is the view of the queue Recover needs to see what was published.
+// *queue.Queue implements it.
+type Ring interface {
+	queue.OrderQueue
+	Recent(n int) []queue.Order
+}
+
+// Publisher hands orders from the WAL to the queue exactly once.
+//
+// Publish appends the order and syncs the log, then enqueues it, then
+// appends a commit marker. An order is durable once the marker is written.
+// A crash between the steps leaves the order in doubt, and Recover resolves
+// it from the ring: the producer publishes in log order, so an in-doubt
+// order is either among the ring's recent slots or was never published.
+type Publisher struct {
+	mu     sync.Mutex
+	log    *Log
+	q      Ring
+	failed error
+	unpin  func() // keeps the in-doubt order from retention until Recover
+}
+
+// RecoveryStats reports how Recover settled in-doubt orders.
+type RecoveryStats struct {
+	Confirmed   int // found on the ring, only the marker was missing
+	Republished int // never reached the ring, enqueued again
+}
+
+// NewPublisher pairs a log and its queue. Call Recover before the first
+// Publish after a restart.
+func NewPublisher(l *Log, q Ring) *Publisher {
+	return &Publisher{log: l, q: q}
+}
+
+// Publish logs, enqueues and commits o, waiting out a full queue until ctx
+// is done. It returns the order's WAL sequence number.
+func (p *Publisher) Publish(ctx context.Context, o queue.Order) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failed != nil {
+		return 0, fmt.Errorf("%w: publisher needs recovery after: %v", ErrInDoubt, p.failed)
+	}
+	seq, err := p.log.Append(o)
+	if err != nil {
+		return 0, err
+	}
+	if err := p.log.Sync(); err != nil {
+		return p.fail(seq, err)
+	}
+	if err := enqueue(ctx, p.q, o); err != nil {
+		return p.fail(seq, err)
+	}
+	if err := p.log.Commit(seq); err != nil {
+		return p.fail(seq, err)
+	}
+	return seq, nil
+}
+
+func (p *Publisher) fail(seq uint64, err error) (uint64, error) {
+	p.failed = err
+	p.unpin = p.log.Pin(seq)
+	return seq, fmt.Errorf("%w: wal seq %d: %v", ErrInDoubt, seq, err)
+}
+
+// Recover scans the log for orders without a commit marker and settles each
+// one: confirmed if its fingerprint is among the ring's recent slots, so a
+// reused OrderID with other terms does not pass for it, otherwise enqueued
+// again. Either way a marker is written, so a second Recover finds
+// nothing to do.
+func (p *Publisher) Recover(ctx context.Context) (RecoveryStats, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var stats RecoveryStats
+	if err := p.log.Sync(); err != nil {
+		return stats, err
+	}
+	defer p.log.Pin(0)()
+	pending := make(map[uint64]queue.Order)
+	err := replay(p.log.dir, p.log.aead, 0, func(seq uint64, o *queue.Order) error {
+		if o == nil {
+			delete(pending, seq)
+		} else {
+			pending[seq] = *o
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	seqs := make([]uint64, 0, len(pending))
+	for seq := range pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	published := make(map[uint64]bool)
+	if len(seqs) > 0 {
+		for _, o := range p.q.Recent(int(p.q.Capacity())) {
+			published[o.Fingerprint()] = true
+		}
+	}
+	for _, seq := range seqs {
+		o := pending[seq]
+		if published[o.Fingerprint()] {
+			stats.Confirmed++
+		} else {
+			if err := enqueue(ctx, p.q, o); err != nil {
+				return stats, fmt.Errorf("republish wal seq %d: %w", seq, err)
+			}
+			stats.Republished++
+		}
+		if err := p.log.Commit(seq); err != nil {
+			return stats, err
+		}
+	}
+	if err := p.log.Sync(); err != nil {
+		return stats, err
+	}
+	p.failed = nil
+	if p.unpin != nil {
+		p.unpin()
+		p.unpin = nil
+	}
+	return stats, nil
+}
+
+func enqueue(ctx context.Context, q queue.OrderQueue, o queue.Order) error {
+	return queue.DefaultBackoff.Enqueue(ctx, q, o)
+}
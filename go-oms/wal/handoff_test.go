@@ -0,0 +1,140 @@
+package wal
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"oms/queue"
+)
+
+func TestRecoverSettlesInDoubtOrders(t *testing.T) {
+	dir := t.TempDir()
+	q, err := queue.CreateQueue(filepath.Join(dir, "orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	l, err := Open(filepath.Join(dir, "wal"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	p := NewPublisher(l, q)
+
+	if _, err := p.Publish(ctx, queue.Order{OrderID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// Crash after the enqueue but before the commit marker.
+	seq, _ := l.Append(queue.Order{OrderID: 2})
+	q.Enqueue(queue.Order{OrderID: 2})
+	// Crash after the log append but before the enqueue.
+	l.Append(queue.Order{OrderID: 3})
+	l.Close()
+
+	if l, err = Open(filepath.Join(dir, "wal"), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	p = NewPublisher(l, q)
+	stats, err := p.Recover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Confirmed != 1 || stats.Republished != 1 {
+		t.Fatalf("recover: %+v, want 1 confirmed (seq %d) and 1 republished", stats, seq)
+	}
+	if stats, _ := p.Recover(ctx); stats != (RecoveryStats{}) {
+		t.Fatalf("second recover: %+v, want nothing to do", stats)
+	}
+
+	var got []uint64
+	for _, o := range q.Recent(10) {
+		got = append(got, o.OrderID)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("ring holds %v, want [1 2 3] exactly once each", got)
+	}
+}
+
+func TestResendFromOrderID(t *testing.T) {
+	dir := t.TempDir()
+	q, err := queue.CreateQueue(filepath.Join(dir, "orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	l, err := Open(filepath.Join(dir, "wal"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	ctx := context.Background()
+	p := NewPublisher(l, q)
+	for id := uint64(10); id < 15; id++ {
+		if _, err := p.Publish(ctx, queue.Order{OrderID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := queue.ResendFrom(12, 0)
+	n, err := p.Resend(ctx, req.OrderID)
+	if err != nil || n != 3 {
+		t.Fatalf("resend: %d orders, err %v; want 3", n, err)
+	}
+	var got []uint64
+	for _, o := range q.Recent(3) {
+		got = append(got, o.OrderID)
+	}
+	if got[0] != 12 || got[2] != 14 {
+		t.Fatalf("resent %v, want [12 13 14]", got)
+	}
+}
+
+func TestAnswerResends(t *testing.T) {
+	dir := t.TempDir()
+	q, err := queue.CreateQueue(filepath.Join(dir, "orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	l, err := Open(filepath.Join(dir, "wal"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	p := NewPublisher(l, q)
+	for id := uint64(1); id <= 4; id++ {
+		if _, err := p.Publish(context.Background(), queue.Order{OrderID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 4 {
+		q.Dequeue() // the engine took them all
+	}
+
+	// the engine finds it lost 3 and on, and asks over the status ring
+	status := queue.NewInMemory(16)
+	status.Enqueue(queue.Order{OrderID: 1, Status: queue.StatusFilled})
+	status.Enqueue(queue.ResendFrom(3, 0))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.AnswerResends(ctx, status, func(from uint64, n int) {
+			if from != 3 || n != 2 {
+				t.Errorf("resent %d from %d, want 2 from 3", n, from)
+			}
+			cancel()
+		})
+	}()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("AnswerResends: %v", err)
+	}
+	var got []uint64
+	for o, _ := q.Dequeue(); o != nil; o, _ = q.Dequeue() {
+		got = append(got, o.OrderID)
+	}
+	if len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Fatalf("ring holds %v after the resend, want [3 4]", got)
+	}
+}
@@ -0,0 +1,122 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// LZ4 block format, as the reference library's LZ4_compress_default writes
+// and LZ4_decompress_safe reads: sequences of literals and a back
+// reference, the last sequence literals only. The frame around it is the
+// compressed segment's own, so only the block format is needed here. The
+// compressor is greedy with a single hash probe, which is what buys LZ4
+// its speed; zstd is there when the ratio matters more. Both directions
+// are checked against blocks from the reference library in testdata/lz4.
+
+const (
+	lz4MinMatch     = 4
+	lz4MFLimit      = 12 // a match starts at least this far from the end
+	lz4LastLiterals = 5  // and the block ends with this many literals
+	lz4MaxOffset    = 65535
+	lz4HashLog      = 14
+)
+
+var errLZ4 = errors.New("lz4: corrupt block")
+
+// lz4Compress appends src compressed to dst.
+func lz4Compress(dst, src []byte) []byte {
+	var table [1 << lz4HashLog]int32 // position+1 of the last 4 bytes hashing here
+	anchor, i := 0, 0
+	for i < len(src)-lz4MFLimit {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := seq * 2654435761 >> (32 - lz4HashLog)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if cand < 0 || i-cand > lz4MaxOffset || binary.LittleEndian.Uint32(src[cand:]) != seq {
+			i++
+			continue
+		}
+		n := lz4MinMatch
+		for end := len(src) - lz4LastLiterals; i+n < end && src[cand+n] == src[i+n]; n++ {
+		}
+		for i > anchor && cand > 0 && src[i-1] == src[cand-1] {
+			i, cand, n = i-1, cand-1, n+1
+		}
+		dst = lz4Sequence(dst, src[anchor:i], min(len(src[anchor:i]), 15)<<4|min(n-lz4MinMatch, 15))
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(i-cand))
+		dst = lz4Length(dst, n-lz4MinMatch)
+		i += n
+		anchor = i
+	}
+	return lz4Sequence(dst, src[anchor:], min(len(src[anchor:]), 15)<<4)
+}
+
+// lz4Sequence appends a sequence's token and literals.
+func lz4Sequence(dst, literals []byte, token int) []byte {
+	dst = append(dst, byte(token))
+	dst = lz4Length(dst, len(literals))
+	return append(dst, literals...)
+}
+
+// lz4Length appends the bytes that extend a length of 15 or more past its
+// token nibble.
+func lz4Length(dst []byte, n int) []byte {
+	if n < 15 {
+		return dst
+	}
+	for n -= 15; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4Decompress appends src decompressed to dst, refusing to grow it by
+// more than size bytes.
+func lz4Decompress(dst, src []byte, size int) ([]byte, error) {
+	base, limit := len(dst), len(dst)+size
+	i := 0
+	length := func(n int) (int, error) {
+		if n < 15 {
+			return n, nil
+		}
+		for {
+			if i >= len(src) {
+				return 0, errLZ4
+			}
+			b := src[i]
+			i++
+			n += int(b)
+			if b != 255 {
+				return n, nil
+			}
+		}
+	}
+	for i < len(src) {
+		token := src[i]
+		i++
+		lit, err := length(int(token >> 4))
+		if err != nil || lit > len(src)-i || len(dst)+lit > limit {
+			return nil, errLZ4
+		}
+		dst = append(dst, src[i:i+lit]...)
+		i += lit
+		if i == len(src) {
+			return dst, nil
+		}
+		if len(src)-i < 2 {
+			return nil, errLZ4
+		}
+		off := int(binary.LittleEndian.Uint16(src[i:]))
+		i += 2
+		n, err := length(int(token & 15))
+		n += lz4MinMatch
+		if err != nil || off == 0 || off > len(dst)-base || len(dst)+n > limit {
+			return nil, errLZ4
+		}
+		// byte by byte: a match may overlap what it copies
+		for from := len(dst) - off; n > 0; n, from = n-1, from+1 {
+			dst = append(dst, dst[from])
+		}
+	}
+	return nil, errLZ4 // no final literals sequence
+}
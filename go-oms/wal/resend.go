@@ -0,0 +1,87 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"oms/queue"
+)
+
+// Resend republishes every committed order with OrderID >= fromID, in log
+// order. Resent orders are not logged again: they are copies of records
+// already in the WAL, and the consumer drops ids it has seen. Publish is
+// blocked for the duration so resent and new orders don't interleave.
+func (p *Publisher) Resend(ctx context.Context, fromID uint64) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failed != nil {
+		return 0, fmt.Errorf("%w: publisher needs recovery after: %v", ErrInDoubt, p.failed)
+	}
+	// The whole log is the resend window: retention keeps off it until
+	// the resend is done.
+	defer p.log.Pin(0)()
+	// Collect first: replay must not hold segment files open while
+	// enqueue waits on a slow consumer.
+	var orders []queue.Order
+	var seqs []uint64
+	committed := make(map[uint64]bool)
+	err := replay(p.log.dir, p.log.aead, 0, func(seq uint64, o *queue.Order) error {
+		switch {
+		case o == nil:
+			committed[seq] = true
+		case o.OrderID >= fromID:
+			orders = append(orders, *o)
+			seqs = append(seqs, seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i, o := range orders {
+		if !committed[seqs[i]] {
+			continue // in doubt; Recover owns it
+		}
+		if err := enqueue(ctx, p.q, o); err != nil {
+			return sent, fmt.Errorf("resend order %d: %w", o.OrderID, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// AnswerResends consumes the status ring until ctx is done, answering each
+// MsgResend a consumer posts there, on finding a gap in the order ids, with
+// Resend; resent, when set, is told of each. Every other record is
+// dropped, so run it only where nothing else consumes the status ring,
+// e.g. in a producer feeding the engine directly. It returns ctx's error,
+// or the first error dequeuing or resending.
+func (p *Publisher) AnswerResends(ctx context.Context, status queue.OrderQueue, resent func(fromID uint64, n int)) error {
+	for {
+		rec, err := status.Dequeue()
+		if err != nil {
+			return fmt.Errorf("status ring: %w", err)
+		}
+		if rec == nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			time.Sleep(50 * time.Microsecond)
+			continue
+		}
+		if rec.MsgType != queue.MsgResend {
+			continue
+		}
+		n, err := p.Resend(ctx, rec.OrderID)
+		if err != nil {
+			return err
+		}
+		if resent != nil {
+			resent(rec.OrderID, n)
+		}
+	}
+}
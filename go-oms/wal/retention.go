@@ -0,0 +1,113 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention bounds how much of the log is kept on disk. A soak test left
+// running logs until the disk is full, and then every Append fails;
+// retention drops the oldest segments first instead, but only whole sealed
+// ones, only from the start of the log, so what is left replays without a
+// gap, and never one still pinned (see Pin). Zero fields do not limit.
+type Retention struct {
+	// MaxAge drops sealed segments last written longer ago than this.
+	MaxAge time.Duration
+	// MaxSize drops the oldest sealed segments while the log's segments
+	// take more bytes than this. The segment being appended to always
+	// stays, so the log can exceed it by up to one segment.
+	MaxSize int64
+}
+
+// PruneStats describes what a Prune dropped.
+type PruneStats struct {
+	Segments int
+	Bytes    int64
+	First    uint64 // the first sequence number left in the log
+}
+
+// Pin keeps every record from seq on from being dropped by retention until
+// the returned unpin is called. Resend and Recover pin what they replay,
+// and an in-doubt order stays pinned until Recover settles it.
+func (l *Log) Pin(seq uint64) (unpin func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pins == nil {
+		l.pins = make(map[uint64]int)
+	}
+	l.pins[seq]++
+	return sync.OnceFunc(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.pins[seq]--; l.pins[seq] == 0 {
+			delete(l.pins, seq)
+		}
+	})
+}
+
+// Prune applies Options.Retention now. The log prunes itself each time it
+// rolls to a new segment; call Prune on a timer too if MaxAge should hold
+// while the log is idle.
+func (l *Log) Prune() (PruneStats, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.prune(time.Now())
+}
+
+// prune drops the oldest segments the retention allows. l.mu is held.
+func (l *Log) prune(now time.Time) (PruneStats, error) {
+	var stats PruneStats
+	r := l.opts.Retention
+	if r == (Retention{}) {
+		return stats, nil
+	}
+	segs, err := segments(l.dir)
+	if err != nil {
+		return stats, err
+	}
+	infos := make([]os.FileInfo, len(segs))
+	var total int64
+	for i, name := range segs {
+		infos[i], err = os.Stat(filepath.Join(l.dir, name))
+		if errors.Is(err, os.ErrNotExist) && strings.HasSuffix(name, segmentExt) {
+			// compressed since it was listed
+			segs[i] = strings.TrimSuffix(name, segmentExt) + compressedExt
+			infos[i], err = os.Stat(filepath.Join(l.dir, segs[i]))
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to stat wal segment: %w", err)
+		}
+		total += infos[i].Size()
+	}
+	floor := l.nextSeq
+	for seq := range l.pins {
+		floor = min(floor, seq)
+	}
+	// the last segment is the one being appended to
+	for i := 0; i < len(segs)-1; i++ {
+		// a segment's records run up to the next one's first seq
+		end, _ := segmentSeq(segs[i+1])
+		old := r.MaxAge > 0 && now.Sub(infos[i].ModTime()) > r.MaxAge
+		big := r.MaxSize > 0 && total > r.MaxSize
+		seq, _ := segmentSeq(segs[i])
+		if !old && !big || end > floor || l.busy[seq] {
+			break
+		}
+		if err := os.Remove(filepath.Join(l.dir, segs[i])); err != nil {
+			return stats, fmt.Errorf("failed to remove wal segment: %w", err)
+		}
+		total -= infos[i].Size()
+		stats.Segments++
+		stats.Bytes += infos[i].Size()
+		stats.First = end
+	}
+	if stats.Segments > 0 {
+		syncDir(l.dir)
+	}
+	return stats, nil
+}
@@ -0,0 +1,103 @@
+package wal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+// checkContiguous replays dir and fails unless it runs from first to last
+// without a gap.
+func checkContiguous(t *testing.T, dir string, first, last uint64) {
+	t.Helper()
+	want := first
+	err := Replay(dir, Options{}, 0, func(seq uint64, o queue.Order) error {
+		if seq != want || o.OrderID != want {
+			t.Fatalf("replay got seq %d order %d, want %d", seq, o.OrderID, want)
+		}
+		want++
+		return nil
+	})
+	if err != nil || want != last+1 {
+		t.Fatalf("replayed %d..%d: %v, want up to %d", first, want-1, err, last)
+	}
+}
+
+func TestRetentionMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	const maxSize = 4096
+	l, err := Open(dir, Options{SegmentSize: 1024, Retention: Retention{MaxSize: maxSize}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 500; i++ {
+		if _, err := l.Append(queue.Order{OrderID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs, _ := segments(dir)
+	var size int64
+	for _, s := range segs {
+		info, _ := os.Stat(filepath.Join(dir, s))
+		size += info.Size()
+	}
+	// pruned at the last roll, before the new segment filled
+	if size > maxSize+1024+orderSize+recordHeaderSize {
+		t.Errorf("%d segments take %d bytes, want about %d", len(segs), size, maxSize)
+	}
+	first, _ := segmentSeq(segs[0])
+	if first == 1 {
+		t.Fatalf("segments %v: nothing dropped", segs)
+	}
+	checkContiguous(t, dir, first, 500)
+}
+
+func TestRetentionKeepsPinnedSegments(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, Options{SegmentSize: 1024, Retention: Retention{MaxAge: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := uint64(1); i <= 200; i++ {
+		l.Append(queue.Order{OrderID: i})
+	}
+	segs, _ := segments(dir)
+	old := time.Now().Add(-2 * time.Hour)
+	for _, s := range segs {
+		os.Chtimes(filepath.Join(dir, s), old, old)
+	}
+
+	unpin := l.Pin(100)
+	stats, err := l.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Segments == 0 || stats.First > 100 {
+		t.Fatalf("prune with seq 100 pinned: %+v", stats)
+	}
+	checkContiguous(t, dir, stats.First, 200)
+
+	unpin()
+	unpin() // a second call is a no-op
+	if stats, err = l.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	left, _ := segments(dir)
+	if len(left) != 1 {
+		t.Fatalf("segments %v after unpin, want only the one being appended to", left)
+	}
+	if first, _ := segmentSeq(left[0]); stats.First != first {
+		t.Errorf("prune reports the log starting at %d, want %d", stats.First, first)
+	}
+	if seq, err := l.Append(queue.Order{OrderID: 201}); err != nil || seq != 201 {
+		t.Fatalf("append after prune: seq %d, %v", seq, err)
+	}
+}
@@ -0,0 +1,555 @@
+// Package wal is an append-only, segmented log of every order handed to the
+// queue. It doubles as the capture recorder: segments can be replayed from
+// any sequence number, and with a key configured each record is sealed with
+// AES-GCM so client order details are not readable on a shared disk.
+package wal
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+const (
+	segmentMagic   = 0x4F4D5357 // "OMSW"
+	segmentVersion = 1
+	flagEncrypted  = 1
+
+	segmentHeaderSize = 16 // magic u32, version u16, flags u16, first seq u64
+	recordHeaderSize  = 16 // seq u64, payload length u32, crc u32
+	orderSize         = 64
+	markerSize        = 8 // commit marker body: the committed seq again
+	segmentExt        = ".wal"
+
+	// DefaultSegmentSize is used when Options.SegmentSize is zero.
+	DefaultSegmentSize = 64 << 20
+
+	// legacyOrderSize is the order record before Flags was added. The new
+	// fields sit at the end and are zero by default, so such a record is
+	// read by zero-extending it.
+	legacyOrderSize = 48
+)
+
+// ErrCorrupt is returned by Replay for a damaged record before the tail of
+// the last segment. A torn final record is expected after a crash and is
+// truncated by Open instead.
+var ErrCorrupt = errors.New("wal record corrupted")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Options configure a Log.
+type Options struct {
+	// SegmentSize is the size at which the log rolls to a new segment file.
+	SegmentSize int64
+	// Key enables encryption at rest. Nil writes plaintext segments.
+	Key KeySource
+	// Compression compresses each segment once the log rolls past it, in
+	// the background; see compress.go. Replay reads compressed and plain
+	// segments alike, whatever it is set to.
+	Compression Compression
+	// Retention drops the oldest segments each time the log rolls; see
+	// retention.go. The zero value keeps everything.
+	Retention Retention
+}
+
+// Log appends orders to the newest segment in a directory. Sequence numbers
+// start at 1 and are contiguous across segments. Commit markers (see
+// Publisher) are interleaved with orders and carry the seq they commit.
+type Log struct {
+	mu      sync.Mutex
+	dir     string
+	opts    Options
+	aead    cipher.AEAD
+	seg     *os.File
+	size    int64
+	nextSeq uint64
+	buf     []byte
+
+	compressing sync.WaitGroup
+	compressErr error           // the first failure, reported by Close
+	busy        map[uint64]bool // segments being compressed, by first seq
+	pins        map[uint64]int  // Pin counts by seq
+	pruneErr    error           // the first failure, reported by Close
+}
+
+// Open opens or creates the log in dir, truncating a torn record left at the
+// end of the last segment by a crash.
+func Open(dir string, opts Options) (*Log, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = DefaultSegmentSize
+	}
+	aead, err := newAEAD(opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create wal directory: %w", err)
+	}
+	removeLeftovers(dir)
+	l := &Log{dir: dir, opts: opts, aead: aead, nextSeq: 1}
+
+	segs, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segs) == 0 {
+		if err := l.roll(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	// compress what an earlier run sealed but did not get to
+	for _, name := range segs[:len(segs)-1] {
+		l.compress(name)
+	}
+	if strings.HasSuffix(segs[len(segs)-1], compressedExt) {
+		f, err := os.Open(filepath.Join(dir, segs[len(segs)-1]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open wal segment: %w", err)
+		}
+		z, err := openCompressed(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		l.nextSeq = z.next
+		if err := l.roll(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+
+	last := filepath.Join(dir, segs[len(segs)-1])
+	f, err := os.OpenFile(last, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wal segment: %w", err)
+	}
+	end, next, err := scan(f, aead, func(uint64, *queue.Order) error { return nil })
+	if err != nil && !errors.Is(err, ErrCorrupt) {
+		f.Close()
+		return nil, err
+	}
+	if end == 0 {
+		// Crashed while rolling, before the header made it to disk.
+		f.Close()
+		if err := os.Remove(last); err != nil {
+			return nil, err
+		}
+		l.nextSeq, _ = segmentSeq(segs[len(segs)-1])
+		if err := l.roll(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to truncate torn wal record: %w", err)
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.seg, l.size, l.nextSeq = f, end, next
+	return l, nil
+}
+
+// Append writes o and returns its sequence number. The record is in the OS
+// page cache on return; call Sync to make it durable.
+func (l *Log) Append(o queue.Order) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seg == nil {
+		return 0, queue.ErrClosed
+	}
+	if l.size >= l.opts.SegmentSize {
+		if err := l.roll(); err != nil {
+			return 0, err
+		}
+	}
+
+	var plain [orderSize]byte
+	if _, err := binary.Encode(plain[:], binary.LittleEndian, &o); err != nil {
+		return 0, err
+	}
+	seq := l.nextSeq
+	if err := l.write(seq, plain[:]); err != nil {
+		return 0, err
+	}
+	l.nextSeq++
+	return seq, nil
+}
+
+// Commit appends a marker recording that order seq reached the queue. It
+// never rolls the segment, so every segment starts with an order.
+func (l *Log) Commit(seq uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seg == nil {
+		return queue.ErrClosed
+	}
+	if seq >= l.nextSeq {
+		return fmt.Errorf("commit of unwritten wal record %d", seq)
+	}
+	var plain [markerSize]byte
+	binary.LittleEndian.PutUint64(plain[:], seq)
+	return l.write(seq, plain[:])
+}
+
+func (l *Log) write(seq uint64, plain []byte) error {
+	rec, err := l.encode(seq, plain)
+	if err != nil {
+		return err
+	}
+	if _, err := l.seg.Write(rec); err != nil {
+		return fmt.Errorf("failed to append wal record %d: %w", seq, err)
+	}
+	l.size += int64(len(rec))
+	return nil
+}
+
+// NextSeq is the sequence number the next Append will return.
+func (l *Log) NextSeq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextSeq
+}
+
+// Sync flushes the current segment to stable storage.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seg == nil {
+		return queue.ErrClosed
+	}
+	return l.seg.Sync()
+}
+
+// Close syncs and closes the current segment, and waits for segments being
+// compressed. A segment that failed to compress stays plain; Close reports
+// the first such failure.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	var err error
+	if l.seg != nil {
+		err = l.seg.Sync()
+		if cerr := l.seg.Close(); err == nil {
+			err = cerr
+		}
+		l.seg = nil
+	}
+	l.mu.Unlock()
+	l.compressing.Wait()
+	if err == nil && l.compressErr != nil {
+		err = fmt.Errorf("failed to compress wal segment: %w", l.compressErr)
+		l.compressErr = nil
+	}
+	if err == nil && l.pruneErr != nil {
+		err = l.pruneErr
+		l.pruneErr = nil
+	}
+	return err
+}
+
+// compress compresses the sealed segment name in the background, if the
+// log is configured to and it is plain. Retention leaves it alone meanwhile.
+// l.mu is held, or Open has not returned yet.
+func (l *Log) compress(name string) {
+	if l.opts.Compression == NoCompression || !strings.HasSuffix(name, segmentExt) {
+		return
+	}
+	seq, _ := segmentSeq(name)
+	if l.busy == nil {
+		l.busy = make(map[uint64]bool)
+	}
+	l.busy[seq] = true
+	l.compressing.Go(func() {
+		err := compressSegment(l.dir, name, l.aead, l.opts.Compression)
+		l.mu.Lock()
+		if err != nil && l.compressErr == nil {
+			l.compressErr = err
+		}
+		delete(l.busy, seq)
+		l.mu.Unlock()
+	})
+}
+
+// roll closes the current segment and starts one named after nextSeq, then
+// applies the retention.
+func (l *Log) roll() error {
+	if l.seg != nil {
+		if err := l.seg.Sync(); err != nil {
+			return err
+		}
+		if err := l.seg.Close(); err != nil {
+			return err
+		}
+		l.compress(filepath.Base(l.seg.Name()))
+		l.seg = nil
+	}
+
+	name := filepath.Join(l.dir, fmt.Sprintf("%020d%s", l.nextSeq, segmentExt))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create wal segment: %w", err)
+	}
+	var hdr [segmentHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:], segmentMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], segmentVersion)
+	if l.aead != nil {
+		binary.LittleEndian.PutUint16(hdr[6:], flagEncrypted)
+	}
+	binary.LittleEndian.PutUint64(hdr[8:], l.nextSeq)
+	if _, err := f.Write(hdr[:]); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write wal segment header: %w", err)
+	}
+	l.seg, l.size = f, segmentHeaderSize
+	// a failed prune is retried on the next roll; it must not fail Append
+	if _, err := l.prune(time.Now()); err != nil && l.pruneErr == nil {
+		l.pruneErr = err
+	}
+	return nil
+}
+
+func (l *Log) encode(seq uint64, plain []byte) ([]byte, error) {
+	rec, err := appendRecord(l.buf[:0], l.aead, seq, plain)
+	if err != nil {
+		return nil, err
+	}
+	l.buf = rec
+	return rec, nil
+}
+
+// appendRecord appends the record for plain to dst, sealed if aead is set.
+func appendRecord(dst []byte, aead cipher.AEAD, seq uint64, plain []byte) ([]byte, error) {
+	payloadLen := len(plain)
+	if aead != nil {
+		payloadLen += aead.NonceSize() + aead.Overhead()
+	}
+	start := len(dst)
+	rec := binary.LittleEndian.AppendUint64(dst, seq)
+	rec = binary.LittleEndian.AppendUint32(rec, uint32(payloadLen))
+	rec = append(rec, 0, 0, 0, 0) // crc, filled in below
+	if aead != nil {
+		var err error
+		if rec, err = seal(aead, rec, plain, rec[start:start+12]); err != nil {
+			return nil, err
+		}
+	} else {
+		rec = append(rec, plain...)
+	}
+	binary.LittleEndian.PutUint32(rec[start+12:], recordCRC(rec[start:]))
+	return rec, nil
+}
+
+func recordCRC(rec []byte) uint32 {
+	crc := crc32.Update(0, crcTable, rec[:12])
+	return crc32.Update(crc, crcTable, rec[recordHeaderSize:])
+}
+
+// Replay calls fn for every record with seq >= from, in order, across all
+// segments in dir. Records are only returned once fully written, so it is
+// safe to replay a log another process is appending to.
+func Replay(dir string, opts Options, from uint64, fn func(seq uint64, o queue.Order) error) error {
+	aead, err := newAEAD(opts.Key)
+	if err != nil {
+		return err
+	}
+	return replay(dir, aead, from, func(seq uint64, o *queue.Order) error {
+		if o == nil {
+			return nil
+		}
+		return fn(seq, *o)
+	})
+}
+
+// replay is Replay including commit markers, which are passed as a nil order.
+func replay(dir string, aead cipher.AEAD, from uint64, fn func(uint64, *queue.Order) error) error {
+	segs, err := segments(dir)
+	if err != nil {
+		return err
+	}
+	// Skip segments that end before from: each is named after its first seq.
+	start := 0
+	for i, name := range segs {
+		first, _ := segmentSeq(name)
+		if first <= from {
+			start = i
+		}
+	}
+
+	for i := start; i < len(segs); i++ {
+		f, err := openSegment(dir, segs[i])
+		if err != nil {
+			return err
+		}
+		after := func(seq uint64, o *queue.Order) error {
+			if seq < from {
+				return nil
+			}
+			return fn(seq, o)
+		}
+		if strings.HasSuffix(f.Name(), compressedExt) {
+			err = scanCompressed(f, aead, from, after)
+		} else {
+			_, _, err = scan(f, aead, after)
+		}
+		f.Close()
+		// A torn record is only legitimate at the very end of the log.
+		if err != nil && (!errors.Is(err, ErrCorrupt) || i != len(segs)-1) {
+			return fmt.Errorf("%s: %w", segs[i], err)
+		}
+	}
+	return nil
+}
+
+// scan validates a segment header and walks its records, passing commit
+// markers as a nil order. It returns the offset just past the last good
+// record and the order sequence number following it; a short or mismatching
+// record stops the scan with ErrCorrupt.
+func scan(f *os.File, aead cipher.AEAD, fn func(uint64, *queue.Order) error) (int64, uint64, error) {
+	r := bufio.NewReader(f)
+	var hdr [segmentHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, 0, fmt.Errorf("%w: short segment header", ErrCorrupt)
+	}
+	if binary.LittleEndian.Uint32(hdr[0:]) != segmentMagic {
+		return 0, 0, fmt.Errorf("%s: not a wal segment", f.Name())
+	}
+	if v := binary.LittleEndian.Uint16(hdr[4:]); v != segmentVersion {
+		return 0, 0, fmt.Errorf("%s: unsupported wal version %d", f.Name(), v)
+	}
+	encrypted := binary.LittleEndian.Uint16(hdr[6:])&flagEncrypted != 0
+	switch {
+	case encrypted && aead == nil:
+		return 0, 0, ErrEncrypted
+	case !encrypted && aead != nil:
+		return 0, 0, ErrNotEncrypted
+	}
+	return scanRecords(r, aead, segmentHeaderSize, binary.LittleEndian.Uint64(hdr[8:]), fn)
+}
+
+// scanRecords walks records from r, the first at offset off and the first
+// order among them numbered next, as scan does.
+func scanRecords(r io.Reader, aead cipher.AEAD, off int64, next uint64, fn func(uint64, *queue.Order) error) (int64, uint64, error) {
+	rec := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, rec[:recordHeaderSize]); err != nil {
+			if err == io.EOF {
+				return off, next, nil
+			}
+			return off, next, fmt.Errorf("%w: torn record header at offset %d", ErrCorrupt, off)
+		}
+		seq := binary.LittleEndian.Uint64(rec[0:])
+		n := int(binary.LittleEndian.Uint32(rec[8:]))
+		if seq > next || n > 1024 {
+			return off, next, fmt.Errorf("%w: bad record header at offset %d", ErrCorrupt, off)
+		}
+		rec = append(rec[:recordHeaderSize], make([]byte, n)...)
+		if _, err := io.ReadFull(r, rec[recordHeaderSize:]); err != nil {
+			return off, next, fmt.Errorf("%w: torn record %d", ErrCorrupt, seq)
+		}
+		if recordCRC(rec) != binary.LittleEndian.Uint32(rec[12:]) {
+			return off, next, fmt.Errorf("%w: checksum mismatch on record %d", ErrCorrupt, seq)
+		}
+
+		plain := rec[recordHeaderSize:]
+		if aead != nil {
+			var err error
+			if plain, err = open(aead, plain, rec[:12]); err != nil {
+				return off, next, fmt.Errorf("record %d: %w", seq, err)
+			}
+		}
+		if len(plain) == legacyOrderSize {
+			plain = append(plain[:legacyOrderSize:legacyOrderSize], make([]byte, orderSize-legacyOrderSize)...)
+		}
+		switch {
+		case len(plain) == orderSize && seq == next:
+			var o queue.Order
+			if _, err := binary.Decode(plain, binary.LittleEndian, &o); err != nil {
+				return off, next, fmt.Errorf("%w: record %d: %v", ErrCorrupt, seq, err)
+			}
+			if err := fn(seq, &o); err != nil {
+				return off, next, err
+			}
+			next++
+		case len(plain) == markerSize && seq < next && binary.LittleEndian.Uint64(plain) == seq:
+			if err := fn(seq, nil); err != nil {
+				return off, next, err
+			}
+		default:
+			return off, next, fmt.Errorf("%w: unexpected record %d at offset %d", ErrCorrupt, seq, off)
+		}
+		off += int64(len(rec))
+	}
+}
+
+// segments lists segment file names in dir, oldest first, plain and
+// compressed. A plain segment whose compressed copy was installed by a
+// compression that stopped short of removing it is left out.
+func segments(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wal directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if _, ok := segmentSeq(e.Name()); ok && e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names) // zero-padded, so lexical order is sequence order
+	out := names[:0]
+	for i, name := range names {
+		if i+1 < len(names) && names[i+1] == strings.TrimSuffix(name, segmentExt)+compressedExt {
+			continue
+		}
+		out = append(out, name)
+	}
+	return out, nil
+}
+
+// openSegment opens the segment name in dir, or its compressed copy if it
+// was compressed since it was listed.
+func openSegment(dir, name string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) && strings.HasSuffix(name, segmentExt) {
+		f, err = os.Open(filepath.Join(dir, strings.TrimSuffix(name, segmentExt)+compressedExt))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wal segment: %w", err)
+	}
+	return f, nil
+}
+
+func segmentSeq(name string) (uint64, bool) {
+	base, ok := strings.CutSuffix(name, segmentExt)
+	if !ok {
+		base, ok = strings.CutSuffix(name, compressedExt)
+	}
+	if !ok || len(base) != 20 {
+		return 0, false
+	}
+	var seq uint64
+	for _, c := range base {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		seq = seq*10 + uint64(c-'0')
+	}
+	return seq, true
+}
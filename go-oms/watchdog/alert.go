@@ -0,0 +1,49 @@
+package watchdog
+
+import (
+	"log"
+	"time"
+
+	"oms/alertpost"
+)
+
+// Event is what an Alert reports.
+type Event string
+
+const (
+	EventStarted       Event = "started"        // the watchdog started the process
+	EventDown          Event = "down"           // no live attachment in its role, or it exited
+	EventStalled       Event = "stalled"        // a consumer left orders waiting for longer than its stall
+	EventRecovered     Event = "recovered"      // up again after down or stalled
+	EventRestarted     Event = "restarted"      // started again after being down
+	EventRestartFailed Event = "restart_failed" // the command could not be started
+	EventHalted        Event = "halted"         // the session was halted because the engine is down
+	EventHaltFailed    Event = "halt_failed"    // and halting it failed
+	EventOrphan        Event = "orphan"         // a process died without detaching from the queue
+)
+
+// Alert is one event for one process.
+type Alert struct {
+	Process string    `json:"process"`
+	Event   Event     `json:"event"`
+	Detail  string    `json:"detail,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// LogAlerts returns a hook that logs every alert with prefix.
+func LogAlerts(prefix string) func(Alert) {
+	return func(a Alert) {
+		if a.Detail == "" {
+			log.Printf("%s %s %s", prefix, a.Process, a.Event)
+			return
+		}
+		log.Printf("%s %s %s: %s", prefix, a.Process, a.Event, a.Detail)
+	}
+}
+
+// Webhook returns a hook that POSTs every alert to url as JSON. Posts run
+// in the background so a slow receiver never holds up Check; failures are
+// logged.
+func Webhook(url string) func(Alert) {
+	return alertpost.Webhook[Alert](url, "[WATCHDOG]")
+}
@@ -0,0 +1,136 @@
+package watchdog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a watchdog file:
+//
+//	interval: 1s
+//	admin: {url: "http://127.0.0.1:8081"}   # token from OMS_ADMIN_TOKEN
+//	webhook: "https://alerts.example/oms"
+//	processes:
+//	  - name: engine
+//	    queue: /run/user/1000/oms/orders
+//	    role: consumer
+//	    stall: 5s
+//	    engine: true
+//	    command: [/opt/oms/rust_me, /run/user/1000/oms/orders]
+//	  - name: broker
+//	    queue: /run/user/1000/oms/orders
+//	    role: producer
+//	    command: [/opt/oms/omsbroker]
+type Config struct {
+	Interval  time.Duration `yaml:"interval"` // default 1s
+	Admin     Admin         `yaml:"admin"`
+	Webhook   string        `yaml:"webhook"` // POST every alert here as JSON
+	Processes []Process     `yaml:"processes"`
+}
+
+// Admin is where the watchdog halts the session, see package admin.
+type Admin struct {
+	URL      string `yaml:"url"`
+	TokenEnv string `yaml:"token_env"` // default OMS_ADMIN_TOKEN
+}
+
+// Process is one producer or consumer the watchdog supervises.
+type Process struct {
+	Name string `yaml:"name"`
+	// Queue is the ring the process attaches to, and Role which side of it
+	// it is on: "producer" or "consumer". Its heartbeat is a live entry
+	// with that role in the queue's registry and, for a consumer, a tail
+	// that moves whenever there is work.
+	Queue string `yaml:"queue"`
+	Role  string `yaml:"role"`
+	// Stall is how long a consumer may leave orders waiting without
+	// consuming any before it counts as down; 0 never.
+	Stall time.Duration `yaml:"stall"`
+	// Engine marks the matching engine: while it is down the session is
+	// halted, and it stays halted for an operator to reopen.
+	Engine bool `yaml:"engine"`
+	// Command, when set, is started by the watchdog and restarted whenever
+	// the process is down, waiting Backoff, doubling up to MaxBackoff,
+	// between attempts. Without it the process is only watched.
+	Command    []string      `yaml:"command"`
+	Backoff    time.Duration `yaml:"backoff"`     // default 1s
+	MaxBackoff time.Duration `yaml:"max_backoff"` // default 1m
+	// Grace is how long a started process has to attach before it counts
+	// as down, and how long a stopped one has to exit before SIGKILL.
+	Grace time.Duration `yaml:"grace"` // default 5s
+}
+
+// Load reads and validates a watchdog file.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates a watchdog file, filling in defaults. Unknown
+// keys are errors.
+func Parse(data []byte) (Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.Admin.TokenEnv == "" {
+		cfg.Admin.TokenEnv = "OMS_ADMIN_TOKEN"
+	}
+	for i := range cfg.Processes {
+		p := &cfg.Processes[i]
+		if p.Backoff == 0 {
+			p.Backoff = time.Second
+		}
+		if p.MaxBackoff == 0 {
+			p.MaxBackoff = time.Minute
+		}
+		if p.Grace == 0 {
+			p.Grace = 5 * time.Second
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+func (cfg Config) Validate() error {
+	if cfg.Interval < 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if len(cfg.Processes) == 0 {
+		return fmt.Errorf("no processes")
+	}
+	names := make(map[string]bool)
+	for _, p := range cfg.Processes {
+		switch {
+		case p.Name == "" || names[p.Name]:
+			return fmt.Errorf("process name %q missing or repeated", p.Name)
+		case p.Queue == "":
+			return fmt.Errorf("process %s: no queue", p.Name)
+		case p.Role != "producer" && p.Role != "consumer":
+			return fmt.Errorf("process %s: role %q is not producer or consumer", p.Name, p.Role)
+		case p.Stall < 0 || p.Stall > 0 && p.Role != "consumer":
+			return fmt.Errorf("process %s: stall applies to consumers only", p.Name)
+		case p.Engine && cfg.Admin.URL == "":
+			return fmt.Errorf("process %s: an engine needs admin.url to halt the session", p.Name)
+		case p.Backoff < 0 || p.MaxBackoff < p.Backoff || p.Grace < 0:
+			return fmt.Errorf("process %s: backoff %v-%v, grace %v", p.Name, p.Backoff, p.MaxBackoff, p.Grace)
+		}
+		names[p.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+// Package watchdog supervises the processes on either side of the OMS
+// queues. A process's heartbeat is the queue itself: a live entry with its
+// role in the queue's registry of attached processes (see queue.Attached)
+// and, for a consumer, a tail that moves whenever there are orders waiting.
+// A process whose heartbeat stops is reported down; the watchdog restarts
+// it if it started it, and halts the session while the matching engine is
+// down, so the gateways stop accepting orders nobody would match.
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"oms/admin"
+	"oms/queue"
+)
+
+// Watchdog checks every configured process once per Check. Build one with
+// New.
+type Watchdog struct {
+	// Halt moves the session to halted; AdminHalt builds one from the
+	// config. When nil, an engine going down only raises alerts.
+	Halt func() error
+
+	interval  time.Duration
+	procs     []*proc
+	hooks     []func(Alert)
+	lastCheck atomic.Int64 // unix nanoseconds
+}
+
+// child is a command the watchdog started.
+type child struct {
+	cmd    *exec.Cmd
+	exited chan struct{} // closed once cmd has been reaped
+	err    error         // what Wait returned, once exited
+}
+
+type proc struct {
+	cfg  Process
+	role uint32
+	q    *queue.ReadOnlyQueue // nil until the queue can be opened
+
+	checked  bool // state below is known
+	down     bool
+	lastTail uint64
+	progress time.Time // last time the tail moved or there was no work
+	orphans  map[int]bool
+
+	child     *child // the command's latest run, nil before the first
+	started   time.Time
+	backoff   time.Duration
+	nextStart time.Time
+	stopping  bool
+}
+
+func New(cfg Config) *Watchdog {
+	w := &Watchdog{interval: cfg.Interval}
+	for _, p := range cfg.Processes {
+		role := queue.RoleConsumer
+		if p.Role == "producer" {
+			role = queue.RoleProducer
+		}
+		w.procs = append(w.procs, &proc{cfg: p, role: role, backoff: p.Backoff, orphans: make(map[int]bool)})
+	}
+	return w
+}
+
+// OnAlert registers fn to receive every alert, in the goroutine calling
+// Check. Register before the first Check.
+func (w *Watchdog) OnAlert(fn func(Alert)) {
+	w.hooks = append(w.hooks, fn)
+}
+
+func (w *Watchdog) alert(p *proc, event Event, now time.Time, detail string, args ...any) {
+	a := Alert{Process: p.cfg.Name, Event: event, Detail: fmt.Sprintf(detail, args...), At: now}
+	for _, fn := range w.hooks {
+		fn(a)
+	}
+}
+
+// Run checks every interval until ctx is done, then stops the processes it
+// started.
+func (w *Watchdog) Run(ctx context.Context) error {
+	defer w.Close()
+	w.Check(time.Now())
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			w.Check(now)
+		}
+	}
+}
+
+// Check takes one look at every process, raising alerts on changes,
+// restarting what it started and halting the session if the engine went
+// down.
+func (w *Watchdog) Check(now time.Time) {
+	for _, p := range w.procs {
+		reason, stalled := w.heartbeat(p, now)
+		down := reason != ""
+		switch {
+		case down && (!p.checked || !p.down):
+			event := EventDown
+			if stalled {
+				event = EventStalled
+			}
+			w.alert(p, event, now, "%s", reason)
+			if p.cfg.Engine {
+				w.halt(p, now)
+			}
+		case !down && p.checked && p.down:
+			p.backoff = p.cfg.Backoff
+			if p.cfg.Engine {
+				w.alert(p, EventRecovered, now, "session left halted for an operator to reopen")
+			} else {
+				w.alert(p, EventRecovered, now, "")
+			}
+		}
+		p.checked, p.down = true, down
+		if len(p.cfg.Command) > 0 && down {
+			w.restart(p, now)
+		}
+	}
+	w.lastCheck.Store(now.UnixNano())
+}
+
+// LastCheck is when the last Check ran; safe to call from any goroutine,
+// e.g. to tell the service manager the watchdog itself is not stuck.
+func (w *Watchdog) LastCheck() time.Time {
+	return time.Unix(0, w.lastCheck.Load())
+}
+
+// heartbeat returns why p is down, or "" if it is up.
+func (w *Watchdog) heartbeat(p *proc, now time.Time) (reason string, stalled bool) {
+	if p.q == nil {
+		q, err := queue.OpenQueueReadOnly(p.cfg.Queue)
+		if err != nil {
+			return fmt.Sprintf("queue: %v", err), false
+		}
+		p.q, p.progress, p.lastTail = q, now, q.ConsumerTail()
+	}
+
+	live, ours := false, false
+	for _, a := range p.q.Attachments() {
+		if !a.Alive {
+			if !p.orphans[a.PID] {
+				p.orphans[a.PID] = true
+				w.alert(p, EventOrphan, now, "pid %d (%s) attached %s", a.PID,
+					queue.RoleString(a.Roles), a.Since.Format(time.RFC3339))
+			}
+			continue
+		}
+		// an attacher in another PID namespace counts as live: only Stall
+		// can tell when it hangs or dies
+		live = live || a.Roles&p.role != 0
+		ours = ours || p.running() && a.PID == p.child.cmd.Process.Pid
+	}
+	switch {
+	case p.running() && !live && !ours && now.Sub(p.started) >= p.cfg.Grace:
+		return fmt.Sprintf("pid %d not attached to %s after %v", p.child.cmd.Process.Pid, p.cfg.Queue, p.cfg.Grace), false
+	case !live && !ours && !p.running():
+		if p.child != nil {
+			return fmt.Sprintf("no live %s attached; pid %d exited: %v", p.cfg.Role, p.child.cmd.Process.Pid, p.child.err), false
+		}
+		return fmt.Sprintf("no live %s attached to %s", p.cfg.Role, p.cfg.Queue), false
+	}
+
+	if p.cfg.Stall > 0 {
+		tail, depth := p.q.ConsumerTail(), p.q.Depth()
+		if tail != p.lastTail || depth == 0 {
+			p.lastTail, p.progress = tail, now
+		}
+		if idle := now.Sub(p.progress); idle >= p.cfg.Stall {
+			return fmt.Sprintf("%d orders waiting, none consumed for %v", depth, idle.Round(time.Millisecond)), true
+		}
+	}
+	return "", false
+}
+
+func (w *Watchdog) halt(p *proc, now time.Time) {
+	if w.Halt == nil {
+		return
+	}
+	if err := w.Halt(); err != nil {
+		w.alert(p, EventHaltFailed, now, "%v", err)
+		return
+	}
+	w.alert(p, EventHalted, now, "engine %s down", p.cfg.Name)
+}
+
+// restart stops p's command if it is still running, and starts it again
+// once it has exited and the backoff has passed.
+func (w *Watchdog) restart(p *proc, now time.Time) {
+	if p.running() {
+		if !p.stopping {
+			p.stopping = true
+			p.child.stop(p.cfg.Grace)
+		}
+		return
+	}
+	if now.Before(p.nextStart) {
+		return
+	}
+	first := p.child == nil
+	cmd := exec.Command(p.cfg.Command[0], p.cfg.Command[1:]...)
+	cmd.Stdout, cmd.Stderr, cmd.Env = os.Stdout, os.Stderr, childEnv()
+	p.nextStart = now.Add(p.backoff)
+	p.backoff = min(2*p.backoff, p.cfg.MaxBackoff)
+	if err := cmd.Start(); err != nil {
+		w.alert(p, EventRestartFailed, now, "%v", err)
+		return
+	}
+	c := &child{cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		c.err = cmd.Wait()
+		close(c.exited)
+	}()
+	p.child, p.stopping = c, false
+	p.started, p.progress = now, now
+	if first {
+		w.alert(p, EventStarted, now, "pid %d", cmd.Process.Pid)
+	} else {
+		w.alert(p, EventRestarted, now, "pid %d, next attempt no sooner than %v", cmd.Process.Pid, p.backoff)
+	}
+}
+
+// childEnv is the watchdog's environment less what systemd set for the
+// watchdog's own unit, so a child does not report to it as if it were the
+// service.
+func childEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case "NOTIFY_SOCKET", "WATCHDOG_USEC", "WATCHDOG_PID", "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// running reports whether the watchdog's command for p has not exited.
+func (p *proc) running() bool {
+	if p.child == nil {
+		return false
+	}
+	select {
+	case <-p.child.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// stop sends SIGTERM, and SIGKILL if the command has not exited after
+// grace.
+func (c *child) stop(grace time.Duration) {
+	c.cmd.Process.Signal(syscall.SIGTERM)
+	go func() {
+		select {
+		case <-c.exited:
+		case <-time.After(grace):
+			c.cmd.Process.Kill()
+		}
+	}()
+}
+
+// Close stops the processes the watchdog started, waiting for them to
+// exit, and releases the queues.
+func (w *Watchdog) Close() {
+	for _, p := range w.procs {
+		if p.running() {
+			p.child.stop(p.cfg.Grace)
+			<-p.child.exited
+		}
+		if p.q != nil {
+			p.q.Close()
+			p.q = nil
+		}
+	}
+}
+
+// AdminHalt returns a Halt that moves the session to halted through the
+// admin API, attributed to omswatchdog in its audit log.
+func AdminHalt(cfg Admin) func() error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	token := os.Getenv(cfg.TokenEnv)
+	return func() error {
+		req, err := http.NewRequest(http.MethodPut, cfg.URL+"/v1/session", bytes.NewReader([]byte(`{"state":"halted"}`)))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(admin.ActorHeader, "omswatchdog")
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("halt session: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("halt session: %s", resp.Status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+package watchdog
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`
+admin: {url: "http://127.0.0.1:8081"}
+processes:
+  - {name: engine, queue: /tmp/orders, role: consumer, stall: 5s, engine: true, command: [rust_me]}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cfg.Processes[0]
+	if cfg.Interval != time.Second || cfg.Admin.TokenEnv != "OMS_ADMIN_TOKEN" || p.Backoff != time.Second || p.MaxBackoff != time.Minute || p.Grace != 5*time.Second {
+		t.Fatalf("defaults not filled in: %+v", cfg)
+	}
+
+	for _, bad := range []string{
+		`processes: []`,
+		`processes: [{name: a, queue: q, role: matcher}]`,
+		`processes: [{name: a, role: consumer}]`,
+		`processes: [{name: a, queue: q, role: producer, stall: 1s}]`,
+		`processes: [{name: a, queue: q, role: consumer, engine: true}]`,
+		`processes: [{name: a, queue: q, role: consumer}, {name: a, queue: q, role: producer}]`,
+		`processes: [{name: a, queue: q, role: consumer, backoff: 2m}]`,
+		`processes: [{name: a, queue: q, role: consumer, restart: always}]`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("%s: no error", bad)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders")
+	producer, err := queue.CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+	enqueue := func() {
+		t.Helper()
+		if err := producer.Enqueue(queue.Order{OrderID: 1, Quantity: 1, Price: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enqueue()
+
+	w := New(Config{Processes: []Process{
+		{Name: "engine", Queue: path, Role: "consumer", Stall: time.Second, Engine: true},
+		{Name: "gateway", Queue: path, Role: "producer"},
+	}})
+	defer w.Close()
+	halts := 0
+	w.Halt = func() error { halts++; return nil }
+	var got []string
+	w.OnAlert(func(a Alert) { got = append(got, a.Process+" "+string(a.Event)) })
+	start := time.Now()
+	check := func(at time.Duration, want ...string) {
+		t.Helper()
+		got = nil
+		w.Check(start.Add(at))
+		if len(got)+len(want) > 0 && !reflect.DeepEqual(got, want) {
+			t.Fatalf("at %v: alerts %q, want %q", at, got, want)
+		}
+	}
+
+	check(0, "engine down", "engine halted")
+	check(time.Second)
+	if halts != 1 {
+		t.Fatalf("halted %d times during one outage", halts)
+	}
+
+	consumer, err := queue.OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consumer.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	check(2*time.Second, "engine recovered")
+
+	// orders waiting and the tail standing still for the stall
+	enqueue()
+	check(2500 * time.Millisecond)
+	check(3*time.Second, "engine stalled", "engine halted")
+	if _, err := consumer.Dequeue(); err != nil {
+		t.Fatal(err)
+	}
+	check(4*time.Second, "engine recovered")
+
+	consumer.Close()
+	check(5*time.Second, "engine down", "engine halted")
+	if halts != 3 {
+		t.Fatalf("halted %d times, want 3", halts)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders")
+	q, err := queue.CreateQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	// true exits at once without ever attaching
+	w := New(Config{Processes: []Process{{
+		Name: "engine", Queue: path, Role: "consumer",
+		Command: []string{"true"}, Backoff: time.Hour, MaxBackoff: 90 * time.Minute, Grace: time.Hour,
+	}}})
+	defer w.Close()
+	var got []Event
+	w.OnAlert(func(a Alert) { got = append(got, a.Event) })
+	p := w.procs[0]
+	start := time.Now()
+
+	w.Check(start)
+	if p.child == nil {
+		t.Fatalf("not started: %v", got)
+	}
+	<-p.child.exited
+	w.Check(start.Add(time.Minute)) // within the backoff
+	w.Check(start.Add(time.Hour))
+	<-p.child.exited
+	w.Check(start.Add(2 * time.Hour)) // backoff doubled, capped at 90m
+	want := []Event{EventDown, EventStarted, EventRestarted}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("alerts %v, want %v", got, want)
+	}
+	w.Check(start.Add(150 * time.Minute))
+	if got[len(got)-1] != EventRestarted || len(got) != 4 {
+		t.Fatalf("alerts %v, want a second restart", got)
+	}
+}
@@ -0,0 +1,273 @@
+package webhook
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"oms/queue"
+)
+
+// The outbox is two append-only files in a directory: reports, a header
+// and then one fixed-size entry per report taken for delivery, and acks,
+// the id of each report delivered. A report is pending while its id is
+// not in acks. Once enough of the reports are acked the files are
+// rewritten with only the pending ones, the header carrying the next id
+// so ids are never reused; a receiver can dedupe on them.
+const (
+	outboxMagic      = 0x4F4D5348 // "OMSH"
+	outboxVersion    = 1
+	outboxHeaderSize = 16 // magic u32, version u16, pad u16, next id u64
+	orderSize        = 64
+	entrySize        = 16 + orderSize // id u64, at unix nanos i64, order
+	ackSize          = 8
+
+	// compactAfter is how many acked entries the files may carry before
+	// they are rewritten.
+	compactAfter = 4096
+)
+
+// entry is one report in the outbox.
+type entry struct {
+	id    uint64
+	at    time.Time
+	order queue.Order
+}
+
+type outbox struct {
+	mu      sync.Mutex
+	dir     string
+	reports *os.File
+	acks    *os.File
+	next    uint64
+	pending map[uint64]entry
+	acked   int // entries in reports that acks has cancelled
+}
+
+// openOutbox opens or creates the outbox in dir and returns it with its
+// pending reports, oldest first. A torn entry at the end of either file,
+// left by a crash mid-write, is cut off.
+func openOutbox(dir string) (*outbox, []entry, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create webhook outbox: %w", err)
+	}
+	b := &outbox{dir: dir, next: 1, pending: make(map[uint64]entry)}
+	var err error
+	if b.reports, err = os.OpenFile(filepath.Join(dir, "reports"), os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to open webhook outbox: %w", err)
+	}
+	if b.acks, err = os.OpenFile(filepath.Join(dir, "acks"), os.O_RDWR|os.O_CREATE, 0600); err != nil {
+		b.reports.Close()
+		return nil, nil, fmt.Errorf("failed to open webhook outbox: %w", err)
+	}
+	if err := b.load(); err != nil {
+		b.close()
+		return nil, nil, fmt.Errorf("webhook outbox %s: %w", dir, err)
+	}
+	entries := make([]entry, 0, len(b.pending))
+	for _, e := range b.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	return b, entries, nil
+}
+
+func (b *outbox) load() error {
+	data, err := io.ReadAll(b.reports)
+	if err != nil {
+		return err
+	}
+	if len(data) < outboxHeaderSize {
+		// new, or torn while writing its header
+		if err := b.reports.Truncate(0); err != nil {
+			return err
+		}
+		return b.writeHeader(b.reports, b.next)
+	}
+	if binary.LittleEndian.Uint32(data) != outboxMagic || binary.LittleEndian.Uint16(data[4:]) != outboxVersion {
+		return errors.New("not a webhook outbox")
+	}
+	b.next = max(b.next, binary.LittleEndian.Uint64(data[8:]))
+	end := outboxHeaderSize
+	for ; end+entrySize <= len(data); end += entrySize {
+		e, err := decodeEntry(data[end : end+entrySize])
+		if err != nil {
+			return err
+		}
+		b.pending[e.id] = e
+		b.next = max(b.next, e.id+1)
+	}
+	if err := truncateTo(b.reports, int64(end), len(data)); err != nil {
+		return err
+	}
+
+	acks, err := io.ReadAll(b.acks)
+	if err != nil {
+		return err
+	}
+	end = 0
+	for ; end+ackSize <= len(acks); end += ackSize {
+		id := binary.LittleEndian.Uint64(acks[end:])
+		if _, ok := b.pending[id]; ok {
+			delete(b.pending, id)
+			b.acked++
+		}
+	}
+	return truncateTo(b.acks, int64(end), len(acks))
+}
+
+// truncateTo cuts f, size bytes long, back to end and leaves its offset
+// there for the next append.
+func truncateTo(f *os.File, end int64, size int) error {
+	if end < int64(size) {
+		if err := f.Truncate(end); err != nil {
+			return err
+		}
+	}
+	_, err := f.Seek(end, io.SeekStart)
+	return err
+}
+
+// appendTo writes buf at f's offset. A failed write is cut back off, so a
+// short one does not leave a torn entry for later ones to land after.
+func appendTo(f *os.File, buf []byte) error {
+	end, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		if terr := f.Truncate(end); terr == nil {
+			f.Seek(end, io.SeekStart)
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *outbox) writeHeader(f *os.File, next uint64) error {
+	var hdr [outboxHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:], outboxMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], outboxVersion)
+	binary.LittleEndian.PutUint64(hdr[8:], next)
+	_, err := f.Write(hdr[:])
+	return err
+}
+
+func encodeEntry(dst []byte, e entry) []byte {
+	dst = binary.LittleEndian.AppendUint64(dst, e.id)
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(e.at.UnixNano()))
+	dst, _ = binary.Append(dst, binary.LittleEndian, &e.order)
+	return dst
+}
+
+func decodeEntry(b []byte) (entry, error) {
+	e := entry{
+		id: binary.LittleEndian.Uint64(b),
+		at: time.Unix(0, int64(binary.LittleEndian.Uint64(b[8:]))),
+	}
+	_, err := binary.Decode(b[16:], binary.LittleEndian, &e.order)
+	return e, err
+}
+
+// add appends o, reported at at, and returns its entry. It is in the page
+// cache on return, so it survives the process dying; sync makes it survive
+// the host too.
+func (b *outbox) add(o queue.Order, at time.Time) (entry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := entry{id: b.next, at: at, order: o}
+	b.next++ // even on failure: the report is still posted, under this id
+	if err := appendTo(b.reports, encodeEntry(make([]byte, 0, entrySize), e)); err != nil {
+		return e, fmt.Errorf("failed to append to webhook outbox: %w", err)
+	}
+	b.pending[e.id] = e
+	return e, nil
+}
+
+// ack records that report id was delivered.
+func (b *outbox) ack(id uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := appendTo(b.acks, binary.LittleEndian.AppendUint64(nil, id)); err != nil {
+		return fmt.Errorf("failed to ack in webhook outbox: %w", err)
+	}
+	delete(b.pending, id)
+	if b.acked++; b.acked >= compactAfter && b.acked >= 2*len(b.pending) {
+		return b.compact()
+	}
+	return nil
+}
+
+// compact rewrites reports with the pending entries only and empties acks.
+// Called with b.mu held. A crash between the two leaves acks for ids no
+// longer in reports, which load skips.
+func (b *outbox) compact() error {
+	entries := make([]entry, 0, len(b.pending))
+	for _, e := range b.pending {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+
+	name := filepath.Join(b.dir, "reports")
+	f, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to compact webhook outbox: %w", err)
+	}
+	buf := make([]byte, 0, len(entries)*entrySize)
+	for _, e := range entries {
+		buf = encodeEntry(buf, e)
+	}
+	err = b.writeHeader(f, b.next)
+	if err == nil {
+		_, err = f.Write(buf)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(name+".tmp", name)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(name + ".tmp")
+		return fmt.Errorf("failed to compact webhook outbox: %w", err)
+	}
+	b.reports.Close()
+	b.reports = f
+	b.acked = 0
+	if err := b.acks.Truncate(0); err != nil {
+		return fmt.Errorf("failed to compact webhook outbox: %w", err)
+	}
+	_, err = b.acks.Seek(0, io.SeekStart)
+	return err
+}
+
+// sync flushes both files to stable storage.
+func (b *outbox) sync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.reports.Sync(); err != nil {
+		return err
+	}
+	return b.acks.Sync()
+}
+
+func (b *outbox) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+func (b *outbox) close() error {
+	err := b.reports.Close()
+	if aerr := b.acks.Close(); err == nil {
+		err = aerr
+	}
+	return err
+}
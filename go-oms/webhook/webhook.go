@@ -0,0 +1,337 @@
+// Package webhook delivers execution reports to clients' HTTP endpoints,
+// for systems that cannot attach to the status ring. Delivery is at least
+// once: every report is written to a durable outbox before it is posted
+// and stays there, surviving restarts, until its endpoint answers 2xx. Each
+// client's reports are posted one at a time in ring order, so a client
+// whose endpoint is down holds up only its own reports, and gets them in
+// order once it is back.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"oms/mirror"
+	"oms/queue"
+)
+
+// Request headers. The id is the report's outbox id, the same on every
+// retry, for the receiver to drop duplicates by; the signature is the
+// HMAC-SHA256 of the body with the endpoint's secret, hex encoded after
+// "sha256=".
+const (
+	IDHeader        = "Idempotency-Key"
+	SignatureHeader = "X-OMS-Signature"
+)
+
+// Config is a webhook file:
+//
+//	outbox: /var/lib/oms/webhooks   # default <queue>_webhooks
+//	timeout: 5s
+//	endpoints:
+//	  - client: 1001
+//	    url: https://fills.example/oms
+//	    secret_env: CLIENT_1001_WEBHOOK_SECRET
+type Config struct {
+	Outbox     string        `yaml:"outbox"`
+	Timeout    time.Duration `yaml:"timeout"`     // per post; default 5s
+	Backoff    time.Duration `yaml:"backoff"`     // before the first retry, doubling; default 1s
+	MaxBackoff time.Duration `yaml:"max_backoff"` // default 1m
+	// SyncInterval is how often the outbox is flushed to disk. A report
+	// is written before it is posted, so a crashed process loses none;
+	// this bounds what a crashed host can. Default 100ms.
+	SyncInterval time.Duration `yaml:"sync_interval"`
+	Endpoints    []Endpoint    `yaml:"endpoints"`
+}
+
+// Endpoint is where one client's execution reports go.
+type Endpoint struct {
+	Client uint32 `yaml:"client"`
+	URL    string `yaml:"url"`
+	// SecretEnv names the environment variable holding the signing
+	// secret; requests are unsigned without it.
+	SecretEnv string `yaml:"secret_env"`
+	secret    []byte
+}
+
+// OutboxPath is the outbox kept next to an order queue.
+func OutboxPath(queuePath string) string {
+	return queuePath + "_webhooks"
+}
+
+// Load reads and validates a webhook file.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Parse decodes and validates a webhook file, filling in defaults and
+// reading the secrets from the environment. Unknown keys are errors.
+func Parse(data []byte) (Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.SyncInterval == 0 {
+		cfg.SyncInterval = 100 * time.Millisecond
+	}
+	clients := make(map[uint32]bool)
+	for i := range cfg.Endpoints {
+		ep := &cfg.Endpoints[i]
+		switch {
+		case ep.URL == "":
+			return cfg, fmt.Errorf("client %d: no url", ep.Client)
+		case clients[ep.Client]:
+			return cfg, fmt.Errorf("client %d: more than one endpoint", ep.Client)
+		case ep.SecretEnv != "":
+			if ep.secret = []byte(os.Getenv(ep.SecretEnv)); len(ep.secret) == 0 {
+				return cfg, fmt.Errorf("client %d: %s is not set", ep.Client, ep.SecretEnv)
+			}
+		}
+		clients[ep.Client] = true
+	}
+	switch {
+	case len(cfg.Endpoints) == 0:
+		return cfg, fmt.Errorf("no endpoints")
+	case cfg.Timeout < 0 || cfg.Backoff < 0 || cfg.MaxBackoff < cfg.Backoff || cfg.SyncInterval < 0:
+		return cfg, fmt.Errorf("timeout %v, backoff %v-%v, sync interval %v", cfg.Timeout, cfg.Backoff, cfg.MaxBackoff, cfg.SyncInterval)
+	}
+	return cfg, nil
+}
+
+// Delivery is the body of each post.
+type Delivery struct {
+	ID      uint64       `json:"id"`
+	Attempt int          `json:"attempt"` // posts of this report since the dispatcher started
+	Event   mirror.Event `json:"event"`   // kind "execution"
+}
+
+// Stats counts reports by what became of them.
+type Stats struct {
+	Queued    uint64 // taken into the outbox
+	Delivered uint64
+	Retries   uint64 // posts that failed and will be tried again
+	Pending   int    // in the outbox, not yet delivered
+}
+
+// Dispatcher posts execution reports from an outbox. Execution is safe for
+// concurrent use; Run does the posting.
+type Dispatcher struct {
+	cfg     Config
+	client  *http.Client
+	box     *outbox
+	clients map[uint32]*client
+
+	queued, delivered, retries atomic.Uint64
+}
+
+// client is one endpoint and the reports waiting for it, oldest first.
+type client struct {
+	ep      Endpoint
+	mu      sync.Mutex
+	pending []entry
+	wake    chan struct{}
+}
+
+// Open opens the outbox in the directory cfg.Outbox, which must be set,
+// and queues the reports a previous run left undelivered.
+func Open(cfg Config) (*Dispatcher, error) {
+	box, entries, err := openOutbox(cfg.Outbox)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dispatcher{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		box:     box,
+		clients: make(map[uint32]*client),
+	}
+	for _, ep := range cfg.Endpoints {
+		d.clients[ep.Client] = &client{ep: ep, wake: make(chan struct{}, 1)}
+	}
+	for _, e := range entries {
+		// a client dropped from the config since keeps its reports in the
+		// outbox for when it is back
+		if c, ok := d.clients[e.order.ClientID]; ok {
+			c.pending = append(c.pending, e)
+		}
+	}
+	return d, nil
+}
+
+// Execution queues a record from the status ring for its client's
+// endpoint. Control records, and clients without an endpoint, are
+// ignored.
+func (d *Dispatcher) Execution(o queue.Order) {
+	c, ok := d.clients[o.ClientID]
+	if !ok || o.IsControl() {
+		return
+	}
+	e, err := d.box.add(o, time.Now())
+	if err != nil {
+		// still posted, only not durable: better than not at all
+		log.Printf("[WEBHOOK] order %d: %v", o.OrderID, err)
+	}
+	d.queued.Add(1)
+	c.mu.Lock()
+	c.pending = append(c.pending, e)
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) Stats() Stats {
+	return Stats{
+		Queued:    d.queued.Load(),
+		Delivered: d.delivered.Load(),
+		Retries:   d.retries.Load(),
+		Pending:   d.box.len(),
+	}
+}
+
+// Run posts reports until ctx is done, then syncs and closes the outbox.
+// Reports still pending are posted by the next Open's Run.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, c := range d.clients {
+		wg.Go(func() { d.deliver(ctx, c) })
+	}
+	tick := time.NewTicker(d.cfg.SyncInterval)
+	defer tick.Stop()
+	for done := false; !done; {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			done = true
+		}
+		if err := d.box.sync(); err != nil {
+			log.Printf("[WEBHOOK] failed to sync outbox: %v", err)
+		}
+	}
+	wg.Wait()
+	err := d.box.sync()
+	if cerr := d.box.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// deliver posts c's reports in order, retrying each until it is accepted.
+// A report the endpoint keeps refusing holds up the ones behind it: they
+// are not skipped, or the client would see them out of order.
+func (d *Dispatcher) deliver(ctx context.Context, c *client) {
+	backoff, attempt := d.cfg.Backoff, 1
+	for {
+		c.mu.Lock()
+		var e entry
+		ok := len(c.pending) > 0
+		if ok {
+			e = c.pending[0]
+		}
+		c.mu.Unlock()
+		if !ok {
+			select {
+			case <-c.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		err := d.post(ctx, c.ep, e, attempt)
+		if err == nil {
+			if err := d.box.ack(e.id); err != nil {
+				log.Printf("[WEBHOOK] %v", err)
+			}
+			c.mu.Lock()
+			c.pending = c.pending[1:]
+			c.mu.Unlock()
+			d.delivered.Add(1)
+			backoff, attempt = d.cfg.Backoff, 1
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		d.retries.Add(1)
+		if attempt == 1 || attempt&(attempt-1) == 0 {
+			log.Printf("[WEBHOOK] client %d: report %d, attempt %d: %v", c.ep.Client, e.id, attempt, err)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, d.cfg.MaxBackoff)
+		attempt++
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, ep Endpoint, e entry, attempt int) error {
+	body, err := json.Marshal(Delivery{ID: e.id, Attempt: attempt, Event: mirror.NewEvent(mirror.KindExecution, e.order, e.at)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, strconv.FormatUint(e.id, 10))
+	if ep.secret != nil {
+		req.Header.Set(SignatureHeader, Sign(ep.secret, body))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096)) // so the connection is reused
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign is the SignatureHeader value for body, for receivers to check theirs
+// against with hmac.Equal.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,198 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"oms/queue"
+)
+
+// receiver records the deliveries it accepts by client, refusing while
+// down. Like a real one, it drops a report it already has by id: a post
+// abandoned by the dispatcher may still have been accepted.
+type receiver struct {
+	mu    sync.Mutex
+	got   map[uint32][]Delivery
+	seen  map[uint64]bool
+	down  atomic.Bool
+	fails atomic.Int32 // refuse this many more posts
+	bad   atomic.Int32 // posts with a wrong id header or signature
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	if r.down.Load() || r.fails.Add(-1) >= 0 {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var d Delivery
+	if err := json.Unmarshal(body, &d); err != nil || req.Header.Get(IDHeader) != strconv.FormatUint(d.ID, 10) ||
+		req.Header.Get(SignatureHeader) != Sign([]byte("s3cret"), body) {
+		r.bad.Add(1)
+	}
+	r.mu.Lock()
+	if !r.seen[d.ID] {
+		r.seen[d.ID] = true
+		r.got[d.Event.ClientID] = append(r.got[d.Event.ClientID], d)
+	}
+	r.mu.Unlock()
+}
+
+func testConfig(t *testing.T, url, outbox string) Config {
+	t.Setenv("TEST_WEBHOOK_SECRET", "s3cret")
+	cfg, err := Parse(fmt.Appendf(nil, `
+outbox: %s
+backoff: 1ms
+max_backoff: 10ms
+sync_interval: 5ms
+endpoints:
+  - {client: 1, url: %q, secret_env: TEST_WEBHOOK_SECRET}
+  - {client: 2, url: %q, secret_env: TEST_WEBHOOK_SECRET}
+`, outbox, url, url))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeliveryOrderAndRetries(t *testing.T) {
+	r := &receiver{got: make(map[uint32][]Delivery), seen: make(map[uint64]bool)}
+	r.fails.Store(5)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	d, err := Open(testConfig(t, srv.URL, t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	const n = 50
+	for i := uint64(1); i <= n; i++ {
+		for client := uint32(1); client <= 3; client++ { // 3 has no endpoint
+			d.Execution(queue.Order{OrderID: i, ClientID: client, Status: queue.StatusFilled})
+		}
+	}
+	d.Execution(queue.Order{OrderID: 99, ClientID: 1, MsgType: queue.MsgCancel})
+	waitFor(t, "deliveries", func() bool { return d.Stats().Delivered == 2*n })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	for client, ds := range r.got {
+		for i, del := range ds {
+			if del.Event.OrderID != uint64(i+1) || del.Event.Kind != "execution" || del.Event.Status != queue.StatusFilled {
+				t.Fatalf("client %d delivery %d: %+v, want order %d", client, i, del, i+1)
+			}
+		}
+	}
+	if r.bad.Load() != 0 {
+		t.Errorf("%d posts with a bad id header or signature", r.bad.Load())
+	}
+	if st := d.Stats(); st.Queued != 2*n || st.Delivered != 2*n || st.Retries < 5 || st.Pending != 0 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestOutboxSurvivesRestart(t *testing.T) {
+	r := &receiver{got: make(map[uint32][]Delivery), seen: make(map[uint64]bool)}
+	r.down.Store(true)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	cfg := testConfig(t, srv.URL, t.TempDir())
+
+	d, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+	for i := uint64(1); i <= 10; i++ {
+		d.Execution(queue.Order{OrderID: i, ClientID: 1})
+	}
+	waitFor(t, "retries", func() bool { return d.Stats().Retries > 0 })
+	cancel()
+	<-done
+	// a torn entry from a crash mid-append
+	f, _ := os.OpenFile(filepath.Join(cfg.Outbox, "reports"), os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(make([]byte, entrySize/2))
+	f.Close()
+
+	r.down.Store(false)
+	if d, err = Open(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if st := d.Stats(); st.Pending != 10 {
+		t.Fatalf("reopened with %d pending, want 10", st.Pending)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { done <- d.Run(ctx) }()
+	d.Execution(queue.Order{OrderID: 11, ClientID: 1})
+	waitFor(t, "deliveries", func() bool { return d.Stats().Delivered == 11 })
+	cancel()
+	<-done
+	for i, del := range r.got[1] {
+		if del.Event.OrderID != uint64(i+1) || del.ID != uint64(i+1) {
+			t.Fatalf("delivery %d: id %d order %d", i, del.ID, del.Event.OrderID)
+		}
+	}
+}
+
+func TestOutboxCompaction(t *testing.T) {
+	dir := t.TempDir()
+	b, _, err := openOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = compactAfter + 10
+	for i := range uint64(n) {
+		if _, err := b.add(queue.Order{OrderID: i}, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := uint64(1); id < n; id++ { // all but the last
+		if err := b.ack(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.close()
+	if info, _ := os.Stat(filepath.Join(dir, "reports")); info.Size() > outboxHeaderSize+100*entrySize {
+		t.Errorf("reports is %d bytes after compaction", info.Size())
+	}
+	b, pending, err := openOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+	if len(pending) != 1 || pending[0].id != n || pending[0].order.OrderID != n-1 {
+		t.Fatalf("pending %+v, want only report %d", pending, n)
+	}
+	if e, _ := b.add(queue.Order{}, time.Now()); e.id != n+1 {
+		t.Errorf("next id %d after reopening, want %d", e.id, n+1)
+	}
+}
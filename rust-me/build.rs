@@ -0,0 +1,237 @@
+//! Generates the shared-memory ABI from the files the Go side generates its
+//! own from, so neither side is synchronized by hand: the reject reason
+//! constants from go-oms/queue/reasons.json, and the Order and QueueHeader
+//! structs, their constants and compile-time layout assertions from
+//! go-oms/queue/schema.json (see gen_schema.go).
+
+use std::env;
+use std::fmt::Write as _;
+use std::fs;
+use std::path::Path;
+
+const REASONS: &str = "../go-oms/queue/reasons.json";
+const SCHEMA: &str = "../go-oms/queue/schema.json";
+
+fn main() {
+    let out_dir = env::var("OUT_DIR").unwrap();
+    reasons(Path::new(&out_dir));
+    schema(Path::new(&out_dir));
+}
+
+fn reasons(out_dir: &Path) {
+    println!("cargo:rerun-if-changed={REASONS}");
+    let json = fs::read_to_string(REASONS).expect("read reasons.json");
+
+    let mut out = String::from("// Generated by build.rs from go-oms/queue/reasons.json.\n\n");
+    let mut names = Vec::new();
+    // gen_reasons.go writes one {"code":..,"name":"..","doc":".."} per line
+    for line in json.lines().filter(|l| l.trim_start().starts_with('{')) {
+        let code = field(line, "code").expect("reason code");
+        let name = field(line, "name").expect("reason name");
+        let doc = field(line, "doc").unwrap_or("");
+        writeln!(out, "/// {doc}").unwrap();
+        writeln!(
+            out,
+            "pub const REASON_{}: u8 = {code};",
+            name.to_uppercase()
+        )
+        .unwrap();
+        names.push(format!("{name:?}"));
+    }
+    writeln!(
+        out,
+        "\n/// Reason names indexed by code, as ReasonName on the Go side."
+    )
+    .unwrap();
+    writeln!(
+        out,
+        "pub const REASON_NAMES: [&str; {}] = [{}];",
+        names.len(),
+        names.join(", ")
+    )
+    .unwrap();
+
+    fs::write(out_dir.join("reasons.rs"), out).expect("write reasons.rs");
+}
+
+fn schema(out_dir: &Path) {
+    println!("cargo:rerun-if-changed={SCHEMA}");
+    let json = fs::read_to_string(SCHEMA).expect("read schema.json");
+
+    // a struct or constant group, then each of its fields or values, per line
+    let mut blocks: Vec<(&str, Vec<&str>)> = Vec::new();
+    for line in json.lines().filter(|l| l.trim_start().starts_with('{')) {
+        if field(line, "struct").is_some() || field(line, "const").is_some() {
+            blocks.push((line, Vec::new()));
+        } else {
+            let (_, members) = blocks.last_mut().expect("entry before any struct or group");
+            members.push(line);
+        }
+    }
+
+    let mut out = String::from("// Generated by build.rs from go-oms/queue/schema.json.\n\n");
+    let mut asserts = String::from("const fn field_size<T, F>(_: fn(&T) -> &F) -> usize {\n");
+    asserts.push_str("    std::mem::size_of::<F>()\n}\n\n");
+    for (head, members) in &blocks {
+        match field(head, "struct") {
+            Some(name) => write_struct(&mut out, &mut asserts, name, head, members),
+            None => write_consts(&mut out, head, members),
+        }
+    }
+    out.push_str(&asserts);
+    fs::write(out_dir.join("schema.rs"), out).expect("write schema.rs");
+}
+
+/// Writes a struct, its swap_bytes, its fingerprint if schema.json marks
+/// fields for one, and its layout assertions. A struct with atomic fields is
+/// a file header: its fields stay private to the queue module, and it is
+/// swapped field by field where it is read.
+fn write_struct(out: &mut String, asserts: &mut String, name: &str, head: &str, members: &[&str]) {
+    let size = field(head, "size").expect("struct size");
+    let align = field(head, "align").expect("struct align");
+    let atomic = members
+        .iter()
+        .any(|m| field(m, "type").is_some_and(|t| t.starts_with("atomic_")));
+
+    writeln!(out, "/// {}", field(head, "doc").unwrap_or("")).unwrap();
+    out.push_str("#[repr(C)]\n");
+    if !atomic {
+        out.push_str("#[derive(Clone, Copy, Debug, Default)]\n");
+    }
+    writeln!(out, "pub struct {name} {{").unwrap();
+    writeln!(
+        asserts,
+        "const _: () = assert!(std::mem::size_of::<{name}>() == {size}, \"{name} must be {size} bytes\");"
+    )
+    .unwrap();
+    writeln!(
+        asserts,
+        "const _: () = assert!(std::mem::align_of::<{name}>() == {align}, \"{name} must be {align}-byte aligned\");"
+    )
+    .unwrap();
+    let mut swap = String::new();
+    let mut fingerprint = String::new();
+    for m in members {
+        let rust = field(m, "rust").expect("field rust name");
+        let typ = field(m, "type").expect("field type");
+        let size = field(m, "size").expect("field size");
+        let offset = field(m, "offset").expect("field offset");
+        if let Some(doc) = field(m, "doc") {
+            writeln!(out, "    /// {doc}").unwrap();
+        }
+        let rust_type = match typ {
+            "atomic_u32" => "AtomicU32".to_string(),
+            "atomic_u64" => "AtomicU64".to_string(),
+            "pad" if size == "1" => "u8".to_string(),
+            "pad" => format!("[u8; {size}]"),
+            // an array of a struct declared before
+            t => match field(m, "count") {
+                Some(count) => format!("[{t}; {count}]"),
+                None => t.to_string(),
+            },
+        };
+        let vis = if atomic { "" } else { "pub " };
+        writeln!(out, "    {vis}{rust}: {rust_type},").unwrap();
+        writeln!(
+            asserts,
+            "const _: () = assert!(std::mem::offset_of!({name}, {rust}) == {offset}, \"{name}.{rust} must be at offset {offset}\");"
+        )
+        .unwrap();
+        writeln!(
+            asserts,
+            "const _: () = assert!(field_size(|x: &{name}| &x.{rust}) == {size}, \"{name}.{rust} must be {size} bytes\");"
+        )
+        .unwrap();
+        let swapped = if size == "1" || typ == "pad" {
+            ""
+        } else {
+            ".swap_bytes()"
+        };
+        writeln!(swap, "            {rust}: self.{rust}{swapped},").unwrap();
+        if field(m, "fingerprint").is_some() {
+            // i32 goes through u32, as Go's uint64(uint32(v)), not sign-extended
+            let widen = match typ {
+                "u64" => "",
+                "i32" => " as u32 as u64",
+                _ => " as u64",
+            };
+            writeln!(
+                fingerprint,
+                "        h = fingerprint_add(h, self.{rust}{widen}, {size});"
+            )
+            .unwrap();
+        }
+    }
+    out.push_str("}\n\n");
+    if !atomic {
+        writeln!(out, "impl {name} {{").unwrap();
+        out.push_str("    /// Byte-swap every multi-byte field. Its own inverse, used to decode\n");
+        out.push_str("    /// captures written on a host with the opposite byte order.\n");
+        writeln!(
+            out,
+            "    pub fn swap_bytes(self) -> {name} {{\n        {name} {{\n{swap}        }}\n    }}"
+        )
+        .unwrap();
+        if !fingerprint.is_empty() {
+            out.push_str("\n    /// Stable 64-bit hash of the fields schema.json marks fingerprint, equal to\n");
+            out.push_str("    /// the Go side's Fingerprint; see fingerprint_add.\n");
+            writeln!(out, "    pub fn fingerprint(&self) -> u64 {{\n        let mut h = FINGERPRINT_BASIS;\n{fingerprint}        h\n    }}").unwrap();
+        }
+        out.push_str("}\n\n");
+    }
+}
+
+/// Writes a constant group; a group of bits also gets a mask of them all.
+fn write_consts(out: &mut String, head: &str, members: &[&str]) {
+    let prefix = field(head, "rust").expect("group rust prefix");
+    let typ = field(head, "type").expect("group type");
+    let bits = head.contains("\"bits\":true");
+    writeln!(out, "// {}", field(head, "doc").unwrap_or("")).unwrap();
+    let mut names = Vec::new();
+    for m in members {
+        let name = format!(
+            "{prefix}_{}",
+            field(m, "name").expect("constant name").to_uppercase()
+        );
+        let value: u64 = field(m, "value")
+            .expect("constant value")
+            .parse()
+            .expect("numeric value");
+        if let Some(doc) = field(m, "doc") {
+            writeln!(out, "/// {doc}").unwrap();
+        }
+        if bits {
+            writeln!(
+                out,
+                "pub const {name}: {typ} = 1 << {};",
+                value.trailing_zeros()
+            )
+            .unwrap();
+        } else {
+            writeln!(out, "pub const {name}: {typ} = {value};").unwrap();
+        }
+        names.push(name);
+    }
+    if bits {
+        writeln!(
+            out,
+            "pub const {prefix}S_KNOWN: {typ} = {};",
+            names.join(" | ")
+        )
+        .unwrap();
+    }
+    out.push('\n');
+}
+
+/// Value of "key" in a flat JSON object line: a number or a string without
+/// escapes, which is all reasons.json and schema.json hold.
+fn field<'a>(line: &'a str, key: &str) -> Option<&'a str> {
+    let rest = &line[line.find(&format!("\"{key}\":"))? + key.len() + 3..];
+    if let Some(s) = rest.strip_prefix('"') {
+        return Some(&s[..s.find('"')?]);
+    }
+    let end = rest
+        .find(|c: char| !c.is_ascii_digit())
+        .unwrap_or(rest.len());
+    Some(&rest[..end])
+}
@@ -1,5 +1,7 @@
 use clap::Parser;
 use rust_me::Queue;
+use rust_me::path::default_queue_path;
+use std::path::PathBuf;
 use std::time::Instant; // Import clap
 
 /// HFT performance benchmark consumer
@@ -10,16 +12,17 @@ struct Args {
     #[arg(long, default_value_t = 10)]
     orders: u64,
 
-    /// Path to the queue file
-    #[arg(long, default_value = "/tmp/sex")]
-    queue: String,
+    /// Path to the queue file (default: $OMS_QUEUE_PATH or the runtime dir)
+    #[arg(long)]
+    queue: Option<PathBuf>,
 }
 
 fn main() -> Result<(), Box<dyn std::error::Error>> {
     let args = Args::parse(); // Parse arguments
 
-    println!("[PERF] Initializing queue: {}", args.queue);
-    let mut queue = Queue::open(&args.queue)?; // Use arg for path
+    let queue_path = args.queue.unwrap_or_else(default_queue_path);
+    println!("[PERF] Initializing queue: {}", queue_path.display());
+    let mut queue = Queue::open(&queue_path)?; // Use arg for path
 
     println!(
         "[PERF] Rust consumer: consuming {} orders...\n",
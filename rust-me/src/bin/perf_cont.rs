@@ -1,4 +1,6 @@
 use rust_me::Queue;
+use rust_me::path::default_queue_path;
+use std::path::PathBuf;
 use std::sync::Arc;
 use std::sync::atomic::{AtomicU64, Ordering};
 use std::thread;
@@ -8,7 +10,11 @@ fn main() -> Result<(), Box<dyn std::error::Error>> {
     println!("[MATCH] Rust Consumer");
     println!("[MATCH] Running forever (Press Ctrl+C to stop)\n");
 
-    let mut queue = Queue::open("/tmp/sex")?;
+    let queue_path = std::env::args_os()
+        .nth(1)
+        .map(PathBuf::from)
+        .unwrap_or_else(default_queue_path);
+    let mut queue = Queue::open(&queue_path)?;
 
     let atomic_count = Arc::new(AtomicU64::new(0));
     let count_clone = atomic_count.clone();
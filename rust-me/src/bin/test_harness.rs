@@ -1,7 +1,10 @@
 use clap::{Parser, Subcommand};
 use env_logger::Env;
 use log::{debug, error, info, warn};
+use rust_me::path::default_queue_path;
 use rust_me::{Order, Queue};
+use std::path::PathBuf;
+use std::sync::OnceLock;
 use std::thread;
 use std::time::{Duration, Instant};
 
@@ -9,11 +12,19 @@ use std::time::{Duration, Instant};
 #[command(name = "HFT Test Harness")]
 #[command(about = "Rust testing and monitoring for shared memory queue", long_about = None)]
 struct Args {
+    /// Queue file (default: $OMS_QUEUE_PATH or the runtime dir)
+    #[arg(long, global = true)]
+    queue: Option<PathBuf>,
+
     #[command(subcommand)]
     command: Commands,
 }
 
-const QUEUE_PATH: &str = "/tmp/sex";
+static QUEUE_PATH: OnceLock<PathBuf> = OnceLock::new();
+
+fn queue_path() -> &'static PathBuf {
+    QUEUE_PATH.get_or_init(default_queue_path)
+}
 
 #[derive(Subcommand, Debug)]
 enum Commands {
@@ -53,6 +64,9 @@ fn main() {
     env_logger::Builder::from_env(Env::default().default_filter_or("info")).init();
 
     let args = Args::parse();
+    if let Some(path) = args.queue {
+        let _ = QUEUE_PATH.set(path);
+    }
 
     match args.command {
         Commands::Validate => validate_queue(),
@@ -74,17 +88,17 @@ fn validate_queue() {
     println!("\n=== Queue Structure Validation ===\n");
 
     println!(
-        "Order size:              {} bytes (expected 48)",
+        "Order size:              {} bytes (expected 64)",
         std::mem::size_of::<Order>()
     );
-    assert_eq!(std::mem::size_of::<Order>(), 48);
+    assert_eq!(std::mem::size_of::<Order>(), 64);
 
-    println!("QueueHeader size:        136 bytes");
+    println!("QueueHeader size:        2432 bytes");
 
     println!("Queue capacity:          {} orders", 65536);
     println!(
         "Total queue size:        {:.1} MB",
-        (136 + (65536 * 48)) as f64 / 1_048_576.0
+        (2432 + (65536 * 64)) as f64 / 1_048_576.0
     );
 
     println!("\n=== Memory Layout ===\n");
@@ -94,6 +108,7 @@ fn validate_queue() {
     println!("Padding 2:               56 bytes (offset 72-127)");
     println!("Magic offset:            128 bytes");
     println!("Capacity offset:         132 bytes");
+    println!("ByteOrder offset:        136 bytes");
 
     println!("\n✓ Validation complete!");
 }
@@ -103,7 +118,7 @@ fn single_order() {
     info!("Attempting to dequeue single order...");
     println!("\n=== Single Order Dequeue ===\n");
 
-    let mut queue = match Queue::open(QUEUE_PATH) {
+    let mut queue = match Queue::open(queue_path()) {
         Ok(q) => q,
         Err(e) => {
             error!("Failed to open queue: {}", e);
@@ -149,7 +164,7 @@ fn batch_orders(count: usize) {
     info!("Starting batch dequeue of {} orders", count);
     println!("\n=== Batch Dequeue: {} Orders ===\n", count);
 
-    let mut queue = match Queue::open(QUEUE_PATH) {
+    let mut queue = match Queue::open(queue_path()) {
         Ok(q) => q,
         Err(e) => {
             error!("Failed to open queue: {}", e);
@@ -222,7 +237,7 @@ fn stream_orders(duration_secs: u64, use_spin: bool) {
     println!("Mode: {}", if use_spin { "SPIN" } else { "YIELD" });
     println!("(Press Ctrl+C to stop)\n");
 
-    let mut queue = match Queue::open(QUEUE_PATH) {
+    let mut queue = match Queue::open(queue_path()) {
         Ok(q) => q,
         Err(e) => {
             error!("Failed to open queue: {}", e);
@@ -308,7 +323,7 @@ fn monitor_queue(max_depth_filter: Option<u64>) {
     // Retry opening queue with timeout
     let mut queue = None;
     for attempt in 0..10 {
-        match Queue::open(QUEUE_PATH) {
+        match Queue::open(queue_path()) {
             Ok(q) => {
                 queue = Some(q);
                 info!("Queue opened successfully");
@@ -381,7 +396,7 @@ fn integration_test() {
     println!("  2. Go OMS streaming:   go run main.go stream");
     println!("\nStarting consumer...\n");
 
-    let mut queue = match Queue::open(QUEUE_PATH) {
+    let mut queue = match Queue::open(queue_path()) {
         Ok(q) => q,
         Err(e) => {
             error!("Integration test failed: {}", e);
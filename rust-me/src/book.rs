@@ -0,0 +1,119 @@
+//! Top-of-book snapshots shared with Go (go-oms/book) for price collars.
+//!
+//! One fixed slot per symbol id. Each slot is a sequence lock: `publish`
+//! makes `seq` odd, rewrites the levels and makes it even again, so a Go
+//! reader that sees the same even `seq` before and after its copy has a
+//! consistent snapshot.
+use crate::queue::QueueError;
+use memmap2::MmapMut;
+use std::fs::OpenOptions;
+use std::os::unix::fs::OpenOptionsExt;
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicU64, Ordering, fence};
+
+pub const BOOK_MAGIC: u32 = 0x4F4D5342; // "OMSB"
+pub const BOOK_DEPTH: usize = 10;
+pub const BOOK_SYMBOLS: usize = 1024;
+const BYTE_ORDER_MARK: u32 = 0x01020304;
+
+#[repr(C)]
+#[derive(Clone, Copy, Debug, Default)]
+pub struct Level {
+    pub price: u64,
+    pub quantity: u64,
+}
+
+#[repr(C)]
+struct BookHeader {
+    magic: u32,
+    byte_order: u32,
+    depth: u32,
+    symbols: u32,
+    _pad: [u8; 48],
+}
+
+#[repr(C)]
+struct Slot {
+    seq: AtomicU64, // odd while writing
+    updated_at: u64,
+    symbol: u32,
+    num_bids: u32,
+    num_asks: u32,
+    _pad: u32,
+    bids: [Level; BOOK_DEPTH], // best first
+    asks: [Level; BOOK_DEPTH],
+}
+
+const HEADER_SIZE: usize = std::mem::size_of::<BookHeader>();
+const SLOT_SIZE: usize = std::mem::size_of::<Slot>();
+const TOTAL_SIZE: usize = HEADER_SIZE + BOOK_SYMBOLS * SLOT_SIZE;
+
+const _: () = assert!(HEADER_SIZE == 64, "BookHeader must be 64 bytes");
+const _: () = assert!(SLOT_SIZE == 352, "book Slot must be 352 bytes");
+
+/// The book segment published next to an order queue
+pub fn book_path<P: AsRef<Path>>(order_path: P) -> PathBuf {
+    let mut p = order_path.as_ref().as_os_str().to_owned();
+    p.push("_book");
+    PathBuf::from(p)
+}
+
+/// The engine's single writer of the book segment
+pub struct BookWriter {
+    mmap: MmapMut,
+}
+
+impl BookWriter {
+    /// Create (or reset) the segment; readers may already have it mapped.
+    pub fn create<P: AsRef<Path>>(path: P) -> Result<Self, QueueError> {
+        crate::path::validate_path(path.as_ref()).map_err(QueueError::InvalidPath)?;
+
+        let file = OpenOptions::new()
+            .read(true)
+            .write(true)
+            .create(true)
+            .mode(0o640)
+            .open(path)
+            .map_err(|e| QueueError::FileOpen(e.to_string()))?;
+        file.set_len(TOTAL_SIZE as u64)
+            .map_err(|e| QueueError::FileOpen(e.to_string()))?;
+
+        let mut mmap =
+            unsafe { MmapMut::map_mut(&file) }.map_err(|e| QueueError::Mmap(e.to_string()))?;
+        mmap.fill(0);
+        let header = unsafe { &mut *(mmap.as_mut_ptr() as *mut BookHeader) };
+        header.depth = BOOK_DEPTH as u32;
+        header.symbols = BOOK_SYMBOLS as u32;
+        header.byte_order = BYTE_ORDER_MARK;
+        header.magic = BOOK_MAGIC;
+        mmap.flush().map_err(|e| QueueError::Mmap(e.to_string()))?;
+
+        Ok(BookWriter { mmap })
+    }
+
+    /// Replace a symbol's levels, best first; extra levels are dropped.
+    pub fn publish(&mut self, symbol: u32, bids: &[Level], asks: &[Level], now: u64) {
+        let idx = symbol as usize;
+        if idx >= BOOK_SYMBOLS {
+            return;
+        }
+        let slot = unsafe {
+            &mut *(self.mmap.as_mut_ptr().add(HEADER_SIZE + idx * SLOT_SIZE) as *mut Slot)
+        };
+
+        let seq = slot.seq.load(Ordering::Relaxed);
+        slot.seq.store(seq | 1, Ordering::Relaxed);
+        fence(Ordering::Release);
+
+        let nb = bids.len().min(BOOK_DEPTH);
+        let na = asks.len().min(BOOK_DEPTH);
+        slot.bids[..nb].copy_from_slice(&bids[..nb]);
+        slot.asks[..na].copy_from_slice(&asks[..na]);
+        slot.num_bids = nb as u32;
+        slot.num_asks = na as u32;
+        slot.symbol = symbol;
+        slot.updated_at = now;
+
+        slot.seq.store((seq | 1) + 1, Ordering::Release);
+    }
+}
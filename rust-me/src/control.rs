@@ -0,0 +1,251 @@
+//! Engine side of the control socket, matching go-oms/handshake: the OMS
+//! announces which queue to attach to, both sides agree on a protocol
+//! version and capabilities, and either side can announce a shutdown.
+use std::fs::File;
+use std::io::{self, BufRead, BufReader, Cursor, Read, Write};
+use std::os::fd::{AsRawFd, FromRawFd, RawFd};
+use std::os::unix::net::UnixStream;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::time::{Duration, Instant};
+
+/// Highest protocol version spoken here
+pub const PROTOCOL_VERSION: u32 = 1;
+
+/// Optional features this engine supports, by the names go-oms uses
+pub const CAPABILITIES: &[&str] = &[
+    "flags",
+    "reasons",
+    "fill_reports",
+    "bust_correct",
+    "rfq",
+    "queue_fd",
+];
+
+/// The control socket of the OMS serving an order queue
+pub fn control_path<P: AsRef<Path>>(order_path: P) -> PathBuf {
+    let mut p = order_path.as_ref().as_os_str().to_owned();
+    p.push("_control");
+    PathBuf::from(p)
+}
+
+/// The queues the OMS announced
+pub enum Queues {
+    /// The order queue's path; the status queue is `status_path` of it
+    Path(PathBuf),
+    /// The order and status queues themselves, for queues in memory the
+    /// engine could not open by name (QUEUE_FD)
+    Files(File, File),
+}
+
+/// A completed handshake with the OMS
+pub struct Control {
+    stream: UnixStream,
+    pub version: u32,
+    pub capabilities: Vec<String>,
+}
+
+fn protocol_error(msg: String) -> io::Error {
+    io::Error::new(io::ErrorKind::InvalidData, msg)
+}
+
+fn read_line(r: &mut impl BufRead) -> io::Result<(String, String)> {
+    let mut line = String::new();
+    if r.read_line(&mut line)? == 0 {
+        return Err(io::ErrorKind::UnexpectedEof.into());
+    }
+    let line = line.trim_end_matches('\n');
+    let (verb, args) = line.split_once(' ').unwrap_or((line, ""));
+    Ok((verb.to_string(), args.to_string()))
+}
+
+/// Receive one message and any descriptors passed with it (SCM_RIGHTS),
+/// owned by the caller from here on
+fn recv_with_files(stream: &UnixStream) -> io::Result<(Vec<u8>, Vec<File>)> {
+    let mut buf = vec![0u8; 4096];
+    // u64s keep the control buffer aligned for cmsghdr; room for 8 fds
+    let mut control = [0u64; 8];
+    let mut iov = libc::iovec {
+        iov_base: buf.as_mut_ptr().cast(),
+        iov_len: buf.len(),
+    };
+    let mut msg: libc::msghdr = unsafe { std::mem::zeroed() };
+    msg.msg_iov = &mut iov;
+    msg.msg_iovlen = 1;
+    msg.msg_control = control.as_mut_ptr().cast();
+    msg.msg_controllen = std::mem::size_of_val(&control) as _;
+    let n = unsafe { libc::recvmsg(stream.as_raw_fd(), &mut msg, libc::MSG_CMSG_CLOEXEC) };
+    if n < 0 {
+        return Err(io::Error::last_os_error());
+    }
+    buf.truncate(n as usize);
+
+    let mut files = Vec::new();
+    let mut cmsg = unsafe { libc::CMSG_FIRSTHDR(&msg) };
+    while !cmsg.is_null() {
+        let hdr = unsafe { &*cmsg };
+        if hdr.cmsg_level == libc::SOL_SOCKET && hdr.cmsg_type == libc::SCM_RIGHTS {
+            let data = unsafe { libc::CMSG_DATA(cmsg) } as *const RawFd;
+            let len = hdr.cmsg_len as usize - unsafe { libc::CMSG_LEN(0) } as usize;
+            for i in 0..len / std::mem::size_of::<RawFd>() {
+                files.push(unsafe { File::from_raw_fd(data.add(i).read_unaligned()) });
+            }
+        }
+        cmsg = unsafe { libc::CMSG_NXTHDR(&msg, cmsg) };
+    }
+    if msg.msg_flags & libc::MSG_CTRUNC != 0 {
+        return Err(protocol_error(
+            "OMS passed more descriptors than expected".into(),
+        ));
+    }
+    Ok((buf, files))
+}
+
+impl Control {
+    /// Connect to the OMS and run the handshake up to the queue
+    /// announcement, returning the queues announced. Call `ready` once both
+    /// rings are mapped.
+    pub fn connect<P: AsRef<Path>>(socket: P) -> io::Result<(Control, Queues)> {
+        Self::handshake(UnixStream::connect(socket)?)
+    }
+
+    /// Like `connect`, for an engine that may start before the OMS, as the
+    /// containers of a pod do: while nothing serves `socket` yet, or a
+    /// stale one is refused, retry until `wait` has passed, logging when
+    /// it starts waiting and when the OMS comes up.
+    pub fn connect_wait<P: AsRef<Path>>(
+        socket: P,
+        wait: Duration,
+    ) -> io::Result<(Control, Queues)> {
+        let socket = socket.as_ref();
+        let deadline = Instant::now() + wait;
+        let mut delay = Duration::from_millis(10);
+        let mut waited = false;
+        loop {
+            match UnixStream::connect(socket) {
+                Ok(stream) => {
+                    if waited {
+                        println!("[Engine] Control: OMS up on {}", socket.display());
+                    }
+                    return Self::handshake(stream);
+                }
+                Err(e)
+                    if matches!(
+                        e.kind(),
+                        io::ErrorKind::NotFound | io::ErrorKind::ConnectionRefused
+                    ) && Instant::now() < deadline =>
+                {
+                    if !waited {
+                        println!(
+                            "[Engine] Control: waiting up to {:?} for the OMS on {}",
+                            wait,
+                            socket.display()
+                        );
+                        waited = true;
+                    }
+                    std::thread::sleep(delay.min(deadline - Instant::now()));
+                    delay = (delay * 2).min(Duration::from_secs(1));
+                }
+                Err(e) => return Err(e),
+            }
+        }
+    }
+
+    fn handshake(mut stream: UnixStream) -> io::Result<(Control, Queues)> {
+        stream.set_read_timeout(Some(Duration::from_secs(5)))?;
+        writeln!(
+            stream,
+            "HELLO {} {}",
+            PROTOCOL_VERSION,
+            CAPABILITIES.join(",")
+        )?;
+
+        // WELCOME arrives in one message with QUEUE, or with QUEUE_FD and
+        // the descriptors, which only recvmsg receives
+        let (welcome, mut files) = recv_with_files(&stream)?;
+        let mut r = BufReader::new(Cursor::new(welcome).chain(stream.try_clone()?));
+        let (verb, args) = read_line(&mut r)?;
+        if verb == "ERROR" {
+            return Err(protocol_error(format!("OMS refused handshake: {}", args)));
+        }
+        if verb != "WELCOME" {
+            return Err(protocol_error(format!("want WELCOME, got {:?}", verb)));
+        }
+        let (version, caps) = args.split_once(' ').unwrap_or((&args, ""));
+        let version: u32 = version
+            .parse()
+            .map_err(|_| protocol_error(format!("WELCOME version {:?}", version)))?;
+        if version > PROTOCOL_VERSION {
+            return Err(protocol_error(format!(
+                "OMS chose unknown version {}",
+                version
+            )));
+        }
+        let capabilities = caps
+            .split(',')
+            .filter(|c| !c.is_empty())
+            .map(String::from)
+            .collect();
+
+        let queues = match read_line(&mut r)? {
+            (verb, path) if verb == "QUEUE" && !path.is_empty() => {
+                Queues::Path(PathBuf::from(path))
+            }
+            (verb, _) if verb == "QUEUE_FD" && files.len() == 2 => {
+                let status = files.pop().unwrap();
+                Queues::Files(files.pop().unwrap(), status)
+            }
+            (verb, _) => {
+                return Err(protocol_error(format!(
+                    "want QUEUE or QUEUE_FD with 2 descriptors, got {:?} with {}",
+                    verb,
+                    files.len()
+                )));
+            }
+        };
+        stream.set_read_timeout(None)?;
+        let control = Control {
+            stream,
+            version,
+            capabilities,
+        };
+        Ok((control, queues))
+    }
+
+    /// Whether both sides support a capability
+    pub fn has(&self, capability: &str) -> bool {
+        self.capabilities.iter().any(|c| c == capability)
+    }
+
+    /// Tell the OMS both rings are mapped. Returns a flag that turns true
+    /// when the OMS announces shutdown or the socket closes.
+    pub fn ready(&mut self) -> io::Result<Arc<AtomicBool>> {
+        writeln!(self.stream, "READY")?;
+        let stop = Arc::new(AtomicBool::new(false));
+        let flag = stop.clone();
+        let mut r = BufReader::new(self.stream.try_clone()?);
+        std::thread::spawn(move || {
+            loop {
+                match read_line(&mut r) {
+                    Ok((verb, reason)) if verb == "SHUTDOWN" => {
+                        println!("[Engine] OMS shutting down: {}", reason);
+                        break;
+                    }
+                    Ok(_) => continue,
+                    Err(_) => {
+                        println!("[Engine] Control socket closed");
+                        break;
+                    }
+                }
+            }
+            flag.store(true, Ordering::Release);
+        });
+        Ok(stop)
+    }
+
+    /// Tell the OMS the engine is going away
+    pub fn shutdown(&mut self, reason: &str) -> io::Result<()> {
+        writeln!(self.stream, "SHUTDOWN {}", reason.replace('\n', " "))
+    }
+}
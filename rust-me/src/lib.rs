@@ -1,2 +1,5 @@
+pub mod book;
+pub mod control;
+pub mod path;
 pub mod queue;
 pub use queue::{Order, Queue, QueueError};
@@ -1,42 +1,174 @@
-use rust_me::queue::{Order, Queue, QueueError};
-use std::time::Instant;
+use rust_me::queue::{
+    LIQUIDITY_TAKER, MSG_BUST, MSG_CORRECT, MSG_NEW, MSG_QUOTE, MSG_QUOTE_HIT, MSG_QUOTE_REQUEST,
+    Order, Queue, QueueError, REASON_ENGINE, REASON_INVALID_FLAGS, REASON_NONE,
+    REASON_QUOTE_EXPIRED, REASON_UNKNOWN_ORDER, REASON_VALIDATION, STATUS_ACKED, STATUS_BUSTED,
+    STATUS_CORRECTED, STATUS_EXPIRED, STATUS_FILLED, STATUS_REJECTED, Sequenced, Sequencer,
+};
+use rust_me::book::{BookWriter, book_path};
+use rust_me::control::{Control, Queues, control_path};
+use rust_me::path::{default_queue_path, startup_wait, status_path};
+use std::collections::HashMap;
+use std::path::PathBuf;
+use std::sync::Arc;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::time::{Instant, SystemTime, UNIX_EPOCH};
 
 fn main() -> Result<(), Box<dyn std::error::Error>> {
     println!("[Engine] Starting Rust matching engine (rustc 1.91.0)...");
 
-    // Open order queue created by Go OMS
-    let mut order_queue = Queue::open("/tmp/sex")?;
-    println!("[Engine] Connected to order queue");
+    // With --control [socket] the OMS announces the order queue over its
+    // control socket; otherwise open the queue given, else $OMS_QUEUE_PATH
+    // or the runtime dir. $OMS_STARTUP_WAIT lets the engine start first and
+    // wait for the OMS and its queues, as a sidecar in the same pod may.
+    let wait = startup_wait()?;
+    let mut args = std::env::args_os().skip(1);
+    let first = args.next();
+    let (mut control, queues) = if first.as_deref() == Some("--control".as_ref()) {
+        let socket = args
+            .next()
+            .map(PathBuf::from)
+            .unwrap_or_else(|| control_path(default_queue_path()));
+        let (c, queues) = Control::connect_wait(&socket, wait)?;
+        println!(
+            "[Engine] Handshake with OMS on {} (protocol {}, capabilities {:?})",
+            socket.display(),
+            c.version,
+            c.capabilities
+        );
+        (Some(c), queues)
+    } else {
+        let path = first.map(PathBuf::from).unwrap_or_else(default_queue_path);
+        (None, Queues::Path(path))
+    };
+    let (mut order_queue, mut status_queue, order_path) = match queues {
+        Queues::Path(path) => {
+            let orders = Queue::open_wait(&path, wait)?;
+            println!("[Engine] Connected to order queue {}", path.display());
+            // Open status feedback queue
+            let status = Queue::open_wait(status_path(&path), wait)?;
+            println!("[Engine] Connected to status queue");
+            (orders, status, Some(path))
+        }
+        Queues::Files(orders, status) => {
+            let queues = (Queue::from_file(orders)?, Queue::from_file(status)?);
+            println!("[Engine] Connected to the order and status queues passed by the OMS");
+            (queues.0, queues.1, None)
+        }
+    };
 
-    // Open status feedback queue
-    let mut status_queue = Queue::open("/tmp/sex_status")?;
-    println!("[Engine] Connected to status queue");
+    // Book snapshots for Go price collars. This engine fills or rejects on
+    // arrival and rests nothing, so every symbol reads as empty for now.
+    // Queues passed in memory have no directory to keep them next to.
+    let _book = order_path
+        .map(|path| BookWriter::create(book_path(&path)))
+        .transpose()?;
+
+    // Set when the OMS announces shutdown; never without a control socket
+    let stop = match control.as_mut() {
+        Some(c) => c.ready()?,
+        None => Arc::new(AtomicBool::new(false)),
+    };
 
     println!("[Engine] Waiting for orders (spinning)...\n");
 
     let mut order_count = 0u64;
     let start = Instant::now();
+    // Fills in force, by order id, so erroneous trades can be busted or
+    // corrected for the rest of the session
+    let mut fills: HashMap<u64, Order> = HashMap::new();
+    // Quotes that may still be hit, by quote request id
+    let mut quotes: HashMap<u64, Order> = HashMap::new();
+    // Ids seen, to ask for lost orders again and drop the ones resent twice
+    let mut sequencer = Sequencer::default();
 
-    loop {
+    while !stop.load(Ordering::Acquire) {
         // Try to dequeue with spinning for lower latency
         match order_queue.dequeue_spin(100)? {
             Some(order) => {
+                if Sequencer::sequenced(&order) {
+                    match sequencer.observe(order.order_id) {
+                        Sequenced::New => {}
+                        Sequenced::Gap(from) => {
+                            eprintln!(
+                                "[Engine] Order ids skipped before {}, asking for a resend from {}",
+                                order.order_id, from
+                            );
+                            send_status(&mut status_queue, Order::resend_from(from, now_nanos()));
+                        }
+                        // already executed: a resend covers more than the gap
+                        Sequenced::Duplicate => continue,
+                    }
+                }
                 order_count += 1;
 
-                // Execute trade (simplified)
-                let executed = execute_order(&order);
-
                 // Send status back to Go OMS
                 let mut status = order;
-                status.status = if executed { 1 } else { 2 };
+                status.status = if order.msg_type == MSG_BUST || order.msg_type == MSG_CORRECT {
+                    // Trade bust/correction: report the amended fill, then ack
+                    match amend_fill(&mut fills, &order) {
+                        Some((busted, corrected)) => {
+                            send_status(&mut status_queue, busted);
+                            if let Some(corrected) = corrected {
+                                send_status(&mut status_queue, corrected);
+                            }
+                            STATUS_ACKED
+                        }
+                        None => {
+                            status.reason = REASON_UNKNOWN_ORDER;
+                            STATUS_REJECTED
+                        }
+                    }
+                } else if order.msg_type == MSG_QUOTE_REQUEST {
+                    // RFQ: answer with a firm quote, or reject the request
+                    match make_quote(&order, now_nanos()) {
+                        Ok(quote) => {
+                            quotes.insert(order.order_id, quote);
+                            status = quote;
+                            quote.status
+                        }
+                        Err(reason) => {
+                            status.reason = reason;
+                            STATUS_REJECTED
+                        }
+                    }
+                } else if order.msg_type == MSG_QUOTE_HIT {
+                    // Trade the quote: report the fill of the request, then ack
+                    match hit_quote(&mut quotes, &order, now_nanos()) {
+                        Ok(fill) => {
+                            fills.insert(fill.order_id, fill);
+                            send_status(&mut status_queue, fill);
+                            STATUS_ACKED
+                        }
+                        Err(reason) => {
+                            status.reason = reason;
+                            STATUS_REJECTED
+                        }
+                    }
+                } else if order.msg_type != MSG_NEW {
+                    // Mass cancel: this engine rests nothing, so there are no
+                    // per-order cancel reports to send before the ack
+                    STATUS_ACKED
+                } else if order.is_expired(now_nanos()) {
+                    // GTD/GTT order went stale before it reached us
+                    STATUS_EXPIRED
+                } else {
+                    // Execute trade (simplified)
+                    status.reason = execute_order(&order);
+                    if status.reason == REASON_NONE {
+                        // fills on arrival, so always against liquidity; the
+                        // simulated contra side is not disclosed
+                        status.liquidity = LIQUIDITY_TAKER;
+                        status.fee = taker_fee(&order);
+                        STATUS_FILLED
+                    } else {
+                        STATUS_REJECTED
+                    }
+                };
 
-                // Handle backpressure on status queue
-                if let Err(QueueError::QueueFull { depth }) = status_queue.enqueue(status) {
-                    eprintln!(
-                        "[Engine] Status queue backpressure (depth {}), dropping status for order {}",
-                        depth, order.order_id
-                    );
+                if status.status == STATUS_FILLED {
+                    fills.insert(order.order_id, status);
                 }
+                send_status(&mut status_queue, status);
 
                 // Report throughput every 1000 orders
                 if order_count % 1000 == 0 {
@@ -57,16 +189,140 @@ fn main() -> Result<(), Box<dyn std::error::Error>> {
             }
         }
     }
+
+    println!("[Engine] Stopping after {} orders", order_count);
+    if let Some(c) = control.as_mut() {
+        let _ = c.shutdown("engine stopping");
+    }
+    Ok(())
+}
+
+/// Wall clock in unix nanos, comparable with Order::expire_at
+fn now_nanos() -> u64 {
+    SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map(|d| d.as_nanos() as u64)
+        .unwrap_or(0)
+}
+
+/// Send a status record back to Go, dropping it on backpressure
+fn send_status(status_queue: &mut Queue, status: Order) {
+    if let Err(QueueError::QueueFull { depth }) = status_queue.enqueue(status) {
+        eprintln!(
+            "[Engine] Status queue backpressure (depth {}), dropping status for order {}",
+            depth, status.order_id
+        );
+    }
+}
+
+/// Bust or correct the fill of `ctrl.order_id`. Returns the reversed fill as
+/// STATUS_BUSTED and, for a correction, the replacement as STATUS_CORRECTED;
+/// None if the client has no fill in force for that order.
+fn amend_fill(fills: &mut HashMap<u64, Order>, ctrl: &Order) -> Option<(Order, Option<Order>)> {
+    let fill = *fills.get(&ctrl.order_id)?;
+    if fill.client_id != ctrl.client_id {
+        return None;
+    }
+    let mut busted = fill;
+    busted.status = STATUS_BUSTED;
+    busted.timestamp = ctrl.timestamp;
+    if ctrl.msg_type == MSG_BUST {
+        fills.remove(&ctrl.order_id);
+        return Some((busted, None));
+    }
+    let mut corrected = busted;
+    corrected.status = STATUS_CORRECTED;
+    corrected.price = ctrl.price;
+    corrected.shares_qty = ctrl.shares_qty;
+    corrected.fee = taker_fee(&corrected);
+    // the table keeps fills as reported, ready for a later bust
+    let mut in_force = corrected;
+    in_force.status = STATUS_FILLED;
+    fills.insert(ctrl.order_id, in_force);
+    Some((busted, Some(corrected)))
+}
+
+/// How far from the requester's reference price this engine quotes, in
+/// basis points, and how long a quote stays firm
+const QUOTE_SPREAD_BPS: u64 = 5;
+const QUOTE_TTL_NANOS: u64 = 5_000_000_000;
+
+/// Quote a request at its reference price plus the spread for a buy, less
+/// it for a sell, firm until the request's own expiry or the quote TTL,
+/// whichever comes first. Err is the reject reason.
+fn make_quote(req: &Order, now: u64) -> Result<Order, u8> {
+    if req.shares_qty == 0 || req.price == 0 {
+        return Err(REASON_VALIDATION);
+    }
+    if req.is_expired(now) {
+        return Err(REASON_QUOTE_EXPIRED);
+    }
+    let spread = req.price.saturating_mul(QUOTE_SPREAD_BPS) / 10_000;
+    let mut quote = *req;
+    quote.msg_type = MSG_QUOTE;
+    quote.status = STATUS_ACKED;
+    quote.price = if req.side == 1 {
+        req.price - spread
+    } else {
+        req.price.saturating_add(spread)
+    };
+    let ttl = now.saturating_add(QUOTE_TTL_NANOS);
+    quote.expire_at = if req.expire_at != 0 { req.expire_at.min(ttl) } else { ttl };
+    quote.timestamp = now;
+    Ok(quote)
+}
+
+/// Trade `hit` against the quote it names. The quote must be live, the
+/// hitter's, at the price hit and for no more than its quantity; it is used
+/// up either way once traded. Returns the fill of the quote request.
+fn hit_quote(quotes: &mut HashMap<u64, Order>, hit: &Order, now: u64) -> Result<Order, u8> {
+    let quote = *quotes.get(&hit.order_id).ok_or(REASON_QUOTE_EXPIRED)?;
+    if quote.client_id != hit.client_id {
+        return Err(REASON_UNKNOWN_ORDER);
+    }
+    if now >= quote.expire_at {
+        quotes.remove(&hit.order_id);
+        return Err(REASON_QUOTE_EXPIRED);
+    }
+    if hit.price != quote.price || hit.shares_qty == 0 || hit.shares_qty > quote.shares_qty {
+        return Err(REASON_VALIDATION);
+    }
+    quotes.remove(&hit.order_id);
+    let mut fill = quote;
+    fill.msg_type = MSG_NEW;
+    fill.status = STATUS_FILLED;
+    fill.shares_qty = hit.shares_qty;
+    fill.liquidity = LIQUIDITY_TAKER;
+    fill.fee = taker_fee(&fill);
+    fill.timestamp = hit.timestamp;
+    fill.expire_at = 0;
+    Ok(fill)
+}
+
+/// Taker fee charged on a fill, in basis points of notional
+const TAKER_FEE_BPS: u64 = 3;
+
+fn taker_fee(order: &Order) -> i32 {
+    let notional = order.price.saturating_mul(order.shares_qty as u64);
+    (notional.saturating_mul(TAKER_FEE_BPS) / 10_000).min(i32::MAX as u64) as i32
 }
 
-/// Simulate order execution (matching engine logic goes here)
-fn execute_order(order: &Order) -> bool {
+/// Simulate order execution (matching engine logic goes here). Returns
+/// REASON_NONE for a fill, else why the order was rejected.
+fn execute_order(order: &Order) -> u8 {
     // Validate order
     if order.shares_qty == 0 || order.price == 0 {
-        return false; // Reject invalid
+        return REASON_VALIDATION;
+    }
+    if !order.flags_valid() {
+        return REASON_INVALID_FLAGS;
     }
 
     // In production: check order book, execute match, update positions
     // For now: accept 90% of orders
-    order.order_id % 10 != 0
+    if order.order_id % 10 == 0 {
+        REASON_ENGINE
+    } else {
+        REASON_NONE
+    }
 }
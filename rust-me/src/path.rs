@@ -0,0 +1,184 @@
+//! Queue path defaults and validation, matching go-oms/queue/path.go
+use std::env;
+use std::fs;
+use std::os::unix::fs::{MetadataExt, PermissionsExt};
+use std::path::{Path, PathBuf};
+use std::time::Duration;
+
+/// Overrides the default order queue path for every binary
+pub const ENV_QUEUE_PATH: &str = "OMS_QUEUE_PATH";
+
+/// Overrides `runtime_dir`, e.g. with a volume shared by the containers of
+/// a pod
+pub const ENV_RUNTIME_DIR: &str = "OMS_RUNTIME_DIR";
+
+/// How long to wait for the OMS at startup; see `startup_wait`
+pub const ENV_STARTUP_WAIT: &str = "OMS_STARTUP_WAIT";
+
+/// The tmpfs `runtime_dir` falls back to, as go-oms/queue/path.go does
+pub const SHM_DIR: &str = "/dev/shm";
+
+/// `$OMS_RUNTIME_DIR`, else `$XDG_RUNTIME_DIR/oms`, else a per-user
+/// directory in /dev/shm, or under the temp dir without it. Any local user
+/// can create that last one first, so `validate_path` refuses queues in it
+/// unless it is this user's and private.
+pub fn runtime_dir() -> PathBuf {
+    if let Some(dir) = env::var_os(ENV_RUNTIME_DIR).filter(|d| !d.is_empty()) {
+        return PathBuf::from(dir);
+    }
+    if let Some(dir) = env::var_os("XDG_RUNTIME_DIR").filter(|d| !d.is_empty()) {
+        return PathBuf::from(dir).join("oms");
+    }
+    fallback_dir()
+}
+
+/// The process' effective uid: /proc/self is owned by it
+fn euid() -> u32 {
+    fs::metadata("/proc/self").map(|m| m.uid()).unwrap_or(0)
+}
+
+/// The per-user directory `runtime_dir` falls back to
+fn fallback_dir() -> PathBuf {
+    let base = if fs::metadata(SHM_DIR).is_ok_and(|m| m.is_dir()) {
+        PathBuf::from(SHM_DIR)
+    } else {
+        env::temp_dir()
+    };
+    base.join(format!("oms-{}", euid()))
+}
+
+/// `$OMS_QUEUE_PATH`, else `runtime_dir()/orders`. With `$OMS_RUNTIME_DIR`
+/// set, a relative `$OMS_QUEUE_PATH` is a name under it.
+pub fn default_queue_path() -> PathBuf {
+    match env::var_os(ENV_QUEUE_PATH).filter(|p| !p.is_empty()) {
+        Some(p) if Path::new(&p).is_relative() && env::var_os(ENV_RUNTIME_DIR).is_some() => {
+            runtime_dir().join(p)
+        }
+        Some(p) => PathBuf::from(p),
+        None => runtime_dir().join("orders"),
+    }
+}
+
+/// `$OMS_STARTUP_WAIT`: a number and one unit, "500ms", "30s" or "2m", or
+/// plain seconds; zero when unset, as on the Go side. Go accepts more
+/// forms, so a value this cannot parse is an error rather than zero.
+pub fn startup_wait() -> Result<Duration, String> {
+    let Some(s) = env::var(ENV_STARTUP_WAIT).ok().filter(|s| !s.is_empty()) else {
+        return Ok(Duration::ZERO);
+    };
+    let split = s.find(|c: char| !c.is_ascii_digit()).unwrap_or(s.len());
+    let (n, unit) = s.split_at(split);
+    let invalid = || format!("invalid {ENV_STARTUP_WAIT} {s:?}: want a duration like 30s");
+    let n: u64 = n.parse().map_err(|_| invalid())?;
+    match unit {
+        "ms" => Ok(Duration::from_millis(n)),
+        "" | "s" => Ok(Duration::from_secs(n)),
+        "m" => Ok(Duration::from_secs(n * 60)),
+        _ => Err(invalid()),
+    }
+}
+
+/// A stream directory's queue file, next to `meta.json`; see
+/// go-oms/queue/stream.go
+pub const STREAM_DATA_FILE: &str = "data";
+/// Held shared by every process attached to a stream
+pub const STREAM_LOCK_FILE: &str = "lock";
+
+/// Whether `path` is a stream directory rather than a bare queue file
+pub fn is_stream(path: &Path) -> bool {
+    let is_dir = fs::symlink_metadata(path).is_ok_and(|m| m.is_dir());
+    is_dir && fs::symlink_metadata(path.join(STREAM_DATA_FILE)).is_ok_and(|m| m.is_file())
+}
+
+/// The status queue paired with an order queue
+pub fn status_path<P: AsRef<Path>>(order_path: P) -> PathBuf {
+    let mut p = order_path.as_ref().as_os_str().to_owned();
+    p.push("_status");
+    PathBuf::from(p)
+}
+
+/// Reject paths another local user could redirect: a symlink or non-regular
+/// file, or a parent that is a symlink, not a directory, or world-writable
+/// without the sticky bit. Under `runtime_dir`'s per-user fallback in a
+/// shared temp dir, that directory must also be owned by this user and mode
+/// 0700 or 0750.
+pub fn validate_path(path: &Path) -> Result<(), String> {
+    let fallback = fallback_dir();
+    let abs = env::current_dir()
+        .map(|cwd| cwd.join(path))
+        .unwrap_or_default();
+    if abs.starts_with(&fallback) {
+        check_private(&fallback, euid())?;
+    }
+
+    if let Ok(meta) = fs::symlink_metadata(path) {
+        let ft = meta.file_type();
+        if ft.is_symlink() {
+            return Err(format!("queue path {} is a symlink", path.display()));
+        }
+        if ft.is_dir() {
+            return Err(format!("queue path {} is a directory", path.display()));
+        }
+        if !ft.is_file() {
+            return Err(format!("queue path {} is not a regular file", path.display()));
+        }
+    }
+
+    let dir = match path.parent() {
+        Some(d) if !d.as_os_str().is_empty() => d,
+        _ => Path::new("."),
+    };
+    let meta = fs::symlink_metadata(dir)
+        .map_err(|e| format!("failed to stat queue directory {}: {}", dir.display(), e))?;
+    if meta.file_type().is_symlink() {
+        return Err(format!("queue directory {} is a symlink", dir.display()));
+    }
+    if !meta.is_dir() {
+        return Err(format!("queue directory {} is not a directory", dir.display()));
+    }
+    let mode = meta.permissions().mode();
+    if mode & 0o002 != 0 && mode & 0o1000 == 0 {
+        return Err(format!(
+            "queue directory {} is world-writable without the sticky bit",
+            dir.display()
+        ));
+    }
+    Ok(())
+}
+
+/// Whether `dir`, if it exists, is a directory owned by `uid` that no one
+/// outside its group can write to or enter
+fn check_private(dir: &Path, uid: u32) -> Result<(), String> {
+    let meta = match fs::symlink_metadata(dir) {
+        Ok(meta) => meta,
+        Err(e) if e.kind() == std::io::ErrorKind::NotFound => return Ok(()),
+        Err(e) => {
+            return Err(format!(
+                "failed to stat queue directory {}: {}",
+                dir.display(),
+                e
+            ));
+        }
+    };
+    if !meta.file_type().is_dir() {
+        return Err(format!("runtime directory {} is not a directory", dir.display()));
+    }
+    if meta.uid() != uid {
+        return Err(format!(
+            "runtime directory {} is owned by uid {}, not {}: set {}",
+            dir.display(),
+            meta.uid(),
+            uid,
+            ENV_RUNTIME_DIR
+        ));
+    }
+    let perm = meta.permissions().mode() & 0o777;
+    if perm != 0o700 && perm != 0o750 {
+        return Err(format!(
+            "runtime directory {} has mode {:o}, want 0700 or 0750",
+            dir.display(),
+            perm
+        ));
+    }
+    Ok(())
+}
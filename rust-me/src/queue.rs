@@ -1,84 +1,237 @@
 use memmap2::MmapMut;
-use std::fs::OpenOptions;
+use std::fs::{File, OpenOptions};
+use std::os::fd::AsRawFd;
 use std::path::Path;
 use std::sync::atomic::{AtomicU32, AtomicU64, Ordering};
-
-#[repr(C)]
-#[derive(Clone, Copy, Debug)]
-pub struct Order {
-    // All u64s first (8-byte aligned)
-    pub order_id: u64,
-    pub price: u64,
-    pub timestamp: u64,
-    // Then u32s (4-byte aligned)
-    pub client_id: u32,
-    pub shares_qty: u32,
-    // Then u8s (1-byte aligned)
-    pub symbol: u32,
-    pub side: u8,   // 0=buy, 1=sell
-    pub status: u8, // 0=pending, 1=filled, 2=rejected
-    // Array of bytes last
+use std::time::{Duration, Instant};
+
+// Order and QueueHeader, their STATUS_*, MSG_*, TIF_*, LIQUIDITY_* and FLAG_*
+// constants, and compile-time layout assertions (fail build if wrong), from
+// go-oms/queue/schema.json, the layout shared with the Go side
+include!(concat!(env!("OUT_DIR"), "/schema.rs"));
+
+// Reject reasons (REASON_*, REASON_NAMES), shared with go-oms/queue/reasons.go
+include!(concat!(env!("OUT_DIR"), "/reasons.rs"));
+
+// An order's fingerprint is FNV-1a over the little-endian bytes of the
+// fields schema.json marks, in schema order; go-oms/queue/fingerprint.go has
+// the rationale. Order::fingerprint is generated from the same marks.
+const FINGERPRINT_BASIS: u64 = 14695981039346656037;
+const FINGERPRINT_PRIME: u64 = 1099511628211;
+
+/// Hash the low `n` bytes of `v` into `h`, least significant first.
+#[inline(always)]
+fn fingerprint_add(mut h: u64, mut v: u64, n: u32) -> u64 {
+    for _ in 0..n {
+        h ^= v & 0xff;
+        h = h.wrapping_mul(FINGERPRINT_PRIME);
+        v >>= 8;
+    }
+    h
 }
 
-impl Default for Order {
-    fn default() -> Self {
+impl Order {
+    /// True once a GTD/GTT order has reached `expire_at` (unix nanos)
+    #[inline(always)]
+    pub fn is_expired(&self, now: u64) -> bool {
+        self.time_in_force != TIF_GOOD_TILL_CANCEL && self.expire_at != 0 && now >= self.expire_at
+    }
+
+    /// Same rules as Order.ValidateFlags on the Go side: known bits only,
+    /// none on control messages, post-only never with all-or-none, and the
+    /// short marks on sells only, one at a time.
+    #[inline(always)]
+    pub fn flags_valid(&self) -> bool {
+        let both = FLAG_POST_ONLY | FLAG_ALL_OR_NONE;
+        let short = FLAG_SHORT | FLAG_SHORT_EXEMPT;
+        self.flags & !FLAGS_KNOWN == 0
+            && (self.flags == 0 || self.msg_type == MSG_NEW)
+            && self.flags & both != both
+            && (self.flags & short == 0 || self.side == 1)
+            && self.flags & short != short
+    }
+
+    /// Request the producer republish every order with id >= `from_id`.
+    /// Post it on the status queue after `Sequencer` finds a gap; resent
+    /// orders keep their ids, and it drops those already processed.
+    pub fn resend_from(from_id: u64, timestamp: u64) -> Order {
         Order {
-            order_id: 0,
-            client_id: 0,
-            symbol: 0,
-            shares_qty: 0,
-            price: 0,
-            side: 0,
-            timestamp: 0,
-            status: 0,
+            order_id: from_id,
+            timestamp,
+            msg_type: MSG_RESEND,
+            ..Order::default()
         }
     }
 }
 
-// QueueHeader with cache-line padding matching Go
-#[repr(C)]
-pub struct QueueHeader {
-    producer_head: AtomicU64, // offset 0
-    _pad1: [u8; 56],          // pad to 64B
-    consumer_tail: AtomicU64, // offset 64
-    _pad2: [u8; 56],          // pad to 128B
-    magic: AtomicU32,         // offset 128
-    capacity: AtomicU32,      // offset 132
+/// How many gaps a `Sequencer` remembers; the oldest is forgotten first
+pub const SEQUENCER_GAPS: usize = 1024;
+
+/// What a `Sequencer` makes of an order id
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Sequenced {
+    /// Next in sequence, or one that fills a gap: process it
+    New,
+    /// New, but ids before it were skipped: process it and post
+    /// `Order::resend_from` the id in here
+    Gap(u64),
+    /// Already seen, e.g. resent: drop it
+    Duplicate,
+}
+
+/// Tracks the order ids a consumer has seen. Producers take the ids of new
+/// orders, quote requests and mass cancels from one increasing sequence
+/// (go-oms/orderid), so a skipped id is a lost message; cancels, busts,
+/// corrections and quote hits carry the id they act on and are not
+/// sequenced. Ids below the highest seen are new only inside a gap.
+#[derive(Debug, Default)]
+pub struct Sequencer {
+    last: u64,             // highest id seen, 0 before the first
+    gaps: Vec<(u64, u64)>, // ids skipped, as ascending inclusive ranges
+}
+
+impl Sequencer {
+    /// Whether `order` takes its id from the sequence
+    pub fn sequenced(order: &Order) -> bool {
+        matches!(
+            order.msg_type,
+            MSG_NEW | MSG_QUOTE_REQUEST | MSG_CANCEL_ALL | MSG_CANCEL_ALL_SYMBOL
+        )
+    }
+
+    /// Record a sequenced order's id and say what to do with the order
+    pub fn observe(&mut self, id: u64) -> Sequenced {
+        if self.last == 0 || id == self.last + 1 {
+            self.last = id;
+            return Sequenced::New;
+        }
+        if id > self.last {
+            if self.gaps.len() == SEQUENCER_GAPS {
+                self.gaps.remove(0);
+            }
+            let from = self.last + 1;
+            self.gaps.push((from, id - 1));
+            self.last = id;
+            return Sequenced::Gap(from);
+        }
+        // a resent or late id: new only if it fills part of a gap
+        let Some(i) = self.gaps.iter().position(|&(lo, hi)| lo <= id && id <= hi) else {
+            return Sequenced::Duplicate;
+        };
+        let (lo, hi) = self.gaps[i];
+        match (id == lo, id == hi) {
+            (true, true) => {
+                self.gaps.remove(i);
+            }
+            (true, false) => self.gaps[i].0 = id + 1,
+            (false, true) => self.gaps[i].1 = id - 1,
+            (false, false) => {
+                self.gaps[i].1 = id - 1;
+                self.gaps.insert(i + 1, (id + 1, hi));
+            }
+        }
+        Sequenced::New
+    }
 }
 
 const QUEUE_MAGIC: u32 = 0xDEADBEEF;
+const BYTE_ORDER_MARK: u32 = 0x01020304;
 const QUEUE_CAPACITY: usize = 65536;
 const ORDER_SIZE: usize = std::mem::size_of::<Order>();
 const HEADER_SIZE: usize = std::mem::size_of::<QueueHeader>();
 const TOTAL_SIZE: usize = HEADER_SIZE + (QUEUE_CAPACITY * ORDER_SIZE);
 
-// Compile-time layout assertions (fail build if wrong)
-const _: () = assert!(ORDER_SIZE == 40, "Order must be 40 bytes");
-const _: () = assert!(HEADER_SIZE == 136, "QueueHeader must be 136 bytes");
-const _: () = {
-    // Verify ConsumerTail is at offset 64
-    assert!(
-        std::mem::offset_of!(QueueHeader, consumer_tail) == 64,
-        "ConsumerTail must be at offset 64"
-    );
-};
-
 #[derive(Debug)]
 pub struct Queue {
     mmap: MmapMut,
 
     header_ptr: *mut QueueHeader, // Cached pointer
     orders_ptr: *mut Order,       // Cached orders pointer
+    swapped: bool,                // File written with the opposite byte order
+    _lock: Option<File>,          // Stream lock, held shared while attached
+    entry: Option<usize>,         // Our entry in the header's attached registry
+    roles: u32,                   // ROLE_* bits already marked in the entry
 }
 
 impl Queue {
     pub fn open<P: AsRef<Path>>(path: P) -> Result<Self, QueueError> {
+        Self::open_with(path, false)
+    }
+
+    /// Like `open`, for an engine that may start before the OMS creates the
+    /// queue, as the containers of a pod do: while nothing is at `path`
+    /// yet, or its stream is still being created, retry until `wait` has
+    /// passed. Any other error is returned at once, as go-oms
+    /// OpenQueueWait does.
+    pub fn open_wait<P: AsRef<Path>>(path: P, wait: Duration) -> Result<Self, QueueError> {
+        let path = path.as_ref();
+        let deadline = Instant::now() + wait;
+        let mut delay = Duration::from_millis(10);
+        loop {
+            let err = match Self::open(path) {
+                Err(e @ QueueError::StreamBusy(_)) => e,
+                Err(e) if !path.exists() => e,
+                Err(e) if path.is_dir() && !crate::path::is_stream(path) => e,
+                result => return result,
+            };
+            let now = Instant::now();
+            if now >= deadline {
+                return Err(err);
+            }
+            std::thread::sleep(delay.min(deadline - now));
+            delay = (delay * 2).min(Duration::from_secs(1));
+        }
+    }
+
+    /// Like `open`, but also accepts files written with the opposite byte
+    /// order. Orders and indices are byte-swapped on dequeue.
+    pub fn open_foreign<P: AsRef<Path>>(path: P) -> Result<Self, QueueError> {
+        Self::open_with(path, true)
+    }
+
+    fn open_with<P: AsRef<Path>>(path: P, allow_foreign: bool) -> Result<Self, QueueError> {
+        let path = path.as_ref();
+        // A stream directory: attach to its data file like the Go side, so
+        // the stream cannot be recreated or compacted under us
+        let (path, lock) = if crate::path::is_stream(path) {
+            let lock = File::open(path.join(crate::path::STREAM_LOCK_FILE))
+                .map_err(|e| QueueError::FileOpen(e.to_string()))?;
+            lock.try_lock_shared().map_err(|e| {
+                QueueError::StreamBusy(format!("stream {} is locked: {}", path.display(), e))
+            })?;
+            (path.join(crate::path::STREAM_DATA_FILE), Some(lock))
+        } else {
+            (path.to_path_buf(), None)
+        };
+        crate::path::validate_path(&path).map_err(QueueError::InvalidPath)?;
+
         let file = OpenOptions::new()
             .read(true)
             .write(true)
-            .open(path)
+            .open(&path)
             .map_err(|e| QueueError::FileOpen(e.to_string()))?;
+        Self::map(&file, lock, allow_foreign)
+    }
+
+    /// Attach to a queue through an open file, such as a memfd the OMS
+    /// passed over the control socket (see `control::Queues::Files`). A
+    /// memfd must be sealed against shrinking, as go-oms seals its own.
+    pub fn from_file(file: File) -> Result<Self, QueueError> {
+        let fd = file.as_raw_fd();
+        let link = std::fs::read_link(format!("/proc/self/fd/{fd}")).unwrap_or_default();
+        if link.to_string_lossy().starts_with("/memfd:") {
+            let seals = unsafe { libc::fcntl(fd, libc::F_GET_SEALS) };
+            if seals < 0 || seals & libc::F_SEAL_SHRINK == 0 {
+                return Err(QueueError::FileOpen(format!(
+                    "{} is not sealed against shrinking",
+                    link.display()
+                )));
+            }
+        }
+        Self::map(&file, None, false)
+    }
 
+    fn map(file: &File, lock: Option<File>, allow_foreign: bool) -> Result<Self, QueueError> {
         let metadata = file
             .metadata()
             .map_err(|e| QueueError::FileStat(e.to_string()))?;
@@ -90,7 +243,7 @@ impl Queue {
         }
 
         let mut mmap =
-            unsafe { MmapMut::map_mut(&file) }.map_err(|e| QueueError::Mmap(e.to_string()))?;
+            unsafe { MmapMut::map_mut(file) }.map_err(|e| QueueError::Mmap(e.to_string()))?;
 
         if let Err(e) = mmap.lock() {
             eprintln!("Warning: failed to mlock: {}", e);
@@ -102,12 +255,26 @@ impl Queue {
 
         // Validate
         let header = unsafe { &*header_ptr };
-        let magic = header.magic.load(Ordering::Relaxed);
+        let mark = header.byte_order.load(Ordering::Relaxed);
+        let swapped = if mark == BYTE_ORDER_MARK {
+            false
+        } else if mark == BYTE_ORDER_MARK.swap_bytes() {
+            if !allow_foreign {
+                return Err(QueueError::ForeignByteOrder);
+            }
+            true
+        } else {
+            return Err(QueueError::InvalidByteOrder { got: mark });
+        };
+
+        let swap32 = |v: u32| if swapped { v.swap_bytes() } else { v };
+
+        let magic = swap32(header.magic.load(Ordering::Relaxed));
         if magic != QUEUE_MAGIC {
             return Err(QueueError::InvalidMagic { got: magic });
         }
 
-        let capacity = header.capacity.load(Ordering::Relaxed);
+        let capacity = swap32(header.capacity.load(Ordering::Relaxed));
         if capacity != QUEUE_CAPACITY as u32 {
             return Err(QueueError::CapacityMismatch {
                 got: capacity,
@@ -115,11 +282,74 @@ impl Queue {
             });
         }
 
-        Ok(Queue {
+        let mut queue = Queue {
             mmap,
             header_ptr,
             orders_ptr,
-        })
+            swapped,
+            _lock: lock,
+            entry: None,
+            roles: 0,
+        };
+        // Foreign captures stay out of the registry
+        if !swapped {
+            queue.attach();
+        }
+        Ok(queue)
+    }
+
+    /// Claim an entry in the header's registry of attached processes,
+    /// freeing those of processes that died without detaching, as
+    /// go-oms/queue/attach.go does. Entries from another PID namespace are
+    /// never freed: their PIDs mean nothing here. With every entry taken the
+    /// queue works unregistered.
+    fn attach(&mut self) {
+        let pid = std::process::id();
+        let ns = pid_namespace();
+        let mut entry = None;
+        for (i, a) in self.header().attached.iter().enumerate() {
+            let mut owner = a.pid.load(Ordering::Acquire);
+            let theirs = self.header().attached_ns[i].inode.load(Ordering::Acquire);
+            let foreign = theirs != 0 && ns != 0 && theirs != ns;
+            if owner != 0
+                && !foreign
+                && !process_alive(owner)
+                && a.pid
+                    .compare_exchange(owner, 0, Ordering::AcqRel, Ordering::Relaxed)
+                    .is_ok()
+            {
+                owner = 0;
+            }
+            if owner == 0
+                && entry.is_none()
+                && a.pid
+                    .compare_exchange(0, pid, Ordering::AcqRel, Ordering::Relaxed)
+                    .is_ok()
+            {
+                let now = std::time::SystemTime::now()
+                    .duration_since(std::time::UNIX_EPOCH)
+                    .map_or(0, |d| d.as_nanos() as u64);
+                self.header().attached_ns[i]
+                    .inode
+                    .store(ns, Ordering::Release);
+                a.roles.store(0, Ordering::Release);
+                a.attached_at.store(now, Ordering::Release);
+                entry = Some(i);
+            }
+        }
+        self.entry = entry;
+    }
+
+    /// Record a ROLE_* bit in our registry entry; callers check `roles`
+    /// first, so the hot paths pay only a branch.
+    #[cold]
+    fn mark_role(&mut self, role: u32) {
+        self.roles |= role;
+        if let Some(i) = self.entry {
+            self.header().attached[i]
+                .roles
+                .fetch_or(role, Ordering::AcqRel);
+        }
     }
 
     /// Get mutable header reference - ZERO COST
@@ -151,6 +381,13 @@ impl Queue {
     /// ULTRA-FAST dequeue - all pointers cached, no borrows
     #[inline]
     pub fn dequeue(&mut self) -> Result<Option<Order>, QueueError> {
+        if self.roles & ROLE_CONSUMER == 0 {
+            self.mark_role(ROLE_CONSUMER);
+        }
+        if self.swapped {
+            return Ok(self.dequeue_swapped());
+        }
+
         let header = self.header_mut();
 
         let producer_head = header.producer_head.load(Ordering::Acquire);
@@ -170,7 +407,35 @@ impl Queue {
         Ok(Some(order))
     }
 
+    /// Slow path for foreign byte order files (capture replay only)
+    fn dequeue_swapped(&mut self) -> Option<Order> {
+        let header = self.header_mut();
+
+        let producer_head = header.producer_head.load(Ordering::Acquire).swap_bytes();
+        let consumer_tail = header.consumer_tail.load(Ordering::Relaxed).swap_bytes();
+
+        if consumer_tail == producer_head {
+            return None;
+        }
+
+        let pos = (consumer_tail % QUEUE_CAPACITY as u64) as usize;
+        let order = self.get_order(pos).swap_bytes();
+
+        header
+            .consumer_tail
+            .store((consumer_tail + 1).swap_bytes(), Ordering::Release);
+
+        Some(order)
+    }
+
     pub fn enqueue(&mut self, order: Order) -> Result<(), QueueError> {
+        if self.swapped {
+            return Err(QueueError::ForeignByteOrder);
+        }
+        if self.roles & ROLE_PRODUCER == 0 {
+            self.mark_role(ROLE_PRODUCER);
+        }
+
         let header = self.header_mut();
 
         let consumer_tail = header.consumer_tail.load(Ordering::Acquire);
@@ -194,8 +459,12 @@ impl Queue {
 
     pub fn depth(&self) -> u64 {
         let header = self.header();
-        let producer_head = header.producer_head.load(Ordering::Relaxed);
-        let consumer_tail = header.consumer_tail.load(Ordering::Relaxed);
+        let mut producer_head = header.producer_head.load(Ordering::Relaxed);
+        let mut consumer_tail = header.consumer_tail.load(Ordering::Relaxed);
+        if self.swapped {
+            producer_head = producer_head.swap_bytes();
+            consumer_tail = consumer_tail.swap_bytes();
+        }
         producer_head.saturating_sub(consumer_tail)
     }
 
@@ -222,6 +491,9 @@ impl Queue {
 
 impl Drop for Queue {
     fn drop(&mut self) {
+        if let Some(i) = self.entry {
+            self.header().attached[i].pid.store(0, Ordering::Release);
+        }
         // Flush before closing
         let _ = self.mmap.flush();
         // Unlock pages (memmap2 handles this automatically)
@@ -229,15 +501,32 @@ impl Drop for Queue {
     }
 }
 
+/// Whether `pid` still exists. Without /proc nothing can be told, so
+/// every process counts as alive and no entry is freed.
+fn process_alive(pid: u32) -> bool {
+    let proc = Path::new("/proc");
+    !proc.join("self").exists() || proc.join(pid.to_string()).exists()
+}
+
+/// Inode of our PID namespace, 0 where /proc does not show it.
+fn pid_namespace() -> u32 {
+    use std::os::unix::fs::MetadataExt;
+    std::fs::metadata("/proc/self/ns/pid").map_or(0, |m| m.ino() as u32)
+}
+
 // Error types
 #[derive(Debug)]
 pub enum QueueError {
+    InvalidPath(String),
     FileOpen(String),
+    StreamBusy(String),
     FileStat(String),
     InvalidSize { got: u64, expected: u64 },
     Mmap(String),
     InvalidMagic { got: u32 },
     CapacityMismatch { got: u32, expected: u32 },
+    InvalidByteOrder { got: u32 },
+    ForeignByteOrder,
     CorruptedOrder,
     QueueFull { depth: u64 },
     Flush(String),
@@ -246,7 +535,9 @@ pub enum QueueError {
 impl std::fmt::Display for QueueError {
     fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
         match self {
+            QueueError::InvalidPath(e) => write!(f, "Invalid queue path: {}", e),
             QueueError::FileOpen(e) => write!(f, "Failed to open file: {}", e),
+            QueueError::StreamBusy(e) => write!(f, "Stream busy: {}", e),
             QueueError::FileStat(e) => write!(f, "Failed to stat file: {}", e),
             QueueError::InvalidSize { got, expected } => {
                 write!(f, "Invalid file size: got {}, expected {}", got, expected)
@@ -258,6 +549,12 @@ impl std::fmt::Display for QueueError {
             QueueError::CapacityMismatch { got, expected } => {
                 write!(f, "Capacity mismatch: got {}, expected {}", got, expected)
             }
+            QueueError::InvalidByteOrder { got } => {
+                write!(f, "Invalid byte order mark: got 0x{:08X}", got)
+            }
+            QueueError::ForeignByteOrder => {
+                write!(f, "Queue written with foreign byte order")
+            }
             QueueError::CorruptedOrder => write!(f, "Corrupted order detected"),
             QueueError::QueueFull { depth } => {
                 write!(f, "Queue full - backpressure at depth {}", depth)
@@ -280,8 +577,8 @@ mod tests {
 
     #[test]
     fn test_layout() {
-        assert_eq!(ORDER_SIZE, 48, "Order must be 48 bytes");
-        assert_eq!(HEADER_SIZE, 136, "QueueHeader must be 136 bytes");
+        assert_eq!(ORDER_SIZE, 64, "Order must be 64 bytes");
+        assert_eq!(HEADER_SIZE, 2432, "QueueHeader must be 2432 bytes");
         assert_eq!(
             std::mem::offset_of!(QueueHeader, consumer_tail),
             64,
@@ -294,6 +591,93 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_order_swap_bytes_roundtrip() {
+        let order = Order {
+            order_id: 0x0102030405060708,
+            client_id: 1001,
+            shares_qty: 100,
+            price: 50000,
+            ..Order::default()
+        };
+        let swapped = order.swap_bytes();
+        assert_eq!(swapped.order_id, 0x0807060504030201);
+        assert_eq!(swapped.swap_bytes().price, 50000);
+    }
+
+    #[test]
+    fn test_fingerprint_matches_go() {
+        // the vector in go-oms/queue/fingerprint_test.go
+        let order = Order {
+            order_id: 42,
+            price: 10050,
+            timestamp: 1700000000000000000,
+            expire_at: 1700000060000000000,
+            client_id: 7,
+            shares_qty: 300,
+            symbol: 3,
+            side: 1,
+            time_in_force: TIF_GOOD_TILL_TIME,
+            flags: FLAG_POST_ONLY,
+            sub_account: 2,
+            trigger_price: 10000,
+            ..Order::default()
+        };
+        assert_eq!(order.fingerprint(), 0x51923f63c0ad0678);
+        let filled = Order {
+            timestamp: order.timestamp + 1,
+            status: STATUS_FILLED,
+            fee: -3,
+            ..order
+        };
+        assert_eq!(filled.fingerprint(), order.fingerprint());
+    }
+
+    #[test]
+    fn test_sequencer_gap_and_duplicates() {
+        let mut seq = Sequencer::default();
+        assert_eq!(seq.observe(100), Sequenced::New); // ids may start anywhere
+        assert_eq!(seq.observe(101), Sequenced::New);
+        // 102..=104 lost: ask for them once, and keep 105
+        assert_eq!(seq.observe(105), Sequenced::Gap(102));
+        assert_eq!(seq.observe(106), Sequenced::New);
+        // the resend from 102 on: only the lost ids are new
+        let resent: Vec<_> = (102..=106).map(|id| seq.observe(id)).collect();
+        use Sequenced::{Duplicate, New};
+        assert_eq!(resent, [New, New, New, Duplicate, Duplicate]);
+        assert_eq!(seq.observe(103), Duplicate);
+        assert_eq!(seq.observe(101), Duplicate);
+        assert_eq!(seq.observe(107), New);
+    }
+
+    #[test]
+    fn test_sequencer_partial_fill_of_gap() {
+        let mut seq = Sequencer::default();
+        seq.observe(1);
+        assert_eq!(seq.observe(10), Sequenced::Gap(2));
+        assert_eq!(seq.observe(5), Sequenced::New);
+        assert_eq!(seq.observe(5), Sequenced::Duplicate);
+        assert_eq!(seq.observe(2), Sequenced::New);
+        assert_eq!(seq.observe(9), Sequenced::New);
+        assert_eq!(seq.gaps, [(3, 4), (6, 8)]);
+    }
+
+    #[test]
+    fn test_sequenced_messages() {
+        let new = Order::default();
+        let bust = Order {
+            msg_type: MSG_BUST,
+            ..new
+        };
+        let cancel_all = Order {
+            msg_type: MSG_CANCEL_ALL,
+            ..new
+        };
+        assert!(Sequencer::sequenced(&new));
+        assert!(Sequencer::sequenced(&cancel_all));
+        assert!(!Sequencer::sequenced(&bust));
+    }
+
     #[test]
     fn test_order_default() {
         let order = Order::default();